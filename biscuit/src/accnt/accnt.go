@@ -10,6 +10,11 @@ type Accnt_t struct {
 	// nanoseconds
 	Userns int64
 	Sysns  int64
+	// the user time by scheduling class, defs.SCHED_OTHER or
+	// defs.SCHED_FIFO; included in Userns
+	Classns [2]int64
+	// the largest resident set size in kilobytes
+	Maxrss int
 	// for getting consistent snapshot of both times; not always needed
 	sync.Mutex
 }
@@ -18,6 +23,12 @@ func (a *Accnt_t) Utadd(delta int) {
 	atomic.AddInt64(&a.Userns, int64(delta))
 }
 
+// adds user time of a thread of the scheduling class
+func (a *Accnt_t) Utadd_class(class, delta int) {
+	a.Utadd(delta)
+	atomic.AddInt64(&a.Classns[class], int64(delta))
+}
+
 func (a *Accnt_t) Systadd(delta int) {
 	atomic.AddInt64(&a.Sysns, int64(delta))
 }
@@ -44,6 +55,12 @@ func (a *Accnt_t) Add(n *Accnt_t) {
 	a.Lock()
 	a.Userns += n.Userns
 	a.Sysns += n.Sysns
+	for i := range a.Classns {
+		a.Classns[i] += n.Classns[i]
+	}
+	if n.Maxrss > a.Maxrss {
+		a.Maxrss = n.Maxrss
+	}
 	a.Unlock()
 }
 
@@ -54,8 +71,9 @@ func (a *Accnt_t) Fetch() []uint8 {
 	return ru
 }
 
+// returns a struct rusage; the fields after ru_maxrss are zero
 func (a *Accnt_t) To_rusage() []uint8 {
-	words := 4
+	words := 18
 	ret := make([]uint8, words*8)
 	totv := func(nano int64) (int, int) {
 		secs := int(nano / 1e9)
@@ -75,5 +93,7 @@ func (a *Accnt_t) To_rusage() []uint8 {
 	off += 8
 	util.Writen(ret, 8, off, us)
 	off += 8
+	util.Writen(ret, 8, off, a.Maxrss)
+	off += 8
 	return ret
 }
@@ -54,6 +54,10 @@ func (bm *blockmem_t) Refup(pa mem.Pa_t) {
 	mem.Physmem.Refup(pa)
 }
 
+func (bm *blockmem_t) Mlocked(pa mem.Pa_t) bool {
+	return mem.Physmem.Mlocked(pa)
+}
+
 // returns true if start is asynchronous
 func (ahci *ahci_disk_t) Start(req *fs.Bdev_req_t) bool {
 	ahci.port.start(req)
@@ -405,6 +409,7 @@ const (
 
 	IDE_FEATURE86_LBA48 uint16 = (1 << 10)
 	IDE_STAT_BSY        uint32 = 0x80
+	IDE_STAT_ERR        uint32 = 0x01
 
 	IDE_SATA_NCQ_SUPPORTED   = (1 << 8)
 	IDE_SATA_NCQ_QUEUE_DEPTH = 0x1f
@@ -1015,7 +1020,8 @@ func (p *ahci_port_t) port_intr(ahci *ahci_disk_t) {
 					fmt.Printf("port_intr: ack inflight %v\n", s)
 				}
 				// writing to channel while holding ahci lock, but should be ok
-				p.inflight[s].AckCh <- true
+				ok := LD(&p.port.tfd)&IDE_STAT_ERR == 0
+				p.inflight[s].AckCh <- ok
 
 			}
 			p.inflight[s] = nil
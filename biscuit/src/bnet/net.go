@@ -593,8 +593,22 @@ type tcpbuf_t struct {
 	didseq  bool
 	cond    *sync.Cond
 	pollers *fdops.Pollers_t
+	// page cache pages queued by sendfile(2), whose bytes follow those in
+	// cbuf. only the send buffer uses them; the user cannot write to cbuf
+	// while pages are queued.
+	pgs   []txpg_t
+	pglen int
 }
 
+// the bytes of a referenced page which remain to be acked
+type txpg_t struct {
+	p_pg mem.Pa_t
+	buf  []uint8
+}
+
+// the most bytes of pages which a send buffer queues
+const tcppgmax = 16 * mem.PGSIZE
+
 func (tb *tcpbuf_t) tbuf_init(v []uint8, p_pg mem.Pa_t, tcb *Tcptcb_t) {
 	tb.cbuf.Cb_init_phys(v, p_pg, pagemem)
 	tb.didseq = false
@@ -611,7 +625,41 @@ func (tb *tcpbuf_t) set_seq(seq uint32) {
 }
 
 func (tb *tcpbuf_t) end_seq() uint32 {
-	return uint32(uint(tb.seq) + uint(tb.cbuf.Used()))
+	return uint32(uint(tb.seq) + uint(tb.used()))
+}
+
+// returns the number of bytes which are queued
+func (tb *tcpbuf_t) used() int {
+	return tb.cbuf.Used() + tb.pglen
+}
+
+// queues at most n bytes of pgs, starting at offset off of the first page,
+// after the queued bytes. returns the number of bytes queued.
+func (tb *tcpbuf_t) addpgs(pgs []mem.Mmapinfo_t, off, n int) int {
+	var did int
+	for _, pg := range pgs {
+		c := util.Min(n-did, mem.PGSIZE-off)
+		c = util.Min(c, tcppgmax-tb.pglen)
+		if c <= 0 {
+			break
+		}
+		pagemem.Refup(pg.Phys)
+		buf := mem.Pg2bytes(pg.Pg)[off : off+c]
+		tb.pgs = append(tb.pgs, txpg_t{p_pg: pg.Phys, buf: buf})
+		tb.pglen += c
+		did += c
+		off = 0
+	}
+	return did
+}
+
+// drops the queued pages
+func (tb *tcpbuf_t) pgrelease() {
+	for _, pg := range tb.pgs {
+		pagemem.Refdown(pg.p_pg)
+	}
+	tb.pgs = nil
+	tb.pglen = 0
 }
 
 func (tb *tcpbuf_t) _sanity() {
@@ -669,11 +717,16 @@ func (tb *tcpbuf_t) rcvup(upto uint32) {
 // free up the buffer by advancing the tail (that happens once data is acked).
 func (tb *tcpbuf_t) sysread(nseq uint32, l int) ([]uint8, []uint8) {
 	tb._sanity()
-	if !_seqbetween(tb.seq, nseq, tb.seq+uint32(tb.cbuf.Used())) {
+	if !_seqbetween(tb.seq, nseq, tb.seq+uint32(tb.used())) {
 		panic("bad sequence number")
 	}
 	off := _seqdiff(nseq, tb.seq)
-	s1, s2 := tb.cbuf.Rawread(off)
+	var s1, s2 []uint8
+	if off < tb.cbuf.Used() {
+		s1, s2 = tb.cbuf.Rawread(off)
+	} else {
+		s1, s2 = tb._pgread(off - tb.cbuf.Used())
+	}
 	rl := len(s1) + len(s2)
 	if rl > l {
 		totprune := rl - l
@@ -692,17 +745,48 @@ func (tb *tcpbuf_t) sysread(nseq uint32, l int) ([]uint8, []uint8) {
 	return s1, s2
 }
 
+// returns the bytes of the queued pages starting at off, which are in at most
+// two pages
+func (tb *tcpbuf_t) _pgread(off int) ([]uint8, []uint8) {
+	for i, pg := range tb.pgs {
+		if off >= len(pg.buf) {
+			off -= len(pg.buf)
+			continue
+		}
+		s1 := pg.buf[off:]
+		var s2 []uint8
+		if i+1 < len(tb.pgs) {
+			s2 = tb.pgs[i+1].buf
+		}
+		return s1, s2
+	}
+	return nil, nil
+}
+
 // advances the circular buffer tail by the difference between rack and the
-// current sequence and updates the seqence.
+// current sequence and updates the seqence. acked pages are released.
 func (tb *tcpbuf_t) ackup(rack uint32) {
-	if !_seqbetween(tb.seq, rack, tb.seq+uint32(tb.cbuf.Used())) {
+	if !_seqbetween(tb.seq, rack, tb.seq+uint32(tb.used())) {
 		panic("ack out of window")
 	}
 	sz := _seqdiff(rack, tb.seq)
 	if sz == 0 {
 		return
 	}
-	tb.cbuf.Advtail(sz)
+	c := util.Min(sz, tb.cbuf.Used())
+	tb.cbuf.Advtail(c)
+	for left := sz - c; left > 0; {
+		pg := &tb.pgs[0]
+		if left < len(pg.buf) {
+			pg.buf = pg.buf[left:]
+			tb.pglen -= left
+			break
+		}
+		left -= len(pg.buf)
+		tb.pglen -= len(pg.buf)
+		pagemem.Refdown(pg.p_pg)
+		tb.pgs = tb.pgs[1:]
+	}
 	tb.seq += uint32(sz)
 	tb.cond.Broadcast()
 	tb.pollers.Wakeready(fdops.R_WRITE)
@@ -1706,7 +1790,7 @@ func (tc *Tcptcb_t) incoming(tk tcpkey_t, ip4 *Ip4hdr_t, tcp *Tcphdr_t,
 		// user may queue for send, receive is done
 		tc.estab(tcp, opt, rest)
 		if tc.finacked() {
-			if tc.txbuf.cbuf.Used() != 0 {
+			if tc.txbuf.used() != 0 {
 				panic("closing but txdata remains")
 			}
 			tc.kill()
@@ -1806,6 +1890,8 @@ func (tc *Tcptcb_t) finacked() bool {
 
 func (tc *Tcptcb_t) _bufrelease() {
 	tc._sanity()
+	// the pages can never be sent
+	tc.txbuf.pgrelease()
 	if tc.openc == 0 {
 		tc.txbuf.cbuf.Cb_release()
 		tc.rxbuf.cbuf.Cb_release()
@@ -2450,6 +2536,10 @@ func (tc *Tcptcb_t) uread(dst fdops.Userio_i) (int, defs.Err_t) {
 
 func (tc *Tcptcb_t) uwrite(src fdops.Userio_i) (int, defs.Err_t) {
 	tc._sanity()
+	// the written bytes must follow the queued pages
+	if tc.txbuf.pglen != 0 {
+		return 0, 0
+	}
 	wrote, err := tc.txbuf.cbuf.Copyin(src)
 	if tc.state == ESTAB || tc.state == CLOSEWAIT {
 		tc.seg_maybe()
@@ -2457,6 +2547,15 @@ func (tc *Tcptcb_t) uwrite(src fdops.Userio_i) (int, defs.Err_t) {
 	return wrote, err
 }
 
+func (tc *Tcptcb_t) upages(pgs []mem.Mmapinfo_t, off, n int) int {
+	tc._sanity()
+	did := tc.txbuf.addpgs(pgs, off, n)
+	if did != 0 && (tc.state == ESTAB || tc.state == CLOSEWAIT) {
+		tc.seg_maybe()
+	}
+	return did
+}
+
 func (tc *Tcptcb_t) shutdown(read, write bool) defs.Err_t {
 	tc._sanity()
 	if tc.dead {
@@ -3001,6 +3100,34 @@ func (tf *Tcpfops_t) Write(src fdops.Userio_i) (int, defs.Err_t) {
 	return wrote, err
 }
 
+// queues the pages for transmission without copying them. the pages are
+// referenced until they are acked, thus later writes to the file may change
+// the data which is sent, like on Linux.
+func (tf *Tcpfops_t) Sendpages(pgs []mem.Mmapinfo_t, off,
+	n int) (int, defs.Err_t) {
+	tf.tcb.tcb_lock()
+	defer tf.tcb.tcb_unlock()
+	if err, ok := tf._closed(); !ok {
+		return 0, err
+	}
+	noblk := tf.options&defs.O_NONBLOCK != 0
+	for {
+		if tf.tcb.txdone || tf.tcb.dead {
+			return 0, -defs.EPIPE
+		}
+		did := tf.tcb.upages(pgs, off, n)
+		if did != 0 {
+			return did, 0
+		}
+		if noblk {
+			return 0, -defs.EAGAIN
+		}
+		if err := tf.tcb.tbufwait(); err != 0 {
+			return 0, err
+		}
+	}
+}
+
 func (tf *Tcpfops_t) Truncate(newlen uint) defs.Err_t {
 	return -defs.EINVAL
 }
@@ -3163,7 +3290,8 @@ func (tf *Tcpfops_t) _pollchk(ev fdops.Ready_t) fdops.Ready_t {
 		if ev&fdops.R_HUP != 0 {
 			ret |= fdops.R_HUP
 		}
-	} else if ev&fdops.R_WRITE != 0 && !tf.tcb.txbuf.cbuf.Full() {
+	} else if ev&fdops.R_WRITE != 0 && !tf.tcb.txbuf.cbuf.Full() &&
+		tf.tcb.txbuf.pglen == 0 {
 		ret |= fdops.R_WRITE
 	}
 	return ret
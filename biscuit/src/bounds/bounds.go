@@ -36,11 +36,21 @@ const (
 	B_SYS_BIND
 	B_SYSCALL_T_SYS_CLOSE
 	B_SYSCALL_T_SYS_EXIT
+	B_SYS_CGROUP
 	B_SYS_CHDIR
+	B_SYS_CLONE
+	B_SYS_CLOSERANGE
 	B_SYS_CONNECT
+	B_SYS_DUP
 	B_SYS_DUP2
+	B_SYS_DUP3
+	B_SYS_EPOLLCREATE
+	B_SYS_EPOLLCTL
+	B_SYS_EPOLLWAIT
+	B_SYS_EVENTFD
 	B_SYS_EXECV
 	B_SYS_FCNTL
+	B_SYS_FLOCK
 	B_SYS_FORK
 	B_SYS_FSTAT
 	B_SYS_FTRUNCATE
@@ -48,23 +58,43 @@ const (
 	B_SYS_GETCWD
 	B_SYS_GETPID
 	B_SYS_GETPPID
+	B_SYS_GETPRIORITY
 	B_SYS_GETRLIMIT
 	B_SYS_GETRUSAGE
 	B_SYS_GETSOCKOPT
 	B_SYS_GETTID
 	B_SYS_GETTIMEOFDAY
 	B_SYS_INFO
+	B_SYS_INOTIFYADD
+	B_SYS_INOTIFYINIT
+	B_SYS_INOTIFYRM
+	B_SYS_IOCTL
 	B_SYS_KILL
 	B_SYS_LINK
+	B_SYS_LINUX
 	B_SYS_LISTEN
 	B_SYS_LSEEK
+	B_SYS_MADVISE
 	B_SYS_MKDIR
 	B_SYS_MKNOD
+	B_SYS_MLOCK
+	B_SYS_MLOCKALL
 	B_SYS_MMAP
+	B_SYS_MPROTECT
+	B_SYS_MREMAP
+	B_SYS_MSGCTL
+	B_SYS_MSGGET
+	B_SYS_MSGRCV
+	B_SYS_MSGSND
+	B_SYS_MSYNC
+	B_SYS_MUNLOCK
+	B_SYS_MUNLOCKALL
 	B_SYS_MUNMAP
 	B_SYS_NANOSLEEP
+	B_SYS_OOMADJ
 	B_SYS_OPEN
 	B_SYS_PAUSE
+	B_SYS_PERSONALITY
 	B_SYS_PIPE2
 	B_SYS_POLL
 	B_SYS_PREAD
@@ -76,19 +106,44 @@ const (
 	B_SYS_RECVFROM
 	B_SYS_RECVMSG
 	B_SYS_RENAME
+	B_SYS_SCHED_GETAFFINITY
+	B_SYS_SCHED_GETPARAM
+	B_SYS_SCHED_GETSCHEDULER
+	B_SYS_SCHED_SETAFFINITY
+	B_SYS_SCHED_SETSCHEDULER
+	B_SYS_SEMCTL
+	B_SYS_SEMGET
+	B_SYS_SEMOP
+	B_SYS_SENDFILE
 	B_SYS_SENDMSG
 	B_SYS_SENDTO
+	B_SYS_SETPRIORITY
 	B_SYS_SETRLIMIT
 	B_SYS_SETSOCKOPT
+	B_SYS_SHMAT
+	B_SYS_SHMCTL
+	B_SYS_SHMDT
+	B_SYS_SHMGET
+	B_SYS_SHMOPEN
+	B_SYS_SHMUNLINK
 	B_SYS_SHUTDOWN
 	B_SYS_SIGACTION
+	B_SYS_SIGNALFD
 	B_SYS_SOCKET
 	B_SYS_SOCKETPAIR
+	B_SYS_SPAWN
+	B_SYS_SPLICE
 	B_SYS_STAT
+	B_SYS_SWAPOFF
+	B_SYS_SWAPON
 	B_SYS_SYNC
+	B_SYS_TFDCREATE
+	B_SYS_TFDGETTIME
+	B_SYS_TFDSETTIME
 	B_SYS_THREXIT
 	B_SYS_TRUNCATE
 	B_SYS_UNLINK
+	B_SYS_USERFAULTFD
 	B_SYS_WAIT4
 	B_SYS_WRITE
 	B_SYS_WRITEV
@@ -134,11 +189,21 @@ var boundres = []*res.Res_t {
 	B_SYS_BIND: &res.Res_t{Objs: runtime.Resobjs_t{1: uint32(uint(bounds[B_SYS_BIND]))}},
 	B_SYSCALL_T_SYS_CLOSE: &res.Res_t{Objs: runtime.Resobjs_t{1: uint32(uint(bounds[B_SYSCALL_T_SYS_CLOSE]))}},
 	B_SYSCALL_T_SYS_EXIT: &res.Res_t{Objs: runtime.Resobjs_t{1: uint32(uint(bounds[B_SYSCALL_T_SYS_EXIT]))}},
+	B_SYS_CGROUP: &res.Res_t{Objs: runtime.Resobjs_t{1: uint32(uint(bounds[B_SYS_CGROUP]))}},
 	B_SYS_CHDIR: &res.Res_t{Objs: runtime.Resobjs_t{1: uint32(uint(bounds[B_SYS_CHDIR]))}},
+	B_SYS_CLONE: &res.Res_t{Objs: runtime.Resobjs_t{1: uint32(uint(bounds[B_SYS_CLONE]))}},
+	B_SYS_CLOSERANGE: &res.Res_t{Objs: runtime.Resobjs_t{1: uint32(uint(bounds[B_SYS_CLOSERANGE]))}},
 	B_SYS_CONNECT: &res.Res_t{Objs: runtime.Resobjs_t{1: uint32(uint(bounds[B_SYS_CONNECT]))}},
+	B_SYS_DUP: &res.Res_t{Objs: runtime.Resobjs_t{1: uint32(uint(bounds[B_SYS_DUP]))}},
 	B_SYS_DUP2: &res.Res_t{Objs: runtime.Resobjs_t{1: uint32(uint(bounds[B_SYS_DUP2]))}},
+	B_SYS_DUP3: &res.Res_t{Objs: runtime.Resobjs_t{1: uint32(uint(bounds[B_SYS_DUP3]))}},
+	B_SYS_EPOLLCREATE: &res.Res_t{Objs: runtime.Resobjs_t{1: uint32(uint(bounds[B_SYS_EPOLLCREATE]))}},
+	B_SYS_EPOLLCTL: &res.Res_t{Objs: runtime.Resobjs_t{1: uint32(uint(bounds[B_SYS_EPOLLCTL]))}},
+	B_SYS_EPOLLWAIT: &res.Res_t{Objs: runtime.Resobjs_t{1: uint32(uint(bounds[B_SYS_EPOLLWAIT]))}},
+	B_SYS_EVENTFD: &res.Res_t{Objs: runtime.Resobjs_t{1: uint32(uint(bounds[B_SYS_EVENTFD]))}},
 	B_SYS_EXECV: &res.Res_t{Objs: runtime.Resobjs_t{1: uint32(uint(bounds[B_SYS_EXECV]))}},
 	B_SYS_FCNTL: &res.Res_t{Objs: runtime.Resobjs_t{1: uint32(uint(bounds[B_SYS_FCNTL]))}},
+	B_SYS_FLOCK: &res.Res_t{Objs: runtime.Resobjs_t{1: uint32(uint(bounds[B_SYS_FLOCK]))}},
 	B_SYS_FORK: &res.Res_t{Objs: runtime.Resobjs_t{1: uint32(uint(bounds[B_SYS_FORK]))}},
 	B_SYS_FSTAT: &res.Res_t{Objs: runtime.Resobjs_t{1: uint32(uint(bounds[B_SYS_FSTAT]))}},
 	B_SYS_FTRUNCATE: &res.Res_t{Objs: runtime.Resobjs_t{1: uint32(uint(bounds[B_SYS_FTRUNCATE]))}},
@@ -146,23 +211,43 @@ var boundres = []*res.Res_t {
 	B_SYS_GETCWD: &res.Res_t{Objs: runtime.Resobjs_t{1: uint32(uint(bounds[B_SYS_GETCWD]))}},
 	B_SYS_GETPID: &res.Res_t{Objs: runtime.Resobjs_t{1: uint32(uint(bounds[B_SYS_GETPID]))}},
 	B_SYS_GETPPID: &res.Res_t{Objs: runtime.Resobjs_t{1: uint32(uint(bounds[B_SYS_GETPPID]))}},
+	B_SYS_GETPRIORITY: &res.Res_t{Objs: runtime.Resobjs_t{1: uint32(uint(bounds[B_SYS_GETPRIORITY]))}},
 	B_SYS_GETRLIMIT: &res.Res_t{Objs: runtime.Resobjs_t{1: uint32(uint(bounds[B_SYS_GETRLIMIT]))}},
 	B_SYS_GETRUSAGE: &res.Res_t{Objs: runtime.Resobjs_t{1: uint32(uint(bounds[B_SYS_GETRUSAGE]))}},
 	B_SYS_GETSOCKOPT: &res.Res_t{Objs: runtime.Resobjs_t{1: uint32(uint(bounds[B_SYS_GETSOCKOPT]))}},
 	B_SYS_GETTID: &res.Res_t{Objs: runtime.Resobjs_t{1: uint32(uint(bounds[B_SYS_GETTID]))}},
 	B_SYS_GETTIMEOFDAY: &res.Res_t{Objs: runtime.Resobjs_t{1: uint32(uint(bounds[B_SYS_GETTIMEOFDAY]))}},
 	B_SYS_INFO: &res.Res_t{Objs: runtime.Resobjs_t{1: uint32(uint(bounds[B_SYS_INFO]))}},
+	B_SYS_INOTIFYADD: &res.Res_t{Objs: runtime.Resobjs_t{1: uint32(uint(bounds[B_SYS_INOTIFYADD]))}},
+	B_SYS_INOTIFYINIT: &res.Res_t{Objs: runtime.Resobjs_t{1: uint32(uint(bounds[B_SYS_INOTIFYINIT]))}},
+	B_SYS_INOTIFYRM: &res.Res_t{Objs: runtime.Resobjs_t{1: uint32(uint(bounds[B_SYS_INOTIFYRM]))}},
+	B_SYS_IOCTL: &res.Res_t{Objs: runtime.Resobjs_t{1: uint32(uint(bounds[B_SYS_IOCTL]))}},
 	B_SYS_KILL: &res.Res_t{Objs: runtime.Resobjs_t{1: uint32(uint(bounds[B_SYS_KILL]))}},
 	B_SYS_LINK: &res.Res_t{Objs: runtime.Resobjs_t{1: uint32(uint(bounds[B_SYS_LINK]))}},
+	B_SYS_LINUX: &res.Res_t{Objs: runtime.Resobjs_t{1: uint32(uint(bounds[B_SYS_LINUX]))}},
 	B_SYS_LISTEN: &res.Res_t{Objs: runtime.Resobjs_t{1: uint32(uint(bounds[B_SYS_LISTEN]))}},
 	B_SYS_LSEEK: &res.Res_t{Objs: runtime.Resobjs_t{1: uint32(uint(bounds[B_SYS_LSEEK]))}},
+	B_SYS_MADVISE: &res.Res_t{Objs: runtime.Resobjs_t{1: uint32(uint(bounds[B_SYS_MADVISE]))}},
 	B_SYS_MKDIR: &res.Res_t{Objs: runtime.Resobjs_t{1: uint32(uint(bounds[B_SYS_MKDIR]))}},
 	B_SYS_MKNOD: &res.Res_t{Objs: runtime.Resobjs_t{1: uint32(uint(bounds[B_SYS_MKNOD]))}},
+	B_SYS_MLOCK: &res.Res_t{Objs: runtime.Resobjs_t{1: uint32(uint(bounds[B_SYS_MLOCK]))}},
+	B_SYS_MLOCKALL: &res.Res_t{Objs: runtime.Resobjs_t{1: uint32(uint(bounds[B_SYS_MLOCKALL]))}},
 	B_SYS_MMAP: &res.Res_t{Objs: runtime.Resobjs_t{1: uint32(uint(bounds[B_SYS_MMAP]))}},
+	B_SYS_MPROTECT: &res.Res_t{Objs: runtime.Resobjs_t{1: uint32(uint(bounds[B_SYS_MPROTECT]))}},
+	B_SYS_MREMAP: &res.Res_t{Objs: runtime.Resobjs_t{1: uint32(uint(bounds[B_SYS_MREMAP]))}},
+	B_SYS_MSGCTL: &res.Res_t{Objs: runtime.Resobjs_t{1: uint32(uint(bounds[B_SYS_MSGCTL]))}},
+	B_SYS_MSGGET: &res.Res_t{Objs: runtime.Resobjs_t{1: uint32(uint(bounds[B_SYS_MSGGET]))}},
+	B_SYS_MSGRCV: &res.Res_t{Objs: runtime.Resobjs_t{1: uint32(uint(bounds[B_SYS_MSGRCV]))}},
+	B_SYS_MSGSND: &res.Res_t{Objs: runtime.Resobjs_t{1: uint32(uint(bounds[B_SYS_MSGSND]))}},
+	B_SYS_MSYNC: &res.Res_t{Objs: runtime.Resobjs_t{1: uint32(uint(bounds[B_SYS_MSYNC]))}},
+	B_SYS_MUNLOCK: &res.Res_t{Objs: runtime.Resobjs_t{1: uint32(uint(bounds[B_SYS_MUNLOCK]))}},
+	B_SYS_MUNLOCKALL: &res.Res_t{Objs: runtime.Resobjs_t{1: uint32(uint(bounds[B_SYS_MUNLOCKALL]))}},
 	B_SYS_MUNMAP: &res.Res_t{Objs: runtime.Resobjs_t{1: uint32(uint(bounds[B_SYS_MUNMAP]))}},
 	B_SYS_NANOSLEEP: &res.Res_t{Objs: runtime.Resobjs_t{1: uint32(uint(bounds[B_SYS_NANOSLEEP]))}},
+	B_SYS_OOMADJ: &res.Res_t{Objs: runtime.Resobjs_t{1: uint32(uint(bounds[B_SYS_OOMADJ]))}},
 	B_SYS_OPEN: &res.Res_t{Objs: runtime.Resobjs_t{1: uint32(uint(bounds[B_SYS_OPEN]))}},
 	B_SYS_PAUSE: &res.Res_t{Objs: runtime.Resobjs_t{1: uint32(uint(bounds[B_SYS_PAUSE]))}},
+	B_SYS_PERSONALITY: &res.Res_t{Objs: runtime.Resobjs_t{1: uint32(uint(bounds[B_SYS_PERSONALITY]))}},
 	B_SYS_PIPE2: &res.Res_t{Objs: runtime.Resobjs_t{1: uint32(uint(bounds[B_SYS_PIPE2]))}},
 	B_SYS_POLL: &res.Res_t{Objs: runtime.Resobjs_t{1: uint32(uint(bounds[B_SYS_POLL]))}},
 	B_SYS_PREAD: &res.Res_t{Objs: runtime.Resobjs_t{1: uint32(uint(bounds[B_SYS_PREAD]))}},
@@ -174,19 +259,44 @@ var boundres = []*res.Res_t {
 	B_SYS_RECVFROM: &res.Res_t{Objs: runtime.Resobjs_t{1: uint32(uint(bounds[B_SYS_RECVFROM]))}},
 	B_SYS_RECVMSG: &res.Res_t{Objs: runtime.Resobjs_t{1: uint32(uint(bounds[B_SYS_RECVMSG]))}},
 	B_SYS_RENAME: &res.Res_t{Objs: runtime.Resobjs_t{1: uint32(uint(bounds[B_SYS_RENAME]))}},
+	B_SYS_SCHED_GETAFFINITY: &res.Res_t{Objs: runtime.Resobjs_t{1: uint32(uint(bounds[B_SYS_SCHED_GETAFFINITY]))}},
+	B_SYS_SCHED_GETPARAM: &res.Res_t{Objs: runtime.Resobjs_t{1: uint32(uint(bounds[B_SYS_SCHED_GETPARAM]))}},
+	B_SYS_SCHED_GETSCHEDULER: &res.Res_t{Objs: runtime.Resobjs_t{1: uint32(uint(bounds[B_SYS_SCHED_GETSCHEDULER]))}},
+	B_SYS_SCHED_SETAFFINITY: &res.Res_t{Objs: runtime.Resobjs_t{1: uint32(uint(bounds[B_SYS_SCHED_SETAFFINITY]))}},
+	B_SYS_SCHED_SETSCHEDULER: &res.Res_t{Objs: runtime.Resobjs_t{1: uint32(uint(bounds[B_SYS_SCHED_SETSCHEDULER]))}},
+	B_SYS_SEMCTL: &res.Res_t{Objs: runtime.Resobjs_t{1: uint32(uint(bounds[B_SYS_SEMCTL]))}},
+	B_SYS_SEMGET: &res.Res_t{Objs: runtime.Resobjs_t{1: uint32(uint(bounds[B_SYS_SEMGET]))}},
+	B_SYS_SEMOP: &res.Res_t{Objs: runtime.Resobjs_t{1: uint32(uint(bounds[B_SYS_SEMOP]))}},
+	B_SYS_SENDFILE: &res.Res_t{Objs: runtime.Resobjs_t{1: uint32(uint(bounds[B_SYS_SENDFILE]))}},
 	B_SYS_SENDMSG: &res.Res_t{Objs: runtime.Resobjs_t{1: uint32(uint(bounds[B_SYS_SENDMSG]))}},
 	B_SYS_SENDTO: &res.Res_t{Objs: runtime.Resobjs_t{1: uint32(uint(bounds[B_SYS_SENDTO]))}},
+	B_SYS_SETPRIORITY: &res.Res_t{Objs: runtime.Resobjs_t{1: uint32(uint(bounds[B_SYS_SETPRIORITY]))}},
 	B_SYS_SETRLIMIT: &res.Res_t{Objs: runtime.Resobjs_t{1: uint32(uint(bounds[B_SYS_SETRLIMIT]))}},
 	B_SYS_SETSOCKOPT: &res.Res_t{Objs: runtime.Resobjs_t{1: uint32(uint(bounds[B_SYS_SETSOCKOPT]))}},
+	B_SYS_SHMAT: &res.Res_t{Objs: runtime.Resobjs_t{1: uint32(uint(bounds[B_SYS_SHMAT]))}},
+	B_SYS_SHMCTL: &res.Res_t{Objs: runtime.Resobjs_t{1: uint32(uint(bounds[B_SYS_SHMCTL]))}},
+	B_SYS_SHMDT: &res.Res_t{Objs: runtime.Resobjs_t{1: uint32(uint(bounds[B_SYS_SHMDT]))}},
+	B_SYS_SHMGET: &res.Res_t{Objs: runtime.Resobjs_t{1: uint32(uint(bounds[B_SYS_SHMGET]))}},
+	B_SYS_SHMOPEN: &res.Res_t{Objs: runtime.Resobjs_t{1: uint32(uint(bounds[B_SYS_SHMOPEN]))}},
+	B_SYS_SHMUNLINK: &res.Res_t{Objs: runtime.Resobjs_t{1: uint32(uint(bounds[B_SYS_SHMUNLINK]))}},
 	B_SYS_SHUTDOWN: &res.Res_t{Objs: runtime.Resobjs_t{1: uint32(uint(bounds[B_SYS_SHUTDOWN]))}},
 	B_SYS_SIGACTION: &res.Res_t{Objs: runtime.Resobjs_t{1: uint32(uint(bounds[B_SYS_SIGACTION]))}},
+	B_SYS_SIGNALFD: &res.Res_t{Objs: runtime.Resobjs_t{1: uint32(uint(bounds[B_SYS_SIGNALFD]))}},
 	B_SYS_SOCKET: &res.Res_t{Objs: runtime.Resobjs_t{1: uint32(uint(bounds[B_SYS_SOCKET]))}},
 	B_SYS_SOCKETPAIR: &res.Res_t{Objs: runtime.Resobjs_t{1: uint32(uint(bounds[B_SYS_SOCKETPAIR]))}},
+	B_SYS_SPAWN: &res.Res_t{Objs: runtime.Resobjs_t{1: uint32(uint(bounds[B_SYS_SPAWN]))}},
+	B_SYS_SPLICE: &res.Res_t{Objs: runtime.Resobjs_t{1: uint32(uint(bounds[B_SYS_SPLICE]))}},
 	B_SYS_STAT: &res.Res_t{Objs: runtime.Resobjs_t{1: uint32(uint(bounds[B_SYS_STAT]))}},
+	B_SYS_SWAPOFF: &res.Res_t{Objs: runtime.Resobjs_t{1: uint32(uint(bounds[B_SYS_SWAPOFF]))}},
+	B_SYS_SWAPON: &res.Res_t{Objs: runtime.Resobjs_t{1: uint32(uint(bounds[B_SYS_SWAPON]))}},
 	B_SYS_SYNC: &res.Res_t{Objs: runtime.Resobjs_t{1: uint32(uint(bounds[B_SYS_SYNC]))}},
+	B_SYS_TFDCREATE: &res.Res_t{Objs: runtime.Resobjs_t{1: uint32(uint(bounds[B_SYS_TFDCREATE]))}},
+	B_SYS_TFDGETTIME: &res.Res_t{Objs: runtime.Resobjs_t{1: uint32(uint(bounds[B_SYS_TFDGETTIME]))}},
+	B_SYS_TFDSETTIME: &res.Res_t{Objs: runtime.Resobjs_t{1: uint32(uint(bounds[B_SYS_TFDSETTIME]))}},
 	B_SYS_THREXIT: &res.Res_t{Objs: runtime.Resobjs_t{1: uint32(uint(bounds[B_SYS_THREXIT]))}},
 	B_SYS_TRUNCATE: &res.Res_t{Objs: runtime.Resobjs_t{1: uint32(uint(bounds[B_SYS_TRUNCATE]))}},
 	B_SYS_UNLINK: &res.Res_t{Objs: runtime.Resobjs_t{1: uint32(uint(bounds[B_SYS_UNLINK]))}},
+	B_SYS_USERFAULTFD: &res.Res_t{Objs: runtime.Resobjs_t{1: uint32(uint(bounds[B_SYS_USERFAULTFD]))}},
 	B_SYS_WAIT4: &res.Res_t{Objs: runtime.Resobjs_t{1: uint32(uint(bounds[B_SYS_WAIT4]))}},
 	B_SYS_WRITE: &res.Res_t{Objs: runtime.Resobjs_t{1: uint32(uint(bounds[B_SYS_WRITE]))}},
 	B_SYS_WRITEV: &res.Res_t{Objs: runtime.Resobjs_t{1: uint32(uint(bounds[B_SYS_WRITEV]))}},
@@ -228,11 +338,21 @@ var bounds = []int{
 	B_SYS_BIND: 1345 * 48 + 898 * 32 + 1 * 208 + 84 * 120 + 3 * 1 + 561 * 14 + 3 * 8 + 1 * 56 + 282 * 16 + 1 * 1656 + 8 * 824 + 96 * 24 + 1 * 280 + 1 * 4096 + 3 * 64 + 580 * 40 + 120 * 216 + 1 * 20,
 	B_SYSCALL_T_SYS_CLOSE: 1 * 24 + 2 * 56 + 1 * 144,
 	B_SYSCALL_T_SYS_EXIT: 2 * 24 + 1 * 8 + 2 * 56 + 1 * 144,
+	B_SYS_CGROUP: 1 * 24 + 1 * 112 + 1 * 80 + 2 * 56 + 2 * 144,
 	B_SYS_CHDIR: 295 * 16 + 110 * 24 + 561 * 14 + 3 * 64 + 659 * 40 + 95 * 120 + 3 * 8 + 1011 * 32 + 9 * 824 + 1 * 20 + 137 * 216 + 4 * 536 + 3 * 1 + 1 * 4096 + 1377 * 48,
+	B_SYS_CLONE: (1554) * 216 + (1554) * 40 + (1554) * 48 + (512) * 24 + (1024) * 40 + (1024) * 112 + 2 * 1 + 63 * 40 + 14 * 48 + 1 * 1600 + 1 * 192 + 2 * 8 + 13 * 16 + 1 * 4120 + 114 * 32 + 6 * 56 + 1 * 376 + 14 * 24 + 1 * 824 + 11 * 120 + 1 * 144 + 1 * 96,
+	B_SYS_CLOSERANGE: 2 * 24 + 1 * 40 + 1 * 48 + 1 * 216 + 2 * 56 + 1 * 144,
 	B_SYS_CONNECT: 36 * 120 + 3 * 56 + 187 * 14 + 1 * 72 + 1 * 280 + 602 * 40 + 529 * 32 + 1 * 200 + 644 * 48 + 138 * 216 + 130 * 16 + 4 * 824 + 131 * 24 + 1 * 12 + 1 * 96 + 1 * 8192,
+	B_SYS_DUP: 2 * 24 + 1 * 40 + 1 * 48 + 1 * 216 + 2 * 56 + 1 * 144,
 	B_SYS_DUP2: 2 * 24 + 1 * 40 + 1 * 48 + 1 * 216 + 2 * 56 + 1 * 144,
+	B_SYS_DUP3: 2 * 24 + 1 * 40 + 1 * 48 + 1 * 216 + 2 * 56 + 1 * 144,
+	B_SYS_EPOLLCREATE: 1 * 24 + 1 * 112 + 1 * 80 + 2 * 56 + 2 * 144,
+	B_SYS_EPOLLCTL: 1 * 24 + 1 * 112 + 1 * 80 + 2 * 56 + 2 * 144,
+	B_SYS_EPOLLWAIT: 1 * 24 + 1 * 112 + 1 * 80 + 2 * 56 + 2 * 144,
+	B_SYS_EVENTFD: 1 * 24 + 1 * 112 + 1 * 80 + 2 * 56 + 2 * 144,
 	B_SYS_EXECV: 1 * 4096 + 1 * 288 + 1786 * 48 + 561 * 14 + 4 * 8 + 1 * 240 + 1 * 10 + 4 * 1048 + 365 * 216 + 1703 * 40 + 1 * 1560 + 1 * 56 + 3 * 64 + 464 * 16 + 2480 * 32 + 279 * 24 + 7 * 112 + 1 * 512 + 1 * 1 + 1 * 20 + 6 * 536 + 238 * 120 + 22 * 824,
-	B_SYS_FCNTL: 0,
+	B_SYS_FCNTL: 1 * 24 + 1 * 112 + 1 * 80 + 2 * 56 + 2 * 144,
+	B_SYS_FLOCK: 1 * 24 + 1 * 112 + 1 * 80 + 2 * 56 + 2 * 144,
 	B_SYS_FORK: (1554) * 216 + (1554) * 40 + (1554) * 48 + (512) * 24 + (1024) * 40 + (1024) * 112 + 2 * 1 + 63 * 40 + 14 * 48 + 1 * 1600 + 1 * 192 + 2 * 8 + 13 * 16 + 1 * 4120 + 114 * 32 + 6 * 56 + 1 * 376 + 14 * 24 + 1 * 824 + 11 * 120 + 1 * 144,
 	B_SYS_FSTAT: 2 * 824 + 1 * 1 + 1 * 20 + 36 * 48 + 19 * 216 + 11 * 120 + 3 * 64 + 1 * 72 + 217 * 32 + 14 * 24 + 1 * 4096 + 14 * 16 + 86 * 40 + 1 * 8,
 	B_SYS_FTRUNCATE: 32 * 48 + 1 * 824 + 13 * 16 + 13 * 24 + 12 * 120 + 1 * 1 + 1 * 20 + 117 * 32 + 81 * 40 + 17 * 216 + 1 * 4096 + 1 * 8 + 3 * 64,
@@ -240,23 +360,43 @@ var bounds = []int{
 	B_SYS_GETCWD: 63 * 48 + 22 * 120 + 1 * 4096 + 1 * 20 + 2 * 824 + 26 * 24 + 1 * 8 + 230 * 32 + 26 * 16 + 34 * 216 + 159 * 40 + 2 * 1 + 3 * 64,
 	B_SYS_GETPID: 0,
 	B_SYS_GETPPID: 0,
+	B_SYS_GETPRIORITY: 1 * 16,
 	B_SYS_GETRLIMIT: 44 * 120 + 52 * 24 + 1 * 1 + 1 * 4096 + 1 * 8 + 125 * 48 + 455 * 32 + 317 * 40 + 4 * 824 + 68 * 216 + 52 * 16 + 3 * 64 + 1 * 20,
 	B_SYS_GETRUSAGE: 13 * 16 + 116 * 32 + 1 * 56 + 1 * 824 + 1 * 20 + 32 * 48 + 80 * 40 + 17 * 216 + 14 * 24 + 1 * 8 + 11 * 120 + 1 * 4096 + 1 * 1 + 3 * 64,
 	B_SYS_GETSOCKOPT: 3 * 64 + 569 * 32 + 65 * 16 + 5 * 824 + 65 * 24 + 55 * 120 + 85 * 216 + 2 * 8 + 396 * 40 + 156 * 48 + 1 * 4096 + 1 * 1 + 1 * 20,
 	B_SYS_GETTID: 0,
 	B_SYS_GETTIMEOFDAY: 3 * 64 + 1 * 824 + 13 * 24 + 17 * 216 + 1 * 4096 + 13 * 16 + 1 * 8 + 1 * 1 + 1 * 20 + 32 * 48 + 116 * 32 + 81 * 40 + 11 * 120,
 	B_SYS_INFO: 1 * 5776 + 1 * 32,
+	B_SYS_INOTIFYADD: 1 * 24 + 1 * 112 + 1 * 80 + 2 * 56 + 2 * 144,
+	B_SYS_INOTIFYINIT: 1 * 24 + 1 * 112 + 1 * 80 + 2 * 56 + 2 * 144,
+	B_SYS_INOTIFYRM: 1 * 24 + 1 * 112 + 1 * 80 + 2 * 56 + 2 * 144,
+	B_SYS_IOCTL: 1 * 24 + 1 * 112 + 1 * 80 + 2 * 56 + 2 * 144,
 	B_SYS_KILL: 0,
 	B_SYS_LINK: 2014 * 48 + 6 * 536 + 748 * 14 + 3 * 1 + 1 * 4096 + 1 * 20 + 236 * 24 + 3 * 8 + 1338 * 32 + 130 * 120 + 272 * 216 + 422 * 16 + 11 * 824 + 1247 * 40 + 3 * 64,
+	B_SYS_LINUX: 1 * 144 + 2 * 32,
 	B_SYS_LISTEN: 1 * 56 + 1 * 136 + 1 * 75776 + 2 * 4120,
 	B_SYS_LSEEK: 1 * 20 + 5 * 48 + 103 * 32 + 1 * 24 + 1 * 72 + 3 * 64 + 2 * 16 + 2 * 216 + 6 * 40 + 1 * 824,
+	B_SYS_MADVISE: 1 * 24 + 1 * 112 + 1 * 80 + 2 * 56 + 2 * 144,
 	B_SYS_MKDIR: 3 * 64 + 3068 * 48 + 3 * 536 + 244 * 216 + 753 * 16 + 11 * 824 + 1190 * 40 + 177 * 120 + 3 * 1 + 1 * 4096 + 1 * 20 + 1298 * 32 + 195 * 24 + 1 * 2 + 1309 * 14 + 3 * 8,
 	B_SYS_MKNOD: 9 * 824 + 1011 * 32 + 109 * 24 + 295 * 16 + 1376 * 48 + 3 * 8 + 3 * 1 + 3 * 64 + 659 * 40 + 3 * 536 + 137 * 216 + 561 * 14 + 95 * 120 + 1 * 4096 + 1 * 20,
+	B_SYS_MLOCK: 1 * 24 + 1 * 112 + 1 * 80 + 2 * 56 + 2 * 144,
+	B_SYS_MLOCKALL: 1 * 24 + 1 * 112 + 1 * 80 + 2 * 56 + 2 * 144,
 	B_SYS_MMAP: 1 * 216 + 1 * 80 + 1 * 144 + 2 * 56 + 1 * 24 + 2 * 40 + 1 * 48 + 2 * 112,
+	B_SYS_MPROTECT: 1 * 24 + 1 * 112 + 1 * 80 + 2 * 56 + 1 * 144,
+	B_SYS_MREMAP: 1 * 24 + 1 * 112 + 1 * 80 + 2 * 56 + 2 * 144,
+	B_SYS_MSGCTL: 1 * 24 + 1 * 112 + 1 * 80 + 2 * 56 + 2 * 144,
+	B_SYS_MSGGET: 1 * 24 + 1 * 112 + 1 * 80 + 2 * 56 + 2 * 144,
+	B_SYS_MSGRCV: 1 * 24 + 1 * 112 + 1 * 80 + 2 * 56 + 2 * 144,
+	B_SYS_MSGSND: 1 * 24 + 1 * 112 + 1 * 80 + 2 * 56 + 2 * 144,
+	B_SYS_MSYNC: 1 * 24 + 1 * 112 + 1 * 80 + 2 * 56 + 2 * 144,
+	B_SYS_MUNLOCK: 1 * 24 + 1 * 112 + 1 * 80 + 2 * 56 + 2 * 144,
+	B_SYS_MUNLOCKALL: 1 * 24 + 1 * 112 + 1 * 80 + 2 * 56 + 2 * 144,
 	B_SYS_MUNMAP: 1 * 24 + 1 * 112 + 1 * 80 + 2 * 56 + 1 * 144,
 	B_SYS_NANOSLEEP: 1 * 20 + 52 * 16 + 4 * 824 + 317 * 40 + 455 * 32 + 52 * 24 + 1 * 4096 + 1 * 8 + 1 * 1 + 125 * 48 + 68 * 216 + 44 * 120 + 3 * 64,
+	B_SYS_OOMADJ: 1 * 24 + 1 * 112 + 1 * 80 + 2 * 56 + 2 * 144,
 	B_SYS_OPEN: 1 * 20 + 95 * 120 + 110 * 24 + 659 * 40 + 1 * 4096 + 3 * 1 + 3 * 64 + 1377 * 48 + 137 * 216 + 295 * 16 + 9 * 824 + 3 * 8 + 1 * 4120 + 1011 * 32 + 3 * 536 + 561 * 14,
 	B_SYS_PAUSE: 0,
+	B_SYS_PERSONALITY: 0,
 	B_SYS_PIPE2: 56 * 24 + 317 * 40 + 455 * 32 + 68 * 216 + 52 * 16 + 2 * 56 + 2 * 4120 + 1 * 200 + 44 * 120 + 4 * 824 + 1 * 1 + 3 * 64 + 125 * 48 + 1 * 4096 + 1 * 8 + 1 * 20,
 	B_SYS_POLL: (1024) * 240 + (512) * 32 + 2 * 824 + 22 * 120 + 34 * 216 + 1 * 8 + 1 * 20 + 229 * 32 + 1 * 1 + 26 * 16 + 1 * 4120 + 159 * 40 + 63 * 48 + 1 * 4096 + 27 * 24 + 3 * 64,
 	B_SYS_PREAD: 238 * 40 + 33 * 120 + 3 * 824 + 344 * 32 + 1 * 112 + 1 * 20 + 3 * 64 + 94 * 48 + 51 * 216 + 1 * 8 + 1 * 1 + 39 * 24 + 39 * 16 + 1 * 4096,
@@ -268,19 +408,44 @@ var bounds = []int{
 	B_SYS_RECVFROM: 1 * 4120 + 1 * 8 + 1023 * 32 + 280 * 48 + 9 * 824 + 1 * 1 + 1 * 20 + 117 * 24 + 118 * 16 + 2 * 536 + 153 * 216 + 712 * 40 + 1 * 4096 + 99 * 120 + 3 * 64,
 	B_SYS_RECVMSG: 838 * 48 + 352 * 16 + 27 * 824 + 1 * 1 + 1 * 184 + 459 * 216 + 297 * 120 + 2 * 536 + 1 * 8 + 351 * 24 + 3057 * 32 + 2135 * 40 + 1 * 4096 + 1 * 20 + 1 * 4120 + 3 * 64,
 	B_SYS_RENAME: 28 * 824 + 983 * 216 + 864 * 24 + 6 * 536 + 4538 * 40 + 3666 * 32 + 469 * 120 + 3 * 2 + 7 * 8 + 4 * 56 + 1803 * 16 + 1 * 4096 + 3 * 1 + 3 * 64 + 1 * 20 + 3553 * 14 + 8970 * 48,
+	B_SYS_SCHED_GETAFFINITY: 0,
+	B_SYS_SCHED_GETPARAM: 0,
+	B_SYS_SCHED_GETSCHEDULER: 0,
+	B_SYS_SCHED_SETAFFINITY: 0,
+	B_SYS_SCHED_SETSCHEDULER: 0,
+	B_SYS_SEMCTL: 1 * 24 + 1 * 112 + 1 * 80 + 2 * 56 + 2 * 144,
+	B_SYS_SEMGET: 1 * 24 + 1 * 112 + 1 * 80 + 2 * 56 + 2 * 144,
+	B_SYS_SEMOP: 1 * 24 + 1 * 112 + 1 * 80 + 2 * 56 + 2 * 144,
+	B_SYS_SENDFILE: 1 * 24 + 1 * 112 + 1 * 80 + 2 * 56 + 2 * 144,
 	B_SYS_SENDMSG: 2909 * 32 + 1 * 280 + 2262 * 40 + 3 * 64 + 404 * 24 + 1 * 20 + 1296 * 48 + 187 * 14 + 495 * 216 + 1 * 72 + 3 * 8 + 1 * 4096 + 403 * 16 + 267 * 120 + 1 * 88 + 25 * 824 + 1 * 184 + 3 * 1,
 	B_SYS_SENDTO: 918 * 40 + 988 * 32 + 182 * 16 + 80 * 120 + 1 * 72 + 1 * 280 + 206 * 216 + 3 * 8 + 1 * 4096 + 1 * 20 + 8 * 824 + 187 * 14 + 3 * 1 + 3 * 64 + 183 * 24 + 769 * 48,
+	B_SYS_SETPRIORITY: 1 * 16,
 	B_SYS_SETRLIMIT: 2 * 824 + 159 * 40 + 34 * 216 + 26 * 16 + 1 * 4096 + 1 * 8 + 1 * 1 + 3 * 64 + 1 * 20 + 229 * 32 + 63 * 48 + 26 * 24 + 22 * 120,
 	B_SYS_SETSOCKOPT: 159 * 40 + 26 * 16 + 1 * 4096 + 1 * 1 + 3 * 64 + 1 * 20 + 63 * 48 + 22 * 120 + 2 * 824 + 230 * 32 + 34 * 216 + 26 * 24 + 1 * 8,
+	B_SYS_SHMAT: 1 * 24 + 1 * 112 + 1 * 80 + 2 * 56 + 2 * 144,
+	B_SYS_SHMCTL: 1 * 24 + 1 * 112 + 1 * 80 + 2 * 56 + 2 * 144,
+	B_SYS_SHMDT: 1 * 24 + 1 * 112 + 1 * 80 + 2 * 56 + 2 * 144,
+	B_SYS_SHMGET: 1 * 24 + 1 * 112 + 1 * 80 + 2 * 56 + 2 * 144,
+	B_SYS_SHMOPEN: 1 * 24 + 1 * 112 + 1 * 80 + 2 * 56 + 2 * 144,
+	B_SYS_SHMUNLINK: 1 * 24 + 1 * 112 + 1 * 80 + 2 * 56 + 2 * 144,
 	B_SYS_SHUTDOWN: 2 * 56 + 1 * 144 + 1 * 24,
 	B_SYS_SIGACTION: 0,
+	B_SYS_SIGNALFD: 1 * 24 + 1 * 112 + 1 * 80 + 2 * 56 + 2 * 144,
 	B_SYS_SOCKET: 1 * 16 + 1 * 608 + 2 * 24 + 1 * 144 + 2 * 56 + 1 * 4120,
 	B_SYS_SOCKETPAIR: 2 * 4120 + 455 * 32 + 1 * 8 + 125 * 48 + 4 * 824 + 2 * 72 + 58 * 24 + 2 * 200 + 44 * 120 + 317 * 40 + 52 * 16 + 4 * 56 + 68 * 216 + 1 * 4096 + 1 * 1 + 3 * 64 + 1 * 20,
+	B_SYS_SPAWN: 1 * 4096 + 1 * 288 + 1786 * 48 + 561 * 14 + 4 * 8 + 1 * 240 + 1 * 10 + 4 * 1048 + 365 * 216 + 1703 * 40 + 1 * 1560 + 1 * 56 + 3 * 64 + 464 * 16 + 2480 * 32 + 279 * 24 + 7 * 112 + 1 * 512 + 1 * 1 + 1 * 20 + 6 * 536 + 238 * 120 + 22 * 824 + 1 * 216 + 1 * 112 + 64 * 40 + 64 * 824,
+	B_SYS_SPLICE: 1 * 24 + 1 * 112 + 1 * 80 + 2 * 56 + 2 * 144,
 	B_SYS_STAT: 3 * 8 + 3 * 1 + 1 * 72 + 58 * 120 + 1 * 4096 + 707 * 48 + 760 * 32 + 6 * 824 + 187 * 14 + 3 * 536 + 172 * 216 + 157 * 24 + 3 * 64 + 156 * 16 + 760 * 40 + 1 * 20,
+	B_SYS_SWAPOFF: 1 * 24 + 1 * 4096,
+	B_SYS_SWAPON: 1 * 24 + 1 * 48 + 2 * 16 + 1 * 4096 + 1 * 64,
 	B_SYS_SYNC: 3 * 16,
+	B_SYS_TFDCREATE: 1 * 24 + 1 * 112 + 1 * 80 + 2 * 56 + 2 * 144,
+	B_SYS_TFDGETTIME: 1 * 24 + 1 * 112 + 1 * 80 + 2 * 56 + 2 * 144,
+	B_SYS_TFDSETTIME: 1 * 24 + 1 * 112 + 1 * 80 + 2 * 56 + 2 * 144,
 	B_SYS_THREXIT: 2 * 24 + 1 * 8 + 1 * 144 + 2 * 56,
 	B_SYS_TRUNCATE: 1124 * 32 + 3 * 8 + 3 * 1 + 3 * 64 + 154 * 216 + 123 * 24 + 1408 * 48 + 308 * 16 + 1 * 20 + 740 * 40 + 1 * 4096 + 107 * 120 + 3 * 536 + 10 * 824 + 561 * 14,
 	B_SYS_UNLINK: 1082 * 40 + 1211 * 32 + 3 * 8 + 209 * 24 + 106 * 120 + 1 * 20 + 2322 * 48 + 237 * 216 + 3 * 1 + 1 * 4096 + 3 * 64 + 935 * 14 + 3 * 536 + 211 * 16 + 10 * 824,
+	B_SYS_USERFAULTFD: 1 * 24 + 1 * 112 + 1 * 80 + 2 * 56 + 2 * 144,
 	B_SYS_WAIT4: 1 * 20 + 3 * 824 + 33 * 120 + 1 * 8 + 95 * 48 + 39 * 16 + 3 * 64 + 39 * 24 + 238 * 40 + 342 * 32 + 1 * 56 + 1 * 4096 + 51 * 216 + 1 * 1,
 	B_SYS_WRITE: 457 * 32 + 1 * 20 + 52 * 16 + 4 * 824 + 126 * 48 + 1 * 4096 + 1 * 8 + 53 * 24 + 69 * 216 + 1 * 80 + 3 * 64 + 318 * 40 + 44 * 120 + 1 * 4120 + 1 * 1,
 	B_SYS_WRITEV: 3 * 64 + 104 * 16 + 105 * 24 + 1 * 80 + 1 * 4120 + 1 * 4096 + 1 * 1 + 250 * 48 + 137 * 216 + 88 * 120 + 1 * 20 + 1 * 184 + 8 * 824 + 1 * 8 + 908 * 32 + 635 * 40,
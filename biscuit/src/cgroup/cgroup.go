@@ -0,0 +1,187 @@
+package cgroup
+
+import "sync"
+import "sync/atomic"
+
+import "defs"
+import "limits"
+
+// the resources which a group limits
+type Kind_t int
+
+const (
+	// resident user pages
+	PAGES Kind_t = iota
+	// bytes of kernel heap reserved by system calls in progress
+	HEAP
+	// processes
+	PROCS
+	NKIND
+)
+
+func (k Kind_t) String() string {
+	switch k {
+	case PAGES:
+		return "pages"
+	case HEAP:
+		return "heap"
+	case PROCS:
+		return "procs"
+	}
+	return "?"
+}
+
+// a limit which is never exceeded
+const Unlimited = -1
+
+// a resource group. groups form a tree rooted at Root; a process belongs to
+// one group and its children start in the same group. the usage of a group
+// includes the usage of its descendants, and a charge fails if it would exceed
+// the limit of the group or of any of its ancestors. a nil group has no
+// limits.
+type Cgroup_t struct {
+	Id     int
+	parent *Cgroup_t
+	// the number of child groups; protected by the table lock
+	nchild int
+	use    [NKIND]int64
+	lim    [NKIND]int64
+}
+
+var Root = &Cgroup_t{lim: [NKIND]int64{Unlimited, Unlimited, Unlimited}}
+
+// the groups by id
+var _groups = struct {
+	sync.Mutex
+	m    map[int]*Cgroup_t
+	next int
+}{m: map[int]*Cgroup_t{0: Root}, next: 1}
+
+func Lookup(id int) (*Cgroup_t, bool) {
+	_groups.Lock()
+	cg, ok := _groups.m[id]
+	_groups.Unlock()
+	return cg, ok
+}
+
+// creates an unlimited child group of cg
+func (cg *Cgroup_t) Mkchild() (*Cgroup_t, defs.Err_t) {
+	_groups.Lock()
+	defer _groups.Unlock()
+	if len(_groups.m) >= limits.Syslimit.Cgroups {
+		return nil, -defs.ENOMEM
+	}
+	ret := &Cgroup_t{Id: _groups.next, parent: cg}
+	for i := range ret.lim {
+		ret.lim[i] = Unlimited
+	}
+	_groups.next++
+	_groups.m[ret.Id] = ret
+	cg.nchild++
+	return ret, 0
+}
+
+// removes a group which has no processes and no child groups
+func (cg *Cgroup_t) Destroy() defs.Err_t {
+	if cg == Root {
+		return -defs.EPERM
+	}
+	_groups.Lock()
+	defer _groups.Unlock()
+	if _, ok := _groups.m[cg.Id]; !ok {
+		return -defs.ENOENT
+	}
+	if cg.nchild != 0 || cg.Usage(PROCS) != 0 {
+		return -defs.EBUSY
+	}
+	delete(_groups.m, cg.Id)
+	cg.parent.nchild--
+	return 0
+}
+
+// moves the charge of a process in the group from to cg. fails if cg was
+// destroyed.
+func (cg *Cgroup_t) Enter(from *Cgroup_t) defs.Err_t {
+	_groups.Lock()
+	defer _groups.Unlock()
+	if g, ok := _groups.m[cg.Id]; !ok || g != cg {
+		return -defs.ENOENT
+	}
+	from.Uncharge(PROCS, 1)
+	cg.Force(PROCS, 1)
+	return 0
+}
+
+// returns true if cg is anc or one of its descendants
+func (cg *Cgroup_t) Within(anc *Cgroup_t) bool {
+	for g := cg; g != nil; g = g.parent {
+		if g == anc {
+			return true
+		}
+	}
+	return false
+}
+
+func (cg *Cgroup_t) Usage(k Kind_t) int {
+	return int(atomic.LoadInt64(&cg.use[k]))
+}
+
+func (cg *Cgroup_t) Limit(k Kind_t) int {
+	return int(atomic.LoadInt64(&cg.lim[k]))
+}
+
+// a limit below the current usage makes the following charges fail until
+// enough of the resource is freed.
+func (cg *Cgroup_t) Setlimit(k Kind_t, lim int) {
+	if lim < 0 {
+		lim = Unlimited
+	}
+	atomic.StoreInt64(&cg.lim[k], int64(lim))
+}
+
+// returns true if n more of k fit within the limit of cg itself
+func (cg *Cgroup_t) Fits(k Kind_t, n int) bool {
+	l := cg.Limit(k)
+	return l == Unlimited || cg.Usage(k)+n <= l
+}
+
+// returns the nearest of cg and its ancestors whose limit n more of k would
+// exceed, or nil if there is none.
+func (cg *Cgroup_t) Over(k Kind_t, n int) *Cgroup_t {
+	for g := cg; g != nil; g = g.parent {
+		if !g.Fits(k, n) {
+			return g
+		}
+	}
+	return nil
+}
+
+// charges n of k to cg and its ancestors. returns false and charges nothing if
+// that would exceed a limit.
+func (cg *Cgroup_t) Charge(k Kind_t, n int) bool {
+	for g := cg; g != nil; g = g.parent {
+		u := atomic.AddInt64(&g.use[k], int64(n))
+		if l := atomic.LoadInt64(&g.lim[k]); l != Unlimited && u > l {
+			for h := cg; h != g.parent; h = h.parent {
+				atomic.AddInt64(&h.use[k], -int64(n))
+			}
+			return false
+		}
+	}
+	return true
+}
+
+// charges n of k to cg and its ancestors regardless of their limits
+func (cg *Cgroup_t) Force(k Kind_t, n int) {
+	for g := cg; g != nil; g = g.parent {
+		atomic.AddInt64(&g.use[k], int64(n))
+	}
+}
+
+func (cg *Cgroup_t) Uncharge(k Kind_t, n int) {
+	for g := cg; g != nil; g = g.parent {
+		if atomic.AddInt64(&g.use[k], -int64(n)) < 0 {
+			panic("negative group usage")
+		}
+	}
+}
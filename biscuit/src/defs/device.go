@@ -9,6 +9,7 @@ const (
 	D_RAWDISK = 5
 	D_STAT    = 6
 	D_PROF    = 7
+	D_OOM     = 8
 	D_FIRST   = D_CONSOLE
 	D_LAST    = D_SUS
 )
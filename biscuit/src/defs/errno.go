@@ -7,6 +7,7 @@ const (
 	EINTR         Err_t = 4
 	EIO           Err_t = 5
 	E2BIG         Err_t = 7
+	ENOEXEC       Err_t = 8
 	EBADF         Err_t = 9
 	ECHILD        Err_t = 10
 	EAGAIN        Err_t = 11
@@ -21,19 +22,26 @@ const (
 	EISDIR        Err_t = 21
 	EINVAL        Err_t = 22
 	EMFILE        Err_t = 24
+	ENOTTY        Err_t = 25
+	ETXTBSY       Err_t = 26
+	EFBIG         Err_t = 27
 	ENOSPC        Err_t = 28
 	ESPIPE        Err_t = 29
 	EPIPE         Err_t = 32
 	ERANGE        Err_t = 34
+	EDEADLK       Err_t = 35
 	ENAMETOOLONG  Err_t = 36
 	ENOSYS        Err_t = 38
 	ENOTEMPTY     Err_t = 39
 	EDESTADDRREQ  Err_t = 40
+	ENOMSG        Err_t = 42
+	EIDRM         Err_t = 43
 	EAFNOSUPPORT  Err_t = 47
 	EADDRINUSE    Err_t = 48
 	EADDRNOTAVAIL Err_t = 49
 	ENETDOWN      Err_t = 50
 	ENETUNREACH   Err_t = 51
+	ELOOP         Err_t = 62
 	EHOSTUNREACH  Err_t = 65
 	ENOTSOCK      Err_t = 88
 	EMSGSIZE      Err_t = 90
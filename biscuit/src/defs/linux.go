@@ -0,0 +1,185 @@
+package defs
+
+// the system call numbers of Linux x86-64, used by processes with the
+// PER_LINUX personality
+const (
+	LSYS_READ               = 0
+	LSYS_WRITE              = 1
+	LSYS_OPEN               = 2
+	LSYS_CLOSE              = 3
+	LSYS_STAT               = 4
+	LSYS_FSTAT              = 5
+	LSYS_LSTAT              = 6
+	LSYS_POLL               = 7
+	LSYS_LSEEK              = 8
+	LSYS_MMAP               = 9
+	LSYS_MPROTECT           = 10
+	LSYS_MUNMAP             = 11
+	LSYS_BRK                = 12
+	LSYS_RT_SIGACTION       = 13
+	LSYS_RT_SIGPROCMASK     = 14
+	LSYS_IOCTL              = 16
+	LSYS_PREAD64            = 17
+	LSYS_PWRITE64           = 18
+	LSYS_READV              = 19
+	LSYS_WRITEV             = 20
+	LSYS_ACCESS             = 21
+	LSYS_PIPE               = 22
+	LSYS_SCHED_YIELD        = 24
+	LSYS_MREMAP             = 25
+	LSYS_MADVISE            = 28
+	LSYS_DUP                = 32
+	LSYS_DUP2               = 33
+	LSYS_NANOSLEEP          = 35
+	LSYS_GETPID             = 39
+	LSYS_CLONE              = 56
+	LSYS_FORK               = 57
+	LSYS_VFORK              = 58
+	LSYS_EXECVE             = 59
+	LSYS_EXIT               = 60
+	LSYS_WAIT4              = 61
+	LSYS_KILL               = 62
+	LSYS_FCNTL              = 72
+	LSYS_FTRUNCATE          = 77
+	LSYS_GETCWD             = 79
+	LSYS_CHDIR              = 80
+	LSYS_RENAME             = 82
+	LSYS_MKDIR              = 83
+	LSYS_RMDIR              = 84
+	LSYS_LINK               = 86
+	LSYS_UNLINK             = 87
+	LSYS_GETTIMEOFDAY       = 96
+	LSYS_GETUID             = 102
+	LSYS_GETGID             = 104
+	LSYS_GETEUID            = 107
+	LSYS_GETEGID            = 108
+	LSYS_GETPPID            = 110
+	LSYS_PERSONALITY        = 135
+	LSYS_GETPRIORITY        = 140
+	LSYS_SETPRIORITY        = 141
+	LSYS_SCHED_GETPARAM     = 143
+	LSYS_SCHED_SETSCHEDULER = 144
+	LSYS_SCHED_GETSCHEDULER = 145
+	LSYS_ARCH_PRCTL         = 158
+	LSYS_GETTID             = 186
+	LSYS_FUTEX              = 202
+	LSYS_SCHED_SETAFFINITY  = 203
+	LSYS_SCHED_GETAFFINITY  = 204
+	LSYS_SET_TID_ADDRESS    = 218
+	LSYS_CLOCK_GETTIME      = 228
+	LSYS_CLOCK_NANOSLEEP    = 230
+	LSYS_EXIT_GROUP         = 231
+	LSYS_OPENAT             = 257
+	LSYS_NEWFSTATAT         = 262
+	LSYS_DUP3               = 292
+	LSYS_PIPE2              = 293
+	LSYS_LAST               = LSYS_PIPE2
+)
+
+// lseek(2) whence values
+const (
+	LSEEK_SET = 0
+	LSEEK_CUR = 1
+	LSEEK_END = 2
+)
+
+// poll(2) event bits
+const (
+	LPOLLIN     = 0x1
+	LPOLLPRI    = 0x2
+	LPOLLOUT    = 0x4
+	LPOLLERR    = 0x8
+	LPOLLHUP    = 0x10
+	LPOLLNVAL   = 0x20
+	LPOLLRDNORM = 0x40
+	LPOLLRDBAND = 0x80
+	LPOLLWRNORM = 0x100
+	LPOLLWRBAND = 0x200
+)
+
+// fcntl(2) commands
+const (
+	LF_DUPFD         = 0
+	LF_GETFD         = 1
+	LF_SETFD         = 2
+	LF_GETFL         = 3
+	LF_SETFL         = 4
+	LF_GETLK         = 5
+	LF_SETLK         = 6
+	LF_SETLKW        = 7
+	LF_DUPFD_CLOEXEC = 1030
+)
+
+// wait4(2) options and status encoding
+const (
+	LWNOHANG   = 1
+	LWSIGSHIFT = 8
+)
+
+// *at(2) arguments
+const (
+	AT_FDCWD      = -100
+	AT_EMPTY_PATH = 0x1000
+)
+
+// arch_prctl(2) codes
+const (
+	ARCH_SET_FS = 0x1002
+	ARCH_GET_FS = 0x1003
+)
+
+// clone(2) flags, which SYS_CLONE shares with Linux. the low byte holds the
+// signal sent to the parent when the child exits.
+const (
+	CLONE_SIGMASK        = 0xff
+	CLONE_VM             = 0x100
+	CLONE_FS             = 0x200
+	CLONE_FILES          = 0x400
+	CLONE_SIGHAND        = 0x800
+	CLONE_VFORK          = 0x4000
+	CLONE_THREAD         = 0x10000
+	CLONE_SYSVSEM        = 0x40000
+	CLONE_SETTLS         = 0x80000
+	CLONE_PARENT_SETTID  = 0x100000
+	CLONE_CHILD_CLEARTID = 0x200000
+	CLONE_DETACHED       = 0x400000
+	CLONE_CHILD_SETTID   = 0x1000000
+)
+
+// futex(2) operations
+const (
+	LFUTEX_WAIT           = 0
+	LFUTEX_WAKE           = 1
+	LFUTEX_REQUEUE        = 3
+	LFUTEX_CMP_REQUEUE    = 4
+	LFUTEX_PRIVATE        = 128
+	LFUTEX_CLOCK_REALTIME = 256
+)
+
+// Linux signal numbers
+const (
+	LSIGCHLD = 17
+)
+
+// Linux file type bits of st_mode
+const (
+	LS_IFIFO  = 0010000
+	LS_IFCHR  = 0020000
+	LS_IFDIR  = 0040000
+	LS_IFBLK  = 0060000
+	LS_IFREG  = 0100000
+	LS_IFLNK  = 0120000
+	LS_IFSOCK = 0140000
+)
+
+// the Linux errnos whose values differ from biscuit's
+const (
+	LELOOP         Err_t = 40
+	LEDESTADDRREQ  Err_t = 89
+	LEAFNOSUPPORT  Err_t = 97
+	LEADDRINUSE    Err_t = 98
+	LEADDRNOTAVAIL Err_t = 99
+	LENETDOWN      Err_t = 100
+	LENETUNREACH   Err_t = 101
+	LEHOSTUNREACH  Err_t = 113
+)
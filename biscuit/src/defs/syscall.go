@@ -4,57 +4,75 @@ type Msgfl_t uint
 type Fdopt_t uint
 
 const (
-	SYS_READ            = 0
-	SYS_WRITE           = 1
-	SYS_OPEN            = 2
-	O_RDONLY    Fdopt_t = 0
-	O_WRONLY    Fdopt_t = 1
-	O_RDWR      Fdopt_t = 2
-	O_CREAT     Fdopt_t = 0x40
-	O_EXCL      Fdopt_t = 0x80
-	O_TRUNC     Fdopt_t = 0x200
-	O_APPEND    Fdopt_t = 0x400
-	O_NONBLOCK  Fdopt_t = 0x800
-	O_DIRECTORY Fdopt_t = 0x10000
-	O_CLOEXEC   Fdopt_t = 0x80000
-	SYS_CLOSE           = 3
-	SYS_STAT            = 4
-	SYS_FSTAT           = 5
-	SYS_POLL            = 7
-	POLLRDNORM          = 0x1
-	POLLRDBAND          = 0x2
-	POLLIN              = (POLLRDNORM | POLLRDBAND)
-	POLLPRI             = 0x4
-	POLLWRNORM          = 0x8
-	POLLOUT             = POLLWRNORM
-	POLLWRBAND          = 0x10
-	POLLERR             = 0x20
-	POLLHUP             = 0x40
-	POLLNVAL            = 0x80
-	SYS_LSEEK           = 8
-	SEEK_SET            = 0x1
-	SEEK_CUR            = 0x2
-	SEEK_END            = 0x4
-	SYS_MMAP            = 9
-	MAP_SHARED          = uint(0x1)
-	MAP_PRIVATE         = uint(0x2)
-	MAP_FIXED           = 0x10
-	MAP_ANON            = 0x20
-	MAP_FAILED          = -1
-	PROT_NONE           = 0x0
-	PROT_READ           = 0x1
-	PROT_WRITE          = 0x2
-	PROT_EXEC           = 0x4
-	SYS_MUNMAP          = 11
-	SYS_SIGACT          = 13
-	SYS_READV           = 19
-	SYS_WRITEV          = 20
-	SYS_ACCESS          = 21
-	SYS_DUP2            = 33
-	SYS_PAUSE           = 34
-	SYS_GETPID          = 39
-	SYS_GETPPID         = 40
-	SYS_SOCKET          = 41
+	SYS_READ             = 0
+	SYS_WRITE            = 1
+	SYS_OPEN             = 2
+	O_RDONLY     Fdopt_t = 0
+	O_WRONLY     Fdopt_t = 1
+	O_RDWR       Fdopt_t = 2
+	O_CREAT      Fdopt_t = 0x40
+	O_EXCL       Fdopt_t = 0x80
+	O_TRUNC      Fdopt_t = 0x200
+	O_APPEND     Fdopt_t = 0x400
+	O_NONBLOCK   Fdopt_t = 0x800
+	O_DIRECTORY  Fdopt_t = 0x10000
+	O_CLOEXEC    Fdopt_t = 0x80000
+	SYS_CLOSE            = 3
+	SYS_STAT             = 4
+	SYS_FSTAT            = 5
+	SYS_POLL             = 7
+	POLLRDNORM           = 0x1
+	POLLRDBAND           = 0x2
+	POLLIN               = (POLLRDNORM | POLLRDBAND)
+	POLLPRI              = 0x4
+	POLLWRNORM           = 0x8
+	POLLOUT              = POLLWRNORM
+	POLLWRBAND           = 0x10
+	POLLERR              = 0x20
+	POLLHUP              = 0x40
+	POLLNVAL             = 0x80
+	SYS_LSEEK            = 8
+	SEEK_SET             = 0x1
+	SEEK_CUR             = 0x2
+	SEEK_END             = 0x4
+	SYS_MMAP             = 9
+	MAP_SHARED           = uint(0x1)
+	MAP_PRIVATE          = uint(0x2)
+	MAP_FIXED            = 0x10
+	MAP_ANON             = 0x20
+	MAP_FAILED           = -1
+	PROT_NONE            = 0x0
+	PROT_READ            = 0x1
+	PROT_WRITE           = 0x2
+	PROT_EXEC            = 0x4
+	SYS_MPROTECT         = 10
+	SYS_MUNMAP           = 11
+	SYS_SIGACT           = 13
+	SYS_IOCTL            = 16
+	SYS_READV            = 19
+	SYS_WRITEV           = 20
+	SYS_ACCESS           = 21
+	SYS_MREMAP           = 25
+	SYS_MSYNC            = 26
+	SYS_MADVISE          = 28
+	SYS_SHMGET           = 29
+	IPC_PRIVATE          = 0
+	IPC_CREAT            = 01000
+	IPC_EXCL             = 02000
+	IPC_NOWAIT           = 04000
+	SYS_SHMAT            = 30
+	SHM_RDONLY           = 010000
+	SHM_RND              = 020000
+	SYS_SHMCTL           = 31
+	IPC_RMID             = 0
+	IPC_SET              = 1
+	IPC_STAT             = 2
+	SYS_DUP              = 32
+	SYS_DUP2             = 33
+	SYS_PAUSE            = 34
+	SYS_GETPID           = 39
+	SYS_GETPPID          = 40
+	SYS_SOCKET           = 41
 	// domains
 	AF_UNIX = 1
 	AF_INET = 2
@@ -107,11 +125,40 @@ const (
 	WNOHANG          = 2
 	WUNTRACED        = 4
 	SYS_KILL         = 62
+	SYS_SEMGET       = 64
+	SYS_SEMOP        = 65
+	SEM_UNDO         = 0x1000
+	SYS_SEMCTL       = 66
+	GETPID           = 11
+	GETVAL           = 12
+	GETALL           = 13
+	SETVAL           = 16
+	SETALL           = 17
+	SYS_SHMDT        = 67
+	SYS_MSGGET       = 68
+	SYS_MSGSND       = 69
+	SYS_MSGRCV       = 70
+	MSG_NOERROR      = 010000
+	MSG_EXCEPT       = 020000
+	SYS_MSGCTL       = 71
 	SYS_FCNTL        = 72
 	F_GETFL          = 1
 	F_SETFL          = 2
 	F_GETFD          = 3
 	F_SETFD          = 4
+	F_SETLK          = 5
+	F_SETLKW         = 6
+	F_GETLK          = 8
+	F_DUPFD          = 9
+	F_DUPFD_CLOEXEC  = 10
+	F_RDLCK          = 0
+	F_WRLCK          = 1
+	F_UNLCK          = 2
+	SYS_FLOCK        = 73
+	LOCK_SH          = 1
+	LOCK_EX          = 2
+	LOCK_NB          = 4
+	LOCK_UN          = 8
 	SYS_TRUNC        = 76
 	SYS_FTRUNC       = 77
 	SYS_GETCWD       = 79
@@ -123,16 +170,69 @@ const (
 	SYS_GETTOD       = 96
 	SYS_GETRLMT      = 97
 	RLIMIT_NOFILE    = 1
+	RLIMIT_MEMLOCK   = 3
+	RLIMIT_RTPRIO    = 4
 	RLIM_INFINITY    = ^uint(0)
 	SYS_GETRUSG      = 98
 	RUSAGE_SELF      = 1
 	RUSAGE_CHILDREN  = 2
 	SYS_MKNOD        = 133
+	SYS_PERSONALITY  = 135
+	SYS_GETPRIO      = 140
+	SYS_SETPRIO      = 141
+	PRIO_PROCESS     = 0
+	NICE_MIN         = -20
+	NICE_MAX         = 19
+	SYS_SCHGETPARAM  = 143
+	SYS_SCHSETSCHED  = 144
+	SYS_SCHGETSCHED  = 145
+	SCHED_OTHER      = 0
+	SCHED_FIFO       = 1
+	SCHED_PRIOMIN    = 1
+	SCHED_PRIOMAX    = 99
+	SYS_MLOCK        = 149
+	SYS_MUNLOCK      = 150
+	SYS_MLOCKALL     = 151
+	MCL_CURRENT      = 1
+	MCL_FUTURE       = 2
+	SYS_MUNLOCKALL   = 152
 	SYS_SETRLMT      = 160
 	SYS_SYNC         = 162
+	SYS_SWAPON       = 167
+	SYS_SWAPOFF      = 168
 	SYS_REBOOT       = 169
+	SYS_SCHSETAFF    = 203
+	SYS_SCHGETAFF    = 204
 	SYS_NANOSLEEP    = 230
+	SYS_EPOLLWAIT    = 232
+	SYS_EPOLLCTL     = 233
+	EPOLL_CTL_ADD    = 1
+	EPOLL_CTL_DEL    = 2
+	EPOLL_CTL_MOD    = 3
+	EPOLLIN          = 0x1
+	EPOLLPRI         = 0x2
+	EPOLLOUT         = 0x4
+	EPOLLERR         = 0x8
+	EPOLLHUP         = 0x10
+	EPOLLONESHOT     = 1 << 30
+	EPOLLET          = 1 << 31
+	SYS_INOTIFYADD   = 254
+	SYS_INOTIFYRM    = 255
+	SYS_SPLICE       = 275
+	SYS_TFDCREATE    = 283
+	CLOCK_REALTIME   = 0
+	CLOCK_MONOTONIC  = 1
+	SYS_TFDSETTIME   = 286
+	SYS_TFDGETTIME   = 287
+	SYS_SIGNALFD     = 289
+	SYS_EVENTFD      = 290
+	SYS_EPOLLCREATE  = 291
+	EPOLL_CLOEXEC    = 0x80000
+	SYS_DUP3         = 292
 	SYS_PIPE2        = 293
+	SYS_INOTIFYINIT  = 294
+	SYS_USERFAULTFD  = 323
+	SYS_CLOSERANGE   = 436
 	SYS_PROF         = 31337
 	PROF_DISABLE     = 1 << 0
 	PROF_GOLANG      = 1 << 1
@@ -157,6 +257,13 @@ const (
 	SINFO_GCOBJS     = 9
 	SINFO_DOGC       = 10
 	SINFO_PROCLIST   = 11
+	SINFO_RSSANON    = 12
+	SINFO_RSSFILE    = 13
+	SINFO_RSSSHARED  = 14
+	SINFO_RSSSWAP    = 15
+	SINFO_MAXRSS     = 16
+	SINFO_KSMSHARED  = 17
+	SINFO_KSMSHARING = 18
 	SYS_PREAD        = 31340
 	SYS_PWRITE       = 31341
 	SYS_FUTEX        = 31342
@@ -164,10 +271,156 @@ const (
 	FUTEX_WAKE       = 2
 	FUTEX_CNDGIVE    = 3
 	SYS_GETTID       = 31343
+	SYS_CGROUP       = 31344
+	CGROUP_SELF      = 1
+	CGROUP_CREATE    = 2
+	CGROUP_DESTROY   = 3
+	CGROUP_JOIN      = 4
+	CGROUP_SETLIM    = 5
+	CGROUP_GETLIM    = 6
+	CGROUP_USAGE     = 7
+	CGROUP_PAGES     = 0
+	CGROUP_HEAP      = 1
+	CGROUP_PROCS     = 2
+	CGROUP_UNLIMITED = 0x7fffffffffffffff
+	SYS_OOMADJ       = 31345
+	SYS_SHMOPEN      = 31346
+	SYS_SHMUNLINK    = 31347
+	SYS_SENDFILE     = 31348
+	SYS_CLONE        = 31349
+	SYS_SPAWN        = 31350
+	SPAWN_DUP2       = 1
+	SPAWN_CLOSE      = 2
+	SPAWN_OPEN       = 3
 )
 
+// splice(2) flags
 const (
-	SIGKILL = 9
+	SPLICE_F_MOVE     = 1
+	SPLICE_F_NONBLOCK = 2
+	SPLICE_F_MORE     = 4
+)
+
+// close_range(2) flags
+const (
+	CLOSE_RANGE_UNSHARE = 1 << 1
+	CLOSE_RANGE_CLOEXEC = 1 << 2
+)
+
+// auxiliary vector entry types
+const (
+	AT_NULL   = 0
+	AT_PHDR   = 3
+	AT_PHENT  = 4
+	AT_PHNUM  = 5
+	AT_PAGESZ = 6
+	AT_BASE   = 7
+	AT_ENTRY  = 9
+	AT_UID    = 11
+	AT_EUID   = 12
+	AT_GID    = 13
+	AT_EGID   = 14
+	AT_SECURE = 23
+	AT_RANDOM = 25
+)
+
+// personality flags. the low byte selects the system call ABI.
+const (
+	PER_MASK          = 0xff
+	PER_BISCUIT       = 0x0
+	PER_LINUX         = 0x1
+	ADDR_NO_RANDOMIZE = 0x0040000
+)
+
+// more mmap flags and the mremap flags
+const (
+	MAP_FIXED_NOREPLACE = 0x100000
+	MREMAP_MAYMOVE      = 0x1
+)
+
+// madvise advice and msync flags
+const (
+	MADV_NORMAL      = 0
+	MADV_RANDOM      = 1
+	MADV_SEQUENTIAL  = 2
+	MADV_WILLNEED    = 3
+	MADV_DONTNEED    = 4
+	MADV_MERGEABLE   = 12
+	MADV_UNMERGEABLE = 13
+	MADV_HUGEPAGE    = 14
+	MADV_NOHUGEPAGE  = 15
+	MS_ASYNC         = 1
+	MS_INVALIDATE    = 2
+	MS_SYNC          = 4
+)
+
+// the range of oom_score_adj; OOM_ADJ_MIN means never kill
+const (
+	OOM_ADJ_MIN = -1000
+	OOM_ADJ_MAX = 1000
+)
+
+// userfaultfd ioctls and their structures' flags
+const (
+	UFFD_API                      = 0xaa
+	UFFDIO_API                    = 0xc018aa3f
+	UFFDIO_REGISTER               = 0xc020aa00
+	UFFDIO_UNREGISTER             = 0x8010aa01
+	UFFDIO_WAKE                   = 0x8010aa02
+	UFFDIO_COPY                   = 0xc028aa03
+	UFFDIO_ZEROPAGE               = 0xc020aa04
+	UFFDIO_REGISTER_MODE_MISSING  = 1
+	UFFDIO_COPY_MODE_DONTWAKE     = 1
+	UFFDIO_ZEROPAGE_MODE_DONTWAKE = 1
+	UFFD_EVENT_PAGEFAULT          = 0x12
+	UFFD_PAGEFAULT_FLAG_WRITE     = 1
+)
+
+const (
+	SIGKILL  = 9
+	SIGSTOP  = 17
+	SIGCHLD  = 20
+	SIGIO    = 23
+	SIGWINCH = 28
+	// signals are numbered from 1 to NSIG
+	NSIG = 64
+)
+
+const (
+	TFD_NONBLOCK      = 0x800
+	TFD_CLOEXEC       = 0x80000
+	TFD_TIMER_ABSTIME = 1
+	SFD_NONBLOCK      = 0x800
+	SFD_CLOEXEC       = 0x80000
+	EFD_SEMAPHORE     = 1
+	EFD_NONBLOCK      = 0x800
+	EFD_CLOEXEC       = 0x80000
+)
+
+const (
+	IN_NONBLOCK      = 0x800
+	IN_CLOEXEC       = 0x80000
+	IN_ACCESS        = 0x1
+	IN_MODIFY        = 0x2
+	IN_ATTRIB        = 0x4
+	IN_CLOSE_WRITE   = 0x8
+	IN_CLOSE_NOWRITE = 0x10
+	IN_OPEN          = 0x20
+	IN_MOVED_FROM    = 0x40
+	IN_MOVED_TO      = 0x80
+	IN_CREATE        = 0x100
+	IN_DELETE        = 0x200
+	IN_DELETE_SELF   = 0x400
+	IN_MOVE_SELF     = 0x800
+	IN_ALL_EVENTS    = 0xfff
+	IN_Q_OVERFLOW    = 0x4000
+	IN_IGNORED       = 0x8000
+	IN_ONLYDIR       = 0x01000000
+	IN_DONT_FOLLOW   = 0x02000000
+	IN_EXCL_UNLINK   = 0x04000000
+	IN_MASK_ADD      = 0x20000000
+	IN_ISDIR         = 0x40000000
+	IN_ONESHOT       = 0x80000000
 )
 
 func Mkexitsig(sig int) int {
@@ -0,0 +1,129 @@
+package entropy
+
+import "runtime"
+import "sync"
+
+// the kernel's source of random numbers. the pool is seeded from the cycle
+// counter and RDRAND, if the CPU has it, at boot and is stirred by the timing
+// of device interrupts and of each request for randomness. it is a
+// xoshiro256** generator, which is fast but not cryptographically secure; it
+// is good enough to randomize address space layouts. Read prefers RDRAND.
+var pool struct {
+	sync.Mutex
+	s [4]uint64
+}
+
+func _splitmix(x *uint64) uint64 {
+	*x += 0x9e3779b97f4a7c15
+	z := *x
+	z = (z ^ (z >> 30)) * 0xbf58476d1ce4e5b9
+	z = (z ^ (z >> 27)) * 0x94d049bb133111eb
+	return z ^ (z >> 31)
+}
+
+func _rotl(x uint64, k uint) uint64 {
+	return (x << k) | (x >> (64 - k))
+}
+
+// caller must hold the pool lock
+func _next() uint64 {
+	s := &pool.s
+	ret := _rotl(s[1]*5, 7) * 9
+	t := s[1] << 17
+	s[2] ^= s[0]
+	s[3] ^= s[1]
+	s[1] ^= s[2]
+	s[0] ^= s[3]
+	s[2] ^= t
+	s[3] = _rotl(s[3], 45)
+	return ret
+}
+
+// caller must hold the pool lock
+func _stir(v uint64) {
+	x := v
+	for i := range pool.s {
+		pool.s[i] ^= _splitmix(&x)
+	}
+	// the generator's state must never be all zero
+	if pool.s[0]|pool.s[1]|pool.s[2]|pool.s[3] == 0 {
+		pool.s[0] = 1
+	}
+	_next()
+}
+
+// true if the CPU has the RDRAND instruction
+var _hasrdrand bool
+
+// returns a random number from the CPU's RDRAND instruction, which is
+// cryptographically secure. like Intel recommends, a few attempts are made
+// before giving up.
+func _rdrand() (uint64, bool) {
+	if !_hasrdrand {
+		return 0, false
+	}
+	for i := 0; i < 10; i++ {
+		if v, ok := runtime.Rdrand(); ok {
+			return v, true
+		}
+	}
+	return 0, false
+}
+
+// seeds the pool. called once at boot.
+func Entropy_init() {
+	ax, bx, cx, dx := runtime.Cpuid(1, 0)
+	_hasrdrand = cx&(1<<30) != 0
+	seed := uint64(runtime.Rdtsc())
+	seed ^= uint64(ax)<<32 | uint64(bx)
+	seed ^= (uint64(cx)<<32 | uint64(dx)) << 1
+	if v, ok := _rdrand(); ok {
+		seed ^= v
+	}
+	pool.Lock()
+	_stir(seed)
+	pool.Unlock()
+}
+
+// mixes an unpredictable value, such as an interrupt's timestamp, into the
+// pool.
+func Stir(v uint64) {
+	pool.Lock()
+	_stir(v)
+	pool.Unlock()
+}
+
+func Uint64() uint64 {
+	pool.Lock()
+	_stir(uint64(runtime.Rdtsc()))
+	ret := _next()
+	pool.Unlock()
+	return ret
+}
+
+// returns a random integer in [0, n)
+func Intn(n int) int {
+	if n <= 0 {
+		panic("bad range")
+	}
+	return int(Uint64() % uint64(n))
+}
+
+// fills buf with random bytes from RDRAND. only if the CPU does not have it,
+// or has no random numbers ready, the bytes come from the pool and are not
+// cryptographically secure.
+func Read(buf []uint8) {
+	pool.Lock()
+	_stir(uint64(runtime.Rdtsc()))
+	for i := 0; i < len(buf); i += 8 {
+		v, ok := _rdrand()
+		if !ok {
+			v = _next()
+		}
+		for j := i; j < len(buf) && j < i+8; j++ {
+			buf[j] = uint8(v)
+			v >>= 8
+		}
+	}
+	pool.Unlock()
+}
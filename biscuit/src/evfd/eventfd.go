@@ -0,0 +1,108 @@
+package evfd
+
+import "sync"
+
+import "defs"
+import "fdops"
+import "proc"
+
+// the largest counter value
+const _efdmax = ^uint64(0) - 1
+
+// an eventfd is a counter. writes add to it, and reads return it and reset it
+// to zero, or decrement it by one in semaphore mode.
+type Eventfd_t struct {
+	_fops_t
+	// broadcast when the counter changes
+	cond    *sync.Cond
+	cnt     uint64
+	sema    bool
+	pollers fdops.Pollers_t
+}
+
+func Mkeventfd(initval uint, sema, nonblock bool) *Eventfd_t {
+	ret := &Eventfd_t{cnt: uint64(initval), sema: sema}
+	ret._init(nonblock)
+	ret.cond = sync.NewCond(ret)
+	return ret
+}
+
+func (e *Eventfd_t) Close() defs.Err_t {
+	e._refdown()
+	return 0
+}
+
+// waits until the counter is not zero
+func (e *Eventfd_t) Read(dst fdops.Userio_i) (int, defs.Err_t) {
+	if dst.Remain() < 8 {
+		return 0, -defs.EINVAL
+	}
+	e.Lock()
+	defer e.Unlock()
+	for e.cnt == 0 {
+		if e._nonblock() {
+			return 0, -defs.EAGAIN
+		}
+		if err := proc.KillableWait(e.cond); err != 0 {
+			return 0, err
+		}
+	}
+	v := e.cnt
+	if e.sema {
+		v = 1
+	}
+	ret, err := _writeval(dst, v)
+	if err != 0 {
+		return 0, err
+	}
+	e.cnt -= v
+	e.cond.Broadcast()
+	e.pollers.Wakeready(fdops.R_WRITE)
+	return ret, 0
+}
+
+// waits until the value can be added without overflowing the counter
+func (e *Eventfd_t) Write(src fdops.Userio_i) (int, defs.Err_t) {
+	v, err := _readval(src)
+	if err != 0 {
+		return 0, err
+	}
+	if v == ^uint64(0) {
+		return 0, -defs.EINVAL
+	}
+	e.Lock()
+	defer e.Unlock()
+	for v > _efdmax-e.cnt {
+		if e._nonblock() {
+			return 0, -defs.EAGAIN
+		}
+		if err := proc.KillableWait(e.cond); err != 0 {
+			return 0, err
+		}
+	}
+	e.cnt += v
+	if v != 0 {
+		e.cond.Broadcast()
+		e.pollers.Wakeready(fdops.R_READ)
+	}
+	return 8, 0
+}
+
+// an eventfd is readable while the counter is not zero and writable while a
+// write of 1 does not block
+func (e *Eventfd_t) Pollone(pm fdops.Pollmsg_t) (fdops.Ready_t, defs.Err_t) {
+	e.Lock()
+	defer e.Unlock()
+	var r fdops.Ready_t
+	if e.cnt != 0 {
+		r |= fdops.R_READ
+	}
+	if e.cnt < _efdmax {
+		r |= fdops.R_WRITE
+	}
+	r &= pm.Events
+	if r != 0 || !pm.Dowait {
+		return r, 0
+	}
+	return 0, e.pollers.Addpoller(&pm)
+}
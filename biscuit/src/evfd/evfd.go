@@ -0,0 +1,152 @@
+package evfd
+
+import "sync"
+
+import "defs"
+import "fdops"
+import "mem"
+import "stat"
+import "util"
+
+// eventfds, timerfds, and signalfds are neither files nor sockets. _fops_t
+// holds their reference counts and options and implements the operations
+// which they do not support. the embedding type's state is protected by the
+// same lock.
+type _fops_t struct {
+	sync.Mutex
+	// the number of descriptors which refer to the fops
+	refs    int
+	options defs.Fdopt_t
+}
+
+// initializes f in place since it holds a lock
+func (f *_fops_t) _init(nonblock bool) {
+	f.refs = 1
+	if nonblock {
+		f.options = defs.O_NONBLOCK
+	}
+}
+
+// returns true if the last reference was dropped
+func (f *_fops_t) _refdown() bool {
+	f.Lock()
+	defer f.Unlock()
+	if f.refs <= 0 {
+		panic("negative refs")
+	}
+	f.refs--
+	return f.refs == 0
+}
+
+// f must be locked
+func (f *_fops_t) _nonblock() bool {
+	return f.options&defs.O_NONBLOCK != 0
+}
+
+func (f *_fops_t) Reopen() defs.Err_t {
+	f.Lock()
+	f.refs++
+	f.Unlock()
+	return 0
+}
+
+func (f *_fops_t) Fstat(st *stat.Stat_t) defs.Err_t {
+	st.Wdev(0)
+	st.Wmode(0)
+	return 0
+}
+
+func (f *_fops_t) Lseek(int, int) (int, defs.Err_t) {
+	return 0, -defs.ESPIPE
+}
+
+func (f *_fops_t) Mmapi(int, int, bool) ([]mem.Mmapinfo_t, defs.Err_t) {
+	return nil, -defs.EINVAL
+}
+
+func (f *_fops_t) Pathi() defs.Inum_t {
+	panic("evfd cwd")
+}
+
+func (f *_fops_t) Truncate(uint) defs.Err_t {
+	return -defs.EINVAL
+}
+
+func (f *_fops_t) Pread(fdops.Userio_i, int) (int, defs.Err_t) {
+	return 0, -defs.ESPIPE
+}
+
+func (f *_fops_t) Pwrite(fdops.Userio_i, int) (int, defs.Err_t) {
+	return 0, -defs.ESPIPE
+}
+
+func (f *_fops_t) Accept(fdops.Userio_i) (fdops.Fdops_i, int, defs.Err_t) {
+	return nil, 0, -defs.ENOTSOCK
+}
+
+func (f *_fops_t) Bind([]uint8) defs.Err_t {
+	return -defs.ENOTSOCK
+}
+
+func (f *_fops_t) Connect([]uint8) defs.Err_t {
+	return -defs.ENOTSOCK
+}
+
+func (f *_fops_t) Listen(int) (fdops.Fdops_i, defs.Err_t) {
+	return nil, -defs.ENOTSOCK
+}
+
+func (f *_fops_t) Sendmsg(fdops.Userio_i, []uint8, []uint8,
+	int) (int, defs.Err_t) {
+	return 0, -defs.ENOTSOCK
+}
+
+func (f *_fops_t) Recvmsg(fdops.Userio_i, fdops.Userio_i,
+	fdops.Userio_i, int) (int, int, int, defs.Msgfl_t, defs.Err_t) {
+	return 0, 0, 0, 0, -defs.ENOTSOCK
+}
+
+func (f *_fops_t) Fcntl(cmd, opt int) int {
+	f.Lock()
+	defer f.Unlock()
+	switch cmd {
+	case defs.F_GETFL:
+		return int(f.options)
+	case defs.F_SETFL:
+		f.options = defs.Fdopt_t(opt)
+		return 0
+	default:
+		return int(-defs.EINVAL)
+	}
+}
+
+func (f *_fops_t) Getsockopt(int, fdops.Userio_i, int) (int, defs.Err_t) {
+	return 0, -defs.ENOTSOCK
+}
+
+func (f *_fops_t) Setsockopt(int, int, fdops.Userio_i, int) defs.Err_t {
+	return -defs.ENOTSOCK
+}
+
+func (f *_fops_t) Shutdown(read, write bool) defs.Err_t {
+	return -defs.ENOTSOCK
+}
+
+// reads the 8-byte value which is written to an eventfd
+func _readval(src fdops.Userio_i) (uint64, defs.Err_t) {
+	if src.Remain() < 8 {
+		return 0, -defs.EINVAL
+	}
+	buf := make([]uint8, 8)
+	if _, err := src.Uioread(buf); err != 0 {
+		return 0, err
+	}
+	return uint64(util.Readn(buf, 8, 0)), 0
+}
+
+// writes the 8-byte value which is read from an eventfd or timerfd
+func _writeval(dst fdops.Userio_i, v uint64) (int, defs.Err_t) {
+	buf := make([]uint8, 8)
+	util.Writen(buf, 8, 0, int(v))
+	return dst.Uiowrite(buf)
+}
@@ -0,0 +1,84 @@
+package evfd
+
+import "defs"
+import "fdops"
+import "proc"
+import "util"
+
+// the size of struct signalfd_siginfo
+const SIGINFOSZ = 128
+
+// a signalfd reads the pending signals in its mask of the process which
+// created it. while a signalfd reads a signal, the signal stays pending
+// instead of terminating the process.
+type Signalfd_t struct {
+	_fops_t
+	sigs *proc.Sigpend_t
+	mask uint64
+}
+
+func Mksignalfd(sigs *proc.Sigpend_t, mask uint64, nonblock bool) *Signalfd_t {
+	ret := &Signalfd_t{sigs: sigs, mask: mask}
+	ret._init(nonblock)
+	sigs.Watch(mask, 1)
+	return ret
+}
+
+func (sf *Signalfd_t) Setmask(mask uint64) {
+	sf.Lock()
+	sf.sigs.Watch(sf.mask, -1)
+	sf.sigs.Watch(mask, 1)
+	sf.mask = mask
+	sf.Unlock()
+}
+
+func (sf *Signalfd_t) Close() defs.Err_t {
+	if sf._refdown() {
+		sf.Lock()
+		sf.sigs.Watch(sf.mask, -1)
+		sf.Unlock()
+	}
+	return 0
+}
+
+// returns as many pending signals as fit in dst. waits for one.
+func (sf *Signalfd_t) Read(dst fdops.Userio_i) (int, defs.Err_t) {
+	if dst.Remain() < SIGINFOSZ {
+		return 0, -defs.EINVAL
+	}
+	sf.Lock()
+	mask := sf.mask
+	nowait := sf._nonblock()
+	sf.Unlock()
+	did := 0
+	for dst.Remain() >= SIGINFOSZ {
+		sig, from, err := sf.sigs.Take(mask, nowait || did != 0)
+		if err != 0 {
+			if did != 0 {
+				break
+			}
+			return 0, err
+		}
+		// the code is SI_USER
+		buf := make([]uint8, SIGINFOSZ)
+		util.Writen(buf, 4, 0, sig)
+		util.Writen(buf, 4, 12, from)
+		c, err := dst.Uiowrite(buf)
+		did += c
+		if err != 0 {
+			return did, err
+		}
+	}
+	return did, 0
+}
+
+func (sf *Signalfd_t) Write(fdops.Userio_i) (int, defs.Err_t) {
+	return 0, -defs.EINVAL
+}
+
+func (sf *Signalfd_t) Pollone(pm fdops.Pollmsg_t) (fdops.Ready_t, defs.Err_t) {
+	sf.Lock()
+	mask := sf.mask
+	sf.Unlock()
+	return sf.sigs.Pollone(mask, pm)
+}
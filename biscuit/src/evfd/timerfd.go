@@ -0,0 +1,177 @@
+package evfd
+
+import "sync"
+import "time"
+
+import "defs"
+import "fdops"
+import "proc"
+
+// the monotonic clock counts from boot
+var _boot = time.Now()
+
+// a timerfd counts the expirations of a timer. reads return the count and reset
+// it to zero.
+type Timerfd_t struct {
+	_fops_t
+	// broadcast when the timer expires
+	cond  *sync.Cond
+	clock int
+	// the expirations since the last read
+	exp uint64
+	// the next expiration, or the zero time if the timer is disarmed
+	next  time.Time
+	ival  time.Duration
+	timer *time.Timer
+	// changes whenever the timer is set so that an expiration of the
+	// previous setting is ignored
+	gen     int
+	pollers fdops.Pollers_t
+}
+
+func Mktimerfd(clock int, nonblock bool) (*Timerfd_t, defs.Err_t) {
+	if clock != defs.CLOCK_REALTIME && clock != defs.CLOCK_MONOTONIC {
+		return nil, -defs.EINVAL
+	}
+	ret := &Timerfd_t{clock: clock}
+	ret._init(nonblock)
+	ret.cond = sync.NewCond(ret)
+	return ret, 0
+}
+
+func (t *Timerfd_t) Close() defs.Err_t {
+	if t._refdown() {
+		t.Lock()
+		t._disarm()
+		t.Unlock()
+	}
+	return 0
+}
+
+// t must be locked
+func (t *Timerfd_t) _disarm() {
+	if t.timer != nil {
+		t.timer.Stop()
+		t.timer = nil
+	}
+	t.next = time.Time{}
+	t.gen++
+}
+
+// t must be locked
+func (t *Timerfd_t) _arm() {
+	gen := t.gen
+	t.timer = time.AfterFunc(time.Until(t.next), func() {
+		t._expire(gen)
+	})
+}
+
+func (t *Timerfd_t) _expire(gen int) {
+	t.Lock()
+	defer t.Unlock()
+	if gen != t.gen {
+		return
+	}
+	if t.ival == 0 {
+		t.exp++
+		t.next = time.Time{}
+		t.timer = nil
+	} else {
+		// count the periods which passed while the timer was late
+		n := 1 + time.Since(t.next)/t.ival
+		if n < 1 {
+			n = 1
+		}
+		t.exp += uint64(n)
+		t.next = t.next.Add(n * t.ival)
+		t._arm()
+	}
+	t.cond.Broadcast()
+	t.pollers.Wakeready(fdops.R_READ)
+}
+
+// returns the time until the next expiration and the interval, which are zero
+// if the timer is disarmed. t must be locked.
+func (t *Timerfd_t) _get() (time.Duration, time.Duration) {
+	if t.next.IsZero() {
+		return 0, t.ival
+	}
+	left := time.Until(t.next)
+	if left <= 0 {
+		// the timer has not expired yet
+		left = 1
+	}
+	return left, t.ival
+}
+
+func (t *Timerfd_t) Gettime() (time.Duration, time.Duration) {
+	t.Lock()
+	defer t.Unlock()
+	return t._get()
+}
+
+// arms the timer to expire after val, or at val since the clock's epoch if abs
+// is true, and then every ival. a zero val disarms the timer. returns the
+// previous setting like Gettime.
+func (t *Timerfd_t) Settime(val time.Duration, abs bool,
+	ival time.Duration) (time.Duration, time.Duration) {
+	t.Lock()
+	defer t.Unlock()
+	oval, oival := t._get()
+	t._disarm()
+	t.exp = 0
+	t.ival = ival
+	if val == 0 {
+		return oval, oival
+	}
+	switch {
+	case !abs:
+		t.next = time.Now().Add(val)
+	case t.clock == defs.CLOCK_MONOTONIC:
+		t.next = _boot.Add(val)
+	default:
+		t.next = time.Unix(0, 0).Add(val)
+	}
+	t._arm()
+	return oval, oival
+}
+
+// waits for an expiration
+func (t *Timerfd_t) Read(dst fdops.Userio_i) (int, defs.Err_t) {
+	if dst.Remain() < 8 {
+		return 0, -defs.EINVAL
+	}
+	t.Lock()
+	defer t.Unlock()
+	for t.exp == 0 {
+		if t._nonblock() {
+			return 0, -defs.EAGAIN
+		}
+		if err := proc.KillableWait(t.cond); err != 0 {
+			return 0, err
+		}
+	}
+	ret, err := _writeval(dst, t.exp)
+	if err != 0 {
+		return 0, err
+	}
+	t.exp = 0
+	return ret, 0
+}
+
+func (t *Timerfd_t) Write(fdops.Userio_i) (int, defs.Err_t) {
+	return 0, -defs.EINVAL
+}
+
+// a timerfd is readable once the timer has expired
+func (t *Timerfd_t) Pollone(pm fdops.Pollmsg_t) (fdops.Ready_t, defs.Err_t) {
+	t.Lock()
+	defer t.Unlock()
+	if t.exp != 0 {
+		return pm.Events & fdops.R_READ, 0
+	}
+	if pm.Events&fdops.R_READ == 0 || !pm.Dowait {
+		return 0, 0
+	}
+	return 0, t.pollers.Addpoller(&pm)
+}
@@ -40,6 +40,9 @@ type Cwd_t struct {
 	sync.Mutex // to serialize chdirs
 	Fd         *Fd_t
 	Path       ustr.Ustr
+	// the number of processes sharing the working directory, which is
+	// more than one after clone(CLONE_FS)
+	refs int
 }
 
 func (cwd *Cwd_t) Fullpath(p ustr.Ustr) ustr.Ustr {
@@ -57,8 +60,40 @@ func (cwd *Cwd_t) Canonicalpath(p ustr.Ustr) ustr.Ustr {
 }
 
 func MkRootCwd(fd *Fd_t) *Cwd_t {
-	c := &Cwd_t{}
+	c := &Cwd_t{refs: 1}
 	c.Fd = fd
 	c.Path = ustr.MkUstrRoot()
 	return c
 }
+
+// returns a private copy of the working directory for a child process
+func (cwd *Cwd_t) Copy() *Cwd_t {
+	cwd.Lock()
+	defer cwd.Unlock()
+	if cwd.Fd.Fops.Reopen() != 0 {
+		panic("must succeed")
+	}
+	return &Cwd_t{Fd: cwd.Fd, Path: cwd.Path, refs: 1}
+}
+
+// adds a reference for another process sharing the working directory
+func (cwd *Cwd_t) Share() *Cwd_t {
+	cwd.Lock()
+	cwd.refs++
+	cwd.Unlock()
+	return cwd
+}
+
+// drops a process' reference; the last reference closes the directory
+func (cwd *Cwd_t) Release() {
+	cwd.Lock()
+	cwd.refs--
+	if cwd.refs < 0 {
+		panic("neg cwd refs")
+	}
+	last := cwd.refs == 0
+	cwd.Unlock()
+	if last {
+		Close_panic(cwd.Fd)
+	}
+}
@@ -0,0 +1,309 @@
+package fdops
+
+import "sync"
+import "sync/atomic"
+import "time"
+
+import "defs"
+import "tinfo"
+
+// an epoll instance keeps a persistent interest list. every registration has a
+// callback poller with the device of its descriptor, which puts the
+// registration on the ready list when the device wakes its pollers; waiting
+// polls only the registrations on the ready list. a level-triggered
+// registration stays on the ready list while it is ready. an edge-triggered
+// registration is reported once, and again after it has been observed not
+// ready and has become ready. removing a registration or closing the instance
+// cancels the callback pollers, which the devices then drop.
+
+// the registration of a descriptor
+type Epctl_t struct {
+	Events Ready_t
+	// report the events once per transition to ready
+	Edge bool
+	// disable the registration once it reports events
+	Oneshot bool
+	// returned with the events
+	Data int
+}
+
+type Epevent_t struct {
+	Events Ready_t
+	Data   int
+}
+
+type _epitem_t struct {
+	fdn  int
+	fops Fdops_i
+	ctl  Epctl_t
+	pm   Pollmsg_t
+	cb   func(Ready_t)
+	dead func() bool
+	// set once the item is removed; read by devices without locks
+	cancelled int32
+	// the edge-triggered item was reported and has not been observed not
+	// ready since
+	reported bool
+	// the oneshot item reported events
+	disabled bool
+	// protected by the ready list lock; removed is also protected by the
+	// epoll lock. a quiet item is on the ready list only to be observed
+	// not ready.
+	onrl    bool
+	quiet   bool
+	removed bool
+}
+
+type Epoll_t struct {
+	// serializes changes to the interest list and waiters
+	sync.Mutex
+	items map[int]*_epitem_t
+	// devices add items with their locks held, thus the ready list lock is
+	// never held while calling into a device.
+	rl struct {
+		sync.Mutex
+		items []*_epitem_t
+		// closed and replaced when an item becomes ready
+		wake    chan bool
+		pollers Pollers_t
+		closed  bool
+	}
+	// set once the instance is closed; read by devices without locks
+	gone int32
+}
+
+func Mkepoll() *Epoll_t {
+	ep := &Epoll_t{items: make(map[int]*_epitem_t)}
+	ep.rl.wake = make(chan bool)
+	return ep
+}
+
+// puts it on the ready list and wakes the waiters
+func (ep *Epoll_t) _ready(it *_epitem_t) {
+	ep.rl.Lock()
+	if !it.removed && !it.onrl && !ep.rl.closed {
+		it.onrl = true
+		it.quiet = false
+		ep.rl.items = append(ep.rl.items, it)
+		close(ep.rl.wake)
+		ep.rl.wake = make(chan bool)
+		ep.rl.pollers.Wakeready(R_READ)
+	}
+	ep.rl.Unlock()
+}
+
+// returns the ready events of it. the device calls back once it becomes ready
+// if it is not ready now.
+func (ep *Epoll_t) _poll(it *_epitem_t) (Ready_t, defs.Err_t) {
+	// errors and hangups are always reported
+	it.pm.Pm_setcb(it.ctl.Events|R_ERROR|R_HUP, it.cb, it.dead)
+	return it.fops.Pollone(it.pm)
+}
+
+// ep must be locked
+func (ep *Epoll_t) _remove(it *_epitem_t) {
+	delete(ep.items, it.fdn)
+	atomic.StoreInt32(&it.cancelled, 1)
+	ep.rl.Lock()
+	it.removed = true
+	ep.rl.Unlock()
+}
+
+// returns the registration of the descriptor fdn, which refers to fops. a
+// registration of a closed descriptor with the same number is removed. ep must
+// be locked.
+func (ep *Epoll_t) _lookup(fdn int, fops Fdops_i) (*_epitem_t, bool) {
+	it, ok := ep.items[fdn]
+	if !ok {
+		return nil, false
+	}
+	if it.fops != fops {
+		ep._remove(it)
+		return nil, false
+	}
+	return it, true
+}
+
+// registers the descriptor fdn, which refers to fops
+func (ep *Epoll_t) Add(fdn int, fops Fdops_i, ctl Epctl_t) defs.Err_t {
+	ep.Lock()
+	defer ep.Unlock()
+	if _, ok := ep._lookup(fdn, fops); ok {
+		return -defs.EEXIST
+	}
+	it := &_epitem_t{fdn: fdn, fops: fops, ctl: ctl}
+	it.cb = func(Ready_t) {
+		ep._ready(it)
+	}
+	it.dead = func() bool {
+		return atomic.LoadInt32(&it.cancelled) != 0 ||
+			atomic.LoadInt32(&ep.gone) != 0
+	}
+	ep.items[fdn] = it
+	r, err := ep._poll(it)
+	if err != 0 {
+		ep._remove(it)
+		return err
+	}
+	if r != 0 {
+		ep._ready(it)
+	}
+	return 0
+}
+
+// changes the registration of the descriptor fdn and enables it again
+func (ep *Epoll_t) Mod(fdn int, fops Fdops_i, ctl Epctl_t) defs.Err_t {
+	ep.Lock()
+	defer ep.Unlock()
+	it, ok := ep._lookup(fdn, fops)
+	if !ok {
+		return -defs.ENOENT
+	}
+	it.ctl = ctl
+	it.reported = false
+	it.disabled = false
+	r, err := ep._poll(it)
+	if err != 0 {
+		return err
+	}
+	if r != 0 {
+		ep._ready(it)
+	}
+	return 0
+}
+
+func (ep *Epoll_t) Del(fdn int, fops Fdops_i) defs.Err_t {
+	ep.Lock()
+	defer ep.Unlock()
+	it, ok := ep._lookup(fdn, fops)
+	if !ok {
+		return -defs.ENOENT
+	}
+	ep._remove(it)
+	return 0
+}
+
+// returns the events of at most max ready registrations. ep must be locked.
+func (ep *Epoll_t) _harvest(max int, live func(int, Fdops_i) bool) []Epevent_t {
+	ep.rl.Lock()
+	items := ep.rl.items
+	ep.rl.items = nil
+	for _, it := range items {
+		it.onrl = false
+	}
+	ep.rl.Unlock()
+
+	var ret []Epevent_t
+	// the items which go back on the ready list
+	var keep []*_epitem_t
+	for i, it := range items {
+		if len(ret) == max {
+			keep = append(keep, items[i:]...)
+			break
+		}
+		if it.removed || it.disabled {
+			continue
+		}
+		if !live(it.fdn, it.fops) {
+			ep._remove(it)
+			continue
+		}
+		r, err := ep._poll(it)
+		if err != 0 {
+			r = R_ERROR
+		}
+		if r == 0 {
+			// the device calls back
+			it.reported = false
+			continue
+		}
+		if it.ctl.Edge && it.reported {
+			keep = append(keep, it)
+			continue
+		}
+		ret = append(ret, Epevent_t{Events: r, Data: it.ctl.Data})
+		switch {
+		case it.ctl.Oneshot:
+			it.disabled = true
+		case it.ctl.Edge:
+			it.reported = true
+			keep = append(keep, it)
+		default:
+			keep = append(keep, it)
+		}
+	}
+
+	ep.rl.Lock()
+	for _, it := range keep {
+		if !it.onrl && !it.removed {
+			it.onrl = true
+			it.quiet = it.ctl.Edge && it.reported
+			ep.rl.items = append(ep.rl.items, it)
+		}
+	}
+	ep.rl.Unlock()
+	return ret
+}
+
+// returns the events of at most max ready registrations. waits for at most
+// timeout milliseconds for a registration to become ready, or forever if
+// timeout is -1. live reports whether a registered descriptor still refers to
+// the registered file; the registrations of closed descriptors are removed.
+func (ep *Epoll_t) Wait(max, timeout int,
+	live func(int, Fdops_i) bool) ([]Epevent_t, defs.Err_t) {
+	var tochan <-chan time.Time
+	if timeout > 0 {
+		tochan = time.After(time.Duration(timeout) * time.Millisecond)
+	}
+	kn := &tinfo.Current().Killnaps
+	for {
+		// an item which becomes ready after harvesting closes wake
+		ep.rl.Lock()
+		wake := ep.rl.wake
+		ep.rl.Unlock()
+		ep.Lock()
+		ret := ep._harvest(max, live)
+		ep.Unlock()
+		if len(ret) != 0 || timeout == 0 {
+			return ret, 0
+		}
+		select {
+		case <-wake:
+		case <-tochan:
+			return nil, 0
+		case <-kn.Killch:
+			if kn.Kerr == 0 {
+				panic("eh?")
+			}
+			return nil, kn.Kerr
+		}
+	}
+}
+
+// an epoll instance is readable while its ready list holds an item which
+// may report events
+func (ep *Epoll_t) Pollone(pm Pollmsg_t) (Ready_t, defs.Err_t) {
+	ep.rl.Lock()
+	defer ep.rl.Unlock()
+	for _, it := range ep.rl.items {
+		if !it.quiet && !it.removed {
+			return pm.Events & R_READ, 0
+		}
+	}
+	if pm.Events&R_READ == 0 || !pm.Dowait {
+		return 0, 0
+	}
+	return 0, ep.rl.pollers.Addpoller(&pm)
+}
+
+// stops the callbacks of the registrations from queueing them and cancels
+// their callback pollers. the epoll lock
+// is not taken since descriptors may be closed with the descriptor table
+// locked.
+func (ep *Epoll_t) Close() {
+	atomic.StoreInt32(&ep.gone, 1)
+	ep.rl.Lock()
+	ep.rl.closed = true
+	ep.rl.items = nil
+	ep.rl.Unlock()
+}
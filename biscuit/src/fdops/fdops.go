@@ -1,5 +1,6 @@
 package fdops
 
+import "sync/atomic"
 import "time"
 
 import "defs"
@@ -75,13 +76,50 @@ type Fdops_i interface {
 	Shutdown(rdone, wdone bool) defs.Err_t
 }
 
+// implemented by the fops of files which support advisory locks. flock locks
+// belong to the open file and record locks to the process whose pid is owner.
+type Lockable_i interface {
+	Flock(op int) defs.Err_t
+	// sets lk to the first lock which conflicts with lk, or sets lk.Type
+	// to F_UNLCK if there is none
+	Getlk(owner int, lk *Reclock_t) defs.Err_t
+	Setlk(owner int, lk *Reclock_t, wait bool) defs.Err_t
+	// releases the record locks of owner on the file
+	Unlock_owner(owner int)
+}
+
+// a record lock, as in struct flock
+type Reclock_t struct {
+	Type   int
+	Whence int
+	Start  int
+	Len    int
+	Pid    int
+}
+
+// implemented by the fops which can transmit page cache pages without copying
+// them
+type Pagesink_i interface {
+	// queues at most n bytes of pgs, starting at offset off of the first
+	// page, and references the queued pages until they are sent. returns
+	// the number of bytes queued.
+	Sendpages(pgs []mem.Mmapinfo_t, off, n int) (int, defs.Err_t)
+}
+
 type Pollmsg_t struct {
 	notif  chan bool
 	Events Ready_t
 	Dowait bool
 	tid    defs.Tid_t
+	// called instead of notifying a waiting thread
+	cb func(Ready_t)
+	// reports whether the callback poller was cancelled
+	dead func() bool
 }
 
+// the ids of callback pollers are negative so that they never equal a tid
+var _cbid int64 = -1
+
 func (pm *Pollmsg_t) Pm_set(tid defs.Tid_t, events Ready_t, dowait bool) {
 	if pm.notif == nil {
 		// 1-element buffered channel; that way devices can send
@@ -93,6 +131,27 @@ func (pm *Pollmsg_t) Pm_set(tid defs.Tid_t, events Ready_t, dowait bool) {
 	pm.tid = tid
 }
 
+// makes the device call cb with the ready events instead of notifying a
+// thread. a poller keeps its id, thus registering it again replaces the
+// previous registration. once dead returns true, devices drop the poller
+// without calling cb. devices call cb and dead with their locks held, thus
+// neither may call into the device.
+func (pm *Pollmsg_t) Pm_setcb(events Ready_t, cb func(Ready_t),
+	dead func() bool) {
+	if pm.cb == nil {
+		pm.tid = defs.Tid_t(atomic.AddInt64(&_cbid, -1))
+	}
+	pm.Events = events
+	pm.Dowait = true
+	pm.cb = cb
+	pm.dead = dead
+}
+
+// returns true if pm is a cancelled callback poller
+func (pm *Pollmsg_t) _cancelled() bool {
+	return pm.dead != nil && pm.dead()
+}
+
 // returns whether we timed out, and error
 func (pm *Pollmsg_t) Pm_wait(to int) (bool, defs.Err_t) {
 	var tochan <-chan time.Time
@@ -125,6 +184,9 @@ type Pollers_t struct {
 func (p *Pollers_t) _find(tid defs.Tid_t, empty bool) (*Pollmsg_t, *Pollmsg_t) {
 	var eret *Pollmsg_t
 	for i := range p.waiters {
+		if p.waiters[i]._cancelled() {
+			p.waiters[i] = Pollmsg_t{}
+		}
 		if p.waiters[i].tid == tid {
 			return &p.waiters[i], eret
 		}
@@ -166,15 +228,23 @@ func (p *Pollers_t) Wakeready(r Ready_t) {
 	var newallmask Ready_t
 	for i := 0; i < len(p.waiters); i++ {
 		pm := p.waiters[i]
-		if pm.Events&r != 0 {
+		if pm._cancelled() {
+			p.waiters[i] = Pollmsg_t{}
+		} else if pm.Events&r != 0 {
 			// found a waiter
 			pm.Events &= r
-			// non-blocking send on a 1-element buffered channel
-			select {
-			case pm.notif <- true:
-			default:
+			if pm.cb != nil {
+				pm.cb(pm.Events)
+			} else {
+				// non-blocking send on a 1-element buffered
+				// channel
+				select {
+				case pm.notif <- true:
+				default:
+				}
 			}
-			p.waiters[i].tid = 0
+			// stale events in an empty slot would notify again
+			p.waiters[i] = Pollmsg_t{}
 		} else {
 			newallmask |= pm.Events
 		}
@@ -258,6 +258,14 @@ func (bcache *bcache_t) unpin(pa mem.Pa_t) {
 	bcache.Relse(b, "unpin")
 }
 
+// returns the pinned block cached in the page pa, if any
+func (bcache *bcache_t) pinned(pa mem.Pa_t) (*Bdev_block_t, bool) {
+	bcache.Lock()
+	defer bcache.Unlock()
+	b, ok := bcache.pins[pa]
+	return b, ok
+}
+
 func bdev_test(mem Blockmem_i, disk Disk_i, bcache *bcache_t) {
 	return
 
@@ -14,6 +14,8 @@ type Blockmem_i interface {
 	Alloc() (mem.Pa_t, *mem.Bytepg_t, bool)
 	Free(mem.Pa_t)
 	Refup(mem.Pa_t)
+	// returns true if a locked mapping maps the page
+	Mlocked(mem.Pa_t) bool
 }
 
 type Block_cb_i interface {
@@ -144,8 +146,9 @@ func (bl *BlkList_t) Delete() {
 }
 
 type Bdev_req_t struct {
-	Cmd   Bdevcmd_t
-	Blks  *BlkList_t
+	Cmd  Bdevcmd_t
+	Blks *BlkList_t
+	// a synchronous request receives whether it succeeded
 	AckCh chan bool
 	Sync  bool
 }
@@ -179,6 +182,11 @@ func (blk *Bdev_block_t) EvictDone() {
 	blk.Mem.Free(blk.Pa)
 }
 
+// blocks whose pages locked mappings map are not evicted
+func (blk *Bdev_block_t) Keep() bool {
+	return blk.Mem.Mlocked(blk.Pa)
+}
+
 func (blk *Bdev_block_t) Tryevict() {
 	blk._try_evict = true
 }
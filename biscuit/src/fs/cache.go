@@ -34,6 +34,11 @@ type Obj_t interface {
 	EvictDone()      // Cache has evicted the object, the refcnt was 0
 }
 
+// an object which Evict_half skips while Keep returns true
+type Keep_i interface {
+	Keep() bool
+}
+
 type Objref_t struct {
 	Key    int
 	Obj    Obj_t
@@ -209,6 +214,9 @@ func (c *cache_t) Evict_half() (int, int) {
 	sort.Sort(ByStamp(elems))
 	for _, p := range elems { // XXX only need the keys, not complete elems
 		e := p.Value.(*Objref_t)
+		if k, ok := e.Obj.(Keep_i); ok && k.Keep() {
+			continue
+		}
 		// evict each inode's dcache before setting REMOVE to ensure
 		// that a concurrent lock-free namei can't succeed on an
 		// evicted inode
@@ -0,0 +1,346 @@
+package fs
+
+import "sync"
+
+import "defs"
+import "fdops"
+import "proc"
+
+// the advisory locks of all files are protected by one lock since deadlock
+// detection follows the waits of processes across files.
+type lockmgr_t struct {
+	sync.Mutex
+	// the owner of a conflicting record lock which each blocked owner
+	// waits for
+	waits map[int]int
+}
+
+func mkLockmgr() *lockmgr_t {
+	return &lockmgr_t{waits: make(map[int]int)}
+}
+
+// returns true if owner waiting for blocker would complete a cycle of waits.
+// lm must be locked.
+func (lm *lockmgr_t) _deadlock(owner, blocker int) bool {
+	cur := blocker
+	// the threads of a process may wait for different owners, thus bound
+	// the walk in case the recorded waits form a cycle without owner
+	for i := 0; i <= len(lm.waits); i++ {
+		if cur == owner {
+			return true
+		}
+		next, ok := lm.waits[cur]
+		if !ok {
+			return false
+		}
+		cur = next
+	}
+	return false
+}
+
+// the advisory locks of an inode. flock locks and record locks do not
+// conflict with each other. protected by the lock manager's lock.
+type ilocks_t struct {
+	// broadcast when a lock is released
+	cond   *sync.Cond
+	flocks []_flock_t
+	recs   []_reclock_t
+}
+
+type _flock_t struct {
+	fo   *fsfops_t
+	excl bool
+}
+
+// locks the bytes [start, end)
+type _reclock_t struct {
+	owner int
+	excl  bool
+	start int
+	end   int
+}
+
+// the end of a record lock which extends past any end of the file
+const _lkeof = int(^uint(0) >> 1)
+
+// returns true if the flock locks of the other open files conflict with a
+// lock of fo.
+func (il *ilocks_t) _fconflict(fo *fsfops_t, excl bool) bool {
+	for _, f := range il.flocks {
+		if f.fo != fo && (excl || f.excl) {
+			return true
+		}
+	}
+	return false
+}
+
+func (il *ilocks_t) _funlock(fo *fsfops_t) {
+	for i, f := range il.flocks {
+		if f.fo == fo {
+			last := len(il.flocks) - 1
+			il.flocks[i] = il.flocks[last]
+			il.flocks = il.flocks[:last]
+			il.cond.Broadcast()
+			return
+		}
+	}
+}
+
+// returns the first record lock of another owner which conflicts with a lock
+// of owner.
+func (il *ilocks_t) _rconflict(owner int, excl bool, start,
+	end int) (_reclock_t, bool) {
+	for _, r := range il.recs {
+		if r.owner != owner && r.start < end && start < r.end &&
+			(excl || r.excl) {
+			return r, true
+		}
+	}
+	return _reclock_t{}, false
+}
+
+// releases the bytes [start, end) of the record locks of owner, splitting the
+// locks which extend past the range.
+func (il *ilocks_t) _runlock(owner, start, end int) {
+	did := false
+	nrecs := il.recs[:0]
+	var split []_reclock_t
+	for _, r := range il.recs {
+		if r.owner != owner || r.end <= start || end <= r.start {
+			nrecs = append(nrecs, r)
+			continue
+		}
+		did = true
+		if r.start < start {
+			left := r
+			left.end = start
+			nrecs = append(nrecs, left)
+		}
+		if end < r.end {
+			right := r
+			right.start = end
+			split = append(split, right)
+		}
+	}
+	il.recs = append(nrecs, split...)
+	if did {
+		il.cond.Broadcast()
+	}
+}
+
+// adds a record lock of owner. owner must not lock any of the bytes already.
+// merges the adjacent locks of owner of the same type.
+func (il *ilocks_t) _rinsert(owner int, excl bool, start, end int) {
+	nrecs := il.recs[:0]
+	for _, r := range il.recs {
+		if r.owner == owner && r.excl == excl {
+			if r.end == start {
+				start = r.start
+				continue
+			}
+			if r.start == end {
+				end = r.end
+				continue
+			}
+		}
+		nrecs = append(nrecs, r)
+	}
+	il.recs = append(nrecs, _reclock_t{owner: owner, excl: excl,
+		start: start, end: end})
+}
+
+// returns the locks of the file's inode, allocating them if alloc is true.
+// the open file holds a reference to the inode, thus the locks remain as long
+// as the file is open.
+func (fo *fsfops_t) _ilocks(alloc bool) *ilocks_t {
+	idm := fo.fs.icache.Iref_locked(fo.priv, "ilocks")
+	lm := fo.fs.locks
+	lm.Lock()
+	if idm.locks == nil && alloc {
+		idm.locks = &ilocks_t{cond: sync.NewCond(lm)}
+	}
+	ret := idm.locks
+	lm.Unlock()
+	idm.iunlock_refdown("ilocks")
+	return ret
+}
+
+func (fo *fsfops_t) _isopen() bool {
+	fo.Lock()
+	defer fo.Unlock()
+	return fo.count > 0
+}
+
+// converting a lock releases it before acquiring it in the new mode, like
+// Linux does.
+func (fo *fsfops_t) Flock(op int) defs.Err_t {
+	nb := op&defs.LOCK_NB != 0
+	op &^= defs.LOCK_NB
+	if op != defs.LOCK_SH && op != defs.LOCK_EX && op != defs.LOCK_UN {
+		return -defs.EINVAL
+	}
+	if !fo._isopen() {
+		return -defs.EBADF
+	}
+	il := fo._ilocks(true)
+	lm := fo.fs.locks
+	lm.Lock()
+	defer lm.Unlock()
+	fo.flk = il
+	il._funlock(fo)
+	if op == defs.LOCK_UN {
+		return 0
+	}
+	excl := op == defs.LOCK_EX
+	for il._fconflict(fo, excl) {
+		if nb {
+			return -defs.EWOULDBLOCK
+		}
+		if err := proc.KillableWait(il.cond); err != 0 {
+			return err
+		}
+	}
+	il.flocks = append(il.flocks, _flock_t{fo: fo, excl: excl})
+	return 0
+}
+
+// returns the bytes [start, end) which lk locks
+func (fo *fsfops_t) _lkrange(lk *fdops.Reclock_t) (int, int, defs.Err_t) {
+	fo.Lock()
+	if fo.count <= 0 {
+		fo.Unlock()
+		return 0, 0, -defs.EBADF
+	}
+	base := fo.offset
+	fo.Unlock()
+	switch lk.Whence {
+	case defs.SEEK_SET:
+		base = 0
+	case defs.SEEK_CUR:
+	case defs.SEEK_END:
+		idm := fo.fs.icache.Iref_locked(fo.priv, "lkrange")
+		base = idm.size
+		idm.iunlock_refdown("lkrange")
+	default:
+		return 0, 0, -defs.EINVAL
+	}
+	start := base + lk.Start
+	end := _lkeof
+	switch {
+	case lk.Len > 0:
+		if start > _lkeof-lk.Len {
+			return 0, 0, -defs.EINVAL
+		}
+		end = start + lk.Len
+	case lk.Len < 0:
+		end = start
+		start += lk.Len
+	}
+	if start < 0 {
+		return 0, 0, -defs.EINVAL
+	}
+	return start, end, 0
+}
+
+func (fo *fsfops_t) Getlk(owner int, lk *fdops.Reclock_t) defs.Err_t {
+	if lk.Type != defs.F_RDLCK && lk.Type != defs.F_WRLCK {
+		return -defs.EINVAL
+	}
+	start, end, err := fo._lkrange(lk)
+	if err != 0 {
+		return err
+	}
+	il := fo._ilocks(false)
+	if il == nil {
+		lk.Type = defs.F_UNLCK
+		return 0
+	}
+	lm := fo.fs.locks
+	lm.Lock()
+	defer lm.Unlock()
+	r, ok := il._rconflict(owner, lk.Type == defs.F_WRLCK, start, end)
+	if !ok {
+		lk.Type = defs.F_UNLCK
+		return 0
+	}
+	lk.Type = defs.F_RDLCK
+	if r.excl {
+		lk.Type = defs.F_WRLCK
+	}
+	lk.Whence = defs.SEEK_SET
+	lk.Start = r.start
+	lk.Len = 0
+	if r.end != _lkeof {
+		lk.Len = r.end - r.start
+	}
+	lk.Pid = r.owner
+	return 0
+}
+
+// waits for the conflicting locks of other owners to be released if wait is
+// true, failing with EDEADLK if the owner of a conflicting lock waits for
+// owner.
+func (fo *fsfops_t) Setlk(owner int, lk *fdops.Reclock_t,
+	wait bool) defs.Err_t {
+	switch lk.Type {
+	case defs.F_RDLCK, defs.F_WRLCK, defs.F_UNLCK:
+	default:
+		return -defs.EINVAL
+	}
+	start, end, err := fo._lkrange(lk)
+	if err != 0 {
+		return err
+	}
+	il := fo._ilocks(true)
+	lm := fo.fs.locks
+	lm.Lock()
+	defer lm.Unlock()
+	if lk.Type == defs.F_UNLCK {
+		il._runlock(owner, start, end)
+		return 0
+	}
+	excl := lk.Type == defs.F_WRLCK
+	for {
+		r, ok := il._rconflict(owner, excl, start, end)
+		if !ok {
+			break
+		}
+		if !wait {
+			return -defs.EAGAIN
+		}
+		if lm._deadlock(owner, r.owner) {
+			return -defs.EDEADLK
+		}
+		lm.waits[owner] = r.owner
+		err := proc.KillableWait(il.cond)
+		delete(lm.waits, owner)
+		if err != 0 {
+			return err
+		}
+	}
+	il._runlock(owner, start, end)
+	il._rinsert(owner, excl, start, end)
+	return 0
+}
+
+func (fo *fsfops_t) Unlock_owner(owner int) {
+	il := fo._ilocks(false)
+	if il == nil {
+		return
+	}
+	lm := fo.fs.locks
+	lm.Lock()
+	il._runlock(owner, 0, _lkeof)
+	lm.Unlock()
+}
+
+// releases the flock lock of fo, which is being closed for the last time
+func (fo *fsfops_t) _flockdone() {
+	lm := fo.fs.locks
+	lm.Lock()
+	if fo.flk != nil {
+		fo.flk._funlock(fo)
+		fo.flk = nil
+	}
+	lm.Unlock()
+}
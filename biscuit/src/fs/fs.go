@@ -10,6 +10,7 @@ import "fd"
 import "fdops"
 import "limits"
 import "mem"
+import "oommsg"
 import "proc"
 import "res"
 import "stat"
@@ -35,6 +36,8 @@ type Fs_t struct {
 	istats       *inode_stats_t
 	root         *imemnode_t
 	diskfs       bool // disk or in-mem file system?
+	watches      *watchtbl_t
+	locks        *lockmgr_t
 }
 
 func StartFS(mem Blockmem_i, disk Disk_i, console proc.Cons_i, diskfs bool) (*fd.Fd_t, *Fs_t) {
@@ -51,6 +54,8 @@ func StartFS(mem Blockmem_i, disk Disk_i, console proc.Cons_i, diskfs bool) (*fd
 	fs.diskfs = diskfs
 	fs.ahci = disk
 	fs.istats = &inode_stats_t{}
+	fs.watches = mkWatchtbl()
+	fs.locks = mkLockmgr()
 	if !fs.diskfs {
 		fmt.Printf("Using MEMORY FS\n")
 	}
@@ -137,6 +142,49 @@ func (fs *Fs_t) Unpin(pa mem.Pa_t) {
 	fs.bcache.unpin(pa)
 }
 
+// journals the blocks which the pinned pages pas cache, like writes to the
+// blocks would. used by msync(2) for shared file mappings. pages which no
+// longer cache a block are skipped.
+func (fs *Fs_t) Pgsync(pas []mem.Pa_t) defs.Err_t {
+	if !fs.diskfs {
+		return 0
+	}
+	for len(pas) != 0 {
+		n := len(pas)
+		if n > MaxBlkPerOp {
+			n = MaxBlkPerOp
+		}
+		opid := fs.fslog.Op_begin("pgsync")
+		for _, pa := range pas[:n] {
+			if b, ok := fs.bcache.pinned(pa); ok {
+				fs.fslog.Write_ordered(opid, b)
+			}
+		}
+		fs.fslog.Op_end(opid)
+		pas = pas[n:]
+	}
+	return 0
+}
+
+// writes the blocks which the pinned pages pas cache to disk and waits until
+// the disk has them. used by msync(2) with MS_SYNC, which thus flushes only
+// the blocks of the mapped file instead of the whole log.
+func (fs *Fs_t) Pgflush(pas []mem.Pa_t) defs.Err_t {
+	if !fs.diskfs {
+		return 0
+	}
+	for _, pa := range pas {
+		if b, ok := fs.bcache.pinned(pa); ok {
+			fs.bcache.Write(b)
+		}
+	}
+	req := MkRequest(nil, BDEV_FLUSH, true)
+	if fs.ahci.Start(req) && !<-req.AckCh {
+		return -defs.EIO
+	}
+	return 0
+}
+
 func (fs *Fs_t) Fs_op_link(old ustr.Ustr, new ustr.Ustr, cwd *fd.Cwd_t) ([]*imemnode_t, defs.Err_t) {
 	opid := fs.fslog.Op_begin("Fs_link")
 	defer fs.fslog.Op_end(opid)
@@ -178,6 +226,8 @@ func (fs *Fs_t) Fs_op_link(old ustr.Ustr, new ustr.Ustr, cwd *fd.Cwd_t) ([]*imem
 	if err != 0 {
 		goto undo
 	}
+	fs._notify(newd.inum, defs.IN_CREATE, 0, fn)
+	fs._notify(inum, defs.IN_ATTRIB, 0, nil)
 	// XXX check for dead and return orig?
 	orig.Refdown("fs_link_orig")
 	return deads, 0
@@ -271,6 +321,11 @@ func (fs *Fs_t) Fs_op_unlink(paths ustr.Ustr, cwd *fd.Cwd_t, wantdir bool) (*ime
 		fmt.Printf("early 3\n")
 		return dead, err
 	}
+	mask := defs.IN_DELETE
+	if child.itype == I_DIR {
+		mask |= defs.IN_ISDIR
+	}
+	fs._notify(par.inum, mask, 0, fn)
 	child._linkdown(opid)
 	del := child.iunlock_refdown("fs_unlink_child")
 	if del {
@@ -495,6 +550,15 @@ func (fs *Fs_t) Fs_op_rename(oldp, newp ustr.Ustr, cwd *fd.Cwd_t) ([]*imemnode_t
 			panic("insert after unlink must succeed")
 		}
 	}
+
+	var isdir int
+	if odir {
+		isdir = defs.IN_ISDIR
+	}
+	cookie := _mkcookie()
+	fs._notify(opar.inum, defs.IN_MOVED_FROM|isdir, cookie, ofn)
+	fs._notify(npar.inum, defs.IN_MOVED_TO|isdir, cookie, nfn)
+	fs._notify(ochild.inum, defs.IN_MOVE_SELF, 0, nil)
 	return refs, nil, 0
 }
 
@@ -579,7 +643,12 @@ type fsfops_t struct {
 	sync.Mutex
 	offset int
 	append bool
-	count  int
+	// opened for writing, for IN_CLOSE_WRITE
+	write bool
+	count int
+	// the locks of the inode once the file has held a flock lock;
+	// protected by the lock manager's lock
+	flk *ilocks_t
 	//hack	*imemnode_t
 }
 
@@ -646,6 +715,9 @@ func (fo *fsfops_t) _write(src fdops.Userio_i, toff int) (int, defs.Err_t) {
 		fo.offset += did
 	}
 	idm.Refdown("_write")
+	if did != 0 {
+		fo.fs._notify(fo.priv, defs.IN_MODIFY, 0, nil)
+	}
 	return did, err
 }
 
@@ -674,6 +746,9 @@ func (fo *fsfops_t) Truncate(newlen uint) defs.Err_t {
 	idm := fo.fs.icache.Iref_locked(fo.priv, "truncate")
 	err := idm.do_trunc(opid, newlen)
 	idm.iunlock_refdown("truncate")
+	if err == 0 {
+		fo.fs._notify(fo.priv, defs.IN_MODIFY, 0, nil)
+	}
 	return err
 }
 
@@ -713,7 +788,16 @@ func (fo *fsfops_t) Close() defs.Err_t {
 		fmt.Printf("Close: %d cnt %d\n", fo.priv, fo.count)
 
 	}
+	last := fo.count == 0
 	fo.Unlock()
+	if last {
+		fo._flockdone()
+		mask := defs.IN_CLOSE_NOWRITE
+		if fo.write {
+			mask = defs.IN_CLOSE_WRITE
+		}
+		fo.fs._notify(fo.priv, mask, 0, nil)
+	}
 	return fo.fs.Fs_close(fo.priv)
 }
 
@@ -839,6 +923,8 @@ func (fo *fsfops_t) Shutdown(read, write bool) defs.Err_t {
 type Devfops_t struct {
 	Maj int
 	Min int
+	// the number of the next OOM event to read
+	oomseq int
 }
 
 func (df *Devfops_t) _sane() {
@@ -846,7 +932,8 @@ func (df *Devfops_t) _sane() {
 	// devices, we can either do dispatch in Devfops_t or we can return
 	// device-specific fdops.Fdops_i in fs_open()
 	if df.Maj != defs.D_CONSOLE && df.Maj != defs.D_DEVNULL &&
-		df.Maj != defs.D_STAT && df.Maj != defs.D_PROF {
+		df.Maj != defs.D_STAT && df.Maj != defs.D_PROF &&
+		df.Maj != defs.D_OOM {
 		panic("bad dev")
 	}
 }
@@ -956,6 +1043,8 @@ func (df *Devfops_t) Read(dst fdops.Userio_i) (int, defs.Err_t) {
 		return stat_read(dst, 0)
 	} else if df.Maj == defs.D_PROF {
 		return _prof_read(dst, 0)
+	} else if df.Maj == defs.D_OOM {
+		return oommsg.Read(dst, &df.oomseq)
 	} else {
 		return 0, 0
 	}
@@ -1050,6 +1139,8 @@ func (df *Devfops_t) Pollone(pm fdops.Pollmsg_t) (fdops.Ready_t, defs.Err_t) {
 		return pm.Events & fdops.R_READ, 0
 	case defs.D_DEVNULL:
 		return pm.Events & (fdops.R_READ | fdops.R_WRITE), 0
+	case defs.D_OOM:
+		return oommsg.Poll(pm, df.oomseq)
 	default:
 		panic("which dev")
 	}
@@ -1281,6 +1372,7 @@ func (fs *Fs_t) Fs_op_mkdir(paths ustr.Ustr, mode int, cwd *fd.Cwd_t) ([]*imemno
 	if err = child.do_insert(opid, ustr.DotDot, par.inum); err != 0 {
 		goto outunlink
 	}
+	fs._notify(par.inum, defs.IN_CREATE|defs.IN_ISDIR, 0, fn)
 	return []*imemnode_t{par, child}, nil, 0
 outunlink:
 	// could do insert last; this cannot fail since par's dirent page is
@@ -1357,6 +1449,9 @@ func (fs *Fs_t) _fs_open_inner(paths ustr.Ustr, flags defs.Fdopt_t, mode int, cw
 			return ret, nil, err
 		}
 		exists := err == -defs.EEXIST
+		if !exists {
+			fs._notify(par.inum, defs.IN_CREATE, 0, fn)
+		}
 		par.iunlock_refdown("Fs_open_inner_par")
 		idm.ilock("child")
 
@@ -1399,7 +1494,10 @@ func (fs *Fs_t) _fs_open_inner(paths ustr.Ustr, flags defs.Fdopt_t, mode int, cw
 	}
 
 	if nodir && trunc {
-		idm.do_trunc(opid, 0)
+		if err := idm.do_trunc(opid, 0); err != 0 {
+			return ret, nil, err
+		}
+		fs._notify(idm.inum, defs.IN_MODIFY, 0, nil)
 	}
 
 	idm.Refup("Fs_open_inner")
@@ -1457,7 +1555,8 @@ func (fs *Fs_t) Fs_open(paths ustr.Ustr, flags defs.Fdopt_t, mode int, cwd *fd.C
 			panic("must succeed")
 		}
 		switch maj {
-		case defs.D_CONSOLE, defs.D_DEVNULL, defs.D_STAT, defs.D_PROF:
+		case defs.D_CONSOLE, defs.D_DEVNULL, defs.D_STAT, defs.D_PROF,
+			defs.D_OOM:
 			if maj == defs.D_STAT {
 				stats_string = fs.Fs_statistics()
 			}
@@ -1469,7 +1568,9 @@ func (fs *Fs_t) Fs_open(paths ustr.Ustr, flags defs.Fdopt_t, mode int, cwd *fd.C
 		}
 	} else {
 		apnd := flags&defs.O_APPEND != 0
-		ret.Fops = &fsfops_t{priv: priv, fs: fs, append: apnd, count: 1}
+		wr := flags&(defs.O_WRONLY|defs.O_RDWR) != 0
+		ret.Fops = &fsfops_t{priv: priv, fs: fs, append: apnd, write: wr,
+			count: 1}
 	}
 	return ret, 0
 }
@@ -185,6 +185,11 @@ type imemnode_t struct {
 	indir  int
 	dindir int
 	addrs  [NIADDRS]int
+	// the file is an active swap area; its blocks are written directly
+	// and thus it must not be written, truncated, or mapped.
+	swapon bool
+	// advisory locks; protected by the lock manager's lock
+	locks *ilocks_t
 	// inode specific metadata blocks
 	dentc struct {
 		// true iff all non-empty directory entries are cached, thus
@@ -322,6 +327,9 @@ func (idm *imemnode_t) do_trunc(opid opid_t, truncto uint) defs.Err_t {
 	if idm.itype != I_FILE && idm.itype != I_DEV {
 		panic("bad truncate")
 	}
+	if idm.swapon {
+		return -defs.ETXTBSY
+	}
 	err := idm.itrunc(opid, truncto)
 	if err == 0 {
 		idm._iupdate(opid)
@@ -364,6 +372,11 @@ func (idm *imemnode_t) do_write(src fdops.Userio_i, offset int, app bool) (int,
 		if idm.itype == I_DIR {
 			panic("write to dir")
 		}
+		if idm.swapon {
+			idm.iunlock("")
+			idm.fs.fslog.Op_end(opid)
+			return i, -defs.ETXTBSY
+		}
 		off := offset + i
 		if app {
 			off = idm.size
@@ -406,6 +419,9 @@ func (idm *imemnode_t) do_mmapi(off, len int, inc bool) ([]mem.Mmapinfo_t, defs.
 	if idm.itype != I_FILE && idm.itype != I_DIR {
 		panic("bad mmapinfo")
 	}
+	if idm.swapon {
+		return nil, -defs.ETXTBSY
+	}
 	return idm.immapinfo(off, len, inc)
 }
 
@@ -483,6 +499,9 @@ func (idm *imemnode_t) _linkdown(opid opid_t) {
 	idm.links--
 	if idm.links <= 0 {
 		idm.fs.icache.markOrphan(opid, idm.inum)
+		idm.fs._notify(idm.inum, defs.IN_DELETE_SELF, 0, nil)
+	} else {
+		idm.fs._notify(idm.inum, defs.IN_ATTRIB, 0, nil)
 	}
 	idm._iupdate(opid)
 }
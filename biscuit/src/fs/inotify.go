@@ -0,0 +1,408 @@
+package fs
+
+import "sync"
+import "sync/atomic"
+
+import "defs"
+import "fd"
+import "fdops"
+import "limits"
+import "mem"
+import "proc"
+import "stat"
+import "ustr"
+import "util"
+
+// a watch reports the events of an inode to an inotify instance. a watch of a
+// directory reports the creation, deletion, and moves of its entries, with
+// their names. the other events are reported only to watches of the inode
+// itself since an inode does not record the directories which link it.
+type _watch_t struct {
+	in   *Inotify_t
+	wd   int
+	inum defs.Inum_t
+	mask int
+}
+
+// the watches of a file system by inode
+type watchtbl_t struct {
+	sync.Mutex
+	m map[defs.Inum_t][]*_watch_t
+	// the number of watches; read without the lock so that operations
+	// skip the table while there are no watches
+	n int64
+}
+
+func mkWatchtbl() *watchtbl_t {
+	return &watchtbl_t{m: make(map[defs.Inum_t][]*_watch_t)}
+}
+
+// removes w and queues IN_IGNORED. tbl and w.in must be locked.
+func (tbl *watchtbl_t) _remove(w *_watch_t) {
+	ws := tbl.m[w.inum]
+	for i := range ws {
+		if ws[i] == w {
+			ws = append(ws[:i], ws[i+1:]...)
+			break
+		}
+	}
+	if len(ws) == 0 {
+		delete(tbl.m, w.inum)
+	} else {
+		tbl.m[w.inum] = ws
+	}
+	atomic.AddInt64(&tbl.n, -1)
+	delete(w.in.watches, w.wd)
+	w.in._queue(_inevent_t{wd: w.wd, mask: defs.IN_IGNORED})
+}
+
+// the events which are queued per instance before IN_Q_OVERFLOW
+const _inqmax = 16384
+
+var _incookie uint32
+
+// returns a cookie which relates the IN_MOVED_FROM and IN_MOVED_TO events of
+// a rename
+func _mkcookie() int {
+	return int(atomic.AddUint32(&_incookie, 1))
+}
+
+// reports an event of the inode inum, or of its entry name if name is not
+// empty. the caller may hold inode locks.
+func (fs *Fs_t) _notify(inum defs.Inum_t, mask, cookie int, name ustr.Ustr) {
+	tbl := fs.watches
+	if atomic.LoadInt64(&tbl.n) == 0 {
+		return
+	}
+	tbl.Lock()
+	defer tbl.Unlock()
+	ws := tbl.m[inum]
+	if len(ws) == 0 {
+		return
+	}
+	// _remove changes the watch list
+	ws = append([]*_watch_t(nil), ws...)
+	for _, w := range ws {
+		w.in.Lock()
+		if w.mask&mask&defs.IN_ALL_EVENTS != 0 {
+			w.in._queue(_inevent_t{wd: w.wd, mask: mask,
+				cookie: cookie, name: name})
+			if w.mask&defs.IN_ONESHOT != 0 {
+				tbl._remove(w)
+			}
+		}
+		// a deleted inode cannot be watched anymore
+		if mask&defs.IN_DELETE_SELF != 0 && w.in.watches[w.wd] == w {
+			tbl._remove(w)
+		}
+		w.in.Unlock()
+	}
+}
+
+type _inevent_t struct {
+	wd     int
+	mask   int
+	cookie int
+	name   ustr.Ustr
+}
+
+// the size of struct inotify_event without the name
+const _ineventsz = 16
+
+// the name is terminated and padded
+func (ev *_inevent_t) size() int {
+	if len(ev.name) == 0 {
+		return _ineventsz
+	}
+	return _ineventsz + util.Roundup(len(ev.name)+1, _ineventsz)
+}
+
+// writes the event as struct inotify_event to buf
+func (ev *_inevent_t) encode(buf []uint8) {
+	util.Writen(buf, 4, 0, ev.wd)
+	util.Writen(buf, 4, 4, ev.mask)
+	util.Writen(buf, 4, 8, ev.cookie)
+	util.Writen(buf, 4, 12, ev.size()-_ineventsz)
+	copy(buf[_ineventsz:], ev.name)
+}
+
+// an inotify instance queues the events of its watches until they are read
+type Inotify_t struct {
+	sync.Mutex
+	fs *Fs_t
+	// broadcast when an event is queued
+	cond *sync.Cond
+	q    []_inevent_t
+	// the watches by descriptor
+	watches map[int]*_watch_t
+	nextwd  int
+	// the number of descriptors which refer to the instance
+	refs    int
+	options defs.Fdopt_t
+	pollers fdops.Pollers_t
+}
+
+func (fs *Fs_t) Mkinotify(nonblock bool) *Inotify_t {
+	ret := &Inotify_t{fs: fs, watches: make(map[int]*_watch_t), nextwd: 1,
+		refs: 1}
+	if nonblock {
+		ret.options = defs.O_NONBLOCK
+	}
+	ret.cond = sync.NewCond(ret)
+	return ret
+}
+
+// queues ev, merging it with an identical unread last event. once the queue is
+// full, the last event is IN_Q_OVERFLOW. in must be locked.
+func (in *Inotify_t) _queue(ev _inevent_t) {
+	if n := len(in.q); n != 0 {
+		last := &in.q[n-1]
+		if last.mask == defs.IN_Q_OVERFLOW {
+			return
+		}
+		if last.wd == ev.wd && last.mask == ev.mask &&
+			last.cookie == ev.cookie && last.name.Eq(ev.name) {
+			return
+		}
+		if n >= _inqmax {
+			ev = _inevent_t{wd: -1, mask: defs.IN_Q_OVERFLOW}
+		}
+	}
+	in.q = append(in.q, ev)
+	in.cond.Broadcast()
+	in.pollers.Wakeready(fdops.R_READ)
+}
+
+// watches the file at path for the events in mask and returns the watch
+// descriptor. a file has at most one watch per instance; watching it again
+// replaces the mask of the watch, or adds to it if mask has IN_MASK_ADD.
+func (in *Inotify_t) Add_watch(path ustr.Ustr, cwd *fd.Cwd_t,
+	mask int) (int, defs.Err_t) {
+	if mask&defs.IN_ALL_EVENTS == 0 {
+		return 0, -defs.EINVAL
+	}
+	idm, dead, err := in.fs.fs_namei_locked(opid_t(0), path, cwd, "inotify")
+	if err != 0 {
+		if dead != nil {
+			dead.Free()
+		}
+		return 0, err
+	}
+	// the inode stays locked so that it cannot be deleted before the watch
+	// is added
+	ret, err := in._add(idm, mask)
+	if idm.iunlock_refdown("inotify") {
+		idm.Free()
+	}
+	return ret, err
+}
+
+func (in *Inotify_t) _add(idm *imemnode_t, mask int) (int, defs.Err_t) {
+	if mask&defs.IN_ONLYDIR != 0 && idm.itype != I_DIR {
+		return 0, -defs.ENOTDIR
+	}
+	tbl := in.fs.watches
+	tbl.Lock()
+	defer tbl.Unlock()
+	in.Lock()
+	defer in.Unlock()
+	keep := defs.IN_ALL_EVENTS | defs.IN_ONESHOT
+	for _, w := range tbl.m[idm.inum] {
+		if w.in == in {
+			if mask&defs.IN_MASK_ADD != 0 {
+				w.mask |= mask & keep
+			} else {
+				w.mask = mask & keep
+			}
+			return w.wd, 0
+		}
+	}
+	if tbl.n >= int64(limits.Syslimit.Inwatches) {
+		limits.Lhits++
+		return 0, -defs.ENOSPC
+	}
+	w := &_watch_t{in: in, wd: in.nextwd, inum: idm.inum, mask: mask & keep}
+	in.nextwd++
+	in.watches[w.wd] = w
+	tbl.m[w.inum] = append(tbl.m[w.inum], w)
+	atomic.AddInt64(&tbl.n, 1)
+	return w.wd, 0
+}
+
+// removes the watch wd and queues IN_IGNORED
+func (in *Inotify_t) Rm_watch(wd int) defs.Err_t {
+	tbl := in.fs.watches
+	tbl.Lock()
+	defer tbl.Unlock()
+	in.Lock()
+	defer in.Unlock()
+	w, ok := in.watches[wd]
+	if !ok {
+		return -defs.EINVAL
+	}
+	tbl._remove(w)
+	return 0
+}
+
+func (in *Inotify_t) Close() defs.Err_t {
+	in.Lock()
+	in.refs--
+	last := in.refs == 0
+	in.Unlock()
+	if !last {
+		return 0
+	}
+	tbl := in.fs.watches
+	tbl.Lock()
+	in.Lock()
+	for _, w := range in.watches {
+		tbl._remove(w)
+	}
+	in.q = nil
+	in.Unlock()
+	tbl.Unlock()
+	return 0
+}
+
+func (in *Inotify_t) Reopen() defs.Err_t {
+	in.Lock()
+	in.refs++
+	in.Unlock()
+	return 0
+}
+
+// returns the queued events which fit in dst. waits for an event. the events
+// are copied to dst without the lock since a fault on dst may modify a file.
+func (in *Inotify_t) Read(dst fdops.Userio_i) (int, defs.Err_t) {
+	in.Lock()
+	for len(in.q) == 0 {
+		if in.options&defs.O_NONBLOCK != 0 {
+			in.Unlock()
+			return 0, -defs.EAGAIN
+		}
+		if err := proc.KillableWait(in.cond); err != 0 {
+			in.Unlock()
+			return 0, err
+		}
+	}
+	if in.q[0].size() > dst.Remain() {
+		in.Unlock()
+		return 0, -defs.EINVAL
+	}
+	var n, sz int
+	for _, ev := range in.q {
+		if sz+ev.size() > dst.Remain() {
+			break
+		}
+		sz += ev.size()
+		n++
+	}
+	buf := make([]uint8, sz)
+	off := 0
+	for i := 0; i < n; i++ {
+		in.q[i].encode(buf[off:])
+		off += in.q[i].size()
+	}
+	in.q = in.q[n:]
+	in.Unlock()
+	return dst.Uiowrite(buf)
+}
+
+func (in *Inotify_t) Write(fdops.Userio_i) (int, defs.Err_t) {
+	return 0, -defs.EINVAL
+}
+
+func (in *Inotify_t) Truncate(uint) defs.Err_t {
+	return -defs.EINVAL
+}
+
+func (in *Inotify_t) Pread(fdops.Userio_i, int) (int, defs.Err_t) {
+	return 0, -defs.ESPIPE
+}
+
+func (in *Inotify_t) Pwrite(fdops.Userio_i, int) (int, defs.Err_t) {
+	return 0, -defs.ESPIPE
+}
+
+func (in *Inotify_t) Fstat(st *stat.Stat_t) defs.Err_t {
+	st.Wdev(0)
+	st.Wmode(0)
+	return 0
+}
+
+func (in *Inotify_t) Lseek(int, int) (int, defs.Err_t) {
+	return 0, -defs.ESPIPE
+}
+
+func (in *Inotify_t) Mmapi(int, int, bool) ([]mem.Mmapinfo_t, defs.Err_t) {
+	return nil, -defs.EINVAL
+}
+
+func (in *Inotify_t) Pathi() defs.Inum_t {
+	panic("inotify cwd")
+}
+
+func (in *Inotify_t) Accept(fdops.Userio_i) (fdops.Fdops_i, int, defs.Err_t) {
+	return nil, 0, -defs.ENOTSOCK
+}
+
+func (in *Inotify_t) Bind([]uint8) defs.Err_t {
+	return -defs.ENOTSOCK
+}
+
+func (in *Inotify_t) Connect([]uint8) defs.Err_t {
+	return -defs.ENOTSOCK
+}
+
+func (in *Inotify_t) Listen(int) (fdops.Fdops_i, defs.Err_t) {
+	return nil, -defs.ENOTSOCK
+}
+
+func (in *Inotify_t) Sendmsg(fdops.Userio_i, []uint8, []uint8,
+	int) (int, defs.Err_t) {
+	return 0, -defs.ENOTSOCK
+}
+
+func (in *Inotify_t) Recvmsg(fdops.Userio_i, fdops.Userio_i,
+	fdops.Userio_i, int) (int, int, int, defs.Msgfl_t, defs.Err_t) {
+	return 0, 0, 0, 0, -defs.ENOTSOCK
+}
+
+// an instance is readable while events are queued
+func (in *Inotify_t) Pollone(pm fdops.Pollmsg_t) (fdops.Ready_t, defs.Err_t) {
+	in.Lock()
+	defer in.Unlock()
+	if len(in.q) != 0 {
+		return pm.Events & fdops.R_READ, 0
+	}
+	if pm.Events&fdops.R_READ == 0 || !pm.Dowait {
+		return 0, 0
+	}
+	return 0, in.pollers.Addpoller(&pm)
+}
+
+func (in *Inotify_t) Fcntl(cmd, opt int) int {
+	in.Lock()
+	defer in.Unlock()
+	switch cmd {
+	case defs.F_GETFL:
+		return int(in.options)
+	case defs.F_SETFL:
+		in.options = defs.Fdopt_t(opt)
+		return 0
+	default:
+		return int(-defs.EINVAL)
+	}
+}
+
+func (in *Inotify_t) Getsockopt(int, fdops.Userio_i, int) (int, defs.Err_t) {
+	return 0, -defs.ENOTSOCK
+}
+
+func (in *Inotify_t) Setsockopt(int, int, fdops.Userio_i, int) defs.Err_t {
+	return -defs.ENOTSOCK
+}
+
+func (in *Inotify_t) Shutdown(read, write bool) defs.Err_t {
+	return -defs.ENOTSOCK
+}
@@ -0,0 +1,143 @@
+package fs
+
+import "defs"
+import "fd"
+import "mem"
+import "ustr"
+
+// a swap area: either a region of the raw disk or the blocks of a regular
+// file. slots are read and written directly, bypassing the block cache and the
+// log, thus an active swap file cannot be written, truncated, or mapped.
+type Swaparea_t struct {
+	fs   *Fs_t
+	blks []int
+	// the swap file or nil for a region of the raw disk
+	idm *imemnode_t
+}
+
+func (sa *Swaparea_t) Slots() int {
+	return len(sa.blks)
+}
+
+func (sa *Swaparea_t) _io(slot int, p_pg mem.Pa_t, cmd Bdevcmd_t) defs.Err_t {
+	b := MkBlock(sa.blks[slot], "swap", nil, sa.fs.ahci, nil)
+	b.Pa = p_pg
+	b.Data = mem.Pg2bytes(mem.Physmem.Dmap(p_pg))
+	l := MkBlkList()
+	l.PushBack(b)
+	req := MkRequest(l, cmd, true)
+	if sa.fs.ahci.Start(req) && !<-req.AckCh {
+		return -defs.EIO
+	}
+	return 0
+}
+
+func (sa *Swaparea_t) Swapread(slot int, p_pg mem.Pa_t) defs.Err_t {
+	return sa._io(slot, p_pg, BDEV_READ)
+}
+
+func (sa *Swaparea_t) Swapwrite(slot int, p_pg mem.Pa_t) defs.Err_t {
+	return sa._io(slot, p_pg, BDEV_WRITE)
+}
+
+func (sa *Swaparea_t) Swapoff() {
+	idm := sa.idm
+	if idm == nil {
+		return
+	}
+	opid := sa.fs.fslog.Op_begin("swapoff")
+	idm.ilock("swapoff")
+	idm.swapon = false
+	del := idm.iunlock_refdown("swapoff")
+	sa.fs.fslog.Op_end(opid)
+	if del {
+		idm.Free()
+	}
+}
+
+// the path of an active swap area
+func (sa *Swaparea_t) Is(path ustr.Ustr, cwd *fd.Cwd_t) bool {
+	idm, dead, err := sa.fs.fs_namei_locked(0, path, cwd, "swapis")
+	if err != 0 {
+		if dead != nil {
+			dead.Free()
+		}
+		return false
+	}
+	ret := idm == sa.idm ||
+		(sa.idm == nil && idm.itype == I_DEV && idm.major == defs.D_RAWDISK)
+	if idm.iunlock_refdown("swapis") {
+		idm.Free()
+	}
+	return ret
+}
+
+// prepares a swap area at path, which is either a raw disk device or a regular
+// file. off and len are the byte offset and length of the area; they must be
+// multiples of the block size. a len of zero means the whole file and is not
+// allowed for the raw disk.
+func (fs *Fs_t) Fs_swapon(path ustr.Ustr, off, len int,
+	cwd *fd.Cwd_t) (*Swaparea_t, defs.Err_t) {
+	if !fs.diskfs {
+		return nil, -defs.EINVAL
+	}
+	if off < 0 || len < 0 || off%BSIZE != 0 || len%BSIZE != 0 {
+		return nil, -defs.EINVAL
+	}
+	// write the file's dirty blocks to their home locations
+	fs.Fs_syncapply()
+	idm, dead, err := fs.fs_namei_locked(0, path, cwd, "swapon")
+	if err != 0 {
+		if dead != nil {
+			dead.Free()
+		}
+		return nil, err
+	}
+	ret := &Swaparea_t{fs: fs}
+	switch {
+	case idm.itype == I_DEV && idm.major == defs.D_RAWDISK:
+		if len == 0 {
+			err = -defs.EINVAL
+			break
+		}
+		for b := off / BSIZE; b < (off+len)/BSIZE; b++ {
+			ret.blks = append(ret.blks, b)
+		}
+	case idm.itype == I_FILE:
+		if idm.swapon {
+			err = -defs.EBUSY
+			break
+		}
+		if len == 0 {
+			len = idm.size - off
+		}
+		if len <= 0 || off+len > idm.size {
+			err = -defs.EINVAL
+			break
+		}
+		for o := off; o < off+len; o += BSIZE {
+			var b int
+			b, _, err = idm.offsetblk(0, o, false)
+			if err != 0 {
+				break
+			}
+			ret.blks = append(ret.blks, b)
+		}
+		if err == 0 {
+			// keep the reference until swapoff
+			idm.swapon = true
+			ret.idm = idm
+			idm.iunlock("swapon")
+			return ret, 0
+		}
+	default:
+		err = -defs.EINVAL
+	}
+	if idm.iunlock_refdown("swapon") {
+		idm.Free()
+	}
+	if err != 0 {
+		return nil, err
+	}
+	return ret, 0
+}
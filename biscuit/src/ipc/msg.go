@@ -0,0 +1,197 @@
+package ipc
+
+import "sync"
+
+import "defs"
+import "limits"
+import "proc"
+import "util"
+
+// the largest message
+const MSGMAX = 8192
+
+type _msg_t struct {
+	mtype int
+	data  []uint8
+}
+
+// a System V message queue
+type Msgq_t struct {
+	sync.Mutex
+	// broadcast when a message is queued or received, or the queue is
+	// removed
+	cond  *sync.Cond
+	msgs  []_msg_t
+	bytes int
+	// the most bytes of queued messages
+	qbytes int
+	// the processes which sent and received last
+	lspid   int
+	lrpid   int
+	key     int
+	mode    int
+	removed bool
+}
+
+var _msgqs = _mktbl()
+
+// returns the id of the message queue with key, creating the queue if
+// necessary.
+func Msgget(key, flags int) (int, defs.Err_t) {
+	mk := func() (interface{}, defs.Err_t) {
+		if _msgqs.count() >= limits.Syslimit.Msgqs {
+			limits.Lhits++
+			return nil, -defs.ENOSPC
+		}
+		q := &Msgq_t{qbytes: limits.Syslimit.Msgqbytes, key: key,
+			mode: flags & 0777}
+		q.cond = sync.NewCond(q)
+		return q, 0
+	}
+	chk := func(interface{}) defs.Err_t {
+		return 0
+	}
+	return _msgqs.get(key, flags, mk, chk)
+}
+
+func Msglookup(id int) (*Msgq_t, defs.Err_t) {
+	obj, ok := _msgqs.lookup(id)
+	if !ok {
+		return nil, -defs.EINVAL
+	}
+	return obj.(*Msgq_t), 0
+}
+
+// removes the queue id and its messages, and wakes the processes which wait
+// on it
+func Msgrmid(id int) defs.Err_t {
+	obj, ok := _msgqs.remove(id)
+	if !ok {
+		return -defs.EINVAL
+	}
+	q := obj.(*Msgq_t)
+	q.Lock()
+	q.removed = true
+	q.msgs = nil
+	q.bytes = 0
+	q.cond.Broadcast()
+	q.Unlock()
+	return 0
+}
+
+// queues a message of type mtype. waits until the queue has room unless
+// nowait is true.
+func (q *Msgq_t) Send(mtype int, data []uint8, nowait bool, pid int) defs.Err_t {
+	if mtype <= 0 || len(data) > MSGMAX {
+		return -defs.EINVAL
+	}
+	q.Lock()
+	defer q.Unlock()
+	for {
+		if q.removed {
+			return -defs.EIDRM
+		}
+		if q.bytes+len(data) <= q.qbytes {
+			break
+		}
+		if nowait {
+			return -defs.EAGAIN
+		}
+		if err := proc.KillableWait(q.cond); err != 0 {
+			return err
+		}
+	}
+	q.msgs = append(q.msgs, _msg_t{mtype, data})
+	q.bytes += len(data)
+	q.lspid = pid
+	q.cond.Broadcast()
+	return 0
+}
+
+// returns the index of the first message which msgtyp selects, or -1
+func (q *Msgq_t) _find(msgtyp int, except bool) int {
+	best := -1
+	for i, m := range q.msgs {
+		switch {
+		case msgtyp == 0:
+			return i
+		case msgtyp > 0 && !except && m.mtype == msgtyp:
+			return i
+		case msgtyp > 0 && except && m.mtype != msgtyp:
+			return i
+		case msgtyp < 0 && m.mtype <= -msgtyp:
+			// the lowest type, oldest first
+			if best == -1 || m.mtype < q.msgs[best].mtype {
+				best = i
+			}
+		}
+	}
+	return best
+}
+
+// dequeues the first message which msgtyp selects: the first message if
+// msgtyp is 0, the first message of type msgtyp if it is positive (or of
+// another type if except is true), and the first message of the lowest type
+// which is at most -msgtyp if it is negative. a message longer than max is
+// truncated if noerror is true and stays queued otherwise. waits for a message
+// unless nowait is true.
+func (q *Msgq_t) Recv(max, msgtyp int, except, noerror, nowait bool,
+	pid int) (int, []uint8, defs.Err_t) {
+	if max < 0 {
+		return 0, nil, -defs.EINVAL
+	}
+	q.Lock()
+	defer q.Unlock()
+	for {
+		if q.removed {
+			return 0, nil, -defs.EIDRM
+		}
+		if i := q._find(msgtyp, except); i != -1 {
+			m := q.msgs[i]
+			if len(m.data) > max && !noerror {
+				return 0, nil, -defs.E2BIG
+			}
+			copy(q.msgs[i:], q.msgs[i+1:])
+			q.msgs = q.msgs[:len(q.msgs)-1]
+			q.bytes -= len(m.data)
+			if len(m.data) > max {
+				m.data = m.data[:max]
+			}
+			q.lrpid = pid
+			q.cond.Broadcast()
+			return m.mtype, m.data, 0
+		}
+		if nowait {
+			return 0, nil, -defs.ENOMSG
+		}
+		if err := proc.KillableWait(q.cond); err != 0 {
+			return 0, nil, err
+		}
+	}
+}
+
+// sets the most bytes of queued messages
+func (q *Msgq_t) Setqbytes(n int) defs.Err_t {
+	if n <= 0 || n > limits.Syslimit.Msgqbytes {
+		return -defs.EINVAL
+	}
+	q.Lock()
+	q.qbytes = n
+	q.cond.Broadcast()
+	q.Unlock()
+	return 0
+}
+
+// returns the queue as struct msqid_ds
+func (q *Msgq_t) Stat() []uint8 {
+	ret := make([]uint8, _ipcpermsz+72)
+	q.Lock()
+	_wrperm(ret, q.key, q.mode)
+	util.Writen(ret, 8, _ipcpermsz+24, q.bytes)
+	util.Writen(ret, 8, _ipcpermsz+32, len(q.msgs))
+	util.Writen(ret, 8, _ipcpermsz+40, q.qbytes)
+	util.Writen(ret, 4, _ipcpermsz+48, q.lspid)
+	util.Writen(ret, 4, _ipcpermsz+52, q.lrpid)
+	q.Unlock()
+	return ret
+}
@@ -0,0 +1,297 @@
+package ipc
+
+import "sync"
+
+import "defs"
+import "limits"
+import "proc"
+import "util"
+
+const (
+	// the most semaphores in a set
+	SEMMSL = 250
+	// the most operations per semop(2)
+	SEMOPM = 32
+	// the largest semaphore value
+	SEMVMX = 32767
+)
+
+// a set of System V semaphores
+type Semset_t struct {
+	sync.Mutex
+	// broadcast whenever a value changes or the set is removed
+	cond *sync.Cond
+	vals []int
+	// the process which last changed each semaphore
+	pids []int
+	// the adjustments which undo the SEM_UNDO operations of each process
+	// by pid
+	undo    map[int][]int
+	key     int
+	mode    int
+	removed bool
+}
+
+// an operation of semop(2)
+type Sembuf_t struct {
+	Num int
+	Op  int
+	Flg int
+}
+
+var _sems = _mktbl()
+
+// returns the id of the semaphore set with key, which has at least nsems
+// semaphores, creating the set if necessary.
+func Semget(key, nsems, flags int) (int, defs.Err_t) {
+	if nsems < 0 || nsems > SEMMSL {
+		return 0, -defs.EINVAL
+	}
+	mk := func() (interface{}, defs.Err_t) {
+		if nsems == 0 {
+			return nil, -defs.EINVAL
+		}
+		if _sems.count() >= limits.Syslimit.Semsets {
+			limits.Lhits++
+			return nil, -defs.ENOSPC
+		}
+		s := &Semset_t{vals: make([]int, nsems), pids: make([]int, nsems),
+			undo: make(map[int][]int), key: key, mode: flags & 0777}
+		s.cond = sync.NewCond(s)
+		return s, 0
+	}
+	chk := func(obj interface{}) defs.Err_t {
+		if nsems > len(obj.(*Semset_t).vals) {
+			return -defs.EINVAL
+		}
+		return 0
+	}
+	return _sems.get(key, flags, mk, chk)
+}
+
+func Semlookup(id int) (*Semset_t, defs.Err_t) {
+	obj, ok := _sems.lookup(id)
+	if !ok {
+		return nil, -defs.EINVAL
+	}
+	return obj.(*Semset_t), 0
+}
+
+// removes the set id and wakes the processes which wait on it
+func Semrmid(id int) defs.Err_t {
+	obj, ok := _sems.remove(id)
+	if !ok {
+		return -defs.EINVAL
+	}
+	s := obj.(*Semset_t)
+	s.Lock()
+	s.removed = true
+	s.cond.Broadcast()
+	s.Unlock()
+	return 0
+}
+
+func (s *Semset_t) Nsems() int {
+	return len(s.vals)
+}
+
+// performs the operations in order and atomically: either all of them or none
+// of them. waits until all of them can be performed, unless an operation which
+// cannot be performed has IPC_NOWAIT. the operations with SEM_UNDO are undone
+// when p terminates.
+func (s *Semset_t) Op(sops []Sembuf_t, p *proc.Proc_t) defs.Err_t {
+	if len(sops) == 0 {
+		return -defs.EINVAL
+	}
+	if len(sops) > SEMOPM {
+		return -defs.E2BIG
+	}
+	for _, op := range sops {
+		if op.Num < 0 || op.Num >= len(s.vals) {
+			return -defs.EFBIG
+		}
+	}
+	s.Lock()
+	defer s.Unlock()
+	for {
+		if s.removed {
+			return -defs.EIDRM
+		}
+		nvals, blk, err := s._try(sops)
+		if err != 0 {
+			return err
+		}
+		if blk == nil {
+			s.vals = nvals
+			for _, op := range sops {
+				s.pids[op.Num] = p.Pid
+				if op.Flg&defs.SEM_UNDO != 0 {
+					s._adjust(p)[op.Num] -= op.Op
+				}
+			}
+			s.cond.Broadcast()
+			return 0
+		}
+		if blk.Flg&defs.IPC_NOWAIT != 0 {
+			return -defs.EAGAIN
+		}
+		if err := proc.KillableWait(s.cond); err != 0 {
+			return err
+		}
+	}
+}
+
+// returns the values after the operations, or the first operation which must
+// wait.
+func (s *Semset_t) _try(sops []Sembuf_t) ([]int, *Sembuf_t, defs.Err_t) {
+	nvals := make([]int, len(s.vals))
+	copy(nvals, s.vals)
+	for i := range sops {
+		op := &sops[i]
+		v := nvals[op.Num] + op.Op
+		switch {
+		case op.Op == 0 && nvals[op.Num] != 0:
+			return nil, op, 0
+		case v < 0:
+			return nil, op, 0
+		case v > SEMVMX:
+			return nil, nil, -defs.ERANGE
+		}
+		nvals[op.Num] = v
+	}
+	return nvals, nil, 0
+}
+
+// returns the adjustments of p. s must be locked.
+func (s *Semset_t) _adjust(p *proc.Proc_t) []int {
+	if adj, ok := s.undo[p.Pid]; ok {
+		return adj
+	}
+	adj := make([]int, len(s.vals))
+	s.undo[p.Pid] = adj
+	p.Semundo_add(s)
+	return adj
+}
+
+// applies the adjustments of process pid, which terminated. a value which
+// would leave the valid range is clamped.
+func (s *Semset_t) Undo(pid int) {
+	s.Lock()
+	defer s.Unlock()
+	adj, ok := s.undo[pid]
+	if !ok || s.removed {
+		return
+	}
+	delete(s.undo, pid)
+	for i, a := range adj {
+		if a == 0 {
+			continue
+		}
+		v := s.vals[i] + a
+		if v < 0 {
+			v = 0
+		}
+		s.vals[i] = util.Min(v, SEMVMX)
+		s.pids[i] = pid
+	}
+	s.cond.Broadcast()
+}
+
+// setting a value discards the adjustments of the semaphore num, or of every
+// semaphore if num is -1. s must be locked.
+func (s *Semset_t) _unadjust(num int) {
+	for _, adj := range s.undo {
+		for i := range adj {
+			if num == -1 || i == num {
+				adj[i] = 0
+			}
+		}
+	}
+}
+
+func (s *Semset_t) _num(num int) defs.Err_t {
+	if s.removed {
+		return -defs.EIDRM
+	}
+	if num < 0 || num >= len(s.vals) {
+		return -defs.EINVAL
+	}
+	return 0
+}
+
+func (s *Semset_t) Getval(num int) (int, defs.Err_t) {
+	s.Lock()
+	defer s.Unlock()
+	if err := s._num(num); err != 0 {
+		return 0, err
+	}
+	return s.vals[num], 0
+}
+
+func (s *Semset_t) Getpid(num int) (int, defs.Err_t) {
+	s.Lock()
+	defer s.Unlock()
+	if err := s._num(num); err != 0 {
+		return 0, err
+	}
+	return s.pids[num], 0
+}
+
+func (s *Semset_t) Setval(num, val, pid int) defs.Err_t {
+	if val < 0 || val > SEMVMX {
+		return -defs.ERANGE
+	}
+	s.Lock()
+	defer s.Unlock()
+	if err := s._num(num); err != 0 {
+		return err
+	}
+	s.vals[num] = val
+	s.pids[num] = pid
+	s._unadjust(num)
+	s.cond.Broadcast()
+	return 0
+}
+
+func (s *Semset_t) Getall() ([]int, defs.Err_t) {
+	s.Lock()
+	defer s.Unlock()
+	if s.removed {
+		return nil, -defs.EIDRM
+	}
+	ret := make([]int, len(s.vals))
+	copy(ret, s.vals)
+	return ret, 0
+}
+
+// sets every semaphore; vals must have a value for each
+func (s *Semset_t) Setall(vals []int, pid int) defs.Err_t {
+	if len(vals) != len(s.vals) {
+		panic("bad semaphore count")
+	}
+	for _, v := range vals {
+		if v < 0 || v > SEMVMX {
+			return -defs.ERANGE
+		}
+	}
+	s.Lock()
+	defer s.Unlock()
+	if s.removed {
+		return -defs.EIDRM
+	}
+	copy(s.vals, vals)
+	for i := range s.pids {
+		s.pids[i] = pid
+	}
+	s._unadjust(-1)
+	s.cond.Broadcast()
+	return 0
+}
+
+// returns the set as struct semid_ds
+func (s *Semset_t) Stat() []uint8 {
+	ret := make([]uint8, _ipcpermsz+56)
+	_wrperm(ret, s.key, s.mode)
+	util.Writen(ret, 8, _ipcpermsz+32, len(s.vals))
+	return ret
+}
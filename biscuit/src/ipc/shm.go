@@ -0,0 +1,491 @@
+package ipc
+
+import "sync"
+import "sync/atomic"
+
+import "defs"
+import "fdops"
+import "limits"
+import "mem"
+import "stat"
+import "ustr"
+import "vm"
+
+// a memory-only object. its pages are allocated when they are first written
+// or mapped, and every shared mapping of the object maps the same pages. the
+// object is freed once it has no name or System V id, no open file
+// descriptors, and no mappings.
+type Shmobj_t struct {
+	sync.Mutex
+	id   int
+	size int
+	// the allocated pages by page number; the others read as zeros
+	pgs map[int]mem.Pa_t
+	// one for the name or System V id and one for each fops in use
+	refs int
+	// the attachments of a System V segment
+	nattch int
+	sysv   struct {
+		key  int
+		mode int
+		cpid int
+		// the process which attached or detached last
+		lpid int
+	}
+}
+
+var _shmnext int64
+
+func _mkshmobj() (*Shmobj_t, defs.Err_t) {
+	if !limits.Syslimit.Shmobjs.Take() {
+		limits.Lhits++
+		return nil, -defs.ENOSPC
+	}
+	ret := &Shmobj_t{pgs: make(map[int]mem.Pa_t), refs: 1}
+	ret.id = int(atomic.AddInt64(&_shmnext, 1))
+	return ret, 0
+}
+
+func (o *Shmobj_t) _refdown() {
+	o.Lock()
+	o.refs--
+	if o.refs < 0 {
+		panic("negative shm refs")
+	}
+	if o.refs != 0 {
+		o.Unlock()
+		return
+	}
+	for _, pa := range o.pgs {
+		mem.Physmem.Refdown(pa)
+	}
+	limits.Syslimit.Shmpgs.Given(uint(len(o.pgs)))
+	o.pgs = nil
+	o.Unlock()
+	limits.Syslimit.Shmobjs.Give()
+}
+
+// returns the page pgn, allocating it if alloc is true. returns 0 if the page
+// is not allocated. o must be locked.
+func (o *Shmobj_t) _page(pgn int, alloc bool) (mem.Pa_t, defs.Err_t) {
+	if pa, ok := o.pgs[pgn]; ok || !alloc {
+		return pa, 0
+	}
+	if !limits.Syslimit.Shmpgs.Take() {
+		limits.Lhits++
+		return 0, -defs.ENOMEM
+	}
+	_, pa, ok := mem.Physmem.Refpg_new()
+	if !ok {
+		limits.Syslimit.Shmpgs.Give()
+		return 0, -defs.ENOMEM
+	}
+	mem.Physmem.Refup(pa)
+	o.pgs[pgn] = pa
+	return pa, 0
+}
+
+// sets the size of o to n bytes. the pages beyond the end are freed and
+// removed from the mappings of o.
+func (o *Shmobj_t) Resize(n int) defs.Err_t {
+	if n < 0 {
+		return -defs.EINVAL
+	}
+	o.Lock()
+	shrunk := n < o.size
+	npg := (n + mem.PGSIZE - 1) >> mem.PGSHIFT
+	for pgn, pa := range o.pgs {
+		if pgn >= npg {
+			mem.Physmem.Refdown(pa)
+			limits.Syslimit.Shmpgs.Give()
+			delete(o.pgs, pgn)
+		}
+	}
+	// a later extension must read zeros
+	if pa, ok := o.pgs[n>>mem.PGSHIFT]; ok && n < o.size {
+		pg := mem.Physmem.Dmap8(pa)
+		for i := n & int(mem.PGOFFSET); i < len(pg); i++ {
+			pg[i] = 0
+		}
+	}
+	o.size = n
+	o.Unlock()
+	// faults lock the address space before o, thus o must be unlocked.
+	// faults beyond the new end fail meanwhile.
+	if shrunk {
+		vm.Truncmaps(func(pc vm.Pagecache_i) bool {
+			sf, ok := pc.(*Shmfops_t)
+			return ok && sf.obj == o
+		}, n)
+	}
+	return 0
+}
+
+func (o *Shmobj_t) Size() int {
+	o.Lock()
+	ret := o.size
+	o.Unlock()
+	return ret
+}
+
+// copies the object's bytes at off to dst. the page is not locked while it is
+// copied since dst may be a mapping of o.
+func (o *Shmobj_t) Read(dst fdops.Userio_i, off int) (int, defs.Err_t) {
+	did := 0
+	for dst.Remain() != 0 {
+		o.Lock()
+		if off >= o.size {
+			o.Unlock()
+			break
+		}
+		pa, _ := o._page(off>>mem.PGSHIFT, false)
+		if pa == 0 {
+			pa = mem.P_zeropg
+		}
+		mem.Physmem.Refup(pa)
+		end := o.size - off
+		o.Unlock()
+		po := off & int(mem.PGOFFSET)
+		src := mem.Physmem.Dmap8(pa)[po:]
+		if len(src) > end {
+			src = src[:end]
+		}
+		c, err := dst.Uiowrite(src)
+		mem.Physmem.Refdown(pa)
+		did += c
+		off += c
+		if err != 0 {
+			return did, err
+		}
+	}
+	return did, 0
+}
+
+// copies src to the object's bytes at off, extending the object if necessary
+func (o *Shmobj_t) Write(src fdops.Userio_i, off int) (int, defs.Err_t) {
+	did := 0
+	for src.Remain() != 0 {
+		o.Lock()
+		pa, err := o._page(off>>mem.PGSHIFT, true)
+		if err != 0 {
+			o.Unlock()
+			return did, err
+		}
+		mem.Physmem.Refup(pa)
+		o.Unlock()
+		po := off & int(mem.PGOFFSET)
+		c, err := src.Uioread(mem.Physmem.Dmap8(pa)[po:])
+		mem.Physmem.Refdown(pa)
+		did += c
+		off += c
+		o.Lock()
+		if off > o.size {
+			o.size = off
+		}
+		o.Unlock()
+		if err != 0 {
+			return did, err
+		}
+	}
+	return did, 0
+}
+
+// returns the pages of the object in [off, off+len). the caller receives a
+// reference to each page.
+func (o *Shmobj_t) Mmapi(off, len int) ([]mem.Mmapinfo_t, defs.Err_t) {
+	o.Lock()
+	defer o.Unlock()
+	if off < 0 || len < 0 || off >= o.size {
+		return nil, -defs.EINVAL
+	}
+	if off+len > o.size {
+		len = o.size - off
+	}
+	first := off >> mem.PGSHIFT
+	last := (off + len - 1) >> mem.PGSHIFT
+	ret := make([]mem.Mmapinfo_t, last-first+1)
+	for i := range ret {
+		pa, err := o._page(first+i, true)
+		if err != 0 {
+			for _, mi := range ret[:i] {
+				mem.Physmem.Refdown(mi.Phys)
+			}
+			return nil, err
+		}
+		mem.Physmem.Refup(pa)
+		ret[i].Pg = mem.Physmem.Dmap(pa)
+		ret[i].Phys = pa
+	}
+	return ret, 0
+}
+
+// opens o; the fops holds a reference to o until it is closed.
+func (o *Shmobj_t) _open(attach bool) *Shmfops_t {
+	o.Lock()
+	o.refs++
+	if attach {
+		o.nattch++
+	}
+	o.Unlock()
+	return &Shmfops_t{obj: o, count: 1, attach: attach}
+}
+
+// the POSIX shared memory objects by name
+var _shmnames = struct {
+	sync.Mutex
+	m map[string]*Shmobj_t
+}{m: make(map[string]*Shmobj_t)}
+
+// names are like "/name"
+func _shmname(name ustr.Ustr) (string, defs.Err_t) {
+	if len(name) < 2 || name[0] != '/' {
+		return "", -defs.EINVAL
+	}
+	for _, c := range name[1:] {
+		if c == '/' {
+			return "", -defs.EINVAL
+		}
+	}
+	return string(name), 0
+}
+
+// opens the object called name, creating it if creat is true. excl makes
+// opening an existing object fail, and trunc truncates the object.
+func Shm_open(name ustr.Ustr, creat, excl, trunc bool) (*Shmfops_t, defs.Err_t) {
+	n, err := _shmname(name)
+	if err != 0 {
+		return nil, err
+	}
+	_shmnames.Lock()
+	defer _shmnames.Unlock()
+	o, ok := _shmnames.m[n]
+	if ok && creat && excl {
+		return nil, -defs.EEXIST
+	}
+	if !ok {
+		if !creat {
+			return nil, -defs.ENOENT
+		}
+		if o, err = _mkshmobj(); err != 0 {
+			return nil, err
+		}
+		_shmnames.m[n] = o
+	}
+	if trunc {
+		o.Resize(0)
+	}
+	return o._open(false), 0
+}
+
+// removes the name of an object; the object is freed once it is not used
+// anymore.
+func Shm_unlink(name ustr.Ustr) defs.Err_t {
+	n, err := _shmname(name)
+	if err != 0 {
+		return err
+	}
+	_shmnames.Lock()
+	o, ok := _shmnames.m[n]
+	delete(_shmnames.m, n)
+	_shmnames.Unlock()
+	if !ok {
+		return -defs.ENOENT
+	}
+	o._refdown()
+	return 0
+}
+
+// the file operations of an open shared memory object or of an attached
+// System V segment. mappings of the object use the fops as their page cache;
+// the pages are always resident, thus there is nothing to unpin or sync.
+type Shmfops_t struct {
+	sync.Mutex
+	obj *Shmobj_t
+	off int
+	// the number of descriptors and mappings which use the fops
+	count int
+	// the fops attaches a System V segment
+	attach  bool
+	options defs.Fdopt_t
+}
+
+func (sf *Shmfops_t) Obj() *Shmobj_t {
+	return sf.obj
+}
+
+// returns true if the fops attaches a System V segment
+func (sf *Shmfops_t) Attached() bool {
+	return sf.attach
+}
+
+func (sf *Shmfops_t) Close() defs.Err_t {
+	sf.Lock()
+	if sf.count <= 0 {
+		sf.Unlock()
+		return -defs.EBADF
+	}
+	sf.count--
+	last := sf.count == 0
+	sf.Unlock()
+	if sf.attach {
+		sf.obj.Lock()
+		sf.obj.nattch--
+		sf.obj.Unlock()
+	}
+	if last {
+		sf.obj._refdown()
+	}
+	return 0
+}
+
+func (sf *Shmfops_t) Reopen() defs.Err_t {
+	sf.Lock()
+	if sf.count <= 0 {
+		sf.Unlock()
+		return -defs.EBADF
+	}
+	sf.count++
+	sf.Unlock()
+	if sf.attach {
+		sf.obj.Lock()
+		sf.obj.nattch++
+		sf.obj.Unlock()
+	}
+	return 0
+}
+
+func (sf *Shmfops_t) Fstat(st *stat.Stat_t) defs.Err_t {
+	st.Wdev(0)
+	st.Wino(uint(sf.obj.id))
+	// a regular file
+	st.Wmode(1 << 16)
+	st.Wsize(uint(sf.obj.Size()))
+	return 0
+}
+
+func (sf *Shmfops_t) Lseek(off, whence int) (int, defs.Err_t) {
+	sf.Lock()
+	defer sf.Unlock()
+	switch whence {
+	case defs.SEEK_SET:
+		sf.off = off
+	case defs.SEEK_CUR:
+		sf.off += off
+	case defs.SEEK_END:
+		sf.off = sf.obj.Size() + off
+	default:
+		return 0, -defs.EINVAL
+	}
+	if sf.off < 0 {
+		sf.off = 0
+	}
+	return sf.off, 0
+}
+
+func (sf *Shmfops_t) Mmapi(off, len int, inc bool) ([]mem.Mmapinfo_t, defs.Err_t) {
+	return sf.obj.Mmapi(off, len)
+}
+
+// shared memory objects have no inode; negative numbers keep their mappings
+// from merging with file mappings.
+func (sf *Shmfops_t) Pathi() defs.Inum_t {
+	return defs.Inum_t(-sf.obj.id)
+}
+
+func (sf *Shmfops_t) Read(dst fdops.Userio_i) (int, defs.Err_t) {
+	sf.Lock()
+	defer sf.Unlock()
+	ret, err := sf.obj.Read(dst, sf.off)
+	sf.off += ret
+	return ret, err
+}
+
+func (sf *Shmfops_t) Write(src fdops.Userio_i) (int, defs.Err_t) {
+	sf.Lock()
+	defer sf.Unlock()
+	ret, err := sf.obj.Write(src, sf.off)
+	sf.off += ret
+	return ret, err
+}
+
+func (sf *Shmfops_t) Truncate(newlen uint) defs.Err_t {
+	if sf.attach {
+		return -defs.EINVAL
+	}
+	return sf.obj.Resize(int(newlen))
+}
+
+func (sf *Shmfops_t) Pread(dst fdops.Userio_i, off int) (int, defs.Err_t) {
+	return sf.obj.Read(dst, off)
+}
+
+func (sf *Shmfops_t) Pwrite(src fdops.Userio_i, off int) (int, defs.Err_t) {
+	return sf.obj.Write(src, off)
+}
+
+func (sf *Shmfops_t) Accept(fdops.Userio_i) (fdops.Fdops_i, int, defs.Err_t) {
+	return nil, 0, -defs.ENOTSOCK
+}
+
+func (sf *Shmfops_t) Bind([]uint8) defs.Err_t {
+	return -defs.ENOTSOCK
+}
+
+func (sf *Shmfops_t) Connect([]uint8) defs.Err_t {
+	return -defs.ENOTSOCK
+}
+
+func (sf *Shmfops_t) Listen(int) (fdops.Fdops_i, defs.Err_t) {
+	return nil, -defs.ENOTSOCK
+}
+
+func (sf *Shmfops_t) Sendmsg(fdops.Userio_i, []uint8, []uint8,
+	int) (int, defs.Err_t) {
+	return 0, -defs.ENOTSOCK
+}
+
+func (sf *Shmfops_t) Recvmsg(fdops.Userio_i, fdops.Userio_i,
+	fdops.Userio_i, int) (int, int, int, defs.Msgfl_t, defs.Err_t) {
+	return 0, 0, 0, 0, -defs.ENOTSOCK
+}
+
+func (sf *Shmfops_t) Pollone(pm fdops.Pollmsg_t) (fdops.Ready_t, defs.Err_t) {
+	return pm.Events & (fdops.R_READ | fdops.R_WRITE), 0
+}
+
+func (sf *Shmfops_t) Fcntl(cmd, opt int) int {
+	sf.Lock()
+	defer sf.Unlock()
+	switch cmd {
+	case defs.F_GETFL:
+		return int(sf.options)
+	case defs.F_SETFL:
+		sf.options = defs.Fdopt_t(opt)
+		return 0
+	default:
+		return int(-defs.EINVAL)
+	}
+}
+
+func (sf *Shmfops_t) Getsockopt(int, fdops.Userio_i, int) (int, defs.Err_t) {
+	return 0, -defs.ENOTSOCK
+}
+
+func (sf *Shmfops_t) Setsockopt(int, int, fdops.Userio_i, int) defs.Err_t {
+	return -defs.ENOTSOCK
+}
+
+func (sf *Shmfops_t) Shutdown(read, write bool) defs.Err_t {
+	return -defs.ENOTSOCK
+}
+
+func (sf *Shmfops_t) Unpin(mem.Pa_t) {
+}
+
+func (sf *Shmfops_t) Pgsync([]mem.Pa_t) defs.Err_t {
+	return 0
+}
+
+func (sf *Shmfops_t) Pgflush([]mem.Pa_t) defs.Err_t {
+	return 0
+}
@@ -0,0 +1,179 @@
+package ipc
+
+import "sync"
+
+import "defs"
+import "util"
+
+// System V objects are named by keys, which processes agree on, and are
+// referred to by ids. an object lives until it is removed with IPC_RMID,
+// though a removed shared memory segment stays until it is detached.
+// permissions are recorded but not checked since there are no users.
+
+type _ipcent_t struct {
+	key int
+	obj interface{}
+}
+
+// the objects of one kind by id, and their ids by key
+type _ipctbl_t struct {
+	sync.Mutex
+	keys map[int]int
+	objs map[int]_ipcent_t
+	next int
+}
+
+func _mktbl() *_ipctbl_t {
+	return &_ipctbl_t{keys: make(map[int]int),
+		objs: make(map[int]_ipcent_t)}
+}
+
+// returns the id of the object with key, creating it with mk if there is none
+// and flags has IPC_CREAT or if key is IPC_PRIVATE. chk validates an existing
+// object against the arguments. mk and chk are called with t locked.
+func (t *_ipctbl_t) get(key, flags int, mk func() (interface{}, defs.Err_t),
+	chk func(interface{}) defs.Err_t) (int, defs.Err_t) {
+	t.Lock()
+	defer t.Unlock()
+	if key != defs.IPC_PRIVATE {
+		if id, ok := t.keys[key]; ok {
+			if flags&defs.IPC_CREAT != 0 && flags&defs.IPC_EXCL != 0 {
+				return 0, -defs.EEXIST
+			}
+			if err := chk(t.objs[id].obj); err != 0 {
+				return 0, err
+			}
+			return id, 0
+		}
+		if flags&defs.IPC_CREAT == 0 {
+			return 0, -defs.ENOENT
+		}
+	}
+	obj, err := mk()
+	if err != 0 {
+		return 0, err
+	}
+	id := t.next
+	t.next++
+	t.objs[id] = _ipcent_t{key, obj}
+	if key != defs.IPC_PRIVATE {
+		t.keys[key] = id
+	}
+	return id, 0
+}
+
+func (t *_ipctbl_t) lookup(id int) (interface{}, bool) {
+	t.Lock()
+	e, ok := t.objs[id]
+	t.Unlock()
+	return e.obj, ok
+}
+
+// removes the object id; its key may name a new object afterwards
+func (t *_ipctbl_t) remove(id int) (interface{}, bool) {
+	t.Lock()
+	defer t.Unlock()
+	e, ok := t.objs[id]
+	if !ok {
+		return nil, false
+	}
+	delete(t.objs, id)
+	if e.key != defs.IPC_PRIVATE {
+		delete(t.keys, e.key)
+	}
+	return e.obj, true
+}
+
+// t must be locked
+func (t *_ipctbl_t) count() int {
+	return len(t.objs)
+}
+
+// the size of struct ipc_perm, which starts the structures of IPC_STAT
+const _ipcpermsz = 48
+
+func _wrperm(buf []uint8, key, mode int) {
+	util.Writen(buf, 4, 0, key)
+	util.Writen(buf, 2, 20, mode)
+}
+
+var _shmsegs = _mktbl()
+
+// returns the id of the shared memory segment with key, which has at least
+// size bytes, creating the segment if necessary.
+func Shmget(key, size, flags, pid int) (int, defs.Err_t) {
+	if size < 0 {
+		return 0, -defs.EINVAL
+	}
+	mk := func() (interface{}, defs.Err_t) {
+		if size == 0 {
+			return nil, -defs.EINVAL
+		}
+		o, err := _mkshmobj()
+		if err != 0 {
+			return nil, err
+		}
+		o.sysv.key = key
+		o.sysv.mode = flags & 0777
+		o.sysv.cpid = pid
+		o.Resize(size)
+		return o, 0
+	}
+	chk := func(obj interface{}) defs.Err_t {
+		if size > obj.(*Shmobj_t).Size() {
+			return -defs.EINVAL
+		}
+		return 0
+	}
+	return _shmsegs.get(key, flags, mk, chk)
+}
+
+// returns an open fops of the segment id for attaching it. the caller maps
+// the fops and closes it.
+func Shmattach(id, pid int) (*Shmfops_t, defs.Err_t) {
+	obj, ok := _shmsegs.lookup(id)
+	if !ok {
+		return nil, -defs.EINVAL
+	}
+	o := obj.(*Shmobj_t)
+	ret := o._open(true)
+	o.Lock()
+	o.sysv.lpid = pid
+	o.Unlock()
+	return ret, 0
+}
+
+// records that pid detached the segment o
+func (o *Shmobj_t) Detached(pid int) {
+	o.Lock()
+	o.sysv.lpid = pid
+	o.Unlock()
+}
+
+// removes the segment id, which is freed once no process attaches it
+func Shmrmid(id int) defs.Err_t {
+	obj, ok := _shmsegs.remove(id)
+	if !ok {
+		return -defs.EINVAL
+	}
+	obj.(*Shmobj_t)._refdown()
+	return 0
+}
+
+// returns the segment id as struct shmid_ds
+func Shmstat(id int) ([]uint8, defs.Err_t) {
+	obj, ok := _shmsegs.lookup(id)
+	if !ok {
+		return nil, -defs.EINVAL
+	}
+	o := obj.(*Shmobj_t)
+	ret := make([]uint8, _ipcpermsz+64)
+	o.Lock()
+	_wrperm(ret, o.sysv.key, o.sysv.mode)
+	util.Writen(ret, 8, _ipcpermsz, o.size)
+	util.Writen(ret, 4, _ipcpermsz+32, o.sysv.cpid)
+	util.Writen(ret, 4, _ipcpermsz+36, o.sysv.lpid)
+	util.Writen(ret, 8, _ipcpermsz+40, o.nattch)
+	o.Unlock()
+	return ret, 0
+}
@@ -0,0 +1,701 @@
+package main
+
+import "runtime"
+import "time"
+
+import "bounds"
+import "defs"
+import "fs"
+import "mem"
+import "proc"
+import "res"
+import "stat"
+
+// the system calls of processes with the PER_LINUX personality, which use the
+// Linux x86-64 numbering and structure layouts. the supported subset is enough
+// for statically linked programs: file I/O, memory mapping, threads, futexes
+// and process creation. signal handlers are not supported.
+var _linuxbounds = []*res.Res_t{
+	defs.LSYS_READ:               bounds.Bounds(bounds.B_SYS_READ),
+	defs.LSYS_WRITE:              bounds.Bounds(bounds.B_SYS_WRITE),
+	defs.LSYS_OPEN:               bounds.Bounds(bounds.B_SYS_OPEN),
+	defs.LSYS_CLOSE:              bounds.Bounds(bounds.B_SYSCALL_T_SYS_CLOSE),
+	defs.LSYS_STAT:               bounds.Bounds(bounds.B_SYS_STAT),
+	defs.LSYS_FSTAT:              bounds.Bounds(bounds.B_SYS_FSTAT),
+	defs.LSYS_LSTAT:              bounds.Bounds(bounds.B_SYS_STAT),
+	defs.LSYS_POLL:               bounds.Bounds(bounds.B_SYS_POLL),
+	defs.LSYS_LSEEK:              bounds.Bounds(bounds.B_SYS_LSEEK),
+	defs.LSYS_MMAP:               bounds.Bounds(bounds.B_SYS_MMAP),
+	defs.LSYS_MPROTECT:           bounds.Bounds(bounds.B_SYS_MPROTECT),
+	defs.LSYS_MUNMAP:             bounds.Bounds(bounds.B_SYS_MUNMAP),
+	defs.LSYS_BRK:                bounds.Bounds(bounds.B_SYS_LINUX),
+	defs.LSYS_RT_SIGACTION:       bounds.Bounds(bounds.B_SYS_LINUX),
+	defs.LSYS_RT_SIGPROCMASK:     bounds.Bounds(bounds.B_SYS_LINUX),
+	defs.LSYS_IOCTL:              bounds.Bounds(bounds.B_SYS_IOCTL),
+	defs.LSYS_PREAD64:            bounds.Bounds(bounds.B_SYS_PREAD),
+	defs.LSYS_PWRITE64:           bounds.Bounds(bounds.B_SYS_PWRITE),
+	defs.LSYS_READV:              bounds.Bounds(bounds.B_SYS_READV),
+	defs.LSYS_WRITEV:             bounds.Bounds(bounds.B_SYS_WRITEV),
+	defs.LSYS_ACCESS:             bounds.Bounds(bounds.B_SYS_ACCESS),
+	defs.LSYS_PIPE:               bounds.Bounds(bounds.B_SYS_PIPE2),
+	defs.LSYS_SCHED_YIELD:        bounds.Bounds(bounds.B_SYS_LINUX),
+	defs.LSYS_MREMAP:             bounds.Bounds(bounds.B_SYS_MREMAP),
+	defs.LSYS_MADVISE:            bounds.Bounds(bounds.B_SYS_MADVISE),
+	defs.LSYS_DUP:                bounds.Bounds(bounds.B_SYS_DUP),
+	defs.LSYS_DUP2:               bounds.Bounds(bounds.B_SYS_DUP2),
+	defs.LSYS_NANOSLEEP:          bounds.Bounds(bounds.B_SYS_NANOSLEEP),
+	defs.LSYS_GETPID:             bounds.Bounds(bounds.B_SYS_GETPID),
+	defs.LSYS_CLONE:              bounds.Bounds(bounds.B_SYS_FORK),
+	defs.LSYS_FORK:               bounds.Bounds(bounds.B_SYS_FORK),
+	defs.LSYS_VFORK:              bounds.Bounds(bounds.B_SYS_FORK),
+	defs.LSYS_EXECVE:             bounds.Bounds(bounds.B_SYS_EXECV),
+	defs.LSYS_EXIT:               bounds.Bounds(bounds.B_SYS_THREXIT),
+	defs.LSYS_WAIT4:              bounds.Bounds(bounds.B_SYS_WAIT4),
+	defs.LSYS_KILL:               bounds.Bounds(bounds.B_SYS_KILL),
+	defs.LSYS_FCNTL:              bounds.Bounds(bounds.B_SYS_FCNTL),
+	defs.LSYS_FTRUNCATE:          bounds.Bounds(bounds.B_SYS_FTRUNCATE),
+	defs.LSYS_GETCWD:             bounds.Bounds(bounds.B_SYS_GETCWD),
+	defs.LSYS_CHDIR:              bounds.Bounds(bounds.B_SYS_CHDIR),
+	defs.LSYS_RENAME:             bounds.Bounds(bounds.B_SYS_RENAME),
+	defs.LSYS_MKDIR:              bounds.Bounds(bounds.B_SYS_MKDIR),
+	defs.LSYS_RMDIR:              bounds.Bounds(bounds.B_SYS_UNLINK),
+	defs.LSYS_LINK:               bounds.Bounds(bounds.B_SYS_LINK),
+	defs.LSYS_UNLINK:             bounds.Bounds(bounds.B_SYS_UNLINK),
+	defs.LSYS_GETTIMEOFDAY:       bounds.Bounds(bounds.B_SYS_GETTIMEOFDAY),
+	defs.LSYS_GETUID:             bounds.Bounds(bounds.B_SYS_LINUX),
+	defs.LSYS_GETGID:             bounds.Bounds(bounds.B_SYS_LINUX),
+	defs.LSYS_GETEUID:            bounds.Bounds(bounds.B_SYS_LINUX),
+	defs.LSYS_GETEGID:            bounds.Bounds(bounds.B_SYS_LINUX),
+	defs.LSYS_GETPPID:            bounds.Bounds(bounds.B_SYS_GETPPID),
+	defs.LSYS_PERSONALITY:        bounds.Bounds(bounds.B_SYS_PERSONALITY),
+	defs.LSYS_GETPRIORITY:        bounds.Bounds(bounds.B_SYS_GETPRIORITY),
+	defs.LSYS_SETPRIORITY:        bounds.Bounds(bounds.B_SYS_SETPRIORITY),
+	defs.LSYS_SCHED_GETPARAM:     bounds.Bounds(bounds.B_SYS_SCHED_GETPARAM),
+	defs.LSYS_SCHED_SETSCHEDULER: bounds.Bounds(bounds.B_SYS_SCHED_SETSCHEDULER),
+	defs.LSYS_SCHED_GETSCHEDULER: bounds.Bounds(bounds.B_SYS_SCHED_GETSCHEDULER),
+	defs.LSYS_ARCH_PRCTL:         bounds.Bounds(bounds.B_SYS_LINUX),
+	defs.LSYS_GETTID:             bounds.Bounds(bounds.B_SYS_GETTID),
+	defs.LSYS_FUTEX:              bounds.Bounds(bounds.B_SYS_FUTEX),
+	defs.LSYS_SCHED_SETAFFINITY:  bounds.Bounds(bounds.B_SYS_SCHED_SETAFFINITY),
+	defs.LSYS_SCHED_GETAFFINITY:  bounds.Bounds(bounds.B_SYS_SCHED_GETAFFINITY),
+	defs.LSYS_SET_TID_ADDRESS:    bounds.Bounds(bounds.B_SYS_LINUX),
+	defs.LSYS_CLOCK_GETTIME:      bounds.Bounds(bounds.B_SYS_GETTIMEOFDAY),
+	defs.LSYS_CLOCK_NANOSLEEP:    bounds.Bounds(bounds.B_SYS_NANOSLEEP),
+	defs.LSYS_EXIT_GROUP:         bounds.Bounds(bounds.B_SYSCALL_T_SYS_EXIT),
+	defs.LSYS_OPENAT:             bounds.Bounds(bounds.B_SYS_OPEN),
+	defs.LSYS_NEWFSTATAT:         bounds.Bounds(bounds.B_SYS_STAT),
+	defs.LSYS_DUP3:               bounds.Bounds(bounds.B_SYS_DUP3),
+	defs.LSYS_PIPE2:              bounds.Bounds(bounds.B_SYS_PIPE2),
+}
+
+// executes a system call of the Linux ABI, which passes the fourth argument in
+// r10 instead of rcx and has a sixth argument in r9.
+func (s *syscall_t) linux_syscall(p *proc.Proc_t, tid defs.Tid_t,
+	tf *[defs.TFSIZE]uintptr) int {
+	sysno := int(tf[defs.TF_RAX])
+	if sysno < 0 || sysno >= len(_linuxbounds) || _linuxbounds[sysno] == nil {
+		return int(-defs.ENOSYS)
+	}
+	if !res.Resadd(_linuxbounds[sysno]) {
+		return int(-defs.ENOHEAP)
+	}
+
+	a1 := int(tf[defs.TF_RDI])
+	a2 := int(tf[defs.TF_RSI])
+	a3 := int(tf[defs.TF_RDX])
+	a4 := int(tf[defs.TF_R10])
+	a5 := int(tf[defs.TF_R8])
+	a6 := int(tf[defs.TF_R9])
+
+	var ret int
+	switch sysno {
+	case defs.LSYS_READ:
+		ret = sys_read(p, a1, a2, a3)
+	case defs.LSYS_WRITE:
+		ret = sys_write(p, a1, a2, a3)
+	case defs.LSYS_OPEN:
+		ret = sys_open(p, a1, a2, a3)
+	case defs.LSYS_CLOSE:
+		ret = s.Sys_close(p, a1)
+	case defs.LSYS_STAT, defs.LSYS_LSTAT:
+		// there are no symbolic links
+		ret = linux_stat(p, a1, a2)
+	case defs.LSYS_FSTAT:
+		ret = linux_fstat(p, a1, a2)
+	case defs.LSYS_POLL:
+		ret = _poll(p, tid, a1, a2, a3, true)
+	case defs.LSYS_LSEEK:
+		ret = linux_lseek(p, a1, a2, a3)
+	case defs.LSYS_MMAP:
+		ret = linux_mmap(p, a1, a2, a3, a4, a5, a6)
+	case defs.LSYS_MPROTECT:
+		ret = sys_mprotect(p, a1, a2, a3)
+	case defs.LSYS_MUNMAP:
+		ret = sys_munmap(p, a1, a2)
+	case defs.LSYS_BRK:
+		// the program break never moves, which the C libraries handle
+		// by allocating with mmap instead
+		ret = 0
+	case defs.LSYS_RT_SIGACTION:
+		ret = linux_rt_sigaction(p, a1, a2, a3, a4)
+	case defs.LSYS_RT_SIGPROCMASK:
+		ret = linux_rt_sigprocmask(p, a1, a2, a3, a4)
+	case defs.LSYS_IOCTL:
+		ret = sys_ioctl(p, a1, a2, a3)
+	case defs.LSYS_PREAD64:
+		ret = sys_pread(p, a1, a2, a3, a4)
+	case defs.LSYS_PWRITE64:
+		ret = sys_pwrite(p, a1, a2, a3, a4)
+	case defs.LSYS_READV:
+		ret = sys_readv(p, a1, a2, a3)
+	case defs.LSYS_WRITEV:
+		ret = sys_writev(p, a1, a2, a3)
+	case defs.LSYS_ACCESS:
+		ret = sys_access(p, a1, a2)
+	case defs.LSYS_PIPE:
+		ret = sys_pipe2(p, a1, 0)
+	case defs.LSYS_SCHED_YIELD:
+		runtime.Gosched()
+	case defs.LSYS_MREMAP:
+		ret = sys_mremap(p, a1, a2, a3, a4)
+	case defs.LSYS_MADVISE:
+		ret = sys_madvise(p, a1, a2, a3)
+	case defs.LSYS_DUP:
+		ret = sys_dup(p, a1)
+	case defs.LSYS_DUP2:
+		ret = sys_dup2(p, a1, a2)
+	case defs.LSYS_NANOSLEEP:
+		ret = sys_nanosleep(p, a1, a2)
+	case defs.LSYS_GETPID:
+		ret = sys_getpid(p, tid)
+	case defs.LSYS_CLONE:
+		ret = sys_clone(p, tf, a1, a2, a3, a4, a5)
+	case defs.LSYS_FORK:
+		ret = sys_clone(p, tf, defs.LSIGCHLD, 0, 0, 0, 0)
+	case defs.LSYS_VFORK:
+		ret = sys_clone(p, tf, defs.CLONE_VM|defs.CLONE_VFORK|
+			defs.LSIGCHLD, 0, 0, 0, 0)
+	case defs.LSYS_EXECVE:
+		ret = sys_execv(p, tf, a1, a2, a3)
+	case defs.LSYS_EXIT:
+		linux_exit(p, tid, a1)
+	case defs.LSYS_WAIT4:
+		ret = linux_wait4(p, a1, a2, a3, a4)
+	case defs.LSYS_KILL:
+		ret = sys_kill(p, a1, a2)
+	case defs.LSYS_FCNTL:
+		ret = linux_fcntl(p, a1, a2, a3)
+	case defs.LSYS_FTRUNCATE:
+		ret = sys_ftruncate(p, a1, uint(a2))
+	case defs.LSYS_GETCWD:
+		ret = linux_getcwd(p, a1, a2)
+	case defs.LSYS_CHDIR:
+		ret = sys_chdir(p, a1)
+	case defs.LSYS_RENAME:
+		ret = sys_rename(p, a1, a2)
+	case defs.LSYS_MKDIR:
+		ret = sys_mkdir(p, a1, a2)
+	case defs.LSYS_RMDIR:
+		ret = sys_unlink(p, a1, 1)
+	case defs.LSYS_LINK:
+		ret = sys_link(p, a1, a2)
+	case defs.LSYS_UNLINK:
+		ret = sys_unlink(p, a1, 0)
+	case defs.LSYS_GETTIMEOFDAY:
+		ret = sys_gettimeofday(p, a1)
+	case defs.LSYS_GETUID, defs.LSYS_GETGID, defs.LSYS_GETEUID,
+		defs.LSYS_GETEGID:
+		// every process runs as root
+		ret = 0
+	case defs.LSYS_GETPPID:
+		ret = sys_getppid(p, tid)
+	case defs.LSYS_PERSONALITY:
+		ret = linux_personality(p, a1)
+	case defs.LSYS_GETPRIORITY:
+		ret = sys_getpriority(p, a1, a2)
+	case defs.LSYS_SETPRIORITY:
+		ret = sys_setpriority(p, a1, a2, a3)
+	case defs.LSYS_SCHED_GETPARAM:
+		ret = sys_sched_getparam(p, a1, a2)
+	case defs.LSYS_SCHED_SETSCHEDULER:
+		ret = sys_sched_setscheduler(p, a1, a2, a3)
+	case defs.LSYS_SCHED_GETSCHEDULER:
+		ret = sys_sched_getscheduler(p, a1)
+	case defs.LSYS_ARCH_PRCTL:
+		ret = linux_arch_prctl(p, tf, a1, a2)
+	case defs.LSYS_GETTID:
+		ret = sys_gettid(p, tid)
+	case defs.LSYS_FUTEX:
+		ret = linux_futex(p, a1, a2, a3, a4, a5, a6)
+	case defs.LSYS_SCHED_SETAFFINITY:
+		ret = sys_sched_setaffinity(p, a1, a2, a3)
+	case defs.LSYS_SCHED_GETAFFINITY:
+		ret = sys_sched_getaffinity(p, a1, a2, a3)
+	case defs.LSYS_SET_TID_ADDRESS:
+		p.Set_cleartid(tid, a1)
+		ret = int(tid)
+	case defs.LSYS_CLOCK_GETTIME:
+		ret = linux_clock_gettime(p, a1, a2)
+	case defs.LSYS_CLOCK_NANOSLEEP:
+		ret = linux_clock_nanosleep(p, a1, a2, a3, a4)
+	case defs.LSYS_EXIT_GROUP:
+		_cleartid(p)
+		s.Sys_exit(p, tid, defs.EXITED|a1&0xff)
+	case defs.LSYS_OPENAT:
+		if ret = linux_atpath(p, a1, a2); ret == 0 {
+			ret = sys_open(p, a2, a3, a4)
+		}
+	case defs.LSYS_NEWFSTATAT:
+		ret = linux_fstatat(p, a1, a2, a3, a4)
+	case defs.LSYS_DUP3:
+		ret = sys_dup3(p, a1, a2, a3)
+	case defs.LSYS_PIPE2:
+		ret = sys_pipe2(p, a1, a2)
+	}
+	return linux_ret(ret)
+}
+
+// the biscuit errnos whose Linux values differ
+var _linuxerrs = map[defs.Err_t]defs.Err_t{
+	defs.ELOOP:         defs.LELOOP,
+	defs.EDESTADDRREQ:  defs.LEDESTADDRREQ,
+	defs.EAFNOSUPPORT:  defs.LEAFNOSUPPORT,
+	defs.EADDRINUSE:    defs.LEADDRINUSE,
+	defs.EADDRNOTAVAIL: defs.LEADDRNOTAVAIL,
+	defs.ENETDOWN:      defs.LENETDOWN,
+	defs.ENETUNREACH:   defs.LENETUNREACH,
+	defs.EHOSTUNREACH:  defs.LEHOSTUNREACH,
+}
+
+// converts the errno of a failed system call to its Linux value. like Linux,
+// return values in [-4095, -1] are errors.
+func linux_ret(ret int) int {
+	if ret < 0 && ret > -4096 {
+		if le, ok := _linuxerrs[defs.Err_t(-ret)]; ok {
+			return int(-le)
+		}
+	}
+	return ret
+}
+
+// returns the Linux st_mode and st_rdev of a file with the biscuit mode. the
+// permission bits are not recorded; every file is accessible.
+func linux_mode(mode uint) (uint, uint) {
+	if maj, min := defs.Unmkdev(mode); maj != 0 {
+		rdev := uint(maj<<8 | min)
+		switch maj {
+		case defs.D_SUD, defs.D_SUS:
+			return defs.LS_IFSOCK | 0777, 0
+		case defs.D_RAWDISK:
+			return defs.LS_IFBLK | 0660, rdev
+		}
+		return defs.LS_IFCHR | 0666, rdev
+	}
+	// regular files, directories and pipes; see mkmode
+	switch mode >> 16 {
+	case 1:
+		return defs.LS_IFREG | 0755, 0
+	case 2:
+		return defs.LS_IFDIR | 0755, 0
+	case 3:
+		return defs.LS_IFIFO | 0600, 0
+	}
+	// anonymous files, such as eventfds
+	return 0600, 0
+}
+
+func _linux_kstat(p *proc.Proc_t, st *stat.Stat_t, statn int) int {
+	mode, rdev := linux_mode(st.Mode())
+	return int(p.Vm.K2user(st.Linux(mode, rdev), statn))
+}
+
+func linux_stat(p *proc.Proc_t, pathn, statn int) int {
+	path, err := p.Vm.Userstr(pathn, fs.NAME_MAX)
+	if err != 0 {
+		return int(err)
+	}
+	st := &stat.Stat_t{}
+	if err := thefs.Fs_stat(path, st, p.Cwd); err != 0 {
+		return int(err)
+	}
+	return _linux_kstat(p, st, statn)
+}
+
+func linux_fstat(p *proc.Proc_t, fdn, statn int) int {
+	f, ok := p.Fd_get(fdn)
+	if !ok {
+		return int(-defs.EBADF)
+	}
+	st := &stat.Stat_t{}
+	if err := f.Fops.Fstat(st); err != 0 {
+		return int(err)
+	}
+	return _linux_kstat(p, st, statn)
+}
+
+// returns an error unless the path of an *at system call is absolute or
+// relative to the working directory; paths relative to a directory file
+// descriptor are not supported.
+func linux_atpath(p *proc.Proc_t, dirfd, pathn int) int {
+	if dirfd == defs.AT_FDCWD {
+		return 0
+	}
+	c, err := p.Vm.Userreadn(pathn, 1)
+	if err != 0 {
+		return int(err)
+	}
+	if c != '/' {
+		return int(-defs.ENOSYS)
+	}
+	return 0
+}
+
+func linux_fstatat(p *proc.Proc_t, dirfd, pathn, statn, flags int) int {
+	if flags&^defs.AT_EMPTY_PATH != 0 {
+		return int(-defs.EINVAL)
+	}
+	if flags&defs.AT_EMPTY_PATH != 0 {
+		c, err := p.Vm.Userreadn(pathn, 1)
+		if err != 0 {
+			return int(err)
+		}
+		if c == 0 {
+			return linux_fstat(p, dirfd, statn)
+		}
+	}
+	if ret := linux_atpath(p, dirfd, pathn); ret != 0 {
+		return ret
+	}
+	return linux_stat(p, pathn, statn)
+}
+
+// the Linux poll(2) event bits and the biscuit bits they correspond to
+var _linuxpoll = []struct {
+	l int
+	b int
+}{
+	{defs.LPOLLIN, defs.POLLIN},
+	{defs.LPOLLPRI, defs.POLLPRI},
+	{defs.LPOLLOUT, defs.POLLOUT},
+	{defs.LPOLLERR, defs.POLLERR},
+	{defs.LPOLLHUP, defs.POLLHUP},
+	{defs.LPOLLNVAL, defs.POLLNVAL},
+	{defs.LPOLLRDNORM, defs.POLLRDNORM},
+	{defs.LPOLLRDBAND, defs.POLLRDBAND},
+	{defs.LPOLLWRNORM, defs.POLLWRNORM},
+	{defs.LPOLLWRBAND, defs.POLLWRBAND},
+}
+
+// returns a copy of the Linux struct pollfds in lbuf with biscuit's event
+// bits
+func linux_pollin(lbuf []uint8) []uint8 {
+	buf := make([]uint8, len(lbuf))
+	for off := 0; off < len(lbuf); off += 8 {
+		uw := readn(lbuf, 8, off)
+		levents := (uw >> 32) & 0xffff
+		events := 0
+		for _, e := range _linuxpoll {
+			if levents&e.l != 0 {
+				events |= e.b
+			}
+		}
+		writen(buf, 8, off, uw&0xffffffff|events<<32)
+	}
+	return buf
+}
+
+// returns a copy of the Linux struct pollfds in lbuf whose revents are those
+// of the biscuit struct pollfds in buf. a Linux bit is reported if the
+// program asked for it, or always for ERR, HUP and NVAL.
+func linux_pollout(lbuf, buf []uint8) []uint8 {
+	always := defs.LPOLLERR | defs.LPOLLHUP | defs.LPOLLNVAL
+	ret := make([]uint8, len(lbuf))
+	for off := 0; off < len(lbuf); off += 8 {
+		luw := readn(lbuf, 8, off)
+		want := (luw>>32)&0xffff | always
+		revents := readn(buf, 8, off) >> 48 & 0xffff
+		lrevents := 0
+		for _, e := range _linuxpoll {
+			if want&e.l != 0 && revents&e.b != 0 {
+				lrevents |= e.l
+			}
+		}
+		writen(ret, 8, off, luw&(1<<48-1)|lrevents<<48)
+	}
+	return ret
+}
+
+func linux_lseek(p *proc.Proc_t, fdn, off, whence int) int {
+	switch whence {
+	case defs.LSEEK_SET:
+		whence = defs.SEEK_SET
+	case defs.LSEEK_CUR:
+		whence = defs.SEEK_CUR
+	case defs.LSEEK_END:
+		whence = defs.SEEK_END
+	default:
+		return int(-defs.EINVAL)
+	}
+	return sys_lseek(p, fdn, off, whence)
+}
+
+// record locks are not supported since struct flock holds a whence value.
+func linux_fcntl(p *proc.Proc_t, fdn, cmd, arg int) int {
+	switch cmd {
+	case defs.LF_DUPFD:
+		cmd = defs.F_DUPFD
+	case defs.LF_DUPFD_CLOEXEC:
+		cmd = defs.F_DUPFD_CLOEXEC
+	case defs.LF_GETFD:
+		cmd = defs.F_GETFD
+	case defs.LF_SETFD:
+		cmd = defs.F_SETFD
+	case defs.LF_GETFL:
+		cmd = defs.F_GETFL
+	case defs.LF_SETFL:
+		cmd = defs.F_SETFL
+	default:
+		return int(-defs.EINVAL)
+	}
+	return sys_fcntl(p, fdn, cmd, arg)
+}
+
+// the mmap flags which only affect Linux's accounting or performance
+const _linux_mapignored = 0x100 | 0x800 | 0x1000 | 0x2000 | 0x4000 |
+	0x8000 | 0x10000 | 0x40000
+
+func linux_mmap(p *proc.Proc_t, addrn, lenn, prot, flags, fdn,
+	offset int) int {
+	flags &^= _linux_mapignored
+	// Linux ignores the file descriptor of anonymous mappings
+	if flags&defs.MAP_ANON != 0 {
+		fdn = -1
+	}
+	return sys_mmap(p, addrn, lenn, prot<<32|int(uint32(flags)), fdn, offset)
+}
+
+const (
+	_SIG_DFL = 0
+	_SIG_IGN = 1
+	// the size of the kernel's struct sigaction
+	_linux_sigactsz = 32
+)
+
+// signal handlers are never invoked, thus only the default and ignore
+// dispositions may be set.
+func linux_rt_sigaction(p *proc.Proc_t, sig, actn, oactn, setsz int) int {
+	if sig < 1 || sig > defs.NSIG || setsz != 8 {
+		return int(-defs.EINVAL)
+	}
+	if actn != 0 {
+		h, err := p.Vm.Userreadn(actn, 8)
+		if err != 0 {
+			return int(err)
+		}
+		if h != _SIG_DFL && h != _SIG_IGN {
+			return int(-defs.ENOSYS)
+		}
+	}
+	if oactn != 0 {
+		buf := make([]uint8, _linux_sigactsz)
+		return int(p.Vm.K2user(buf, oactn))
+	}
+	return 0
+}
+
+// no signals are blocked since no handlers run.
+func linux_rt_sigprocmask(p *proc.Proc_t, how, setn, osetn, setsz int) int {
+	if setsz != 8 {
+		return int(-defs.EINVAL)
+	}
+	if osetn != 0 {
+		return int(p.Vm.Userwriten(osetn, 8, 0))
+	}
+	return 0
+}
+
+// returns the length of the path including the terminator, like Linux.
+func linux_getcwd(p *proc.Proc_t, bufn, sz int) int {
+	l := len(p.Cwd.Path) + 1
+	if sz < l {
+		return int(-defs.ERANGE)
+	}
+	if ret := sys_getcwd(p, bufn, sz); ret != 0 {
+		return ret
+	}
+	return l
+}
+
+// the domain of processes with the Linux ABI is reported as Linux's PER_LINUX,
+// 0, and cannot be changed.
+func linux_personality(p *proc.Proc_t, persona int) int {
+	old := p.Personality &^ defs.PER_MASK
+	if uint32(persona) == 0xffffffff {
+		return old
+	}
+	if persona&^defs.ADDR_NO_RANDOMIZE != 0 {
+		return int(-defs.EINVAL)
+	}
+	p.Personality = persona | defs.PER_LINUX
+	return old
+}
+
+func linux_arch_prctl(p *proc.Proc_t, tf *[defs.TFSIZE]uintptr, code,
+	addr int) int {
+	switch code {
+	case defs.ARCH_SET_FS:
+		if uint(addr) >= uint(mem.USERMAX) {
+			return int(-defs.EPERM)
+		}
+		tf[defs.TF_FSBASE] = uintptr(addr)
+		return 0
+	case defs.ARCH_GET_FS:
+		return int(p.Vm.Userwriten(addr, 8, int(tf[defs.TF_FSBASE])))
+	}
+	return int(-defs.EINVAL)
+}
+
+const (
+	_CLOCK_REALTIME  = 0
+	_CLOCK_MONOTONIC = 1
+	_TIMER_ABSTIME   = 1
+)
+
+// the start of CLOCK_MONOTONIC
+var _linux_boot = time.Now()
+
+func linux_clock_gettime(p *proc.Proc_t, clk, tsn int) int {
+	var ns int64
+	switch clk {
+	case _CLOCK_REALTIME:
+		ns = time.Now().UnixNano()
+	case _CLOCK_MONOTONIC:
+		ns = int64(time.Since(_linux_boot))
+	default:
+		return int(-defs.EINVAL)
+	}
+	buf := make([]uint8, 16)
+	writen(buf, 8, 0, int(ns/1e9))
+	writen(buf, 8, 8, int(ns%1e9))
+	return int(p.Vm.K2user(buf, tsn))
+}
+
+// only relative sleeps are supported.
+func linux_clock_nanosleep(p *proc.Proc_t, clk, flags, reqn, remn int) int {
+	if clk != _CLOCK_REALTIME && clk != _CLOCK_MONOTONIC {
+		return int(-defs.EINVAL)
+	}
+	if flags&_TIMER_ABSTIME != 0 {
+		return int(-defs.ENOSYS)
+	}
+	return sys_nanosleep(p, reqn, remn)
+}
+
+// terminates the calling thread. its clear-tid address is zeroed and woken so
+// that threads joining it notice the exit.
+func linux_exit(p *proc.Proc_t, tid defs.Tid_t, status int) {
+	_cleartid(p)
+	p.Thread_dead(tid, defs.EXITED|status&0xff, true)
+	// threads are joined via the clear-tid address instead of wait4, thus
+	// reap the thread's status now
+	p.Mywait.Reaptid(int(tid), true)
+}
+
+// converts a biscuit exit status to a Linux wait status
+func linux_wstatus(st int) int {
+	if st&defs.SIGNALED != 0 {
+		return (st >> defs.SIGSHIFT) & 0x7f
+	}
+	return (st & 0xff) << defs.LWSIGSHIFT
+}
+
+// process groups are not supported.
+func linux_wait4(p *proc.Proc_t, wpid, statusp, options, rusagep int) int {
+	if options&^defs.LWNOHANG != 0 {
+		return int(-defs.EINVAL)
+	}
+	if wpid == 0 || wpid < defs.WAIT_ANY {
+		return int(-defs.ENOSYS)
+	}
+	resp, err := p.Mywait.Reappid(wpid, options&defs.LWNOHANG != 0)
+	if err != 0 {
+		return int(err)
+	}
+	if resp.Pid == 0 {
+		// WNOHANG and no child has exited
+		return 0
+	}
+	if statusp != 0 {
+		err := p.Vm.Userwriten(statusp, 4, linux_wstatus(resp.Status))
+		if err != 0 {
+			return int(err)
+		}
+	}
+	// update total child rusage, whose layout matches Linux's
+	p.Catime.Add(&resp.Atime)
+	if rusagep != 0 {
+		if err := p.Vm.K2user(resp.Atime.To_rusage(), rusagep); err != 0 {
+			return int(err)
+		}
+	}
+	return resp.Pid
+}
+
+// wakes at most n waiters and returns the number woken.
+func _linux_wake(p *proc.Proc_t, futn, n int) int {
+	if n <= 0 {
+		return 0
+	}
+	return _futex(p, _FUTEX_WAKEN, uintptr(futn), 0, uint32(n),
+		time.Time{}, false)
+}
+
+// futexes are keyed by physical address, thus private futexes are handled
+// like shared ones. a requeue moves all remaining waiters.
+func linux_futex(p *proc.Proc_t, futn, op, val, timeoutn, fut2n,
+	val3 int) int {
+	switch op &^ (defs.LFUTEX_PRIVATE | defs.LFUTEX_CLOCK_REALTIME) {
+	case defs.LFUTEX_WAIT:
+		var when time.Time
+		useto := timeoutn != 0
+		if useto {
+			// the timeout is relative
+			d, _, err := p.Vm.Usertimespec(timeoutn)
+			if err != 0 {
+				return int(err)
+			}
+			if d == 0 {
+				return int(-defs.ETIMEDOUT)
+			}
+			when = time.Now().Add(d)
+		}
+		return _futex(p, defs.FUTEX_SLEEP, uintptr(futn), 0, uint32(val),
+			when, useto)
+	case defs.LFUTEX_WAKE:
+		return _linux_wake(p, futn, val)
+	case defs.LFUTEX_CMP_REQUEUE:
+		v, err := p.Vm.Userreadn(futn, 4)
+		if err != 0 {
+			return int(err)
+		}
+		if uint32(v) != uint32(val3) {
+			return int(-defs.EAGAIN)
+		}
+		fallthrough
+	case defs.LFUTEX_REQUEUE:
+		woke := _linux_wake(p, futn, val)
+		if woke < 0 {
+			return woke
+		}
+		// the timeout argument holds the number of waiters to requeue
+		if timeoutn <= 0 {
+			return woke
+		}
+		if ret := _futex(p, defs.FUTEX_CNDGIVE, uintptr(futn),
+			uintptr(fut2n), 0, time.Time{}, false); ret < 0 {
+			return ret
+		}
+		return woke
+	}
+	return int(-defs.ENOSYS)
+}
@@ -13,7 +13,9 @@ import "ahci"
 import "apic"
 import "bnet"
 import "caller"
+import "cgroup"
 import "defs"
+import "entropy"
 import "inet"
 import "fd"
 import "fdops"
@@ -90,6 +92,7 @@ func trap_disk(intn uint) {
 	for {
 		runtime.IRQsched(intn)
 
+		entropy.Stir(runtime.Rdtsc())
 		// is this a disk int?
 		if !pci.Disk.Intr() {
 			fmt.Printf("spurious disk int\n")
@@ -102,6 +105,7 @@ func trap_disk(intn uint) {
 func trap_cons(intn uint, ch chan bool) {
 	for {
 		runtime.IRQsched(intn)
+		entropy.Stir(runtime.Rdtsc())
 		ch <- true
 	}
 }
@@ -1323,6 +1327,7 @@ func main() {
 
 	structchk()
 	cpuchk()
+	entropy.Entropy_init()
 	bnet.Net_init(mem.Physmem)
 
 	mem.Dmap_init()
@@ -1348,18 +1353,25 @@ func main() {
 	thefs = fs
 
 	proc.Oom_init(thefs.Fs_evict)
+	vm.Swapd_init(proc.Vm_iter)
+	vm.Ksmd_init(proc.Vm_iter)
 
 	exec := func(cmd ustr.Ustr, args []ustr.Ustr) {
 		fmt.Printf("start [%v %v]\n", cmd, args)
 		nargs := []ustr.Ustr{cmd}
 		nargs = append(nargs, args...)
 		defaultfds := []*fd.Fd_t{&fd_stdin, &fd_stdout, &fd_stderr}
-		p, ok := proc.Proc_new(cmd, fd.MkRootCwd(rf), defaultfds, sys)
+		// the process holds its own reference to the root directory
+		if rf.Fops.Reopen() != 0 {
+			panic("must succeed")
+		}
+		p, ok := proc.Proc_new(cmd, fd.MkRootCwd(rf),
+			proc.Mkfdtable(defaultfds), sys, cgroup.Root)
 		if !ok {
 			panic("silly sysprocs")
 		}
 		var tf [defs.TFSIZE]uintptr
-		ret := sys_execv1(p, &tf, cmd, nargs)
+		ret := sys_execv1(p, &tf, cmd, nargs, nil)
 		if ret != 0 {
 			panic(fmt.Sprintf("exec failed %v", ret))
 		}
@@ -14,11 +14,15 @@ import "unsafe"
 import "bnet"
 import "bounds"
 import "bpath"
+import "cgroup"
 import "circbuf"
 import "defs"
+import "entropy"
+import "evfd"
 import "fd"
 import "fdops"
 import "fs"
+import "ipc"
 import "limits"
 import "mem"
 import "proc"
@@ -30,67 +34,121 @@ import "util"
 import "vm"
 
 var _sysbounds = []*res.Res_t{
-	defs.SYS_READ:       bounds.Bounds(bounds.B_SYS_READ),
-	defs.SYS_WRITE:      bounds.Bounds(bounds.B_SYS_WRITE),
-	defs.SYS_OPEN:       bounds.Bounds(bounds.B_SYS_OPEN),
-	defs.SYS_CLOSE:      bounds.Bounds(bounds.B_SYSCALL_T_SYS_CLOSE),
-	defs.SYS_STAT:       bounds.Bounds(bounds.B_SYS_STAT),
-	defs.SYS_FSTAT:      bounds.Bounds(bounds.B_SYS_FSTAT),
-	defs.SYS_POLL:       bounds.Bounds(bounds.B_SYS_POLL),
-	defs.SYS_LSEEK:      bounds.Bounds(bounds.B_SYS_LSEEK),
-	defs.SYS_MMAP:       bounds.Bounds(bounds.B_SYS_MMAP),
-	defs.SYS_MUNMAP:     bounds.Bounds(bounds.B_SYS_MUNMAP),
-	defs.SYS_SIGACT:     bounds.Bounds(bounds.B_SYS_SIGACTION),
-	defs.SYS_READV:      bounds.Bounds(bounds.B_SYS_READV),
-	defs.SYS_WRITEV:     bounds.Bounds(bounds.B_SYS_WRITEV),
-	defs.SYS_ACCESS:     bounds.Bounds(bounds.B_SYS_ACCESS),
-	defs.SYS_DUP2:       bounds.Bounds(bounds.B_SYS_DUP2),
-	defs.SYS_PAUSE:      bounds.Bounds(bounds.B_SYS_PAUSE),
-	defs.SYS_GETPID:     bounds.Bounds(bounds.B_SYS_GETPID),
-	defs.SYS_GETPPID:    bounds.Bounds(bounds.B_SYS_GETPPID),
-	defs.SYS_SOCKET:     bounds.Bounds(bounds.B_SYS_SOCKET),
-	defs.SYS_CONNECT:    bounds.Bounds(bounds.B_SYS_CONNECT),
-	defs.SYS_ACCEPT:     bounds.Bounds(bounds.B_SYS_ACCEPT),
-	defs.SYS_SENDTO:     bounds.Bounds(bounds.B_SYS_SENDTO),
-	defs.SYS_RECVFROM:   bounds.Bounds(bounds.B_SYS_RECVFROM),
-	defs.SYS_SOCKPAIR:   bounds.Bounds(bounds.B_SYS_SOCKETPAIR),
-	defs.SYS_SHUTDOWN:   bounds.Bounds(bounds.B_SYS_SHUTDOWN),
-	defs.SYS_BIND:       bounds.Bounds(bounds.B_SYS_BIND),
-	defs.SYS_LISTEN:     bounds.Bounds(bounds.B_SYS_LISTEN),
-	defs.SYS_RECVMSG:    bounds.Bounds(bounds.B_SYS_RECVMSG),
-	defs.SYS_SENDMSG:    bounds.Bounds(bounds.B_SYS_SENDMSG),
-	defs.SYS_GETSOCKOPT: bounds.Bounds(bounds.B_SYS_GETSOCKOPT),
-	defs.SYS_SETSOCKOPT: bounds.Bounds(bounds.B_SYS_SETSOCKOPT),
-	defs.SYS_FORK:       bounds.Bounds(bounds.B_SYS_FORK),
-	defs.SYS_EXECV:      bounds.Bounds(bounds.B_SYS_EXECV),
-	defs.SYS_EXIT:       bounds.Bounds(bounds.B_SYSCALL_T_SYS_EXIT),
-	defs.SYS_WAIT4:      bounds.Bounds(bounds.B_SYS_WAIT4),
-	defs.SYS_KILL:       bounds.Bounds(bounds.B_SYS_KILL),
-	defs.SYS_FCNTL:      bounds.Bounds(bounds.B_SYS_FCNTL),
-	defs.SYS_TRUNC:      bounds.Bounds(bounds.B_SYS_TRUNCATE),
-	defs.SYS_FTRUNC:     bounds.Bounds(bounds.B_SYS_FTRUNCATE),
-	defs.SYS_GETCWD:     bounds.Bounds(bounds.B_SYS_GETCWD),
-	defs.SYS_CHDIR:      bounds.Bounds(bounds.B_SYS_CHDIR),
-	defs.SYS_RENAME:     bounds.Bounds(bounds.B_SYS_RENAME),
-	defs.SYS_MKDIR:      bounds.Bounds(bounds.B_SYS_MKDIR),
-	defs.SYS_LINK:       bounds.Bounds(bounds.B_SYS_LINK),
-	defs.SYS_UNLINK:     bounds.Bounds(bounds.B_SYS_UNLINK),
-	defs.SYS_GETTOD:     bounds.Bounds(bounds.B_SYS_GETTIMEOFDAY),
-	defs.SYS_GETRLMT:    bounds.Bounds(bounds.B_SYS_GETRLIMIT),
-	defs.SYS_GETRUSG:    bounds.Bounds(bounds.B_SYS_GETRUSAGE),
-	defs.SYS_MKNOD:      bounds.Bounds(bounds.B_SYS_MKNOD),
-	defs.SYS_SETRLMT:    bounds.Bounds(bounds.B_SYS_SETRLIMIT),
-	defs.SYS_SYNC:       bounds.Bounds(bounds.B_SYS_SYNC),
-	defs.SYS_REBOOT:     bounds.Bounds(bounds.B_SYS_REBOOT),
-	defs.SYS_NANOSLEEP:  bounds.Bounds(bounds.B_SYS_NANOSLEEP),
-	defs.SYS_PIPE2:      bounds.Bounds(bounds.B_SYS_PIPE2),
-	defs.SYS_PROF:       bounds.Bounds(bounds.B_SYS_PROF),
-	defs.SYS_THREXIT:    bounds.Bounds(bounds.B_SYS_THREXIT),
-	defs.SYS_INFO:       bounds.Bounds(bounds.B_SYS_INFO),
-	defs.SYS_PREAD:      bounds.Bounds(bounds.B_SYS_PREAD),
-	defs.SYS_PWRITE:     bounds.Bounds(bounds.B_SYS_PWRITE),
-	defs.SYS_FUTEX:      bounds.Bounds(bounds.B_SYS_FUTEX),
-	defs.SYS_GETTID:     bounds.Bounds(bounds.B_SYS_GETTID),
+	defs.SYS_READ:        bounds.Bounds(bounds.B_SYS_READ),
+	defs.SYS_WRITE:       bounds.Bounds(bounds.B_SYS_WRITE),
+	defs.SYS_OPEN:        bounds.Bounds(bounds.B_SYS_OPEN),
+	defs.SYS_CLOSE:       bounds.Bounds(bounds.B_SYSCALL_T_SYS_CLOSE),
+	defs.SYS_STAT:        bounds.Bounds(bounds.B_SYS_STAT),
+	defs.SYS_FSTAT:       bounds.Bounds(bounds.B_SYS_FSTAT),
+	defs.SYS_POLL:        bounds.Bounds(bounds.B_SYS_POLL),
+	defs.SYS_LSEEK:       bounds.Bounds(bounds.B_SYS_LSEEK),
+	defs.SYS_MMAP:        bounds.Bounds(bounds.B_SYS_MMAP),
+	defs.SYS_MPROTECT:    bounds.Bounds(bounds.B_SYS_MPROTECT),
+	defs.SYS_MUNMAP:      bounds.Bounds(bounds.B_SYS_MUNMAP),
+	defs.SYS_MSYNC:       bounds.Bounds(bounds.B_SYS_MSYNC),
+	defs.SYS_MADVISE:     bounds.Bounds(bounds.B_SYS_MADVISE),
+	defs.SYS_SHMGET:      bounds.Bounds(bounds.B_SYS_SHMGET),
+	defs.SYS_SHMAT:       bounds.Bounds(bounds.B_SYS_SHMAT),
+	defs.SYS_SHMCTL:      bounds.Bounds(bounds.B_SYS_SHMCTL),
+	defs.SYS_MREMAP:      bounds.Bounds(bounds.B_SYS_MREMAP),
+	defs.SYS_SIGACT:      bounds.Bounds(bounds.B_SYS_SIGACTION),
+	defs.SYS_IOCTL:       bounds.Bounds(bounds.B_SYS_IOCTL),
+	defs.SYS_READV:       bounds.Bounds(bounds.B_SYS_READV),
+	defs.SYS_WRITEV:      bounds.Bounds(bounds.B_SYS_WRITEV),
+	defs.SYS_ACCESS:      bounds.Bounds(bounds.B_SYS_ACCESS),
+	defs.SYS_DUP:         bounds.Bounds(bounds.B_SYS_DUP),
+	defs.SYS_DUP2:        bounds.Bounds(bounds.B_SYS_DUP2),
+	defs.SYS_DUP3:        bounds.Bounds(bounds.B_SYS_DUP3),
+	defs.SYS_CLOSERANGE:  bounds.Bounds(bounds.B_SYS_CLOSERANGE),
+	defs.SYS_PAUSE:       bounds.Bounds(bounds.B_SYS_PAUSE),
+	defs.SYS_GETPID:      bounds.Bounds(bounds.B_SYS_GETPID),
+	defs.SYS_GETPPID:     bounds.Bounds(bounds.B_SYS_GETPPID),
+	defs.SYS_SOCKET:      bounds.Bounds(bounds.B_SYS_SOCKET),
+	defs.SYS_CONNECT:     bounds.Bounds(bounds.B_SYS_CONNECT),
+	defs.SYS_ACCEPT:      bounds.Bounds(bounds.B_SYS_ACCEPT),
+	defs.SYS_SENDTO:      bounds.Bounds(bounds.B_SYS_SENDTO),
+	defs.SYS_RECVFROM:    bounds.Bounds(bounds.B_SYS_RECVFROM),
+	defs.SYS_SOCKPAIR:    bounds.Bounds(bounds.B_SYS_SOCKETPAIR),
+	defs.SYS_SHUTDOWN:    bounds.Bounds(bounds.B_SYS_SHUTDOWN),
+	defs.SYS_BIND:        bounds.Bounds(bounds.B_SYS_BIND),
+	defs.SYS_LISTEN:      bounds.Bounds(bounds.B_SYS_LISTEN),
+	defs.SYS_RECVMSG:     bounds.Bounds(bounds.B_SYS_RECVMSG),
+	defs.SYS_SENDMSG:     bounds.Bounds(bounds.B_SYS_SENDMSG),
+	defs.SYS_GETSOCKOPT:  bounds.Bounds(bounds.B_SYS_GETSOCKOPT),
+	defs.SYS_SETSOCKOPT:  bounds.Bounds(bounds.B_SYS_SETSOCKOPT),
+	defs.SYS_FORK:        bounds.Bounds(bounds.B_SYS_FORK),
+	defs.SYS_CLONE:       bounds.Bounds(bounds.B_SYS_CLONE),
+	defs.SYS_SPAWN:       bounds.Bounds(bounds.B_SYS_SPAWN),
+	defs.SYS_EXECV:       bounds.Bounds(bounds.B_SYS_EXECV),
+	defs.SYS_EXIT:        bounds.Bounds(bounds.B_SYSCALL_T_SYS_EXIT),
+	defs.SYS_WAIT4:       bounds.Bounds(bounds.B_SYS_WAIT4),
+	defs.SYS_KILL:        bounds.Bounds(bounds.B_SYS_KILL),
+	defs.SYS_SEMGET:      bounds.Bounds(bounds.B_SYS_SEMGET),
+	defs.SYS_SEMOP:       bounds.Bounds(bounds.B_SYS_SEMOP),
+	defs.SYS_SEMCTL:      bounds.Bounds(bounds.B_SYS_SEMCTL),
+	defs.SYS_SHMDT:       bounds.Bounds(bounds.B_SYS_SHMDT),
+	defs.SYS_MSGGET:      bounds.Bounds(bounds.B_SYS_MSGGET),
+	defs.SYS_MSGSND:      bounds.Bounds(bounds.B_SYS_MSGSND),
+	defs.SYS_MSGRCV:      bounds.Bounds(bounds.B_SYS_MSGRCV),
+	defs.SYS_MSGCTL:      bounds.Bounds(bounds.B_SYS_MSGCTL),
+	defs.SYS_FCNTL:       bounds.Bounds(bounds.B_SYS_FCNTL),
+	defs.SYS_FLOCK:       bounds.Bounds(bounds.B_SYS_FLOCK),
+	defs.SYS_TRUNC:       bounds.Bounds(bounds.B_SYS_TRUNCATE),
+	defs.SYS_FTRUNC:      bounds.Bounds(bounds.B_SYS_FTRUNCATE),
+	defs.SYS_GETCWD:      bounds.Bounds(bounds.B_SYS_GETCWD),
+	defs.SYS_CHDIR:       bounds.Bounds(bounds.B_SYS_CHDIR),
+	defs.SYS_RENAME:      bounds.Bounds(bounds.B_SYS_RENAME),
+	defs.SYS_MKDIR:       bounds.Bounds(bounds.B_SYS_MKDIR),
+	defs.SYS_LINK:        bounds.Bounds(bounds.B_SYS_LINK),
+	defs.SYS_UNLINK:      bounds.Bounds(bounds.B_SYS_UNLINK),
+	defs.SYS_GETTOD:      bounds.Bounds(bounds.B_SYS_GETTIMEOFDAY),
+	defs.SYS_GETRLMT:     bounds.Bounds(bounds.B_SYS_GETRLIMIT),
+	defs.SYS_GETRUSG:     bounds.Bounds(bounds.B_SYS_GETRUSAGE),
+	defs.SYS_MKNOD:       bounds.Bounds(bounds.B_SYS_MKNOD),
+	defs.SYS_SETRLMT:     bounds.Bounds(bounds.B_SYS_SETRLIMIT),
+	defs.SYS_SYNC:        bounds.Bounds(bounds.B_SYS_SYNC),
+	defs.SYS_SWAPON:      bounds.Bounds(bounds.B_SYS_SWAPON),
+	defs.SYS_SWAPOFF:     bounds.Bounds(bounds.B_SYS_SWAPOFF),
+	defs.SYS_REBOOT:      bounds.Bounds(bounds.B_SYS_REBOOT),
+	defs.SYS_NANOSLEEP:   bounds.Bounds(bounds.B_SYS_NANOSLEEP),
+	defs.SYS_EPOLLWAIT:   bounds.Bounds(bounds.B_SYS_EPOLLWAIT),
+	defs.SYS_EPOLLCTL:    bounds.Bounds(bounds.B_SYS_EPOLLCTL),
+	defs.SYS_INOTIFYADD:  bounds.Bounds(bounds.B_SYS_INOTIFYADD),
+	defs.SYS_INOTIFYRM:   bounds.Bounds(bounds.B_SYS_INOTIFYRM),
+	defs.SYS_TFDCREATE:   bounds.Bounds(bounds.B_SYS_TFDCREATE),
+	defs.SYS_TFDSETTIME:  bounds.Bounds(bounds.B_SYS_TFDSETTIME),
+	defs.SYS_TFDGETTIME:  bounds.Bounds(bounds.B_SYS_TFDGETTIME),
+	defs.SYS_SIGNALFD:    bounds.Bounds(bounds.B_SYS_SIGNALFD),
+	defs.SYS_EVENTFD:     bounds.Bounds(bounds.B_SYS_EVENTFD),
+	defs.SYS_EPOLLCREATE: bounds.Bounds(bounds.B_SYS_EPOLLCREATE),
+	defs.SYS_SENDFILE:    bounds.Bounds(bounds.B_SYS_SENDFILE),
+	defs.SYS_SPLICE:      bounds.Bounds(bounds.B_SYS_SPLICE),
+	defs.SYS_PIPE2:       bounds.Bounds(bounds.B_SYS_PIPE2),
+	defs.SYS_INOTIFYINIT: bounds.Bounds(bounds.B_SYS_INOTIFYINIT),
+	defs.SYS_USERFAULTFD: bounds.Bounds(bounds.B_SYS_USERFAULTFD),
+	defs.SYS_PROF:        bounds.Bounds(bounds.B_SYS_PROF),
+	defs.SYS_THREXIT:     bounds.Bounds(bounds.B_SYS_THREXIT),
+	defs.SYS_INFO:        bounds.Bounds(bounds.B_SYS_INFO),
+	defs.SYS_PREAD:       bounds.Bounds(bounds.B_SYS_PREAD),
+	defs.SYS_PWRITE:      bounds.Bounds(bounds.B_SYS_PWRITE),
+	defs.SYS_FUTEX:       bounds.Bounds(bounds.B_SYS_FUTEX),
+	defs.SYS_GETTID:      bounds.Bounds(bounds.B_SYS_GETTID),
+	defs.SYS_PERSONALITY: bounds.Bounds(bounds.B_SYS_PERSONALITY),
+	defs.SYS_GETPRIO:     bounds.Bounds(bounds.B_SYS_GETPRIORITY),
+	defs.SYS_SETPRIO:     bounds.Bounds(bounds.B_SYS_SETPRIORITY),
+	defs.SYS_SCHGETPARAM: bounds.Bounds(bounds.B_SYS_SCHED_GETPARAM),
+	defs.SYS_SCHSETSCHED: bounds.Bounds(bounds.B_SYS_SCHED_SETSCHEDULER),
+	defs.SYS_SCHGETSCHED: bounds.Bounds(bounds.B_SYS_SCHED_GETSCHEDULER),
+	defs.SYS_SCHSETAFF:   bounds.Bounds(bounds.B_SYS_SCHED_SETAFFINITY),
+	defs.SYS_SCHGETAFF:   bounds.Bounds(bounds.B_SYS_SCHED_GETAFFINITY),
+	defs.SYS_MLOCK:       bounds.Bounds(bounds.B_SYS_MLOCK),
+	defs.SYS_MUNLOCK:     bounds.Bounds(bounds.B_SYS_MUNLOCK),
+	defs.SYS_MLOCKALL:    bounds.Bounds(bounds.B_SYS_MLOCKALL),
+	defs.SYS_MUNLOCKALL:  bounds.Bounds(bounds.B_SYS_MUNLOCKALL),
+	defs.SYS_CGROUP:      bounds.Bounds(bounds.B_SYS_CGROUP),
+	defs.SYS_OOMADJ:      bounds.Bounds(bounds.B_SYS_OOMADJ),
+	defs.SYS_SHMOPEN:     bounds.Bounds(bounds.B_SYS_SHMOPEN),
+	defs.SYS_SHMUNLINK:   bounds.Bounds(bounds.B_SYS_SHMUNLINK),
 }
 
 // Implements Syscall_i
@@ -107,6 +165,10 @@ func (s *syscall_t) Syscall(p *proc.Proc_t, tid defs.Tid_t, tf *[defs.TFSIZE]uin
 		return 0
 	}
 
+	if p.Abi == defs.PER_LINUX {
+		return s.linux_syscall(p, tid, tf)
+	}
+
 	sysno := int(tf[defs.TF_RAX])
 
 	//lim, ok := _sysbounds[sysno]
@@ -148,18 +210,34 @@ func (s *syscall_t) Syscall(p *proc.Proc_t, tid defs.Tid_t, tf *[defs.TFSIZE]uin
 		ret = sys_lseek(p, a1, a2, a3)
 	case defs.SYS_MMAP:
 		ret = sys_mmap(p, a1, a2, a3, a4, a5)
+	case defs.SYS_MPROTECT:
+		ret = sys_mprotect(p, a1, a2, a3)
 	case defs.SYS_MUNMAP:
 		ret = sys_munmap(p, a1, a2)
+	case defs.SYS_MREMAP:
+		ret = sys_mremap(p, a1, a2, a3, a4)
+	case defs.SYS_MSYNC:
+		ret = sys_msync(p, a1, a2, a3)
+	case defs.SYS_MADVISE:
+		ret = sys_madvise(p, a1, a2, a3)
 	case defs.SYS_READV:
 		ret = sys_readv(p, a1, a2, a3)
 	case defs.SYS_WRITEV:
 		ret = sys_writev(p, a1, a2, a3)
 	case defs.SYS_SIGACT:
 		ret = sys_sigaction(p, a1, a2, a3)
+	case defs.SYS_IOCTL:
+		ret = sys_ioctl(p, a1, a2, a3)
 	case defs.SYS_ACCESS:
 		ret = sys_access(p, a1, a2)
+	case defs.SYS_DUP:
+		ret = sys_dup(p, a1)
 	case defs.SYS_DUP2:
 		ret = sys_dup2(p, a1, a2)
+	case defs.SYS_DUP3:
+		ret = sys_dup3(p, a1, a2, a3)
+	case defs.SYS_CLOSERANGE:
+		ret = sys_close_range(p, a1, a2, a3)
 	case defs.SYS_PAUSE:
 		ret = sys_pause(p)
 	case defs.SYS_GETPID:
@@ -194,11 +272,16 @@ func (s *syscall_t) Syscall(p *proc.Proc_t, tid defs.Tid_t, tf *[defs.TFSIZE]uin
 		ret = sys_setsockopt(p, a1, a2, a3, a4, a5)
 	case defs.SYS_FORK:
 		ret = sys_fork(p, tf, a1, a2)
+	case defs.SYS_CLONE:
+		ret = sys_clone(p, tf, a1, a2, a3, a4, a5)
+	case defs.SYS_SPAWN:
+		ret = sys_spawn(p, a1, a2, a3, a4, a5)
 	case defs.SYS_EXECV:
-		ret = sys_execv(p, tf, a1, a2)
+		ret = sys_execv(p, tf, a1, a2, a3)
 	case defs.SYS_EXIT:
 		status := a1 & 0xff
 		status |= defs.EXITED
+		_cleartid(p)
 		s.Sys_exit(p, tid, status)
 	case defs.SYS_WAIT4:
 		ret = sys_wait4(p, tid, a1, a2, a3, a4, a5)
@@ -206,6 +289,8 @@ func (s *syscall_t) Syscall(p *proc.Proc_t, tid defs.Tid_t, tf *[defs.TFSIZE]uin
 		ret = sys_kill(p, a1, a2)
 	case defs.SYS_FCNTL:
 		ret = sys_fcntl(p, a1, a2, a3)
+	case defs.SYS_FLOCK:
+		ret = sys_flock(p, a1, a2)
 	case defs.SYS_TRUNC:
 		ret = sys_truncate(p, a1, uint(a2))
 	case defs.SYS_FTRUNC:
@@ -234,12 +319,44 @@ func (s *syscall_t) Syscall(p *proc.Proc_t, tid defs.Tid_t, tf *[defs.TFSIZE]uin
 		ret = sys_setrlimit(p, a1, a2)
 	case defs.SYS_SYNC:
 		ret = sys_sync(p)
+	case defs.SYS_SWAPON:
+		ret = sys_swapon(p, a1, a2, a3)
+	case defs.SYS_SWAPOFF:
+		ret = sys_swapoff(p, a1)
 	case defs.SYS_REBOOT:
 		ret = sys_reboot(p)
 	case defs.SYS_NANOSLEEP:
 		ret = sys_nanosleep(p, a1, a2)
+	case defs.SYS_EPOLLWAIT:
+		ret = sys_epoll_wait(p, a1, a2, a3, a4)
+	case defs.SYS_EPOLLCTL:
+		ret = sys_epoll_ctl(p, a1, a2, a3, a4)
+	case defs.SYS_EPOLLCREATE:
+		ret = sys_epoll_create1(p, a1)
+	case defs.SYS_SENDFILE:
+		ret = sys_sendfile(p, a1, a2, a3, a4)
+	case defs.SYS_SPLICE:
+		ret = sys_splice(p, a1, a2, a3, a4, a5)
+	case defs.SYS_INOTIFYINIT:
+		ret = sys_inotify_init1(p, a1)
+	case defs.SYS_INOTIFYADD:
+		ret = sys_inotify_add_watch(p, a1, a2, a3)
+	case defs.SYS_INOTIFYRM:
+		ret = sys_inotify_rm_watch(p, a1, a2)
+	case defs.SYS_TFDCREATE:
+		ret = sys_timerfd_create(p, a1, a2)
+	case defs.SYS_TFDSETTIME:
+		ret = sys_timerfd_settime(p, a1, a2, a3, a4)
+	case defs.SYS_TFDGETTIME:
+		ret = sys_timerfd_gettime(p, a1, a2)
+	case defs.SYS_SIGNALFD:
+		ret = sys_signalfd4(p, a1, a2, a3, a4)
+	case defs.SYS_EVENTFD:
+		ret = sys_eventfd2(p, a1, a2)
 	case defs.SYS_PIPE2:
 		ret = sys_pipe2(p, a1, a2)
+	case defs.SYS_USERFAULTFD:
+		ret = sys_userfaultfd(p, a1)
 	case defs.SYS_PROF:
 		ret = sys_prof(p, a1, a2, a3, a4)
 	case defs.SYS_INFO:
@@ -254,6 +371,60 @@ func (s *syscall_t) Syscall(p *proc.Proc_t, tid defs.Tid_t, tf *[defs.TFSIZE]uin
 		ret = sys_futex(p, a1, a2, a3, a4, a5)
 	case defs.SYS_GETTID:
 		ret = sys_gettid(p, tid)
+	case defs.SYS_PERSONALITY:
+		ret = sys_personality(p, a1)
+	case defs.SYS_GETPRIO:
+		ret = sys_getpriority(p, a1, a2)
+	case defs.SYS_SETPRIO:
+		ret = sys_setpriority(p, a1, a2, a3)
+	case defs.SYS_SCHGETPARAM:
+		ret = sys_sched_getparam(p, a1, a2)
+	case defs.SYS_SCHSETSCHED:
+		ret = sys_sched_setscheduler(p, a1, a2, a3)
+	case defs.SYS_SCHGETSCHED:
+		ret = sys_sched_getscheduler(p, a1)
+	case defs.SYS_SCHSETAFF:
+		ret = sys_sched_setaffinity(p, a1, a2, a3)
+	case defs.SYS_SCHGETAFF:
+		ret = sys_sched_getaffinity(p, a1, a2, a3)
+	case defs.SYS_MLOCK:
+		ret = sys_mlock(p, a1, a2)
+	case defs.SYS_MUNLOCK:
+		ret = sys_munlock(p, a1, a2)
+	case defs.SYS_MLOCKALL:
+		ret = sys_mlockall(p, a1)
+	case defs.SYS_MUNLOCKALL:
+		ret = sys_munlockall(p)
+	case defs.SYS_CGROUP:
+		ret = sys_cgroup(p, a1, a2, a3, a4)
+	case defs.SYS_OOMADJ:
+		ret = sys_oomadj(p, a1, a2, a3)
+	case defs.SYS_SHMOPEN:
+		ret = sys_shm_open(p, a1, a2)
+	case defs.SYS_SHMUNLINK:
+		ret = sys_shm_unlink(p, a1)
+	case defs.SYS_SHMGET:
+		ret = sys_shmget(p, a1, a2, a3)
+	case defs.SYS_SHMAT:
+		ret = sys_shmat(p, a1, a2, a3)
+	case defs.SYS_SHMDT:
+		ret = sys_shmdt(p, a1)
+	case defs.SYS_SHMCTL:
+		ret = sys_shmctl(p, a1, a2, a3)
+	case defs.SYS_SEMGET:
+		ret = sys_semget(p, a1, a2, a3)
+	case defs.SYS_SEMOP:
+		ret = sys_semop(p, a1, a2, a3)
+	case defs.SYS_SEMCTL:
+		ret = sys_semctl(p, a1, a2, a3, a4)
+	case defs.SYS_MSGGET:
+		ret = sys_msgget(p, a1, a2)
+	case defs.SYS_MSGSND:
+		ret = sys_msgsnd(p, a1, a2, a3, a4)
+	case defs.SYS_MSGRCV:
+		ret = sys_msgrcv(p, a1, a2, a3, a4, a5)
+	case defs.SYS_MSGCTL:
+		ret = sys_msgctl(p, a1, a2, a3)
 	default:
 		fmt.Printf("unexpected syscall %v\n", sysno)
 		s.Sys_exit(p, tid, defs.SIGNALED|defs.Mkexitsig(31))
@@ -364,13 +535,30 @@ func sys_open(p *proc.Proc_t, pathn int, _flags int, mode int) int {
 	if err != 0 {
 		return int(err)
 	}
+	file, fdperms, err := _open(p, path, _flags, mode)
+	if err != 0 {
+		return int(err)
+	}
+	fdn, ok := p.Fd_insert(file, fdperms)
+	if !ok {
+		lhits++
+		fd.Close_panic(file)
+		return int(-defs.EMFILE)
+	}
+	return fdn
+}
+
+// opens path relative to the working directory of p. returns the file and
+// its fd permissions.
+func _open(p *proc.Proc_t, path ustr.Ustr, _flags int, mode int) (*fd.Fd_t,
+	int, defs.Err_t) {
 	flags := defs.Fdopt_t(_flags)
 	temp := flags & (defs.O_RDONLY | defs.O_WRONLY | defs.O_RDWR)
 	if temp != defs.O_RDONLY && temp != defs.O_WRONLY && temp != defs.O_RDWR {
-		return int(-defs.EINVAL)
+		return nil, 0, -defs.EINVAL
 	}
 	if temp == defs.O_RDONLY && flags&defs.O_TRUNC != 0 {
-		return int(-defs.EINVAL)
+		return nil, 0, -defs.EINVAL
 	}
 	fdperms := 0
 	switch temp {
@@ -383,24 +571,17 @@ func sys_open(p *proc.Proc_t, pathn int, _flags int, mode int) int {
 	default:
 		fdperms = fd.FD_READ
 	}
-	err = badpath(path)
-	if err != 0 {
-		return int(err)
+	if err := badpath(path); err != 0 {
+		return nil, 0, err
 	}
 	file, err := thefs.Fs_open(path, flags, mode, p.Cwd, 0, 0)
 	if err != 0 {
-		return int(err)
+		return nil, 0, err
 	}
 	if flags&defs.O_CLOEXEC != 0 {
 		fdperms |= fd.FD_CLOEXEC
 	}
-	fdn, ok := p.Fd_insert(file, fdperms)
-	if !ok {
-		lhits++
-		fd.Close_panic(file)
-		return int(-defs.EMFILE)
-	}
-	return fdn
+	return file, fdperms, 0
 }
 
 func sys_pause(p *proc.Proc_t) int {
@@ -418,7 +599,7 @@ func (s *syscall_t) Sys_close(p *proc.Proc_t, fdn int) int {
 	if !ok {
 		return int(-defs.EBADF)
 	}
-	ret := fd.Fops.Close()
+	ret := p.Fd_close(fd)
 	return int(ret)
 }
 
@@ -439,22 +620,19 @@ func sys_mmap(p *proc.Proc_t, addrn, lenn, protflags, fdn, offset int) int {
 	if (fdmap && fdn < 0) || (fdmap && offset < 0) || (anon && fdn >= 0) {
 		return int(-defs.EINVAL)
 	}
-	if flags&defs.MAP_FIXED != 0 {
-		return int(-defs.EINVAL)
+	// MAP_FIXED replaces any mappings in the way while
+	// MAP_FIXED_NOREPLACE fails instead
+	fixed := flags&defs.MAP_FIXED != 0
+	noreplace := flags&defs.MAP_FIXED_NOREPLACE != 0
+	if fixed || noreplace {
+		if addrn&int(vm.PGOFFSET) != 0 || addrn < mem.USERMIN ||
+			lenn < 0 || lenn > mem.USERMAX || addrn+lenn > mem.USERMAX {
+			return int(-defs.EINVAL)
+		}
 	}
-	// OpenBSD allows mappings of only PROT_WRITE and read accesses that
-	// fault-in the page cause a segfault while writes do not. Reads
-	// following a write do not cause segfault (of course). POSIX
-	// apparently requires an implementation to support only proc.PROT_WRITE,
-	// but it seems better to disallow permission schemes that the CPU
-	// cannot enforce.
-	if prot&defs.PROT_READ == 0 {
+	if !protok(prot) {
 		return int(-defs.EINVAL)
 	}
-	if prot == defs.PROT_NONE {
-		panic("no imp")
-		return p.Mmapi
-	}
 
 	var f *fd.Fd_t
 	if fdmap {
@@ -472,10 +650,7 @@ func sys_mmap(p *proc.Proc_t, addrn, lenn, protflags, fdn, offset int) int {
 
 	p.Vm.Lock_pmap()
 
-	perms := vm.PTE_U
-	if prot&defs.PROT_WRITE != 0 {
-		perms |= vm.PTE_W
-	}
+	perms := prot2perms(prot)
 	lenn = util.Roundup(lenn, mem.PGSIZE)
 	// limit checks
 	if lenn/int(mem.PGSIZE)+p.Vm.Vmregion.Pglen() > p.Ulim.Pages {
@@ -489,8 +664,36 @@ func sys_mmap(p *proc.Proc_t, addrn, lenn, protflags, fdn, offset int) int {
 		return int(-defs.ENOMEM)
 	}
 
-	addr := p.Vm.Unusedva_inner(p.Mmapi, lenn)
-	p.Mmapi = addr + lenn
+	var addr int
+	if fixed || noreplace {
+		if p.Vm.Vmregion.Overlaps(addrn, lenn) {
+			if noreplace {
+				p.Vm.Unlock_pmap()
+				return int(-defs.EEXIST)
+			}
+			// the new mapping needs a vm object too
+			split := p.Vm.Vmregion.Unmapsplits(addrn, lenn)
+			if p.Vm.Vmregion.Novma+split >= p.Ulim.Novma {
+				p.Vm.Unlock_pmap()
+				lhits++
+				return int(-defs.ENOMEM)
+			}
+			// splitting a huge page may run out of memory
+			if err := p.Vm.Unmap(addrn, lenn, p.Ulim.Novma); err != 0 {
+				p.Vm.Unlock_pmap()
+				return int(err)
+			}
+		}
+		addr = addrn
+	} else if anon && !shared && lenn >= mem.HUGESIZE {
+		// align large anonymous mappings so that huge pages map them
+		addr = p.Vm.Unusedva_inner(p.Mmapi, lenn+mem.HUGESIZE)
+		addr = util.Roundup(addr, mem.HUGESIZE)
+		p.Mmapi = addr + lenn
+	} else {
+		addr = p.Vm.Unusedva_inner(p.Mmapi, lenn)
+		p.Mmapi = addr + lenn
+	}
 	switch {
 	case anon && shared:
 		p.Vm.Vmadd_shareanon(addr, lenn, perms)
@@ -500,84 +703,329 @@ func sys_mmap(p *proc.Proc_t, addrn, lenn, protflags, fdn, offset int) int {
 		fops := f.Fops
 		// vmadd_*file will increase the open count on the file
 		if shared {
+			rdonly := f.Perms&fd.FD_WRITE == 0
+			// shared memory objects cache their own pages
+			pcache := vm.Pagecache_i(thefs)
+			if pc, ok := fops.(vm.Pagecache_i); ok {
+				pcache = pc
+			}
 			p.Vm.Vmadd_sharefile(addr, lenn, perms, fops, offset,
-				thefs)
+				pcache, rdonly)
 		} else {
 			p.Vm.Vmadd_file(addr, lenn, perms, fops, offset)
 		}
 	}
-	tshoot := false
 	// eagerly map anonymous pages, lazily-map file pages. our vm system
-	// supports lazily-mapped private anonymous pages though.
-	var ub int
-	failed := false
-	if anon {
-		for i := 0; i < lenn; i += int(mem.PGSIZE) {
-			_, p_pg, ok := physmem.Refpg_new()
-			if !ok {
-				failed = true
-				break
-			}
-			ns, ok := p.Vm.Page_insert(addr+i, p_pg, perms, true, nil)
-			if !ok {
-				physmem.Refdown(p_pg)
-				failed = true
-				break
+	// supports lazily-mapped private anonymous pages though, which is
+	// important for PROT_NONE reservations of address space. shared
+	// anonymous pages must always be mapped, even if inaccessible.
+	ret := addr
+	if anon && (perms != 0 || shared) {
+		pteperms := perms
+		if perms == 0 {
+			pteperms = vm.PTE_PROTNONE
+		}
+		if p.Vm.Populate(addr, lenn, pteperms) != 0 {
+			// removing this region cannot create any more vm
+			// objects than what this call to sys_mmap started
+			// with.
+			if p.Vm.Vmregion.Remove(addr, lenn, p.Ulim.Novma) != 0 {
+				panic("wut")
 			}
-			ub = i
-			tshoot = tshoot || ns
+			ret = int(-defs.ENOMEM)
 		}
 	}
-	ret := addr
-	if failed {
-		for i := 0; i < ub; i += mem.PGSIZE {
-			p.Vm.Page_remove(addr + i)
-		}
-		// removing this region cannot create any more vm objects than
-		// what this call to sys_mmap started with.
-		if p.Vm.Vmregion.Remove(addr, lenn, p.Ulim.Novma) != 0 {
-			panic("wut")
+	// mlockall(MCL_FUTURE)
+	if ret == addr && p.Vm.Lockfuture {
+		err := p.Vm.Mlock(addr, lenn, _memlockpgs(p), p.Ulim.Novma)
+		if err != 0 {
+			if p.Vm.Unmap(addr, lenn, p.Ulim.Novma) != 0 {
+				panic("wut")
+			}
+			lhits++
+			ret = int(err)
 		}
-		ret = int(-defs.ENOMEM)
-	}
-	// sys_mmap won't replace pages since it always finds unused VA space,
-	// so the following TLB shootdown is never used.
-	if tshoot {
-		p.Vm.Tlbshoot(0, 1)
 	}
 	p.Vm.Unlock_pmap()
 	return ret
 }
 
 func sys_munmap(p *proc.Proc_t, addrn, len int) int {
-	if addrn&int(vm.PGOFFSET) != 0 || addrn < mem.USERMIN {
+	if addrn&int(vm.PGOFFSET) != 0 || addrn < mem.USERMIN || len <= 0 {
 		return int(-defs.EINVAL)
 	}
 	p.Vm.Lock_pmap()
 	defer p.Vm.Unlock_pmap()
 
-	vmi1, ok1 := p.Vm.Vmregion.Lookup(uintptr(addrn))
-	vmi2, ok2 := p.Vm.Vmregion.Lookup(uintptr(addrn+len) - 1)
-	if !ok1 || !ok2 || vmi1.Pgn != vmi2.Pgn {
+	// the range may span several mappings (like a thread stack and its
+	// guard page), but all of it must be mapped.
+	len = util.Roundup(len, mem.PGSIZE)
+	if !p.Vm.Vmregion.Mapped(addrn, len) {
+		return int(-defs.EINVAL)
+	}
+	if err := p.Vm.Unmap(addrn, len, p.Ulim.Novma); err != 0 {
+		lhits++
+		return int(err)
+	}
+	return 0
+}
+
+func sys_mremap(p *proc.Proc_t, oldn, oldlen, newlen, flags int) int {
+	if oldn&int(vm.PGOFFSET) != 0 || oldn < mem.USERMIN || oldlen <= 0 ||
+		newlen <= 0 || newlen > mem.USERMAX-mem.USERMIN {
+		return int(-defs.EINVAL)
+	}
+	if flags&^defs.MREMAP_MAYMOVE != 0 {
 		return int(-defs.EINVAL)
 	}
+	maymove := flags&defs.MREMAP_MAYMOVE != 0
+
+	p.Vm.Lock_pmap()
+	defer p.Vm.Unlock_pmap()
 
-	err := p.Vm.Vmregion.Remove(addrn, len, p.Ulim.Novma)
+	newlen = util.Roundup(newlen, mem.PGSIZE)
+	oldlen = util.Roundup(oldlen, mem.PGSIZE)
+	if newlen > oldlen &&
+		(newlen-oldlen)/mem.PGSIZE+p.Vm.Vmregion.Pglen() > p.Ulim.Pages {
+		lhits++
+		return int(-defs.ENOMEM)
+	}
+	ret, err := p.Vm.Mremap(oldn, oldlen, newlen, maymove, p.Mmapi,
+		p.Ulim.Novma)
+	if err == -defs.ENOMEM {
+		lhits++
+	}
 	if err != 0 {
+		return int(err)
+	}
+	if ret != oldn {
+		p.Mmapi = ret + newlen
+	}
+	return ret
+}
+
+// OpenBSD allows mappings of only PROT_WRITE and read accesses that fault-in
+// the page cause a segfault while writes do not. Reads following a write do
+// not cause segfault (of course). POSIX apparently requires an implementation
+// to support only proc.PROT_WRITE, but it seems better to disallow permission
+// schemes that the CPU cannot enforce. PROT_NONE is enforced by leaving the
+// pages inaccessible.
+func protok(prot uint) bool {
+	return prot == defs.PROT_NONE || prot&defs.PROT_READ != 0
+}
+
+// converts PROT_* flags into the permissions of a vm mapping
+func prot2perms(prot uint) mem.Pa_t {
+	if prot == defs.PROT_NONE {
+		return 0
+	}
+	perms := vm.PTE_U
+	if prot&defs.PROT_WRITE != 0 {
+		perms |= vm.PTE_W
+	}
+	return perms
+}
+
+func sys_mprotect(p *proc.Proc_t, addrn, len, prot int) int {
+	if addrn&int(vm.PGOFFSET) != 0 || addrn < mem.USERMIN || len <= 0 {
+		return int(-defs.EINVAL)
+	}
+	uprot := uint(prot)
+	if uprot&^(defs.PROT_READ|defs.PROT_WRITE|defs.PROT_EXEC) != 0 ||
+		!protok(uprot) {
+		return int(-defs.EINVAL)
+	}
+	len = util.Roundup(len, mem.PGSIZE)
+	if addrn+len < addrn {
+		return int(-defs.EINVAL)
+	}
+
+	p.Vm.Lock_pmap()
+	defer p.Vm.Unlock_pmap()
+
+	if !p.Vm.Vmregion.Mapped(addrn, len) {
+		return int(-defs.ENOMEM)
+	}
+	err := p.Vm.Mprotect(addrn, len, prot2perms(uprot), p.Ulim.Novma)
+	if err == -defs.ENOMEM {
 		lhits++
+	}
+	if err != 0 {
 		return int(err)
 	}
-	// addrn must be page-aligned
+	return 0
+}
+
+func sys_msync(p *proc.Proc_t, addrn, len, flags int) int {
+	if addrn&int(vm.PGOFFSET) != 0 || addrn < mem.USERMIN || len < 0 {
+		return int(-defs.EINVAL)
+	}
+	allf := defs.MS_ASYNC | defs.MS_INVALIDATE | defs.MS_SYNC
+	if flags&^allf != 0 ||
+		flags&(defs.MS_ASYNC|defs.MS_SYNC) == defs.MS_ASYNC|defs.MS_SYNC {
+		return int(-defs.EINVAL)
+	}
+	if len == 0 {
+		return 0
+	}
 	len = util.Roundup(len, mem.PGSIZE)
-	for i := 0; i < len; i += mem.PGSIZE {
-		a := addrn + i
-		if a < mem.USERMIN {
-			panic("how")
-		}
-		p.Vm.Page_remove(a)
+	if addrn+len < addrn {
+		return int(-defs.EINVAL)
+	}
+
+	p.Vm.Lock_pmap()
+	if !p.Vm.Vmregion.Mapped(addrn, len) {
+		p.Vm.Unlock_pmap()
+		return int(-defs.ENOMEM)
+	}
+	// shared file mappings map the block cache's pages, thus the other
+	// mappings of the file always observe the synced data and
+	// MS_INVALIDATE has nothing to do.
+	err := p.Vm.Msync(addrn, len, flags&defs.MS_SYNC != 0)
+	p.Vm.Unlock_pmap()
+	return int(err)
+}
+
+func sys_madvise(p *proc.Proc_t, addrn, len, advice int) int {
+	if addrn&int(vm.PGOFFSET) != 0 || addrn < mem.USERMIN || len < 0 {
+		return int(-defs.EINVAL)
+	}
+	switch advice {
+	case defs.MADV_NORMAL, defs.MADV_RANDOM, defs.MADV_SEQUENTIAL,
+		defs.MADV_WILLNEED, defs.MADV_DONTNEED, defs.MADV_HUGEPAGE,
+		defs.MADV_NOHUGEPAGE, defs.MADV_MERGEABLE, defs.MADV_UNMERGEABLE:
+	default:
+		return int(-defs.EINVAL)
+	}
+	if len == 0 {
+		return 0
+	}
+	len = util.Roundup(len, mem.PGSIZE)
+	if addrn+len < addrn {
+		return int(-defs.EINVAL)
+	}
+
+	p.Vm.Lock_pmap()
+	defer p.Vm.Unlock_pmap()
+
+	if !p.Vm.Vmregion.Mapped(addrn, len) {
+		return int(-defs.ENOMEM)
+	}
+	var err defs.Err_t
+	switch advice {
+	case defs.MADV_NORMAL:
+		err = p.Vm.Madvise_ra(addrn, len, vm.RA_NORMAL, p.Ulim.Novma)
+	case defs.MADV_RANDOM:
+		err = p.Vm.Madvise_ra(addrn, len, vm.RA_RANDOM, p.Ulim.Novma)
+	case defs.MADV_SEQUENTIAL:
+		err = p.Vm.Madvise_ra(addrn, len, vm.RA_SEQ, p.Ulim.Novma)
+	case defs.MADV_WILLNEED:
+		p.Vm.Madvise_willneed(addrn, len)
+	case defs.MADV_DONTNEED:
+		err = p.Vm.Madvise_dontneed(addrn, len)
+	case defs.MADV_HUGEPAGE, defs.MADV_NOHUGEPAGE:
+		huge := advice == defs.MADV_HUGEPAGE
+		err = p.Vm.Madvise_huge(addrn, len, huge, p.Ulim.Novma)
+	case defs.MADV_MERGEABLE, defs.MADV_UNMERGEABLE:
+		merge := advice == defs.MADV_MERGEABLE
+		err = p.Vm.Madvise_merge(addrn, len, merge, p.Ulim.Novma)
+	}
+	if err == -defs.ENOMEM {
+		lhits++
+	}
+	if err != 0 {
+		return int(err)
+	}
+	return 0
+}
+
+// returns the number of pages p may lock
+func _memlockpgs(p *proc.Proc_t) int {
+	if p.Ulim.Memlock == defs.RLIM_INFINITY {
+		return int(^uint(0) >> 1)
+	}
+	return int(p.Ulim.Memlock >> mem.PGSHIFT)
+}
+
+// returns the page-aligned range which covers [addrn, addrn+len), or EINVAL
+// if it wraps around
+func _mlockrange(addrn, len int) (int, int, defs.Err_t) {
+	if len < 0 {
+		return 0, 0, -defs.EINVAL
+	}
+	start := util.Rounddown(addrn, mem.PGSIZE)
+	end := util.Roundup(addrn+len, mem.PGSIZE)
+	if end < start {
+		return 0, 0, -defs.EINVAL
+	}
+	return start, end - start, 0
+}
+
+func sys_mlock(p *proc.Proc_t, addrn, len int) int {
+	start, len, err := _mlockrange(addrn, len)
+	if err != 0 {
+		return int(err)
+	}
+	if len == 0 {
+		return 0
+	}
+
+	p.Vm.Lock_pmap()
+	defer p.Vm.Unlock_pmap()
+
+	if start < mem.USERMIN || !p.Vm.Vmregion.Mapped(start, len) {
+		return int(-defs.ENOMEM)
+	}
+	err = p.Vm.Mlock(start, len, _memlockpgs(p), p.Ulim.Novma)
+	if err == -defs.ENOMEM {
+		lhits++
+	}
+	return int(err)
+}
+
+func sys_munlock(p *proc.Proc_t, addrn, len int) int {
+	start, len, err := _mlockrange(addrn, len)
+	if err != 0 {
+		return int(err)
+	}
+	if len == 0 {
+		return 0
+	}
+
+	p.Vm.Lock_pmap()
+	defer p.Vm.Unlock_pmap()
+
+	if start < mem.USERMIN || !p.Vm.Vmregion.Mapped(start, len) {
+		return int(-defs.ENOMEM)
+	}
+	err = p.Vm.Munlock(start, len, p.Ulim.Novma)
+	if err == -defs.ENOMEM {
+		lhits++
+	}
+	return int(err)
+}
+
+func sys_mlockall(p *proc.Proc_t, flags int) int {
+	if flags == 0 || flags&^(defs.MCL_CURRENT|defs.MCL_FUTURE) != 0 {
+		return int(-defs.EINVAL)
 	}
-	pgs := len >> vm.PGSHIFT
-	p.Vm.Tlbshoot(uintptr(addrn), pgs)
+	current := flags&defs.MCL_CURRENT != 0
+	future := flags&defs.MCL_FUTURE != 0
+
+	p.Vm.Lock_pmap()
+	defer p.Vm.Unlock_pmap()
+
+	err := p.Vm.Mlockall(current, future, _memlockpgs(p))
+	if err == -defs.ENOMEM {
+		lhits++
+	}
+	return int(err)
+}
+
+func sys_munlockall(p *proc.Proc_t) int {
+	p.Vm.Lock_pmap()
+	p.Vm.Munlockall()
+	p.Vm.Unlock_pmap()
 	return 0
 }
 
@@ -588,7 +1036,7 @@ func sys_readv(p *proc.Proc_t, fdn, _iovn, iovcnt int) int {
 	}
 	iovn := uint(_iovn)
 	iov := &vm.Useriovec_t{}
-	if err := iov.Iov_init(&p.Vm, iovn, iovcnt); err != 0 {
+	if err := iov.Iov_init(p.Vm, iovn, iovcnt); err != 0 {
 		return int(err)
 	}
 	ret, err := fd.Fops.Read(iov)
@@ -605,7 +1053,7 @@ func sys_writev(p *proc.Proc_t, fdn, _iovn, iovcnt int) int {
 	}
 	iovn := uint(_iovn)
 	iov := &vm.Useriovec_t{}
-	if err := iov.Iov_init(&p.Vm, iovn, iovcnt); err != 0 {
+	if err := iov.Iov_init(p.Vm, iovn, iovcnt); err != 0 {
 		return int(err)
 	}
 	ret, err := fd.Fops.Write(iov)
@@ -645,20 +1093,62 @@ func sys_access(p *proc.Proc_t, pathn, mode int) int {
 	return ret
 }
 
+func sys_dup(p *proc.Proc_t, oldn int) int {
+	nfdn, err := p.Fd_dupmin(oldn, 0, false)
+	if err != 0 {
+		return int(err)
+	}
+	return nfdn
+}
+
 func sys_dup2(p *proc.Proc_t, oldn, newn int) int {
 	if oldn == newn {
+		if _, ok := p.Fd_get(oldn); !ok {
+			return int(-defs.EBADF)
+		}
 		return newn
 	}
-	ofd, needclose, err := p.Fd_dup(oldn, newn)
+	return _dup3(p, oldn, newn, false)
+}
+
+func sys_dup3(p *proc.Proc_t, oldn, newn, flags int) int {
+	fl := defs.Fdopt_t(flags)
+	if oldn == newn || fl&^defs.O_CLOEXEC != 0 {
+		return int(-defs.EINVAL)
+	}
+	return _dup3(p, oldn, newn, fl&defs.O_CLOEXEC != 0)
+}
+
+func _dup3(p *proc.Proc_t, oldn, newn int, cloexec bool) int {
+	ofd, needclose, err := p.Fd_dup(oldn, newn, cloexec)
 	if err != 0 {
 		return int(err)
 	}
 	if needclose {
-		fd.Close_panic(ofd)
+		if p.Fd_close(ofd) != 0 {
+			panic("must succeed")
+		}
 	}
 	return newn
 }
 
+func sys_close_range(p *proc.Proc_t, first, last, flags int) int {
+	// the fd table is shared by all threads of a process and cannot be
+	// unshared
+	first, last = int(uint32(first)), int(uint32(last))
+	if flags&^defs.CLOSE_RANGE_CLOEXEC != 0 || first > last {
+		return int(-defs.EINVAL)
+	}
+	if flags&defs.CLOSE_RANGE_CLOEXEC != 0 {
+		p.Fd_cloexecrange(first, last)
+		return 0
+	}
+	for _, f := range p.Fd_delrange(first, last) {
+		p.Fd_close(f)
+	}
+	return 0
+}
+
 func sys_stat(p *proc.Proc_t, pathn, statn int) int {
 	path, err := p.Vm.Userstr(pathn, fs.NAME_MAX)
 	if err != 0 {
@@ -727,7 +1217,7 @@ func _checkfds(p *proc.Proc_t, tid defs.Tid_t, pm *fdops.Pollmsg_t, wait bool, b
 		}
 		fd, ok := p.Fd_get_inner(fdn)
 		if !ok {
-			uw |= defs.POLLNVAL
+			uw |= defs.POLLNVAL << 48
 			writen(buf, 8, off, uw)
 			writeback = true
 			continue
@@ -767,6 +1257,13 @@ func _checkfds(p *proc.Proc_t, tid defs.Tid_t, pm *fdops.Pollmsg_t, wait bool, b
 }
 
 func sys_poll(p *proc.Proc_t, tid defs.Tid_t, fdsn, nfds, timeout int) int {
+	return _poll(p, tid, fdsn, nfds, timeout, false)
+}
+
+// polls the struct pollfds at fdsn, whose event bits are Linux's if linux is
+// true
+func _poll(p *proc.Proc_t, tid defs.Tid_t, fdsn, nfds, timeout int,
+	linux bool) int {
 	if nfds < 0 || timeout < -1 {
 		return int(-defs.EINVAL)
 	}
@@ -787,6 +1284,11 @@ func sys_poll(p *proc.Proc_t, tid defs.Tid_t, fdsn, nfds, timeout int) int {
 	if err := p.Vm.User2k(buf, fdsn); err != 0 {
 		return int(err)
 	}
+	var lbuf []uint8
+	if linux {
+		lbuf = buf
+		buf = linux_pollin(lbuf)
+	}
 
 	// first we tell the underlying device to notify us if their fd is
 	// ready. if a device is immediately ready, we don't bother to register
@@ -806,7 +1308,11 @@ func sys_poll(p *proc.Proc_t, tid defs.Tid_t, fdsn, nfds, timeout int) int {
 			return int(err)
 		}
 		if writeback {
-			if err := p.Vm.K2user(buf, fdsn); err != 0 {
+			ubuf := buf
+			if linux {
+				ubuf = linux_pollout(lbuf, buf)
+			}
+			if err := p.Vm.K2user(ubuf, fdsn); err != 0 {
 				return int(err)
 			}
 		}
@@ -992,23 +1498,171 @@ func (o *pipe_t) op_read(dst fdops.Userio_i, noblock bool) (int, defs.Err_t) {
 	return ret, 0
 }
 
-func (o *pipe_t) op_poll(pm fdops.Pollmsg_t) (fdops.Ready_t, defs.Err_t) {
-	o.Lock()
-
-	if o.closed {
-		o.Unlock()
-		return 0, 0
-	}
+// returns a copy of at most n of the bytes in the pipe without consuming them.
+// o must be locked and not empty.
+func (o *pipe_t) _peek(n int) []uint8 {
+	s1, s2 := o.cbuf.Rawread(0)
+	ret := make([]uint8, util.Min(n, len(s1)+len(s2)))
+	c := copy(ret, s1)
+	copy(ret[c:], s2)
+	return ret
+}
 
-	var r fdops.Ready_t
-	readable := false
-	if !o.cbuf.Empty() || o.writers == 0 {
-		readable = true
-	}
-	writeable := false
-	if !o.cbuf.Full() || o.readers == 0 {
-		writeable = true
-	}
+// moves at most n bytes of the pipe to out, writing at offset off unless off
+// is -1. the pipe stays locked while writing to out so that the bytes which
+// out does not accept remain in the pipe.
+func (o *pipe_t) op_splice_out(out fdops.Fdops_i, off, n int,
+	noblock bool) (int, defs.Err_t) {
+	o.Lock()
+	defer o.Unlock()
+	for {
+		if o.closed {
+			return 0, -defs.EBADF
+		}
+		if o.writers == 0 || !o.cbuf.Empty() {
+			break
+		}
+		if noblock {
+			return 0, -defs.EWOULDBLOCK
+		}
+		if err := proc.KillableWait(o.rcond); err != 0 {
+			return 0, err
+		}
+	}
+	if o.cbuf.Empty() {
+		return 0, 0
+	}
+	ret, err := _kwrite(out, o._peek(n), off)
+	if ret == 0 {
+		return 0, err
+	}
+	o.cbuf.Advtail(ret)
+	o.wcond.Signal()
+	o.pollers.Wakeready(fdops.R_WRITE)
+	return ret, 0
+}
+
+// moves at most n bytes from in to the pipe, reading at offset off unless off
+// is -1. the pipe stays locked while reading from in so that the space for
+// the bytes remains free.
+func (o *pipe_t) op_splice_in(in fdops.Fdops_i, off, n int,
+	noblock bool) (int, defs.Err_t) {
+	o.Lock()
+	defer o.Unlock()
+	for {
+		if o.closed {
+			return 0, -defs.EBADF
+		}
+		if o.readers == 0 {
+			return 0, -defs.EPIPE
+		}
+		if !o.cbuf.Full() {
+			break
+		}
+		if noblock {
+			return 0, -defs.EWOULDBLOCK
+		}
+		if err := proc.KillableWait(o.wcond); err != 0 {
+			return 0, err
+		}
+	}
+	buf := make([]uint8, util.Min(n, o.cbuf.Left()))
+	ret, err := _kread(in, buf, off)
+	if ret == 0 {
+		return 0, err
+	}
+	if err := _pipecopyin(o, buf[:ret]); err != 0 {
+		return 0, err
+	}
+	return ret, 0
+}
+
+// appends buf, which must fit, to the pipe. o must be locked.
+func _pipecopyin(o *pipe_t, buf []uint8) defs.Err_t {
+	fb := &vm.Fakeubuf_t{}
+	fb.Fake_init(buf)
+	if _, err := o.cbuf.Copyin(fb); err != 0 {
+		return err
+	}
+	o.rcond.Signal()
+	o.pollers.Wakeready(fdops.R_READ)
+	return 0
+}
+
+// moves at most n bytes from pipe in to pipe out. the pipes are locked in the
+// order of their addresses, and neither is locked while waiting for the
+// other.
+func _pipe2pipe(in, out *pipe_t, n int, noblock bool) (int, defs.Err_t) {
+	first, second := in, out
+	if uintptr(unsafe.Pointer(out)) < uintptr(unsafe.Pointer(in)) {
+		first, second = out, in
+	}
+	for {
+		first.Lock()
+		second.Lock()
+		var ret int
+		var err defs.Err_t
+		var wait *pipe_t
+		switch {
+		case in.closed || out.closed:
+			err = -defs.EBADF
+		case out.readers == 0:
+			err = -defs.EPIPE
+		case in.cbuf.Empty():
+			if in.writers != 0 {
+				wait = in
+			}
+		case out.cbuf.Full():
+			wait = out
+		default:
+			buf := in._peek(util.Min(n, out.cbuf.Left()))
+			if err = _pipecopyin(out, buf); err == 0 {
+				ret = len(buf)
+				in.cbuf.Advtail(ret)
+				in.wcond.Signal()
+				in.pollers.Wakeready(fdops.R_WRITE)
+			}
+		}
+		second.Unlock()
+		first.Unlock()
+		if wait == nil {
+			return ret, err
+		}
+		if noblock {
+			return 0, -defs.EWOULDBLOCK
+		}
+		// wait for data or space, after checking again with only the
+		// pipe which is waited on locked
+		wait.Lock()
+		if wait == in && in.cbuf.Empty() && in.writers != 0 && !in.closed {
+			err = proc.KillableWait(in.rcond)
+		} else if wait == out && out.cbuf.Full() && !out.closed {
+			err = proc.KillableWait(out.wcond)
+		}
+		wait.Unlock()
+		if err != 0 {
+			return 0, err
+		}
+	}
+}
+
+func (o *pipe_t) op_poll(pm fdops.Pollmsg_t) (fdops.Ready_t, defs.Err_t) {
+	o.Lock()
+
+	if o.closed {
+		o.Unlock()
+		return 0, 0
+	}
+
+	var r fdops.Ready_t
+	readable := false
+	if !o.cbuf.Empty() || o.writers == 0 {
+		readable = true
+	}
+	writeable := false
+	if !o.cbuf.Full() || o.readers == 0 {
+		writeable = true
+	}
 	if pm.Events&fdops.R_READ != 0 && readable {
 		r |= fdops.R_READ
 	}
@@ -1213,2717 +1867,4922 @@ func (of *pipefops_t) Shutdown(read, write bool) defs.Err_t {
 	return -defs.ENOTCONN
 }
 
-func sys_rename(p *proc.Proc_t, oldn int, newn int) int {
-	old, err1 := p.Vm.Userstr(oldn, fs.NAME_MAX)
-	new, err2 := p.Vm.Userstr(newn, fs.NAME_MAX)
-	if err1 != 0 {
-		return int(err1)
-	}
-	if err2 != 0 {
-		return int(err2)
+func sys_userfaultfd(p *proc.Proc_t, _flags int) int {
+	flags := defs.Fdopt_t(_flags)
+	if flags&^(defs.O_NONBLOCK|defs.O_CLOEXEC) != 0 {
+		return int(-defs.EINVAL)
 	}
-	err1 = badpath(old)
-	err2 = badpath(new)
-	if err1 != 0 {
-		return int(err1)
+	perms := fd.FD_READ
+	if flags&defs.O_CLOEXEC != 0 {
+		perms |= fd.FD_CLOEXEC
 	}
-	if err2 != 0 {
-		return int(err2)
+	uf := &uffdfops_t{uffd: vm.Mkuffd(p.Vm), refs: 1,
+		options: flags & defs.O_NONBLOCK}
+	fdn, ok := p.Fd_insert(&fd.Fd_t{Fops: uf}, perms)
+	if !ok {
+		lhits++
+		return int(-defs.EMFILE)
 	}
-	err := thefs.Fs_rename(old, new, p.Cwd)
-	return int(err)
+	return fdn
 }
 
-func sys_mkdir(p *proc.Proc_t, pathn int, mode int) int {
-	path, err := p.Vm.Userstr(pathn, fs.NAME_MAX)
-	if err != 0 {
-		return int(err)
+// only userfaultfds support ioctl(2)
+func sys_ioctl(p *proc.Proc_t, fdn, req, argp int) int {
+	f, ok := p.Fd_get(fdn)
+	if !ok {
+		return int(-defs.EBADF)
 	}
-	err = badpath(path)
-	if err != 0 {
-		return int(err)
+	uf, ok := f.Fops.(*uffdfops_t)
+	if !ok {
+		return int(-defs.ENOTTY)
 	}
-	err = thefs.Fs_mkdir(path, mode, p.Cwd)
-	return int(err)
+	return int(uf.ioctl(p, req, argp))
 }
 
-func sys_link(p *proc.Proc_t, oldn int, newn int) int {
-	old, err1 := p.Vm.Userstr(oldn, fs.NAME_MAX)
-	new, err2 := p.Vm.Userstr(newn, fs.NAME_MAX)
-	if err1 != 0 {
-		return int(err1)
-	}
-	if err2 != 0 {
-		return int(err2)
-	}
-	err1 = badpath(old)
-	err2 = badpath(new)
-	if err1 != 0 {
-		return int(err1)
-	}
-	if err2 != 0 {
-		return int(err2)
-	}
-	err := thefs.Fs_link(old, new, p.Cwd)
-	return int(err)
+type uffdfops_t struct {
+	sync.Mutex
+	uffd *vm.Uffd_t
+	// the number of file descriptors which refer to the userfaultfd
+	refs    int
+	options defs.Fdopt_t
 }
 
-func sys_unlink(p *proc.Proc_t, pathn, isdiri int) int {
-	path, err := p.Vm.Userstr(pathn, fs.NAME_MAX)
-	if err != 0 {
-		return int(err)
-	}
-	err = badpath(path)
-	if err != 0 {
-		return int(err)
+// the ioctls which a registered range supports
+const _uffd_rangeioctls = 1<<(defs.UFFDIO_WAKE&0xff) |
+	1<<(defs.UFFDIO_COPY&0xff) | 1<<(defs.UFFDIO_ZEROPAGE&0xff)
+
+// reads the n 8-byte fields of the structure at argp
+func _ioctlargs(p *proc.Proc_t, argp, n int) ([]int, defs.Err_t) {
+	ret := make([]int, n)
+	for i := range ret {
+		v, err := p.Vm.Userreadn(argp+8*i, 8)
+		if err != 0 {
+			return nil, err
+		}
+		ret[i] = v
 	}
-	wantdir := isdiri != 0
-	err = thefs.Fs_unlink(path, p.Cwd, wantdir)
-	return int(err)
+	return ret, 0
 }
 
-func sys_gettimeofday(p *proc.Proc_t, timevaln int) int {
-	tvalsz := 16
-	now := time.Now()
-	buf := make([]uint8, tvalsz)
-	us := int(now.UnixNano() / 1000)
-	writen(buf, 8, 0, us/1e6)
-	writen(buf, 8, 8, us%1e6)
-	if err := p.Vm.K2user(buf, timevaln); err != 0 {
-		return int(err)
+// returns EINVAL unless [start, start+len) is a non-empty, page-aligned range
+// of user addresses
+func _uffd_range(start, len int) defs.Err_t {
+	if start&int(vm.PGOFFSET) != 0 || len&int(vm.PGOFFSET) != 0 ||
+		len <= 0 || start < mem.USERMIN || start+len > mem.USERMAX {
+		return -defs.EINVAL
 	}
 	return 0
 }
 
-var _rlimits = map[int]uint{defs.RLIMIT_NOFILE: defs.RLIM_INFINITY}
+func (uf *uffdfops_t) ioctl(p *proc.Proc_t, req, argp int) defs.Err_t {
+	switch req {
+	case defs.UFFDIO_API:
+		args, err := _ioctlargs(p, argp, 1)
+		if err != 0 {
+			return err
+		}
+		if args[0] != defs.UFFD_API {
+			return -defs.EINVAL
+		}
+		// no optional features
+		if err := p.Vm.Userwriten(argp+8, 8, 0); err != 0 {
+			return err
+		}
+		ioctls := uint(1)<<(defs.UFFDIO_API&0xff) |
+			1<<(defs.UFFDIO_REGISTER&0xff) |
+			1<<(defs.UFFDIO_UNREGISTER&0xff)
+		return p.Vm.Userwriten(argp+16, 8, int(ioctls))
+	case defs.UFFDIO_REGISTER:
+		args, err := _ioctlargs(p, argp, 3)
+		if err != 0 {
+			return err
+		}
+		start, len, mode := args[0], args[1], args[2]
+		if err := _uffd_range(start, len); err != 0 {
+			return err
+		}
+		if mode != defs.UFFDIO_REGISTER_MODE_MISSING {
+			return -defs.EINVAL
+		}
+		p.Vm.Lock_pmap()
+		if !p.Vm.Vmregion.Mapped(start, len) {
+			err = -defs.EINVAL
+		} else {
+			err = p.Vm.Uffd_register(start, len, uf.uffd, p.Ulim.Novma)
+		}
+		p.Vm.Unlock_pmap()
+		if err != 0 {
+			if err == -defs.ENOMEM {
+				lhits++
+			}
+			return err
+		}
+		return p.Vm.Userwriten(argp+24, 8, _uffd_rangeioctls)
+	case defs.UFFDIO_UNREGISTER:
+		args, err := _ioctlargs(p, argp, 2)
+		if err != 0 {
+			return err
+		}
+		start, len := args[0], args[1]
+		if err := _uffd_range(start, len); err != 0 {
+			return err
+		}
+		p.Vm.Lock_pmap()
+		if !p.Vm.Vmregion.Mapped(start, len) {
+			err = -defs.EINVAL
+		} else {
+			err = p.Vm.Uffd_unregister(start, len, p.Ulim.Novma)
+		}
+		p.Vm.Unlock_pmap()
+		if err == -defs.ENOMEM {
+			lhits++
+		}
+		return err
+	case defs.UFFDIO_WAKE:
+		args, err := _ioctlargs(p, argp, 2)
+		if err != 0 {
+			return err
+		}
+		if err := _uffd_range(args[0], args[1]); err != 0 {
+			return err
+		}
+		uf.uffd.Wake(args[0], args[1])
+		return 0
+	case defs.UFFDIO_COPY, defs.UFFDIO_ZEROPAGE:
+		zero := req == defs.UFFDIO_ZEROPAGE
+		n := 4
+		if zero {
+			n = 3
+		}
+		args, err := _ioctlargs(p, argp, n)
+		if err != 0 {
+			return err
+		}
+		// struct uffdio_copy has a source address after the destination
+		dst, src, len, mode := args[0], 0, args[1], args[2]
+		if !zero {
+			src, len, mode = args[1], args[2], args[3]
+		}
+		if err := _uffd_range(dst, len); err != 0 {
+			return err
+		}
+		if mode&^defs.UFFDIO_COPY_MODE_DONTWAKE != 0 {
+			return -defs.EINVAL
+		}
+		did := 0
+		for ; did < len; did += mem.PGSIZE {
+			if zero {
+				err = uf.uffd.Zeropage(dst + did)
+			} else {
+				err = uf._copypage(p, dst+did, src+did)
+			}
+			if err != 0 {
+				break
+			}
+		}
+		// the number of bytes mapped or the error follows the
+		// arguments
+		out := did
+		if did == 0 {
+			out = int(err)
+		}
+		if err := p.Vm.Userwriten(argp+8*n, 8, out); err != 0 {
+			return err
+		}
+		if did == 0 {
+			return err
+		}
+		if mode&defs.UFFDIO_COPY_MODE_DONTWAKE == 0 {
+			uf.uffd.Wake(dst, did)
+		}
+		if did != len {
+			return -defs.EAGAIN
+		}
+		return 0
+	}
+	return -defs.EINVAL
+}
 
-func sys_getrlimit(p *proc.Proc_t, resn, rlpn int) int {
-	var cur uint
-	switch resn {
-	case defs.RLIMIT_NOFILE:
-		cur = p.Ulim.Nofile
-	default:
-		return int(-defs.EINVAL)
+// copies the page at the caller's src to the missing page at dst of a range
+// registered with the userfaultfd.
+func (uf *uffdfops_t) _copypage(p *proc.Proc_t, dst, src int) defs.Err_t {
+	pg, p_pg, ok := physmem.Refpg_new_nozero()
+	if !ok {
+		lhits++
+		return -defs.ENOMEM
 	}
-	max := _rlimits[resn]
-	err1 := p.Vm.Userwriten(rlpn, 8, int(cur))
-	err2 := p.Vm.Userwriten(rlpn+8, 8, int(max))
-	if err1 != 0 {
-		return int(err1)
+	if err := p.Vm.User2k(mem.Pg2bytes(pg)[:], src); err != 0 {
+		// free the page
+		physmem.Refup(p_pg)
+		physmem.Refdown(p_pg)
+		return err
 	}
-	if err2 != 0 {
-		return int(err2)
+	return uf.uffd.Copy(dst, p_pg)
+}
+
+func (uf *uffdfops_t) Close() defs.Err_t {
+	uf.Lock()
+	uf.refs--
+	last := uf.refs == 0
+	uf.Unlock()
+	if last {
+		uf.uffd.Close()
 	}
 	return 0
 }
 
-func sys_setrlimit(p *proc.Proc_t, resn, rlpn int) int {
-	// XXX root can raise max
-	_ncur, err := p.Vm.Userreadn(rlpn, 8)
-	if err != 0 {
-		return int(err)
-	}
-	ncur := uint(_ncur)
-	if ncur > _rlimits[resn] {
-		return int(-defs.EINVAL)
-	}
-	switch resn {
-	case defs.RLIMIT_NOFILE:
-		p.Ulim.Nofile = ncur
-	default:
-		return int(-defs.EINVAL)
-	}
+func (uf *uffdfops_t) Fstat(st *stat.Stat_t) defs.Err_t {
+	st.Wdev(0)
+	st.Wmode(0)
 	return 0
 }
 
-func sys_getrusage(p *proc.Proc_t, who, rusagep int) int {
-	var ru []uint8
-	if who == defs.RUSAGE_SELF {
-		// user time is gathered at thread termination... report user
-		// time as best as we can
-		tmp := p.Atime
+func (uf *uffdfops_t) Lseek(int, int) (int, defs.Err_t) {
+	return 0, -defs.ESPIPE
+}
 
-		p.Threadi.Lock()
-		for tid := range p.Threadi.Notes {
-			if tid == 0 {
-			}
-			val := 42
-			// tid may not exist if the query for the time races
-			// with a thread exiting.
-			if val > 0 {
-				tmp.Userns += int64(val)
-			}
-		}
-		p.Threadi.Unlock()
+func (uf *uffdfops_t) Mmapi(int, int, bool) ([]mem.Mmapinfo_t, defs.Err_t) {
+	return nil, -defs.EINVAL
+}
 
-		ru = tmp.To_rusage()
-	} else if who == defs.RUSAGE_CHILDREN {
-		ru = p.Catime.Fetch()
-	} else {
-		return int(-defs.EINVAL)
-	}
-	if err := p.Vm.K2user(ru, rusagep); err != 0 {
-		return int(err)
-	}
-	return int(-defs.ENOSYS)
+func (uf *uffdfops_t) Pathi() defs.Inum_t {
+	panic("userfaultfd cwd")
 }
 
-func sys_mknod(p *proc.Proc_t, pathn, moden, devn int) int {
-	path, err := p.Vm.Userstr(pathn, fs.NAME_MAX)
-	if err != 0 {
-		return int(err)
-	}
+func (uf *uffdfops_t) Read(dst fdops.Userio_i) (int, defs.Err_t) {
+	noblk := uf.options&defs.O_NONBLOCK != 0
+	return uf.uffd.Read(dst, noblk)
+}
 
-	err = badpath(path)
-	if err != 0 {
-		return int(err)
-	}
-	maj, min := defs.Unmkdev(uint(devn))
-	fsf, err := thefs.Fs_open_inner(path, defs.O_CREAT, 0, p.Cwd, maj, min)
-	if err != 0 {
-		return int(err)
-	}
-	if thefs.Fs_close(fsf.Inum) != 0 {
-		panic("must succeed")
-	}
+func (uf *uffdfops_t) Reopen() defs.Err_t {
+	uf.Lock()
+	uf.refs++
+	uf.Unlock()
 	return 0
 }
 
-func sys_sync(p *proc.Proc_t) int {
-	return int(thefs.Fs_sync())
+func (uf *uffdfops_t) Write(fdops.Userio_i) (int, defs.Err_t) {
+	return 0, -defs.EINVAL
 }
 
-func sys_reboot(p *proc.Proc_t) int {
-	// mov'ing to cr3 does not flush global pages. if, before loading the
-	// zero page into cr3 below, there are just enough TLB entries to
-	// dispatch a fault, but not enough to complete the fault handler, the
-	// fault handler will recursively fault forever since it uses an IST
-	// stack. therefore, flush the global pages too.
-	pge := uintptr(1 << 7)
-	runtime.Lcr4(runtime.Rcr4() &^ pge)
-	// who needs ACPI?
-	runtime.Lcr3(uintptr(mem.P_zeropg))
-	// poof
-	fmt.Printf("what?\n")
-	return 0
+func (uf *uffdfops_t) Truncate(uint) defs.Err_t {
+	return -defs.EINVAL
 }
 
-func sys_nanosleep(p *proc.Proc_t, sleeptsn, remaintsn int) int {
-	tot, _, err := p.Vm.Usertimespec(sleeptsn)
-	if err != 0 {
-		return int(err)
-	}
-	tochan := time.After(tot)
-	kn := &tinfo.Current().Killnaps
-	select {
-	case <-tochan:
+func (uf *uffdfops_t) Pread(fdops.Userio_i, int) (int, defs.Err_t) {
+	return 0, -defs.ESPIPE
+}
+
+func (uf *uffdfops_t) Pwrite(fdops.Userio_i, int) (int, defs.Err_t) {
+	return 0, -defs.ESPIPE
+}
+
+func (uf *uffdfops_t) Accept(fdops.Userio_i) (fdops.Fdops_i, int, defs.Err_t) {
+	return nil, 0, -defs.ENOTSOCK
+}
+
+func (uf *uffdfops_t) Bind([]uint8) defs.Err_t {
+	return -defs.ENOTSOCK
+}
+
+func (uf *uffdfops_t) Connect([]uint8) defs.Err_t {
+	return -defs.ENOTSOCK
+}
+
+func (uf *uffdfops_t) Listen(int) (fdops.Fdops_i, defs.Err_t) {
+	return nil, -defs.ENOTSOCK
+}
+
+func (uf *uffdfops_t) Sendmsg(fdops.Userio_i, []uint8, []uint8,
+	int) (int, defs.Err_t) {
+	return 0, -defs.ENOTSOCK
+}
+
+func (uf *uffdfops_t) Recvmsg(fdops.Userio_i, fdops.Userio_i,
+	fdops.Userio_i, int) (int, int, int, defs.Msgfl_t, defs.Err_t) {
+	return 0, 0, 0, 0, -defs.ENOTSOCK
+}
+
+func (uf *uffdfops_t) Pollone(pm fdops.Pollmsg_t) (fdops.Ready_t, defs.Err_t) {
+	return uf.uffd.Pollone(pm)
+}
+
+func (uf *uffdfops_t) Fcntl(cmd, opt int) int {
+	switch cmd {
+	case defs.F_GETFL:
+		return int(uf.options)
+	case defs.F_SETFL:
+		uf.options = defs.Fdopt_t(opt)
 		return 0
-	case <-kn.Killch:
-		if kn.Kerr == 0 {
-			panic("no")
-		}
-		return int(kn.Kerr)
+	default:
+		panic("weird cmd")
 	}
 }
 
-func sys_getpid(p *proc.Proc_t, tid defs.Tid_t) int {
-	return p.Pid
+func (uf *uffdfops_t) Getsockopt(int, fdops.Userio_i, int) (int, defs.Err_t) {
+	return 0, -defs.ENOTSOCK
 }
 
-func sys_getppid(p *proc.Proc_t, tid defs.Tid_t) int {
-	return p.Pwait.Pid
+func (uf *uffdfops_t) Setsockopt(int, int, fdops.Userio_i, int) defs.Err_t {
+	return -defs.ENOTSOCK
 }
 
-func sys_socket(p *proc.Proc_t, domain, typ, proto int) int {
-	var opts defs.Fdopt_t
-	if typ&defs.SOCK_NONBLOCK != 0 {
-		opts |= defs.O_NONBLOCK
-	}
-	var clop int
-	if typ&defs.SOCK_CLOEXEC != 0 {
-		clop = fd.FD_CLOEXEC
-	}
+func (uf *uffdfops_t) Shutdown(read, write bool) defs.Err_t {
+	return -defs.ENOTSOCK
+}
 
-	var sfops fdops.Fdops_i
-	switch {
-	case domain == defs.AF_UNIX && typ&defs.SOCK_DGRAM != 0:
-		if opts != 0 {
-			panic("no imp")
-		}
-		sfops = &sudfops_t{open: 1}
-	case domain == defs.AF_UNIX && typ&defs.SOCK_STREAM != 0:
-		sfops = &susfops_t{options: opts}
-	case domain == defs.AF_INET && typ&defs.SOCK_STREAM != 0:
-		tfops := &bnet.Tcpfops_t{}
-		tfops.Set(&bnet.Tcptcb_t{}, opts)
-		sfops = tfops
-	default:
+type epollfops_t struct {
+	sync.Mutex
+	ep *fdops.Epoll_t
+	// the number of file descriptors which refer to the epoll instance
+	refs    int
+	options defs.Fdopt_t
+}
+
+func sys_epoll_create1(p *proc.Proc_t, _flags int) int {
+	if _flags&^defs.EPOLL_CLOEXEC != 0 {
 		return int(-defs.EINVAL)
 	}
-	if !limits.Syslimit.Socks.Take() {
-		lhits++
-		return int(-defs.ENOMEM)
+	perms := fd.FD_READ
+	if _flags&defs.EPOLL_CLOEXEC != 0 {
+		perms |= fd.FD_CLOEXEC
 	}
-	file := &fd.Fd_t{}
-	file.Fops = sfops
-	fdn, ok := p.Fd_insert(file, fd.FD_READ|fd.FD_WRITE|clop)
+	ef := &epollfops_t{ep: fdops.Mkepoll(), refs: 1}
+	fdn, ok := p.Fd_insert(&fd.Fd_t{Fops: ef}, perms)
 	if !ok {
-		fd.Close_panic(file)
-		limits.Syslimit.Socks.Give()
+		lhits++
 		return int(-defs.EMFILE)
 	}
 	return fdn
 }
 
-func sys_connect(p *proc.Proc_t, fdn, sockaddrn, socklen int) int {
-	fd, ok := p.Fd_get(fdn)
-	if !ok {
-		return int(-defs.EBADF)
+func _epev2ready(ev int) fdops.Ready_t {
+	var r fdops.Ready_t
+	if ev&(defs.EPOLLIN|defs.EPOLLPRI) != 0 {
+		r |= fdops.R_READ
+	}
+	if ev&defs.EPOLLOUT != 0 {
+		r |= fdops.R_WRITE
 	}
+	return r
+}
 
-	// copy sockaddr to kernel space to avoid races
-	sabuf, err := copysockaddr(p, sockaddrn, socklen)
-	if err != 0 {
-		return int(err)
+func _ready2epev(r fdops.Ready_t) int {
+	var ev int
+	if r&fdops.R_READ != 0 {
+		ev |= defs.EPOLLIN
 	}
-	err = fd.Fops.Connect(sabuf)
-	return int(err)
+	if r&fdops.R_WRITE != 0 {
+		ev |= defs.EPOLLOUT
+	}
+	if r&fdops.R_ERROR != 0 {
+		ev |= defs.EPOLLERR
+	}
+	if r&fdops.R_HUP != 0 {
+		ev |= defs.EPOLLHUP
+	}
+	return ev
 }
 
-func sys_accept(p *proc.Proc_t, fdn, sockaddrn, socklenn int) int {
-	f, ok := p.Fd_get(fdn)
+// the size of the packed struct epoll_event
+const _epevsz = 12
+
+// epoll instances cannot watch epoll instances
+func sys_epoll_ctl(p *proc.Proc_t, epfd, op, fdn, eventn int) int {
+	ef, ok := p.Fd_get(epfd)
 	if !ok {
 		return int(-defs.EBADF)
 	}
-	var sl int
-	if socklenn != 0 {
-		l, err := p.Vm.Userreadn(socklenn, 8)
-		if err != 0 {
-			return int(err)
-		}
-		if l < 0 {
-			return int(-defs.EFAULT)
-		}
-		sl = l
+	tf, ok := p.Fd_get(fdn)
+	if !ok {
+		return int(-defs.EBADF)
 	}
-	fromsa := p.Vm.Mkuserbuf(sockaddrn, sl)
-	newfops, fromlen, err := f.Fops.Accept(fromsa)
-	//proc.Ubpool.Put(fromsa)
-	if err != 0 {
-		return int(err)
+	eps, ok := ef.Fops.(*epollfops_t)
+	if !ok || fdn == epfd {
+		return int(-defs.EINVAL)
 	}
-	if fromlen != 0 {
-		if err := p.Vm.Userwriten(socklenn, 8, fromlen); err != 0 {
+	if _, ok := tf.Fops.(*epollfops_t); ok {
+		return int(-defs.EINVAL)
+	}
+	var ctl fdops.Epctl_t
+	if op == defs.EPOLL_CTL_ADD || op == defs.EPOLL_CTL_MOD {
+		buf := make([]uint8, _epevsz)
+		if err := p.Vm.User2k(buf, eventn); err != 0 {
 			return int(err)
 		}
+		ev := util.Readn(buf, 4, 0)
+		ctl.Events = _epev2ready(ev)
+		ctl.Edge = ev&defs.EPOLLET != 0
+		ctl.Oneshot = ev&defs.EPOLLONESHOT != 0
+		ctl.Data = util.Readn(buf, 8, 4)
+	}
+	switch op {
+	case defs.EPOLL_CTL_ADD:
+		return int(eps.ep.Add(fdn, tf.Fops, ctl))
+	case defs.EPOLL_CTL_MOD:
+		return int(eps.ep.Mod(fdn, tf.Fops, ctl))
+	case defs.EPOLL_CTL_DEL:
+		return int(eps.ep.Del(fdn, tf.Fops))
+	default:
+		return int(-defs.EINVAL)
 	}
-	newfd := &fd.Fd_t{Fops: newfops}
-	ret, ok := p.Fd_insert(newfd, fd.FD_READ|fd.FD_WRITE)
-	if !ok {
-		fd.Close_panic(newfd)
-		return int(-defs.EMFILE)
-	}
-	return ret
 }
 
-func copysockaddr(p *proc.Proc_t, san, sl int) ([]uint8, defs.Err_t) {
-	if sl == 0 {
-		return nil, 0
+func sys_epoll_wait(p *proc.Proc_t, epfd, eventsn, maxevents, timeout int) int {
+	if maxevents <= 0 || timeout < -1 {
+		return int(-defs.EINVAL)
 	}
-	if sl < 0 {
-		return nil, -defs.EFAULT
+	ef, ok := p.Fd_get(epfd)
+	if !ok {
+		return int(-defs.EBADF)
 	}
-	maxsl := 256
-	if sl >= maxsl {
-		return nil, -defs.ENOTSOCK
+	eps, ok := ef.Fops.(*epollfops_t)
+	if !ok {
+		return int(-defs.EINVAL)
 	}
-	ub := p.Vm.Mkuserbuf(san, sl)
-	sabuf := make([]uint8, sl)
-	_, err := ub.Uioread(sabuf)
-	//proc.Ubpool.Put(ub)
-	if err != 0 {
-		return nil, err
+	// the registrations of closed descriptors are dropped
+	live := func(fdn int, fops fdops.Fdops_i) bool {
+		f, ok := p.Fd_get(fdn)
+		return ok && f.Fops == fops
 	}
-	return sabuf, 0
-}
-
-func sys_sendto(p *proc.Proc_t, fdn, bufn, flaglen, sockaddrn, socklen int) int {
-	fd, err := _fd_write(p, fdn)
+	evs, err := eps.ep.Wait(maxevents, timeout, live)
 	if err != 0 {
 		return int(err)
 	}
-	flags := int(uint(uint32(flaglen)))
-	if flags != 0 {
-		panic("no imp")
-	}
-	buflen := int(uint(flaglen) >> 32)
-	if buflen < 0 {
-		return int(-defs.EFAULT)
+	buf := make([]uint8, len(evs)*_epevsz)
+	for i, ev := range evs {
+		util.Writen(buf, 4, i*_epevsz, _ready2epev(ev.Events))
+		util.Writen(buf, 8, i*_epevsz+4, ev.Data)
 	}
-
-	// copy sockaddr to kernel space to avoid races
-	sabuf, err := copysockaddr(p, sockaddrn, socklen)
-	if err != 0 {
+	if err := p.Vm.K2user(buf, eventsn); err != 0 {
 		return int(err)
 	}
+	return len(evs)
+}
 
-	buf := p.Vm.Mkuserbuf(bufn, buflen)
-	ret, err := fd.Fops.Sendmsg(buf, sabuf, nil, flags)
-	//proc.Ubpool.Put(buf)
-	if err != 0 {
-		return int(err)
+func (ef *epollfops_t) Close() defs.Err_t {
+	ef.Lock()
+	ef.refs--
+	last := ef.refs == 0
+	ef.Unlock()
+	if last {
+		ef.ep.Close()
 	}
-	return ret
+	return 0
 }
 
-func sys_recvfrom(p *proc.Proc_t, fdn, bufn, flaglen, sockaddrn,
-	socklenn int) int {
-	fd, err := _fd_read(p, fdn)
+func (ef *epollfops_t) Fstat(st *stat.Stat_t) defs.Err_t {
+	st.Wdev(0)
+	st.Wmode(0)
+	return 0
+}
+
+func (ef *epollfops_t) Lseek(int, int) (int, defs.Err_t) {
+	return 0, -defs.ESPIPE
+}
+
+func (ef *epollfops_t) Mmapi(int, int, bool) ([]mem.Mmapinfo_t, defs.Err_t) {
+	return nil, -defs.EINVAL
+}
+
+func (ef *epollfops_t) Pathi() defs.Inum_t {
+	panic("epoll cwd")
+}
+
+func (ef *epollfops_t) Read(fdops.Userio_i) (int, defs.Err_t) {
+	return 0, -defs.EINVAL
+}
+
+func (ef *epollfops_t) Reopen() defs.Err_t {
+	ef.Lock()
+	ef.refs++
+	ef.Unlock()
+	return 0
+}
+
+func (ef *epollfops_t) Write(fdops.Userio_i) (int, defs.Err_t) {
+	return 0, -defs.EINVAL
+}
+
+func (ef *epollfops_t) Truncate(uint) defs.Err_t {
+	return -defs.EINVAL
+}
+
+func (ef *epollfops_t) Pread(fdops.Userio_i, int) (int, defs.Err_t) {
+	return 0, -defs.ESPIPE
+}
+
+func (ef *epollfops_t) Pwrite(fdops.Userio_i, int) (int, defs.Err_t) {
+	return 0, -defs.ESPIPE
+}
+
+func (ef *epollfops_t) Accept(fdops.Userio_i) (fdops.Fdops_i, int, defs.Err_t) {
+	return nil, 0, -defs.ENOTSOCK
+}
+
+func (ef *epollfops_t) Bind([]uint8) defs.Err_t {
+	return -defs.ENOTSOCK
+}
+
+func (ef *epollfops_t) Connect([]uint8) defs.Err_t {
+	return -defs.ENOTSOCK
+}
+
+func (ef *epollfops_t) Listen(int) (fdops.Fdops_i, defs.Err_t) {
+	return nil, -defs.ENOTSOCK
+}
+
+func (ef *epollfops_t) Sendmsg(fdops.Userio_i, []uint8, []uint8,
+	int) (int, defs.Err_t) {
+	return 0, -defs.ENOTSOCK
+}
+
+func (ef *epollfops_t) Recvmsg(fdops.Userio_i, fdops.Userio_i,
+	fdops.Userio_i, int) (int, int, int, defs.Msgfl_t, defs.Err_t) {
+	return 0, 0, 0, 0, -defs.ENOTSOCK
+}
+
+func (ef *epollfops_t) Pollone(pm fdops.Pollmsg_t) (fdops.Ready_t, defs.Err_t) {
+	return ef.ep.Pollone(pm)
+}
+
+func (ef *epollfops_t) Fcntl(cmd, opt int) int {
+	ef.Lock()
+	defer ef.Unlock()
+	switch cmd {
+	case defs.F_GETFL:
+		return int(ef.options)
+	case defs.F_SETFL:
+		ef.options = defs.Fdopt_t(opt)
+		return 0
+	default:
+		panic("weird cmd")
+	}
+}
+
+func (ef *epollfops_t) Getsockopt(int, fdops.Userio_i, int) (int, defs.Err_t) {
+	return 0, -defs.ENOTSOCK
+}
+
+func (ef *epollfops_t) Setsockopt(int, int, fdops.Userio_i, int) defs.Err_t {
+	return -defs.ENOTSOCK
+}
+
+func (ef *epollfops_t) Shutdown(read, write bool) defs.Err_t {
+	return -defs.ENOTSOCK
+}
+
+func _evfd_insert(p *proc.Proc_t, fops fdops.Fdops_i, cloexec bool) int {
+	perms := fd.FD_READ | fd.FD_WRITE
+	if cloexec {
+		perms |= fd.FD_CLOEXEC
+	}
+	fdn, ok := p.Fd_insert(&fd.Fd_t{Fops: fops}, perms)
+	if !ok {
+		lhits++
+		fops.Close()
+		return int(-defs.EMFILE)
+	}
+	return fdn
+}
+
+func sys_eventfd2(p *proc.Proc_t, initval, flags int) int {
+	if flags&^(defs.EFD_SEMAPHORE|defs.EFD_NONBLOCK|defs.EFD_CLOEXEC) != 0 {
+		return int(-defs.EINVAL)
+	}
+	sema := flags&defs.EFD_SEMAPHORE != 0
+	nonblock := flags&defs.EFD_NONBLOCK != 0
+	e := evfd.Mkeventfd(uint(uint32(initval)), sema, nonblock)
+	return _evfd_insert(p, e, flags&defs.EFD_CLOEXEC != 0)
+}
+
+func sys_timerfd_create(p *proc.Proc_t, clock, flags int) int {
+	if flags&^(defs.TFD_NONBLOCK|defs.TFD_CLOEXEC) != 0 {
+		return int(-defs.EINVAL)
+	}
+	t, err := evfd.Mktimerfd(clock, flags&defs.TFD_NONBLOCK != 0)
 	if err != 0 {
 		return int(err)
 	}
-	flags := uint(uint32(flaglen))
-	if flags != 0 {
-		panic("no imp")
+	return _evfd_insert(p, t, flags&defs.TFD_CLOEXEC != 0)
+}
+
+func _timerfd_get(p *proc.Proc_t, fdn int) (*evfd.Timerfd_t, defs.Err_t) {
+	f, ok := p.Fd_get(fdn)
+	if !ok {
+		return nil, -defs.EBADF
 	}
-	buflen := int(uint(flaglen) >> 32)
-	buf := p.Vm.Mkuserbuf(bufn, buflen)
+	t, ok := f.Fops.(*evfd.Timerfd_t)
+	if !ok {
+		return nil, -defs.EINVAL
+	}
+	return t, 0
+}
 
-	// is the from address requested?
-	var salen int
-	if socklenn != 0 {
-		l, err := p.Vm.Userreadn(socklenn, 8)
-		if err != 0 {
-			return int(err)
-		}
-		salen = l
-		if salen < 0 {
-			return int(-defs.EFAULT)
-		}
+// writes a struct itimerspec to user address va
+func _itimerspec_write(p *proc.Proc_t, va int, val,
+	ival time.Duration) defs.Err_t {
+	buf := make([]uint8, 32)
+	writen(buf, 8, 0, int(ival/time.Second))
+	writen(buf, 8, 8, int(ival%time.Second))
+	writen(buf, 8, 16, int(val/time.Second))
+	writen(buf, 8, 24, int(val%time.Second))
+	return p.Vm.K2user(buf, va)
+}
+
+func sys_timerfd_settime(p *proc.Proc_t, fdn, flags, newn, oldn int) int {
+	if flags&^defs.TFD_TIMER_ABSTIME != 0 {
+		return int(-defs.EINVAL)
 	}
-	fromsa := p.Vm.Mkuserbuf(sockaddrn, salen)
-	ret, addrlen, _, _, err := fd.Fops.Recvmsg(buf, fromsa, zeroubuf, 0)
-	//proc.Ubpool.Put(buf)
-	//proc.Ubpool.Put(fromsa)
+	t, err := _timerfd_get(p, fdn)
 	if err != 0 {
 		return int(err)
 	}
-	// write new socket size to user space
-	if addrlen > 0 {
-		if err := p.Vm.Userwriten(socklenn, 8, addrlen); err != 0 {
+	ival, _, err := p.Vm.Usertimespec(newn)
+	if err != 0 {
+		return int(err)
+	}
+	val, _, err := p.Vm.Usertimespec(newn + 16)
+	if err != 0 {
+		return int(err)
+	}
+	abs := flags&defs.TFD_TIMER_ABSTIME != 0
+	oval, oival := t.Settime(val, abs, ival)
+	if oldn != 0 {
+		if err := _itimerspec_write(p, oldn, oval, oival); err != 0 {
 			return int(err)
 		}
 	}
-	return ret
+	return 0
 }
 
-func sys_recvmsg(p *proc.Proc_t, fdn, _msgn, _flags int) int {
-	if _flags != 0 {
-		panic("no imp")
+func sys_timerfd_gettime(p *proc.Proc_t, fdn, curn int) int {
+	t, err := _timerfd_get(p, fdn)
+	if err != 0 {
+		return int(err)
 	}
-	fd, err := _fd_read(p, fdn)
+	val, ival := t.Gettime()
+	return int(_itimerspec_write(p, curn, val, ival))
+}
+
+// creates a signalfd if fdn is -1, and otherwise changes the mask of the
+// signalfd fdn
+func sys_signalfd4(p *proc.Proc_t, fdn, maskn, sizemask, flags int) int {
+	if flags&^(defs.SFD_NONBLOCK|defs.SFD_CLOEXEC) != 0 || sizemask != 8 {
+		return int(-defs.EINVAL)
+	}
+	m, err := p.Vm.Userreadn(maskn, 8)
 	if err != 0 {
 		return int(err)
 	}
-	// maybe copy the msghdr to kernel space?
-	msgn := uint(_msgn)
-	iovn, err1 := p.Vm.Userreadn(int(msgn+2*8), 8)
-	niov, err2 := p.Vm.Userreadn(int(msgn+3*8), 4)
-	cmsgl, err3 := p.Vm.Userreadn(int(msgn+5*8), 8)
-	salen, err4 := p.Vm.Userreadn(int(msgn+1*8), 8)
-	if err1 != 0 {
-		return int(err1)
+	// SIGKILL cannot be read
+	mask := uint64(m) &^ (1 << (defs.SIGKILL - 1))
+	if fdn != -1 {
+		f, ok := p.Fd_get(fdn)
+		if !ok {
+			return int(-defs.EBADF)
+		}
+		sf, ok := f.Fops.(*evfd.Signalfd_t)
+		if !ok {
+			return int(-defs.EINVAL)
+		}
+		sf.Setmask(mask)
+		return fdn
 	}
-	if err2 != 0 {
-		return int(err2)
+	sf := evfd.Mksignalfd(&p.Sigs, mask, flags&defs.SFD_NONBLOCK != 0)
+	return _evfd_insert(p, sf, flags&defs.SFD_CLOEXEC != 0)
+}
+
+func sys_inotify_init1(p *proc.Proc_t, flags int) int {
+	if flags&^(defs.IN_NONBLOCK|defs.IN_CLOEXEC) != 0 {
+		return int(-defs.EINVAL)
 	}
-	if err3 != 0 {
-		return int(err3)
+	perms := fd.FD_READ
+	if flags&defs.IN_CLOEXEC != 0 {
+		perms |= fd.FD_CLOEXEC
 	}
-	if err4 != 0 {
-		return int(err4)
+	in := thefs.Mkinotify(flags&defs.IN_NONBLOCK != 0)
+	fdn, ok := p.Fd_insert(&fd.Fd_t{Fops: in}, perms)
+	if !ok {
+		lhits++
+		in.Close()
+		return int(-defs.EMFILE)
 	}
+	return fdn
+}
 
-	var saddr fdops.Userio_i
-	saddr = zeroubuf
-	if salen > 0 {
-		saddrn, err := p.Vm.Userreadn(int(msgn+0*8), 8)
-		if err != 0 {
-			return int(err)
-		}
-		ub := p.Vm.Mkuserbuf(saddrn, salen)
-		saddr = ub
+func _inotify_get(p *proc.Proc_t, fdn int) (*fs.Inotify_t, defs.Err_t) {
+	f, ok := p.Fd_get(fdn)
+	if !ok {
+		return nil, -defs.EBADF
 	}
-	var cmsg fdops.Userio_i
-	cmsg = zeroubuf
-	if cmsgl > 0 {
-		cmsgn, err := p.Vm.Userreadn(int(msgn+4*8), 8)
-		if err != 0 {
-			return int(err)
-		}
-		ub := p.Vm.Mkuserbuf(cmsgn, cmsgl)
-		cmsg = ub
+	in, ok := f.Fops.(*fs.Inotify_t)
+	if !ok {
+		return nil, -defs.EINVAL
 	}
+	return in, 0
+}
 
-	iov := &vm.Useriovec_t{}
-	err = iov.Iov_init(&p.Vm, uint(iovn), niov)
+func sys_inotify_add_watch(p *proc.Proc_t, fdn, pathn, mask int) int {
+	in, err := _inotify_get(p, fdn)
 	if err != 0 {
 		return int(err)
 	}
-
-	ret, sawr, cmwr, msgfl, err := fd.Fops.Recvmsg(iov, saddr,
-		cmsg, 0)
+	path, err := p.Vm.Userstr(pathn, fs.NAME_MAX)
 	if err != 0 {
 		return int(err)
 	}
-	// write size of socket address, ancillary data, and msg flags back to
-	// user space
-	if err := p.Vm.Userwriten(int(msgn+28), 4, int(msgfl)); err != 0 {
+	if err := badpath(path); err != 0 {
 		return int(err)
 	}
-	if saddr.Totalsz() != 0 {
-		if err := p.Vm.Userwriten(int(msgn+1*8), 8, sawr); err != 0 {
-			return int(err)
-		}
-	}
-	if cmsg.Totalsz() != 0 {
-		if err := p.Vm.Userwriten(int(msgn+5*8), 8, cmwr); err != 0 {
-			return int(err)
-		}
+	wd, err := in.Add_watch(path, p.Cwd, int(uint32(mask)))
+	if err != 0 {
+		return int(err)
 	}
-	return ret
+	return wd
 }
 
-func sys_sendmsg(p *proc.Proc_t, fdn, _msgn, _flags int) int {
-	if _flags != 0 {
-		panic("no imp")
-	}
-	fd, err := _fd_write(p, fdn)
+func sys_inotify_rm_watch(p *proc.Proc_t, fdn, wd int) int {
+	in, err := _inotify_get(p, fdn)
 	if err != 0 {
 		return int(err)
 	}
-	// maybe copy the msghdr to kernel space?
-	msgn := uint(_msgn)
-	iovn, err1 := p.Vm.Userreadn(int(msgn+2*8), 8)
-	niov, err2 := p.Vm.Userreadn(int(msgn+3*8), 8)
-	cmsgl, err3 := p.Vm.Userreadn(int(msgn+5*8), 8)
-	salen, err4 := p.Vm.Userreadn(int(msgn+1*8), 8)
-	if err1 != 0 {
-		return int(err1)
+	return int(in.Rm_watch(wd))
+}
+
+// reads from f into the kernel buffer, at offset off unless off is -1
+func _kread(f fdops.Fdops_i, buf []uint8, off int) (int, defs.Err_t) {
+	fb := &vm.Fakeubuf_t{}
+	fb.Fake_init(buf)
+	if off == -1 {
+		return f.Read(fb)
 	}
-	if err2 != 0 {
-		return int(err2)
+	return f.Pread(fb, off)
+}
+
+// writes the kernel buffer to f, at offset off unless off is -1
+func _kwrite(f fdops.Fdops_i, buf []uint8, off int) (int, defs.Err_t) {
+	fb := &vm.Fakeubuf_t{}
+	fb.Fake_init(buf)
+	if off == -1 {
+		return f.Write(fb)
 	}
-	if err3 != 0 {
-		return int(err3)
+	return f.Pwrite(fb, off)
+}
+
+// the most bytes which sendfile(2) moves at a time
+const _sendchunk = 16 * mem.PGSIZE
+
+func sys_sendfile(p *proc.Proc_t, outfd, infd, offn, count int) int {
+	in, ok1 := p.Fd_get(infd)
+	out, ok2 := p.Fd_get(outfd)
+	if !ok1 || !ok2 || in.Perms&fd.FD_READ == 0 ||
+		out.Perms&fd.FD_WRITE == 0 {
+		return int(-defs.EBADF)
 	}
-	if err4 != 0 {
-		return int(err4)
+	if count < 0 {
+		return int(-defs.EINVAL)
 	}
-
-	// copy to address and ancillary data to kernel space
-	var saddr []uint8
-	if salen > 0 {
-		if salen > 64 {
+	// the input must be a seekable file
+	off, err := in.Fops.Lseek(0, defs.SEEK_CUR)
+	if err != 0 {
+		return int(-defs.EINVAL)
+	}
+	if offn != 0 {
+		off, err = p.Vm.Userreadn(offn, 8)
+		if err != 0 {
+			return int(err)
+		}
+		if off < 0 {
 			return int(-defs.EINVAL)
 		}
-		saddrva, err := p.Vm.Userreadn(int(msgn+0*8), 8)
-		if err != 0 {
+	}
+	did, err := _sendfile(out.Fops, in.Fops, off, count)
+	// the file offset is not changed when an offset is given
+	if offn != 0 {
+		if err := p.Vm.Userwriten(offn, 8, off+did); err != 0 {
 			return int(err)
 		}
-		saddr = make([]uint8, salen)
-		ub := p.Vm.Mkuserbuf(saddrva, salen)
-		did, err := ub.Uioread(saddr)
-		if err != 0 {
+	} else if did != 0 {
+		if _, err := in.Fops.Lseek(off+did, defs.SEEK_SET); err != 0 {
 			return int(err)
 		}
-		if did != salen {
-			panic("how")
-		}
 	}
-	var cmsg []uint8
-	if cmsgl > 0 {
-		if cmsgl > 256 {
-			return int(-defs.EINVAL)
-		}
-		cmsgva, err := p.Vm.Userreadn(int(msgn+4*8), 8)
-		if err != 0 {
-			return int(err)
-		}
-		cmsg = make([]uint8, cmsgl)
-		ub := p.Vm.Mkuserbuf(cmsgva, cmsgl)
-		did, err := ub.Uioread(cmsg)
-		if err != 0 {
-			return int(err)
+	if did == 0 && err != 0 {
+		return int(err)
+	}
+	return did
+}
+
+// sends the page cache pages of the file to out without copying them if out
+// supports it, otherwise copies the file through a kernel buffer. returns the
+// number of bytes sent.
+func _sendfile(out, in fdops.Fdops_i, off, count int) (int, defs.Err_t) {
+	var st stat.Stat_t
+	if err := in.Fstat(&st); err != 0 {
+		return 0, err
+	}
+	size := int(st.Size())
+	sink, zerocopy := out.(fdops.Pagesink_i)
+	var did int
+	for did < count {
+		n := util.Min(count-did, _sendchunk)
+		var c int
+		var err defs.Err_t
+		if zerocopy {
+			n = util.Min(n, size-off-did)
+			if n <= 0 {
+				break
+			}
+			c, err = _sendpages(sink, in, off+did, n)
+		} else {
+			buf := make([]uint8, n)
+			n, err = _kread(in, buf, off+did)
+			if n == 0 {
+				return did, err
+			}
+			c, err = _kwrite(out, buf[:n], -1)
 		}
-		if did != cmsgl {
-			panic("how")
+		did += c
+		if err != 0 || c < n {
+			return did, err
 		}
 	}
-	iov := &vm.Useriovec_t{}
-	err = iov.Iov_init(&p.Vm, uint(iovn), niov)
+	return did, 0
+}
+
+func _sendpages(sink fdops.Pagesink_i, in fdops.Fdops_i, off,
+	n int) (int, defs.Err_t) {
+	pgs, err := in.Mmapi(off, n, false)
 	if err != 0 {
-		return int(err)
+		return 0, err
 	}
-	ret, err := fd.Fops.Sendmsg(iov, saddr, cmsg, 0)
-	if err != 0 {
-		return int(err)
+	ret, err := sink.Sendpages(pgs, off%mem.PGSIZE, n)
+	// the sink references the pages it queued
+	for _, pg := range pgs {
+		mem.Physmem.Refdown(pg.Phys)
 	}
-	return ret
+	return ret, err
 }
 
-func sys_socketpair(p *proc.Proc_t, domain, typ, proto int, sockn int) int {
-	var opts defs.Fdopt_t
-	if typ&defs.SOCK_NONBLOCK != 0 {
-		opts |= defs.O_NONBLOCK
+// reads the offset at offn, returning -1 if offn is NULL
+func _spliceoff(p *proc.Proc_t, offn int) (int, defs.Err_t) {
+	if offn == 0 {
+		return -1, 0
 	}
-	var clop int
-	if typ&defs.SOCK_CLOEXEC != 0 {
-		clop = fd.FD_CLOEXEC
+	off, err := p.Vm.Userreadn(offn, 8)
+	if err != 0 {
+		return 0, err
+	}
+	if off < 0 {
+		return 0, -defs.EINVAL
 	}
+	return off, 0
+}
 
-	mask := defs.SOCK_STREAM | defs.SOCK_DGRAM
-	if typ&mask == 0 || typ&mask == mask {
+// the length and the flags share an argument; the flags are in the upper 32
+// bits. one end must be a pipe.
+func sys_splice(p *proc.Proc_t, infd, offinn, outfd, offoutn,
+	lenflags int) int {
+	n := int(uint32(lenflags))
+	flags := int(uint(lenflags) >> 32)
+	fl := defs.SPLICE_F_MOVE | defs.SPLICE_F_NONBLOCK | defs.SPLICE_F_MORE
+	if flags&^fl != 0 {
 		return int(-defs.EINVAL)
 	}
-
-	if !limits.Syslimit.Socks.Take() {
-		return int(-defs.ENOMEM)
+	in, ok1 := p.Fd_get(infd)
+	out, ok2 := p.Fd_get(outfd)
+	if !ok1 || !ok2 || in.Perms&fd.FD_READ == 0 ||
+		out.Perms&fd.FD_WRITE == 0 {
+		return int(-defs.EBADF)
 	}
-
-	var sfops1, sfops2 fdops.Fdops_i
-	var err defs.Err_t
+	ip, inpipe := in.Fops.(*pipefops_t)
+	op, outpipe := out.Fops.(*pipefops_t)
 	switch {
-	case domain == defs.AF_UNIX && typ&defs.SOCK_STREAM != 0:
-		sfops1, sfops2, err = _suspair(opts)
-	default:
-		panic("no imp")
+	case !inpipe && !outpipe:
+		return int(-defs.EINVAL)
+	case inpipe && outpipe && ip.pipe == op.pipe:
+		return int(-defs.EINVAL)
+	case inpipe && offinn != 0, outpipe && offoutn != 0:
+		return int(-defs.ESPIPE)
 	}
-
+	offin, err := _spliceoff(p, offinn)
 	if err != 0 {
-		limits.Syslimit.Socks.Give()
 		return int(err)
 	}
-
-	fd1 := &fd.Fd_t{}
-	fd1.Fops = sfops1
-	fd2 := &fd.Fd_t{}
-	fd2.Fops = sfops2
-	perms := fd.FD_READ | fd.FD_WRITE | clop
-	fdn1, fdn2, ok := p.Fd_insert2(fd1, perms, fd2, perms)
-	if !ok {
-		fd.Close_panic(fd1)
-		fd.Close_panic(fd2)
-		return int(-defs.EMFILE)
+	offout, err := _spliceoff(p, offoutn)
+	if err != 0 {
+		return int(err)
 	}
-	if err1, err2 := p.Vm.Userwriten(sockn, 4, fdn1), p.Vm.Userwriten(sockn+4, 4, fdn2); err1 != 0 || err2 != 0 {
-		if sys.Sys_close(p, fdn1) != 0 || sys.Sys_close(p, fdn2) != 0 {
-			panic("must succeed")
+	// the pipe operations do not block if the flag or a pipe's
+	// O_NONBLOCK is set
+	noblk := flags&defs.SPLICE_F_NONBLOCK != 0
+	if inpipe {
+		noblk = noblk || ip.options&defs.O_NONBLOCK != 0
+	}
+	if outpipe {
+		noblk = noblk || op.options&defs.O_NONBLOCK != 0
+	}
+	var did int
+	switch {
+	case inpipe && outpipe:
+		did, err = _pipe2pipe(ip.pipe, op.pipe, n, noblk)
+	case inpipe:
+		did, err = ip.pipe.op_splice_out(out.Fops, offout, n, noblk)
+	default:
+		did, err = op.pipe.op_splice_in(in.Fops, offin, n, noblk)
+	}
+	if err != 0 {
+		return int(err)
+	}
+	if offinn != 0 {
+		if err := p.Vm.Userwriten(offinn, 8, offin+did); err != 0 {
+			return int(err)
 		}
-		if err1 == 0 {
-			err1 = err2
+	}
+	if offoutn != 0 {
+		if err := p.Vm.Userwriten(offoutn, 8, offout+did); err != 0 {
+			return int(err)
 		}
-		return int(err1)
 	}
-	return 0
-}
-
-func _suspair(opts defs.Fdopt_t) (fdops.Fdops_i, fdops.Fdops_i, defs.Err_t) {
-	pipe1 := &pipe_t{}
-	pipe2 := &pipe_t{}
-	pipe1.pipe_start()
-	pipe2.pipe_start()
-
-	p1r := &pipefops_t{pipe: pipe1, options: opts}
-	p1w := &pipefops_t{pipe: pipe2, writer: true, options: opts}
-
-	p2r := &pipefops_t{pipe: pipe2, options: opts}
-	p2w := &pipefops_t{pipe: pipe1, writer: true, options: opts}
-
-	sfops1 := &susfops_t{pipein: p1r, pipeout: p1w, options: opts}
-	sfops2 := &susfops_t{pipein: p2r, pipeout: p2w, options: opts}
-	sfops1.conn, sfops2.conn = true, true
-	return sfops1, sfops2, 0
+	return did
 }
 
-func sys_shutdown(p *proc.Proc_t, fdn, how int) int {
-	fd, ok := p.Fd_get(fdn)
-	if !ok {
-		return int(-defs.EBADF)
+func sys_rename(p *proc.Proc_t, oldn int, newn int) int {
+	old, err1 := p.Vm.Userstr(oldn, fs.NAME_MAX)
+	new, err2 := p.Vm.Userstr(newn, fs.NAME_MAX)
+	if err1 != 0 {
+		return int(err1)
 	}
-	var rdone, wdone bool
-	if how&defs.SHUT_WR != 0 {
-		wdone = true
+	if err2 != 0 {
+		return int(err2)
 	}
-	if how&defs.SHUT_RD != 0 {
-		rdone = true
+	err1 = badpath(old)
+	err2 = badpath(new)
+	if err1 != 0 {
+		return int(err1)
 	}
-	return int(fd.Fops.Shutdown(rdone, wdone))
+	if err2 != 0 {
+		return int(err2)
+	}
+	err := thefs.Fs_rename(old, new, p.Cwd)
+	return int(err)
 }
 
-func sys_bind(p *proc.Proc_t, fdn, sockaddrn, socklen int) int {
-	fd, ok := p.Fd_get(fdn)
-	if !ok {
-		return int(-defs.EBADF)
+func sys_mkdir(p *proc.Proc_t, pathn int, mode int) int {
+	path, err := p.Vm.Userstr(pathn, fs.NAME_MAX)
+	if err != 0 {
+		return int(err)
 	}
-
-	sabuf, err := copysockaddr(p, sockaddrn, socklen)
+	err = badpath(path)
 	if err != 0 {
 		return int(err)
 	}
-	r := fd.Fops.Bind(sabuf)
-	return int(r)
+	err = thefs.Fs_mkdir(path, mode, p.Cwd)
+	return int(err)
 }
 
-type sudfops_t struct {
-	// this lock protects open and bound; bud has its own lock
-	sync.Mutex
-	bud   *bud_t
-	open  int
-	bound bool
+func sys_link(p *proc.Proc_t, oldn int, newn int) int {
+	old, err1 := p.Vm.Userstr(oldn, fs.NAME_MAX)
+	new, err2 := p.Vm.Userstr(newn, fs.NAME_MAX)
+	if err1 != 0 {
+		return int(err1)
+	}
+	if err2 != 0 {
+		return int(err2)
+	}
+	err1 = badpath(old)
+	err2 = badpath(new)
+	if err1 != 0 {
+		return int(err1)
+	}
+	if err2 != 0 {
+		return int(err2)
+	}
+	err := thefs.Fs_link(old, new, p.Cwd)
+	return int(err)
 }
 
-func (sf *sudfops_t) Close() defs.Err_t {
-	// XXX use new method
-	sf.Lock()
-	sf.open--
-	if sf.open < 0 {
-		panic("negative ref count")
+func sys_unlink(p *proc.Proc_t, pathn, isdiri int) int {
+	path, err := p.Vm.Userstr(pathn, fs.NAME_MAX)
+	if err != 0 {
+		return int(err)
 	}
-	term := sf.open == 0
-	if term {
-		if sf.bound {
-			sf.bud.bud_close()
-			sf.bound = false
-			sf.bud = nil
-		}
-		limits.Syslimit.Socks.Give()
+	err = badpath(path)
+	if err != 0 {
+		return int(err)
 	}
-	sf.Unlock()
-	return 0
+	wantdir := isdiri != 0
+	err = thefs.Fs_unlink(path, p.Cwd, wantdir)
+	return int(err)
 }
 
-func (sf *sudfops_t) Fstat(s *stat.Stat_t) defs.Err_t {
-	panic("no imp")
+func sys_gettimeofday(p *proc.Proc_t, timevaln int) int {
+	tvalsz := 16
+	now := time.Now()
+	buf := make([]uint8, tvalsz)
+	us := int(now.UnixNano() / 1000)
+	writen(buf, 8, 0, us/1e6)
+	writen(buf, 8, 8, us%1e6)
+	if err := p.Vm.K2user(buf, timevaln); err != 0 {
+		return int(err)
+	}
+	return 0
 }
 
-func (sf *sudfops_t) Mmapi(int, int, bool) ([]mem.Mmapinfo_t, defs.Err_t) {
-	return nil, -defs.EINVAL
-}
+var _rlimits = map[int]uint{defs.RLIMIT_NOFILE: defs.RLIM_INFINITY,
+	defs.RLIMIT_MEMLOCK: defs.RLIM_INFINITY,
+	defs.RLIMIT_RTPRIO: defs.SCHED_PRIOMAX}
 
-func (sf *sudfops_t) Pathi() defs.Inum_t {
-	panic("cwd socket?")
+func sys_getrlimit(p *proc.Proc_t, resn, rlpn int) int {
+	var cur uint
+	switch resn {
+	case defs.RLIMIT_NOFILE:
+		cur = p.Ulim.Nofile
+	case defs.RLIMIT_MEMLOCK:
+		cur = p.Ulim.Memlock
+	case defs.RLIMIT_RTPRIO:
+		cur = p.Ulim.Rtprio
+	default:
+		return int(-defs.EINVAL)
+	}
+	max := _rlimits[resn]
+	switch resn {
+	case defs.RLIMIT_MEMLOCK:
+		max = p.Ulim.Memlockmax
+	case defs.RLIMIT_RTPRIO:
+		max = p.Ulim.Rtpriomax
+	}
+	err1 := p.Vm.Userwriten(rlpn, 8, int(cur))
+	err2 := p.Vm.Userwriten(rlpn+8, 8, int(max))
+	if err1 != 0 {
+		return int(err1)
+	}
+	if err2 != 0 {
+		return int(err2)
+	}
+	return 0
 }
 
-func (sf *sudfops_t) Read(dst fdops.Userio_i) (int, defs.Err_t) {
-	return 0, -defs.EBADF
-}
-
-func (sf *sudfops_t) Reopen() defs.Err_t {
-	sf.Lock()
-	sf.open++
-	sf.Unlock()
+func sys_setrlimit(p *proc.Proc_t, resn, rlpn int) int {
+	// XXX root can raise max
+	_ncur, err := p.Vm.Userreadn(rlpn, 8)
+	if err != 0 {
+		return int(err)
+	}
+	_nmax, err := p.Vm.Userreadn(rlpn+8, 8)
+	if err != 0 {
+		return int(err)
+	}
+	ncur, nmax := uint(_ncur), uint(_nmax)
+	if ncur > _rlimits[resn] || ncur > nmax {
+		return int(-defs.EINVAL)
+	}
+	switch resn {
+	case defs.RLIMIT_NOFILE:
+		p.Ulim.Nofile = ncur
+	case defs.RLIMIT_MEMLOCK:
+		// locked pages cannot be evicted, thus only a privileged
+		// process may raise the hard limit
+		if nmax > p.Ulim.Memlockmax {
+			return int(-defs.EPERM)
+		}
+		// a lower limit does not unlock the mappings which are locked
+		p.Ulim.Memlock = ncur
+		p.Ulim.Memlockmax = nmax
+	case defs.RLIMIT_RTPRIO:
+		// realtime threads can starve the threads of other
+		// processes, thus the hard limit can only be lowered
+		if nmax > p.Ulim.Rtpriomax {
+			return int(-defs.EPERM)
+		}
+		p.Ulim.Rtprio = ncur
+		p.Ulim.Rtpriomax = nmax
+	default:
+		return int(-defs.EINVAL)
+	}
 	return 0
 }
 
-func (sf *sudfops_t) Write(fdops.Userio_i) (int, defs.Err_t) {
-	return 0, -defs.EBADF
-}
-
-func (sf *sudfops_t) Truncate(newlen uint) defs.Err_t {
-	return -defs.EINVAL
-}
-
-func (sf *sudfops_t) Pread(dst fdops.Userio_i, offset int) (int, defs.Err_t) {
-	return 0, -defs.ESPIPE
-}
-
-func (sf *sudfops_t) Pwrite(src fdops.Userio_i, offset int) (int, defs.Err_t) {
-	return 0, -defs.ESPIPE
-}
+func sys_getrusage(p *proc.Proc_t, who, rusagep int) int {
+	var ru []uint8
+	if who == defs.RUSAGE_SELF {
+		// threads add their user time whenever they enter the kernel
+		tmp := p.Atime
 
-func (sf *sudfops_t) Lseek(int, int) (int, defs.Err_t) {
-	return 0, -defs.ESPIPE
-}
+		p.Vm.Lock_pmap()
+		tmp.Maxrss = p.Vm.Rss.Maxkb()
+		p.Vm.Unlock_pmap()
 
-// trims trailing nulls from slice
-func slicetostr(buf []uint8) string {
-	end := 0
-	for i := range buf {
-		end = i
-		if buf[i] == 0 {
-			break
-		}
+		ru = tmp.To_rusage()
+	} else if who == defs.RUSAGE_CHILDREN {
+		ru = p.Catime.Fetch()
+	} else {
+		return int(-defs.EINVAL)
 	}
-	return string(buf[:end])
-}
-
-func (sf *sudfops_t) Accept(fdops.Userio_i) (fdops.Fdops_i, int, defs.Err_t) {
-	return nil, 0, -defs.EINVAL
+	if err := p.Vm.K2user(ru, rusagep); err != 0 {
+		return int(err)
+	}
+	return 0
 }
 
-func (sf *sudfops_t) Bind(sa []uint8) defs.Err_t {
-	sf.Lock()
-	defer sf.Unlock()
-
-	if sf.bound {
-		return -defs.EINVAL
+func sys_mknod(p *proc.Proc_t, pathn, moden, devn int) int {
+	path, err := p.Vm.Userstr(pathn, fs.NAME_MAX)
+	if err != 0 {
+		return int(err)
 	}
 
-	poff := 2
-	path := ustr.MkUstrSlice(sa[poff:])
-	// try to create the specified file as a special device
-	bid := allbuds.bud_id_new()
-	fsf, err := thefs.Fs_open_inner(path, defs.O_CREAT|defs.O_EXCL, 0, proc.CurrentProc().Cwd, defs.D_SUD, int(bid))
+	err = badpath(path)
 	if err != 0 {
-		return err
+		return int(err)
+	}
+	maj, min := defs.Unmkdev(uint(devn))
+	fsf, err := thefs.Fs_open_inner(path, defs.O_CREAT, 0, p.Cwd, maj, min)
+	if err != 0 {
+		return int(err)
 	}
-	inum := fsf.Inum
-	bud := allbuds.bud_new(bid, path, inum)
 	if thefs.Fs_close(fsf.Inum) != 0 {
 		panic("must succeed")
 	}
-	sf.bud = bud
-	sf.bound = true
 	return 0
 }
 
-func (sf *sudfops_t) Connect(sabuf []uint8) defs.Err_t {
-	return -defs.EINVAL
+func sys_sync(p *proc.Proc_t) int {
+	return int(thefs.Fs_sync())
 }
 
-func (sf *sudfops_t) Listen(backlog int) (fdops.Fdops_i, defs.Err_t) {
-	return nil, -defs.EINVAL
+// the active swap area, if any
+var swaparea struct {
+	sync.Mutex
+	sa *fs.Swaparea_t
 }
 
-func (sf *sudfops_t) Sendmsg(src fdops.Userio_i, sa []uint8,
-	cmsg []uint8, flags int) (int, defs.Err_t) {
-	if len(cmsg) != 0 || flags != 0 {
-		panic("no imp")
+// starts paging anonymous memory to the raw disk or regular file at pathn. off
+// and len select the region in bytes; a len of zero means the whole file.
+func sys_swapon(p *proc.Proc_t, pathn, off, len int) int {
+	path, err := p.Vm.Userstr(pathn, fs.NAME_MAX)
+	if err != 0 {
+		return int(err)
 	}
-	poff := 2
-	if len(sa) <= poff {
-		return 0, -defs.EINVAL
+	swaparea.Lock()
+	defer swaparea.Unlock()
+	if swaparea.sa != nil {
+		return int(-defs.EBUSY)
 	}
-	st := &stat.Stat_t{}
-	path := ustr.MkUstrSlice(sa[poff:])
-
-	err := thefs.Fs_stat(path, st, proc.CurrentProc().Cwd)
+	sa, err := thefs.Fs_swapon(path, off, len, p.Cwd)
 	if err != 0 {
-		return 0, err
+		return int(err)
 	}
-	maj, min := defs.Unmkdev(st.Rdev())
-	if maj != defs.D_SUD {
-		return 0, -defs.ECONNREFUSED
+	if err := vm.Swapon(sa); err != 0 {
+		sa.Swapoff()
+		return int(err)
 	}
-	ino := st.Rino()
+	swaparea.sa = sa
+	return 0
+}
 
-	bid := budid_t(min)
-	bud, ok := allbuds.bud_lookup(bid, defs.Inum_t(ino))
-	if !ok {
-		return 0, -defs.ECONNREFUSED
+// swaps in all pages and stops using the swap area at pathn
+func sys_swapoff(p *proc.Proc_t, pathn int) int {
+	path, err := p.Vm.Userstr(pathn, fs.NAME_MAX)
+	if err != 0 {
+		return int(err)
 	}
-
-	var bp ustr.Ustr
-	sf.Lock()
-	if sf.bound {
-		bp = sf.bud.bpath
+	swaparea.Lock()
+	defer swaparea.Unlock()
+	if swaparea.sa == nil || !swaparea.sa.Is(path, p.Cwd) {
+		return int(-defs.EINVAL)
 	}
-	sf.Unlock()
-
-	did, err := bud.bud_in(src, bp, cmsg)
-	if err != 0 {
-		return 0, err
+	if err := vm.Swapoff(); err != 0 {
+		return int(err)
 	}
-	return did, 0
+	swaparea.sa = nil
+	return 0
 }
 
-func (sf *sudfops_t) Recvmsg(dst fdops.Userio_i,
-	fromsa fdops.Userio_i, cmsg fdops.Userio_i, flags int) (int, int, int, defs.Msgfl_t, defs.Err_t) {
-	if cmsg.Totalsz() != 0 || flags != 0 {
-		panic("no imp")
-	}
-
-	sf.Lock()
-	defer sf.Unlock()
-
-	// XXX what is recv'ing on an unbound unix datagram socket supposed to
-	// do? openbsd and linux seem to block forever.
-	if !sf.bound {
-		return 0, 0, 0, 0, -defs.ECONNREFUSED
-	}
-	bud := sf.bud
+func sys_reboot(p *proc.Proc_t) int {
+	// mov'ing to cr3 does not flush global pages. if, before loading the
+	// zero page into cr3 below, there are just enough TLB entries to
+	// dispatch a fault, but not enough to complete the fault handler, the
+	// fault handler will recursively fault forever since it uses an IST
+	// stack. therefore, flush the global pages too.
+	pge := uintptr(1 << 7)
+	runtime.Lcr4(runtime.Rcr4() &^ pge)
+	// who needs ACPI?
+	runtime.Lcr3(uintptr(mem.P_zeropg))
+	// poof
+	fmt.Printf("what?\n")
+	return 0
+}
 
-	datadid, addrdid, ancdid, msgfl, err := bud.bud_out(dst, fromsa, cmsg)
+func sys_nanosleep(p *proc.Proc_t, sleeptsn, remaintsn int) int {
+	tot, _, err := p.Vm.Usertimespec(sleeptsn)
 	if err != 0 {
-		return 0, 0, 0, 0, err
+		return int(err)
 	}
-	return datadid, addrdid, ancdid, msgfl, 0
-}
-
-func (sf *sudfops_t) Pollone(pm fdops.Pollmsg_t) (fdops.Ready_t, defs.Err_t) {
-	sf.Lock()
-	defer sf.Unlock()
-
-	if !sf.bound {
-		return pm.Events & fdops.R_ERROR, 0
+	tochan := time.After(tot)
+	kn := &tinfo.Current().Killnaps
+	select {
+	case <-tochan:
+		return 0
+	case <-kn.Killch:
+		if kn.Kerr == 0 {
+			panic("no")
+		}
+		return int(kn.Kerr)
 	}
-	r, err := sf.bud.bud_poll(pm)
-	return r, err
 }
 
-func (sf *sudfops_t) Fcntl(cmd, opt int) int {
-	return int(-defs.ENOSYS)
+func sys_getpid(p *proc.Proc_t, tid defs.Tid_t) int {
+	return p.Pid
 }
 
-func (sf *sudfops_t) Getsockopt(opt int, bufarg fdops.Userio_i,
-	intarg int) (int, defs.Err_t) {
-	return 0, -defs.EOPNOTSUPP
+func sys_getppid(p *proc.Proc_t, tid defs.Tid_t) int {
+	return p.Pwait.Pid
 }
 
-func (sf *sudfops_t) Setsockopt(int, int, fdops.Userio_i, int) defs.Err_t {
-	return -defs.EOPNOTSUPP
-}
+func sys_socket(p *proc.Proc_t, domain, typ, proto int) int {
+	var opts defs.Fdopt_t
+	if typ&defs.SOCK_NONBLOCK != 0 {
+		opts |= defs.O_NONBLOCK
+	}
+	var clop int
+	if typ&defs.SOCK_CLOEXEC != 0 {
+		clop = fd.FD_CLOEXEC
+	}
 
-func (sf *sudfops_t) Shutdown(read, write bool) defs.Err_t {
-	return -defs.ENOTSOCK
+	var sfops fdops.Fdops_i
+	switch {
+	case domain == defs.AF_UNIX && typ&defs.SOCK_DGRAM != 0:
+		if opts != 0 {
+			panic("no imp")
+		}
+		sfops = &sudfops_t{open: 1}
+	case domain == defs.AF_UNIX && typ&defs.SOCK_STREAM != 0:
+		sfops = &susfops_t{options: opts}
+	case domain == defs.AF_INET && typ&defs.SOCK_STREAM != 0:
+		tfops := &bnet.Tcpfops_t{}
+		tfops.Set(&bnet.Tcptcb_t{}, opts)
+		sfops = tfops
+	default:
+		return int(-defs.EINVAL)
+	}
+	if !limits.Syslimit.Socks.Take() {
+		lhits++
+		return int(-defs.ENOMEM)
+	}
+	file := &fd.Fd_t{}
+	file.Fops = sfops
+	fdn, ok := p.Fd_insert(file, fd.FD_READ|fd.FD_WRITE|clop)
+	if !ok {
+		fd.Close_panic(file)
+		limits.Syslimit.Socks.Give()
+		return int(-defs.EMFILE)
+	}
+	return fdn
 }
 
-type budid_t int
-
-var allbuds = allbud_t{m: make(map[budkey_t]*bud_t)}
-
-// buds are indexed by bid and inode number in order to detect stale socket
-// files that happen to have the same bid.
-type budkey_t struct {
-	bid  budid_t
-	priv defs.Inum_t
-}
-
-type allbud_t struct {
-	// leaf lock
-	sync.Mutex
-	m       map[budkey_t]*bud_t
-	nextbid budid_t
-}
-
-func (ab *allbud_t) bud_lookup(bid budid_t, fpriv defs.Inum_t) (*bud_t, bool) {
-	key := budkey_t{bid, fpriv}
-
-	ab.Lock()
-	bud, ok := ab.m[key]
-	ab.Unlock()
-
-	return bud, ok
-}
+func sys_connect(p *proc.Proc_t, fdn, sockaddrn, socklen int) int {
+	fd, ok := p.Fd_get(fdn)
+	if !ok {
+		return int(-defs.EBADF)
+	}
 
-func (ab *allbud_t) bud_id_new() budid_t {
-	ab.Lock()
-	ret := ab.nextbid
-	ab.nextbid++
-	ab.Unlock()
-	return ret
+	// copy sockaddr to kernel space to avoid races
+	sabuf, err := copysockaddr(p, sockaddrn, socklen)
+	if err != 0 {
+		return int(err)
+	}
+	err = fd.Fops.Connect(sabuf)
+	return int(err)
 }
 
-func (ab *allbud_t) bud_new(bid budid_t, budpath ustr.Ustr, fpriv defs.Inum_t) *bud_t {
-	ret := &bud_t{}
-	ret.bud_init(bid, budpath, fpriv)
-
-	key := budkey_t{bid, fpriv}
-	ab.Lock()
-	if _, ok := ab.m[key]; ok {
-		panic("bud exists")
+func sys_accept(p *proc.Proc_t, fdn, sockaddrn, socklenn int) int {
+	f, ok := p.Fd_get(fdn)
+	if !ok {
+		return int(-defs.EBADF)
+	}
+	var sl int
+	if socklenn != 0 {
+		l, err := p.Vm.Userreadn(socklenn, 8)
+		if err != 0 {
+			return int(err)
+		}
+		if l < 0 {
+			return int(-defs.EFAULT)
+		}
+		sl = l
+	}
+	fromsa := p.Vm.Mkuserbuf(sockaddrn, sl)
+	newfops, fromlen, err := f.Fops.Accept(fromsa)
+	//proc.Ubpool.Put(fromsa)
+	if err != 0 {
+		return int(err)
+	}
+	if fromlen != 0 {
+		if err := p.Vm.Userwriten(socklenn, 8, fromlen); err != 0 {
+			return int(err)
+		}
+	}
+	newfd := &fd.Fd_t{Fops: newfops}
+	ret, ok := p.Fd_insert(newfd, fd.FD_READ|fd.FD_WRITE)
+	if !ok {
+		fd.Close_panic(newfd)
+		return int(-defs.EMFILE)
 	}
-	ab.m[key] = ret
-	ab.Unlock()
 	return ret
 }
 
-func (ab *allbud_t) bud_del(bid budid_t, fpriv defs.Inum_t) {
-	key := budkey_t{bid, fpriv}
-	ab.Lock()
-	if _, ok := ab.m[key]; !ok {
-		panic("no such bud")
+func copysockaddr(p *proc.Proc_t, san, sl int) ([]uint8, defs.Err_t) {
+	if sl == 0 {
+		return nil, 0
 	}
-	delete(ab.m, key)
-	ab.Unlock()
-}
-
-type dgram_t struct {
-	from ustr.Ustr
-	sz   int
+	if sl < 0 {
+		return nil, -defs.EFAULT
+	}
+	maxsl := 256
+	if sl >= maxsl {
+		return nil, -defs.ENOTSOCK
+	}
+	ub := p.Vm.Mkuserbuf(san, sl)
+	sabuf := make([]uint8, sl)
+	_, err := ub.Uioread(sabuf)
+	//proc.Ubpool.Put(ub)
+	if err != 0 {
+		return nil, err
+	}
+	return sabuf, 0
 }
 
-// a circular buffer for datagrams and their source addresses
-type dgrambuf_t struct {
-	cbuf   circbuf.Circbuf_t
-	dgrams []dgram_t
-	// add dgrams at head, remove from tail
-	head uint
-	tail uint
-}
+func sys_sendto(p *proc.Proc_t, fdn, bufn, flaglen, sockaddrn, socklen int) int {
+	fd, err := _fd_write(p, fdn)
+	if err != 0 {
+		return int(err)
+	}
+	flags := int(uint(uint32(flaglen)))
+	if flags != 0 {
+		panic("no imp")
+	}
+	buflen := int(uint(flaglen) >> 32)
+	if buflen < 0 {
+		return int(-defs.EFAULT)
+	}
 
-func (db *dgrambuf_t) dg_init(sz int) {
-	db.cbuf.Cb_init(sz, mem.Physmem)
-	// assume that messages are at least 10 bytes
-	db.dgrams = make([]dgram_t, sz/10)
-	db.head, db.tail = 0, 0
-}
+	// copy sockaddr to kernel space to avoid races
+	sabuf, err := copysockaddr(p, sockaddrn, socklen)
+	if err != 0 {
+		return int(err)
+	}
 
-// returns true if there is enough buffers to hold a datagram of size sz
-func (db *dgrambuf_t) _canhold(sz int) bool {
-	if (db.head-db.tail) == uint(len(db.dgrams)) ||
-		db.cbuf.Left() < sz {
-		return false
+	buf := p.Vm.Mkuserbuf(bufn, buflen)
+	ret, err := fd.Fops.Sendmsg(buf, sabuf, nil, flags)
+	//proc.Ubpool.Put(buf)
+	if err != 0 {
+		return int(err)
 	}
-	return true
+	return ret
 }
 
-func (db *dgrambuf_t) _havedgram() bool {
-	return db.head != db.tail
-}
+func sys_recvfrom(p *proc.Proc_t, fdn, bufn, flaglen, sockaddrn,
+	socklenn int) int {
+	fd, err := _fd_read(p, fdn)
+	if err != 0 {
+		return int(err)
+	}
+	flags := uint(uint32(flaglen))
+	if flags != 0 {
+		panic("no imp")
+	}
+	buflen := int(uint(flaglen) >> 32)
+	buf := p.Vm.Mkuserbuf(bufn, buflen)
 
-func (db *dgrambuf_t) copyin(src fdops.Userio_i, from ustr.Ustr) (int, defs.Err_t) {
-	// is there a free source address slot and buffer space?
-	if !db._canhold(src.Totalsz()) {
-		panic("should have blocked")
+	// is the from address requested?
+	var salen int
+	if socklenn != 0 {
+		l, err := p.Vm.Userreadn(socklenn, 8)
+		if err != 0 {
+			return int(err)
+		}
+		salen = l
+		if salen < 0 {
+			return int(-defs.EFAULT)
+		}
 	}
-	did, err := db.cbuf.Copyin(src)
+	fromsa := p.Vm.Mkuserbuf(sockaddrn, salen)
+	ret, addrlen, _, _, err := fd.Fops.Recvmsg(buf, fromsa, zeroubuf, 0)
+	//proc.Ubpool.Put(buf)
+	//proc.Ubpool.Put(fromsa)
 	if err != 0 {
-		return 0, err
+		return int(err)
 	}
-	slot := &db.dgrams[db.head%uint(len(db.dgrams))]
-	db.head++
-	slot.from = from
-	slot.sz = did
-	return did, 0
+	// write new socket size to user space
+	if addrlen > 0 {
+		if err := p.Vm.Userwriten(socklenn, 8, addrlen); err != 0 {
+			return int(err)
+		}
+	}
+	return ret
 }
 
-func (db *dgrambuf_t) copyout(dst, fromsa, cmsg fdops.Userio_i) (int, int, defs.Err_t) {
-	if cmsg.Totalsz() != 0 {
+func sys_recvmsg(p *proc.Proc_t, fdn, _msgn, _flags int) int {
+	if _flags != 0 {
 		panic("no imp")
 	}
-	if db.head == db.tail {
-		panic("should have blocked")
+	fd, err := _fd_read(p, fdn)
+	if err != 0 {
+		return int(err)
 	}
-	slot := &db.dgrams[db.tail%uint(len(db.dgrams))]
-	sz := slot.sz
-	if sz == 0 {
-		panic("huh?")
+	// maybe copy the msghdr to kernel space?
+	msgn := uint(_msgn)
+	iovn, err1 := p.Vm.Userreadn(int(msgn+2*8), 8)
+	niov, err2 := p.Vm.Userreadn(int(msgn+3*8), 4)
+	cmsgl, err3 := p.Vm.Userreadn(int(msgn+5*8), 8)
+	salen, err4 := p.Vm.Userreadn(int(msgn+1*8), 8)
+	if err1 != 0 {
+		return int(err1)
 	}
-	var fdid int
-	if fromsa.Totalsz() != 0 {
-		fsaddr := _sockaddr_un(slot.from)
-		var err defs.Err_t
-		fdid, err = fromsa.Uiowrite(fsaddr)
-		if err != 0 {
-			return 0, 0, err
-		}
+	if err2 != 0 {
+		return int(err2)
 	}
-	did, err := db.cbuf.Copyout_n(dst, sz)
-	if err != 0 {
-		return 0, 0, err
+	if err3 != 0 {
+		return int(err3)
+	}
+	if err4 != 0 {
+		return int(err4)
 	}
-	// commit tail
-	db.tail++
-	return did, fdid, 0
-}
-
-func (db *dgrambuf_t) dg_release() {
-	db.cbuf.Cb_release()
-}
 
-// convert bound socket path to struct sockaddr_un
-func _sockaddr_un(budpath ustr.Ustr) []uint8 {
-	ret := make([]uint8, 2, 16)
-	// len
-	writen(ret, 1, 0, len(budpath))
-	// family
-	writen(ret, 1, 1, defs.AF_UNIX)
-	// path
-	ret = append(ret, budpath...)
-	ret = append(ret, 0)
-	return ret
-}
-
-// a type for bound UNIX datagram sockets
-type bud_t struct {
-	sync.Mutex
-	bid     budid_t
-	fpriv   defs.Inum_t
-	dbuf    dgrambuf_t
-	pollers fdops.Pollers_t
-	cond    *sync.Cond
-	closed  bool
-	bpath   ustr.Ustr
-}
-
-func (bud *bud_t) bud_init(bid budid_t, bpath ustr.Ustr, priv defs.Inum_t) {
-	bud.bid = bid
-	bud.fpriv = priv
-	bud.bpath = bpath
-	bud.dbuf.dg_init(512)
-	bud.cond = sync.NewCond(bud)
-}
-
-func (bud *bud_t) _rready() {
-	bud.cond.Broadcast()
-	bud.pollers.Wakeready(fdops.R_READ)
-}
+	var saddr fdops.Userio_i
+	saddr = zeroubuf
+	if salen > 0 {
+		saddrn, err := p.Vm.Userreadn(int(msgn+0*8), 8)
+		if err != 0 {
+			return int(err)
+		}
+		ub := p.Vm.Mkuserbuf(saddrn, salen)
+		saddr = ub
+	}
+	var cmsg fdops.Userio_i
+	cmsg = zeroubuf
+	if cmsgl > 0 {
+		cmsgn, err := p.Vm.Userreadn(int(msgn+4*8), 8)
+		if err != 0 {
+			return int(err)
+		}
+		ub := p.Vm.Mkuserbuf(cmsgn, cmsgl)
+		cmsg = ub
+	}
 
-func (bud *bud_t) _wready() {
-	bud.cond.Broadcast()
-	bud.pollers.Wakeready(fdops.R_WRITE)
-}
+	iov := &vm.Useriovec_t{}
+	err = iov.Iov_init(p.Vm, uint(iovn), niov)
+	if err != 0 {
+		return int(err)
+	}
 
-// returns number of bytes written and error
-func (bud *bud_t) bud_in(src fdops.Userio_i, from ustr.Ustr, cmsg []uint8) (int, defs.Err_t) {
-	if len(cmsg) != 0 {
-		panic("no imp")
+	ret, sawr, cmwr, msgfl, err := fd.Fops.Recvmsg(iov, saddr,
+		cmsg, 0)
+	if err != 0 {
+		return int(err)
 	}
-	need := src.Totalsz()
-	bud.Lock()
-	for {
-		if bud.closed {
-			bud.Unlock()
-			return 0, -defs.EBADF
-		}
-		if bud.dbuf._canhold(need) || bud.closed {
-			break
+	// write size of socket address, ancillary data, and msg flags back to
+	// user space
+	if err := p.Vm.Userwriten(int(msgn+28), 4, int(msgfl)); err != 0 {
+		return int(err)
+	}
+	if saddr.Totalsz() != 0 {
+		if err := p.Vm.Userwriten(int(msgn+1*8), 8, sawr); err != 0 {
+			return int(err)
 		}
-		if err := proc.KillableWait(bud.cond); err != 0 {
-			bud.Unlock()
-			return 0, err
+	}
+	if cmsg.Totalsz() != 0 {
+		if err := p.Vm.Userwriten(int(msgn+5*8), 8, cmwr); err != 0 {
+			return int(err)
 		}
 	}
-	did, err := bud.dbuf.copyin(src, from)
-	bud._rready()
-	bud.Unlock()
-	return did, err
+	return ret
 }
 
-// returns number of bytes written of data, socket address, ancillary data, and
-// ancillary message flags...
-func (bud *bud_t) bud_out(dst, fromsa, cmsg fdops.Userio_i) (int, int, int,
-	defs.Msgfl_t, defs.Err_t) {
-	if cmsg.Totalsz() != 0 {
+func sys_sendmsg(p *proc.Proc_t, fdn, _msgn, _flags int) int {
+	if _flags != 0 {
 		panic("no imp")
 	}
-	bud.Lock()
-	for {
-		if bud.closed {
-			bud.Unlock()
-			return 0, 0, 0, 0, -defs.EBADF
+	fd, err := _fd_write(p, fdn)
+	if err != 0 {
+		return int(err)
+	}
+	// maybe copy the msghdr to kernel space?
+	msgn := uint(_msgn)
+	iovn, err1 := p.Vm.Userreadn(int(msgn+2*8), 8)
+	niov, err2 := p.Vm.Userreadn(int(msgn+3*8), 8)
+	cmsgl, err3 := p.Vm.Userreadn(int(msgn+5*8), 8)
+	salen, err4 := p.Vm.Userreadn(int(msgn+1*8), 8)
+	if err1 != 0 {
+		return int(err1)
+	}
+	if err2 != 0 {
+		return int(err2)
+	}
+	if err3 != 0 {
+		return int(err3)
+	}
+	if err4 != 0 {
+		return int(err4)
+	}
+
+	// copy to address and ancillary data to kernel space
+	var saddr []uint8
+	if salen > 0 {
+		if salen > 64 {
+			return int(-defs.EINVAL)
 		}
-		if bud.dbuf._havedgram() {
-			break
+		saddrva, err := p.Vm.Userreadn(int(msgn+0*8), 8)
+		if err != 0 {
+			return int(err)
 		}
-		if err := proc.KillableWait(bud.cond); err != 0 {
-			bud.Unlock()
-			return 0, 0, 0, 0, err
+		saddr = make([]uint8, salen)
+		ub := p.Vm.Mkuserbuf(saddrva, salen)
+		did, err := ub.Uioread(saddr)
+		if err != 0 {
+			return int(err)
+		}
+		if did != salen {
+			panic("how")
 		}
 	}
-	ddid, fdid, err := bud.dbuf.copyout(dst, fromsa, cmsg)
-	bud._wready()
-	bud.Unlock()
-	return ddid, fdid, 0, 0, err
-}
-
-func (bud *bud_t) bud_poll(pm fdops.Pollmsg_t) (fdops.Ready_t, defs.Err_t) {
-	var ret fdops.Ready_t
-	var err defs.Err_t
-	bud.Lock()
-	if bud.closed {
-		goto out
-	}
-	if pm.Events&fdops.R_READ != 0 && bud.dbuf._havedgram() {
-		ret |= fdops.R_READ
+	var cmsg []uint8
+	if cmsgl > 0 {
+		if cmsgl > 256 {
+			return int(-defs.EINVAL)
+		}
+		cmsgva, err := p.Vm.Userreadn(int(msgn+4*8), 8)
+		if err != 0 {
+			return int(err)
+		}
+		cmsg = make([]uint8, cmsgl)
+		ub := p.Vm.Mkuserbuf(cmsgva, cmsgl)
+		did, err := ub.Uioread(cmsg)
+		if err != 0 {
+			return int(err)
+		}
+		if did != cmsgl {
+			panic("how")
+		}
 	}
-	if pm.Events&fdops.R_WRITE != 0 && bud.dbuf._canhold(32) {
-		ret |= fdops.R_WRITE
+	iov := &vm.Useriovec_t{}
+	err = iov.Iov_init(p.Vm, uint(iovn), niov)
+	if err != 0 {
+		return int(err)
 	}
-	if ret == 0 && pm.Dowait {
-		err = bud.pollers.Addpoller(&pm)
+	ret, err := fd.Fops.Sendmsg(iov, saddr, cmsg, 0)
+	if err != 0 {
+		return int(err)
 	}
-out:
-	bud.Unlock()
-	return ret, err
-}
-
-// the bud is closed; wake up any waiting threads
-func (bud *bud_t) bud_close() {
-	bud.Lock()
-	bud.closed = true
-	bud.cond.Broadcast()
-	bud.pollers.Wakeready(fdops.R_READ | fdops.R_WRITE | fdops.R_ERROR)
-	bid := bud.bid
-	fpriv := bud.fpriv
-	bud.dbuf.dg_release()
-	bud.Unlock()
-
-	allbuds.bud_del(bid, fpriv)
-}
-
-type susfops_t struct {
-	pipein  *pipefops_t
-	pipeout *pipefops_t
-	bl      sync.Mutex
-	conn    bool
-	bound   bool
-	lstn    bool
-	myaddr  ustr.Ustr
-	mysid   int
-	options defs.Fdopt_t
+	return ret
 }
 
-func (sus *susfops_t) Close() defs.Err_t {
-	if !sus.conn {
-		return 0
+func sys_socketpair(p *proc.Proc_t, domain, typ, proto int, sockn int) int {
+	var opts defs.Fdopt_t
+	if typ&defs.SOCK_NONBLOCK != 0 {
+		opts |= defs.O_NONBLOCK
 	}
-	err1 := sus.pipein.Close()
-	err2 := sus.pipeout.Close()
-	if err1 != 0 {
-		return err1
+	var clop int
+	if typ&defs.SOCK_CLOEXEC != 0 {
+		clop = fd.FD_CLOEXEC
 	}
-	// XXX
-	sus.pipein.pipe.Lock()
-	term := sus.pipein.pipe.closed
-	sus.pipein.pipe.Unlock()
-	if term {
-		limits.Syslimit.Socks.Give()
+
+	mask := defs.SOCK_STREAM | defs.SOCK_DGRAM
+	if typ&mask == 0 || typ&mask == mask {
+		return int(-defs.EINVAL)
 	}
-	return err2
-}
 
-func (sus *susfops_t) Fstat(*stat.Stat_t) defs.Err_t {
-	panic("no imp")
+	if !limits.Syslimit.Socks.Take() {
+		return int(-defs.ENOMEM)
+	}
+
+	var sfops1, sfops2 fdops.Fdops_i
+	var err defs.Err_t
+	switch {
+	case domain == defs.AF_UNIX && typ&defs.SOCK_STREAM != 0:
+		sfops1, sfops2, err = _suspair(opts)
+	default:
+		panic("no imp")
+	}
+
+	if err != 0 {
+		limits.Syslimit.Socks.Give()
+		return int(err)
+	}
+
+	fd1 := &fd.Fd_t{}
+	fd1.Fops = sfops1
+	fd2 := &fd.Fd_t{}
+	fd2.Fops = sfops2
+	perms := fd.FD_READ | fd.FD_WRITE | clop
+	fdn1, fdn2, ok := p.Fd_insert2(fd1, perms, fd2, perms)
+	if !ok {
+		fd.Close_panic(fd1)
+		fd.Close_panic(fd2)
+		return int(-defs.EMFILE)
+	}
+	if err1, err2 := p.Vm.Userwriten(sockn, 4, fdn1), p.Vm.Userwriten(sockn+4, 4, fdn2); err1 != 0 || err2 != 0 {
+		if sys.Sys_close(p, fdn1) != 0 || sys.Sys_close(p, fdn2) != 0 {
+			panic("must succeed")
+		}
+		if err1 == 0 {
+			err1 = err2
+		}
+		return int(err1)
+	}
+	return 0
 }
 
-func (sus *susfops_t) Lseek(int, int) (int, defs.Err_t) {
-	return 0, -defs.ESPIPE
+func _suspair(opts defs.Fdopt_t) (fdops.Fdops_i, fdops.Fdops_i, defs.Err_t) {
+	pipe1 := &pipe_t{}
+	pipe2 := &pipe_t{}
+	pipe1.pipe_start()
+	pipe2.pipe_start()
+
+	p1r := &pipefops_t{pipe: pipe1, options: opts}
+	p1w := &pipefops_t{pipe: pipe2, writer: true, options: opts}
+
+	p2r := &pipefops_t{pipe: pipe2, options: opts}
+	p2w := &pipefops_t{pipe: pipe1, writer: true, options: opts}
+
+	sfops1 := &susfops_t{pipein: p1r, pipeout: p1w, options: opts}
+	sfops2 := &susfops_t{pipein: p2r, pipeout: p2w, options: opts}
+	sfops1.conn, sfops2.conn = true, true
+	return sfops1, sfops2, 0
 }
 
-func (sus *susfops_t) Mmapi(int, int, bool) ([]mem.Mmapinfo_t, defs.Err_t) {
-	return nil, -defs.ENODEV
+func sys_shutdown(p *proc.Proc_t, fdn, how int) int {
+	fd, ok := p.Fd_get(fdn)
+	if !ok {
+		return int(-defs.EBADF)
+	}
+	var rdone, wdone bool
+	if how&defs.SHUT_WR != 0 {
+		wdone = true
+	}
+	if how&defs.SHUT_RD != 0 {
+		rdone = true
+	}
+	return int(fd.Fops.Shutdown(rdone, wdone))
 }
 
-func (sus *susfops_t) Pathi() defs.Inum_t {
-	panic("unix stream cwd?")
+func sys_bind(p *proc.Proc_t, fdn, sockaddrn, socklen int) int {
+	fd, ok := p.Fd_get(fdn)
+	if !ok {
+		return int(-defs.EBADF)
+	}
+
+	sabuf, err := copysockaddr(p, sockaddrn, socklen)
+	if err != 0 {
+		return int(err)
+	}
+	r := fd.Fops.Bind(sabuf)
+	return int(r)
 }
 
-func (sus *susfops_t) Read(dst fdops.Userio_i) (int, defs.Err_t) {
-	read, _, _, _, err := sus.Recvmsg(dst, zeroubuf, zeroubuf, 0)
-	return read, err
+type sudfops_t struct {
+	// this lock protects open and bound; bud has its own lock
+	sync.Mutex
+	bud   *bud_t
+	open  int
+	bound bool
 }
 
-func (sus *susfops_t) Reopen() defs.Err_t {
-	if !sus.conn {
-		return 0
+func (sf *sudfops_t) Close() defs.Err_t {
+	// XXX use new method
+	sf.Lock()
+	sf.open--
+	if sf.open < 0 {
+		panic("negative ref count")
 	}
-	err1 := sus.pipein.Reopen()
-	err2 := sus.pipeout.Reopen()
-	if err1 != 0 {
-		return err1
+	term := sf.open == 0
+	if term {
+		if sf.bound {
+			sf.bud.bud_close()
+			sf.bound = false
+			sf.bud = nil
+		}
+		limits.Syslimit.Socks.Give()
 	}
-	return err2
+	sf.Unlock()
+	return 0
 }
 
-func (sus *susfops_t) Write(src fdops.Userio_i) (int, defs.Err_t) {
-	wrote, err := sus.Sendmsg(src, nil, nil, 0)
-	if err == -defs.EPIPE {
-		err = -defs.ECONNRESET
-	}
-	return wrote, err
+func (sf *sudfops_t) Fstat(s *stat.Stat_t) defs.Err_t {
+	panic("no imp")
 }
 
-func (sus *susfops_t) Truncate(newlen uint) defs.Err_t {
+func (sf *sudfops_t) Mmapi(int, int, bool) ([]mem.Mmapinfo_t, defs.Err_t) {
+	return nil, -defs.EINVAL
+}
+
+func (sf *sudfops_t) Pathi() defs.Inum_t {
+	panic("cwd socket?")
+}
+
+func (sf *sudfops_t) Read(dst fdops.Userio_i) (int, defs.Err_t) {
+	return 0, -defs.EBADF
+}
+
+func (sf *sudfops_t) Reopen() defs.Err_t {
+	sf.Lock()
+	sf.open++
+	sf.Unlock()
+	return 0
+}
+
+func (sf *sudfops_t) Write(fdops.Userio_i) (int, defs.Err_t) {
+	return 0, -defs.EBADF
+}
+
+func (sf *sudfops_t) Truncate(newlen uint) defs.Err_t {
 	return -defs.EINVAL
 }
 
-func (sus *susfops_t) Pread(dst fdops.Userio_i, offset int) (int, defs.Err_t) {
+func (sf *sudfops_t) Pread(dst fdops.Userio_i, offset int) (int, defs.Err_t) {
 	return 0, -defs.ESPIPE
 }
 
-func (sus *susfops_t) Pwrite(src fdops.Userio_i, offset int) (int, defs.Err_t) {
+func (sf *sudfops_t) Pwrite(src fdops.Userio_i, offset int) (int, defs.Err_t) {
 	return 0, -defs.ESPIPE
 }
 
-func (sus *susfops_t) Accept(fdops.Userio_i) (fdops.Fdops_i, int, defs.Err_t) {
+func (sf *sudfops_t) Lseek(int, int) (int, defs.Err_t) {
+	return 0, -defs.ESPIPE
+}
+
+// trims trailing nulls from slice
+func slicetostr(buf []uint8) string {
+	end := 0
+	for i := range buf {
+		end = i
+		if buf[i] == 0 {
+			break
+		}
+	}
+	return string(buf[:end])
+}
+
+func (sf *sudfops_t) Accept(fdops.Userio_i) (fdops.Fdops_i, int, defs.Err_t) {
 	return nil, 0, -defs.EINVAL
 }
 
-func (sus *susfops_t) Bind(saddr []uint8) defs.Err_t {
-	sus.bl.Lock()
-	defer sus.bl.Unlock()
+func (sf *sudfops_t) Bind(sa []uint8) defs.Err_t {
+	sf.Lock()
+	defer sf.Unlock()
 
-	if sus.bound {
+	if sf.bound {
 		return -defs.EINVAL
 	}
-	poff := 2
-	path := ustr.MkUstrSlice(saddr[poff:])
-	sid := susid_new()
 
-	// create special file
-	fsf, err := thefs.Fs_open_inner(path, defs.O_CREAT|defs.O_EXCL, 0, proc.CurrentProc().Cwd, defs.D_SUS, sid)
+	poff := 2
+	path := ustr.MkUstrSlice(sa[poff:])
+	// try to create the specified file as a special device
+	bid := allbuds.bud_id_new()
+	fsf, err := thefs.Fs_open_inner(path, defs.O_CREAT|defs.O_EXCL, 0, proc.CurrentProc().Cwd, defs.D_SUD, int(bid))
 	if err != 0 {
 		return err
 	}
+	inum := fsf.Inum
+	bud := allbuds.bud_new(bid, path, inum)
 	if thefs.Fs_close(fsf.Inum) != 0 {
 		panic("must succeed")
 	}
-	sus.myaddr = path
-	sus.mysid = sid
-	sus.bound = true
+	sf.bud = bud
+	sf.bound = true
 	return 0
 }
 
-func (sus *susfops_t) Connect(saddr []uint8) defs.Err_t {
-	sus.bl.Lock()
-	defer sus.bl.Unlock()
+func (sf *sudfops_t) Connect(sabuf []uint8) defs.Err_t {
+	return -defs.EINVAL
+}
 
-	if sus.conn {
-		return -defs.EISCONN
+func (sf *sudfops_t) Listen(backlog int) (fdops.Fdops_i, defs.Err_t) {
+	return nil, -defs.EINVAL
+}
+
+func (sf *sudfops_t) Sendmsg(src fdops.Userio_i, sa []uint8,
+	cmsg []uint8, flags int) (int, defs.Err_t) {
+	if len(cmsg) != 0 || flags != 0 {
+		panic("no imp")
 	}
 	poff := 2
-	path := ustr.MkUstrSlice(saddr[poff:])
-
-	// lookup sid
+	if len(sa) <= poff {
+		return 0, -defs.EINVAL
+	}
 	st := &stat.Stat_t{}
+	path := ustr.MkUstrSlice(sa[poff:])
+
 	err := thefs.Fs_stat(path, st, proc.CurrentProc().Cwd)
 	if err != 0 {
-		return err
+		return 0, err
 	}
 	maj, min := defs.Unmkdev(st.Rdev())
-	if maj != defs.D_SUS {
-		return -defs.ECONNREFUSED
+	if maj != defs.D_SUD {
+		return 0, -defs.ECONNREFUSED
 	}
-	sid := min
+	ino := st.Rino()
 
-	allsusl.Lock()
-	susl, ok := allsusl.m[sid]
-	allsusl.Unlock()
+	bid := budid_t(min)
+	bud, ok := allbuds.bud_lookup(bid, defs.Inum_t(ino))
 	if !ok {
-		return -defs.ECONNREFUSED
+		return 0, -defs.ECONNREFUSED
 	}
 
-	pipein := &pipe_t{}
-	pipein.pipe_start()
+	var bp ustr.Ustr
+	sf.Lock()
+	if sf.bound {
+		bp = sf.bud.bpath
+	}
+	sf.Unlock()
 
-	pipeout, err := susl.connectwait(pipein)
+	did, err := bud.bud_in(src, bp, cmsg)
 	if err != 0 {
-		return err
+		return 0, err
 	}
+	return did, 0
+}
 
-	sus.pipein = &pipefops_t{pipe: pipein, options: sus.options}
-	sus.pipeout = &pipefops_t{pipe: pipeout, writer: true, options: sus.options}
-	sus.conn = true
-	return 0
-}
-
-func (sus *susfops_t) Listen(backlog int) (fdops.Fdops_i, defs.Err_t) {
-	sus.bl.Lock()
-	defer sus.bl.Unlock()
-
-	if sus.conn {
-		return nil, -defs.EISCONN
-	}
-	if !sus.bound {
-		return nil, -defs.EINVAL
-	}
-	if sus.lstn {
-		return nil, -defs.EINVAL
-	}
-	sus.lstn = true
-
-	// create a listening socket
-	susl := &susl_t{}
-	susl.susl_start(sus.mysid, backlog)
-	newsock := &suslfops_t{susl: susl, myaddr: sus.myaddr,
-		options: sus.options}
-	allsusl.Lock()
-	// XXXPANIC
-	if _, ok := allsusl.m[sus.mysid]; ok {
-		panic("susl exists")
-	}
-	allsusl.m[sus.mysid] = susl
-	allsusl.Unlock()
-
-	return newsock, 0
-}
-
-func (sus *susfops_t) Sendmsg(src fdops.Userio_i, toaddr []uint8,
-	cmsg []uint8, flags int) (int, defs.Err_t) {
-	if !sus.conn {
-		return 0, -defs.ENOTCONN
-	}
-	if toaddr != nil {
-		return 0, -defs.EISCONN
-	}
-
-	if len(cmsg) > 0 {
-		scmsz := 16 + 8
-		if len(cmsg) < scmsz {
-			return 0, -defs.EINVAL
-		}
-		// allow fd sending
-		cmsg_len := readn(cmsg, 8, 0)
-		cmsg_level := readn(cmsg, 4, 8)
-		cmsg_type := readn(cmsg, 4, 12)
-		scm_rights := 1
-		if cmsg_len != scmsz || cmsg_level != scm_rights ||
-			cmsg_type != defs.SOL_SOCKET {
-			return 0, -defs.EINVAL
-		}
-		chdrsz := 16
-		fdn := readn(cmsg, 4, chdrsz)
-		ofd, ok := proc.CurrentProc().Fd_get(fdn)
-		if !ok {
-			return 0, -defs.EBADF
-		}
-		nfd, err := fd.Copyfd(ofd)
-		if err != 0 {
-			return 0, err
-		}
-		err = sus.pipeout.pipe.op_fdadd(nfd)
-		if err != 0 {
-			return 0, err
-		}
+func (sf *sudfops_t) Recvmsg(dst fdops.Userio_i,
+	fromsa fdops.Userio_i, cmsg fdops.Userio_i, flags int) (int, int, int, defs.Msgfl_t, defs.Err_t) {
+	if cmsg.Totalsz() != 0 || flags != 0 {
+		panic("no imp")
 	}
 
-	return sus.pipeout.Write(src)
-}
-
-func (sus *susfops_t) _fdrecv(cmsg fdops.Userio_i,
-	fl defs.Msgfl_t) (int, defs.Msgfl_t, defs.Err_t) {
-	scmsz := 16 + 8
-	if cmsg.Totalsz() < scmsz {
-		return 0, fl, 0
-	}
-	nfd, ok := sus.pipein.pipe.op_fdtake()
-	if !ok {
-		return 0, fl, 0
-	}
-	nfdn, ok := proc.CurrentProc().Fd_insert(nfd, nfd.Perms)
-	if !ok {
-		fd.Close_panic(nfd)
-		return 0, fl, -defs.EMFILE
-	}
-	buf := make([]uint8, scmsz)
-	writen(buf, 8, 0, scmsz)
-	writen(buf, 4, 8, defs.SOL_SOCKET)
-	scm_rights := 1
-	writen(buf, 4, 12, scm_rights)
-	writen(buf, 4, 16, nfdn)
-	l, err := cmsg.Uiowrite(buf)
-	if err != 0 {
-		return 0, fl, err
-	}
-	if l != scmsz {
-		panic("how")
-	}
-	return scmsz, fl, 0
-}
+	sf.Lock()
+	defer sf.Unlock()
 
-func (sus *susfops_t) Recvmsg(dst fdops.Userio_i, fromsa fdops.Userio_i,
-	cmsg fdops.Userio_i, flags int) (int, int, int, defs.Msgfl_t, defs.Err_t) {
-	if !sus.conn {
-		return 0, 0, 0, 0, -defs.ENOTCONN
+	// XXX what is recv'ing on an unbound unix datagram socket supposed to
+	// do? openbsd and linux seem to block forever.
+	if !sf.bound {
+		return 0, 0, 0, 0, -defs.ECONNREFUSED
 	}
+	bud := sf.bud
 
-	ret, err := sus.pipein.Read(dst)
+	datadid, addrdid, ancdid, msgfl, err := bud.bud_out(dst, fromsa, cmsg)
 	if err != 0 {
 		return 0, 0, 0, 0, err
 	}
-	cmsglen, msgfl, err := sus._fdrecv(cmsg, 0)
-	return ret, 0, cmsglen, msgfl, err
+	return datadid, addrdid, ancdid, msgfl, 0
 }
 
-func (sus *susfops_t) Pollone(pm fdops.Pollmsg_t) (fdops.Ready_t, defs.Err_t) {
-	if !sus.conn {
-		return pm.Events & fdops.R_ERROR, 0
-	}
+func (sf *sudfops_t) Pollone(pm fdops.Pollmsg_t) (fdops.Ready_t, defs.Err_t) {
+	sf.Lock()
+	defer sf.Unlock()
 
-	// pipefops_t.pollone() doesn't allow polling for reading on write-end
-	// of pipe and vice versa
-	var readyin fdops.Ready_t
-	var readyout fdops.Ready_t
-	both := pm.Events&(fdops.R_READ|fdops.R_WRITE) == 0
-	var err defs.Err_t
-	if both || pm.Events&fdops.R_READ != 0 {
-		readyin, err = sus.pipein.Pollone(pm)
-	}
-	if err != 0 {
-		return 0, err
-	}
-	if readyin != 0 {
-		return readyin, 0
-	}
-	if both || pm.Events&fdops.R_WRITE != 0 {
-		readyout, err = sus.pipeout.Pollone(pm)
+	if !sf.bound {
+		return pm.Events & fdops.R_ERROR, 0
 	}
-	return readyin | readyout, err
+	r, err := sf.bud.bud_poll(pm)
+	return r, err
 }
 
-func (sus *susfops_t) Fcntl(cmd, opt int) int {
-	sus.bl.Lock()
-	defer sus.bl.Unlock()
-
-	switch cmd {
-	case defs.F_GETFL:
-		return int(sus.options)
-	case defs.F_SETFL:
-		sus.options = defs.Fdopt_t(opt)
-		if sus.conn {
-			sus.pipein.options = defs.Fdopt_t(opt)
-			sus.pipeout.options = defs.Fdopt_t(opt)
-		}
-		return 0
-	default:
-		panic("weird cmd")
-	}
+func (sf *sudfops_t) Fcntl(cmd, opt int) int {
+	return int(-defs.ENOSYS)
 }
 
-func (sus *susfops_t) Getsockopt(opt int, bufarg fdops.Userio_i,
+func (sf *sudfops_t) Getsockopt(opt int, bufarg fdops.Userio_i,
 	intarg int) (int, defs.Err_t) {
-	switch opt {
-	case defs.SO_ERROR:
-		dur := [4]uint8{}
-		writen(dur[:], 4, 0, 0)
-		did, err := bufarg.Uiowrite(dur[:])
-		return did, err
-	default:
-		return 0, -defs.EOPNOTSUPP
-	}
+	return 0, -defs.EOPNOTSUPP
 }
 
-func (sus *susfops_t) Setsockopt(int, int, fdops.Userio_i, int) defs.Err_t {
+func (sf *sudfops_t) Setsockopt(int, int, fdops.Userio_i, int) defs.Err_t {
 	return -defs.EOPNOTSUPP
 }
 
-func (sus *susfops_t) Shutdown(read, write bool) defs.Err_t {
-	panic("no imp")
+func (sf *sudfops_t) Shutdown(read, write bool) defs.Err_t {
+	return -defs.ENOTSOCK
 }
 
-var _susid uint64
+type budid_t int
 
-func susid_new() int {
-	newid := atomic.AddUint64(&_susid, 1)
-	return int(newid)
+var allbuds = allbud_t{m: make(map[budkey_t]*bud_t)}
+
+// buds are indexed by bid and inode number in order to detect stale socket
+// files that happen to have the same bid.
+type budkey_t struct {
+	bid  budid_t
+	priv defs.Inum_t
 }
 
-type allsusl_t struct {
-	m map[int]*susl_t
+type allbud_t struct {
+	// leaf lock
 	sync.Mutex
+	m       map[budkey_t]*bud_t
+	nextbid budid_t
 }
 
-var allsusl = allsusl_t{m: map[int]*susl_t{}}
+func (ab *allbud_t) bud_lookup(bid budid_t, fpriv defs.Inum_t) (*bud_t, bool) {
+	key := budkey_t{bid, fpriv}
 
-// listening unix stream socket
-type susl_t struct {
-	sync.Mutex
-	waiters         []_suslblog_t
-	pollers         fdops.Pollers_t
-	opencount       int
-	mysid           int
-	readyconnectors int
+	ab.Lock()
+	bud, ok := ab.m[key]
+	ab.Unlock()
+
+	return bud, ok
 }
 
-type _suslblog_t struct {
-	conn *pipe_t
-	acc  *pipe_t
-	cond *sync.Cond
-	err  defs.Err_t
+func (ab *allbud_t) bud_id_new() budid_t {
+	ab.Lock()
+	ret := ab.nextbid
+	ab.nextbid++
+	ab.Unlock()
+	return ret
 }
 
-func (susl *susl_t) susl_start(mysid, backlog int) {
-	blm := 64
-	if backlog < 0 || backlog > blm {
-		backlog = blm
-	}
-	susl.waiters = make([]_suslblog_t, backlog)
-	for i := range susl.waiters {
-		susl.waiters[i].cond = sync.NewCond(susl)
+func (ab *allbud_t) bud_new(bid budid_t, budpath ustr.Ustr, fpriv defs.Inum_t) *bud_t {
+	ret := &bud_t{}
+	ret.bud_init(bid, budpath, fpriv)
+
+	key := budkey_t{bid, fpriv}
+	ab.Lock()
+	if _, ok := ab.m[key]; ok {
+		panic("bud exists")
 	}
-	susl.opencount = 1
-	susl.mysid = mysid
+	ab.m[key] = ret
+	ab.Unlock()
+	return ret
 }
 
-func (susl *susl_t) _findbed(amconnector bool) (*_suslblog_t, bool) {
-	for i := range susl.waiters {
-		var chk *pipe_t
-		if amconnector {
-			chk = susl.waiters[i].conn
-		} else {
-			chk = susl.waiters[i].acc
-		}
-		if chk == nil {
-			return &susl.waiters[i], true
-		}
+func (ab *allbud_t) bud_del(bid budid_t, fpriv defs.Inum_t) {
+	key := budkey_t{bid, fpriv}
+	ab.Lock()
+	if _, ok := ab.m[key]; !ok {
+		panic("no such bud")
 	}
-	return nil, false
+	delete(ab.m, key)
+	ab.Unlock()
 }
 
-func (susl *susl_t) _findwaiter(getacceptor bool) (*_suslblog_t, bool) {
-	for i := range susl.waiters {
-		var chk *pipe_t
-		var oth *pipe_t
-		if getacceptor {
-			chk = susl.waiters[i].acc
-			oth = susl.waiters[i].conn
-		} else {
-			chk = susl.waiters[i].conn
-			oth = susl.waiters[i].acc
-		}
-		if chk != nil && oth == nil {
-			return &susl.waiters[i], true
-		}
-	}
-	return nil, false
+type dgram_t struct {
+	from ustr.Ustr
+	sz   int
 }
 
-func (susl *susl_t) _slotreset(slot *_suslblog_t) {
-	slot.acc = nil
-	slot.conn = nil
+// a circular buffer for datagrams and their source addresses
+type dgrambuf_t struct {
+	cbuf   circbuf.Circbuf_t
+	dgrams []dgram_t
+	// add dgrams at head, remove from tail
+	head uint
+	tail uint
 }
 
-func (susl *susl_t) _getpartner(mypipe *pipe_t, getacceptor,
-	noblk bool) (*pipe_t, defs.Err_t) {
-	susl.Lock()
-	if susl.opencount == 0 {
-		susl.Unlock()
-		return nil, -defs.EBADF
-	}
+func (db *dgrambuf_t) dg_init(sz int) {
+	db.cbuf.Cb_init(sz, mem.Physmem)
+	// assume that messages are at least 10 bytes
+	db.dgrams = make([]dgram_t, sz/10)
+	db.head, db.tail = 0, 0
+}
 
-	var theirs *pipe_t
-	// fastpath: is there a peer already waiting?
-	s, found := susl._findwaiter(getacceptor)
-	if found {
-		if getacceptor {
-			theirs = s.acc
-			s.conn = mypipe
-		} else {
-			theirs = s.conn
-			s.acc = mypipe
-		}
-		susl.Unlock()
-		s.cond.Signal()
-		return theirs, 0
+// returns true if there is enough buffers to hold a datagram of size sz
+func (db *dgrambuf_t) _canhold(sz int) bool {
+	if (db.head-db.tail) == uint(len(db.dgrams)) ||
+		db.cbuf.Left() < sz {
+		return false
 	}
-	if noblk {
-		susl.Unlock()
-		return nil, -defs.EWOULDBLOCK
+	return true
+}
+
+func (db *dgrambuf_t) _havedgram() bool {
+	return db.head != db.tail
+}
+
+func (db *dgrambuf_t) copyin(src fdops.Userio_i, from ustr.Ustr) (int, defs.Err_t) {
+	// is there a free source address slot and buffer space?
+	if !db._canhold(src.Totalsz()) {
+		panic("should have blocked")
 	}
-	// darn. wait for a peer.
-	b, found := susl._findbed(getacceptor)
-	if !found {
-		// backlog is full
-		susl.Unlock()
-		if !getacceptor {
-			panic("fixme: allow more accepts than backlog")
-		}
-		return nil, -defs.ECONNREFUSED
+	did, err := db.cbuf.Copyin(src)
+	if err != 0 {
+		return 0, err
 	}
-	if getacceptor {
-		b.conn = mypipe
-		susl.pollers.Wakeready(fdops.R_READ)
-	} else {
-		b.acc = mypipe
+	slot := &db.dgrams[db.head%uint(len(db.dgrams))]
+	db.head++
+	slot.from = from
+	slot.sz = did
+	return did, 0
+}
+
+func (db *dgrambuf_t) copyout(dst, fromsa, cmsg fdops.Userio_i) (int, int, defs.Err_t) {
+	if cmsg.Totalsz() != 0 {
+		panic("no imp")
 	}
-	if getacceptor {
-		susl.readyconnectors++
+	if db.head == db.tail {
+		panic("should have blocked")
 	}
-	err := proc.KillableWait(b.cond)
-	if err == 0 {
-		err = b.err
+	slot := &db.dgrams[db.tail%uint(len(db.dgrams))]
+	sz := slot.sz
+	if sz == 0 {
+		panic("huh?")
 	}
-	if getacceptor {
-		theirs = b.acc
-	} else {
-		theirs = b.conn
+	var fdid int
+	if fromsa.Totalsz() != 0 {
+		fsaddr := _sockaddr_un(slot.from)
+		var err defs.Err_t
+		fdid, err = fromsa.Uiowrite(fsaddr)
+		if err != 0 {
+			return 0, 0, err
+		}
 	}
-	susl._slotreset(b)
-	if getacceptor {
-		susl.readyconnectors--
+	did, err := db.cbuf.Copyout_n(dst, sz)
+	if err != 0 {
+		return 0, 0, err
 	}
-	susl.Unlock()
-	return theirs, err
+	// commit tail
+	db.tail++
+	return did, fdid, 0
 }
 
-func (susl *susl_t) connectwait(mypipe *pipe_t) (*pipe_t, defs.Err_t) {
-	noblk := false
-	return susl._getpartner(mypipe, true, noblk)
+func (db *dgrambuf_t) dg_release() {
+	db.cbuf.Cb_release()
 }
 
-func (susl *susl_t) acceptwait(mypipe *pipe_t) (*pipe_t, defs.Err_t) {
-	noblk := false
-	return susl._getpartner(mypipe, false, noblk)
+// convert bound socket path to struct sockaddr_un
+func _sockaddr_un(budpath ustr.Ustr) []uint8 {
+	ret := make([]uint8, 2, 16)
+	// len
+	writen(ret, 1, 0, len(budpath))
+	// family
+	writen(ret, 1, 1, defs.AF_UNIX)
+	// path
+	ret = append(ret, budpath...)
+	ret = append(ret, 0)
+	return ret
 }
 
-func (susl *susl_t) acceptnowait(mypipe *pipe_t) (*pipe_t, defs.Err_t) {
-	noblk := true
-	return susl._getpartner(mypipe, false, noblk)
+// a type for bound UNIX datagram sockets
+type bud_t struct {
+	sync.Mutex
+	bid     budid_t
+	fpriv   defs.Inum_t
+	dbuf    dgrambuf_t
+	pollers fdops.Pollers_t
+	cond    *sync.Cond
+	closed  bool
+	bpath   ustr.Ustr
 }
 
-func (susl *susl_t) susl_reopen(delta int) defs.Err_t {
-	ret := defs.Err_t(0)
-	dorem := false
-	susl.Lock()
-	if susl.opencount != 0 {
-		susl.opencount += delta
-		if susl.opencount == 0 {
-			dorem = true
-		}
-	} else {
-		ret = -defs.EBADF
-	}
+func (bud *bud_t) bud_init(bid budid_t, bpath ustr.Ustr, priv defs.Inum_t) {
+	bud.bid = bid
+	bud.fpriv = priv
+	bud.bpath = bpath
+	bud.dbuf.dg_init(512)
+	bud.cond = sync.NewCond(bud)
+}
 
-	if dorem {
-		limits.Syslimit.Socks.Give()
-		// wake up all blocked connectors/acceptors/pollers
-		for i := range susl.waiters {
-			s := &susl.waiters[i]
-			a := s.acc
-			b := s.conn
-			if a == nil && b == nil {
-				continue
-			}
-			s.err = -defs.ECONNRESET
-			s.cond.Signal()
-		}
-		susl.pollers.Wakeready(fdops.R_READ | fdops.R_HUP | fdops.R_ERROR)
-	}
+func (bud *bud_t) _rready() {
+	bud.cond.Broadcast()
+	bud.pollers.Wakeready(fdops.R_READ)
+}
 
-	susl.Unlock()
-	if dorem {
-		allsusl.Lock()
-		delete(allsusl.m, susl.mysid)
-		allsusl.Unlock()
-	}
-	return ret
+func (bud *bud_t) _wready() {
+	bud.cond.Broadcast()
+	bud.pollers.Wakeready(fdops.R_WRITE)
 }
 
-func (susl *susl_t) susl_poll(pm fdops.Pollmsg_t) (fdops.Ready_t, defs.Err_t) {
-	susl.Lock()
-	if susl.opencount == 0 {
-		susl.Unlock()
-		return 0, 0
+// returns number of bytes written and error
+func (bud *bud_t) bud_in(src fdops.Userio_i, from ustr.Ustr, cmsg []uint8) (int, defs.Err_t) {
+	if len(cmsg) != 0 {
+		panic("no imp")
 	}
-	if pm.Events&fdops.R_READ != 0 {
-		if susl.readyconnectors > 0 {
-			susl.Unlock()
-			return fdops.R_READ, 0
+	need := src.Totalsz()
+	bud.Lock()
+	for {
+		if bud.closed {
+			bud.Unlock()
+			return 0, -defs.EBADF
+		}
+		if bud.dbuf._canhold(need) || bud.closed {
+			break
+		}
+		if err := proc.KillableWait(bud.cond); err != 0 {
+			bud.Unlock()
+			return 0, err
 		}
 	}
-	var err defs.Err_t
-	if pm.Dowait {
-		err = susl.pollers.Addpoller(&pm)
-	}
-	susl.Unlock()
-	return 0, err
-}
-
-type suslfops_t struct {
-	susl    *susl_t
-	myaddr  ustr.Ustr
-	options defs.Fdopt_t
+	did, err := bud.dbuf.copyin(src, from)
+	bud._rready()
+	bud.Unlock()
+	return did, err
 }
 
-func (sf *suslfops_t) Close() defs.Err_t {
-	return sf.susl.susl_reopen(-1)
+// returns number of bytes written of data, socket address, ancillary data, and
+// ancillary message flags...
+func (bud *bud_t) bud_out(dst, fromsa, cmsg fdops.Userio_i) (int, int, int,
+	defs.Msgfl_t, defs.Err_t) {
+	if cmsg.Totalsz() != 0 {
+		panic("no imp")
+	}
+	bud.Lock()
+	for {
+		if bud.closed {
+			bud.Unlock()
+			return 0, 0, 0, 0, -defs.EBADF
+		}
+		if bud.dbuf._havedgram() {
+			break
+		}
+		if err := proc.KillableWait(bud.cond); err != 0 {
+			bud.Unlock()
+			return 0, 0, 0, 0, err
+		}
+	}
+	ddid, fdid, err := bud.dbuf.copyout(dst, fromsa, cmsg)
+	bud._wready()
+	bud.Unlock()
+	return ddid, fdid, 0, 0, err
 }
 
-func (sf *suslfops_t) Fstat(*stat.Stat_t) defs.Err_t {
-	panic("no imp")
+func (bud *bud_t) bud_poll(pm fdops.Pollmsg_t) (fdops.Ready_t, defs.Err_t) {
+	var ret fdops.Ready_t
+	var err defs.Err_t
+	bud.Lock()
+	if bud.closed {
+		goto out
+	}
+	if pm.Events&fdops.R_READ != 0 && bud.dbuf._havedgram() {
+		ret |= fdops.R_READ
+	}
+	if pm.Events&fdops.R_WRITE != 0 && bud.dbuf._canhold(32) {
+		ret |= fdops.R_WRITE
+	}
+	if ret == 0 && pm.Dowait {
+		err = bud.pollers.Addpoller(&pm)
+	}
+out:
+	bud.Unlock()
+	return ret, err
 }
 
-func (sf *suslfops_t) Lseek(int, int) (int, defs.Err_t) {
-	return 0, -defs.ESPIPE
-}
+// the bud is closed; wake up any waiting threads
+func (bud *bud_t) bud_close() {
+	bud.Lock()
+	bud.closed = true
+	bud.cond.Broadcast()
+	bud.pollers.Wakeready(fdops.R_READ | fdops.R_WRITE | fdops.R_ERROR)
+	bid := bud.bid
+	fpriv := bud.fpriv
+	bud.dbuf.dg_release()
+	bud.Unlock()
 
-func (sf *suslfops_t) Mmapi(int, int, bool) ([]mem.Mmapinfo_t, defs.Err_t) {
-	return nil, -defs.ENODEV
+	allbuds.bud_del(bid, fpriv)
 }
 
-func (sf *suslfops_t) Pathi() defs.Inum_t {
-	panic("unix stream listener cwd?")
+type susfops_t struct {
+	pipein  *pipefops_t
+	pipeout *pipefops_t
+	bl      sync.Mutex
+	conn    bool
+	bound   bool
+	lstn    bool
+	myaddr  ustr.Ustr
+	mysid   int
+	options defs.Fdopt_t
 }
 
-func (sf *suslfops_t) Read(fdops.Userio_i) (int, defs.Err_t) {
-	return 0, -defs.ENOTCONN
+func (sus *susfops_t) Close() defs.Err_t {
+	if !sus.conn {
+		return 0
+	}
+	err1 := sus.pipein.Close()
+	err2 := sus.pipeout.Close()
+	if err1 != 0 {
+		return err1
+	}
+	// XXX
+	sus.pipein.pipe.Lock()
+	term := sus.pipein.pipe.closed
+	sus.pipein.pipe.Unlock()
+	if term {
+		limits.Syslimit.Socks.Give()
+	}
+	return err2
 }
 
-func (sf *suslfops_t) Reopen() defs.Err_t {
-	return sf.susl.susl_reopen(1)
+func (sus *susfops_t) Fstat(*stat.Stat_t) defs.Err_t {
+	panic("no imp")
 }
 
-func (sf *suslfops_t) Write(fdops.Userio_i) (int, defs.Err_t) {
-	return 0, -defs.EPIPE
+func (sus *susfops_t) Lseek(int, int) (int, defs.Err_t) {
+	return 0, -defs.ESPIPE
 }
 
-func (sf *suslfops_t) Truncate(newlen uint) defs.Err_t {
-	return -defs.EINVAL
+func (sus *susfops_t) Mmapi(int, int, bool) ([]mem.Mmapinfo_t, defs.Err_t) {
+	return nil, -defs.ENODEV
 }
 
-func (sf *suslfops_t) Pread(dst fdops.Userio_i, offset int) (int, defs.Err_t) {
-	return 0, -defs.ESPIPE
+func (sus *susfops_t) Pathi() defs.Inum_t {
+	panic("unix stream cwd?")
 }
 
-func (sf *suslfops_t) Pwrite(src fdops.Userio_i, offset int) (int, defs.Err_t) {
-	return 0, -defs.ESPIPE
+func (sus *susfops_t) Read(dst fdops.Userio_i) (int, defs.Err_t) {
+	read, _, _, _, err := sus.Recvmsg(dst, zeroubuf, zeroubuf, 0)
+	return read, err
 }
 
-func (sf *suslfops_t) Accept(fromsa fdops.Userio_i) (fdops.Fdops_i, int, defs.Err_t) {
-	// the connector has already taken syslimit.Socks (1 sock reservation
-	// counts for a connected pair of UNIX stream sockets).
-	noblk := sf.options&defs.O_NONBLOCK != 0
-	pipein := &pipe_t{}
-	pipein.pipe_start()
-	var pipeout *pipe_t
-	var err defs.Err_t
-	if noblk {
-		pipeout, err = sf.susl.acceptnowait(pipein)
-	} else {
-		pipeout, err = sf.susl.acceptwait(pipein)
+func (sus *susfops_t) Reopen() defs.Err_t {
+	if !sus.conn {
+		return 0
 	}
-	if err != 0 {
-		return nil, 0, err
+	err1 := sus.pipein.Reopen()
+	err2 := sus.pipeout.Reopen()
+	if err1 != 0 {
+		return err1
 	}
-	pfin := &pipefops_t{pipe: pipein, options: sf.options}
-	pfout := &pipefops_t{pipe: pipeout, writer: true, options: sf.options}
-	ret := &susfops_t{pipein: pfin, pipeout: pfout, conn: true,
-		options: sf.options}
-	return ret, 0, 0
+	return err2
 }
 
-func (sf *suslfops_t) Bind([]uint8) defs.Err_t {
-	return -defs.EINVAL
+func (sus *susfops_t) Write(src fdops.Userio_i) (int, defs.Err_t) {
+	wrote, err := sus.Sendmsg(src, nil, nil, 0)
+	if err == -defs.EPIPE {
+		err = -defs.ECONNRESET
+	}
+	return wrote, err
 }
 
-func (sf *suslfops_t) Connect(sabuf []uint8) defs.Err_t {
+func (sus *susfops_t) Truncate(newlen uint) defs.Err_t {
 	return -defs.EINVAL
 }
 
-func (sf *suslfops_t) Listen(backlog int) (fdops.Fdops_i, defs.Err_t) {
-	return nil, -defs.EINVAL
+func (sus *susfops_t) Pread(dst fdops.Userio_i, offset int) (int, defs.Err_t) {
+	return 0, -defs.ESPIPE
 }
 
-func (sf *suslfops_t) Sendmsg(fdops.Userio_i, []uint8, []uint8,
-	int) (int, defs.Err_t) {
-	return 0, -defs.ENOTCONN
+func (sus *susfops_t) Pwrite(src fdops.Userio_i, offset int) (int, defs.Err_t) {
+	return 0, -defs.ESPIPE
 }
 
-func (sf *suslfops_t) Recvmsg(fdops.Userio_i, fdops.Userio_i,
-	fdops.Userio_i, int) (int, int, int, defs.Msgfl_t, defs.Err_t) {
-	return 0, 0, 0, 0, -defs.ENOTCONN
+func (sus *susfops_t) Accept(fdops.Userio_i) (fdops.Fdops_i, int, defs.Err_t) {
+	return nil, 0, -defs.EINVAL
 }
 
-func (sf *suslfops_t) Pollone(pm fdops.Pollmsg_t) (fdops.Ready_t, defs.Err_t) {
-	return sf.susl.susl_poll(pm)
-}
+func (sus *susfops_t) Bind(saddr []uint8) defs.Err_t {
+	sus.bl.Lock()
+	defer sus.bl.Unlock()
 
-func (sf *suslfops_t) Fcntl(cmd, opt int) int {
-	switch cmd {
-	case defs.F_GETFL:
-		return int(sf.options)
-	case defs.F_SETFL:
-		sf.options = defs.Fdopt_t(opt)
-		return 0
-	default:
-		panic("weird cmd")
+	if sus.bound {
+		return -defs.EINVAL
 	}
-}
-
-func (sf *suslfops_t) Getsockopt(opt int, bufarg fdops.Userio_i,
-	intarg int) (int, defs.Err_t) {
-	return 0, -defs.EOPNOTSUPP
-}
-
-func (sf *suslfops_t) Setsockopt(int, int, fdops.Userio_i, int) defs.Err_t {
-	return -defs.EOPNOTSUPP
-}
-
-func (sf *suslfops_t) Shutdown(read, write bool) defs.Err_t {
-	return -defs.ENOTCONN
-}
+	poff := 2
+	path := ustr.MkUstrSlice(saddr[poff:])
+	sid := susid_new()
 
-func sys_listen(p *proc.Proc_t, fdn, backlog int) int {
-	fd, ok := p.Fd_get(fdn)
-	if !ok {
-		return int(-defs.EBADF)
-	}
-	if backlog < 0 {
-		backlog = 0
-	}
-	newfops, err := fd.Fops.Listen(backlog)
+	// create special file
+	fsf, err := thefs.Fs_open_inner(path, defs.O_CREAT|defs.O_EXCL, 0, proc.CurrentProc().Cwd, defs.D_SUS, sid)
 	if err != 0 {
-		return int(err)
+		return err
 	}
-	// replace old fops
-	p.Fdl.Lock()
-	fd.Fops = newfops
-	p.Fdl.Unlock()
+	if thefs.Fs_close(fsf.Inum) != 0 {
+		panic("must succeed")
+	}
+	sus.myaddr = path
+	sus.mysid = sid
+	sus.bound = true
 	return 0
 }
 
-func sys_getsockopt(p *proc.Proc_t, fdn, level, opt, optvaln, optlenn int) int {
-	if level != defs.SOL_SOCKET {
-		panic("no imp")
+func (sus *susfops_t) Connect(saddr []uint8) defs.Err_t {
+	sus.bl.Lock()
+	defer sus.bl.Unlock()
+
+	if sus.conn {
+		return -defs.EISCONN
 	}
-	var olen int
-	if optlenn != 0 {
-		l, err := p.Vm.Userreadn(optlenn, 8)
-		if err != 0 {
-			return int(err)
-		}
-		if l < 0 {
-			return int(-defs.EFAULT)
-		}
-		olen = l
+	poff := 2
+	path := ustr.MkUstrSlice(saddr[poff:])
+
+	// lookup sid
+	st := &stat.Stat_t{}
+	err := thefs.Fs_stat(path, st, proc.CurrentProc().Cwd)
+	if err != 0 {
+		return err
 	}
-	bufarg := p.Vm.Mkuserbuf(optvaln, olen)
-	// XXX why intarg??
-	intarg := optvaln
-	fd, ok := p.Fd_get(fdn)
+	maj, min := defs.Unmkdev(st.Rdev())
+	if maj != defs.D_SUS {
+		return -defs.ECONNREFUSED
+	}
+	sid := min
+
+	allsusl.Lock()
+	susl, ok := allsusl.m[sid]
+	allsusl.Unlock()
 	if !ok {
-		return int(-defs.EBADF)
+		return -defs.ECONNREFUSED
 	}
-	optwrote, err := fd.Fops.Getsockopt(opt, bufarg, intarg)
+
+	pipein := &pipe_t{}
+	pipein.pipe_start()
+
+	pipeout, err := susl.connectwait(pipein)
 	if err != 0 {
-		return int(err)
-	}
-	if optlenn != 0 {
-		if err := p.Vm.Userwriten(optlenn, 8, optwrote); err != 0 {
-			return int(err)
-		}
+		return err
 	}
+
+	sus.pipein = &pipefops_t{pipe: pipein, options: sus.options}
+	sus.pipeout = &pipefops_t{pipe: pipeout, writer: true, options: sus.options}
+	sus.conn = true
 	return 0
 }
 
-func sys_setsockopt(p *proc.Proc_t, fdn, level, opt, optvaln, optlenn int) int {
-	if optlenn < 0 {
-		return int(-defs.EFAULT)
+func (sus *susfops_t) Listen(backlog int) (fdops.Fdops_i, defs.Err_t) {
+	sus.bl.Lock()
+	defer sus.bl.Unlock()
+
+	if sus.conn {
+		return nil, -defs.EISCONN
 	}
-	var intarg int
-	if optlenn >= 4 {
-		var err defs.Err_t
-		intarg, err = p.Vm.Userreadn(optvaln, 4)
-		if err != 0 {
-			return int(err)
-		}
+	if !sus.bound {
+		return nil, -defs.EINVAL
 	}
-	bufarg := p.Vm.Mkuserbuf(optvaln, optlenn)
-	fd, ok := p.Fd_get(fdn)
-	if !ok {
-		return int(-defs.EBADF)
+	if sus.lstn {
+		return nil, -defs.EINVAL
 	}
-	err := fd.Fops.Setsockopt(level, opt, bufarg, intarg)
-	return int(err)
-}
+	sus.lstn = true
 
-func _closefds(fds []*fd.Fd_t) {
-	for _, f := range fds {
-		if f != nil {
-			fd.Close_panic(f)
-		}
+	// create a listening socket
+	susl := &susl_t{}
+	susl.susl_start(sus.mysid, backlog)
+	newsock := &suslfops_t{susl: susl, myaddr: sus.myaddr,
+		options: sus.options}
+	allsusl.Lock()
+	// XXXPANIC
+	if _, ok := allsusl.m[sus.mysid]; ok {
+		panic("susl exists")
 	}
+	allsusl.m[sus.mysid] = susl
+	allsusl.Unlock()
+
+	return newsock, 0
 }
 
-func sys_fork(parent *proc.Proc_t, ptf *[defs.TFSIZE]uintptr, tforkp int, flags int) int {
-	tmp := flags & (defs.FORK_THREAD | defs.FORK_PROCESS)
-	if tmp != defs.FORK_THREAD && tmp != defs.FORK_PROCESS {
-		return int(-defs.EINVAL)
+func (sus *susfops_t) Sendmsg(src fdops.Userio_i, toaddr []uint8,
+	cmsg []uint8, flags int) (int, defs.Err_t) {
+	if !sus.conn {
+		return 0, -defs.ENOTCONN
+	}
+	if toaddr != nil {
+		return 0, -defs.EISCONN
 	}
 
-	mkproc := flags&defs.FORK_PROCESS != 0
-	var child *proc.Proc_t
-	var childtid defs.Tid_t
-	var ret int
-
-	// copy parents trap frame
-	chtf := &[defs.TFSIZE]uintptr{}
-	*chtf = *ptf
-
-	if mkproc {
-		var ok bool
-		// lock fd table for copying
-		parent.Fdl.Lock()
-		cwd := *parent.Cwd
-		child, ok = proc.Proc_new(parent.Name, &cwd, parent.Fds, sys)
-		parent.Fdl.Unlock()
-		if !ok {
-			lhits++
-			return int(-defs.ENOMEM)
-		}
-
-		child.Vm.Pmap, child.Vm.P_pmap, ok = physmem.Pmap_new()
-		if !ok {
-			goto outproc
-		}
-		physmem.Refup(child.Vm.P_pmap)
-
-		child.Pwait = &parent.Mywait
-		ok = parent.Start_proc(child.Pid)
-		if !ok {
-			lhits++
-			goto outmem
-		}
-
-		// fork parent address space
-		parent.Vm.Lock_pmap()
-		rsp := chtf[defs.TF_RSP]
-		doflush, ok := parent.Vm_fork(child, rsp)
-		if ok && !doflush {
-			panic("no writable segs?")
-		}
-		// flush all ptes now marked COW
-		if doflush {
-			parent.Tlbflush()
-		}
-		parent.Vm.Unlock_pmap()
-
-		if !ok {
-			// child page table allocation failed. call
-			// proc.Proc_t.terminate which will clean everything up. the
-			// parent will get th error code directly.
-			child.Thread_dead(child.Tid0(), 0, false)
-			return int(-defs.ENOMEM)
-		}
-
-		childtid = child.Tid0()
-		ret = child.Pid
-	} else {
-		// validate tfork struct
-		tcb, err1 := parent.Vm.Userreadn(tforkp+0, 8)
-		tidaddrn, err2 := parent.Vm.Userreadn(tforkp+8, 8)
-		stack, err3 := parent.Vm.Userreadn(tforkp+16, 8)
-		if err1 != 0 {
-			return int(err1)
-		}
-		if err2 != 0 {
-			return int(err2)
-		}
-		if err3 != 0 {
-			return int(err3)
+	if len(cmsg) > 0 {
+		scmsz := 16 + 8
+		if len(cmsg) < scmsz {
+			return 0, -defs.EINVAL
 		}
-		writetid := tidaddrn != 0
-		if tcb != 0 {
-			chtf[defs.TF_FSBASE] = uintptr(tcb)
+		// allow fd sending
+		cmsg_len := readn(cmsg, 8, 0)
+		cmsg_level := readn(cmsg, 4, 8)
+		cmsg_type := readn(cmsg, 4, 12)
+		scm_rights := 1
+		if cmsg_len != scmsz || cmsg_level != scm_rights ||
+			cmsg_type != defs.SOL_SOCKET {
+			return 0, -defs.EINVAL
 		}
-
-		child = parent
-		var ok bool
-		childtid, ok = parent.Thread_new()
+		chdrsz := 16
+		fdn := readn(cmsg, 4, chdrsz)
+		ofd, ok := proc.CurrentProc().Fd_get(fdn)
 		if !ok {
-			lhits++
-			return int(-defs.ENOMEM)
+			return 0, -defs.EBADF
 		}
-		ok = parent.Start_thread(childtid)
-		if !ok {
-			lhits++
-			parent.Thread_undo(childtid)
-			return int(-defs.ENOMEM)
+		nfd, err := fd.Copyfd(ofd)
+		if err != 0 {
+			return 0, err
 		}
-
-		v := int(childtid)
-		chtf[defs.TF_RSP] = uintptr(stack)
-		ret = v
-		if writetid {
-			// it is not a fatal error if some thread unmapped the
-			// memory that was supposed to hold the new thread's
-			// tid out from under us.
-			parent.Vm.Userwriten(tidaddrn, 8, v)
+		err = sus.pipeout.pipe.op_fdadd(nfd)
+		if err != 0 {
+			return 0, err
 		}
 	}
 
-	chtf[defs.TF_RAX] = 0
-	child.Sched_add(chtf, childtid)
-	return ret
-outmem:
-	physmem.Refdown(child.Vm.P_pmap)
-outproc:
-	proc.Tid_del()
-	proc.Proc_del(child.Pid)
-	_closefds(child.Fds)
-	return int(-defs.ENOMEM)
+	return sus.pipeout.Write(src)
 }
 
-func sys_execv(p *proc.Proc_t, tf *[defs.TFSIZE]uintptr, pathn int, argn int) int {
-	args, err := p.Userargs(argn)
-	if err != 0 {
-		return int(err)
+func (sus *susfops_t) _fdrecv(cmsg fdops.Userio_i,
+	fl defs.Msgfl_t) (int, defs.Msgfl_t, defs.Err_t) {
+	scmsz := 16 + 8
+	if cmsg.Totalsz() < scmsz {
+		return 0, fl, 0
 	}
-	path, err := p.Vm.Userstr(pathn, fs.NAME_MAX)
-	if err != 0 {
-		return int(err)
+	nfd, ok := sus.pipein.pipe.op_fdtake()
+	if !ok {
+		return 0, fl, 0
 	}
-	err = badpath(path)
+	nfdn, ok := proc.CurrentProc().Fd_insert(nfd, nfd.Perms)
+	if !ok {
+		fd.Close_panic(nfd)
+		return 0, fl, -defs.EMFILE
+	}
+	buf := make([]uint8, scmsz)
+	writen(buf, 8, 0, scmsz)
+	writen(buf, 4, 8, defs.SOL_SOCKET)
+	scm_rights := 1
+	writen(buf, 4, 12, scm_rights)
+	writen(buf, 4, 16, nfdn)
+	l, err := cmsg.Uiowrite(buf)
 	if err != 0 {
-		return int(err)
+		return 0, fl, err
 	}
-	return sys_execv1(p, tf, path, args)
+	if l != scmsz {
+		panic("how")
+	}
+	return scmsz, fl, 0
 }
 
-var _zvmregion vm.Vmregion_t
-
-func sys_execv1(p *proc.Proc_t, tf *[defs.TFSIZE]uintptr, paths ustr.Ustr,
-	args []ustr.Ustr) int {
-	// XXX a multithreaded process that execs is broken; POSIX2008 says
-	// that all threads should terminate before exec.
-	if p.Thread_count() > 1 {
-		panic("fix exec with many threads")
+func (sus *susfops_t) Recvmsg(dst fdops.Userio_i, fromsa fdops.Userio_i,
+	cmsg fdops.Userio_i, flags int) (int, int, int, defs.Msgfl_t, defs.Err_t) {
+	if !sus.conn {
+		return 0, 0, 0, 0, -defs.ENOTCONN
 	}
 
-	p.Vm.Lock_pmap()
-	defer p.Vm.Unlock_pmap()
-
-	// save page trackers in case the exec fails
-	ovmreg := p.Vm.Vmregion
-	p.Vm.Vmregion = _zvmregion
-
-	// create kernel page table
-	opmap := p.Vm.Pmap
-	op_pmap := p.Vm.P_pmap
-	var ok bool
-	p.Vm.Pmap, p.Vm.P_pmap, ok = physmem.Pmap_new()
-	if !ok {
-		p.Vm.Pmap, p.Vm.P_pmap = opmap, op_pmap
-		return int(-defs.ENOMEM)
-	}
-	physmem.Refup(p.Vm.P_pmap)
-	for _, e := range mem.Kents {
-		p.Vm.Pmap[e.Pml4slot] = e.Entry
+	ret, err := sus.pipein.Read(dst)
+	if err != 0 {
+		return 0, 0, 0, 0, err
 	}
+	cmsglen, msgfl, err := sus._fdrecv(cmsg, 0)
+	return ret, 0, cmsglen, msgfl, err
+}
 
-	restore := func() {
-		vm.Uvmfree_inner(p.Vm.Pmap, p.Vm.P_pmap, &p.Vm.Vmregion)
-		physmem.Refdown(p.Vm.P_pmap)
-		p.Vm.Vmregion.Clear()
-		p.Vm.Pmap = opmap
-		p.Vm.P_pmap = op_pmap
-		p.Vm.Vmregion = ovmreg
+func (sus *susfops_t) Pollone(pm fdops.Pollmsg_t) (fdops.Ready_t, defs.Err_t) {
+	if !sus.conn {
+		return pm.Events & fdops.R_ERROR, 0
 	}
 
-	// load binary image -- get first block of file
-	file, err := thefs.Fs_open(paths, defs.O_RDONLY, 0, p.Cwd, 0, 0)
+	// pipefops_t.pollone() doesn't allow polling for reading on write-end
+	// of pipe and vice versa
+	var readyin fdops.Ready_t
+	var readyout fdops.Ready_t
+	both := pm.Events&(fdops.R_READ|fdops.R_WRITE) == 0
+	var err defs.Err_t
+	if both || pm.Events&fdops.R_READ != 0 {
+		readyin, err = sus.pipein.Pollone(pm)
+	}
 	if err != 0 {
-		restore()
-		return int(err)
+		return 0, err
 	}
-	defer fd.Close_panic(file)
+	if readyin != 0 {
+		return readyin, 0
+	}
+	if both || pm.Events&fdops.R_WRITE != 0 {
+		readyout, err = sus.pipeout.Pollone(pm)
+	}
+	return readyin | readyout, err
+}
 
-	hdata := make([]uint8, 512)
-	ub := &vm.Fakeubuf_t{}
-	ub.Fake_init(hdata)
-	ret, err := file.Fops.Read(ub)
-	if err != 0 {
-		restore()
-		return int(err)
+func (sus *susfops_t) Fcntl(cmd, opt int) int {
+	sus.bl.Lock()
+	defer sus.bl.Unlock()
+
+	switch cmd {
+	case defs.F_GETFL:
+		return int(sus.options)
+	case defs.F_SETFL:
+		sus.options = defs.Fdopt_t(opt)
+		if sus.conn {
+			sus.pipein.options = defs.Fdopt_t(opt)
+			sus.pipeout.options = defs.Fdopt_t(opt)
+		}
+		return 0
+	default:
+		panic("weird cmd")
 	}
-	if ret < len(hdata) {
-		hdata = hdata[0:ret]
+}
+
+func (sus *susfops_t) Getsockopt(opt int, bufarg fdops.Userio_i,
+	intarg int) (int, defs.Err_t) {
+	switch opt {
+	case defs.SO_ERROR:
+		dur := [4]uint8{}
+		writen(dur[:], 4, 0, 0)
+		did, err := bufarg.Uiowrite(dur[:])
+		return did, err
+	default:
+		return 0, -defs.EOPNOTSUPP
 	}
+}
 
-	// assume its always an elf, for now
-	elfhdr := &elf_t{hdata}
-	ok = elfhdr.sanity()
-	if !ok {
-		restore()
-		return int(-defs.EPERM)
+func (sus *susfops_t) Setsockopt(int, int, fdops.Userio_i, int) defs.Err_t {
+	return -defs.EOPNOTSUPP
+}
+
+func (sus *susfops_t) Shutdown(read, write bool) defs.Err_t {
+	panic("no imp")
+}
+
+var _susid uint64
+
+func susid_new() int {
+	newid := atomic.AddUint64(&_susid, 1)
+	return int(newid)
+}
+
+type allsusl_t struct {
+	m map[int]*susl_t
+	sync.Mutex
+}
+
+var allsusl = allsusl_t{m: map[int]*susl_t{}}
+
+// listening unix stream socket
+type susl_t struct {
+	sync.Mutex
+	waiters         []_suslblog_t
+	pollers         fdops.Pollers_t
+	opencount       int
+	mysid           int
+	readyconnectors int
+}
+
+type _suslblog_t struct {
+	conn *pipe_t
+	acc  *pipe_t
+	cond *sync.Cond
+	err  defs.Err_t
+}
+
+func (susl *susl_t) susl_start(mysid, backlog int) {
+	blm := 64
+	if backlog < 0 || backlog > blm {
+		backlog = blm
+	}
+	susl.waiters = make([]_suslblog_t, backlog)
+	for i := range susl.waiters {
+		susl.waiters[i].cond = sync.NewCond(susl)
 	}
+	susl.opencount = 1
+	susl.mysid = mysid
+}
 
-	// elf_load() will create two copies of TLS section: one for the fresh
-	// copy and one for thread 0
-	freshtls, t0tls, tlssz, err := elfhdr.elf_load(p, file)
-	if err != 0 {
-		restore()
-		return int(err)
+func (susl *susl_t) _findbed(amconnector bool) (*_suslblog_t, bool) {
+	for i := range susl.waiters {
+		var chk *pipe_t
+		if amconnector {
+			chk = susl.waiters[i].conn
+		} else {
+			chk = susl.waiters[i].acc
+		}
+		if chk == nil {
+			return &susl.waiters[i], true
+		}
 	}
+	return nil, false
+}
 
-	// map new stack
-	numstkpages := 6
-	// +1 for the guard page
-	stksz := (numstkpages + 1) * mem.PGSIZE
-	stackva := p.Vm.Unusedva_inner(0x0ff<<39, stksz)
-	p.Vm.Vmadd_anon(stackva, mem.PGSIZE, 0)
-	p.Vm.Vmadd_anon(stackva+mem.PGSIZE, stksz-mem.PGSIZE, vm.PTE_U|vm.PTE_W)
-	stackva += stksz
-	// eagerly map first two pages for stack
-	stkeagermap := 2
-	for i := 0; i < stkeagermap; i++ {
-		ptr := uintptr(stackva - (i+1)*mem.PGSIZE)
-		_, p_pg, ok := physmem.Refpg_new()
-		if !ok {
-			restore()
-			return int(-defs.ENOMEM)
+func (susl *susl_t) _findwaiter(getacceptor bool) (*_suslblog_t, bool) {
+	for i := range susl.waiters {
+		var chk *pipe_t
+		var oth *pipe_t
+		if getacceptor {
+			chk = susl.waiters[i].acc
+			oth = susl.waiters[i].conn
+		} else {
+			chk = susl.waiters[i].conn
+			oth = susl.waiters[i].acc
 		}
-		_, ok = p.Vm.Page_insert(int(ptr), p_pg, vm.PTE_W|vm.PTE_U, true, nil)
-		if !ok {
-			restore()
-			return int(-defs.ENOMEM)
+		if chk != nil && oth == nil {
+			return &susl.waiters[i], true
 		}
 	}
+	return nil, false
+}
 
-	// XXX make insertargs not fail by using more than a page...
-	argc, argv, err := insertargs(p, args)
-	if err != 0 {
-		restore()
-		return int(err)
+func (susl *susl_t) _slotreset(slot *_suslblog_t) {
+	slot.acc = nil
+	slot.conn = nil
+}
+
+func (susl *susl_t) _getpartner(mypipe *pipe_t, getacceptor,
+	noblk bool) (*pipe_t, defs.Err_t) {
+	susl.Lock()
+	if susl.opencount == 0 {
+		susl.Unlock()
+		return nil, -defs.EBADF
 	}
 
-	// put special struct on stack: fresh tls start, tls len, and tls0
-	// pointer
-	words := 4
-	buf := make([]uint8, words*8)
-	writen(buf, 8, 0, freshtls)
-	writen(buf, 8, 8, tlssz)
-	writen(buf, 8, 16, t0tls)
-	writen(buf, 8, 24, int(runtime.Pspercycle))
-	bufdest := stackva - words*8
-	tls0addr := bufdest + 2*8
+	var theirs *pipe_t
+	// fastpath: is there a peer already waiting?
+	s, found := susl._findwaiter(getacceptor)
+	if found {
+		if getacceptor {
+			theirs = s.acc
+			s.conn = mypipe
+		} else {
+			theirs = s.conn
+			s.acc = mypipe
+		}
+		susl.Unlock()
+		s.cond.Signal()
+		return theirs, 0
+	}
+	if noblk {
+		susl.Unlock()
+		return nil, -defs.EWOULDBLOCK
+	}
+	// darn. wait for a peer.
+	b, found := susl._findbed(getacceptor)
+	if !found {
+		// backlog is full
+		susl.Unlock()
+		if !getacceptor {
+			panic("fixme: allow more accepts than backlog")
+		}
+		return nil, -defs.ECONNREFUSED
+	}
+	if getacceptor {
+		b.conn = mypipe
+		susl.pollers.Wakeready(fdops.R_READ)
+	} else {
+		b.acc = mypipe
+	}
+	if getacceptor {
+		susl.readyconnectors++
+	}
+	err := proc.KillableWait(b.cond)
+	if err == 0 {
+		err = b.err
+	}
+	if getacceptor {
+		theirs = b.acc
+	} else {
+		theirs = b.conn
+	}
+	susl._slotreset(b)
+	if getacceptor {
+		susl.readyconnectors--
+	}
+	susl.Unlock()
+	return theirs, err
+}
 
-	if err := p.Vm.K2user_inner(buf, bufdest); err != 0 {
-		restore()
-		return int(err)
+func (susl *susl_t) connectwait(mypipe *pipe_t) (*pipe_t, defs.Err_t) {
+	noblk := false
+	return susl._getpartner(mypipe, true, noblk)
+}
+
+func (susl *susl_t) acceptwait(mypipe *pipe_t) (*pipe_t, defs.Err_t) {
+	noblk := false
+	return susl._getpartner(mypipe, false, noblk)
+}
+
+func (susl *susl_t) acceptnowait(mypipe *pipe_t) (*pipe_t, defs.Err_t) {
+	noblk := true
+	return susl._getpartner(mypipe, false, noblk)
+}
+
+func (susl *susl_t) susl_reopen(delta int) defs.Err_t {
+	ret := defs.Err_t(0)
+	dorem := false
+	susl.Lock()
+	if susl.opencount != 0 {
+		susl.opencount += delta
+		if susl.opencount == 0 {
+			dorem = true
+		}
+	} else {
+		ret = -defs.EBADF
+	}
+
+	if dorem {
+		limits.Syslimit.Socks.Give()
+		// wake up all blocked connectors/acceptors/pollers
+		for i := range susl.waiters {
+			s := &susl.waiters[i]
+			a := s.acc
+			b := s.conn
+			if a == nil && b == nil {
+				continue
+			}
+			s.err = -defs.ECONNRESET
+			s.cond.Signal()
+		}
+		susl.pollers.Wakeready(fdops.R_READ | fdops.R_HUP | fdops.R_ERROR)
+	}
+
+	susl.Unlock()
+	if dorem {
+		allsusl.Lock()
+		delete(allsusl.m, susl.mysid)
+		allsusl.Unlock()
+	}
+	return ret
+}
+
+func (susl *susl_t) susl_poll(pm fdops.Pollmsg_t) (fdops.Ready_t, defs.Err_t) {
+	susl.Lock()
+	if susl.opencount == 0 {
+		susl.Unlock()
+		return 0, 0
+	}
+	if pm.Events&fdops.R_READ != 0 {
+		if susl.readyconnectors > 0 {
+			susl.Unlock()
+			return fdops.R_READ, 0
+		}
+	}
+	var err defs.Err_t
+	if pm.Dowait {
+		err = susl.pollers.Addpoller(&pm)
+	}
+	susl.Unlock()
+	return 0, err
+}
+
+type suslfops_t struct {
+	susl    *susl_t
+	myaddr  ustr.Ustr
+	options defs.Fdopt_t
+}
+
+func (sf *suslfops_t) Close() defs.Err_t {
+	return sf.susl.susl_reopen(-1)
+}
+
+func (sf *suslfops_t) Fstat(*stat.Stat_t) defs.Err_t {
+	panic("no imp")
+}
+
+func (sf *suslfops_t) Lseek(int, int) (int, defs.Err_t) {
+	return 0, -defs.ESPIPE
+}
+
+func (sf *suslfops_t) Mmapi(int, int, bool) ([]mem.Mmapinfo_t, defs.Err_t) {
+	return nil, -defs.ENODEV
+}
+
+func (sf *suslfops_t) Pathi() defs.Inum_t {
+	panic("unix stream listener cwd?")
+}
+
+func (sf *suslfops_t) Read(fdops.Userio_i) (int, defs.Err_t) {
+	return 0, -defs.ENOTCONN
+}
+
+func (sf *suslfops_t) Reopen() defs.Err_t {
+	return sf.susl.susl_reopen(1)
+}
+
+func (sf *suslfops_t) Write(fdops.Userio_i) (int, defs.Err_t) {
+	return 0, -defs.EPIPE
+}
+
+func (sf *suslfops_t) Truncate(newlen uint) defs.Err_t {
+	return -defs.EINVAL
+}
+
+func (sf *suslfops_t) Pread(dst fdops.Userio_i, offset int) (int, defs.Err_t) {
+	return 0, -defs.ESPIPE
+}
+
+func (sf *suslfops_t) Pwrite(src fdops.Userio_i, offset int) (int, defs.Err_t) {
+	return 0, -defs.ESPIPE
+}
+
+func (sf *suslfops_t) Accept(fromsa fdops.Userio_i) (fdops.Fdops_i, int, defs.Err_t) {
+	// the connector has already taken syslimit.Socks (1 sock reservation
+	// counts for a connected pair of UNIX stream sockets).
+	noblk := sf.options&defs.O_NONBLOCK != 0
+	pipein := &pipe_t{}
+	pipein.pipe_start()
+	var pipeout *pipe_t
+	var err defs.Err_t
+	if noblk {
+		pipeout, err = sf.susl.acceptnowait(pipein)
+	} else {
+		pipeout, err = sf.susl.acceptwait(pipein)
+	}
+	if err != 0 {
+		return nil, 0, err
+	}
+	pfin := &pipefops_t{pipe: pipein, options: sf.options}
+	pfout := &pipefops_t{pipe: pipeout, writer: true, options: sf.options}
+	ret := &susfops_t{pipein: pfin, pipeout: pfout, conn: true,
+		options: sf.options}
+	return ret, 0, 0
+}
+
+func (sf *suslfops_t) Bind([]uint8) defs.Err_t {
+	return -defs.EINVAL
+}
+
+func (sf *suslfops_t) Connect(sabuf []uint8) defs.Err_t {
+	return -defs.EINVAL
+}
+
+func (sf *suslfops_t) Listen(backlog int) (fdops.Fdops_i, defs.Err_t) {
+	return nil, -defs.EINVAL
+}
+
+func (sf *suslfops_t) Sendmsg(fdops.Userio_i, []uint8, []uint8,
+	int) (int, defs.Err_t) {
+	return 0, -defs.ENOTCONN
+}
+
+func (sf *suslfops_t) Recvmsg(fdops.Userio_i, fdops.Userio_i,
+	fdops.Userio_i, int) (int, int, int, defs.Msgfl_t, defs.Err_t) {
+	return 0, 0, 0, 0, -defs.ENOTCONN
+}
+
+func (sf *suslfops_t) Pollone(pm fdops.Pollmsg_t) (fdops.Ready_t, defs.Err_t) {
+	return sf.susl.susl_poll(pm)
+}
+
+func (sf *suslfops_t) Fcntl(cmd, opt int) int {
+	switch cmd {
+	case defs.F_GETFL:
+		return int(sf.options)
+	case defs.F_SETFL:
+		sf.options = defs.Fdopt_t(opt)
+		return 0
+	default:
+		panic("weird cmd")
+	}
+}
+
+func (sf *suslfops_t) Getsockopt(opt int, bufarg fdops.Userio_i,
+	intarg int) (int, defs.Err_t) {
+	return 0, -defs.EOPNOTSUPP
+}
+
+func (sf *suslfops_t) Setsockopt(int, int, fdops.Userio_i, int) defs.Err_t {
+	return -defs.EOPNOTSUPP
+}
+
+func (sf *suslfops_t) Shutdown(read, write bool) defs.Err_t {
+	return -defs.ENOTCONN
+}
+
+func sys_listen(p *proc.Proc_t, fdn, backlog int) int {
+	fd, ok := p.Fd_get(fdn)
+	if !ok {
+		return int(-defs.EBADF)
+	}
+	if backlog < 0 {
+		backlog = 0
+	}
+	newfops, err := fd.Fops.Listen(backlog)
+	if err != 0 {
+		return int(err)
+	}
+	// replace old fops
+	p.Fdl.Lock()
+	fd.Fops = newfops
+	p.Fdl.Unlock()
+	return 0
+}
+
+func sys_getsockopt(p *proc.Proc_t, fdn, level, opt, optvaln, optlenn int) int {
+	if level != defs.SOL_SOCKET {
+		panic("no imp")
+	}
+	var olen int
+	if optlenn != 0 {
+		l, err := p.Vm.Userreadn(optlenn, 8)
+		if err != 0 {
+			return int(err)
+		}
+		if l < 0 {
+			return int(-defs.EFAULT)
+		}
+		olen = l
+	}
+	bufarg := p.Vm.Mkuserbuf(optvaln, olen)
+	// XXX why intarg??
+	intarg := optvaln
+	fd, ok := p.Fd_get(fdn)
+	if !ok {
+		return int(-defs.EBADF)
+	}
+	optwrote, err := fd.Fops.Getsockopt(opt, bufarg, intarg)
+	if err != 0 {
+		return int(err)
+	}
+	if optlenn != 0 {
+		if err := p.Vm.Userwriten(optlenn, 8, optwrote); err != 0 {
+			return int(err)
+		}
+	}
+	return 0
+}
+
+func sys_setsockopt(p *proc.Proc_t, fdn, level, opt, optvaln, optlenn int) int {
+	if optlenn < 0 {
+		return int(-defs.EFAULT)
+	}
+	var intarg int
+	if optlenn >= 4 {
+		var err defs.Err_t
+		intarg, err = p.Vm.Userreadn(optvaln, 4)
+		if err != 0 {
+			return int(err)
+		}
+	}
+	bufarg := p.Vm.Mkuserbuf(optvaln, optlenn)
+	fd, ok := p.Fd_get(fdn)
+	if !ok {
+		return int(-defs.EBADF)
+	}
+	err := fd.Fops.Setsockopt(level, opt, bufarg, intarg)
+	return int(err)
+}
+
+func sys_fork(parent *proc.Proc_t, ptf *[defs.TFSIZE]uintptr, tforkp int, flags int) int {
+	tmp := flags & (defs.FORK_THREAD | defs.FORK_PROCESS)
+	if tmp != defs.FORK_THREAD && tmp != defs.FORK_PROCESS {
+		return int(-defs.EINVAL)
+	}
+
+	if flags&defs.FORK_PROCESS != 0 {
+		child, chtf, err := _fork_proc(parent, ptf, 0)
+		if err != 0 {
+			return int(err)
+		}
+		child.Sched_add(chtf, child.Tid0())
+		return child.Pid
+	}
+
+	// validate tfork struct
+	tcb, err1 := parent.Vm.Userreadn(tforkp+0, 8)
+	tidaddrn, err2 := parent.Vm.Userreadn(tforkp+8, 8)
+	stack, err3 := parent.Vm.Userreadn(tforkp+16, 8)
+	if err1 != 0 {
+		return int(err1)
+	}
+	if err2 != 0 {
+		return int(err2)
+	}
+	if err3 != 0 {
+		return int(err3)
+	}
+	childtid, chtf, err := _fork_thread(parent, ptf, stack)
+	if err != 0 {
+		return int(err)
+	}
+	if tcb != 0 {
+		chtf[defs.TF_FSBASE] = uintptr(tcb)
+	}
+	v := int(childtid)
+	if tidaddrn != 0 {
+		// it is not a fatal error if some thread unmapped the
+		// memory that was supposed to hold the new thread's
+		// tid out from under us.
+		parent.Vm.Userwriten(tidaddrn, 8, v)
+	}
+	parent.Sched_add(chtf, childtid)
+	return v
+}
+
+// creates a child process of parent. the child shares the parent's address
+// space, fd table, and working directory if flags contains CLONE_VM,
+// CLONE_FILES, and CLONE_FS, respectively, and gets copies of them otherwise.
+// returns the child and the trap frame with which to schedule its first
+// thread; the child returns 0 from the system call.
+func _fork_proc(parent *proc.Proc_t, ptf *[defs.TFSIZE]uintptr,
+	flags int) (*proc.Proc_t, *[defs.TFSIZE]uintptr, defs.Err_t) {
+	// copy parents trap frame
+	chtf := &[defs.TFSIZE]uintptr{}
+	*chtf = *ptf
+	chtf[defs.TF_RAX] = 0
+
+	var doflush bool
+	var fdt *proc.Fdtable_t
+	if flags&defs.CLONE_FILES != 0 {
+		fdt = parent.Fdtable_t.Share()
+	} else {
+		fdt = parent.Fdtable_t.Copy()
+	}
+	var cwd *fd.Cwd_t
+	if flags&defs.CLONE_FS != 0 {
+		cwd = parent.Cwd.Share()
+	} else {
+		cwd = parent.Cwd.Copy()
+	}
+	child, ok := proc.Proc_new(parent.Name, cwd, fdt, sys, parent.Cgroup())
+	if !ok {
+		fdt.Release()
+		cwd.Release()
+		lhits++
+		return nil, nil, -defs.ENOMEM
+	}
+	child.Personality = parent.Personality
+	child.Abi = parent.Abi
+	child.Oom_inherit(parent)
+	child.Ulim = parent.Ulim
+
+	if flags&defs.CLONE_VM != 0 {
+		child.Vm_set(parent.Vm.Share())
+	} else {
+		child.Vm.Pmap, child.Vm.P_pmap, ok = physmem.Pmap_new()
+		if !ok {
+			goto outproc
+		}
+		physmem.Refup(child.Vm.P_pmap)
+	}
+
+	child.Pwait = &parent.Mywait
+	ok = parent.Start_proc(child.Pid)
+	if !ok {
+		lhits++
+		goto outmem
+	}
+	if flags&defs.CLONE_VM != 0 {
+		return child, chtf, 0
+	}
+
+	// fork parent address space
+	parent.Vm.Lock_pmap()
+	doflush, ok = parent.Vm_fork(child, chtf[defs.TF_RSP])
+	if ok && !doflush {
+		panic("no writable segs?")
+	}
+	// flush all ptes now marked COW
+	if doflush {
+		parent.Tlbflush()
+	}
+	parent.Vm.Unlock_pmap()
+
+	if !ok {
+		// child page table allocation failed. call
+		// proc.Proc_t.terminate which will clean everything up. the
+		// parent will get th error code directly.
+		child.Thread_dead(child.Tid0(), 0, false)
+		return nil, nil, -defs.ENOMEM
+	}
+	return child, chtf, 0
+outmem:
+	if flags&defs.CLONE_VM != 0 {
+		child.Vm.Release()
+	} else {
+		physmem.Refdown(child.Vm.P_pmap)
+	}
+outproc:
+	proc.Tid_del()
+	proc.Proc_del(child.Pid)
+	child.Fdtable_t.Release()
+	child.Cwd.Release()
+	return nil, nil, -defs.ENOMEM
+}
+
+// creates a new thread of parent which starts with the stack pointer stack.
+// returns the thread's id and the trap frame with which to schedule it; the
+// thread returns 0 from the system call.
+func _fork_thread(parent *proc.Proc_t, ptf *[defs.TFSIZE]uintptr,
+	stack int) (defs.Tid_t, *[defs.TFSIZE]uintptr, defs.Err_t) {
+	childtid, ok := parent.Thread_new()
+	if !ok {
+		lhits++
+		return 0, nil, -defs.ENOMEM
+	}
+	ok = parent.Start_thread(childtid)
+	if !ok {
+		lhits++
+		parent.Thread_undo(childtid)
+		return 0, nil, -defs.ENOMEM
+	}
+	chtf := &[defs.TFSIZE]uintptr{}
+	*chtf = *ptf
+	chtf[defs.TF_RSP] = uintptr(stack)
+	chtf[defs.TF_RAX] = 0
+	return childtid, chtf, 0
+}
+
+// creates a thread or a process like Linux's clone(2). a thread shares
+// everything with its creator, while a process shares its creator's address
+// space, fd table, and working directory only if flags contains CLONE_VM,
+// CLONE_FILES, and CLONE_FS. there are no signal handlers to share, thus
+// CLONE_SIGHAND only requires CLONE_VM, like Linux. the creator of a
+// CLONE_VFORK process sleeps until the process execs or terminates. the exit
+// signal in the low byte of flags is ignored since parents learn of exits via
+// wait4.
+func sys_clone(p *proc.Proc_t, tf *[defs.TFSIZE]uintptr, flags, newsp,
+	ptidn, ctidn, tls int) int {
+	const thread = defs.CLONE_VM | defs.CLONE_FS | defs.CLONE_FILES |
+		defs.CLONE_SIGHAND | defs.CLONE_THREAD
+	const share = defs.CLONE_VM | defs.CLONE_FS | defs.CLONE_FILES |
+		defs.CLONE_SIGHAND | defs.CLONE_VFORK
+	const opt = defs.CLONE_SYSVSEM | defs.CLONE_SETTLS |
+		defs.CLONE_PARENT_SETTID | defs.CLONE_CHILD_SETTID |
+		defs.CLONE_CHILD_CLEARTID | defs.CLONE_DETACHED
+	if flags&defs.CLONE_SIGHAND != 0 && flags&defs.CLONE_VM == 0 {
+		return int(-defs.EINVAL)
+	}
+	if flags&defs.CLONE_SETTLS != 0 && uint(tls) >= uint(mem.USERMAX) {
+		return int(-defs.EPERM)
+	}
+
+	var child *proc.Proc_t
+	var ctid defs.Tid_t
+	var chtf *[defs.TFSIZE]uintptr
+	var err defs.Err_t
+	var ret int
+	var vforkc <-chan bool
+	switch {
+	case flags&^opt == thread:
+		stack := newsp
+		if stack == 0 {
+			stack = int(tf[defs.TF_RSP])
+		}
+		child = p
+		ctid, chtf, err = _fork_thread(p, tf, stack)
+		ret = int(ctid)
+	case flags&^(opt|share|defs.CLONE_SIGMASK) == 0:
+		child, chtf, err = _fork_proc(p, tf, flags)
+		if err == 0 {
+			ctid = child.Tid0()
+			ret = child.Pid
+			if newsp != 0 {
+				chtf[defs.TF_RSP] = uintptr(newsp)
+			}
+			if flags&defs.CLONE_VFORK != 0 {
+				vforkc = child.Vfork_start()
+			}
+		}
+	default:
+		return int(-defs.EINVAL)
+	}
+	if err != 0 {
+		return int(err)
+	}
+	if flags&defs.CLONE_SETTLS != 0 {
+		chtf[defs.TF_FSBASE] = uintptr(tls)
+	}
+	// like Linux, failing to write the tids is not an error
+	if flags&defs.CLONE_PARENT_SETTID != 0 {
+		p.Vm.Userwriten(ptidn, 4, ret)
+	}
+	if flags&defs.CLONE_CHILD_SETTID != 0 {
+		child.Vm.Userwriten(ctidn, 4, ret)
+	}
+	if flags&defs.CLONE_CHILD_CLEARTID != 0 {
+		child.Set_cleartid(ctid, ctidn)
+	}
+	child.Sched_add(chtf, ctid)
+	if vforkc != nil {
+		// the child may be using our stack
+		select {
+		case <-vforkc:
+		case <-tinfo.Current().Killnaps.Killch:
+		}
+	}
+	return ret
+}
+
+// zeroes the clear-tid address of the calling thread, set by
+// CLONE_CHILD_CLEARTID, and wakes its futex so that the threads and processes
+// joining the exiting thread notice the exit.
+func _cleartid(p *proc.Proc_t) {
+	if ctid := tinfo.Current().Cleartid; ctid != 0 {
+		if p.Vm.Userwriten(ctid, 4, 0) == 0 {
+			_futex(p, defs.FUTEX_WAKE, uintptr(ctid), 0, ^uint32(0),
+				time.Time{}, false)
+		}
+	}
+}
+
+func sys_execv(p *proc.Proc_t, tf *[defs.TFSIZE]uintptr, pathn, argn,
+	envn int) int {
+	path, args, env, err := _execargs(p, pathn, argn, envn)
+	if err != 0 {
+		return int(err)
+	}
+	ret := sys_execv1(p, tf, path, args, env)
+	if ret == 0 {
+		// the clear-tid address belongs to the old image
+		tinfo.Current().Cleartid = 0
+	}
+	return ret
+}
+
+// reads the executable path and the argument and environment strings of
+// execv and spawn
+func _execargs(p *proc.Proc_t, pathn, argn, envn int) (ustr.Ustr,
+	[]ustr.Ustr, []ustr.Ustr, defs.Err_t) {
+	args, err := p.Userargs(argn)
+	if err != 0 {
+		return nil, nil, nil, err
+	}
+	env, err := p.Userargs(envn)
+	if err != 0 {
+		return nil, nil, nil, err
+	}
+	path, err := p.Vm.Userstr(pathn, fs.NAME_MAX)
+	if err != 0 {
+		return nil, nil, nil, err
+	}
+	if err := badpath(path); err != 0 {
+		return nil, nil, nil, err
+	}
+	return path, args, env, 0
+}
+
+// the layout of a spawn file action: the operation, the target fd, the source
+// fd of SPAWN_DUP2 or the flags of SPAWN_OPEN, the mode of SPAWN_OPEN, and the
+// path of SPAWN_OPEN.
+const (
+	_spawnactsz  = 24
+	_spawnactmax = 64
+)
+
+type spawnact_t struct {
+	op   int
+	fd   int
+	arg  int
+	mode int
+	path ustr.Ustr
+}
+
+// reads the file actions of spawn
+func _spawnacts(p *proc.Proc_t, actn, nact int) ([]spawnact_t, defs.Err_t) {
+	if nact < 0 || nact > _spawnactmax {
+		return nil, -defs.EINVAL
+	}
+	ret := make([]spawnact_t, nact)
+	for i := range ret {
+		va := actn + i*_spawnactsz
+		var flds [4]int
+		for j := range flds {
+			v, err := p.Vm.Userreadn(va+4*j, 4)
+			if err != 0 {
+				return nil, err
+			}
+			flds[j] = int(int32(v))
+		}
+		a := &ret[i]
+		a.op, a.fd, a.arg, a.mode = flds[0], flds[1], flds[2], flds[3]
+		if a.fd < 0 {
+			return nil, -defs.EBADF
+		}
+		switch a.op {
+		case defs.SPAWN_DUP2, defs.SPAWN_CLOSE:
+		case defs.SPAWN_OPEN:
+			pathn, err := p.Vm.Userreadn(va+16, 8)
+			if err != 0 {
+				return nil, err
+			}
+			a.path, err = p.Vm.Userstr(pathn, fs.NAME_MAX)
+			if err != 0 {
+				return nil, err
+			}
+		default:
+			return nil, -defs.EINVAL
+		}
+	}
+	return ret, 0
+}
+
+// applies the file actions, in order, to the fd table of the new process c
+func _spawnfds(c *proc.Proc_t, acts []spawnact_t) defs.Err_t {
+	for _, a := range acts {
+		switch a.op {
+		case defs.SPAWN_DUP2:
+			// duplicating an fd onto itself clears its close-on-exec
+			// flag, like posix_spawn
+			if a.arg == a.fd {
+				if !c.Fd_cloexec(a.fd, false) {
+					return -defs.EBADF
+				}
+			} else if ret := _dup3(c, a.arg, a.fd, false); ret < 0 {
+				return defs.Err_t(ret)
+			}
+		case defs.SPAWN_CLOSE:
+			// like glibc, closing an fd which is not open is not an
+			// error
+			sys.Sys_close(c, a.fd)
+		case defs.SPAWN_OPEN:
+			file, perms, err := _open(c, a.path, a.arg, a.mode)
+			if err != 0 {
+				return err
+			}
+			fdn, ok := c.Fd_insert(file, perms)
+			if !ok {
+				fd.Close_panic(file)
+				return -defs.EMFILE
+			}
+			if fdn != a.fd {
+				cloexec := perms&fd.FD_CLOEXEC != 0
+				ret := _dup3(c, fdn, a.fd, cloexec)
+				sys.Sys_close(c, fdn)
+				if ret < 0 {
+					return defs.Err_t(ret)
+				}
+			}
+		}
+	}
+	return 0
+}
+
+// creates a process running the executable at pathn, like a fork followed by
+// an exec, but without copying the address space of p. the child gets a copy
+// of p's fd table to which the file actions are applied before the exec.
+// returns the child's pid.
+func sys_spawn(p *proc.Proc_t, pathn, argn, envn, actn, nact int) int {
+	path, args, env, err := _execargs(p, pathn, argn, envn)
+	if err != 0 {
+		return int(err)
+	}
+	acts, err := _spawnacts(p, actn, nact)
+	if err != 0 {
+		return int(err)
+	}
+
+	fdt := p.Fdtable_t.Copy()
+	cwd := p.Cwd.Copy()
+	child, ok := proc.Proc_new(path, cwd, fdt, sys, p.Cgroup())
+	if !ok {
+		fdt.Release()
+		cwd.Release()
+		lhits++
+		return int(-defs.ENOMEM)
+	}
+	child.Personality = p.Personality
+	child.Oom_inherit(p)
+	child.Ulim = p.Ulim
+
+	// the child has no address space yet, thus the exec only loads the
+	// new image
+	var tf [defs.TFSIZE]uintptr
+	if err = _spawnfds(child, acts); err == 0 {
+		if ret := sys_execv1(child, &tf, path, args, env); ret != 0 {
+			err = defs.Err_t(ret)
+		}
+	}
+	if err == 0 {
+		child.Pwait = &p.Mywait
+		if !p.Start_proc(child.Pid) {
+			lhits++
+			child.Vm.Release()
+			err = -defs.ENOMEM
+		}
+	}
+	if err != 0 {
+		proc.Tid_del()
+		proc.Proc_del(child.Pid)
+		child.Fdtable_t.Release()
+		child.Cwd.Release()
+		return int(err)
+	}
+	child.Sched_add(&tf, child.Tid0())
+	return child.Pid
+}
+
+// the maximum number of nested #! interpreters
+const _maxinterp = 4
+
+// opens the executable and reads its first block
+func _execopen(p *proc.Proc_t, paths ustr.Ustr) (*fd.Fd_t, []uint8, defs.Err_t) {
+	file, err := thefs.Fs_open(paths, defs.O_RDONLY, 0, p.Cwd, 0, 0)
+	if err != 0 {
+		return nil, nil, err
+	}
+	hdata := make([]uint8, 512)
+	ub := &vm.Fakeubuf_t{}
+	ub.Fake_init(hdata)
+	ret, err := file.Fops.Read(ub)
+	if err != 0 {
+		fd.Close_panic(file)
+		return nil, nil, err
+	}
+	if ret < len(hdata) {
+		hdata = hdata[0:ret]
+	}
+	return file, hdata, 0
+}
+
+func _isscript(hdata []uint8) bool {
+	return len(hdata) >= 2 && hdata[0] == '#' && hdata[1] == '!'
+}
+
+// parses the "#!interpreter [arg]" line at the start of a script. like Linux,
+// everything following the interpreter path is passed as a single argument.
+func _shebang(hdata []uint8) (ustr.Ustr, ustr.Ustr, defs.Err_t) {
+	line := hdata[2:]
+	end := -1
+	for i, c := range line {
+		if c == '\n' {
+			end = i
+			break
+		}
+	}
+	if end == -1 {
+		// the interpreter line must fit in the first block
+		return nil, nil, -defs.ENOEXEC
+	}
+	line = line[:end]
+	isspace := func(c uint8) bool {
+		return c == ' ' || c == '\t' || c == '\r'
+	}
+	trim := func(b []uint8) []uint8 {
+		for len(b) > 0 && isspace(b[0]) {
+			b = b[1:]
+		}
+		for len(b) > 0 && isspace(b[len(b)-1]) {
+			b = b[:len(b)-1]
+		}
+		return b
+	}
+	line = trim(line)
+	i := 0
+	for i < len(line) && !isspace(line[i]) {
+		i++
+	}
+	interp := ustr.Ustr(line[:i])
+	if len(interp) == 0 {
+		return nil, nil, -defs.ENOEXEC
+	}
+	var iarg ustr.Ustr
+	if rest := trim(line[i:]); len(rest) != 0 {
+		iarg = ustr.Ustr(rest)
+	}
+	return interp, iarg, 0
+}
+
+var _zvmregion vm.Vmregion_t
+
+func sys_execv1(p *proc.Proc_t, tf *[defs.TFSIZE]uintptr, paths ustr.Ustr,
+	args []ustr.Ustr, env []ustr.Ustr) int {
+	// XXX a multithreaded process that execs is broken; POSIX2008 says
+	// that all threads should terminate before exec.
+	if p.Thread_count() > 1 {
+		panic("fix exec with many threads")
+	}
+
+	// load binary image -- get first block of file. scripts are executed
+	// by their interpreter, which gets the script path as an argument.
+	name := paths
+	file, hdata, err := _execopen(p, paths)
+	if err != 0 {
+		return int(err)
+	}
+	for depth := 0; _isscript(hdata); depth++ {
+		fd.Close_panic(file)
+		if depth >= _maxinterp {
+			return int(-defs.ELOOP)
+		}
+		interp, iarg, err := _shebang(hdata)
+		if err != 0 {
+			return int(err)
+		}
+		nargs := []ustr.Ustr{interp}
+		if iarg != nil {
+			nargs = append(nargs, iarg)
+		}
+		nargs = append(nargs, paths)
+		if len(args) > 1 {
+			nargs = append(nargs, args[1:]...)
+		}
+		paths, args = interp, nargs
+		file, hdata, err = _execopen(p, paths)
+		if err != 0 {
+			return int(err)
+		}
+	}
+	defer fd.Close_panic(file)
+
+	// assume its always an elf, for now
+	elfhdr := &elf_t{data: hdata}
+	if !elfhdr.sanity() {
+		return int(-defs.ENOEXEC)
+	}
+	// programs built for Linux use its system call ABI. they are
+	// recognized by their ELF OS ABI or run via the Linux personality.
+	abi := defs.PER_BISCUIT
+	if p.Personality&defs.PER_MASK == defs.PER_LINUX ||
+		elfhdr.osabi() == ELFOSABI_LINUX {
+		abi = defs.PER_LINUX
+		// the addresses below USERMIN are reserved for the kernel,
+		// thus only position-independent images can be loaded
+		if elfhdr.lowsegs() {
+			return int(-defs.ENOEXEC)
+		}
+	}
+
+	// dynamically linked executables are started by their program
+	// interpreter, which is given the auxiliary vector to find the
+	// executable.
+	ipath, isdyn, err := elfhdr.interp(file)
+	if err != 0 {
+		return int(err)
+	}
+	var ielf *elf_t
+	var ifile *fd.Fd_t
+	if isdyn {
+		if err := badpath(ipath); err != 0 {
+			return int(err)
+		}
+		var idata []uint8
+		ifile, idata, err = _execopen(p, ipath)
+		if err != 0 {
+			return int(err)
+		}
+		defer fd.Close_panic(ifile)
+		ielf = &elf_t{data: idata}
+		if !ielf.sanity() {
+			return int(-defs.ENOEXEC)
+		}
+		// the interpreter cannot itself require an interpreter
+		if _, nested, err := ielf.interp(ifile); err != 0 || nested {
+			return int(-defs.ENOEXEC)
+		}
+	}
+
+	// a process sharing its address space, such as a vfork child, loads
+	// the image into a new address space and leaves the shared one to the
+	// other processes
+	var svm *vm.Vm_t
+	if p.Vm.Shared() {
+		svm = p.Vm
+		p.Vm_set(vm.Mkvm(p.Cgroup()))
+	}
+
+	p.Vm.Lock_pmap()
+	defer p.Vm.Unlock_pmap()
+
+	// save page trackers in case the exec fails
+	ovmreg := p.Vm.Vmregion
+	p.Vm.Vmregion = _zvmregion
+	// the largest resident set survives the exec
+	orss := p.Vm.Rss
+	p.Vm.Rss = vm.Rss_t{Max: orss.Max, Cg: orss.Cg}
+
+	// create kernel page table
+	opmap := p.Vm.Pmap
+	op_pmap := p.Vm.P_pmap
+	var ok bool
+	p.Vm.Pmap, p.Vm.P_pmap, ok = physmem.Pmap_new()
+	if !ok {
+		p.Vm.Pmap, p.Vm.P_pmap = opmap, op_pmap
+		if svm != nil {
+			p.Vm_set(svm)
+		}
+		return int(-defs.ENOMEM)
+	}
+	physmem.Refup(p.Vm.P_pmap)
+	for _, e := range mem.Kents {
+		p.Vm.Pmap[e.Pml4slot] = e.Entry
+	}
+
+	restore := func() {
+		vm.Uvmfree_inner(p.Vm.Pmap, p.Vm.P_pmap, &p.Vm.Vmregion)
+		physmem.Refdown(p.Vm.P_pmap)
+		p.Vm.Vmregion.Clear()
+		p.Vm.Pmap = opmap
+		p.Vm.P_pmap = op_pmap
+		p.Vm.Vmregion = ovmreg
+		p.Vm.Rss.Release()
+		p.Vm.Rss = orss
+		if svm != nil {
+			p.Vm_set(svm)
+		}
+	}
+
+	// elf_load() will create two copies of TLS section: one for the fresh
+	// copy and one for thread 0
+	freshtls, t0tls, tlssz, err := elfhdr.elf_load(p, file)
+	if err != 0 {
+		restore()
+		return int(err)
+	}
+	entry := elfhdr.entry()
+	ibase := 0
+	if ielf != nil {
+		if err := ielf.interp_load(p, ifile); err != 0 {
+			restore()
+			return int(err)
+		}
+		entry = ielf.entry()
+		ibase = ielf.base
+	}
+
+	// map new stack
+	numstkpages := 6
+	if abi == defs.PER_LINUX {
+		numstkpages = _linuxstkpages
+	}
+	// +1 for the guard page
+	stksz := (numstkpages + 1) * mem.PGSIZE
+	stackva := p.Vm.Unusedva_inner(_stackbase+aslr_off(p), stksz)
+	p.Vm.Vmadd_anon(stackva, mem.PGSIZE, 0)
+	p.Vm.Vmadd_stack(stackva+mem.PGSIZE, stksz-mem.PGSIZE, vm.PTE_U|vm.PTE_W,
+		elfhdr.execstack())
+	stackva += stksz
+	// eagerly map first two pages for stack
+	stkeagermap := 2 * mem.PGSIZE
+	err = p.Vm.Populate(stackva-stkeagermap, stkeagermap, vm.PTE_W|vm.PTE_U)
+	if err != 0 {
+		restore()
+		return int(err)
+	}
+
+	argptrs, envptrs, err := insertargs(p, args, env)
+	if err != 0 {
+		restore()
+		return int(err)
+	}
+
+	// put special struct on stack: fresh tls start, tls len, and tls0
+	// pointer
+	words := 4
+	buf := make([]uint8, words*8)
+	writen(buf, 8, 0, freshtls)
+	writen(buf, 8, 8, tlssz)
+	writen(buf, 8, 16, t0tls)
+	writen(buf, 8, 24, int(runtime.Pspercycle))
+	bufdest := stackva - words*8
+	tls0addr := bufdest + 2*8
+
+	if err := p.Vm.K2user_inner(buf, bufdest); err != 0 {
+		restore()
+		return int(err)
+	}
+
+	// below the special struct, build argc, the argv and envp arrays, and
+	// the auxiliary vector just as the SysV amd64 ABI lays them out.
+	sp, argv, envp, err := insertauxv(p, elfhdr, ibase, bufdest, argptrs,
+		envptrs)
+	if err != 0 {
+		restore()
+		return int(err)
+	}
+
+	// the exec must succeed now; free old pmap/mapped files
+	if op_pmap != 0 {
+		vm.Uvmfree_inner(opmap, op_pmap, &ovmreg)
+		physmem.Dec_pmap(op_pmap)
+		orss.Release()
+	}
+	ovmreg.Clear()
+	if svm != nil {
+		svm.Release()
+	}
+	// the parent of a vfork child may run again
+	p.Vfork_done()
+
+	// close fds marked with CLOEXEC. a shared fd table is copied first
+	// so that the other processes keep their fds.
+	p.Fd_unshare()
+	for fdn, f := range p.Fds {
+		if f == nil {
+			continue
+		}
+		if f.Perms&fd.FD_CLOEXEC != 0 {
+			if sys.Sys_close(p, fdn) != 0 {
+				panic("close")
+			}
+		}
+	}
+
+	// commit new image state
+	tf[defs.TF_RSP] = uintptr(sp)
+	tf[defs.TF_RIP] = uintptr(entry)
+	tf[defs.TF_RFLAGS] = uintptr(defs.TF_FL_IF)
+	ucseg := uintptr(5)
+	udseg := uintptr(6)
+	tf[defs.TF_CS] = (ucseg << 3) | 3
+	tf[defs.TF_SS] = (udseg << 3) | 3
+	tf[defs.TF_RDI] = uintptr(len(argptrs))
+	tf[defs.TF_RSI] = uintptr(argv)
+	tf[defs.TF_RDX] = uintptr(bufdest)
+	tf[defs.TF_RCX] = uintptr(envp)
+	tf[defs.TF_FSBASE] = uintptr(tls0addr)
+	if abi == defs.PER_LINUX {
+		// Linux programs start with zeroed registers, except for the
+		// stack pointer, and set up their own TLS
+		for i := defs.TF_FSBASE; i <= defs.TF_RAX; i++ {
+			tf[i] = 0
+		}
+	}
+	p.Abi = abi
+	p.Mmapi = _mmapbase + aslr_off(p)
+	p.Name = name
+
+	return 0
+}
+
+// copies the argument and environment strings to freshly mapped user pages.
+// returns the user addresses of the strings.
+func insertargs(p *proc.Proc_t, sargs, senv []ustr.Ustr) ([]int, []int,
+	defs.Err_t) {
+	tot := 0
+	for _, str := range sargs {
+		tot += len(str) + 1
+	}
+	for _, str := range senv {
+		tot += len(str) + 1
+	}
+	l := util.Roundup(tot, mem.PGSIZE)
+	if l == 0 {
+		l = mem.PGSIZE
+	}
+	uva := p.Vm.Unusedva_inner(0, l)
+	p.Vm.Vmadd_anon(uva, l, vm.PTE_U)
+	for i := 0; i < l; i += mem.PGSIZE {
+		_, p_pg, ok := physmem.Refpg_new()
+		if !ok {
+			return nil, nil, -defs.ENOMEM
+		}
+		_, ok = p.Vm.Page_insert(uva+i, p_pg, vm.PTE_U, true, nil)
+		if !ok {
+			physmem.Refdown(p_pg)
+			return nil, nil, -defs.ENOMEM
+		}
+	}
+	buf := make([]uint8, 0, tot)
+	// add null terminators
+	copystrs := func(strs []ustr.Ustr) []int {
+		ptrs := make([]int, len(strs))
+		for i, str := range strs {
+			ptrs[i] = uva + len(buf)
+			buf = append(buf, str...)
+			buf = append(buf, 0)
+		}
+		return ptrs
+	}
+	argptrs := copystrs(sargs)
+	envptrs := copystrs(senv)
+	if err := p.Vm.K2user_inner(buf, uva); err != 0 {
+		return nil, nil, err
+	}
+	return argptrs, envptrs, 0
+}
+
+// writes argc, the NULL-terminated argv and envp pointer arrays, and the
+// auxiliary vector to the user stack below top. ibase is the load address of
+// the program interpreter, if any. returns the new stack pointer
+// and the user addresses of the argv and envp arrays.
+func insertauxv(p *proc.Proc_t, e *elf_t, ibase, top int, argptrs,
+	envptrs []int) (int, int, int, defs.Err_t) {
+	// 16 random bytes for AT_RANDOM, used by libcs to seed stack
+	// protectors and pointer guards. they are only unpredictable if the
+	// CPU has RDRAND; otherwise they come from the kernel's pool, which is
+	// not a cryptographically secure generator.
+	rnd := make([]uint8, 16)
+	entropy.Read(rnd)
+	rndva := top - len(rnd)
+	if err := p.Vm.K2user_inner(rnd, rndva); err != 0 {
+		return 0, 0, 0, err
+	}
+
+	auxv := []int{
+		defs.AT_PHDR, e.phdraddr(),
+		defs.AT_PHENT, e.phentsize(),
+		defs.AT_PHNUM, e.npheaders(),
+		defs.AT_PAGESZ, mem.PGSIZE,
+		defs.AT_BASE, ibase,
+		defs.AT_ENTRY, e.entry(),
+		defs.AT_UID, 0,
+		defs.AT_EUID, 0,
+		defs.AT_GID, 0,
+		defs.AT_EGID, 0,
+		defs.AT_SECURE, 0,
+		defs.AT_RANDOM, rndva,
+		defs.AT_NULL, 0,
+	}
+	vec := make([]int, 0, len(argptrs)+len(envptrs)+len(auxv)+3)
+	vec = append(vec, len(argptrs))
+	vec = append(vec, argptrs...)
+	vec = append(vec, 0)
+	vec = append(vec, envptrs...)
+	vec = append(vec, 0)
+	vec = append(vec, auxv...)
+
+	buf := make([]uint8, len(vec)*8)
+	for i, v := range vec {
+		writen(buf, 8, i*8, v)
+	}
+	// the ABI requires the stack pointer to be 16-byte aligned on entry
+	sp := util.Rounddown(rndva-len(buf), 16)
+	if err := p.Vm.K2user_inner(buf, sp); err != 0 {
+		return 0, 0, 0, err
+	}
+	argv := sp + 8
+	envp := argv + (len(argptrs)+1)*8
+	return sp, argv, envp, 0
+}
+
+func (s *syscall_t) Sys_exit(p *proc.Proc_t, tid defs.Tid_t, status int) {
+	// set doomed so all other threads die
+	p.Doomall()
+	p.Thread_dead(tid, status, true)
+}
+
+func sys_threxit(p *proc.Proc_t, tid defs.Tid_t, status int) {
+	_cleartid(p)
+	p.Thread_dead(tid, status, false)
+}
+
+func sys_wait4(p *proc.Proc_t, tid defs.Tid_t, wpid, statusp, options, rusagep,
+	_isthread int) int {
+	if wpid == defs.WAIT_MYPGRP || options == defs.WCONTINUED ||
+		options == defs.WUNTRACED {
+		panic("no imp")
+	}
+
+	// no waiting for yourself!
+	if tid == defs.Tid_t(wpid) {
+		return int(-defs.ECHILD)
+	}
+	isthread := _isthread != 0
+	if isthread && wpid == defs.WAIT_ANY {
+		return int(-defs.EINVAL)
+	}
+
+	noblk := options&defs.WNOHANG != 0
+	var resp proc.Waitst_t
+	var err defs.Err_t
+	if isthread {
+		resp, err = p.Mywait.Reaptid(wpid, noblk)
+	} else {
+		resp, err = p.Mywait.Reappid(wpid, noblk)
+	}
+
+	if err != 0 {
+		return int(err)
+	}
+	if isthread {
+		if statusp != 0 {
+			err := p.Vm.Userwriten(statusp, 8, resp.Status)
+			if err != 0 {
+				return int(err)
+			}
+		}
+	} else {
+		if statusp != 0 {
+			err := p.Vm.Userwriten(statusp, 4, resp.Status)
+			if err != 0 {
+				return int(err)
+			}
+		}
+		// update total child rusage
+		p.Catime.Add(&resp.Atime)
+		if rusagep != 0 {
+			ru := resp.Atime.To_rusage()
+			err = p.Vm.K2user(ru, rusagep)
+		}
+		if err != 0 {
+			return int(err)
+		}
+	}
+	return resp.Pid
+}
+
+// signals other than SIGKILL stay pending until they are read from a
+// signalfd
+func sys_kill(p *proc.Proc_t, pid, sig int) int {
+	if sig < 0 || sig > defs.NSIG {
+		return int(-defs.EINVAL)
+	}
+	t, ok := proc.Proc_check(pid)
+	if !ok {
+		return int(-defs.ESRCH)
+	}
+	if !p.Maysignal(t) {
+		return int(-defs.EPERM)
+	}
+	switch {
+	case sig == 0:
+	case sig == defs.SIGKILL:
+		t.Kill(sig)
+	case !t.Sigs.Post(sig, p.Pid):
+		return int(t.Sigdefault(sig))
+	}
+	return 0
+}
+
+func sys_pread(p *proc.Proc_t, fdn, bufn, lenn, offset int) int {
+	fd, err := _fd_read(p, fdn)
+	if err != 0 {
+		return int(err)
+	}
+	dst := p.Vm.Mkuserbuf(bufn, lenn)
+	ret, err := fd.Fops.Pread(dst, offset)
+	if err != 0 {
+		return int(err)
+	}
+	return ret
+}
+
+func sys_pwrite(p *proc.Proc_t, fdn, bufn, lenn, offset int) int {
+	fd, err := _fd_write(p, fdn)
+	if err != 0 {
+		return int(err)
+	}
+	src := p.Vm.Mkuserbuf(bufn, lenn)
+	ret, err := fd.Fops.Pwrite(src, offset)
+	if err != 0 {
+		return int(err)
+	}
+	return ret
+}
+
+type futexmsg_t struct {
+	op      uint
+	aux     uint32
+	ack     chan int
+	othmut  futex_t
+	cndtake []chan int
+	totake  []_futto_t
+	fumem   futumem_t
+	timeout time.Time
+	useto   bool
+}
+
+func (fm *futexmsg_t) fmsg_init(op uint, aux uint32, ack chan int) {
+	fm.op = op
+	fm.aux = aux
+	fm.ack = ack
+}
+
+// futex timeout metadata
+type _futto_t struct {
+	when   time.Time
+	tochan <-chan time.Time
+	who    chan int
+}
+
+type futex_t struct {
+	reopen chan int
+	cmd    chan futexmsg_t
+	_cnds  []chan int
+	cnds   []chan int
+	_tos   []_futto_t
+	tos    []_futto_t
+}
+
+func (f *futex_t) cndsleep(c chan int) {
+	f.cnds = append(f.cnds, c)
+}
+
+func (f *futex_t) cndwake(v int) {
+	if len(f.cnds) == 0 {
+		return
+	}
+	c := f.cnds[0]
+	f.cnds = f.cnds[1:]
+	if len(f.cnds) == 0 {
+		f.cnds = f._cnds
+	}
+	f._torm(c)
+	c <- v
+}
+
+func (f *futex_t) toadd(who chan int, when time.Time) {
+	fto := _futto_t{when, time.After(when.Sub(time.Now())), who}
+	f.tos = append(f.tos, fto)
+}
+
+func (f *futex_t) tonext() (<-chan time.Time, chan int) {
+	if len(f.tos) == 0 {
+		return nil, nil
+	}
+	small := f.tos[0].when
+	next := f.tos[0]
+	for _, nto := range f.tos {
+		if nto.when.Before(small) {
+			small = nto.when
+			next = nto
+		}
+	}
+	return next.tochan, next.who
+}
+
+func (f *futex_t) _torm(who chan int) {
+	idx := -1
+	for i, nto := range f.tos {
+		if nto.who == who {
+			idx = i
+			break
+		}
+	}
+	if idx == -1 {
+		return
+	}
+	copy(f.tos[idx:], f.tos[idx+1:])
+	l := len(f.tos)
+	f.tos = f.tos[:l-1]
+	if len(f.tos) == 0 {
+		f.tos = f._tos
+	}
+}
+
+func (f *futex_t) towake(who chan int, v int) {
+	// remove from tos and cnds
+	f._torm(who)
+	idx := -1
+	for i := range f.cnds {
+		if f.cnds[i] == who {
+			idx = i
+			break
+		}
+	}
+	copy(f.cnds[idx:], f.cnds[idx+1:])
+	l := len(f.cnds)
+	f.cnds = f.cnds[:l-1]
+	if len(f.cnds) == 0 {
+		f.cnds = f._cnds
+	}
+	who <- v
+}
+
+const (
+	_FUTEX_LAST = defs.FUTEX_CNDGIVE
+	// futex internal ops
+	_FUTEX_CNDTAKE = 4
+	// wakes at most aux waiters and returns their number, like Linux's
+	// FUTEX_WAKE
+	_FUTEX_WAKEN = 5
+)
+
+func (f *futex_t) _resume(ack chan int, err defs.Err_t) {
+	select {
+	case ack <- int(err):
+	default:
+	}
+}
+
+func (f *futex_t) futex_start() {
+	res.Kresdebug(res.Onek, "futex daemon")
+	maxwait := 10
+	f._cnds = make([]chan int, 0, maxwait)
+	f.cnds = f._cnds
+	f._tos = make([]_futto_t, 0, maxwait)
+	f.tos = f._tos
+
+	pack := make(chan int, 1)
+	opencount := 1
+	for opencount > 0 {
+		res.Kunresdebug()
+		res.Kresdebug(res.Onek, "futex daemon")
+		tochan, towho := f.tonext()
+		select {
+		case <-tochan:
+			f.towake(towho, 0)
+		case d := <-f.reopen:
+			opencount += d
+		case fm := <-f.cmd:
+			switch fm.op {
+			case defs.FUTEX_SLEEP:
+				val, err := fm.fumem.futload()
+				if err != 0 {
+					f._resume(fm.ack, err)
+					break
+				}
+				if val != fm.aux {
+					// owner just unlocked and it's this
+					// thread's turn; don't sleep
+					f._resume(fm.ack, 0)
+				} else {
+					if (fm.useto && len(f.tos) >= maxwait) ||
+						len(f.cnds) >= maxwait {
+						f._resume(fm.ack, -defs.ENOMEM)
+						break
+					}
+					if fm.useto {
+						f.toadd(fm.ack, fm.timeout)
+					}
+					f.cndsleep(fm.ack)
+				}
+			case defs.FUTEX_WAKE:
+				var v int
+				if fm.aux == 1 {
+					v = 0
+				} else if fm.aux == ^uint32(0) {
+					v = 1
+				} else {
+					panic("weird wake n")
+				}
+				f.cndwake(v)
+				f._resume(fm.ack, 0)
+			case _FUTEX_WAKEN:
+				n := 0
+				for ; uint32(n) < fm.aux && len(f.cnds) != 0; n++ {
+					f.cndwake(0)
+				}
+				f._resume(fm.ack, defs.Err_t(n))
+			case defs.FUTEX_CNDGIVE:
+				// as an optimization to avoid thundering herd
+				// after pthread_cond_broadcast(3), move
+				// conditional variable's queue of sleepers to
+				// the mutex of the thread we wakeup here.
+				l := len(f.cnds)
+				if l == 0 {
+					f._resume(fm.ack, 0)
+					break
+				}
+				here := make([]chan int, l)
+				copy(here, f.cnds)
+				tohere := make([]_futto_t, len(f.tos))
+				copy(tohere, f.tos)
+
+				var nfm futexmsg_t
+				nfm.fmsg_init(_FUTEX_CNDTAKE, 0, pack)
+				nfm.cndtake = here
+				nfm.totake = tohere
+
+				fm.othmut.cmd <- nfm
+				err := <-nfm.ack
+				if err == 0 {
+					f.cnds = f._cnds
+					f.tos = f._tos
+				}
+				f._resume(fm.ack, defs.Err_t(err))
+			case _FUTEX_CNDTAKE:
+				// add new waiters to our queue; get them
+				// tickets
+				here := fm.cndtake
+				tohere := fm.totake
+				if len(f.cnds)+len(here) >= maxwait ||
+					len(f.tos)+len(tohere) >= maxwait {
+					f._resume(fm.ack, -defs.ENOMEM)
+					break
+				}
+				f.cnds = append(f.cnds, here...)
+				f.tos = append(f.tos, tohere...)
+				f._resume(fm.ack, 0)
+			default:
+				panic("bad futex op")
+			}
+		}
+	}
+	res.Kunresdebug()
+}
+
+type allfutex_t struct {
+	sync.Mutex
+	m map[uintptr]futex_t
+}
+
+var _allfutex = allfutex_t{m: map[uintptr]futex_t{}}
+
+func futex_ensure(uniq uintptr) (futex_t, defs.Err_t) {
+	_allfutex.Lock()
+	if len(_allfutex.m) > limits.Syslimit.Futexes {
+		_allfutex.Unlock()
+		var zf futex_t
+		return zf, -defs.ENOMEM
+	}
+	r, ok := _allfutex.m[uniq]
+	if !ok {
+		r.reopen = make(chan int)
+		r.cmd = make(chan futexmsg_t)
+		_allfutex.m[uniq] = r
+		go r.futex_start()
+	}
+	_allfutex.Unlock()
+	return r, 0
+}
+
+// pmap must be locked. maps user va to kernel va. returns kva as uintptr and
+// *uint32
+func _uva2kva(p *proc.Proc_t, va uintptr) (uintptr, *uint32, defs.Err_t) {
+	p.Vm.Lockassert_pmap()
+
+	pa, ok := vm.Userpa(p.Vm.Pmap, int(va))
+	if !ok {
+		return 0, nil, -defs.EFAULT
+	}
+	pgva := physmem.Dmap(pa)
+	pgoff := uintptr(va) & uintptr(vm.PGOFFSET)
+	uniq := uintptr(unsafe.Pointer(pgva)) + pgoff
+	return uniq, (*uint32)(unsafe.Pointer(uniq)), 0
+}
+
+func va2fut(p *proc.Proc_t, va uintptr) (futex_t, defs.Err_t) {
+	p.Vm.Lock_pmap()
+	defer p.Vm.Unlock_pmap()
+
+	var zf futex_t
+	uniq, _, err := _uva2kva(p, va)
+	if err != 0 {
+		return zf, err
 	}
+	return futex_ensure(uniq)
+}
 
-	// the exec must succeed now; free old pmap/mapped files
-	if op_pmap != 0 {
-		vm.Uvmfree_inner(opmap, op_pmap, &ovmreg)
-		physmem.Dec_pmap(op_pmap)
+// an object for atomically looking-up and incrementing/loading from a user
+// address
+type futumem_t struct {
+	p    *proc.Proc_t
+	umem uintptr
+}
+
+func (fu *futumem_t) futload() (uint32, defs.Err_t) {
+	fu.p.Vm.Lock_pmap()
+	defer fu.p.Vm.Unlock_pmap()
+
+	_, ptr, err := _uva2kva(fu.p, fu.umem)
+	if err != 0 {
+		return 0, err
 	}
-	ovmreg.Clear()
+	var ret uint32
+	ret = atomic.LoadUint32(ptr)
+	return ret, 0
+}
 
-	// close fds marked with CLOEXEC
-	for fdn, f := range p.Fds {
-		if f == nil {
-			continue
+func sys_futex(p *proc.Proc_t, _op, _futn, _fut2n, aux, timespecn int) int {
+	op := uint(_op)
+	if op > _FUTEX_LAST {
+		return int(-defs.EINVAL)
+	}
+	var when time.Time
+	useto := timespecn != 0
+	if useto {
+		var err defs.Err_t
+		_, when, err = p.Vm.Usertimespec(timespecn)
+		if err != 0 {
+			return int(err)
 		}
-		if f.Perms&fd.FD_CLOEXEC != 0 {
-			if sys.Sys_close(p, fdn) != 0 {
-				panic("close")
-			}
+		if when.Before(time.Now()) {
+			return int(-defs.EINVAL)
 		}
 	}
-
-	// commit new image state
-	tf[defs.TF_RSP] = uintptr(bufdest)
-	tf[defs.TF_RIP] = uintptr(elfhdr.entry())
-	tf[defs.TF_RFLAGS] = uintptr(defs.TF_FL_IF)
-	ucseg := uintptr(5)
-	udseg := uintptr(6)
-	tf[defs.TF_CS] = (ucseg << 3) | 3
-	tf[defs.TF_SS] = (udseg << 3) | 3
-	tf[defs.TF_RDI] = uintptr(argc)
-	tf[defs.TF_RSI] = uintptr(argv)
-	tf[defs.TF_RDX] = uintptr(bufdest)
-	tf[defs.TF_FSBASE] = uintptr(tls0addr)
-	p.Mmapi = mem.USERMIN
-	p.Name = paths
-
-	return 0
+	return _futex(p, op, uintptr(_futn), uintptr(_fut2n), uint32(aux), when,
+		useto)
 }
 
-func insertargs(p *proc.Proc_t, sargs []ustr.Ustr) (int, int, defs.Err_t) {
-	// find free page
-	uva := p.Vm.Unusedva_inner(0, mem.PGSIZE)
-	p.Vm.Vmadd_anon(uva, mem.PGSIZE, vm.PTE_U)
-	_, p_pg, ok := physmem.Refpg_new()
-	if !ok {
-		return 0, 0, -defs.ENOMEM
+// performs the futex operation op on the futex at futn. a sleep times out at
+// when if useto is true.
+func _futex(p *proc.Proc_t, op uint, futn, fut2n uintptr, aux uint32,
+	when time.Time, useto bool) int {
+	// futn must be 4 byte aligned
+	if (futn|fut2n)&0x3 != 0 {
+		return int(-defs.EINVAL)
 	}
-	_, ok = p.Vm.Page_insert(uva, p_pg, vm.PTE_U, true, nil)
-	if !ok {
-		physmem.Refdown(p_pg)
-		return 0, 0, -defs.ENOMEM
+	fut, err := va2fut(p, futn)
+	if err != 0 {
+		return int(err)
 	}
-	//var args [][]uint8
-	args := make([][]uint8, 0, 12)
-	for _, str := range sargs {
-		args = append(args, []uint8(str))
-	}
-	argptrs := make([]int, len(args)+1)
-	// copy strings to arg page
-	cnt := 0
-	for i, arg := range args {
-		argptrs[i] = uva + cnt
-		// add null terminators
-		arg = append(arg, 0)
-		if err := p.Vm.K2user_inner(arg, uva+cnt); err != 0 {
-			// args take up more than a page? the user is on their
-			// own.
-			return 0, 0, err
+
+	var fm futexmsg_t
+	// could lazily allocate one futex channel per thread
+	fm.fmsg_init(op, aux, make(chan int, 1))
+	fm.fumem = futumem_t{p, futn}
+	fm.timeout = when
+	fm.useto = useto
+
+	if op == defs.FUTEX_CNDGIVE {
+		fm.othmut, err = va2fut(p, fut2n)
+		if err != 0 {
+			return int(err)
 		}
-		cnt += len(arg)
-	}
-	argptrs[len(argptrs)-1] = 0
-	// now put the array of strings
-	argstart := uva + cnt
-	vdata, err := p.Vm.Userdmap8_inner(argstart, true)
-	if err != 0 || len(vdata) < len(argptrs)*8 {
-		fmt.Printf("no room for args")
-		// XXX
-		return 0, 0, -defs.ENOSPC
-	}
-	for i, ptr := range argptrs {
-		writen(vdata, 8, i*8, ptr)
 	}
-	return len(args), argstart, 0
-}
 
-func (s *syscall_t) Sys_exit(p *proc.Proc_t, tid defs.Tid_t, status int) {
-	// set doomed so all other threads die
-	p.Doomall()
-	p.Thread_dead(tid, status, true)
+	kn := &tinfo.Current().Killnaps
+	fut.cmd <- fm
+	select {
+	case ret := <-fm.ack:
+		return ret
+	case <-kn.Killch:
+		if kn.Kerr == 0 {
+			panic("no")
+		}
+		return int(kn.Kerr)
+	}
 }
 
-func sys_threxit(p *proc.Proc_t, tid defs.Tid_t, status int) {
-	p.Thread_dead(tid, status, false)
+func sys_gettid(p *proc.Proc_t, tid defs.Tid_t) int {
+	return int(tid)
 }
 
-func sys_wait4(p *proc.Proc_t, tid defs.Tid_t, wpid, statusp, options, rusagep,
-	_isthread int) int {
-	if wpid == defs.WAIT_MYPGRP || options == defs.WCONTINUED ||
-		options == defs.WUNTRACED {
-		panic("no imp")
+// sets the personality flags of p and returns the previous flags. the only
+// supported flag is ADDR_NO_RANDOMIZE, which disables address space layout
+// randomization starting at the next exec (for reproducible benchmarks). the
+// domain in the low byte, PER_BISCUIT or PER_LINUX, selects the system call
+// ABI of the images executed next. 0xffffffff only queries the flags.
+func sys_personality(p *proc.Proc_t, persona int) int {
+	old := p.Personality
+	if uint32(persona) == 0xffffffff {
+		return old
 	}
-
-	// no waiting for yourself!
-	if tid == defs.Tid_t(wpid) {
-		return int(-defs.ECHILD)
+	if persona&^(defs.PER_MASK|defs.ADDR_NO_RANDOMIZE) != 0 {
+		return int(-defs.EINVAL)
 	}
-	isthread := _isthread != 0
-	if isthread && wpid == defs.WAIT_ANY {
+	switch persona & defs.PER_MASK {
+	case defs.PER_BISCUIT, defs.PER_LINUX:
+	default:
 		return int(-defs.EINVAL)
 	}
+	p.Personality = persona
+	return old
+}
 
-	noblk := options&defs.WNOHANG != 0
-	var resp proc.Waitst_t
-	var err defs.Err_t
-	if isthread {
-		resp, err = p.Mywait.Reaptid(wpid, noblk)
-	} else {
-		resp, err = p.Mywait.Reappid(wpid, noblk)
+// manages resource groups. a process may only operate on its own group and
+// the groups below it, and may only change the limits of the groups below its
+// own, so that it cannot escape its limits.
+func sys_cgroup(p *proc.Proc_t, op, id, kind, lim int) int {
+	cur := p.Cgroup()
+	if op == defs.CGROUP_SELF {
+		return cur.Id
 	}
-
-	if err != 0 {
-		return int(err)
+	cg, ok := cgroup.Lookup(id)
+	if !ok {
+		return int(-defs.ENOENT)
 	}
-	if isthread {
-		if statusp != 0 {
-			err := p.Vm.Userwriten(statusp, 8, resp.Status)
-			if err != 0 {
-				return int(err)
-			}
+	if !cg.Within(cur) {
+		return int(-defs.EPERM)
+	}
+	switch op {
+	case defs.CGROUP_CREATE:
+		n, err := cg.Mkchild()
+		if err != 0 {
+			lhits++
+			return int(err)
 		}
-	} else {
-		if statusp != 0 {
-			err := p.Vm.Userwriten(statusp, 4, resp.Status)
-			if err != 0 {
-				return int(err)
-			}
+		return n.Id
+	case defs.CGROUP_DESTROY:
+		return int(cg.Destroy())
+	case defs.CGROUP_JOIN:
+		return int(p.Cgroup_join(cg))
+	}
+	var k cgroup.Kind_t
+	switch kind {
+	case defs.CGROUP_PAGES:
+		k = cgroup.PAGES
+	case defs.CGROUP_HEAP:
+		k = cgroup.HEAP
+	case defs.CGROUP_PROCS:
+		k = cgroup.PROCS
+	default:
+		return int(-defs.EINVAL)
+	}
+	switch op {
+	case defs.CGROUP_SETLIM:
+		if cg == cur && cur != cgroup.Root {
+			return int(-defs.EPERM)
 		}
-		// update total child rusage
-		p.Catime.Add(&resp.Atime)
-		if rusagep != 0 {
-			ru := resp.Atime.To_rusage()
-			err = p.Vm.K2user(ru, rusagep)
+		if lim == defs.CGROUP_UNLIMITED {
+			lim = cgroup.Unlimited
+		} else if lim < 0 {
+			return int(-defs.EINVAL)
 		}
-		if err != 0 {
-			return int(err)
+		cg.Setlimit(k, lim)
+		return 0
+	case defs.CGROUP_GETLIM:
+		if l := cg.Limit(k); l != cgroup.Unlimited {
+			return l
 		}
+		return defs.CGROUP_UNLIMITED
+	case defs.CGROUP_USAGE:
+		return cg.Usage(k)
 	}
-	return resp.Pid
+	return int(-defs.EINVAL)
 }
 
-func sys_kill(p *proc.Proc_t, pid, sig int) int {
-	if sig != defs.SIGKILL {
-		panic("no imp")
-	}
-	p, ok := proc.Proc_check(pid)
-	if !ok {
-		return int(-defs.ESRCH)
+// reads and sets the oom_score_adj of the process pid, or of p if pid is 0.
+// if newp is not 0, it points to the new value; if oldp is not 0, the
+// previous value is written there. only p and its descendants can be
+// changed, and only p itself can lower its value.
+func sys_oomadj(p *proc.Proc_t, pid, newp, oldp int) int {
+	t := p
+	if pid != 0 && pid != p.Pid {
+		var ok bool
+		t, ok = proc.Proc_check(pid)
+		if !ok {
+			return int(-defs.ESRCH)
+		}
 	}
-	p.Doomall()
-	return 0
-}
-
-func sys_pread(p *proc.Proc_t, fdn, bufn, lenn, offset int) int {
-	fd, err := _fd_read(p, fdn)
-	if err != 0 {
-		return int(err)
+	old := t.Oom_adj()
+	if newp != 0 {
+		n, err := p.Vm.Userreadn(newp, 4)
+		if err != 0 {
+			return int(err)
+		}
+		if err := t.Oom_change(p, int(int32(n))); err != 0 {
+			return int(err)
+		}
 	}
-	dst := p.Vm.Mkuserbuf(bufn, lenn)
-	ret, err := fd.Fops.Pread(dst, offset)
-	if err != 0 {
-		return int(err)
+	if oldp != 0 {
+		if err := p.Vm.Userwriten(oldp, 4, old); err != 0 {
+			return int(err)
+		}
 	}
-	return ret
+	return 0
 }
 
-func sys_pwrite(p *proc.Proc_t, fdn, bufn, lenn, offset int) int {
-	fd, err := _fd_write(p, fdn)
-	if err != 0 {
-		return int(err)
+// returns the process named by which and who for getpriority and
+// setpriority. only PRIO_PROCESS is supported. if set is true, the process
+// must be p or one of its descendants.
+func _prioproc(p *proc.Proc_t, which, who int, set bool) (*proc.Proc_t,
+	defs.Err_t) {
+	if which != defs.PRIO_PROCESS {
+		return nil, -defs.EINVAL
 	}
-	src := p.Vm.Mkuserbuf(bufn, lenn)
-	ret, err := fd.Fops.Pwrite(src, offset)
-	if err != 0 {
-		return int(err)
+	if who == 0 || who == p.Pid {
+		return p, 0
 	}
-	return ret
-}
-
-type futexmsg_t struct {
-	op      uint
-	aux     uint32
-	ack     chan int
-	othmut  futex_t
-	cndtake []chan int
-	totake  []_futto_t
-	fumem   futumem_t
-	timeout time.Time
-	useto   bool
-}
-
-func (fm *futexmsg_t) fmsg_init(op uint, aux uint32, ack chan int) {
-	fm.op = op
-	fm.aux = aux
-	fm.ack = ack
-}
-
-// futex timeout metadata
-type _futto_t struct {
-	when   time.Time
-	tochan <-chan time.Time
-	who    chan int
-}
-
-type futex_t struct {
-	reopen chan int
-	cmd    chan futexmsg_t
-	_cnds  []chan int
-	cnds   []chan int
-	_tos   []_futto_t
-	tos    []_futto_t
-}
-
-func (f *futex_t) cndsleep(c chan int) {
-	f.cnds = append(f.cnds, c)
-}
-
-func (f *futex_t) cndwake(v int) {
-	if len(f.cnds) == 0 {
-		return
+	t, ok := proc.Proc_check(who)
+	if !ok {
+		return nil, -defs.ESRCH
 	}
-	c := f.cnds[0]
-	f.cnds = f.cnds[1:]
-	if len(f.cnds) == 0 {
-		f.cnds = f._cnds
+	if set && !p.Ancestor(t) {
+		return nil, -defs.EPERM
 	}
-	f._torm(c)
-	c <- v
-}
-
-func (f *futex_t) toadd(who chan int, when time.Time) {
-	fto := _futto_t{when, time.After(when.Sub(time.Now())), who}
-	f.tos = append(f.tos, fto)
+	return t, 0
 }
 
-func (f *futex_t) tonext() (<-chan time.Time, chan int) {
-	if len(f.tos) == 0 {
-		return nil, nil
-	}
-	small := f.tos[0].when
-	next := f.tos[0]
-	for _, nto := range f.tos {
-		if nto.when.Before(small) {
-			small = nto.when
-			next = nto
+// returns the nice value of the process' thread with the highest priority.
+// like Linux, the result is 20 minus the nice value so that it cannot be
+// mistaken for an error; the C library converts it back.
+func sys_getpriority(p *proc.Proc_t, which, who int) int {
+	t, err := _prioproc(p, which, who, false)
+	if err != 0 {
+		return int(err)
+	}
+	nice := defs.NICE_MAX + 1
+	t.Thread_iter(func(tn *tinfo.Tnote_t) {
+		if n := tn.Sched_get().Nice; n < nice {
+			nice = n
 		}
+	})
+	if nice > defs.NICE_MAX {
+		return int(-defs.ESRCH)
 	}
-	return next.tochan, next.who
+	return 20 - nice
 }
 
-func (f *futex_t) _torm(who chan int) {
-	idx := -1
-	for i, nto := range f.tos {
-		if nto.who == who {
-			idx = i
-			break
-		}
+// sets the nice value of every thread of the process. out-of-range values are
+// clamped, like on Linux. since there are no privileged processes, the nice
+// value of a thread can only be raised.
+func sys_setpriority(p *proc.Proc_t, which, who, nice int) int {
+	t, err := _prioproc(p, which, who, true)
+	if err != 0 {
+		return int(err)
 	}
-	if idx == -1 {
-		return
+	if nice < defs.NICE_MIN {
+		nice = defs.NICE_MIN
+	} else if nice > defs.NICE_MAX {
+		nice = defs.NICE_MAX
 	}
-	copy(f.tos[idx:], f.tos[idx+1:])
-	l := len(f.tos)
-	f.tos = f.tos[:l-1]
-	if len(f.tos) == 0 {
-		f.tos = f._tos
+	lower := false
+	t.Thread_iter(func(tn *tinfo.Tnote_t) {
+		if nice < tn.Sched_get().Nice {
+			lower = true
+		}
+	})
+	if lower {
+		return int(-defs.EACCES)
 	}
+	t.Thread_iter(func(tn *tinfo.Tnote_t) {
+		tn.Sched_nice(nice)
+	})
+	return 0
 }
 
-func (f *futex_t) towake(who chan int, v int) {
-	// remove from tos and cnds
-	f._torm(who)
-	idx := -1
-	for i := range f.cnds {
-		if f.cnds[i] == who {
-			idx = i
-			break
-		}
+// returns the thread named by id for the sched_* system calls: a thread, the
+// first thread of a process, or the calling thread if id is 0. if set is true,
+// the thread must belong to p or one of its descendants.
+func _schedthread(p *proc.Proc_t, id int, set bool) (*tinfo.Tnote_t,
+	defs.Err_t) {
+	if id == 0 {
+		return tinfo.Current(), 0
 	}
-	copy(f.cnds[idx:], f.cnds[idx+1:])
-	l := len(f.cnds)
-	f.cnds = f.cnds[:l-1]
-	if len(f.cnds) == 0 {
-		f.cnds = f._cnds
+	if id < 0 {
+		return nil, -defs.EINVAL
 	}
-	who <- v
+	t, tn, ok := proc.Thread_find(id)
+	if !ok {
+		return nil, -defs.ESRCH
+	}
+	if set && t != p && !p.Ancestor(t) {
+		return nil, -defs.EPERM
+	}
+	return tn, 0
 }
 
-const (
-	_FUTEX_LAST = defs.FUTEX_CNDGIVE
-	// futex internal op
-	_FUTEX_CNDTAKE = 4
-)
+// writes the realtime priority of the thread to the struct sched_param at
+// paramp; it is 0 for SCHED_OTHER.
+func sys_sched_getparam(p *proc.Proc_t, id, paramp int) int {
+	tn, err := _schedthread(p, id, false)
+	if err != 0 {
+		return int(err)
+	}
+	s := tn.Sched_get()
+	return int(p.Vm.Userwriten(paramp, 4, s.Rtprio))
+}
 
-func (f *futex_t) _resume(ack chan int, err defs.Err_t) {
-	select {
-	case ack <- int(err):
+// sets the scheduling policy of the thread and its realtime priority, which
+// the struct sched_param at paramp holds. a SCHED_FIFO thread runs before the
+// SCHED_OTHER threads and is not preempted by them.
+func sys_sched_setscheduler(p *proc.Proc_t, id, policy, paramp int) int {
+	tn, err := _schedthread(p, id, true)
+	if err != 0 {
+		return int(err)
+	}
+	n, err := p.Vm.Userreadn(paramp, 4)
+	if err != 0 {
+		return int(err)
+	}
+	prio := int(int32(n))
+	switch policy {
+	case defs.SCHED_OTHER:
+		if prio != 0 {
+			return int(-defs.EINVAL)
+		}
+	case defs.SCHED_FIFO:
+		if prio < defs.SCHED_PRIOMIN || prio > defs.SCHED_PRIOMAX {
+			return int(-defs.EINVAL)
+		}
+		// a realtime thread can starve the threads of other
+		// processes, thus the caller's RLIMIT_RTPRIO must allow it
+		if uint(prio) > p.Ulim.Rtprio {
+			return int(-defs.EPERM)
+		}
 	default:
+		return int(-defs.EINVAL)
 	}
+	tn.Sched_policy(policy, prio)
+	return 0
 }
 
-func (f *futex_t) futex_start() {
-	res.Kresdebug(res.Onek, "futex daemon")
-	maxwait := 10
-	f._cnds = make([]chan int, 0, maxwait)
-	f.cnds = f._cnds
-	f._tos = make([]_futto_t, 0, maxwait)
-	f.tos = f._tos
+func sys_sched_getscheduler(p *proc.Proc_t, id int) int {
+	tn, err := _schedthread(p, id, false)
+	if err != 0 {
+		return int(err)
+	}
+	return tn.Sched_get().Policy
+}
 
-	pack := make(chan int, 1)
-	opencount := 1
-	for opencount > 0 {
-		res.Kunresdebug()
-		res.Kresdebug(res.Onek, "futex daemon")
-		tochan, towho := f.tonext()
-		select {
-		case <-tochan:
-			f.towake(towho, 0)
-		case d := <-f.reopen:
-			opencount += d
-		case fm := <-f.cmd:
-			switch fm.op {
-			case defs.FUTEX_SLEEP:
-				val, err := fm.fumem.futload()
-				if err != 0 {
-					f._resume(fm.ack, err)
-					break
-				}
-				if val != fm.aux {
-					// owner just unlocked and it's this
-					// thread's turn; don't sleep
-					f._resume(fm.ack, 0)
-				} else {
-					if (fm.useto && len(f.tos) >= maxwait) ||
-						len(f.cnds) >= maxwait {
-						f._resume(fm.ack, -defs.ENOMEM)
-						break
-					}
-					if fm.useto {
-						f.toadd(fm.ack, fm.timeout)
-					}
-					f.cndsleep(fm.ack)
-				}
-			case defs.FUTEX_WAKE:
-				var v int
-				if fm.aux == 1 {
-					v = 0
-				} else if fm.aux == ^uint32(0) {
-					v = 1
-				} else {
-					panic("weird wake n")
-				}
-				f.cndwake(v)
-				f._resume(fm.ack, 0)
-			case defs.FUTEX_CNDGIVE:
-				// as an optimization to avoid thundering herd
-				// after pthread_cond_broadcast(3), move
-				// conditional variable's queue of sleepers to
-				// the mutex of the thread we wakeup here.
-				l := len(f.cnds)
-				if l == 0 {
-					f._resume(fm.ack, 0)
-					break
-				}
-				here := make([]chan int, l)
-				copy(here, f.cnds)
-				tohere := make([]_futto_t, len(f.tos))
-				copy(tohere, f.tos)
+// the CPUs on which user threads may run
+func _cpumask() uint64 {
+	return 1<<uint(runtime.GOMAXPROCS(0)) - 1
+}
 
-				var nfm futexmsg_t
-				nfm.fmsg_init(_FUTEX_CNDTAKE, 0, pack)
-				nfm.cndtake = here
-				nfm.totake = tohere
+// sets the CPUs on which the thread may run to the mask of sz bytes at maskp.
+// CPUs which do not exist are ignored, but the mask must name at least one
+// CPU which does.
+func sys_sched_setaffinity(p *proc.Proc_t, id, sz, maskp int) int {
+	tn, err := _schedthread(p, id, true)
+	if err != 0 {
+		return int(err)
+	}
+	if sz <= 0 {
+		return int(-defs.EINVAL)
+	}
+	if sz > 8 {
+		sz = 8
+	}
+	n, err := p.Vm.Userreadn(maskp, sz)
+	if err != 0 {
+		return int(err)
+	}
+	mask := uint64(n) & _cpumask()
+	if mask == 0 {
+		return int(-defs.EINVAL)
+	}
+	tn.Sched_mask(mask)
+	return 0
+}
 
-				fm.othmut.cmd <- nfm
-				err := <-nfm.ack
-				if err == 0 {
-					f.cnds = f._cnds
-					f.tos = f._tos
-				}
-				f._resume(fm.ack, defs.Err_t(err))
-			case _FUTEX_CNDTAKE:
-				// add new waiters to our queue; get them
-				// tickets
-				here := fm.cndtake
-				tohere := fm.totake
-				if len(f.cnds)+len(here) >= maxwait ||
-					len(f.tos)+len(tohere) >= maxwait {
-					f._resume(fm.ack, -defs.ENOMEM)
-					break
-				}
-				f.cnds = append(f.cnds, here...)
-				f.tos = append(f.tos, tohere...)
-				f._resume(fm.ack, 0)
-			default:
-				panic("bad futex op")
-			}
+// writes the CPU affinity mask of the thread to maskp and returns its size,
+// like Linux.
+func sys_sched_getaffinity(p *proc.Proc_t, id, sz, maskp int) int {
+	tn, err := _schedthread(p, id, false)
+	if err != 0 {
+		return int(err)
+	}
+	if sz < 8 {
+		return int(-defs.EINVAL)
+	}
+	mask := tn.Sched_get().Mask
+	if mask == 0 {
+		mask = _cpumask()
+	}
+	if err := p.Vm.Userwriten(maskp, 8, int(mask)); err != 0 {
+		return int(err)
+	}
+	return 8
+}
+
+// opens the POSIX shared memory object called by the string at namen. like
+// on Linux, the descriptor is close-on-exec.
+func sys_shm_open(p *proc.Proc_t, namen, _flags int) int {
+	name, err := p.Vm.Userstr(namen, fs.NAME_MAX)
+	if err != 0 {
+		return int(err)
+	}
+	flags := defs.Fdopt_t(_flags)
+	fdperms := fd.FD_CLOEXEC
+	switch flags & (defs.O_RDONLY | defs.O_WRONLY | defs.O_RDWR) {
+	case defs.O_RDONLY:
+		if flags&defs.O_TRUNC != 0 {
+			return int(-defs.EINVAL)
 		}
+		fdperms |= fd.FD_READ
+	case defs.O_RDWR:
+		fdperms |= fd.FD_READ | fd.FD_WRITE
+	default:
+		return int(-defs.EINVAL)
 	}
-	res.Kunresdebug()
+	creat := flags&defs.O_CREAT != 0
+	excl := creat && flags&defs.O_EXCL != 0
+	sf, err := ipc.Shm_open(name, creat, excl, flags&defs.O_TRUNC != 0)
+	if err != 0 {
+		return int(err)
+	}
+	f := &fd.Fd_t{Fops: sf}
+	fdn, ok := p.Fd_insert(f, fdperms)
+	if !ok {
+		lhits++
+		fd.Close_panic(f)
+		return int(-defs.EMFILE)
+	}
+	return fdn
 }
 
-type allfutex_t struct {
-	sync.Mutex
-	m map[uintptr]futex_t
+func sys_shm_unlink(p *proc.Proc_t, namen int) int {
+	name, err := p.Vm.Userstr(namen, fs.NAME_MAX)
+	if err != 0 {
+		return int(err)
+	}
+	return int(ipc.Shm_unlink(name))
 }
 
-var _allfutex = allfutex_t{m: map[uintptr]futex_t{}}
+func sys_shmget(p *proc.Proc_t, key, size, flags int) int {
+	key = int(int32(key))
+	ret, err := ipc.Shmget(key, size, flags, p.Pid)
+	if err != 0 {
+		return int(err)
+	}
+	return ret
+}
 
-func futex_ensure(uniq uintptr) (futex_t, defs.Err_t) {
-	_allfutex.Lock()
-	if len(_allfutex.m) > limits.Syslimit.Futexes {
-		_allfutex.Unlock()
-		var zf futex_t
-		return zf, -defs.ENOMEM
+// attaches the System V segment shmid at addrn, or at an unused address if
+// addrn is 0. an attachment is a shared mapping of the whole segment.
+func sys_shmat(p *proc.Proc_t, shmid, addrn, flags int) int {
+	if flags&^(defs.SHM_RDONLY|defs.SHM_RND) != 0 {
+		return int(-defs.EINVAL)
 	}
-	r, ok := _allfutex.m[uniq]
-	if !ok {
-		r.reopen = make(chan int)
-		r.cmd = make(chan futexmsg_t)
-		_allfutex.m[uniq] = r
-		go r.futex_start()
+	if flags&defs.SHM_RND != 0 {
+		addrn = util.Rounddown(addrn, mem.PGSIZE)
+	}
+	if addrn&int(vm.PGOFFSET) != 0 {
+		return int(-defs.EINVAL)
+	}
+	sf, err := ipc.Shmattach(shmid, p.Pid)
+	if err != 0 {
+		return int(err)
+	}
+	// the mapping holds its own reference
+	defer sf.Close()
+	lenn := util.Roundup(sf.Obj().Size(), mem.PGSIZE)
+	if addrn != 0 && (addrn < mem.USERMIN || addrn+lenn > mem.USERMAX) {
+		return int(-defs.EINVAL)
+	}
+	rdonly := flags&defs.SHM_RDONLY != 0
+	prot := uint(defs.PROT_READ | defs.PROT_WRITE)
+	if rdonly {
+		prot = defs.PROT_READ
 	}
-	_allfutex.Unlock()
-	return r, 0
-}
 
-// pmap must be locked. maps user va to kernel va. returns kva as uintptr and
-// *uint32
-func _uva2kva(p *proc.Proc_t, va uintptr) (uintptr, *uint32, defs.Err_t) {
-	p.Vm.Lockassert_pmap()
+	p.Vm.Lock_pmap()
+	defer p.Vm.Unlock_pmap()
 
-	pte := vm.Pmap_lookup(p.Vm.Pmap, int(va))
-	if pte == nil || *pte&vm.PTE_P == 0 || *pte&vm.PTE_U == 0 {
-		return 0, nil, -defs.EFAULT
+	if lenn/int(mem.PGSIZE)+p.Vm.Vmregion.Pglen() > p.Ulim.Pages {
+		lhits++
+		return int(-defs.ENOMEM)
+	}
+	if p.Vm.Vmregion.Novma >= p.Ulim.Novma {
+		lhits++
+		return int(-defs.ENOMEM)
 	}
-	pgva := physmem.Dmap(*pte & vm.PTE_ADDR)
-	pgoff := uintptr(va) & uintptr(vm.PGOFFSET)
-	uniq := uintptr(unsafe.Pointer(pgva)) + pgoff
-	return uniq, (*uint32)(unsafe.Pointer(uniq)), 0
+	addr := addrn
+	if addr == 0 {
+		addr = p.Vm.Unusedva_inner(p.Mmapi, lenn)
+		p.Mmapi = addr + lenn
+	} else if p.Vm.Vmregion.Overlaps(addr, lenn) {
+		return int(-defs.EINVAL)
+	}
+	p.Vm.Vmadd_sharefile(addr, lenn, prot2perms(prot), sf, 0, sf, rdonly)
+	// mlockall(MCL_FUTURE)
+	if p.Vm.Lockfuture {
+		err := p.Vm.Mlock(addr, lenn, _memlockpgs(p), p.Ulim.Novma)
+		if err != 0 {
+			if p.Vm.Unmap(addr, lenn, p.Ulim.Novma) != 0 {
+				panic("wut")
+			}
+			lhits++
+			return int(err)
+		}
+	}
+	return addr
 }
 
-func va2fut(p *proc.Proc_t, va uintptr) (futex_t, defs.Err_t) {
+// detaches the System V segment attached at addrn
+func sys_shmdt(p *proc.Proc_t, addrn int) int {
 	p.Vm.Lock_pmap()
 	defer p.Vm.Unlock_pmap()
 
-	var zf futex_t
-	uniq, _, err := _uva2kva(p, va)
-	if err != 0 {
-		return zf, err
+	vmi, ok := p.Vm.Vmregion.Lookup(uintptr(addrn))
+	if !ok || int(vmi.Pgn<<vm.PGSHIFT) != addrn {
+		return int(-defs.EINVAL)
 	}
-	return futex_ensure(uniq)
+	fops, foff, ok := vmi.Filemap()
+	sf, isshm := fops.(*ipc.Shmfops_t)
+	if !ok || !isshm || !sf.Attached() || foff != 0 {
+		return int(-defs.EINVAL)
+	}
+	// mprotect(2) may have split the attachment
+	end := addrn
+	for {
+		vmi, ok := p.Vm.Vmregion.Lookup(uintptr(end))
+		if !ok {
+			break
+		}
+		if f, _, _ := vmi.Filemap(); f != fops {
+			break
+		}
+		end += vmi.Pglen << vm.PGSHIFT
+	}
+	obj := sf.Obj()
+	if err := p.Vm.Unmap(addrn, end-addrn, p.Ulim.Novma); err != 0 {
+		lhits++
+		return int(err)
+	}
+	obj.Detached(p.Pid)
+	return 0
 }
 
-// an object for atomically looking-up and incrementing/loading from a user
-// address
-type futumem_t struct {
-	p    *proc.Proc_t
-	umem uintptr
+// only IPC_STAT and IPC_RMID are supported
+func sys_shmctl(p *proc.Proc_t, shmid, cmd, bufn int) int {
+	switch cmd {
+	case defs.IPC_STAT:
+		st, err := ipc.Shmstat(shmid)
+		if err != 0 {
+			return int(err)
+		}
+		return int(p.Vm.K2user(st, bufn))
+	case defs.IPC_RMID:
+		return int(ipc.Shmrmid(shmid))
+	default:
+		return int(-defs.EINVAL)
+	}
 }
 
-func (fu *futumem_t) futload() (uint32, defs.Err_t) {
-	fu.p.Vm.Lock_pmap()
-	defer fu.p.Vm.Unlock_pmap()
-
-	_, ptr, err := _uva2kva(fu.p, fu.umem)
+func sys_semget(p *proc.Proc_t, key, nsems, flags int) int {
+	key = int(int32(key))
+	ret, err := ipc.Semget(key, nsems, flags)
 	if err != 0 {
-		return 0, err
+		return int(err)
 	}
-	var ret uint32
-	ret = atomic.LoadUint32(ptr)
-	return ret, 0
+	return ret
 }
 
-func sys_futex(p *proc.Proc_t, _op, _futn, _fut2n, aux, timespecn int) int {
-	op := uint(_op)
-	if op > _FUTEX_LAST {
+// sopsn points to nsops struct sembufs
+func sys_semop(p *proc.Proc_t, semid, sopsn, nsops int) int {
+	if nsops <= 0 {
 		return int(-defs.EINVAL)
 	}
-	futn := uintptr(_futn)
-	fut2n := uintptr(_fut2n)
-	// futn must be 4 byte aligned
-	if (futn|fut2n)&0x3 != 0 {
-		return int(-defs.EINVAL)
+	if nsops > ipc.SEMOPM {
+		return int(-defs.E2BIG)
 	}
-	fut, err := va2fut(p, futn)
+	s, err := ipc.Semlookup(semid)
 	if err != 0 {
 		return int(err)
 	}
+	const sembufsz = 6
+	buf := make([]uint8, nsops*sembufsz)
+	if err := p.Vm.User2k(buf, sopsn); err != 0 {
+		return int(err)
+	}
+	sops := make([]ipc.Sembuf_t, nsops)
+	for i := range sops {
+		b := buf[i*sembufsz:]
+		sops[i].Num = util.Readn(b, 2, 0)
+		sops[i].Op = int(int16(util.Readn(b, 2, 2)))
+		sops[i].Flg = int(int16(util.Readn(b, 2, 4)))
+	}
+	return int(s.Op(sops, p))
+}
 
-	var fm futexmsg_t
-	// could lazily allocate one futex channel per thread
-	fm.fmsg_init(op, uint32(aux), make(chan int, 1))
-	fm.fumem = futumem_t{p, futn}
-
-	if timespecn != 0 {
-		_, when, err := p.Vm.Usertimespec(timespecn)
+// arg is the value of union semun: an integer for SETVAL and a pointer
+// otherwise. only IPC_STAT and IPC_RMID of the commands on the whole set are
+// supported.
+func sys_semctl(p *proc.Proc_t, semid, semnum, cmd, arg int) int {
+	s, err := ipc.Semlookup(semid)
+	if err != 0 {
+		return int(err)
+	}
+	switch cmd {
+	case defs.IPC_STAT:
+		return int(p.Vm.K2user(s.Stat(), arg))
+	case defs.IPC_RMID:
+		return int(ipc.Semrmid(semid))
+	case defs.GETVAL:
+		ret, err := s.Getval(semnum)
 		if err != 0 {
 			return int(err)
 		}
-		n := time.Now()
-		if when.Before(n) {
-			return int(-defs.EINVAL)
+		return ret
+	case defs.GETPID:
+		ret, err := s.Getpid(semnum)
+		if err != 0 {
+			return int(err)
 		}
-		fm.timeout = when
-		fm.useto = true
-	}
-
-	if op == defs.FUTEX_CNDGIVE {
-		fm.othmut, err = va2fut(p, fut2n)
+		return ret
+	case defs.SETVAL:
+		return int(s.Setval(semnum, int(int32(arg)), p.Pid))
+	case defs.GETALL:
+		vals, err := s.Getall()
 		if err != 0 {
 			return int(err)
 		}
+		buf := make([]uint8, 2*len(vals))
+		for i, v := range vals {
+			util.Writen(buf, 2, 2*i, v)
+		}
+		return int(p.Vm.K2user(buf, arg))
+	case defs.SETALL:
+		buf := make([]uint8, 2*s.Nsems())
+		if err := p.Vm.User2k(buf, arg); err != 0 {
+			return int(err)
+		}
+		vals := make([]int, s.Nsems())
+		for i := range vals {
+			vals[i] = util.Readn(buf, 2, 2*i)
+		}
+		return int(s.Setall(vals, p.Pid))
+	default:
+		return int(-defs.EINVAL)
 	}
+}
 
-	kn := &tinfo.Current().Killnaps
-	fut.cmd <- fm
-	select {
-	case ret := <-fm.ack:
-		return ret
-	case <-kn.Killch:
-		if kn.Kerr == 0 {
-			panic("no")
-		}
-		return int(kn.Kerr)
+func sys_msgget(p *proc.Proc_t, key, flags int) int {
+	key = int(int32(key))
+	ret, err := ipc.Msgget(key, flags)
+	if err != 0 {
+		return int(err)
 	}
+	return ret
 }
 
-func sys_gettid(p *proc.Proc_t, tid defs.Tid_t) int {
-	return int(tid)
+// msgp points to a long message type followed by msgsz bytes of text
+func sys_msgsnd(p *proc.Proc_t, msqid, msgp, msgsz, flags int) int {
+	if msgsz < 0 || msgsz > ipc.MSGMAX {
+		return int(-defs.EINVAL)
+	}
+	q, err := ipc.Msglookup(msqid)
+	if err != 0 {
+		return int(err)
+	}
+	mtype, err := p.Vm.Userreadn(msgp, 8)
+	if err != 0 {
+		return int(err)
+	}
+	data := make([]uint8, msgsz)
+	if err := p.Vm.User2k(data, msgp+8); err != 0 {
+		return int(err)
+	}
+	nowait := flags&defs.IPC_NOWAIT != 0
+	return int(q.Send(mtype, data, nowait, p.Pid))
+}
+
+// returns the length of the received text. the message is lost if msgp is
+// not writable.
+func sys_msgrcv(p *proc.Proc_t, msqid, msgp, msgsz, msgtyp, flags int) int {
+	if msgsz < 0 {
+		return int(-defs.EINVAL)
+	}
+	q, err := ipc.Msglookup(msqid)
+	if err != 0 {
+		return int(err)
+	}
+	except := flags&defs.MSG_EXCEPT != 0
+	noerror := flags&defs.MSG_NOERROR != 0
+	nowait := flags&defs.IPC_NOWAIT != 0
+	mtype, data, err := q.Recv(msgsz, msgtyp, except, noerror, nowait,
+		p.Pid)
+	if err != 0 {
+		return int(err)
+	}
+	if err := p.Vm.Userwriten(msgp, 8, mtype); err != 0 {
+		return int(err)
+	}
+	if err := p.Vm.K2user(data, msgp+8); err != 0 {
+		return int(err)
+	}
+	return len(data)
+}
+
+// IPC_SET only sets msg_qbytes
+func sys_msgctl(p *proc.Proc_t, msqid, cmd, bufn int) int {
+	q, err := ipc.Msglookup(msqid)
+	if err != 0 {
+		return int(err)
+	}
+	switch cmd {
+	case defs.IPC_STAT:
+		return int(p.Vm.K2user(q.Stat(), bufn))
+	case defs.IPC_SET:
+		// the offset of msg_qbytes
+		qbytes, err := p.Vm.Userreadn(bufn+88, 8)
+		if err != 0 {
+			return int(err)
+		}
+		return int(q.Setqbytes(qbytes))
+	case defs.IPC_RMID:
+		return int(ipc.Msgrmid(msqid))
+	default:
+		return int(-defs.EINVAL)
+	}
 }
 
 func sys_fcntl(p *proc.Proc_t, fdn, cmd, opt int) int {
@@ -3936,20 +6795,77 @@ func sys_fcntl(p *proc.Proc_t, fdn, cmd, opt int) int {
 	case defs.F_GETFD:
 		return f.Perms & fd.FD_CLOEXEC
 	case defs.F_SETFD:
-		if opt&fd.FD_CLOEXEC == 0 {
-			f.Perms &^= fd.FD_CLOEXEC
-		} else {
-			f.Perms |= fd.FD_CLOEXEC
+		if !p.Fd_cloexec(fdn, opt&fd.FD_CLOEXEC != 0) {
+			return int(-defs.EBADF)
 		}
 		return 0
+	case defs.F_DUPFD, defs.F_DUPFD_CLOEXEC:
+		nfdn, err := p.Fd_dupmin(fdn, opt, cmd == defs.F_DUPFD_CLOEXEC)
+		if err != 0 {
+			return int(err)
+		}
+		return nfdn
 	// fd specific fcntl(2) ops
 	case defs.F_GETFL, defs.F_SETFL:
 		return f.Fops.Fcntl(cmd, opt)
+	case defs.F_GETLK, defs.F_SETLK, defs.F_SETLKW:
+		return _fcntl_lock(p, f, cmd, opt)
 	default:
 		return int(-defs.EINVAL)
 	}
 }
 
+// the size of struct flock
+const _flocksz = 32
+
+func _fcntl_lock(p *proc.Proc_t, f *fd.Fd_t, cmd, flockn int) int {
+	lf, ok := f.Fops.(fdops.Lockable_i)
+	if !ok {
+		return int(-defs.EINVAL)
+	}
+	buf := make([]uint8, _flocksz)
+	if err := p.Vm.User2k(buf, flockn); err != 0 {
+		return int(err)
+	}
+	lk := fdops.Reclock_t{}
+	lk.Type = int(int16(util.Readn(buf, 2, 0)))
+	lk.Whence = int(int16(util.Readn(buf, 2, 2)))
+	lk.Start = util.Readn(buf, 8, 8)
+	lk.Len = util.Readn(buf, 8, 16)
+	if cmd == defs.F_GETLK {
+		if err := lf.Getlk(p.Pid, &lk); err != 0 {
+			return int(err)
+		}
+		util.Writen(buf, 2, 0, lk.Type)
+		util.Writen(buf, 2, 2, lk.Whence)
+		util.Writen(buf, 8, 8, lk.Start)
+		util.Writen(buf, 8, 16, lk.Len)
+		util.Writen(buf, 8, 24, lk.Pid)
+		return int(p.Vm.K2user(buf, flockn))
+	}
+	// a read lock requires the file to be open for reading and a write
+	// lock for writing
+	switch {
+	case lk.Type == defs.F_RDLCK && f.Perms&fd.FD_READ == 0:
+		return int(-defs.EBADF)
+	case lk.Type == defs.F_WRLCK && f.Perms&fd.FD_WRITE == 0:
+		return int(-defs.EBADF)
+	}
+	return int(lf.Setlk(p.Pid, &lk, cmd == defs.F_SETLKW))
+}
+
+func sys_flock(p *proc.Proc_t, fdn, op int) int {
+	f, ok := p.Fd_get(fdn)
+	if !ok {
+		return int(-defs.EBADF)
+	}
+	lf, ok := f.Fops.(fdops.Lockable_i)
+	if !ok {
+		return int(-defs.EINVAL)
+	}
+	return int(lf.Flock(op))
+}
+
 func sys_truncate(p *proc.Proc_t, pathn int, newlen uint) int {
 	path, err := p.Vm.Userstr(pathn, fs.NAME_MAX)
 	if err != 0 {
@@ -4304,6 +7220,29 @@ func sys_info(p *proc.Proc_t, n int) int {
 		ret = 0
 		p1, p2 := physmem.Pgcount()
 		fmt.Printf("pgcount: %v, %v\n", p1, p2)
+	case defs.SINFO_RSSANON, defs.SINFO_RSSFILE, defs.SINFO_RSSSHARED,
+		defs.SINFO_RSSSWAP, defs.SINFO_MAXRSS:
+		p.Vm.Lock_pmap()
+		rss := p.Vm.Rss
+		p.Vm.Unlock_pmap()
+		pgs := rss.Max
+		switch n {
+		case defs.SINFO_RSSANON:
+			pgs = rss.Anon
+		case defs.SINFO_RSSFILE:
+			pgs = rss.File
+		case defs.SINFO_RSSSHARED:
+			pgs = rss.Shared
+		case defs.SINFO_RSSSWAP:
+			pgs = rss.Swap
+		}
+		ret = pgs * mem.PGSIZE
+	case defs.SINFO_KSMSHARED, defs.SINFO_KSMSHARING:
+		shared, sharing := vm.Ksmstats()
+		ret = shared
+		if n == defs.SINFO_KSMSHARING {
+			ret = sharing
+		}
 	case defs.SINFO_PROCLIST:
 		//p.Vm.Vmregion.dump()
 		fmt.Printf("proc dump:\n")
@@ -4366,6 +7305,9 @@ func fieldinfo(sizes []int, n int) (int, int) {
 
 type elf_t struct {
 	data []uint8
+	// load bias added to all virtual addresses; non-zero only for
+	// position-independent (ET_DYN) images
+	base int
 }
 
 type elf_phdr struct {
@@ -4377,6 +7319,30 @@ type elf_phdr struct {
 	memsz   int
 }
 
+const (
+	ET_EXEC = 2
+	ET_DYN  = 3
+)
+
+const (
+	PT_LOAD      = 1
+	PT_INTERP    = 3
+	PT_PHDR      = 6
+	PT_TLS       = 7
+	PT_GNU_STACK = 0x6474e551
+)
+
+const (
+	PF_X = 1
+	PF_W = 2
+)
+
+const ELFOSABI_LINUX = 3
+
+// the stack pages of Linux programs, which expect a larger stack than biscuit
+// programs. they are mapped on demand.
+const _linuxstkpages = 256
+
 const (
 	ELF_QUARTER = 2
 	ELF_HALF    = 4
@@ -4450,7 +7416,7 @@ func (e *elf_t) header(c int) elf_phdr {
 	ret.etype = f(p_type, ELF_HALF)
 	ret.flags = f(p_flags, ELF_HALF)
 	ret.fileoff = f(p_offset, ELF_OFF)
-	ret.vaddr = f(p_vaddr, ELF_ADDR)
+	ret.vaddr = f(p_vaddr, ELF_ADDR) + e.base
 	ret.filesz = f(p_filesz, ELF_XWORD)
 	ret.memsz = f(p_memsz, ELF_XWORD)
 	return ret
@@ -4467,7 +7433,144 @@ func (e *elf_t) headers() []elf_phdr {
 
 func (e *elf_t) entry() int {
 	e_entry := 0x18
-	return readn(e.data, ELF_ADDR, e_entry)
+	return readn(e.data, ELF_ADDR, e_entry) + e.base
+}
+
+// returns the OS ABI of the ELF identification
+func (e *elf_t) osabi() int {
+	ei_osabi := 7
+	return readn(e.data, 1, ei_osabi)
+}
+
+// returns true if the image is not position-independent and has loadable
+// segments below USERMIN, which elf_load does not load.
+func (e *elf_t) lowsegs() bool {
+	if e.etype() == ET_DYN {
+		return false
+	}
+	for _, hdr := range e.headers() {
+		if hdr.etype == PT_LOAD && hdr.vaddr < mem.USERMIN {
+			return true
+		}
+	}
+	return false
+}
+
+func (e *elf_t) etype() int {
+	e_type := 0x10
+	return readn(e.data, ELF_QUARTER, e_type)
+}
+
+// returns the path of the program interpreter named by the PT_INTERP header,
+// if any.
+func (e *elf_t) interp(f *fd.Fd_t) (ustr.Ustr, bool, defs.Err_t) {
+	for _, hdr := range e.headers() {
+		if hdr.etype != PT_INTERP {
+			continue
+		}
+		if hdr.filesz <= 1 || hdr.filesz > fs.NAME_MAX {
+			return nil, false, -defs.ENOEXEC
+		}
+		buf := make([]uint8, hdr.filesz)
+		ub := &vm.Fakeubuf_t{}
+		ub.Fake_init(buf)
+		n, err := f.Fops.Pread(ub, hdr.fileoff)
+		if err != 0 {
+			return nil, false, err
+		}
+		if n != len(buf) || buf[n-1] != 0 {
+			return nil, false, -defs.ENOEXEC
+		}
+		return ustr.Ustr(buf[:n-1]), true, 0
+	}
+	return nil, false, 0
+}
+
+// returns true if the stack should be executable. like Linux, the stack is
+// executable when there is no PT_GNU_STACK header.
+func (e *elf_t) execstack() bool {
+	for _, hdr := range e.headers() {
+		if hdr.etype == PT_GNU_STACK {
+			return hdr.flags&PF_X != 0
+		}
+	}
+	return true
+}
+
+// the regions in which position-independent executables, program
+// interpreters, and the stack are placed, and the initial mmap hint. each
+// base is randomized within _baserange bytes of its region.
+const (
+	_piebase    = 0x0f0 << 39
+	_interpbase = 0x0f8 << 39
+	_stackbase  = 0x0ff << 39
+	_mmapbase   = mem.USERMIN
+	_baserange  = 1 << 36
+)
+
+// returns a random, page-aligned offset less than _baserange used to
+// randomize the address space layout of p, or zero if p disabled
+// randomization.
+func aslr_off(p *proc.Proc_t) int {
+	if p.Personality&defs.ADDR_NO_RANDOMIZE != 0 {
+		return 0
+	}
+	return entropy.Intn(_baserange>>mem.PGSHIFT) << mem.PGSHIFT
+}
+
+// chooses a random load bias for a position-independent image such that all
+// of its loadable segments fit in unused address space at or above start.
+// caller must hold proc's pagemap lock.
+func (e *elf_t) pickbase(p *proc.Proc_t, start int) defs.Err_t {
+	if e.etype() != ET_DYN {
+		return 0
+	}
+	e.base = 0
+	lo, hi := -1, 0
+	for _, hdr := range e.headers() {
+		if hdr.etype != PT_LOAD {
+			continue
+		}
+		s := util.Rounddown(hdr.vaddr, mem.PGSIZE)
+		end := util.Roundup(hdr.vaddr+hdr.memsz, mem.PGSIZE)
+		if lo == -1 || s < lo {
+			lo = s
+		}
+		if end > hi {
+			hi = end
+		}
+	}
+	if lo == -1 || hi-lo > _baserange {
+		return -defs.ENOEXEC
+	}
+	e.base = p.Vm.Unusedva_inner(start+aslr_off(p), hi-lo) - lo
+	return 0
+}
+
+func (e *elf_t) phentsize() int {
+	e_phentsize := 0x36
+	return readn(e.data, ELF_QUARTER, e_phentsize)
+}
+
+// returns the user address of the program headers, for AT_PHDR
+func (e *elf_t) phdraddr() int {
+	e_phoff := 0x20
+	phoff := readn(e.data, ELF_OFF, e_phoff)
+	hdrs := e.headers()
+	for _, hdr := range hdrs {
+		if hdr.etype == PT_PHDR {
+			return hdr.vaddr
+		}
+	}
+	// otherwise the program headers are in the segment which maps the
+	// start of the file
+	for _, hdr := range hdrs {
+		if hdr.etype == PT_LOAD && hdr.fileoff <= phoff &&
+			phoff < hdr.fileoff+hdr.filesz {
+			return hdr.vaddr + phoff - hdr.fileoff
+		}
+	}
+	return 0
 }
 
 func segload(p *proc.Proc_t, entry int, hdr *elf_phdr, fops fdops.Fdops_i) defs.Err_t {
@@ -4475,8 +7578,6 @@ func segload(p *proc.Proc_t, entry int, hdr *elf_phdr, fops fdops.Fdops_i) defs.
 		panic("requires copying")
 	}
 	perms := vm.PTE_U
-	//PF_X := 1
-	PF_W := 2
 	if hdr.flags&PF_W != 0 {
 		perms |= vm.PTE_W
 	}
@@ -4515,7 +7616,7 @@ func segload(p *proc.Proc_t, entry int, hdr *elf_phdr, fops fdops.Fdops_i) defs.
 		if !ok {
 			panic("just mapped?")
 		}
-		err := vm.Sys_pgfault(&p.Vm, vmi, ent, uintptr(vm.PTE_U))
+		err := vm.Sys_pgfault(p.Vm, vmi, ent, uintptr(vm.PTE_U))
 		if err != 0 {
 			return err
 		}
@@ -4547,11 +7648,37 @@ func segload(p *proc.Proc_t, entry int, hdr *elf_phdr, fops fdops.Fdops_i) defs.
 	return 0
 }
 
+// maps the loadable segments of a program interpreter, such as a dynamic
+// loader, at a random base. caller must hold proc's pagemap lock.
+func (e *elf_t) interp_load(p *proc.Proc_t, f *fd.Fd_t) defs.Err_t {
+	if e.etype() != ET_DYN && e.etype() != ET_EXEC {
+		return -defs.ENOEXEC
+	}
+	if err := e.pickbase(p, _interpbase); err != 0 {
+		return err
+	}
+	gimme := bounds.Bounds(bounds.B_ELF_T_ELF_LOAD)
+	entry := e.entry()
+	for _, hdr := range e.headers() {
+		if !res.Resadd_noblock(gimme) {
+			return -defs.ENOHEAP
+		}
+		if hdr.etype == PT_LOAD && hdr.vaddr >= mem.USERMIN {
+			err := segload(p, entry, &hdr, f.Fops)
+			if err != 0 {
+				return err
+			}
+		}
+	}
+	return 0
+}
+
 // returns user address of read-only TLS, thread 0's TLS image, TLS size, and
 // success. caller must hold proc's pagemap lock.
 func (e *elf_t) elf_load(p *proc.Proc_t, f *fd.Fd_t) (int, int, int, defs.Err_t) {
-	PT_LOAD := 1
-	PT_TLS := 7
+	if err := e.pickbase(p, _piebase); err != 0 {
+		return 0, 0, 0, err
+	}
 	istls := false
 	tlssize := 0
 	var tlsaddr int
@@ -32,6 +32,19 @@ type Syslimit_t struct {
 	//shared		Sysatomic_t
 	// bdev blocks
 	Blocks int
+	// protected by the resource group table lock
+	Cgroups int
+	// pages of shared memory objects and System V segments
+	Shmpgs Sysatomic_t
+	// shared memory objects and System V segments
+	Shmobjs Sysatomic_t
+	// protected by the System V table locks
+	Semsets int
+	Msgqs   int
+	// the default and largest size of a message queue
+	Msgqbytes int
+	// protected by the inotify watch table lock
+	Inwatches int
 }
 
 var Syslimit *Syslimit_t = MkSysLimit()
@@ -47,7 +60,15 @@ func MkSysLimit() *Syslimit_t {
 		Vnodes:   20000, // 1e6,
 		Pipes:    1e4,
 		// 8GB of block pages
-		Blocks: 100000, // 1 << 21,
+		Blocks:  100000, // 1 << 21,
+		Cgroups: 1024,
+		// 256MB of shared memory
+		Shmpgs:    1 << 16,
+		Shmobjs:   4096,
+		Semsets:   128,
+		Msgqs:     32,
+		Msgqbytes: 16384,
+		Inwatches: 8192,
 	}
 }
 
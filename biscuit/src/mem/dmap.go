@@ -13,6 +13,9 @@ const VEND int = 0x50
 const VUSER int = 0x59
 
 const USERMIN int = VUSER << 39
+
+// one past the highest userspace address
+const USERMAX int = 0x100 << 39
 const DMAPLEN int = 1 << 39
 
 var Vdirect = uintptr(VDIRECT << 39)
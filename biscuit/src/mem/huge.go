@@ -0,0 +1,162 @@
+package mem
+
+import "sync/atomic"
+
+// huge pages are 2MB, physically contiguous and aligned, and are mapped by a
+// single page directory entry.
+const HUGESHIFT uint = 21
+const HUGESIZE int = 1 << HUGESHIFT
+const HUGEPGS int = HUGESIZE / PGSIZE
+
+// the number of huge pages which Phys_init sets aside; set it before
+// Phys_init to reserve more. a free huge page is broken into pages once the
+// free list runs out, but the pages never form a huge page again.
+var Hugereserve = 8
+
+// returns the number of free pages, including the pages of free huge pages.
+// phys must be locked.
+func (phys *Physmem_t) _nfree() int {
+	return phys.nfree + phys.nhfree*HUGEPGS
+}
+
+// moves up to want aligned runs of free pages from the free list to the huge
+// page free list. only used during boot.
+func (phys *Physmem_t) _hugeinit(want int) {
+	taken := make([]bool, len(phys.Pgs))
+	phys.hfreei = ^uint32(0)
+	for idx := 0; idx+HUGEPGS <= len(phys.Pgs) && phys.nhfree < want; {
+		if (uint32(idx)+phys.startn)%uint32(HUGEPGS) != 0 {
+			idx++
+			continue
+		}
+		ok := true
+		for i := idx; i < idx+HUGEPGS; i++ {
+			if phys.Pgs[i].Refcnt != 0 {
+				ok = false
+				break
+			}
+		}
+		if ok {
+			for i := idx; i < idx+HUGEPGS; i++ {
+				taken[i] = true
+			}
+			phys.Pgs[idx].huge = true
+			phys.Pgs[idx].nexti = phys.hfreei
+			phys.hfreei = uint32(idx)
+			phys.nhfree++
+		}
+		idx += HUGEPGS
+	}
+	// rebuild the free list without the huge pages' pages
+	phys.freei = ^uint32(0)
+	phys.nfree = 0
+	for i := len(phys.Pgs) - 1; i >= 0; i-- {
+		if phys.Pgs[i].Refcnt != 0 || taken[i] {
+			continue
+		}
+		phys.Pgs[i].nexti = phys.freei
+		phys.freei = uint32(i)
+		phys.nfree++
+	}
+}
+
+// moves the pages of a free huge page to the free list. phys must be locked.
+func (phys *Physmem_t) _hugebreak() {
+	h := phys.hfreei
+	if h == ^uint32(0) {
+		return
+	}
+	phys.hfreei = phys.Pgs[h].nexti
+	phys.nhfree--
+	phys.Pgs[h].huge = false
+	for i := h + uint32(HUGEPGS) - 1; ; i-- {
+		phys.Pgs[i].nexti = phys.freei
+		phys.freei = i
+		phys.nfree++
+		if i == h {
+			break
+		}
+	}
+}
+
+// returns a zeroed huge page. like Refpg_new, the reference count of the
+// returned page is not incremented.
+func (phys *Physmem_t) Hugepg_new() (Pa_t, bool) {
+	phys.Lock()
+	h := phys.hfreei
+	if h == ^uint32(0) {
+		phys.Unlock()
+		return 0, false
+	}
+	phys.hfreei = phys.Pgs[h].nexti
+	phys.nhfree--
+	phys.Unlock()
+	p_pg := Pa_t(h+phys.startn) << PGSHIFT
+	for i := 0; i < HUGEPGS; i++ {
+		*phys.Dmap(p_pg + Pa_t(i<<PGSHIFT)) = *Zeropg
+	}
+	return p_pg, true
+}
+
+// increases the reference count of the huge page p_pg, or of each of its pages
+// if it was split.
+func (phys *Physmem_t) Hugeup(p_pg Pa_t) {
+	phys.Lock()
+	_, idx := phys.Refaddr(p_pg)
+	if phys.Pgs[idx].huge {
+		phys.Pgs[idx].Refcnt++
+	} else {
+		// the pages may also be mapped individually
+		for i := idx; i < idx+uint32(HUGEPGS); i++ {
+			atomic.AddInt32(&phys.Pgs[i].Refcnt, 1)
+		}
+	}
+	phys.Unlock()
+}
+
+// decreases the reference count of the huge page p_pg, or of each of its pages
+// if it was split, and frees the pages which are no longer used.
+func (phys *Physmem_t) Hugedown(p_pg Pa_t) {
+	phys.Lock()
+	_, idx := phys.Refaddr(p_pg)
+	if phys.Pgs[idx].huge {
+		phys.Pgs[idx].Refcnt--
+		if phys.Pgs[idx].Refcnt < 0 {
+			panic("negative ref count")
+		}
+		if phys.Pgs[idx].Refcnt == 0 {
+			phys.Pgs[idx].nexti = phys.hfreei
+			phys.hfreei = idx
+			phys.nhfree++
+		}
+	} else {
+		for i := idx; i < idx+uint32(HUGEPGS); i++ {
+			c := atomic.AddInt32(&phys.Pgs[i].Refcnt, -1)
+			if c < 0 {
+				panic("negative ref count")
+			}
+			if c == 0 {
+				phys.Pgs[i].nexti = phys.freei
+				phys.freei = i
+				phys.nfree++
+			}
+		}
+	}
+	phys.Unlock()
+}
+
+// gives each page of the huge page p_pg the huge page's reference count so
+// that the pages can be mapped and freed individually. the pages never form a
+// huge page again; they return to the free list once they are freed.
+func (phys *Physmem_t) Hugesplit(p_pg Pa_t) {
+	phys.Lock()
+	_, idx := phys.Refaddr(p_pg)
+	if phys.Pgs[idx].huge {
+		phys.Pgs[idx].huge = false
+		c := phys.Pgs[idx].Refcnt
+		for i := idx; i < idx+uint32(HUGEPGS); i++ {
+			atomic.StoreInt32(&phys.Pgs[i].Refcnt, c)
+		}
+	}
+	phys.Unlock()
+}
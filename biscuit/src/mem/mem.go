@@ -19,7 +19,8 @@ const PTE_G Pa_t = 1 << 8
 const PTE_PCD Pa_t = 1 << 4
 const PTE_PS Pa_t = 1 << 7
 
-const PTE_ADDR Pa_t = PGMASK
+// bit 63 is execute-disable
+const PTE_ADDR Pa_t = PGMASK &^ (1 << 63)
 
 type Pa_t uintptr
 type Bytepg_t [PGSIZE]uint8
@@ -70,6 +71,11 @@ type Physpg_t struct {
 	Refcnt int32
 	// index into pgs of next page on free list
 	nexti uint32
+	// the first page of a huge page which was not split. the reference
+	// count of a huge page is the first page's.
+	huge bool
+	// the number of locked mappings which map the page; see Mlock
+	mlocks int32
 }
 
 type Physmem_t struct {
@@ -78,8 +84,18 @@ type Physmem_t struct {
 	// index into pgs of first free pg
 	freei uint32
 	pmaps uint32
+	// the number of pages on the free list
+	nfree int
+	// index into pgs of the first free huge page and the number of free
+	// huge pages
+	hfreei uint32
+	nhfree int
 	sync.Mutex
 	Dmapinit bool
+	// Lowch receives a message whenever an allocation leaves fewer than
+	// Lowat free pages; the message is dropped if nobody is waiting.
+	Lowat int
+	Lowch chan bool
 }
 
 func (phys *Physmem_t) _refpg_new() (*Pg_t, Pa_t, bool) {
@@ -117,7 +133,9 @@ func (phys *Physmem_t) _reffree(idx uint32) {
 	phys.Lock()
 	onext := phys.freei
 	phys.Pgs[idx].nexti = onext
+	phys.Pgs[idx].mlocks = 0
 	phys.freei = idx
+	phys.nfree++
 	phys.Unlock()
 }
 
@@ -130,6 +148,32 @@ func (phys *Physmem_t) Refdown(p_pg Pa_t) bool {
 	return false
 }
 
+// counts a locked mapping of p_pg so that the caches which share the page
+// with the mapping keep it until every locked mapping of the page is unlocked
+// or the page is freed.
+func (phys *Physmem_t) Mlock(p_pg Pa_t) {
+	_, idx := phys.Refaddr(p_pg)
+	atomic.AddInt32(&phys.Pgs[idx].mlocks, 1)
+}
+
+// uncounts a locked mapping of p_pg. a page which no locked mapping counted,
+// such as a piece of a split huge page, stays unlocked.
+func (phys *Physmem_t) Munlock(p_pg Pa_t) {
+	_, idx := phys.Refaddr(p_pg)
+	n := &phys.Pgs[idx].mlocks
+	for {
+		c := atomic.LoadInt32(n)
+		if c == 0 || atomic.CompareAndSwapInt32(n, c, c-1) {
+			return
+		}
+	}
+}
+
+func (phys *Physmem_t) Mlocked(p_pg Pa_t) bool {
+	_, idx := phys.Refaddr(p_pg)
+	return atomic.LoadInt32(&phys.Pgs[idx].mlocks) != 0
+}
+
 var Zeropg *Pg_t
 
 // refcnt of returned page is not incremented (it is usually incremented via
@@ -171,6 +215,9 @@ func (phys *Physmem_t) _phys_new(fl *uint32) (*Pg_t, Pa_t, bool) {
 	var p_pg Pa_t
 	var ok bool
 	phys.Lock()
+	if fl == &phys.freei && *fl == ^uint32(0) {
+		phys._hugebreak()
+	}
 	ff := *fl
 	if ff != ^uint32(0) {
 		p_pg = Pa_t(ff+phys.startn) << PGSHIFT
@@ -180,6 +227,17 @@ func (phys *Physmem_t) _phys_new(fl *uint32) (*Pg_t, Pa_t, bool) {
 			panic("negative ref count")
 		}
 	}
+	if fl == &phys.freei {
+		if ok {
+			phys.nfree--
+		}
+		if phys._nfree() < phys.Lowat && phys.Lowch != nil {
+			select {
+			case phys.Lowch <- true:
+			default:
+			}
+		}
+	}
 	phys.Unlock()
 	if ok {
 		return phys.Dmap(p_pg), p_pg, true
@@ -233,6 +291,14 @@ func (phys *Physmem_t) Dmap8(p Pa_t) []uint8 {
 	return bpg[off:]
 }
 
+// returns the number of free pages
+func (phys *Physmem_t) Freecount() int {
+	phys.Lock()
+	ret := phys._nfree()
+	phys.Unlock()
+	return ret
+}
+
 func (phys *Physmem_t) Pgcount() (int, int) {
 	phys.Lock()
 	r1 := 0
@@ -286,6 +352,7 @@ func Phys_init() *Physmem_t {
 	phys.pmaps = ^uint32(0)
 	phys.Pgs[0].Refcnt = 0
 	phys.Pgs[0].nexti = ^uint32(0)
+	phys.nfree = 1
 	last := phys.freei
 	for i := 0; i < respgs-1; i++ {
 		p_pg := Pa_t(runtime.Get_phys())
@@ -301,8 +368,10 @@ func Phys_init() *Physmem_t {
 		phys.Pgs[idx].Refcnt = 0
 		phys.Pgs[last].nexti = idx
 		phys.Pgs[idx].nexti = ^uint32(0)
+		phys.nfree++
 		last = idx
 	}
+	phys._hugeinit(Hugereserve)
 	fmt.Printf("Reserved %v pages (%vMB)\n", respgs, respgs>>8)
 	return phys
 }
@@ -0,0 +1,102 @@
+package oommsg
+
+import "fmt"
+import "sync"
+import "time"
+
+import "defs"
+import "fdops"
+
+// a process which the OOM killer killed
+type Oomevent_t struct {
+	// increases by one for each event
+	Seq  int
+	When time.Time
+	Pid  int
+	Name string
+	// the victim's badness score and oom_score_adj
+	Score int
+	Adj   int
+	// what ran out: the kernel heap, or a resource of a resource group
+	Reason string
+	// the id of the group which ran out; meaningless for the kernel heap
+	Cg int
+}
+
+func (e *Oomevent_t) String() string {
+	return fmt.Sprintf("%d %d.%09d pid=%d name=%s score=%d adj=%d "+
+		"reason=%s group=%d\n", e.Seq, e.When.Unix(), e.When.Nanosecond(),
+		e.Pid, e.Name, e.Score, e.Adj, e.Reason, e.Cg)
+}
+
+// the number of most recent events that are kept
+const _nevents = 64
+
+// the OOM event log, which /dev/oom reads
+var _events struct {
+	sync.Mutex
+	ring [_nevents]Oomevent_t
+	// the sequence number of the next event
+	next    int
+	pollers fdops.Pollers_t
+}
+
+// records ev, setting its sequence number, and wakes the pollers of the log
+func Report(ev Oomevent_t) {
+	_events.Lock()
+	ev.Seq = _events.next
+	_events.ring[ev.Seq%_nevents] = ev
+	_events.next++
+	_events.pollers.Wakeready(fdops.R_READ)
+	_events.Unlock()
+}
+
+// returns the sequence number of the oldest event which is kept
+func _oldest() int {
+	if _events.next < _nevents {
+		return 0
+	}
+	return _events.next - _nevents
+}
+
+// copies one line per event, starting with the event numbered *seq, to dst
+// and advances *seq past the copied events. only whole lines are copied;
+// events which were dropped from the log before they were read are skipped.
+// returns 0 if there is no new event.
+func Read(dst fdops.Userio_i, seq *int) (int, defs.Err_t) {
+	_events.Lock()
+	defer _events.Unlock()
+	if o := _oldest(); *seq < o {
+		*seq = o
+	}
+	did := 0
+	for ; *seq < _events.next; *seq++ {
+		l := []uint8(_events.ring[*seq%_nevents].String())
+		if len(l) > dst.Remain() {
+			if did == 0 {
+				return 0, -defs.EINVAL
+			}
+			break
+		}
+		c, err := dst.Uiowrite(l)
+		did += c
+		if err != 0 {
+			return did, err
+		}
+	}
+	return did, 0
+}
+
+// the log is readable by a reader at *seq if an event numbered *seq or later
+// exists.
+func Poll(pm fdops.Pollmsg_t, seq int) (fdops.Ready_t, defs.Err_t) {
+	_events.Lock()
+	defer _events.Unlock()
+	if seq < _events.next {
+		return pm.Events & fdops.R_READ, 0
+	}
+	if pm.Events&fdops.R_READ == 0 || !pm.Dowait {
+		return 0, 0
+	}
+	return 0, _events.pollers.Addpoller(&pm)
+}
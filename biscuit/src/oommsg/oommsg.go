@@ -1,8 +1,15 @@
 package oommsg
 
+import "cgroup"
+
 var OomCh chan Oommsg_t = make(chan Oommsg_t)
 
 type Oommsg_t struct {
 	Need   int
 	Resume chan bool
+	// a resource group which is out of Kind asks to kill one of its
+	// processes; Need is then in units of Kind. Resume receives false if
+	// the group has no process to kill.
+	Cg   *cgroup.Cgroup_t
+	Kind cgroup.Kind_t
 }
@@ -4,6 +4,9 @@ import "fmt"
 import "runtime"
 import "time"
 
+import "cgroup"
+import "defs"
+import "mem"
 import "oommsg"
 import "res"
 
@@ -31,6 +34,10 @@ func (o *oom_t) gc() {
 func (o *oom_t) reign() {
 outter:
 	for msg := range o.halp {
+		if msg.Cg != nil {
+			msg.Resume <- o.groupoom(msg)
+			continue
+		}
 		fmt.Printf("A need %v, rem %v\n", msg.Need, runtime.Remain())
 		if msg.Need < runtime.Remain() {
 			// there is apparently enough reservation available for
@@ -68,7 +75,9 @@ outter:
 		}
 		for {
 			// someone must die
-			o.dispatch_peasant(msg.Need)
+			if !o.dispatch_peasant(msg.Need, nil, "kernel-heap") {
+				panic("nothing to kill?")
+			}
 			o.gc()
 			if msg.Need < runtime.Remain() {
 				msg.Resume <- true
@@ -78,22 +87,43 @@ outter:
 	}
 }
 
-func (o *oom_t) dispatch_peasant(need int) {
+// kills a process of the resource group which ran out of msg.Kind unless the
+// group has room by now. returns false if the group has no process to kill.
+func (o *oom_t) groupoom(msg oommsg.Oommsg_t) bool {
+	if msg.Cg.Fits(msg.Kind, msg.Need) {
+		return true
+	}
+	return o.dispatch_peasant(msg.Need, msg.Cg, "group-"+msg.Kind.String())
+}
+
+// kills the process with the highest badness score, only considering the
+// processes of the resource group cg unless cg is nil, and reports the kill to
+// the OOM event log. returns false if there is no process to kill.
+func (o *oom_t) dispatch_peasant(need int, cg *cgroup.Cgroup_t,
+	reason string) bool {
 	// the oom killer's memory use should have a small bound
 	var head *Proc_t
 	Proclock.Lock()
 	for _, p := range Allprocs {
+		if cg != nil && !p.Cg.Within(cg) {
+			continue
+		}
 		p.Oomlink = head
 		head = p
 	}
 	Proclock.Unlock()
 
-	var memmax int
+	// oom_score_adj is relative to the memory which the candidates share
+	total := len(mem.Physmem.Pgs)
+	if cg != nil && cg.Limit(cgroup.PAGES) != cgroup.Unlimited {
+		total = cg.Limit(cgroup.PAGES)
+	}
+	var scoremax int
 	var vic *Proc_t
 	for p := head; p != nil; p = p.Oomlink {
-		mem := o.judge_peasant(p)
-		if mem > memmax {
-			memmax = mem
+		score := o.judge_peasant(p, total)
+		if score > scoremax {
+			scoremax = score
 			vic = p
 		}
 	}
@@ -106,12 +136,24 @@ func (o *oom_t) dispatch_peasant(need int) {
 	}
 
 	if vic == nil {
-		panic("nothing to kill?")
+		return false
 	}
 
-	fmt.Printf("Killing PID %d \"%v\" for (%v %v)...\n", vic.Pid, vic.Name,
-		res.Human(need), vic.Vm.Vmregion.Novma)
-	vic.Doomall()
+	if cg != nil {
+		fmt.Printf("Killing PID %d \"%v\" in group %d...\n", vic.Pid,
+			vic.Name, cg.Id)
+	} else {
+		fmt.Printf("Killing PID %d \"%v\" for (%v %v)...\n", vic.Pid,
+			vic.Name, res.Human(need), vic.Vm.Vmregion.Novma)
+	}
+	ev := oommsg.Oomevent_t{When: time.Now(), Pid: vic.Pid,
+		Name: vic.Name.String(), Score: scoremax, Adj: vic.Oom_adj(),
+		Reason: reason}
+	if cg != nil {
+		ev.Cg = cg.Id
+	}
+	oommsg.Report(ev)
+	vic.Kill(defs.SIGKILL)
 	st := time.Now()
 	dl := st.Add(time.Second)
 	// wait for the victim to die
@@ -134,30 +176,57 @@ func (o *oom_t) dispatch_peasant(need int) {
 			sleept = maxs
 		}
 	}
+	return true
 }
 
-// acquires p's pmap and fd locks (separately)
-func (o *oom_t) judge_peasant(p *Proc_t) int {
+// returns the badness score of p: the number of pages and objects which
+// killing p frees, including the kernel heap its threads reserved, plus p's
+// oom_score_adj in thousandths of total. a process which may be killed scores
+// at least 1. acquires p's pmap, fd, and thread locks (separately)
+func (o *oom_t) judge_peasant(p *Proc_t, total int) int {
 	// init(1) must never perish
 	if p.Pid == 1 {
 		return 0
 	}
+	adj := p.Oom_adj()
+	if adj == defs.OOM_ADJ_MIN {
+		return 0
+	}
 
-	p.Vm.Lock_pmap()
-	novma := int(p.Vm.Vmregion.Novma)
-	p.Vm.Unlock_pmap()
+	// an exec may replace a shared address space or fd table
+	as := p.Vm
+	as.Lock_pmap()
+	novma := int(as.Vmregion.Novma)
+	pgs := as.Rss.Resident() + as.Rss.Swap
+	as.Unlock_pmap()
 
 	var nofd int
-	p.Fdl.Lock()
-	for _, fd := range p.Fds {
+	ft := p.Fdtable_t
+	ft.Fdl.Lock()
+	for _, fd := range ft.Fds {
 		if fd != nil {
 			nofd++
 		}
 	}
-	p.Fdl.Unlock()
+	ft.Fdl.Unlock()
 
 	// count per-thread and per-child process wait objects
 	chalds := p.Mywait.Len()
 
-	return novma + nofd + chalds
+	// the reservations of the system calls in progress
+	var heap int
+	p.Threadi.Lock()
+	for _, t := range p.Threadi.Notes {
+		t.Lock()
+		heap += t.Cgheap
+		t.Unlock()
+	}
+	p.Threadi.Unlock()
+
+	score := pgs + novma + nofd + chalds + heap>>mem.PGSHIFT
+	score += adj * total / 1000
+	if score < 1 {
+		score = 1
+	}
+	return score
 }
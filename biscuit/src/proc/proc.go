@@ -7,8 +7,10 @@ import "runtime"
 
 import "accnt"
 import "bounds"
+import "cgroup"
 import "defs"
 import "fd"
+import "fdops"
 import "limits"
 import "mem"
 import "res"
@@ -22,6 +24,14 @@ type Ulimit_t struct {
 	Nofile uint
 	Novma  uint
 	Noproc uint
+	// bytes of locked mappings and the hard limit, which can only be
+	// lowered
+	Memlock    uint
+	Memlockmax uint
+	// the highest SCHED_FIFO priority the process may set and the hard
+	// limit, which can only be lowered
+	Rtprio    uint
+	Rtpriomax uint
 }
 
 type Proc_t struct {
@@ -34,32 +44,52 @@ type Proc_t struct {
 	Mywait Wait_t
 	// waitinfo of my parent
 	Pwait *Wait_t
+	// the signals sent to this process
+	Sigs Sigpend_t
 
 	// thread tids of this process
 	Threadi tinfo.Threadinfo_t
 
-	// Address space
-	Vm vm.Vm_t
+	// Address space, shared with the processes created by
+	// clone(CLONE_VM)
+	Vm *vm.Vm_t
 
 	// mmap next virtual address hint
 	Mmapi int
 
+	// personality flags, such as ADDR_NO_RANDOMIZE. preserved across fork
+	// and exec.
+	Personality int
+	// the system call ABI of the running image, PER_BISCUIT or PER_LINUX.
+	// chosen at exec from the personality and preserved across fork.
+	Abi int
+
 	// a process is marked doomed when it has been killed but may have
 	// threads currently running on another processor
 	doomed     bool
 	exitstatus int
 
-	Fds []*fd.Fd_t
-	// where to start scanning for free fds
-	fdstart int
-	// fds, fdstart, nfds protected by fdl
-	Fdl sync.Mutex
-	// number of valid file descriptors
-	nfds int
+	// the fd table, shared with the processes created by
+	// clone(CLONE_FILES)
+	*Fdtable_t
 
+	// the working directory, shared with the processes created by
+	// clone(CLONE_FS)
 	Cwd *fd.Cwd_t
 
+	// closed once a child created by clone(CLONE_VFORK) execs or
+	// terminates, which resumes its parent
+	vforkc chan bool
+
 	Ulim Ulimit_t
+	// the resource group; protected by Proclock and Threadi's lock
+	Cg *cgroup.Cgroup_t
+	// the OOM killer's bias for or against killing this process, from
+	// OOM_ADJ_MIN (never) to OOM_ADJ_MAX; protected by Proclock
+	oomadj int
+	// the lowest oomadj the process may set, inherited from its parent;
+	// protected by Proclock
+	oomadjmin int
 
 	// this proc's rusage
 	Atime accnt.Accnt_t
@@ -69,10 +99,103 @@ type Proc_t struct {
 	syscall Syscall_i
 	// no thread can read/write Oomlink except the OOM killer
 	Oomlink *Proc_t
+
+	// the semaphore sets which undo this proc's SEM_UNDO operations when
+	// it terminates; protected by Threadi's lock
+	semundo []Semundo_i
+}
+
+// a System V semaphore set which records adjustments for a process
+type Semundo_i interface {
+	// applies and forgets the adjustments of process pid
+	Undo(pid int)
+}
+
+// records that s holds adjustments for p. a forked child has none.
+func (p *Proc_t) Semundo_add(s Semundo_i) {
+	p.Threadi.Lock()
+	p.semundo = append(p.semundo, s)
+	p.Threadi.Unlock()
 }
 
 var Allprocs = make(map[int]*Proc_t, limits.Syslimit.Sysprocs)
 
+type Fdtable_t struct {
+	Fds []*fd.Fd_t
+	// where to start scanning for free fds
+	fdstart int
+	// fds, fdstart, nfds, refs protected by fdl
+	Fdl sync.Mutex
+	// number of valid file descriptors
+	nfds int
+	// the number of processes using the table
+	refs int
+}
+
+// returns a new fd table with copies of fds. the fd table containing fds must
+// be locked.
+func Mkfdtable(fds []*fd.Fd_t) *Fdtable_t {
+	ret := &Fdtable_t{refs: 1}
+	ret.Fds = make([]*fd.Fd_t, len(fds))
+	ret.fdstart = 3
+	for i := range fds {
+		if fds[i] == nil {
+			continue
+		}
+		tfd, err := fd.Copyfd(fds[i])
+		// copying an fd may fail if another thread closes the fd out
+		// from under us
+		if err == 0 {
+			ret.Fds[i] = tfd
+			ret.nfds++
+		}
+	}
+	return ret
+}
+
+// returns a private copy of the fd table for a child process
+func (ft *Fdtable_t) Copy() *Fdtable_t {
+	ft.Fdl.Lock()
+	defer ft.Fdl.Unlock()
+	return Mkfdtable(ft.Fds)
+}
+
+// adds a reference for another process sharing the fd table
+func (ft *Fdtable_t) Share() *Fdtable_t {
+	ft.Fdl.Lock()
+	ft.refs++
+	ft.Fdl.Unlock()
+	return ft
+}
+
+// returns true if more than one process uses the fd table
+func (ft *Fdtable_t) Shared() bool {
+	ft.Fdl.Lock()
+	ret := ft.refs > 1
+	ft.Fdl.Unlock()
+	return ret
+}
+
+// drops a process' reference; the last reference closes the fds
+func (ft *Fdtable_t) Release() {
+	ft.Fdl.Lock()
+	defer ft.Fdl.Unlock()
+	ft.refs--
+	if ft.refs < 0 {
+		panic("neg fdtable refs")
+	}
+	if ft.refs != 0 {
+		return
+	}
+	for i, f := range ft.Fds {
+		if f != nil {
+			fd.Close_panic(f)
+			ft.Fds[i] = nil
+		}
+	}
+	ft.nfds = 0
+}
+
 func (p *Proc_t) Tid0() defs.Tid_t {
 	return p.tid0
 }
@@ -92,34 +215,35 @@ func (p *Proc_t) Fd_insert(f *fd.Fd_t, perms int) (int, bool) {
 }
 
 func (p *Proc_t) fd_insert_inner(f *fd.Fd_t, perms int) (int, bool) {
+	return p.fd_insert_min(f, perms, 0)
+}
 
+// inserts f at the lowest free fd which is not less than min
+func (p *Proc_t) fd_insert_min(f *fd.Fd_t, perms, min int) (int, bool) {
 	if uint(p.nfds) >= p.Ulim.Nofile {
 		return -1, false
 	}
-	// find free fd
-	newfd := p.fdstart
+	// find free fd; the fds below fdstart are in use
+	newfd := min
+	if newfd < p.fdstart {
+		newfd = p.fdstart
+	}
 	found := false
 	for newfd < len(p.Fds) {
 		if p.Fds[newfd] == nil {
-			p.fdstart = newfd + 1
+			if min <= p.fdstart {
+				p.fdstart = newfd + 1
+			}
 			found = true
 			break
 		}
 		newfd++
 	}
 	if !found {
-		// double size of fd table
-		ol := len(p.Fds)
-		nl := 2 * ol
-		if p.Ulim.Nofile != defs.RLIM_INFINITY && nl > int(p.Ulim.Nofile) {
-			nl = int(p.Ulim.Nofile)
-			if nl < ol {
-				panic("how")
-			}
+		if uint(newfd) >= p.Ulim.Nofile {
+			return -1, false
 		}
-		nfdt := make([]*fd.Fd_t, nl, nl)
-		copy(nfdt, p.Fds)
-		p.Fds = nfdt
+		p.fd_grow(newfd + 1)
 	}
 	fdn := newfd
 	fd := f
@@ -135,6 +259,34 @@ func (p *Proc_t) fd_insert_inner(f *fd.Fd_t, perms int) (int, bool) {
 	return fdn, true
 }
 
+// dup2(2) and F_DUPFD may only request fds below fdmax, which bounds the
+// size of the fd table of a process without an fd limit
+const fdmax = 1 << 16
+
+// returns true if a process may request fdn
+func (p *Proc_t) fd_inlimit(fdn int) bool {
+	return fdn >= 0 && fdn < fdmax && uint(fdn) < p.Ulim.Nofile
+}
+
+// grows the fd table to at least n fds. n must not exceed the fd limit.
+func (p *Proc_t) fd_grow(n int) {
+	// at least double size of fd table
+	ol := len(p.Fds)
+	nl := 2 * ol
+	if nl < n {
+		nl = n
+	}
+	if p.Ulim.Nofile != defs.RLIM_INFINITY && nl > int(p.Ulim.Nofile) {
+		nl = int(p.Ulim.Nofile)
+		if nl < ol || nl < n {
+			panic("how")
+		}
+	}
+	nfdt := make([]*fd.Fd_t, nl, nl)
+	copy(nfdt, p.Fds)
+	p.Fds = nfdt
+}
+
 // returns the fd numbers and success
 func (p *Proc_t) Fd_insert2(f1 *fd.Fd_t, perms1 int,
 	f2 *fd.Fd_t, perms2 int) (int, int, bool) {
@@ -200,12 +352,38 @@ func (p *Proc_t) fd_del_inner(fdn int) (*fd.Fd_t, bool) {
 	return ret, ok
 }
 
+// closes f, which the process no longer refers to, after releasing the
+// process' record locks on the file
+func (p *Proc_t) Fd_close(f *fd.Fd_t) defs.Err_t {
+	if lf, ok := f.Fops.(fdops.Lockable_i); ok {
+		lf.Unlock_owner(p.Pid)
+	}
+	return f.Fops.Close()
+}
+
+// gives p a private copy of its fd table if other processes share it, as
+// exec does
+func (p *Proc_t) Fd_unshare() {
+	oft := p.Fdtable_t
+	if !oft.Shared() {
+		return
+	}
+	p.Fdtable_t = oft.Copy()
+	oft.Release()
+}
+
 // fdn is not guaranteed to be a sane fd. returns the the fd replaced by ofdn
-// and whether it exists and needs to be closed, and success.
-func (p *Proc_t) Fd_dup(ofdn, nfdn int) (*fd.Fd_t, bool, defs.Err_t) {
+// and whether it exists and needs to be closed, and success. the new fd is
+// close-on-exec if cloexec is true; the flag is set before the new fd is
+// visible to a forking thread.
+func (p *Proc_t) Fd_dup(ofdn, nfdn int, cloexec bool) (*fd.Fd_t, bool,
+	defs.Err_t) {
 	if ofdn == nfdn {
 		return nil, false, 0
 	}
+	if !p.fd_inlimit(nfdn) {
+		return nil, false, -defs.EBADF
+	}
 
 	p.Fdl.Lock()
 	defer p.Fdl.Unlock()
@@ -219,16 +397,101 @@ func (p *Proc_t) Fd_dup(ofdn, nfdn int) (*fd.Fd_t, bool, defs.Err_t) {
 		return nil, false, err
 	}
 	cpy.Perms &^= fd.FD_CLOEXEC
+	if cloexec {
+		cpy.Perms |= fd.FD_CLOEXEC
+	}
+	if nfdn >= len(p.Fds) {
+		p.fd_grow(nfdn + 1)
+	}
 	rfd, needclose := p.Fd_get_inner(nfdn)
 	p.Fds[nfdn] = cpy
+	if !needclose {
+		p.nfds++
+	}
 
 	return rfd, needclose, 0
 }
 
+// duplicates ofdn to the lowest free fd which is not less than min. returns
+// the new fd.
+func (p *Proc_t) Fd_dupmin(ofdn, min int, cloexec bool) (int, defs.Err_t) {
+	if !p.fd_inlimit(min) {
+		return 0, -defs.EINVAL
+	}
+	p.Fdl.Lock()
+	ofd, ok := p.Fd_get_inner(ofdn)
+	if !ok {
+		p.Fdl.Unlock()
+		return 0, -defs.EBADF
+	}
+	cpy, err := fd.Copyfd(ofd)
+	if err != 0 {
+		p.Fdl.Unlock()
+		return 0, err
+	}
+	perms := cpy.Perms &^ fd.FD_CLOEXEC
+	if cloexec {
+		perms |= fd.FD_CLOEXEC
+	}
+	nfdn, ok := p.fd_insert_min(cpy, perms, min)
+	p.Fdl.Unlock()
+	if !ok {
+		fd.Close_panic(cpy)
+		return 0, -defs.EMFILE
+	}
+	return nfdn, 0
+}
+
+// sets or clears the close-on-exec flag of fdn with the fd table locked so
+// that a forking thread copies the fd with either the old or the new flag.
+func (p *Proc_t) Fd_cloexec(fdn int, cloexec bool) bool {
+	p.Fdl.Lock()
+	defer p.Fdl.Unlock()
+	f, ok := p.Fd_get_inner(fdn)
+	if !ok {
+		return false
+	}
+	if cloexec {
+		f.Perms |= fd.FD_CLOEXEC
+	} else {
+		f.Perms &^= fd.FD_CLOEXEC
+	}
+	return true
+}
+
+// removes the fds from first to last from the fd table, returning them so
+// that the caller can close them.
+func (p *Proc_t) Fd_delrange(first, last int) []*fd.Fd_t {
+	p.Fdl.Lock()
+	defer p.Fdl.Unlock()
+	var ret []*fd.Fd_t
+	for fdn := first; fdn <= last && fdn < len(p.Fds); fdn++ {
+		if f, ok := p.fd_del_inner(fdn); ok {
+			ret = append(ret, f)
+		}
+	}
+	return ret
+}
+
+// sets the close-on-exec flag of the fds from first to last
+func (p *Proc_t) Fd_cloexecrange(first, last int) {
+	p.Fdl.Lock()
+	defer p.Fdl.Unlock()
+	for fdn := first; fdn <= last && fdn < len(p.Fds); fdn++ {
+		if f := p.Fds[fdn]; f != nil {
+			f.Perms |= fd.FD_CLOEXEC
+		}
+	}
+}
+
 // returns whether the parent's TLB should be flushed and whether the we
 // successfully copied the parent's address space.
 func (parent *Proc_t) Vm_fork(child *Proc_t, rsp uintptr) (bool, bool) {
 	parent.Vm.Lockassert_pmap()
+	// the page-out daemon may find the child before the fork finishes, and
+	// sys_pgfault expects pmap to be locked
+	child.Vm.Lock_pmap()
+	defer child.Vm.Unlock_pmap()
 	// first add kernel pml4 entries
 	for _, e := range mem.Kents {
 		child.Vm.Pmap[e.Pml4slot] = e.Entry
@@ -243,6 +506,10 @@ func (parent *Proc_t) Vm_fork(child *Proc_t, rsp uintptr) (bool, bool) {
 		start := int(vmi.Pgn << vm.PGSHIFT)
 		end := start + int(vmi.Pglen<<vm.PGSHIFT)
 		ashared := vmi.Mtype == vm.VSANON
+		if ashared && parent.Vm.Unswap(vmi) != 0 {
+			failed = true
+			return
+		}
 		fl, ok := vm.Ptefork(child.Vm.Pmap, parent.Vm.Pmap, start, end, ashared)
 		failed = failed || !ok
 		doflush = doflush || fl
@@ -251,6 +518,14 @@ func (parent *Proc_t) Vm_fork(child *Proc_t, rsp uintptr) (bool, bool) {
 	if failed {
 		return doflush, false
 	}
+	// the child maps every page that the parent maps
+	rss := parent.Vm.Rss
+	rss.Cg = child.Vm.Rss.Cg
+	rss.Max = rss.Resident()
+	if !rss.Cg.Charge(cgroup.PAGES, rss.Resident()) {
+		return doflush, false
+	}
+	child.Vm.Rss = rss
 
 	// don't mark stack COW since the parent/child will fault their stacks
 	// immediately
@@ -259,22 +534,19 @@ func (parent *Proc_t) Vm_fork(child *Proc_t, rsp uintptr) (bool, bool) {
 	if !ok {
 		return doflush, true
 	}
-	pte, ok := vmi.Ptefor(child.Vm.Pmap, rsp)
+	pte, ok := child.Vm.Ptefor(vmi, rsp)
 	if !ok || *pte&vm.PTE_P == 0 || *pte&vm.PTE_U == 0 {
 		return doflush, true
 	}
-	// sys_pgfault expects pmap to be locked
-	child.Vm.Lock_pmap()
 	perms := uintptr(vm.PTE_U | vm.PTE_W)
-	if vm.Sys_pgfault(&child.Vm, vmi, rsp, perms) != 0 {
+	if vm.Sys_pgfault(child.Vm, vmi, rsp, perms) != 0 {
 		return doflush, false
 	}
-	child.Vm.Unlock_pmap()
 	vmi, ok = parent.Vm.Vmregion.Lookup(rsp)
 	if !ok || *pte&vm.PTE_P == 0 || *pte&vm.PTE_U == 0 {
 		panic("child has stack but not parent")
 	}
-	pte, ok = vmi.Ptefor(parent.Vm.Pmap, rsp)
+	pte, ok = parent.Vm.Ptefor(vmi, rsp)
 	if !ok {
 		panic("must exist")
 	}
@@ -284,6 +556,31 @@ func (parent *Proc_t) Vm_fork(child *Proc_t, rsp uintptr) (bool, bool) {
 	return true, true
 }
 
+// replaces the address space of p. Proclock protects the pointer from
+// Vm_iter.
+func (p *Proc_t) Vm_set(as *vm.Vm_t) {
+	Proclock.Lock()
+	p.Vm = as
+	Proclock.Unlock()
+}
+
+// returns the channel which is closed once the child p, created by
+// clone(CLONE_VFORK), no longer uses its parent's address space. must be
+// called before p runs.
+func (p *Proc_t) Vfork_start() <-chan bool {
+	p.vforkc = make(chan bool)
+	return p.vforkc
+}
+
+// resumes the parent of a child created by clone(CLONE_VFORK). called when the
+// child execs or terminates, while it has a single thread.
+func (p *Proc_t) Vfork_done() {
+	if p.vforkc != nil {
+		close(p.vforkc)
+		p.vforkc = nil
+	}
+}
+
 // flush TLB on all CPUs that may have this processes' pmap loaded
 func (p *Proc_t) Tlbflush() {
 	// this flushes the TLB for now
@@ -351,18 +648,28 @@ func (p *Proc_t) trap_proc(tf *[defs.TFSIZE]uintptr, tid defs.Tid_t, intno, aux
 
 	case defs.TIMER:
 		//fmt.Printf(".")
-		runtime.Gosched()
+		runtime.Schedtick()
 	case defs.PGFAULT:
 		faultaddr := uintptr(aux)
 		err := p.Vm.Pgfault(tid, faultaddr, tf[defs.TF_ERROR])
 		restart = err == -defs.ENOHEAP
-		if err != 0 && !restart {
+		// a fault which waited for a userfaultfd handler may have
+		// been interrupted by a kill
+		if err != 0 && !restart && !p.doomed {
 			fmt.Printf("*** fault *** %v: addr %x, "+
 				"rip %x, err %v. killing...\n", p.Name, faultaddr,
 				tf[defs.TF_RIP], err)
 			p.syscall.Sys_exit(p, tid, defs.SIGNALED|defs.Mkexitsig(11))
 		}
-	case defs.DIVZERO, defs.GPFAULT, defs.UD:
+	case defs.UD:
+		if p.Abi == defs.PER_LINUX {
+			if ok, rs := p._linux_syscall(tf, tid); ok {
+				restart = rs
+				break
+			}
+		}
+		fallthrough
+	case defs.DIVZERO, defs.GPFAULT:
 		fmt.Printf("%s -- TRAP: %v, RIP: %x\n", p.Name, intno,
 			tf[defs.TF_RIP])
 		p.syscall.Sys_exit(p, tid, defs.SIGNALED|defs.Mkexitsig(4))
@@ -376,6 +683,33 @@ func (p *Proc_t) trap_proc(tf *[defs.TFSIZE]uintptr, tid defs.Tid_t, intno, aux
 	return fastret, restart
 }
 
+// the syscall instruction
+const _syscallinsn = 0x050f
+
+// executes the system call of a program of the Linux ABI. SYSCALL is not
+// enabled, thus the syscall instruction raises an invalid opcode exception,
+// after which the registers are updated as the instruction would have.
+// returns false if the exception was not caused by a syscall instruction, and
+// whether the system call must be restarted.
+func (p *Proc_t) _linux_syscall(tf *[defs.TFSIZE]uintptr,
+	tid defs.Tid_t) (bool, bool) {
+	rip := tf[defs.TF_RIP]
+	insn, err := p.Vm.Userreadn(int(rip), 2)
+	if err != 0 || insn != _syscallinsn {
+		return false, false
+	}
+	tf[defs.TF_RIP] = rip + 2
+	tf[defs.TF_RCX] = rip + 2
+	tf[defs.TF_R11] = tf[defs.TF_RFLAGS]
+	ret := p.syscall.Syscall(p, tid, tf)
+	if ret == int(-defs.ENOHEAP) {
+		tf[defs.TF_RIP] = rip
+		return true, true
+	}
+	tf[defs.TF_RAX] = uintptr(ret)
+	return true, false
+}
+
 func (p *Proc_t) run(tf *[defs.TFSIZE]uintptr, tid defs.Tid_t) {
 
 	p.Threadi.Lock()
@@ -396,7 +730,11 @@ func (p *Proc_t) run(tf *[defs.TFSIZE]uintptr, tid defs.Tid_t) {
 
 	gimme := bounds.Bounds(bounds.B_PROC_T_RUN1)
 	fastret := false
+	class := defs.SCHED_OTHER
 	for p.resched(tid, mynote) {
+		if c, ok := mynote.Sched_apply(); ok {
+			class = c
+		}
 		// for fast syscalls, we restore little state. thus we must
 		// distinguish between returning to the user program after it
 		// was interrupted by a timer interrupt/CPU exception vs a
@@ -404,8 +742,10 @@ func (p *Proc_t) run(tf *[defs.TFSIZE]uintptr, tid defs.Tid_t) {
 		refp, _ := mem.Physmem.Refaddr(p.Vm.P_pmap)
 		res.Resend()
 
+		start := p.Atime.Now()
 		intno, aux, op_pmap, odec := runtime.Userrun(tf, fxbuf,
 			uintptr(p.Vm.P_pmap), fastret, refp)
+		p.Atime.Utadd_class(class, p.Atime.Now()-start)
 
 		// XXX debug
 		if tinfo.Current() != mynote {
@@ -438,9 +778,15 @@ func (p *Proc_t) Sched_add(tf *[defs.TFSIZE]uintptr, tid defs.Tid_t) {
 }
 
 func (p *Proc_t) _thread_new(t defs.Tid_t) {
-	p.Threadi.Lock()
 	tnote := &tinfo.Tnote_t{Alive: true, State: p}
 	tnote.Killnaps.Killch = make(chan bool, 1)
+	// threads inherit the scheduling parameters of their creator
+	if cur, ok := tinfo.Currentok(); ok {
+		tnote.Sched = cur.Sched_get()
+		tnote.Schedmod = true
+	}
+	p.Threadi.Lock()
+	tnote.Cg = p.Cg
 	p.Threadi.Notes[t] = tnote
 	p.Threadi.Unlock()
 }
@@ -463,6 +809,24 @@ func (p *Proc_t) Thread_undo(t defs.Tid_t) {
 	p.Threadi.Unlock()
 }
 
+// sets the user address which is cleared when thread t of the Linux ABI exits
+func (p *Proc_t) Set_cleartid(t defs.Tid_t, va int) {
+	p.Threadi.Lock()
+	if tn, ok := p.Threadi.Notes[t]; ok {
+		tn.Cleartid = va
+	}
+	p.Threadi.Unlock()
+}
+
+// calls f on the note of each thread of p while holding p's thread info lock.
+func (p *Proc_t) Thread_iter(f func(*tinfo.Tnote_t)) {
+	p.Threadi.Lock()
+	for _, tnote := range p.Threadi.Notes {
+		f(tnote)
+	}
+	p.Threadi.Unlock()
+}
+
 func (p *Proc_t) Thread_count() int {
 	p.Threadi.Lock()
 	ret := len(p.Threadi.Notes)
@@ -472,6 +836,7 @@ func (p *Proc_t) Thread_count() int {
 
 // terminate a single thread
 func (p *Proc_t) Thread_dead(tid defs.Tid_t, status int, usestatus bool) {
+	res.Cgrelease()
 	tinfo.ClearCurrent()
 	// XXX exit process if thread is thread0, even if other threads exist
 	p.Threadi.Lock()
@@ -489,11 +854,6 @@ func (p *Proc_t) Thread_dead(tid defs.Tid_t, status int, usestatus bool) {
 	}
 	p.Threadi.Unlock()
 
-	// update rusage user time
-	// XXX
-	utime := 42
-	p.Atime.Utadd(utime)
-
 	// put thread status in this process's wait info; threads don't have
 	// rusage for now.
 	p.Mywait.puttid(int(tid), status, nil)
@@ -609,25 +969,40 @@ func (p *Proc_t) terminate() {
 	}
 	p.Threadi.Unlock()
 
-	// close open fds
+	// release the process' record locks and then close the open fds
+	// unless another process shares them
 	p.Fdl.Lock()
-	for i := range p.Fds {
-		if p.Fds[i] == nil {
+	for _, f := range p.Fds {
+		if f == nil {
 			continue
 		}
-		fd.Close_panic(p.Fds[i])
+		if lf, ok := f.Fops.(fdops.Lockable_i); ok {
+			lf.Unlock_owner(p.Pid)
+		}
 	}
 	p.Fdl.Unlock()
-	fd.Close_panic(p.Cwd.Fd)
+	p.Fdtable_t.Release()
+	p.Cwd.Release()
+
+	// undo the SEM_UNDO semaphore operations
+	p.Threadi.Lock()
+	undo := p.semundo
+	p.semundo = nil
+	p.Threadi.Unlock()
+	for _, s := range undo {
+		s.Undo(p.Pid)
+	}
 
 	p.Mywait.Pid = 1
 
-	// free all user pages in the pmap. the last CPU to call Dec_pmap on
-	// the proc's pmap will free the pmap itself. freeing the user pages is
-	// safe since we know that all user threads are dead and thus no CPU
-	// will try to access user mappings. however, any CPU may access kernel
-	// mappings via this pmap.
-	p.Vm.Uvmfree()
+	// free all user pages in the pmap unless another process shares the
+	// address space. the last CPU to call Dec_pmap on the proc's pmap
+	// will free the pmap itself. freeing the user pages is safe since we
+	// know that all user threads are dead and thus no CPU will try to
+	// access user mappings. however, any CPU may access kernel mappings
+	// via this pmap.
+	p.Vm.Release()
+	p.Vfork_done()
 
 	// send status to parent
 	if p.Pwait == nil {
@@ -635,18 +1010,34 @@ func (p *Proc_t) terminate() {
 	}
 
 	// combine total child rusage with ours, send to parent
-	na := accnt.Accnt_t{Userns: p.Atime.Userns, Sysns: p.Atime.Sysns}
+	na := accnt.Accnt_t{Userns: p.Atime.Userns, Sysns: p.Atime.Sysns,
+		Classns: p.Atime.Classns}
 	// calling na.add() makes the compiler allocate na in the heap! escape
 	// analysis' fault?
 	//na.add(&p.Catime)
 	na.Userns += p.Catime.Userns
 	na.Sysns += p.Catime.Sysns
+	for i := range na.Classns {
+		na.Classns[i] += p.Catime.Classns[i]
+	}
+	na.Maxrss = p.Vm.Rss.Maxkb()
+	if p.Catime.Maxrss > na.Maxrss {
+		na.Maxrss = p.Catime.Maxrss
+	}
+
+	// the group's process limit must not count p once the parent reaped
+	// it
+	Proclock.Lock()
+	p._cgleave()
+	Proclock.Unlock()
 
 	// put process exit status to parent's wait info
 	p.Pwait.putpid(p.Pid, p.exitstatus, &na)
 	// remove pointer to parent to prevent deep fork trees from consuming
-	// unbounded memory.
+	// unbounded memory. Ancestor reads it with Proclock held.
+	Proclock.Lock()
 	p.Pwait = nil
+	Proclock.Unlock()
 	// OOM killer assumes a process has terminated once its pid is no
 	// longer in the pid table.
 	Proc_del(p.Pid)
@@ -673,14 +1064,146 @@ func Proc_check(pid int) (*Proc_t, bool) {
 	return p, ok
 }
 
+// returns the note of the thread id, or of the first thread of the process
+// id, and the thread's process.
+func Thread_find(id int) (*Proc_t, *tinfo.Tnote_t, bool) {
+	Proclock.Lock()
+	defer Proclock.Unlock()
+	if p, ok := Allprocs[id]; ok {
+		id = int(p.tid0)
+	}
+	for _, p := range Allprocs {
+		p.Threadi.Lock()
+		tnote, ok := p.Threadi.Notes[defs.Tid_t(id)]
+		p.Threadi.Unlock()
+		if ok {
+			return p, tnote, true
+		}
+	}
+	return nil, nil, false
+}
+
+// calls f on the address space of every process. f may lock the address
+// spaces since Proclock is not held while f runs.
+func Vm_iter(f func(*vm.Vm_t)) {
+	Proclock.Lock()
+	vms := make([]*vm.Vm_t, 0, len(Allprocs))
+	// processes may share an address space
+	seen := make(map[*vm.Vm_t]bool, len(Allprocs))
+	for _, p := range Allprocs {
+		if !seen[p.Vm] {
+			seen[p.Vm] = true
+			vms = append(vms, p.Vm)
+		}
+	}
+	Proclock.Unlock()
+	for _, as := range vms {
+		f(as)
+	}
+}
+
 func Proc_del(pid int) {
 	Proclock.Lock()
-	_, ok := Allprocs[pid]
+	p, ok := Allprocs[pid]
 	if !ok {
 		panic("bad pid")
 	}
 	delete(Allprocs, pid)
+	p._cgleave()
+	Proclock.Unlock()
+}
+
+func (p *Proc_t) Oom_adj() int {
+	Proclock.Lock()
+	ret := p.oomadj
+	Proclock.Unlock()
+	return ret
+}
+
+// gives p the oom_score_adj of its parent and the same lower bound
+func (p *Proc_t) Oom_inherit(parent *Proc_t) {
+	Proclock.Lock()
+	p.oomadj = parent.oomadj
+	p.oomadjmin = parent.oomadjmin
+	Proclock.Unlock()
+}
+
+// sets the oom_score_adj of p to adj on behalf of the process by, which must
+// be p or an ancestor of p. a process may lower its own value, though not
+// below the lowest value of its parent, but other processes may only raise
+// it, since lowering the value protects p from the OOM killer at the expense
+// of the other processes.
+func (p *Proc_t) Oom_change(by *Proc_t, adj int) defs.Err_t {
+	if adj < defs.OOM_ADJ_MIN || adj > defs.OOM_ADJ_MAX {
+		return -defs.EINVAL
+	}
+	if by != p && !by.Ancestor(p) {
+		return -defs.EPERM
+	}
+	Proclock.Lock()
+	defer Proclock.Unlock()
+	if adj < p.oomadj && (by != p || adj < p.oomadjmin) {
+		return -defs.EPERM
+	}
+	p.oomadj = adj
+	return 0
+}
+
+// returns true if p is the parent of c or one of the parent's ancestors
+func (p *Proc_t) Ancestor(c *Proc_t) bool {
+	Proclock.Lock()
+	defer Proclock.Unlock()
+	for c.Pwait != nil {
+		if c.Pwait.Pid == p.Pid {
+			return true
+		}
+		var ok bool
+		c, ok = Allprocs[c.Pwait.Pid]
+		if !ok {
+			return false
+		}
+	}
+	return false
+}
+
+// uncharges the process from its resource group. Proclock must be held.
+func (p *Proc_t) _cgleave() {
+	p.Cg.Uncharge(cgroup.PROCS, 1)
+	p.Cg = nil
+}
+
+func (p *Proc_t) Cgroup() *cgroup.Cgroup_t {
+	Proclock.Lock()
+	ret := p.Cg
 	Proclock.Unlock()
+	return ret
+}
+
+// moves the process, its threads, and its charges to the resource group cg.
+// the move succeeds even if the process exceeds cg's limits; the following
+// allocations then reclaim or kill within cg.
+func (p *Proc_t) Cgroup_join(cg *cgroup.Cgroup_t) defs.Err_t {
+	Proclock.Lock()
+	p.Threadi.Lock()
+	ocg := p.Cg
+	err := cg.Enter(ocg)
+	if err == 0 {
+		p.Cg = cg
+		for _, tnote := range p.Threadi.Notes {
+			tnote.Lock()
+			tnote.Cg = cg
+			tnote.Unlock()
+		}
+	}
+	p.Threadi.Unlock()
+	Proclock.Unlock()
+	if err != 0 {
+		return err
+	}
+	p.Vm.Lock_pmap()
+	p.Vm.Rss.Setcg(cg)
+	p.Vm.Unlock_pmap()
+	return 0
 }
 
 var _deflimits = Ulimit_t{
@@ -690,19 +1213,30 @@ var _deflimits = Ulimit_t{
 	//nofile: 512,
 	Nofile: defs.RLIM_INFINITY,
 	//Novma:  (1 << 8),
-	Novma:  defs.RLIM_INFINITY,
-	Noproc: (1 << 10),
+	Novma:      defs.RLIM_INFINITY,
+	Noproc:     (1 << 10),
+	Memlock:    8 << 20,
+	Memlockmax: 8 << 20,
+	Rtprio:     0,
+	Rtpriomax:  defs.SCHED_PRIOMAX,
 }
 
 // returns the new proc and success; can fail if the system-wide limit of
-// procs/threads has been reached. the parent's fdtable must be locked.
-func Proc_new(name ustr.Ustr, cwd *fd.Cwd_t, fds []*fd.Fd_t, sys Syscall_i) (*Proc_t, bool) {
+// procs/threads or the process limit of the resource group cg has been
+// reached. the new proc takes the caller's references to cwd and fdt only if
+// it succeeds.
+func Proc_new(name ustr.Ustr, cwd *fd.Cwd_t, fdt *Fdtable_t, sys Syscall_i,
+	cg *cgroup.Cgroup_t) (*Proc_t, bool) {
 	Proclock.Lock()
 
 	if nthreads >= int64(limits.Syslimit.Sysprocs) {
 		Proclock.Unlock()
 		return nil, false
 	}
+	if !cg.Charge(cgroup.PROCS, 1) {
+		Proclock.Unlock()
+		return nil, false
+	}
 
 	nthreads++
 
@@ -713,30 +1247,15 @@ func Proc_new(name ustr.Ustr, cwd *fd.Cwd_t, fds []*fd.Fd_t, sys Syscall_i) (*Pr
 	if _, ok := Allprocs[np]; ok {
 		panic("pid exists")
 	}
-	ret := &Proc_t{}
+	ret := &Proc_t{Cg: cg}
+	ret.Vm = vm.Mkvm(cg)
 	Allprocs[np] = ret
 	Proclock.Unlock()
 
 	ret.Name = name
 	ret.Pid = np
-	ret.Fds = make([]*fd.Fd_t, len(fds))
-	ret.fdstart = 3
-	for i := range fds {
-		if fds[i] == nil {
-			continue
-		}
-		tfd, err := fd.Copyfd(fds[i])
-		// copying an fd may fail if another thread closes the fd out
-		// from under us
-		if err == 0 {
-			ret.Fds[i] = tfd
-		}
-		ret.nfds++
-	}
+	ret.Fdtable_t = fdt
 	ret.Cwd = cwd
-	if ret.Cwd.Fd.Fops.Reopen() != 0 {
-		panic("must succeed")
-	}
 	ret.Mmapi = mem.USERMIN
 	ret.Ulim = _deflimits
 
@@ -745,6 +1264,7 @@ func Proc_new(name ustr.Ustr, cwd *fd.Cwd_t, fds []*fd.Fd_t, sys Syscall_i) (*Pr
 	ret._thread_new(tid0)
 
 	ret.Mywait.Wait_init(ret.Pid)
+	ret.Sigs.Sig_init()
 	if !ret.Start_thread(ret.tid0) {
 		panic("silly noproc")
 	}
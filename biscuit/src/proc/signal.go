@@ -0,0 +1,140 @@
+package proc
+
+import "sync"
+
+import "defs"
+import "fdops"
+
+// processes cannot catch signals yet. a signal which a signalfd of the process
+// reads stays pending until it is read; like a blocked signal, a pending
+// signal is not queued again. other signals take their default disposition.
+type Sigpend_t struct {
+	sync.Mutex
+	// broadcast when a signal becomes pending
+	cond *sync.Cond
+	// bit sig-1 is set when sig is pending
+	set uint64
+	// the process which sent each pending signal
+	from [defs.NSIG]int
+	// the number of signalfds which read each signal
+	watch   [defs.NSIG]int
+	pollers fdops.Pollers_t
+}
+
+// the signals which are ignored by default
+const _sigign = 1<<(defs.SIGCHLD-1) | 1<<(defs.SIGIO-1) |
+	1<<(defs.SIGWINCH-1)
+
+func (sp *Sigpend_t) Sig_init() {
+	sp.cond = sync.NewCond(sp)
+}
+
+// adds n to the number of signalfds which read each signal in mask
+func (sp *Sigpend_t) Watch(mask uint64, n int) {
+	sp.Lock()
+	for i := range sp.watch {
+		if mask&(1<<uint(i)) != 0 {
+			sp.watch[i] += n
+		}
+	}
+	sp.Unlock()
+}
+
+// makes sig pending and returns true if a signalfd reads sig. otherwise the
+// caller applies the default disposition of sig.
+func (sp *Sigpend_t) Post(sig, from int) bool {
+	if sig < 1 || sig > defs.NSIG {
+		panic("bad sig")
+	}
+	sp.Lock()
+	defer sp.Unlock()
+	if sp.watch[sig-1] == 0 {
+		return false
+	}
+	sp.set |= 1 << uint(sig-1)
+	sp.from[sig-1] = from
+	sp.cond.Broadcast()
+	sp.pollers.Wakeready(fdops.R_READ)
+	return true
+}
+
+// applies the default disposition of sig, which no signalfd of p reads.
+// stopping a process is not supported, and the exit status cannot report
+// the signals above 31.
+func (p *Proc_t) Sigdefault(sig int) defs.Err_t {
+	bit := uint64(1) << uint(sig-1)
+	switch {
+	case _sigign&bit != 0:
+		return 0
+	case sig == defs.SIGSTOP:
+		return -defs.ENOSYS
+	case sig > 31:
+		return -defs.EINVAL
+	}
+	p.Kill(sig)
+	return 0
+}
+
+// terminates p as if by sig; the parent collects a status which reports sig
+// unless a thread of p exits first.
+func (p *Proc_t) Kill(sig int) {
+	p.Threadi.Lock()
+	p.exitstatus = defs.SIGNALED | defs.Mkexitsig(sig)
+	p.Threadi.Unlock()
+	p.Doomall()
+}
+
+// returns true if p may send signals to t: t is p or a descendant of p, or
+// t is p's parent or one of its descendants, like the jobs of a shell.
+func (p *Proc_t) Maysignal(t *Proc_t) bool {
+	if t == p || p.Ancestor(t) {
+		return true
+	}
+	Proclock.Lock()
+	var par *Proc_t
+	if p.Pwait != nil {
+		par = Allprocs[p.Pwait.Pid]
+	}
+	Proclock.Unlock()
+	return par != nil && (par == t || par.Ancestor(t))
+}
+
+// removes and returns the lowest pending signal in mask and its sender. waits
+// for one unless nowait is true.
+func (sp *Sigpend_t) Take(mask uint64, nowait bool) (int, int, defs.Err_t) {
+	sp.Lock()
+	defer sp.Unlock()
+	for sp.set&mask == 0 {
+		if nowait {
+			return 0, 0, -defs.EAGAIN
+		}
+		if err := KillableWait(sp.cond); err != 0 {
+			return 0, 0, err
+		}
+	}
+	pend := sp.set & mask
+	sig := 1
+	for pend&1 == 0 {
+		pend >>= 1
+		sig++
+	}
+	sp.set &^= 1 << uint(sig-1)
+	return sig, sp.from[sig-1], 0
+}
+
+// a signalfd with mask is readable while a signal in mask is pending
+func (sp *Sigpend_t) Pollone(mask uint64,
+	pm fdops.Pollmsg_t) (fdops.Ready_t, defs.Err_t) {
+	sp.Lock()
+	defer sp.Unlock()
+	if pm.Events&fdops.R_READ == 0 {
+		return 0, 0
+	}
+	if sp.set&mask != 0 {
+		return fdops.R_READ, 0
+	}
+	if !pm.Dowait {
+		return 0, 0
+	}
+	return 0, sp.pollers.Addpoller(&pm)
+}
@@ -148,6 +148,12 @@ func (w *Wait_t) _put(id, status int, isproc bool, atime *accnt.Accnt_t) {
 	if atime != nil {
 		wn.wst.Atime.Userns += atime.Userns
 		wn.wst.Atime.Sysns += atime.Sysns
+		for i := range atime.Classns {
+			wn.wst.Atime.Classns[i] += atime.Classns[i]
+		}
+		if atime.Maxrss > wn.wst.Atime.Maxrss {
+			wn.wst.Atime.Maxrss = atime.Maxrss
+		}
 	}
 	w.cond.Broadcast()
 }
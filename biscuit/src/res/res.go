@@ -4,6 +4,7 @@ import "fmt"
 import "runtime"
 
 import "caller"
+import "cgroup"
 import "oommsg"
 import "tinfo"
 
@@ -76,6 +77,23 @@ func Resend() {
 	//	return
 	//}
 	runtime.Gresrelease()
+	Cgrelease()
+}
+
+// uncharges the current thread's reservations from its resource group
+func Cgrelease() {
+	t, ok := tinfo.Currentok()
+	if !ok {
+		return
+	}
+	t.Lock()
+	cg, n := t.Cgres, t.Cgheap
+	t.Cgres = nil
+	t.Cgheap = 0
+	t.Unlock()
+	if cg != nil {
+		cg.Uncharge(cgroup.HEAP, n)
+	}
 }
 
 func Human(_bytes int) string {
@@ -98,6 +116,9 @@ func _reswait(want *Res_t, incremental, block bool) bool {
 	//if !Lims {
 	//	return true
 	//}
+	if !_cgreserve(want, block) {
+		return false
+	}
 	f := runtime.Greserve
 	for !f(want) {
 		//if time.Since(lastp) > time.Second {
@@ -114,18 +135,70 @@ func _reswait(want *Res_t, incremental, block bool) bool {
 		//fmt.Printf("%v: Wait for memory hog to die...\n", p.Name)
 		var omsg oommsg.Oommsg_t
 		omsg.Need = 2 << 20
-		omsg.Resume = make(chan bool, 1)
-		select {
-		case oommsg.OomCh <- omsg:
-		case <-tinfo.Current().Killnaps.Killch:
+		if !_oomwait(omsg) {
+			return false
+		}
+	}
+	return true
+}
+
+// sends omsg to the OOM killer and waits for its answer. returns false if this
+// process has been killed or the OOM killer gave up.
+func _oomwait(omsg oommsg.Oommsg_t) bool {
+	omsg.Resume = make(chan bool, 1)
+	select {
+	case oommsg.OomCh <- omsg:
+	case <-tinfo.Current().Killnaps.Killch:
+		return false
+	}
+	select {
+	case ok := <-omsg.Resume:
+		return ok
+	case <-tinfo.Current().Killnaps.Killch:
+		return false
+	}
+}
+
+// asks the OOM killer to kill a process of the group cg, which has no room
+// for n more of k. returns false if this process has been killed or cg has no
+// process which can be killed.
+func Oomgroup(cg *cgroup.Cgroup_t, k cgroup.Kind_t, n int) bool {
+	return _oomwait(oommsg.Oommsg_t{Need: n, Cg: cg, Kind: k})
+}
+
+// charges the reservation to the resource group of the current thread. if the
+// group's share of the kernel heap is used up, a process of the group is
+// killed to make room.
+func _cgreserve(want *Res_t, block bool) bool {
+	t, ok := tinfo.Currentok()
+	if !ok {
+		return true
+	}
+	// another thread may move the process to another group meanwhile;
+	// the reservations until the next Resend stay charged to this one
+	t.Lock()
+	if t.Cgres == nil {
+		t.Cgres = t.Cg
+	}
+	cg := t.Cgres
+	t.Unlock()
+	if cg == nil {
+		return true
+	}
+	n := int(want.Objs[1])
+	for !cg.Charge(cgroup.HEAP, n) {
+		if t.Doomed() || !block {
 			return false
 		}
-		select {
-		case <-omsg.Resume:
-		case <-tinfo.Current().Killnaps.Killch:
+		// another thread may have freed some of the share meanwhile
+		over := cg.Over(cgroup.HEAP, n)
+		if over != nil && !Oomgroup(over, cgroup.HEAP, n) {
 			return false
 		}
 	}
+	t.Lock()
+	t.Cgheap += n
+	t.Unlock()
 	return true
 }
 
@@ -2,6 +2,8 @@ package stat
 
 import "unsafe"
 
+import "util"
+
 type Stat_t struct {
 	_dev    uint
 	_ino    uint
@@ -55,3 +57,29 @@ func (st *Stat_t) Bytes() []uint8 {
 	sl := (*[sz]uint8)(unsafe.Pointer(&st._dev))
 	return sl[:]
 }
+
+// the size of struct stat on Linux x86-64
+const Linuxsz = 144
+
+// returns the stat in the layout of struct stat on Linux x86-64. mode and rdev
+// are given in the Linux encoding.
+func (st *Stat_t) Linux(mode, rdev uint) []uint8 {
+	ret := make([]uint8, Linuxsz)
+	util.Writen(ret, 8, 0, int(st._dev))
+	util.Writen(ret, 8, 8, int(st._ino))
+	// there is no link count; report one link
+	util.Writen(ret, 8, 16, 1)
+	util.Writen(ret, 4, 24, int(mode))
+	util.Writen(ret, 4, 28, int(st._uid))
+	util.Writen(ret, 8, 40, int(rdev))
+	util.Writen(ret, 8, 48, int(st._size))
+	util.Writen(ret, 8, 56, 4096)
+	util.Writen(ret, 8, 64, int(st._blocks))
+	// only the modification time is recorded, which is reported as the
+	// access and change times too
+	for _, off := range []int{72, 88, 104} {
+		util.Writen(ret, 8, off, int(st._m_sec))
+		util.Writen(ret, 8, off+8, int(st._m_nsec))
+	}
+	return ret
+}
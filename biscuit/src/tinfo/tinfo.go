@@ -4,6 +4,7 @@ import "runtime"
 import "sync"
 import "unsafe"
 
+import "cgroup"
 import "defs"
 
 type Tnote_t struct {
@@ -12,19 +13,94 @@ type Tnote_t struct {
 	Alive    bool
 	Killed   bool
 	Isdoomed bool // XXX maybe don't need doomed, but can use killed?
-	// protects killed, Killnaps.Cond and Kerr, and is a leaf lock
+	// protects killed, Killnaps.Cond, Kerr, Cg, Cgres and Cgheap, and is a
+	// leaf lock
 	sync.Mutex
 	Killnaps struct {
 		Killch chan bool
 		Cond   *sync.Cond
 		Kerr   defs.Err_t
 	}
+	// the resource group of the thread's process, which is written while
+	// the process' thread info lock is held too. Cgres is the group which
+	// the kernel heap reservations since the last Resend, Cgheap bytes,
+	// were charged to.
+	Cg     *cgroup.Cgroup_t
+	Cgres  *cgroup.Cgroup_t
+	Cgheap int
+	// the user address which is zeroed and futex-woken when a thread of
+	// the Linux ABI exits, see set_tid_address(2). only accessed by the
+	// thread itself, or by its creator before it runs.
+	Cleartid int
+	// the scheduling parameters of the thread, protected by the note's
+	// lock. Schedmod is set when they change; the thread applies them to
+	// its goroutine before it next returns to user mode.
+	Sched    Sched_t
+	Schedmod bool
+}
+
+// the scheduling parameters of a user thread
+type Sched_t struct {
+	// defs.SCHED_OTHER or defs.SCHED_FIFO
+	Policy int
+	Nice   int
+	Rtprio int
+	// the CPUs on which the thread may run; 0 allows all of them
+	Mask uint64
 }
 
 func (t *Tnote_t) Doomed() bool {
 	return t.Isdoomed
 }
 
+func (t *Tnote_t) Sched_nice(nice int) {
+	t.Lock()
+	t.Sched.Nice = nice
+	t.Schedmod = true
+	t.Unlock()
+}
+
+func (t *Tnote_t) Sched_policy(policy, rtprio int) {
+	t.Lock()
+	t.Sched.Policy = policy
+	t.Sched.Rtprio = rtprio
+	t.Schedmod = true
+	t.Unlock()
+}
+
+func (t *Tnote_t) Sched_mask(mask uint64) {
+	t.Lock()
+	t.Sched.Mask = mask
+	t.Schedmod = true
+	t.Unlock()
+}
+
+func (t *Tnote_t) Sched_get() Sched_t {
+	t.Lock()
+	ret := t.Sched
+	t.Unlock()
+	return ret
+}
+
+// applies the scheduling parameters of the thread to the calling goroutine,
+// which must be the thread's, if they changed since they were last applied.
+// returns the scheduling policy and true if they did.
+func (t *Tnote_t) Sched_apply() (int, bool) {
+	t.Lock()
+	s, mod := t.Sched, t.Schedmod
+	t.Schedmod = false
+	t.Unlock()
+	if !mod {
+		return 0, false
+	}
+	prio := s.Nice
+	if s.Policy == defs.SCHED_FIFO {
+		prio = s.Rtprio
+	}
+	runtime.Setsched(s.Policy, prio, s.Mask)
+	return s.Policy, true
+}
+
 type Threadinfo_t struct {
 	Notes map[defs.Tid_t]*Tnote_t
 	sync.Mutex
@@ -43,6 +119,15 @@ func Current() *Tnote_t {
 	return ret
 }
 
+// like Current, but returns false if the goroutine is not a user thread
+func Currentok() (*Tnote_t, bool) {
+	_p := runtime.Gptr()
+	if _p == nil {
+		return nil, false
+	}
+	return (*Tnote_t)(_p), true
+}
+
 func SetCurrent(p *Tnote_t) {
 	if p == nil {
 		panic("nuts")
@@ -109,6 +109,10 @@ func (bm *blockmem_t) Free(pa mem.Pa_t) {
 func (bm *blockmem_t) Refup(pa mem.Pa_t) {
 }
 
+func (bm *blockmem_t) Mlocked(pa mem.Pa_t) bool {
+	return false
+}
+
 type console_t struct {
 }
 
@@ -6,6 +6,7 @@ import "sync/atomic"
 import "time"
 
 import "bounds"
+import "cgroup"
 import "defs"
 import "fdops"
 import "mem"
@@ -14,7 +15,7 @@ import "ustr"
 import "util"
 
 type Vm_t struct {
-	// lock for vmregion, pmpages, pmap, and p_pmap
+	// lock for vmregion, pmpages, pmap, p_pmap, and refs
 	sync.Mutex
 
 	Vmregion Vmregion_t
@@ -23,6 +24,18 @@ type Vm_t struct {
 	Pmap   *mem.Pmap_t
 	P_pmap mem.Pa_t
 
+	// the address space was freed; the page-out daemon must skip it
+	freed bool
+
+	// mlockall(MCL_FUTURE) locks the mappings created later
+	Lockfuture bool
+
+	// the number of processes using the address space, which is more
+	// than one after clone(CLONE_VM)
+	refs int
+
+	Rss Rss_t
+
 	pgfltaken bool
 }
 
@@ -52,10 +65,15 @@ func (as *Vm_t) Userdmap8_inner(va int, k2u bool) ([]uint8, defs.Err_t) {
 	voff := va & int(PGOFFSET)
 	uva := uintptr(va)
 	vmi, ok := as.Vmregion.Lookup(uva)
-	if !ok {
+	if !ok || vmi.Perms == 0 {
 		return nil, -defs.EFAULT
 	}
-	pte, ok := vmi.Ptefor(as.Pmap, uva)
+	if pde := _hugepde(as.Pmap, va); pde != nil &&
+		(!k2u || *pde&PTE_COW == 0) {
+		hoff := mem.Pa_t(va & (mem.HUGESIZE - 1))
+		return mem.Physmem.Dmap8(*pde&PTE_ADDR + hoff), 0
+	}
+	pte, ok := as.Ptefor(vmi, uva)
 	if !ok {
 		return nil, -defs.ENOMEM
 	}
@@ -308,6 +326,266 @@ func (as *Vm_t) Tlbshoot(startva uintptr, pgcount int) {
 	tlb_shootdown(uintptr(as.P_pmap), startva, pgcount)
 }
 
+// returns the PTE for a resident page after its mapping's permissions change
+// to perms.
+func _protpte(pte, perms mem.Pa_t, shared bool) mem.Pa_t {
+	if pte&PTE_PROTNONE != 0 {
+		pte = (pte &^ PTE_PROTNONE) | PTE_U
+	}
+	switch {
+	case perms&PTE_W == 0:
+		// a private page stays copy-on-write so that the page fault
+		// handler reclaims it if the mapping becomes writable again
+		if pte&PTE_W != 0 {
+			pte &^= PTE_W | PTE_WASCOW
+			if !shared {
+				pte |= PTE_COW
+			}
+		}
+	case shared:
+		pte |= PTE_W | PTE_D
+	default:
+		// the page may have been mapped while the mapping was
+		// read-only
+		if pte&(PTE_W|PTE_COW) == 0 {
+			pte |= PTE_COW
+		}
+	}
+	if perms == 0 {
+		pte = (pte &^ PTE_U) | PTE_PROTNONE
+	}
+	return pte
+}
+
+// changes the permissions of [start, start+len) to perms, which are like the
+// perms of _mkvmi, and updates the PTEs of resident pages accordingly. the
+// caller must make sure that the range is mapped.
+func (as *Vm_t) Mprotect(start, len int, perms mem.Pa_t, novma uint) defs.Err_t {
+	as.Lockassert_pmap()
+	len = util.Roundup(len, mem.PGSIZE)
+	if !as._unhugeends(start, len) {
+		return -defs.ENOMEM
+	}
+	if err := as.Vmregion.Setperms(start, len, uint(perms), novma); err != 0 {
+		return err
+	}
+	for va := start; va < start+len; va += mem.PGSIZE {
+		vmi, ok := as.Vmregion.Lookup(uintptr(va))
+		if !ok {
+			panic("must be mapped")
+		}
+		shared := vmi.Mtype == VSANON ||
+			(vmi.Mtype == VFILE && vmi.file.shared)
+		if pde := _hugepde(as.Pmap, va); pde != nil {
+			*pde = _protpte(*pde, perms, shared)
+			va += mem.HUGESIZE - mem.PGSIZE
+			continue
+		}
+		pte := Pmap_lookup(as.Pmap, va)
+		if pte == nil || *pte&PTE_P == 0 {
+			continue
+		}
+		*pte = _protpte(*pte, perms, shared)
+	}
+	as.Tlbshoot(uintptr(start), len>>PGSHIFT)
+	return 0
+}
+
+// eagerly maps fresh, zeroed pages at [start, start+len), which must be mapped
+// by one mapping without any pages yet, with the PTE permissions perms. if
+// memory runs out, it removes the pages it mapped and returns ENOMEM.
+func (as *Vm_t) Populate(start, len int, perms mem.Pa_t) defs.Err_t {
+	as.Lockassert_pmap()
+	vmi, ok := as.Vmregion.Lookup(uintptr(start))
+	if !ok {
+		panic("must be mapped")
+	}
+	perms |= vmi._nx()
+	for i := 0; i < len; i += mem.PGSIZE {
+		va := start + i
+		if va%mem.HUGESIZE == 0 && i+mem.HUGESIZE <= len &&
+			vmi._hugeok(uintptr(va)) && as._hugeinsert(va, perms) {
+			i += mem.HUGESIZE - mem.PGSIZE
+			continue
+		}
+		_, p_pg, ok := mem.Physmem.Refpg_new()
+		if ok {
+			_, ok = as.Page_insert(start+i, p_pg, perms, true, nil)
+			if !ok {
+				mem.Physmem.Refdown(p_pg)
+			}
+		}
+		if !ok {
+			for j := 0; j < i; j += mem.PGSIZE {
+				if as._hugeremove(start + j) {
+					j += mem.HUGESIZE - mem.PGSIZE
+					continue
+				}
+				as.Page_remove(start + j)
+			}
+			return -defs.ENOMEM
+		}
+	}
+	return 0
+}
+
+// unmaps [start, start+len), which need not be entirely mapped, and frees the
+// pages. returns ENOMEM, having unmapped nothing, if a mapping must be split
+// but there are already novma mappings.
+func (as *Vm_t) Unmap(start, len int, novma uint) defs.Err_t {
+	as.Lockassert_pmap()
+	len = util.Roundup(len, mem.PGSIZE)
+	m := &as.Vmregion
+	if m.Unmapsplits(start, len) != 0 && m.Novma >= novma {
+		return -defs.ENOMEM
+	}
+	if !as._unhugeends(start, len) {
+		return -defs.ENOMEM
+	}
+	pgn := uintptr(start) >> PGSHIFT
+	pgend := pgn + uintptr(len>>PGSHIFT)
+	for n := m._firstin(pgn, pgend); n != nil; n = m._firstin(pgn, pgend) {
+		s := n.vmi.Pgn
+		if s < pgn {
+			s = pgn
+		}
+		e := n.vmi.Pgn + uintptr(n.vmi.Pglen)
+		if e > pgend {
+			e = pgend
+		}
+		if n.vmi.locked {
+			as._munlockpgs(int(s<<PGSHIFT), int(e<<PGSHIFT))
+		}
+		// the pages are accounted to the mapping, thus they are
+		// removed first
+		for i := s; i < e; i++ {
+			if as._hugeremove(int(i << PGSHIFT)) {
+				i += uintptr(mem.HUGEPGS - 1)
+				continue
+			}
+			as.Page_remove(int(i << PGSHIFT))
+		}
+		if m.Remove(int(s<<PGSHIFT), int(e-s)<<PGSHIFT, novma) != 0 {
+			panic("split was checked")
+		}
+		pgn = e
+	}
+	as.Tlbshoot(uintptr(start), len>>PGSHIFT)
+	return 0
+}
+
+// resizes [old, old+oldlen), which must be within a single mapping, to newlen
+// bytes and returns its new address. the mapping grows in place if the pages
+// after it are unused. otherwise, if maymove is true, the mapping moves to
+// unused address space at or above hint; the page table entries move with it
+// so that no page is copied or faulted in again.
+func (as *Vm_t) Mremap(old, oldlen, newlen int, maymove bool, hint int,
+	novma uint) (int, defs.Err_t) {
+	as.Lockassert_pmap()
+	oldlen = util.Roundup(oldlen, mem.PGSIZE)
+	newlen = util.Roundup(newlen, mem.PGSIZE)
+	vmi, ok := as.Vmregion.Lookup(uintptr(old))
+	if !ok {
+		return 0, -defs.EFAULT
+	}
+	vend := int(vmi.Pgn+uintptr(vmi.Pglen)) << PGSHIFT
+	if old+oldlen > vend {
+		return 0, -defs.EFAULT
+	}
+	if newlen <= oldlen {
+		if newlen < oldlen {
+			err := as.Unmap(old+newlen, oldlen-newlen, novma)
+			if err != 0 {
+				return 0, err
+			}
+		}
+		return old, 0
+	}
+	pteperms := mem.Pa_t(vmi.Perms)
+	if pteperms == 0 {
+		pteperms = PTE_PROTNONE
+	}
+	mtype := vmi.Mtype
+	grow := newlen - oldlen
+	if old+oldlen == vend && vend+grow <= mem.USERMAX &&
+		!as.Vmregion.Overlaps(vend, grow) {
+		as.Vmregion.grow(uintptr(vend)>>PGSHIFT, grow>>PGSHIFT)
+		// shared anonymous pages must always be mapped
+		if mtype == VSANON {
+			if err := as.Populate(vend, grow, pteperms); err != 0 {
+				as.Vmregion.Remove(vend, grow, novma)
+				return 0, err
+			}
+		}
+		return old, 0
+	}
+	if !maymove {
+		return 0, -defs.ENOMEM
+	}
+	if as.Vmregion.Novma+as.Vmregion.Unmapsplits(old, oldlen)+1 > novma {
+		return 0, -defs.ENOMEM
+	}
+	// the page table entries move one by one
+	for va := old &^ (mem.HUGESIZE - 1); va < old+oldlen; va += mem.HUGESIZE {
+		if !as._unhuge(va) {
+			return 0, -defs.ENOMEM
+		}
+	}
+
+	nva := as.Unusedva_inner(hint, newlen)
+	nvmi := &Vminfo_t{}
+	*nvmi = *vmi
+	nvmi.Pgn = uintptr(nva) >> PGSHIFT
+	nvmi.Pglen = newlen >> PGSHIFT
+	nvmi.pch = nil
+	if mtype == VFILE {
+		nvmi.file.foff += old - int(vmi.Pgn<<PGSHIFT)
+		nmf := &Mfile_t{}
+		*nmf = *vmi.file.mfile
+		nmf.mapcount = nvmi.Pglen
+		nvmi.file.mfile = nmf
+	}
+	// vmi may be merged away by the insert
+	vmi = nil
+	as.Vmregion.insert(nvmi)
+	if mtype == VSANON {
+		err := as.Populate(nva+oldlen, grow, pteperms)
+		if err != 0 {
+			as.Vmregion.Remove(nva, newlen, novma)
+			return 0, err
+		}
+	}
+	for i := 0; i < oldlen; i += mem.PGSIZE {
+		opte := Pmap_lookup(as.Pmap, old+i)
+		if opte == nil || *opte == 0 {
+			continue
+		}
+		npte, err := pmap_walk(as.Pmap, nva+i, PTE_U|PTE_W)
+		if err != 0 {
+			// put back the entries moved so far
+			for j := 0; j < i; j += mem.PGSIZE {
+				npte := Pmap_lookup(as.Pmap, nva+j)
+				if npte != nil && *npte != 0 {
+					*Pmap_lookup(as.Pmap, old+j) = *npte
+					*npte = 0
+				}
+			}
+			for j := oldlen; j < newlen; j += mem.PGSIZE {
+				as.Page_remove(nva + j)
+			}
+			as.Vmregion.Remove(nva, newlen, novma)
+			return 0, err
+		}
+		*npte = *opte
+		*opte = 0
+	}
+	if as.Vmregion.Remove(old, oldlen, novma) != 0 {
+		panic("split was checked")
+	}
+	as.Tlbshoot(uintptr(old), oldlen>>PGSHIFT)
+	return nva, 0
+}
+
 // returns true if the fault was handled successfully
 func Sys_pgfault(as *Vm_t, vmi *Vminfo_t, faultaddr, ecode uintptr) defs.Err_t {
 	isguard := vmi.Perms == 0
@@ -322,11 +600,15 @@ func Sys_pgfault(as *Vm_t, vmi *Vminfo_t, faultaddr, ecode uintptr) defs.Err_t {
 		// runtime.trap(), but just in case
 		panic("kernel page fault")
 	}
-	if vmi.Mtype == VSANON {
-		panic("shared anon pages should always be mapped")
+	if as._hugefault(vmi, faultaddr, iswrite) {
+		return 0
+	}
+	// only Pgfault may wait for the userfaultfd
+	if as._uffdmissing(vmi, faultaddr) {
+		return -defs.EFAULT
 	}
 
-	pte, ok := vmi.Ptefor(as.Pmap, faultaddr)
+	pte, ok := as.Ptefor(vmi, faultaddr)
 	if !ok {
 		return -defs.ENOMEM
 	}
@@ -335,10 +617,16 @@ func Sys_pgfault(as *Vm_t, vmi *Vminfo_t, faultaddr, ecode uintptr) defs.Err_t {
 		// two threads simultaneously faulted on same page
 		return 0
 	}
+	if _isswap(*pte) {
+		return as._pgswapin(vmi, pte, faultaddr)
+	}
+	if vmi.Mtype == VSANON {
+		panic("shared anon pages should always be mapped")
+	}
 
 	var p_pg mem.Pa_t
 	isblockpage := false
-	perms := PTE_U | PTE_P
+	perms := PTE_U | PTE_P | vmi._nx()
 	isempty := true
 
 	// shared file mappings are handled the same way regardless of whether
@@ -441,12 +729,18 @@ func Sys_pgfault(as *Vm_t, vmi *Vminfo_t, faultaddr, ecode uintptr) defs.Err_t {
 		tshoot, ok = as.Page_insert(int(faultaddr), p_pg, perms, isempty, pte)
 	}
 	if !ok {
+		if isblockpage && vmi.file.shared {
+			vmi.file.mfile.pcache.Unpin(p_pg)
+		}
 		mem.Physmem.Refdown(p_pg)
 		return -defs.ENOMEM
 	}
 	if tshoot {
 		as.Tlbshoot(faultaddr, 1)
 	}
+	if vmi.Mtype == VFILE && vmi.ra == RA_SEQ {
+		as._readahead(vmi, faultaddr)
+	}
 	return 0
 }
 
@@ -487,11 +781,14 @@ func (as *Vm_t) _page_insert(va int, p_pg mem.Pa_t, perms mem.Pa_t,
 		if vempty {
 			panic("pte not empty")
 		}
-		if *pte&PTE_U == 0 {
+		if *pte&(PTE_U|PTE_PROTNONE) == 0 {
 			panic("replacing kernel page")
 		}
 		ninval = true
 		p_old = mem.Pa_t(*pte & PTE_ADDR)
+	} else if !as.Rss._tryadd(as._mtype(va), 1) {
+		// the resource group is out of pages
+		return false, false
 	}
 	*pte = p_pg | perms | PTE_P
 	if ninval {
@@ -505,31 +802,128 @@ func (as *Vm_t) Page_remove(va int) bool {
 	remmed := false
 	pte := Pmap_lookup(as.Pmap, va)
 	if pte != nil && *pte&PTE_P != 0 {
-		if *pte&PTE_U == 0 {
+		if *pte&(PTE_U|PTE_PROTNONE) == 0 {
 			panic("removing kernel page")
 		}
 		p_old := mem.Pa_t(*pte & PTE_ADDR)
 		mem.Physmem.Refdown(p_old)
 		*pte = 0
+		as.Rss._add(as._mtype(va), -1)
 		remmed = true
+	} else if pte != nil && _isswap(*pte) {
+		_slotdrop(_swapslot(*pte))
+		*pte = 0
+		as.Rss.Swap--
 	}
 	return remmed
 }
 
 // returns true if the pagefault was handled successfully
 func (as *Vm_t) Pgfault(tid defs.Tid_t, fa, ecode uintptr) defs.Err_t {
-	as.Lock_pmap()
-	vmi, ok := as.Vmregion.Lookup(fa)
-	if !ok {
+	for try := 0; ; try++ {
+		as.Lock_pmap()
+		vmi, ok := as.Vmregion.Lookup(fa)
+		if !ok {
+			as.Unlock_pmap()
+			return -defs.EFAULT
+		}
+		if f := as._uffdfault(vmi, fa, ecode, tid); f != nil {
+			as.Unlock_pmap()
+			if err := f._wait(); err != 0 {
+				return err
+			}
+			// the page may be mapped now
+			try = -1
+			continue
+		}
+		// a page on swap is read without the pmap lock held, thus the
+		// fault is retried to check the access against the mapping
+		swapped, ret := as._swapinva(fa)
+		if swapped && ret == 0 {
+			as.Unlock_pmap()
+			try = -1
+			continue
+		}
+		if !swapped {
+			var old mem.Pa_t
+			if vmi.locked && _hugepde(as.Pmap, int(fa)) == nil {
+				old = _mlockphys(Pmap_lookup(as.Pmap, int(fa)))
+			}
+			ret = Sys_pgfault(as, vmi, fa, ecode)
+			if ret == 0 && vmi.locked {
+				as._mlockfault(int(fa), old)
+			}
+		}
+		over := as.Rss.Cg.Over(cgroup.PAGES, 1)
 		as.Unlock_pmap()
-		return -defs.EFAULT
+		if ret != -defs.ENOMEM {
+			return ret
+		}
+		// if memory ran out, retry once after the page-out daemon
+		// freed some pages. the daemon locks the address space, thus
+		// it must be unlocked while waiting. if the resource group ran
+		// out of pages instead, the daemon pages out only the group's
+		// pages, and if that does not help, the OOM killer kills one
+		// of the group's processes before each retry.
+		if over == nil {
+			if try != 0 || !Reclaim() {
+				return ret
+			}
+			continue
+		}
+		if try == 0 && Reclaimgroup(over) {
+			continue
+		}
+		if !res.Oomgroup(over, cgroup.PAGES, 1) {
+			return ret
+		}
 	}
-	ret := Sys_pgfault(as, vmi, fa, ecode)
+}
+
+// returns a new address space without a pmap whose pages are charged to cg
+func Mkvm(cg *cgroup.Cgroup_t) *Vm_t {
+	ret := &Vm_t{refs: 1}
+	ret.Rss.Cg = cg
+	return ret
+}
+
+// adds a reference for another process using the address space
+func (as *Vm_t) Share() *Vm_t {
+	as.Lock_pmap()
+	as.refs++
+	as.Unlock_pmap()
+	return as
+}
+
+// returns true if more than one process uses the address space
+func (as *Vm_t) Shared() bool {
+	as.Lock_pmap()
+	ret := as.refs > 1
 	as.Unlock_pmap()
 	return ret
 }
 
+// drops a process' reference; the last reference frees the user pages
+func (as *Vm_t) Release() {
+	as.Lock_pmap()
+	as.refs--
+	if as.refs < 0 {
+		panic("neg vm refs")
+	}
+	last := as.refs == 0
+	as.Unlock_pmap()
+	if last {
+		as.Uvmfree()
+	}
+}
+
 func (as *Vm_t) Uvmfree() {
+	// the page-out daemon may be scanning the address space
+	as.Lock_pmap()
+	as.freed = true
+	as.Rss.Release()
+	as.Munlockall()
+	as.Unlock_pmap()
 	Uvmfree_inner(as.Pmap, as.P_pmap, &as.Vmregion)
 	// Dec_pmap could free the pmap itself. thus it must come after
 	// Uvmfree.
@@ -543,6 +937,13 @@ func (as *Vm_t) Vmadd_anon(start, len int, perms mem.Pa_t) {
 	as.Vmregion.insert(vmi)
 }
 
+// the stack is not executable unless exec is true.
+func (as *Vm_t) Vmadd_stack(start, len int, perms mem.Pa_t, exec bool) {
+	vmi := as._mkvmi(VANON, start, len, perms, 0, nil, nil)
+	vmi.noexec = !exec
+	as.Vmregion.insert(vmi)
+}
+
 func (as *Vm_t) Vmadd_file(start, len int, perms mem.Pa_t, fops fdops.Fdops_i,
 	foff int) {
 	vmi := as._mkvmi(VFILE, start, len, perms, foff, fops, nil)
@@ -554,9 +955,11 @@ func (as *Vm_t) Vmadd_shareanon(start, len int, perms mem.Pa_t) {
 	as.Vmregion.insert(vmi)
 }
 
+// rdonly means the file was not opened for writing.
 func (as *Vm_t) Vmadd_sharefile(start, len int, perms mem.Pa_t, fops fdops.Fdops_i,
-	foff int, unpin mem.Unpin_i) {
-	vmi := as._mkvmi(VFILE, start, len, perms, foff, fops, unpin)
+	foff int, pcache Pagecache_i, rdonly bool) {
+	vmi := as._mkvmi(VFILE, start, len, perms, foff, fops, pcache)
+	vmi.file.mfile.rdonly = rdonly
 	as.Vmregion.insert(vmi)
 }
 
@@ -564,7 +967,7 @@ func (as *Vm_t) Vmadd_sharefile(start, len int, perms mem.Pa_t, fops fdops.Fdops
 // only use PTE_U/PTE_W; the page fault handler will install the correct COW
 // flags. perms == 0 means that no mapping can go here (like for guard pages).
 func (as *Vm_t) _mkvmi(mt mtype_t, start, len int, perms mem.Pa_t, foff int,
-	fops fdops.Fdops_i, unpin mem.Unpin_i) *Vminfo_t {
+	fops fdops.Fdops_i, pcache Pagecache_i) *Vminfo_t {
 	if len <= 0 {
 		panic("bad vmi len")
 	}
@@ -587,9 +990,9 @@ func (as *Vm_t) _mkvmi(mt mtype_t, start, len int, perms mem.Pa_t, foff int,
 		ret.file.foff = foff
 		ret.file.mfile = &Mfile_t{}
 		ret.file.mfile.mfops = fops
-		ret.file.mfile.unpin = unpin
+		ret.file.mfile.pcache = pcache
 		ret.file.mfile.mapcount = pglen
-		ret.file.shared = unpin != nil
+		ret.file.shared = pcache != nil
 	}
 	return ret
 }
@@ -0,0 +1,144 @@
+package vm
+
+import "defs"
+import "mem"
+
+// transparent huge pages: private anonymous memory is mapped with 2MB pages
+// where a 2MB-aligned chunk of the address space lies entirely within one
+// mapping whose chunk has no page table yet. operations which only affect part
+// of a huge page, and copy-on-write faults on it, split it into 4KB pages.
+// huge pages are never paged out.
+
+// returns true if the huge page at the 2MB-aligned va may map part of vmi
+func (vmi *Vminfo_t) _hugeok(va uintptr) bool {
+	start := vmi.Pgn << PGSHIFT
+	end := start + uintptr(vmi.Pglen)<<PGSHIFT
+	return vmi.Mtype == VANON && !vmi.nohuge && vmi.uffd == nil &&
+		vmi.Perms != 0 &&
+		va >= start && va+uintptr(mem.HUGESIZE) <= end
+}
+
+// maps a fresh huge page at the 2MB-aligned va with the PTE permissions perms
+// if va's page directory entry is empty. returns false if the page directory
+// entry is in use or memory ran out.
+func (as *Vm_t) _hugeinsert(va int, perms mem.Pa_t) bool {
+	pd, pdb := pmap_pdir(as.Pmap, va, true, PTE_U|PTE_W)
+	if pd == nil || pd[pdb] != 0 {
+		return false
+	}
+	p_pg, ok := mem.Physmem.Hugepg_new()
+	if !ok {
+		return false
+	}
+	mem.Physmem.Hugeup(p_pg)
+	if !as.Rss._tryadd(VANON, mem.HUGEPGS) {
+		mem.Physmem.Hugedown(p_pg)
+		return false
+	}
+	pd[pdb] = p_pg | perms | PTE_PS | PTE_P
+	return true
+}
+
+// handles a fault on a chunk which a huge page maps or may map. returns true
+// if the fault was handled.
+func (as *Vm_t) _hugefault(vmi *Vminfo_t, va uintptr, iswrite bool) bool {
+	hva := va &^ uintptr(mem.HUGESIZE-1)
+	if pde := _hugepde(as.Pmap, int(hva)); pde != nil {
+		// two threads simultaneously faulted on same page, unless
+		// this is a write to a copy-on-write huge page
+		return !iswrite || *pde&PTE_W != 0
+	}
+	if !vmi._hugeok(hva) {
+		return false
+	}
+	perms := PTE_U | PTE_A | vmi._nx()
+	if vmi.Perms&uint(PTE_W) != 0 {
+		perms |= PTE_W | PTE_WASCOW | PTE_D
+	}
+	return as._hugeinsert(int(hva), perms)
+}
+
+// unmaps and frees the huge page at the 2MB-aligned va and returns true, or
+// returns false if no huge page maps va.
+func (as *Vm_t) _hugeremove(va int) bool {
+	pde := _hugepde(as.Pmap, va)
+	if pde == nil {
+		return false
+	}
+	mem.Physmem.Hugedown(*pde & PTE_ADDR)
+	*pde = 0
+	as.Rss._add(VANON, -mem.HUGEPGS)
+	return true
+}
+
+// splits the huge page mapping va, if any, into 4KB pages. returns false if
+// memory ran out.
+func (as *Vm_t) _unhuge(va int) bool {
+	as.Lockassert_pmap()
+	pde := _hugepde(as.Pmap, va)
+	if pde == nil {
+		return true
+	}
+	_, p_pt, ok := mem.Physmem.Refpg_new()
+	if !ok {
+		return false
+	}
+	mem.Physmem.Refup(p_pt)
+	pt := _cpe(p_pt)
+	phys := *pde & PTE_ADDR
+	flags := *pde &^ (PTE_ADDR | PTE_PS)
+	mem.Physmem.Hugesplit(phys)
+	for i := range pt {
+		pt[i] = phys + mem.Pa_t(i<<PGSHIFT) | flags
+	}
+	*pde = p_pt | PTE_U | PTE_W | PTE_P
+	as.Tlbshoot(uintptr(va&^(mem.HUGESIZE-1)), mem.HUGEPGS)
+	return true
+}
+
+// splits the huge pages which map only part of [start, start+len). returns
+// false if memory ran out.
+func (as *Vm_t) _unhugeends(start, len int) bool {
+	hmask := mem.HUGESIZE - 1
+	if start&hmask != 0 && !as._unhuge(start) {
+		return false
+	}
+	end := start + len
+	return end&hmask == 0 || as._unhuge(end)
+}
+
+// returns the PTE for va in vmi, splitting the huge page which maps va, if
+// any. returns false if memory ran out.
+func (as *Vm_t) Ptefor(vmi *Vminfo_t, va uintptr) (*mem.Pa_t, bool) {
+	if !as._unhuge(int(va)) {
+		return nil, false
+	}
+	return vmi.Ptefor(as.Pmap, va)
+}
+
+// returns the physical address which the user address va maps to if a
+// present, accessible page maps it.
+func Userpa(pml4 *mem.Pmap_t, va int) (mem.Pa_t, bool) {
+	if pde := _hugepde(pml4, va); pde != nil {
+		if *pde&PTE_U == 0 {
+			return 0, false
+		}
+		return *pde&PTE_ADDR + mem.Pa_t(va&(mem.HUGESIZE-1)), true
+	}
+	pte := Pmap_lookup(pml4, va)
+	if pte == nil || *pte&PTE_P == 0 || *pte&PTE_U == 0 {
+		return 0, false
+	}
+	return *pte&PTE_ADDR + mem.Pa_t(va)&PGOFFSET, true
+}
+
+// allows or forbids huge pages in [start, start+len) for madvise(2).
+// forbidding huge pages does not split the huge pages which are already
+// mapped, except where they would straddle two mappings.
+func (as *Vm_t) Madvise_huge(start, len int, huge bool, novma uint) defs.Err_t {
+	as.Lockassert_pmap()
+	if !as._unhugeends(start, len) {
+		return -defs.ENOMEM
+	}
+	return as.Vmregion.Sethuge(start, len, huge, novma)
+}
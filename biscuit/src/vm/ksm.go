@@ -0,0 +1,314 @@
+package vm
+
+import "sync/atomic"
+import "time"
+
+import "mem"
+
+// same-page merging: a daemon periodically scans the private anonymous
+// mappings which madvise(MADV_MERGEABLE) marked and maps the pages with
+// identical contents to one read-only, copy-on-write page. a write to a merged
+// page gets a private copy from the page fault handler like after fork. the
+// daemon holds a reference to each merged ("stable") page so that the fault
+// handler never claims it. a page whose contents match no stable page is
+// remembered for one pass over all address spaces; if another page with the
+// same contents is found during that pass, the later page becomes stable and
+// the earlier one is merged into it. zero-filled pages are merged into the
+// zero page. huge pages are not merged.
+
+// the time between two passes
+const _ksmsleep = 200 * time.Millisecond
+
+// a page which was seen during the current pass
+type _ksmcand_t struct {
+	as   *Vm_t
+	va   int
+	phys mem.Pa_t
+}
+
+var ksm struct {
+	// stable pages by the hash of their contents; only used by the daemon
+	stable map[uint64][]mem.Pa_t
+	// the number of stable pages and the number of additional PTEs
+	// which map them, as of the end of the last pass
+	nshared  int64
+	nsharing int64
+	iter     func(func(*Vm_t))
+}
+
+// starts the merging daemon. iter must call its argument on the address space
+// of every process.
+func Ksmd_init(iter func(func(*Vm_t))) {
+	ksm.iter = iter
+	ksm.stable = make(map[uint64][]mem.Pa_t)
+	_zerohash = _pghash(mem.P_zeropg)
+	go ksmd()
+}
+
+// returns the number of stable pages and the number of PTEs which map them,
+// not counting one PTE per page; i.e. the number of pages merging saves.
+func Ksmstats() (int, int) {
+	return int(atomic.LoadInt64(&ksm.nshared)),
+		int(atomic.LoadInt64(&ksm.nsharing))
+}
+
+func ksmd() {
+	for {
+		time.Sleep(_ksmsleep)
+		_ksmpass()
+	}
+}
+
+func _ksmpass() {
+	unstable := make(map[uint64]_ksmcand_t)
+	ksm.iter(func(as *Vm_t) {
+		// skip address spaces which have no mergeable mapping without
+		// taking their locks
+		if atomic.LoadInt32(&as.Vmregion.mergeable) == 0 {
+			return
+		}
+		as.Lock_pmap()
+		if !as.freed {
+			as._ksmscan(unstable)
+		}
+		as.Unlock_pmap()
+	})
+	// release the stable pages which no process maps anymore
+	var shared, sharing int64
+	for h, pgs := range ksm.stable {
+		n := 0
+		for _, s := range pgs {
+			ref, _ := mem.Physmem.Refaddr(s)
+			c := atomic.LoadInt32(ref)
+			if c == 1 {
+				mem.Physmem.Refdown(s)
+				continue
+			}
+			pgs[n] = s
+			n++
+			shared++
+			// the daemon's reference and the first PTE save nothing
+			if c > 2 {
+				sharing += int64(c - 2)
+			}
+		}
+		if n == 0 {
+			delete(ksm.stable, h)
+		} else {
+			ksm.stable[h] = pgs[:n]
+		}
+	}
+	atomic.StoreInt64(&ksm.nshared, shared)
+	atomic.StoreInt64(&ksm.nsharing, sharing)
+}
+
+func _pghash(phys mem.Pa_t) uint64 {
+	// FNV-1a over the words of the page
+	h := uint64(14695981039346656037)
+	for _, w := range mem.Physmem.Dmap(phys) {
+		h ^= uint64(w)
+		h *= 1099511628211
+	}
+	return h
+}
+
+var _zerohash uint64
+
+// a page which has the same hash as a known page and was write-protected
+type _ksmpg_t struct {
+	pte  *mem.Pa_t
+	va   int
+	phys mem.Pa_t
+	h    uint64
+}
+
+// the pages of one address space which are merged with one TLB shootdown
+// after they are write-protected and one after they are replaced
+type _ksmbatch_t struct {
+	pgs []_ksmpg_t
+	// the replaced pages, which are freed after the second shootdown
+	olds []mem.Pa_t
+	// the range of the PTEs which changed since the last shootdown
+	lo, hi int
+	n      int
+}
+
+// records that the PTE of va changed
+func (b *_ksmbatch_t) _touch(va int) {
+	if b.n == 0 || va < b.lo {
+		b.lo = va
+	}
+	if b.n == 0 || va > b.hi {
+		b.hi = va
+	}
+	b.n++
+}
+
+func (as *Vm_t) _ksmshoot(b *_ksmbatch_t) {
+	if b.n == 0 {
+		return
+	}
+	as.Tlbshoot(uintptr(b.lo), (b.hi-b.lo)>>PGSHIFT+1)
+	b.n = 0
+}
+
+// merges the pages of the mergeable mappings of as. the pages which may be
+// merged are write-protected before their contents are compared.
+func (as *Vm_t) _ksmscan(unstable map[uint64]_ksmcand_t) {
+	var b _ksmbatch_t
+	found := false
+	as.Vmregion.Iter(func(vmi *Vminfo_t) {
+		if vmi.Mtype != VANON || !vmi.merge {
+			return
+		}
+		found = true
+		// merging would move the locks of the pages of locked mappings
+		if vmi.Perms != 0 && !vmi.locked {
+			as._ksmvmi(vmi, unstable, &b)
+		}
+	})
+	if !found {
+		atomic.StoreInt32(&as.Vmregion.mergeable, 0)
+		return
+	}
+	as._ksmshoot(&b)
+	for _, pg := range b.pgs {
+		as._ksmpage(pg, unstable, &b)
+	}
+	as._ksmshoot(&b)
+	for _, old := range b.olds {
+		mem.Physmem.Refdown(old)
+	}
+}
+
+func (as *Vm_t) _ksmvmi(vmi *Vminfo_t, unstable map[uint64]_ksmcand_t,
+	b *_ksmbatch_t) {
+	start := int(vmi.Pgn << PGSHIFT)
+	end := start + vmi.Pglen<<PGSHIFT
+	for va := start; va < end; {
+		if _hugepde(as.Pmap, va) != nil {
+			va += mem.HUGESIZE
+			continue
+		}
+		pt, slot := pmap_pgtbl(as.Pmap, va, false, 0)
+		if pt == nil {
+			va += 1 << 21
+			va &^= (1 << 21) - 1
+			continue
+		}
+		for ; slot < len(pt) && va < end; slot, va = slot+1, va+mem.PGSIZE {
+			as._ksmhash(&pt[slot], va, unstable, b)
+		}
+	}
+}
+
+// hashes the page which pte maps at va. if a page with the same contents may
+// be known, the page is write-protected and added to the batch; otherwise it
+// is remembered for the rest of the pass.
+func (as *Vm_t) _ksmhash(pte *mem.Pa_t, va int,
+	unstable map[uint64]_ksmcand_t, b *_ksmbatch_t) {
+	if *pte&(PTE_P|PTE_U) != PTE_P|PTE_U {
+		return
+	}
+	// pages which are already shared, for example after fork, are left
+	// alone
+	phys := *pte & PTE_ADDR
+	ref, _ := mem.Physmem.Refaddr(phys)
+	if phys == mem.P_zeropg || atomic.LoadInt32(ref) != 1 {
+		return
+	}
+	h := _pghash(phys)
+	_, stable := ksm.stable[h]
+	c, ok := unstable[h]
+	if h != _zerohash && !stable && (!ok || c.phys == phys) {
+		unstable[h] = _ksmcand_t{as, va, phys}
+		return
+	}
+	as._wrprotect(pte, va, b)
+	b.pgs = append(b.pgs, _ksmpg_t{pte, va, phys, h})
+	// the earlier page may be merged into this one
+	if !stable && ok {
+		if q := as._ksmlookup(c); q != nil {
+			as._wrprotect(q, c.va, b)
+		}
+	}
+}
+
+// tries to merge the write-protected page pg
+func (as *Vm_t) _ksmpage(pg _ksmpg_t, unstable map[uint64]_ksmcand_t,
+	b *_ksmbatch_t) {
+	pte, va, phys, h := pg.pte, pg.va, pg.phys, pg.h
+	if *pte&PTE_ADDR != phys {
+		return
+	}
+	if h == _zerohash && as._ksmmerge(pte, va, mem.P_zeropg, b) {
+		return
+	}
+	if pgs, ok := ksm.stable[h]; ok {
+		for _, s := range pgs {
+			if as._ksmmerge(pte, va, s, b) {
+				return
+			}
+		}
+		return
+	}
+	c, ok := unstable[h]
+	if !ok || c.phys == phys {
+		unstable[h] = _ksmcand_t{as, va, phys}
+		return
+	}
+	// the page may have changed since it was hashed
+	if _pghash(phys) != h {
+		return
+	}
+	mem.Physmem.Refup(phys)
+	ksm.stable[h] = append(ksm.stable[h], phys)
+	delete(unstable, h)
+	// the earlier page is merged by the next pass unless it is in this
+	// address space
+	if q := as._ksmlookup(c); q != nil {
+		as._ksmmerge(q, c.va, phys, b)
+	}
+}
+
+// returns the PTE of the page c if it is in as and is still mapped
+func (as *Vm_t) _ksmlookup(c _ksmcand_t) *mem.Pa_t {
+	if c.as != as {
+		return nil
+	}
+	q := Pmap_lookup(as.Pmap, c.va)
+	if q == nil || *q&(PTE_P|PTE_U) != PTE_P|PTE_U || *q&PTE_ADDR != c.phys {
+		return nil
+	}
+	return q
+}
+
+// makes the private page which pte maps at va copy-on-write so that its
+// contents cannot change without a page fault once the batch's TLB shootdown
+// is done.
+func (as *Vm_t) _wrprotect(pte *mem.Pa_t, va int, b *_ksmbatch_t) {
+	if *pte&PTE_W == 0 {
+		return
+	}
+	*pte = (*pte &^ (PTE_W | PTE_WASCOW)) | PTE_COW
+	b._touch(va)
+}
+
+// maps the stable page s at va instead of the page which pte maps, if the
+// page was write-protected before the last TLB shootdown and their contents
+// are identical. returns true if the page was merged.
+func (as *Vm_t) _ksmmerge(pte *mem.Pa_t, va int, s mem.Pa_t,
+	b *_ksmbatch_t) bool {
+	if *pte&PTE_W != 0 {
+		return false
+	}
+	old := *pte & PTE_ADDR
+	if *mem.Physmem.Dmap(old) != *mem.Physmem.Dmap(s) {
+		return false
+	}
+	mem.Physmem.Refup(s)
+	*pte = s | *pte&^PTE_ADDR
+	b._touch(va)
+	b.olds = append(b.olds, old)
+	return true
+}
@@ -0,0 +1,246 @@
+package vm
+
+import "defs"
+import "mem"
+import "util"
+
+// readahead hints of file mappings. a fault on a page of a sequential mapping
+// also maps the following pages of the mapping.
+type Ra_t uint8
+
+const (
+	RA_NORMAL Ra_t = iota
+	RA_SEQ
+	RA_RANDOM
+)
+
+// the number of pages mapped after a faulting page of a sequential mapping
+const _rapgs = 16
+
+// calls f on each mapping in [start, end) with the part of the range the
+// mapping covers. the whole range must be mapped.
+func (as *Vm_t) _eachvmi(start, end int, f func(*Vminfo_t, int, int)) {
+	for va := start; va < end; {
+		vmi, ok := as.Vmregion.Lookup(uintptr(va))
+		if !ok {
+			panic("must be mapped")
+		}
+		e := int(vmi.Pgn<<PGSHIFT) + vmi.Pglen<<PGSHIFT
+		if e > end {
+			e = end
+		}
+		f(vmi, va, e)
+		va = e
+	}
+}
+
+// clears the dirty bits of the pages of the shared file mapping vmi in [start,
+// end) and journals the dirty pages.
+func (as *Vm_t) _pgsync(vmi *Vminfo_t, start, end int) defs.Err_t {
+	var dirty []mem.Pa_t
+	for va := start; va < end; va += mem.PGSIZE {
+		pte := Pmap_lookup(as.Pmap, va)
+		if pte == nil || *pte&(PTE_P|PTE_D) != PTE_P|PTE_D {
+			continue
+		}
+		*pte &^= PTE_D
+		dirty = append(dirty, *pte&PTE_ADDR)
+	}
+	if len(dirty) == 0 {
+		return 0
+	}
+	// a write after the shootdown dirties the page again
+	as.Tlbshoot(uintptr(start), (end-start)>>PGSHIFT)
+	return vmi.file.mfile.pcache.Pgsync(dirty)
+}
+
+// writes the pages of the shared file mapping vmi in [start, end) to disk,
+// including the pages which were journaled earlier.
+func (as *Vm_t) _pgflush(vmi *Vminfo_t, start, end int) defs.Err_t {
+	var pas []mem.Pa_t
+	for va := start; va < end; va += mem.PGSIZE {
+		pte := Pmap_lookup(as.Pmap, va)
+		if pte != nil && *pte&PTE_P != 0 {
+			pas = append(pas, *pte&PTE_ADDR)
+		}
+	}
+	if len(pas) == 0 {
+		return 0
+	}
+	return vmi.file.mfile.pcache.Pgflush(pas)
+}
+
+// journals the pages of shared file mappings in [start, start+len) which were
+// written since they were mapped or last synced. if sync is true, the pages
+// are also written to disk. the caller must make sure that the range is
+// mapped.
+func (as *Vm_t) Msync(start, len int, sync bool) defs.Err_t {
+	as.Lockassert_pmap()
+	var err defs.Err_t
+	as._eachvmi(start, start+len, func(vmi *Vminfo_t, s, e int) {
+		if err == 0 && vmi.Mtype == VFILE && vmi.file.shared {
+			err = as._pgsync(vmi, s, e)
+			if err == 0 && sync {
+				err = as._pgflush(vmi, s, e)
+			}
+		}
+	})
+	return err
+}
+
+// frees the pages in [start, start+len) so that the next access of a private
+// page finds zeros or the file's contents. the dirty pages of shared file
+// mappings are journaled first. shared anonymous pages have no other copy and
+// stay mapped. locked pages cannot be freed. the caller must make sure that
+// the range is mapped.
+func (as *Vm_t) Madvise_dontneed(start, len int) defs.Err_t {
+	as.Lockassert_pmap()
+	var err defs.Err_t
+	as._eachvmi(start, start+len, func(vmi *Vminfo_t, s, e int) {
+		if vmi.locked {
+			err = -defs.EINVAL
+		}
+	})
+	if err != 0 {
+		return err
+	}
+	if !as._unhugeends(start, len) {
+		return -defs.ENOMEM
+	}
+	as._eachvmi(start, start+len, func(vmi *Vminfo_t, s, e int) {
+		if err != 0 || vmi.Mtype == VSANON {
+			return
+		}
+		var unpin mem.Unpin_i
+		if vmi.Mtype == VFILE && vmi.file.shared {
+			if err = as._pgsync(vmi, s, e); err != 0 {
+				return
+			}
+			unpin = vmi.file.mfile.pcache
+		}
+		npg, nswap := pmfree(as.Pmap, uintptr(s), uintptr(e), unpin)
+		as.Rss._add(vmi.Mtype, -npg)
+		as.Rss.Swap -= nswap
+	})
+	as.Tlbshoot(uintptr(start), len>>PGSHIFT)
+	return err
+}
+
+// removes the pages at and beyond the file offset off from the shared mappings
+// of every process whose page cache is one that same accepts, like a file
+// which shrinks to off would. later accesses fault and find the new end.
+func Truncmaps(same func(Pagecache_i) bool, off int) {
+	if swap.iter == nil {
+		return
+	}
+	off = util.Roundup(off, mem.PGSIZE)
+	swap.iter(func(as *Vm_t) {
+		as.Lock_pmap()
+		if !as.freed {
+			as._truncmaps(same, off)
+		}
+		as.Unlock_pmap()
+	})
+}
+
+func (as *Vm_t) _truncmaps(same func(Pagecache_i) bool, off int) {
+	as.Vmregion.Iter(func(vmi *Vminfo_t) {
+		if vmi.Mtype != VFILE || !vmi.file.shared ||
+			!same(vmi.file.mfile.pcache) {
+			return
+		}
+		start := int(vmi.Pgn << PGSHIFT)
+		end := start + vmi.Pglen<<PGSHIFT
+		if s := start + off - vmi.file.foff; s > start {
+			start = s
+		}
+		if start >= end {
+			return
+		}
+		if vmi.locked {
+			as._munlockpgs(start, end)
+		}
+		npg, nswap := pmfree(as.Pmap, uintptr(start), uintptr(end),
+			vmi.file.mfile.pcache)
+		as.Rss._add(vmi.Mtype, -npg)
+		as.Rss.Swap -= nswap
+		as.Tlbshoot(uintptr(start), (end-start)>>PGSHIFT)
+	})
+}
+
+// reads the file pages of the file mappings in [start, start+len) into the
+// block cache. the caller must make sure that the range is mapped.
+func (as *Vm_t) Madvise_willneed(start, len int) {
+	as.Lockassert_pmap()
+	as._eachvmi(start, start+len, func(vmi *Vminfo_t, s, e int) {
+		if vmi.Mtype != VFILE {
+			return
+		}
+		foff := vmi.file.foff + s - int(vmi.Pgn<<PGSHIFT)
+		// the range may extend beyond the end of the file
+		mmapi, err := vmi.file.mfile.mfops.Mmapi(foff, e-s, false)
+		if err != 0 {
+			return
+		}
+		for _, mi := range mmapi {
+			mem.Physmem.Refdown(mi.Phys)
+		}
+	})
+}
+
+// sets the readahead hint of the mappings in [start, start+len), which must be
+// mapped.
+func (as *Vm_t) Madvise_ra(start, len int, ra Ra_t, novma uint) defs.Err_t {
+	as.Lockassert_pmap()
+	return as.Vmregion.Setra(start, len, ra, novma)
+}
+
+// allows or forbids merging the pages of the anonymous mappings in [start,
+// start+len), which must be mapped, with identical pages. pages which are
+// already merged stay shared until they are written.
+func (as *Vm_t) Madvise_merge(start, len int, merge bool, novma uint) defs.Err_t {
+	as.Lockassert_pmap()
+	return as.Vmregion.Setmerge(start, len, merge, novma)
+}
+
+// maps the file pages which follow the faulting page va of the sequential file
+// mapping vmi and are not mapped yet. the pages are mapped like read faults
+// map them, except that shared pages are clean.
+func (as *Vm_t) _readahead(vmi *Vminfo_t, va uintptr) {
+	start := int(va&^uintptr(PGOFFSET)) + mem.PGSIZE
+	end := start + _rapgs<<PGSHIFT
+	if vend := int(vmi.Pgn<<PGSHIFT) + vmi.Pglen<<PGSHIFT; end > vend {
+		end = vend
+	}
+	if start >= end || vmi.Perms == 0 {
+		return
+	}
+	foff := vmi.file.foff + start - int(vmi.Pgn<<PGSHIFT)
+	shared := vmi.file.shared
+	mmapi, err := vmi.file.mfile.mfops.Mmapi(foff, end-start, shared)
+	if err != 0 {
+		return
+	}
+	perms := PTE_U | PTE_A | vmi._nx()
+	if vmi.Perms&uint(PTE_W) != 0 {
+		if shared {
+			perms |= PTE_W
+		} else {
+			perms |= PTE_COW
+		}
+	}
+	for i, mi := range mmapi {
+		pva := start + i<<PGSHIFT
+		pte, ok := vmi.Ptefor(as.Pmap, uintptr(pva))
+		if ok && *pte == 0 {
+			_, ok = as.Blockpage_insert(pva, mi.Phys, perms, true, pte)
+			if ok {
+				continue
+			}
+		}
+		if shared {
+			vmi.file.mfile.pcache.Unpin(mi.Phys)
+		}
+		mem.Physmem.Refdown(mi.Phys)
+	}
+}
@@ -0,0 +1,199 @@
+package vm
+
+import "defs"
+import "mem"
+import "util"
+
+// locked mappings: the pages of a locked mapping are faulted in when it is
+// locked and are never paged out. the block cache keeps the blocks whose pages
+// locked file mappings map. every page counts the locked mappings which map
+// it. only the mappings themselves are locked; a child does not inherit them.
+
+// returns the number of pages of locked mappings
+func (as *Vm_t) Lockedpgs() int {
+	as.Lockassert_pmap()
+	n := 0
+	as.Vmregion.Iter(func(vmi *Vminfo_t) {
+		if vmi.locked {
+			n += vmi.Pglen
+		}
+	})
+	return n
+}
+
+// locks the mappings in [start, start+len), which must be mapped, and faults
+// in their pages. returns ENOMEM if more than lim pages would be locked. if
+// memory runs out while faulting in, the range stays locked and ENOMEM is
+// returned; the remaining pages are locked once they are faulted in.
+func (as *Vm_t) Mlock(start, len, lim int, novma uint) defs.Err_t {
+	as.Lockassert_pmap()
+	n := as.Lockedpgs()
+	as._eachvmi(start, start+len, func(vmi *Vminfo_t, s, e int) {
+		if !vmi.locked {
+			n += (e - s) >> PGSHIFT
+		}
+	})
+	if n > lim {
+		return -defs.ENOMEM
+	}
+	// the pages of the mappings which are locked already are counted
+	var todo [][2]int
+	as._eachvmi(start, start+len, func(vmi *Vminfo_t, s, e int) {
+		if !vmi.locked {
+			todo = append(todo, [2]int{s, e})
+		}
+	})
+	if err := as.Vmregion.Setlock(start, len, true, novma); err != 0 {
+		return err
+	}
+	var err defs.Err_t
+	for _, r := range todo {
+		as._eachvmi(r[0], r[1], func(vmi *Vminfo_t, s, e int) {
+			if err == 0 {
+				err = as._mlockpop(vmi, s, e)
+			}
+		})
+	}
+	return err
+}
+
+// unlocks the mappings in [start, start+len), which must be mapped
+func (as *Vm_t) Munlock(start, len int, novma uint) defs.Err_t {
+	as.Lockassert_pmap()
+	as._eachvmi(start, start+len, func(vmi *Vminfo_t, s, e int) {
+		if vmi.locked {
+			as._munlockpgs(s, e)
+		}
+	})
+	return as.Vmregion.Setlock(start, len, false, novma)
+}
+
+// locks every mapping and faults in their pages if current is true, and the
+// mappings created later if future is true. returns ENOMEM if more than lim
+// pages would be locked.
+func (as *Vm_t) Mlockall(current, future bool, lim int) defs.Err_t {
+	as.Lockassert_pmap()
+	if current && as.Vmregion.Pglen() > lim {
+		return -defs.ENOMEM
+	}
+	as.Lockfuture = future
+	if !current {
+		return 0
+	}
+	// locking every mapping splits none
+	var err defs.Err_t
+	as.Vmregion.Iter(func(vmi *Vminfo_t) {
+		if vmi.locked {
+			return
+		}
+		vmi.locked = true
+		if err == 0 {
+			s := int(vmi.Pgn << PGSHIFT)
+			err = as._mlockpop(vmi, s, s+vmi.Pglen<<PGSHIFT)
+		}
+	})
+	return err
+}
+
+// unlocks every mapping and stops locking new mappings
+func (as *Vm_t) Munlockall() {
+	as.Lockassert_pmap()
+	as.Lockfuture = false
+	as.Vmregion.Iter(func(vmi *Vminfo_t) {
+		if vmi.locked {
+			s := int(vmi.Pgn << PGSHIFT)
+			as._munlockpgs(s, s+vmi.Pglen<<PGSHIFT)
+			vmi.locked = false
+		}
+	})
+}
+
+// faults in the pages of the locked mapping vmi in [start, end) like accesses
+// would and counts the lock of each page. the private pages of writable
+// mappings are faulted in writable so that they are not copied later. the
+// pages of inaccessible mappings and the missing pages of ranges registered
+// with a userfaultfd are not faulted in.
+func (as *Vm_t) _mlockpop(vmi *Vminfo_t, start, end int) defs.Err_t {
+	noacc := vmi.Perms == 0
+	write := vmi.Perms&uint(PTE_W) != 0 &&
+		(vmi.Mtype == VANON || (vmi.Mtype == VFILE && !vmi.file.shared))
+	ecode := uintptr(PTE_U)
+	if write {
+		ecode |= uintptr(PTE_W)
+	}
+	for va := start; va < end; {
+		// huge pages are never paged out
+		if _hugepde(as.Pmap, va) != nil {
+			va = util.Rounddown(va, mem.HUGESIZE) + mem.HUGESIZE
+			continue
+		}
+		pte := Pmap_lookup(as.Pmap, va)
+		fault := !noacc && (pte == nil || *pte&PTE_P == 0 ||
+			(write && *pte&PTE_COW != 0))
+		if fault && !as._uffdmissing(vmi, uintptr(va)) {
+			err := Sys_pgfault(as, vmi, uintptr(va), ecode)
+			if err == -defs.ENOMEM || err == -defs.ENOHEAP {
+				return -defs.ENOMEM
+			}
+			// the fault may have mapped a huge page
+			if _hugepde(as.Pmap, va) != nil {
+				continue
+			}
+			pte = Pmap_lookup(as.Pmap, va)
+		}
+		as._mlockpg(pte)
+		va += mem.PGSIZE
+	}
+	return 0
+}
+
+// returns the page which pte maps, or 0 if there is none or it is the zero
+// page
+func _mlockphys(pte *mem.Pa_t) mem.Pa_t {
+	if pte == nil || *pte&PTE_P == 0 {
+		return 0
+	}
+	if phys := *pte & PTE_ADDR; phys != mem.P_zeropg {
+		return phys
+	}
+	return 0
+}
+
+// counts the lock of the page which pte maps, if any
+func (as *Vm_t) _mlockpg(pte *mem.Pa_t) {
+	if phys := _mlockphys(pte); phys != 0 {
+		mem.Physmem.Mlock(phys)
+	}
+}
+
+// moves the lock of the locked mapping at va from the page old, which va
+// mapped before a fault, to the page which va maps now
+func (as *Vm_t) _mlockfault(va int, old mem.Pa_t) {
+	if _hugepde(as.Pmap, va) != nil {
+		return
+	}
+	phys := _mlockphys(Pmap_lookup(as.Pmap, va))
+	if phys == old {
+		return
+	}
+	if old != 0 {
+		mem.Physmem.Munlock(old)
+	}
+	if phys != 0 {
+		mem.Physmem.Mlock(phys)
+	}
+}
+
+// uncounts the locks of the pages in [start, end)
+func (as *Vm_t) _munlockpgs(start, end int) {
+	for va := start; va < end; {
+		if _hugepde(as.Pmap, va) != nil {
+			va = util.Rounddown(va, mem.HUGESIZE) + mem.HUGESIZE
+			continue
+		}
+		if phys := _mlockphys(Pmap_lookup(as.Pmap, va)); phys != 0 {
+			mem.Physmem.Munlock(phys)
+		}
+		va += mem.PGSIZE
+	}
+}
@@ -20,14 +20,14 @@ func _instpg(pg *mem.Pmap_t, idx uint, perms mem.Pa_t) (mem.Pa_t, bool) {
 	return npte, true
 }
 
+// returns the page directory which maps v and the index of v's entry in it.
 // returns nil if either 1) create was false and the mapping doesn't exist or
 // 2) create was true but we failed to allocate a page to create the mapping.
-func pmap_pgtbl(pml4 *mem.Pmap_t, v int, create bool, perms mem.Pa_t) (*mem.Pmap_t, int) {
+func pmap_pdir(pml4 *mem.Pmap_t, v int, create bool, perms mem.Pa_t) (*mem.Pmap_t, int) {
 	vn := uint(uintptr(v))
 	l4b := (vn >> (12 + 9*3)) & 0x1ff
 	pdpb := (vn >> (12 + 9*2)) & 0x1ff
 	pdb := (vn >> (12 + 9*1)) & 0x1ff
-	ptb := (vn >> (12 + 9*0)) & 0x1ff
 	if l4b >= uint(mem.VREC) && l4b <= uint(mem.VEND) {
 		panic(fmt.Sprintf("map in special slots: %#x", l4b))
 	}
@@ -36,14 +36,6 @@ func pmap_pgtbl(pml4 *mem.Pmap_t, v int, create bool, perms mem.Pa_t) (*mem.Pmap
 		panic("mapping page 0")
 	}
 
-	cpe := func(pe mem.Pa_t) *mem.Pmap_t {
-		if pe&PTE_PS != 0 {
-			panic("insert mapping into PS page")
-		}
-		phys := uintptr(pe & PTE_ADDR)
-		return (*mem.Pmap_t)(unsafe.Pointer(mem.Vdirect + phys))
-	}
-
 	var ok bool
 	pe := pml4[l4b]
 	if pe&PTE_P == 0 {
@@ -55,7 +47,7 @@ func pmap_pgtbl(pml4 *mem.Pmap_t, v int, create bool, perms mem.Pa_t) (*mem.Pmap
 			return nil, 0
 		}
 	}
-	next := cpe(pe)
+	next := _cpe(pe)
 	pe = next[pdpb]
 	if pe&PTE_P == 0 {
 		if !create {
@@ -66,19 +58,48 @@ func pmap_pgtbl(pml4 *mem.Pmap_t, v int, create bool, perms mem.Pa_t) (*mem.Pmap
 			return nil, 0
 		}
 	}
-	next = cpe(pe)
-	pe = next[pdb]
+	return _cpe(pe), int(pdb)
+}
+
+func _cpe(pe mem.Pa_t) *mem.Pmap_t {
+	if pe&PTE_PS != 0 {
+		panic("insert mapping into PS page")
+	}
+	phys := uintptr(pe & PTE_ADDR)
+	return (*mem.Pmap_t)(unsafe.Pointer(mem.Vdirect + phys))
+}
+
+// returns nil if either 1) create was false and the mapping doesn't exist or
+// 2) create was true but we failed to allocate a page to create the mapping.
+// v must not be mapped by a huge page.
+func pmap_pgtbl(pml4 *mem.Pmap_t, v int, create bool, perms mem.Pa_t) (*mem.Pmap_t, int) {
+	pd, pdb := pmap_pdir(pml4, v, create, perms)
+	if pd == nil {
+		return nil, 0
+	}
+	ptb := (uint(uintptr(v)) >> 12) & 0x1ff
+	pe := pd[pdb]
 	if pe&PTE_P == 0 {
 		if !create {
 			return nil, 0
 		}
-		pe, ok = _instpg(next, pdb, perms)
+		var ok bool
+		pe, ok = _instpg(pd, uint(pdb), perms)
 		if !ok {
 			return nil, 0
 		}
 	}
-	next = cpe(pe)
-	return next, int(ptb)
+	return _cpe(pe), int(ptb)
+}
+
+// returns the page directory entry of the huge page which maps v, or nil if a
+// huge page does not map v.
+func _hugepde(pml4 *mem.Pmap_t, v int) *mem.Pa_t {
+	pd, pdb := pmap_pdir(pml4, v, false, 0)
+	if pd == nil || pd[pdb]&(PTE_P|PTE_PS) != PTE_P|PTE_PS {
+		return nil
+	}
+	return &pd[pdb]
 }
 
 // requires direct mapping
@@ -103,8 +124,20 @@ func Pmap_lookup(pml4 *mem.Pmap_t, v int) *mem.Pa_t {
 	return _pmap_walk(pml4, v, false, 0)
 }
 
-func pmfree(pml4 *mem.Pmap_t, start, end uintptr, fops mem.Unpin_i) {
+func pmfree(pml4 *mem.Pmap_t, start, end uintptr, fops mem.Unpin_i) (int, int) {
+	var npg, nswap int
 	for i := start; i < end; {
+		if pde := _hugepde(pml4, int(i)); pde != nil {
+			if i%uintptr(mem.HUGESIZE) != 0 ||
+				i+uintptr(mem.HUGESIZE) > end {
+				panic("huge page in two mappings")
+			}
+			mem.Physmem.Hugedown(*pde & PTE_ADDR)
+			*pde = 0
+			npg += mem.HUGEPGS
+			i += uintptr(mem.HUGESIZE)
+			continue
+		}
 		pg, slot := pmap_pgtbl(pml4, int(i), false, 0)
 		if pg == nil {
 			// this level is not mapped; skip to the next va that
@@ -120,7 +153,7 @@ func pmfree(pml4 *mem.Pmap_t, start, end uintptr, fops mem.Unpin_i) {
 		}
 		for idx, p_pg := range tofree {
 			if p_pg&PTE_P != 0 {
-				if p_pg&PTE_U == 0 {
+				if p_pg&(PTE_U|PTE_PROTNONE) == 0 {
 					panic("kernel pages in vminfo?")
 				}
 				pa := p_pg & PTE_ADDR
@@ -129,10 +162,16 @@ func pmfree(pml4 *mem.Pmap_t, start, end uintptr, fops mem.Unpin_i) {
 				}
 				mem.Physmem.Refdown(pa)
 				tofree[idx] = 0
+				npg++
+			} else if _isswap(p_pg) {
+				_slotdrop(_swapslot(p_pg))
+				tofree[idx] = 0
+				nswap++
 			}
 		}
 		i += uintptr(len(tofree)) << PGSHIFT
 	}
+	return npg, nswap
 }
 
 // forks the ptes only for the virtual address range specified. returns true if
@@ -144,6 +183,27 @@ func Ptefork(cpmap, ppmap *mem.Pmap_t, start, end int,
 	mkcow := !shared
 	i := start
 	for i < end {
+		if pde := _hugepde(ppmap, i); pde != nil {
+			if i%mem.HUGESIZE != 0 || i+mem.HUGESIZE > end {
+				panic("huge page in two mappings")
+			}
+			cpd, pdb := pmap_pdir(cpmap, i, true, PTE_U|PTE_W)
+			if cpd == nil {
+				return doflush, false
+			}
+			phys := *pde & PTE_ADDR
+			flags := *pde &^ PTE_ADDR
+			if flags&PTE_W != 0 && mkcow {
+				flags &^= (PTE_W | PTE_WASCOW)
+				flags |= PTE_COW
+				doflush = true
+				*pde = phys | flags
+			}
+			cpd[pdb] = phys | flags
+			mem.Physmem.Hugeup(phys)
+			i += mem.HUGESIZE
+			continue
+		}
 		pptb, slot := pmap_pgtbl(ppmap, i, false, 0)
 		if pptb == nil {
 			// skip to next page directory
@@ -164,6 +224,16 @@ func Ptefork(cpmap, ppmap *mem.Pmap_t, start, end int,
 			cs = cs[:left]
 		}
 		for j, pte := range ps {
+			if _isswap(pte) {
+				// the caller swaps in shared anonymous pages so
+				// that both processes map the same page
+				if shared {
+					panic("shared page on swap")
+				}
+				_slotdup(_swapslot(pte))
+				cs[j] = pte
+				continue
+			}
 			// may be guard pages
 			if pte&PTE_P == 0 {
 				continue
@@ -178,7 +248,7 @@ func Ptefork(cpmap, ppmap *mem.Pmap_t, start, end int,
 			}
 			cs[j] = phys | flags
 			// XXXPANIC
-			if pte&PTE_U == 0 {
+			if pte&(PTE_U|PTE_PROTNONE) == 0 {
 				panic("huh?")
 			}
 			mem.Physmem.Refup(phys)
@@ -271,7 +341,7 @@ func Uvmfree_inner(pmg *mem.Pmap_t, p_pmap mem.Pa_t, vmr *Vmregion_t) {
 		end := start + uintptr(vmi.Pglen<<PGSHIFT)
 		var unpin mem.Unpin_i
 		if vmi.Mtype == VFILE {
-			unpin = vmi.file.mfile.unpin
+			unpin = vmi.file.mfile.pcache
 		}
 		pmfree(pmg, start, end, unpin)
 	})
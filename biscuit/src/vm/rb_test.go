@@ -0,0 +1,360 @@
+package vm
+
+import "math/rand"
+import "testing"
+
+import "defs"
+
+const rw = uint(PTE_U | PTE_W)
+
+func anon(pgn uintptr, pglen int, perms uint) *Vminfo_t {
+	return &Vminfo_t{Mtype: VANON, Pgn: pgn, Pglen: pglen, Perms: perms}
+}
+
+// checks the red-black properties and that the mappings are sorted and do
+// not overlap. returns the black height.
+func rbcheck(t *testing.T, n *Rbn_t) int {
+	if n == nil {
+		return 1
+	}
+	if n.l != nil {
+		if n.l.p != n {
+			t.Fatalf("bad parent of %#x", n.l.vmi.Pgn)
+		}
+		if n.l.vmi.Pgn+uintptr(n.l.vmi.Pglen) > n.vmi.Pgn {
+			t.Fatalf("%#x overlaps %#x", n.l.vmi.Pgn, n.vmi.Pgn)
+		}
+	}
+	if n.r != nil {
+		if n.r.p != n {
+			t.Fatalf("bad parent of %#x", n.r.vmi.Pgn)
+		}
+		if n.vmi.Pgn+uintptr(n.vmi.Pglen) > n.r.vmi.Pgn {
+			t.Fatalf("%#x overlaps %#x", n.vmi.Pgn, n.r.vmi.Pgn)
+		}
+	}
+	if n.c == RED && ((n.l != nil && n.l.c == RED) ||
+		(n.r != nil && n.r.c == RED)) {
+		t.Fatalf("red node %#x has red child", n.vmi.Pgn)
+	}
+	lh := rbcheck(t, n.l)
+	if lh != rbcheck(t, n.r) {
+		t.Fatalf("black heights differ at %#x", n.vmi.Pgn)
+	}
+	if n.c == BLACK {
+		lh++
+	}
+	return lh
+}
+
+// checks the tree and that the pages in [0, len(want)) are mapped exactly
+// when want is non-zero, with want's permissions minus one.
+func check(t *testing.T, m *Vmregion_t, want []uint) {
+	if m.rb.root != nil && m.rb.root.c != BLACK {
+		t.Fatalf("red root")
+	}
+	rbcheck(t, m.rb.root)
+	var novma uint
+	pglen := 0
+	m.Iter(func(vmi *Vminfo_t) {
+		novma++
+		pglen += vmi.Pglen
+	})
+	if novma != m.Novma {
+		t.Fatalf("novma %v, have %v", m.Novma, novma)
+	}
+	if pglen != m.Pglen() {
+		t.Fatalf("pglen %v, have %v", m.Pglen(), pglen)
+	}
+	for i, w := range want {
+		vmi, ok := m.Lookup(uintptr(i) << PGSHIFT)
+		if ok != (w != 0) {
+			t.Fatalf("page %v: mapped %v", i, ok)
+		}
+		if ok && vmi.Perms != w-1 {
+			t.Fatalf("page %v: perms %#x", i, vmi.Perms)
+		}
+		over := m.Overlaps(i<<PGSHIFT, 1<<PGSHIFT)
+		if over != ok {
+			t.Fatalf("page %v: overlaps %v", i, over)
+		}
+	}
+}
+
+func TestInsertMerge(t *testing.T) {
+	m := &Vmregion_t{}
+	want := make([]uint, 32)
+	m.insert(anon(4, 4, rw))
+	m.insert(anon(12, 4, rw))
+	m.insert(anon(20, 4, uint(PTE_U)))
+	for i := 4; i < 8; i++ {
+		want[i], want[i+8] = rw+1, rw+1
+		want[i+16] = uint(PTE_U) + 1
+	}
+	check(t, m, want)
+	if m.Novma != 3 {
+		t.Fatalf("novma %v", m.Novma)
+	}
+	// fills the gap and merges with both neighbors
+	m.insert(anon(8, 4, rw))
+	for i := 8; i < 12; i++ {
+		want[i] = rw + 1
+	}
+	check(t, m, want)
+	if m.Novma != 2 {
+		t.Fatalf("novma %v", m.Novma)
+	}
+	// different permissions do not merge
+	m.insert(anon(16, 4, rw))
+	for i := 16; i < 20; i++ {
+		want[i] = rw + 1
+	}
+	check(t, m, want)
+	if m.Novma != 2 {
+		t.Fatalf("novma %v", m.Novma)
+	}
+	if m.Overlaps(0, 4<<PGSHIFT) || !m.Overlaps(0, 5<<PGSHIFT) {
+		t.Fatalf("overlaps")
+	}
+	if !m.Mapped(4<<PGSHIFT, 20<<PGSHIFT) || m.Mapped(0, 5<<PGSHIFT) {
+		t.Fatalf("mapped")
+	}
+}
+
+func TestRemoveOverlap(t *testing.T) {
+	m := &Vmregion_t{}
+	want := make([]uint, 32)
+	m.insert(anon(4, 16, rw))
+	for i := 4; i < 20; i++ {
+		want[i] = rw + 1
+	}
+	if m.Unmapsplits(8<<PGSHIFT, 4<<PGSHIFT) != 1 ||
+		m.Unmapsplits(4<<PGSHIFT, 4<<PGSHIFT) != 0 ||
+		m.Unmapsplits(16<<PGSHIFT, 8<<PGSHIFT) != 0 {
+		t.Fatalf("unmapsplits")
+	}
+	// removing the middle splits the mapping, unless there are too many
+	if m.Remove(8<<PGSHIFT, 4<<PGSHIFT, 1) != -defs.ENOMEM {
+		t.Fatalf("split beyond limit")
+	}
+	m = &Vmregion_t{}
+	m.insert(anon(4, 16, rw))
+	if m.Remove(8<<PGSHIFT, 4<<PGSHIFT, 8) != 0 {
+		t.Fatalf("remove")
+	}
+	for i := 8; i < 12; i++ {
+		want[i] = 0
+	}
+	check(t, m, want)
+	// the lowest overlapping mapping is found first
+	n := m._firstin(0, 32)
+	if n == nil || n.vmi.Pgn != 4 {
+		t.Fatalf("firstin")
+	}
+	if n = m._firstin(8, 12); n != nil {
+		t.Fatalf("firstin in hole")
+	}
+	if n = m._firstin(9, 13); n == nil || n.vmi.Pgn != 12 {
+		t.Fatalf("firstin")
+	}
+	// trim the beginning and the end
+	m.Remove(4<<PGSHIFT, 1<<PGSHIFT, 8)
+	m.Remove(19<<PGSHIFT, 1<<PGSHIFT, 8)
+	want[4], want[19] = 0, 0
+	check(t, m, want)
+}
+
+func TestSetperms(t *testing.T) {
+	m := &Vmregion_t{}
+	want := make([]uint, 32)
+	m.insert(anon(4, 16, rw))
+	for i := 4; i < 20; i++ {
+		want[i] = rw + 1
+	}
+	ro := uint(PTE_U)
+	if m.Setperms(8<<PGSHIFT, 4<<PGSHIFT, ro, 2) != -defs.ENOMEM {
+		t.Fatalf("split beyond limit")
+	}
+	check(t, m, want)
+	if m.Setperms(8<<PGSHIFT, 4<<PGSHIFT, ro, 8) != 0 {
+		t.Fatalf("setperms")
+	}
+	for i := 8; i < 12; i++ {
+		want[i] = ro + 1
+	}
+	check(t, m, want)
+	if m.Novma != 3 {
+		t.Fatalf("novma %v", m.Novma)
+	}
+	// restoring the permissions merges the mappings again
+	if m.Setperms(4<<PGSHIFT, 16<<PGSHIFT, rw, 8) != 0 {
+		t.Fatalf("setperms")
+	}
+	for i := 8; i < 12; i++ {
+		want[i] = rw + 1
+	}
+	check(t, m, want)
+	if m.Novma != 1 {
+		t.Fatalf("novma %v", m.Novma)
+	}
+	// an inaccessible guard page below a mapping
+	if m.Setperms(4<<PGSHIFT, 1<<PGSHIFT, 0, 8) != 0 {
+		t.Fatalf("setperms")
+	}
+	want[4] = 1
+	check(t, m, want)
+}
+
+func TestSethuge(t *testing.T) {
+	m := &Vmregion_t{}
+	want := make([]uint, 32)
+	m.insert(anon(4, 16, rw))
+	for i := 4; i < 20; i++ {
+		want[i] = rw + 1
+	}
+	if m.Sethuge(8<<PGSHIFT, 4<<PGSHIFT, false, 8) != 0 {
+		t.Fatalf("sethuge")
+	}
+	check(t, m, want)
+	if m.Novma != 3 {
+		t.Fatalf("novma %v", m.Novma)
+	}
+	vmi, _ := m.Lookup(8 << PGSHIFT)
+	if !vmi.nohuge || vmi.Pgn != 8 || vmi.Pglen != 4 {
+		t.Fatalf("bad mapping %#x %v", vmi.Pgn, vmi.Pglen)
+	}
+	vmi, _ = m.Lookup(4 << PGSHIFT)
+	if vmi.nohuge {
+		t.Fatalf("advice outside the range")
+	}
+	// allowing huge pages again merges the mappings
+	if m.Sethuge(8<<PGSHIFT, 4<<PGSHIFT, true, 8) != 0 {
+		t.Fatalf("sethuge")
+	}
+	check(t, m, want)
+	if m.Novma != 1 {
+		t.Fatalf("novma %v", m.Novma)
+	}
+}
+
+func TestGrowHole(t *testing.T) {
+	m := &Vmregion_t{}
+	want := make([]uint, 64)
+	m.insert(anon(4, 4, rw))
+	for i := 4; i < 8; i++ {
+		want[i] = rw + 1
+	}
+	// prime the cached hole, then grow into it
+	start, _ := m.empty(8<<PGSHIFT, 1<<PGSHIFT)
+	if start != 8<<PGSHIFT {
+		t.Fatalf("hole at %#x", start)
+	}
+	m.grow(8, 4)
+	for i := 8; i < 12; i++ {
+		want[i] = rw + 1
+	}
+	check(t, m, want)
+	start, _ = m.empty(8<<PGSHIFT, 1<<PGSHIFT)
+	if start != 12<<PGSHIFT {
+		t.Fatalf("stale hole at %#x", start)
+	}
+	// a fixed mapping which begins below the cached hole
+	m.Remove(8<<PGSHIFT, 4<<PGSHIFT, 8)
+	for i := 8; i < 12; i++ {
+		want[i] = 0
+	}
+	m.insert(anon(10, 6, uint(PTE_U)))
+	for i := 10; i < 16; i++ {
+		want[i] = uint(PTE_U) + 1
+	}
+	check(t, m, want)
+	start, l := m.empty(13<<PGSHIFT, 1<<PGSHIFT)
+	if start < 16<<PGSHIFT && start+l > 10<<PGSHIFT {
+		t.Fatalf("hole [%#x, %#x) overlaps mapping", start, start+l)
+	}
+}
+
+// randomly maps and unmaps ranges, comparing against a page array
+func TestRandom(t *testing.T) {
+	const npages = 256
+	r := rand.New(rand.NewSource(1))
+	m := &Vmregion_t{}
+	want := make([]uint, npages)
+	for it := 0; it < 5000; it++ {
+		pgn := uintptr(1 + r.Intn(npages-17))
+		pglen := 1 + r.Intn(16)
+		perms := rw
+		if r.Intn(2) == 0 {
+			perms = uint(PTE_U)
+		}
+		switch r.Intn(5) {
+		case 0:
+			if m.Overlaps(int(pgn<<PGSHIFT), pglen<<PGSHIFT) {
+				continue
+			}
+			m.insert(anon(pgn, pglen, perms))
+			for i := 0; i < pglen; i++ {
+				want[int(pgn)+i] = perms + 1
+			}
+		case 1:
+			s, e := pgn, pgn+uintptr(pglen)
+			for n := m._firstin(s, e); n != nil; n = m._firstin(s, e) {
+				ps := n.vmi.Pgn
+				if ps < s {
+					ps = s
+				}
+				pe := n.vmi.Pgn + uintptr(n.vmi.Pglen)
+				if pe > e {
+					pe = e
+				}
+				err := m.Remove(int(ps<<PGSHIFT), int(pe-ps)<<PGSHIFT,
+					1<<20)
+				if err != 0 {
+					t.Fatalf("remove")
+				}
+				s = pe
+			}
+			for i := 0; i < pglen; i++ {
+				want[int(pgn)+i] = 0
+			}
+		case 2:
+			if !m.Mapped(int(pgn<<PGSHIFT), pglen<<PGSHIFT) {
+				continue
+			}
+			if m.Setperms(int(pgn<<PGSHIFT), pglen<<PGSHIFT, perms,
+				1<<20) != 0 {
+				t.Fatalf("setperms")
+			}
+			for i := 0; i < pglen; i++ {
+				want[int(pgn)+i] = perms + 1
+			}
+		case 3:
+			// the cached hole must never contain mapped pages
+			s, l := m.empty(pgn<<PGSHIFT, uintptr(pglen)<<PGSHIFT)
+			if m.Overlaps(int(s), int(l)) {
+				t.Fatalf("hole [%#x, %#x) is mapped", s, s+l)
+			}
+			if s < pgn<<PGSHIFT {
+				s = pgn << PGSHIFT
+			}
+			s >>= PGSHIFT
+			if int(s)+pglen > npages {
+				continue
+			}
+			m.insert(anon(s, pglen, perms))
+			for i := 0; i < pglen; i++ {
+				want[int(s)+i] = perms + 1
+			}
+		case 4:
+			if want[pgn] != 0 || want[pgn-1] == 0 ||
+				m.Overlaps(int(pgn<<PGSHIFT), pglen<<PGSHIFT) {
+				continue
+			}
+			m.grow(pgn, pglen)
+			for i := 0; i < pglen; i++ {
+				want[int(pgn)+i] = want[pgn-1]
+			}
+		}
+		check(t, m, want)
+	}
+}
@@ -0,0 +1,88 @@
+package vm
+
+import "cgroup"
+import "mem"
+
+// the number of pages which an address space maps, by kind of mapping. the
+// counts change along with the page tables, thus the pmap lock protects them.
+type Rss_t struct {
+	// resident pages of private anonymous, file, and shared anonymous
+	// mappings
+	Anon   int
+	File   int
+	Shared int
+	// pages of anonymous mappings which are on swap
+	Swap int
+	// the largest number of resident pages so far
+	Max int
+	// the resource group which the resident pages are charged to
+	Cg *cgroup.Cgroup_t
+}
+
+func (r *Rss_t) Resident() int {
+	return r.Anon + r.File + r.Shared
+}
+
+// returns the largest resident set size in kilobytes
+func (r *Rss_t) Maxkb() int {
+	return r.Max * mem.PGSIZE >> 10
+}
+
+// uncharges the resident pages once the address space is freed
+func (r *Rss_t) Release() {
+	r.Cg.Uncharge(cgroup.PAGES, r.Resident())
+	r.Anon, r.File, r.Shared, r.Swap = 0, 0, 0, 0
+}
+
+// charges the resident pages to cg instead of the current group
+func (r *Rss_t) Setcg(cg *cgroup.Cgroup_t) {
+	r.Cg.Uncharge(cgroup.PAGES, r.Resident())
+	cg.Force(cgroup.PAGES, r.Resident())
+	r.Cg = cg
+}
+
+// adds n, which may be negative, to the resident pages of mapping type mt. the
+// pages are charged to the group even if that exceeds its limit.
+func (r *Rss_t) _add(mt mtype_t, n int) {
+	if n > 0 {
+		r.Cg.Force(cgroup.PAGES, n)
+	} else {
+		r.Cg.Uncharge(cgroup.PAGES, -n)
+	}
+	r._count(mt, n)
+}
+
+// like _add for n > 0, except that it adds nothing and returns false if the
+// group's page limit would be exceeded.
+func (r *Rss_t) _tryadd(mt mtype_t, n int) bool {
+	if !r.Cg.Charge(cgroup.PAGES, n) {
+		return false
+	}
+	r._count(mt, n)
+	return true
+}
+
+func (r *Rss_t) _count(mt mtype_t, n int) {
+	switch mt {
+	case VANON:
+		r.Anon += n
+	case VFILE:
+		r.File += n
+	case VSANON:
+		r.Shared += n
+	default:
+		panic("bad mapping type")
+	}
+	if t := r.Resident(); t > r.Max {
+		r.Max = t
+	}
+}
+
+// returns the type of the mapping which contains va
+func (as *Vm_t) _mtype(va int) mtype_t {
+	vmi, ok := as.Vmregion.Lookup(uintptr(va))
+	if !ok {
+		panic("page outside mappings")
+	}
+	return vmi.Mtype
+}
@@ -0,0 +1,594 @@
+package vm
+
+import "sync"
+import "sync/atomic"
+
+import "cgroup"
+import "defs"
+import "mem"
+import "util"
+
+// a non-present PTE with PTE_SWAP set is a swap entry: the page was paged out
+// and the address bits hold its swap slot. PTE_COW is only meaningful in
+// present PTEs, thus swap entries reuse its bit.
+const PTE_SWAP mem.Pa_t = PTE_COW
+
+func _isswap(pte mem.Pa_t) bool {
+	return pte&(PTE_P|PTE_SWAP) == PTE_SWAP
+}
+
+func _mkswap(slot int) mem.Pa_t {
+	return mem.Pa_t(slot)<<PGSHIFT | PTE_SWAP
+}
+
+func _swapslot(pte mem.Pa_t) int {
+	return int(pte >> PGSHIFT)
+}
+
+// a swap area is a region of a disk or a file divided into page-sized slots.
+type Swapdev_i interface {
+	// the number of slots
+	Slots() int
+	Swapread(slot int, p_pg mem.Pa_t) defs.Err_t
+	Swapwrite(slot int, p_pg mem.Pa_t) defs.Err_t
+	// releases the area once no page is on swap
+	Swapoff()
+}
+
+// the page-out daemon starts when fewer than _swaplow pages are free and pages
+// out until _swaphigh pages are free.
+const _swaplow = 1 << 10
+const _swaphigh = 1 << 11
+
+// the number of victim pages written per TLB shootdown
+const _pobatch = 32
+
+var swap struct {
+	sync.Mutex
+	dev Swapdev_i
+	// the number of swap entries which refer to each slot
+	refs  []int32
+	nfree int
+	// the pages of the slots which are being written or whose writes
+	// failed. swapping in copies them instead of reading the slot.
+	cache map[int]mem.Pa_t
+	// where the search for a free slot starts
+	next int
+	// swapoff is in progress; no more pages are paged out
+	off bool
+	// page faults which ran out of memory ask the daemon to reclaim pages
+	reclaim chan _reclaim_t
+	// calls the function on the address space of every process
+	iter func(func(*Vm_t))
+}
+
+// starts the page-out daemon. iter must call its argument on the address space
+// of every process.
+func Swapd_init(iter func(func(*Vm_t))) {
+	swap.iter = iter
+	swap.reclaim = make(chan _reclaim_t)
+	mem.Physmem.Lowat = _swaplow
+	mem.Physmem.Lowch = make(chan bool, 1)
+	go swapd()
+}
+
+// a request to reclaim pages. the daemon sends on done whether it paged out
+// any pages.
+type _reclaim_t struct {
+	// only pages of processes in this resource group are paged out, or
+	// any pages if nil
+	cg   *cgroup.Cgroup_t
+	done chan bool
+}
+
+func swapd() {
+	for {
+		var req _reclaim_t
+		select {
+		case <-mem.Physmem.Lowch:
+		case req = <-swap.reclaim:
+		}
+		did := true
+		if req.cg == nil {
+			_pageout_all()
+		} else {
+			did = _pageout_group(req.cg) != 0
+		}
+		if req.done != nil {
+			req.done <- did
+		}
+	}
+}
+
+func _swapactive() bool {
+	swap.Lock()
+	ret := swap.dev != nil
+	swap.Unlock()
+	return ret
+}
+
+// asks the page-out daemon to page out cold pages and waits until it is done.
+// returns false if there is no swap area.
+func Reclaim() bool {
+	if swap.reclaim == nil || !_swapactive() {
+		return false
+	}
+	done := make(chan bool)
+	swap.reclaim <- _reclaim_t{done: done}
+	<-done
+	return true
+}
+
+// asks the page-out daemon to page out pages of the processes in the resource
+// group cg until it is below its page limit, and waits until it is done.
+// returns false if no page was paged out.
+func Reclaimgroup(cg *cgroup.Cgroup_t) bool {
+	if swap.reclaim == nil || !_swapactive() {
+		return false
+	}
+	done := make(chan bool)
+	swap.reclaim <- _reclaim_t{cg: cg, done: done}
+	return <-done
+}
+
+// pages out enough pages of the processes in cg to leave a batch of pages
+// below its page limit. returns the number of pages paged out.
+func _pageout_group(cg *cgroup.Cgroup_t) int {
+	lim := cg.Limit(cgroup.PAGES)
+	if lim == cgroup.Unlimited {
+		return 0
+	}
+	want := cg.Usage(cgroup.PAGES) - lim + _pobatch
+	did := 0
+	// the first pass may only clear accessed bits
+	for pass := 0; pass < 2 && did < want && _swapactive(); pass++ {
+		swap.iter(func(as *Vm_t) {
+			if did >= want {
+				return
+			}
+			as.Lock_pmap()
+			if as.Rss.Cg.Within(cg) {
+				did += as.pageout(want - did)
+			}
+			as.Unlock_pmap()
+		})
+	}
+	return did
+}
+
+func _pageout_all() {
+	// the first pass may only clear accessed bits
+	for pass := 0; pass < 2; pass++ {
+		want := _swaphigh - mem.Physmem.Freecount()
+		if want <= 0 || !_swapactive() {
+			return
+		}
+		did := 0
+		swap.iter(func(as *Vm_t) {
+			if did >= want {
+				return
+			}
+			as.Lock_pmap()
+			did += as.pageout(want - did)
+			as.Unlock_pmap()
+		})
+	}
+}
+
+func _slotalloc() (int, bool) {
+	swap.Lock()
+	defer swap.Unlock()
+	if swap.dev == nil || swap.off || swap.nfree == 0 {
+		return 0, false
+	}
+	for i := range swap.refs {
+		s := (swap.next + i) % len(swap.refs)
+		if swap.refs[s] == 0 {
+			swap.refs[s] = 1
+			swap.nfree--
+			swap.next = s + 1
+			return s, true
+		}
+	}
+	panic("nfree is wrong")
+}
+
+func _slotdup(slot int) {
+	swap.Lock()
+	swap.refs[slot]++
+	swap.Unlock()
+}
+
+func _slotdrop(slot int) {
+	var cached mem.Pa_t
+	swap.Lock()
+	swap.refs[slot]--
+	if swap.refs[slot] < 0 {
+		panic("negative slot ref")
+	}
+	if swap.refs[slot] == 0 {
+		swap.nfree++
+		if p_pg, ok := swap.cache[slot]; ok {
+			delete(swap.cache, slot)
+			cached = p_pg
+		}
+	}
+	swap.Unlock()
+	if cached != 0 {
+		mem.Physmem.Refdown(cached)
+	}
+}
+
+// reads the page of the swap entry pte into a new page. the entry keeps its
+// reference to the slot.
+func _swapin(pte mem.Pa_t) (mem.Pa_t, defs.Err_t) {
+	slot := _swapslot(pte)
+	_, p_pg, ok := mem.Physmem.Refpg_new_nozero()
+	if !ok {
+		return 0, -defs.ENOMEM
+	}
+	swap.Lock()
+	dev := swap.dev
+	if c, ok := swap.cache[slot]; ok {
+		*mem.Physmem.Dmap(p_pg) = *mem.Physmem.Dmap(c)
+		swap.Unlock()
+		return p_pg, 0
+	}
+	swap.Unlock()
+	if err := dev.Swapread(slot, p_pg); err != 0 {
+		_pgfree(p_pg)
+		return 0, err
+	}
+	return p_pg, 0
+}
+
+// frees a new page which nothing maps
+func _pgfree(p_pg mem.Pa_t) {
+	mem.Physmem.Refup(p_pg)
+	mem.Physmem.Refdown(p_pg)
+}
+
+// replaces the swap entry pte of vmi's page at va with the swapped-in page. the
+// page is a fresh copy even if other processes still refer to the slot, thus
+// it is mapped writable if vmi is. the page is read with the pmap lock held.
+func (as *Vm_t) _pgswapin(vmi *Vminfo_t, pte *mem.Pa_t, va uintptr) defs.Err_t {
+	p_pg, err := _swapin(*pte)
+	if err != 0 {
+		return err
+	}
+	return as._pgswapmap(vmi, pte, va, p_pg)
+}
+
+// swaps in the page at va if it is on swap and returns true. the pmap lock is
+// dropped while the page is read, thus the caller must look up the mapping
+// again afterwards.
+func (as *Vm_t) _swapinva(va uintptr) (bool, defs.Err_t) {
+	as.Lockassert_pmap()
+	if as.freed || _hugepde(as.Pmap, int(va)) != nil {
+		return false, 0
+	}
+	pte := Pmap_lookup(as.Pmap, int(va))
+	if pte == nil || !_isswap(*pte) {
+		return false, 0
+	}
+	ent := *pte
+	// the reference keeps the slot from being reused while it is read
+	slot := _swapslot(ent)
+	_slotdup(slot)
+	defer _slotdrop(slot)
+	as.Unlock_pmap()
+	p_pg, err := _swapin(ent)
+	as.Lock_pmap()
+	if err != 0 {
+		return true, err
+	}
+	// the page tables stay until the address space is freed, but the page
+	// may have been swapped in or unmapped meanwhile
+	vmi, ok := as.Vmregion.Lookup(va)
+	if as.freed || !ok || *pte != ent {
+		_pgfree(p_pg)
+		return true, 0
+	}
+	if err := as._pgswapmap(vmi, pte, va, p_pg); err != 0 {
+		return true, err
+	}
+	if vmi.locked {
+		as._mlockpg(pte)
+	}
+	return true, 0
+}
+
+// maps the swapped-in page p_pg in place of the swap entry pte
+func (as *Vm_t) _pgswapmap(vmi *Vminfo_t, pte *mem.Pa_t, va uintptr,
+	p_pg mem.Pa_t) defs.Err_t {
+	slot := _swapslot(*pte)
+	perms := PTE_U | PTE_A | vmi._nx()
+	if vmi.Perms&uint(PTE_W) != 0 {
+		perms |= PTE_W | PTE_WASCOW | PTE_D
+	}
+	if vmi.Perms == 0 {
+		perms = (perms &^ PTE_U) | PTE_PROTNONE
+	}
+	// the swap entry stays if the resource group is out of pages
+	if _, ok := as.Page_insert(int(va), p_pg, perms, true, pte); !ok {
+		mem.Physmem.Refdown(p_pg)
+		return -defs.ENOMEM
+	}
+	_slotdrop(slot)
+	as.Rss.Swap--
+	return 0
+}
+
+// returns the lowest address in [start, end) whose page is on swap
+func (as *Vm_t) _swapscan(start, end int) (int, bool) {
+	for va := start; va < end; {
+		// huge pages are not paged out and have no swap entries
+		if _hugepde(as.Pmap, va) != nil {
+			va = util.Rounddown(va, mem.HUGESIZE) + mem.HUGESIZE
+			continue
+		}
+		pt, slot := pmap_pgtbl(as.Pmap, va, false, 0)
+		if pt == nil {
+			va += 1 << 21
+			va &^= (1 << 21) - 1
+			continue
+		}
+		for ; slot < len(pt) && va < end; slot, va = slot+1, va+mem.PGSIZE {
+			if _isswap(pt[slot]) {
+				return va, true
+			}
+		}
+	}
+	return 0, false
+}
+
+// swaps in every page of vmi that is on swap. the pages are read with the pmap
+// lock held since fork must not let the mappings change.
+func (as *Vm_t) Unswap(vmi *Vminfo_t) defs.Err_t {
+	as.Lockassert_pmap()
+	if !_swapactive() {
+		return 0
+	}
+	start := int(vmi.Pgn << PGSHIFT)
+	end := start + vmi.Pglen<<PGSHIFT
+	for va, ok := as._swapscan(start, end); ok; va, ok = as._swapscan(va, end) {
+		pte := Pmap_lookup(as.Pmap, va)
+		if err := as._pgswapin(vmi, pte, uintptr(va)); err != 0 {
+			return err
+		}
+	}
+	return 0
+}
+
+// swaps in every page of the anonymous mappings that is on swap. the pmap lock
+// is dropped while each page is read.
+func (as *Vm_t) _unswapall() defs.Err_t {
+	as.Lock_pmap()
+	defer as.Unlock_pmap()
+	for pgn := uintptr(0); !as.freed; {
+		n := as.Vmregion._firstin(pgn, ^uintptr(0))
+		if n == nil {
+			return 0
+		}
+		vmi := &n.vmi
+		if pgn < vmi.Pgn {
+			pgn = vmi.Pgn
+		}
+		end := vmi.Pgn + uintptr(vmi.Pglen)
+		if vmi.Mtype != VANON && vmi.Mtype != VSANON {
+			pgn = end
+			continue
+		}
+		va, ok := as._swapscan(int(pgn<<PGSHIFT), int(end<<PGSHIFT))
+		if !ok {
+			pgn = end
+			continue
+		}
+		if _, err := as._swapinva(uintptr(va)); err != 0 {
+			return err
+		}
+		pgn = uintptr(va) >> PGSHIFT
+	}
+	return 0
+}
+
+type _povic_t struct {
+	pte *mem.Pa_t
+	old mem.Pa_t
+}
+
+// pages out up to want cold pages of anonymous mappings and returns the number
+// of pages paged out. a page is cold if its accessed bit is clear; the
+// accessed bits of the other pages are cleared so that they are paged out by a
+// later scan unless they are used again. only pages mapped by exactly one PTE
+// are paged out; shared anonymous pages mapped by several processes and the
+// pages of locked mappings stay resident. the pmap lock is dropped while pages
+// are written.
+func (as *Vm_t) pageout(want int) int {
+	as.Lockassert_pmap()
+	did := 0
+	for pgn := uintptr(0); did < want && !as.freed; {
+		n := as.Vmregion._firstin(pgn, ^uintptr(0))
+		if n == nil {
+			break
+		}
+		vmi := &n.vmi
+		if pgn < vmi.Pgn {
+			pgn = vmi.Pgn
+		}
+		end := vmi.Pgn + uintptr(vmi.Pglen)
+		if vmi.Perms == 0 || vmi.locked ||
+			(vmi.Mtype != VANON && vmi.Mtype != VSANON) {
+			pgn = end
+			continue
+		}
+		d, next := as._pageoutvmi(vmi, int(pgn<<PGSHIFT),
+			int(end<<PGSHIFT), want-did)
+		did += d
+		pgn = uintptr(next) >> PGSHIFT
+	}
+	return did
+}
+
+// pages out cold pages of vmi in [start, end) until want pages or a batch of
+// victims are paged out. returns the number of pages paged out and the address
+// where the scan stopped. the caller must look up vmi again afterwards.
+func (as *Vm_t) _pageoutvmi(vmi *Vminfo_t, start, end, want int) (int, int) {
+	var vics [_pobatch]_povic_t
+	nvic := 0
+	flush := false
+	va := start
+	for va < end && nvic < want {
+		// huge pages are not paged out and have no swap entries
+		if _hugepde(as.Pmap, va) != nil {
+			va = util.Rounddown(va, mem.HUGESIZE) + mem.HUGESIZE
+			continue
+		}
+		pt, slot := pmap_pgtbl(as.Pmap, va, false, 0)
+		if pt == nil {
+			va += 1 << 21
+			va &^= (1 << 21) - 1
+			continue
+		}
+		for ; slot < len(pt) && va < end; slot, va = slot+1, va+mem.PGSIZE {
+			if nvic >= want {
+				break
+			}
+			pte := &pt[slot]
+			if *pte&PTE_P == 0 {
+				continue
+			}
+			if *pte&PTE_A != 0 {
+				*pte &^= PTE_A
+				flush = true
+				continue
+			}
+			phys := *pte & PTE_ADDR
+			ref, _ := mem.Physmem.Refaddr(phys)
+			if phys == mem.P_zeropg || atomic.LoadInt32(ref) != 1 {
+				continue
+			}
+			s, ok := _slotalloc()
+			if !ok {
+				// no slot is free
+				va = end
+				break
+			}
+			vics[nvic] = _povic_t{pte, *pte}
+			*pte = _mkswap(s)
+			as.Rss._add(vmi.Mtype, -1)
+			as.Rss.Swap++
+			nvic++
+			if nvic == len(vics) {
+				va += mem.PGSIZE
+				return as._pageoutflush(vics[:], start, va), va
+			}
+		}
+	}
+	if nvic != 0 || flush {
+		return as._pageoutflush(vics[:nvic], start, va), va
+	}
+	return 0, va
+}
+
+// writes the victims in [start, end), whose PTEs are already swap entries, to
+// swap once no TLB maps them and frees their pages. the pmap lock is dropped
+// while the victims are written; meanwhile the swap cache holds their pages so
+// that they can be swapped in, and their slots keep an extra reference so that
+// they are not reused. a page whose write fails stays in the swap cache.
+func (as *Vm_t) _pageoutflush(vics []_povic_t, start, end int) int {
+	as.Tlbshoot(uintptr(start), (end-start)>>PGSHIFT)
+	if len(vics) == 0 {
+		return 0
+	}
+	var slots [_pobatch]int
+	swap.Lock()
+	dev := swap.dev
+	for i, v := range vics {
+		slots[i] = _swapslot(*v.pte)
+		swap.cache[slots[i]] = v.old & PTE_ADDR
+		swap.refs[slots[i]]++
+	}
+	swap.Unlock()
+	as.Unlock_pmap()
+	var failed [_pobatch]bool
+	for i, v := range vics {
+		failed[i] = dev.Swapwrite(slots[i], v.old&PTE_ADDR) != 0
+	}
+	as.Lock_pmap()
+	did := 0
+	for i, v := range vics {
+		if !failed[i] {
+			swap.Lock()
+			delete(swap.cache, slots[i])
+			swap.Unlock()
+			mem.Physmem.Refdown(v.old & PTE_ADDR)
+			did++
+		}
+		_slotdrop(slots[i])
+	}
+	return did
+}
+
+// starts paging to dev. only one swap area may be in use at a time.
+func Swapon(dev Swapdev_i) defs.Err_t {
+	n := dev.Slots()
+	if n <= 0 {
+		return -defs.EINVAL
+	}
+	swap.Lock()
+	defer swap.Unlock()
+	if swap.dev != nil {
+		return -defs.EBUSY
+	}
+	swap.dev = dev
+	swap.refs = make([]int32, n)
+	swap.cache = make(map[int]mem.Pa_t)
+	swap.nfree = n
+	swap.next = 0
+	swap.off = false
+	return 0
+}
+
+// stops paging out, swaps in every page on swap, and releases the swap area.
+// if memory runs out first, the swap area stays in use and the error is
+// returned.
+func Swapoff() defs.Err_t {
+	swap.Lock()
+	if swap.dev == nil || swap.off {
+		swap.Unlock()
+		return -defs.EINVAL
+	}
+	swap.off = true
+	swap.Unlock()
+	// processes may fork swap entries to new processes while we scan,
+	// thus scan until no slot is in use.
+	for try := 0; ; try++ {
+		var err defs.Err_t
+		swap.iter(func(as *Vm_t) {
+			if err == 0 {
+				err = as._unswapall()
+			}
+		})
+		swap.Lock()
+		if err == 0 && swap.nfree == len(swap.refs) {
+			dev := swap.dev
+			swap.dev = nil
+			swap.refs = nil
+			swap.cache = nil
+			swap.off = false
+			swap.Unlock()
+			dev.Swapoff()
+			return 0
+		}
+		if err != 0 || try == 3 {
+			swap.off = false
+			swap.Unlock()
+			if err == 0 {
+				err = -defs.EBUSY
+			}
+			return err
+		}
+		swap.Unlock()
+	}
+}
@@ -0,0 +1,316 @@
+package vm
+
+import "sync"
+
+import "defs"
+import "fdops"
+import "mem"
+import "tinfo"
+import "util"
+
+// user-level page fault handling: a process registers ranges of its private
+// anonymous mappings with a userfaultfd. the kernel does not handle a fault on
+// a page of a registered range which has no page; instead the faulting thread
+// blocks until a handler, which reads the fault from the userfaultfd, maps the
+// page with Copy or Zeropage, or wakes the thread. kernel accesses to such
+// pages fail with EFAULT. once the userfaultfd is closed, faults on registered
+// ranges are handled as usual. registered ranges never use huge pages.
+type Uffd_t struct {
+	sync.Mutex
+	// the address space whose faults the userfaultfd receives
+	as *Vm_t
+	// the faults which were not read yet, oldest first
+	queue []*_uffault_t
+	// the faults which threads wait on by page address
+	faults map[uintptr]*_uffault_t
+	// receives a value when a fault is queued
+	ready   chan bool
+	pollers fdops.Pollers_t
+	closed  bool
+}
+
+// a fault on a missing page of a registered range
+type _uffault_t struct {
+	// the page address
+	va    uintptr
+	write bool
+	tid   defs.Tid_t
+	// closed once the faulting threads may retry
+	done chan bool
+}
+
+func Mkuffd(as *Vm_t) *Uffd_t {
+	return &Uffd_t{as: as, faults: make(map[uintptr]*_uffault_t),
+		ready: make(chan bool, 1)}
+}
+
+// the size of a message read from a userfaultfd
+const UFFD_MSGSZ = 32
+
+func (f *_uffault_t) _msg() []uint8 {
+	msg := make([]uint8, UFFD_MSGSZ)
+	msg[0] = defs.UFFD_EVENT_PAGEFAULT
+	flags := 0
+	if f.write {
+		flags |= defs.UFFD_PAGEFAULT_FLAG_WRITE
+	}
+	util.Writen(msg, 8, 8, flags)
+	util.Writen(msg, 8, 16, int(f.va))
+	util.Writen(msg, 4, 24, int(f.tid))
+	return msg
+}
+
+// waits until the handler resolved the fault or the thread was killed
+func (f *_uffault_t) _wait() defs.Err_t {
+	kn := &tinfo.Current().Killnaps
+	select {
+	case <-f.done:
+		return 0
+	case <-kn.Killch:
+		if kn.Kerr == 0 {
+			panic("eh?")
+		}
+		return kn.Kerr
+	}
+}
+
+// returns true if the page at va of vmi, which is registered with a
+// userfaultfd which is still open, has neither a page nor a swap entry.
+func (as *Vm_t) _uffdmissing(vmi *Vminfo_t, va uintptr) bool {
+	u := vmi.uffd
+	if u == nil {
+		return false
+	}
+	u.Lock()
+	closed := u.closed
+	u.Unlock()
+	if closed || _hugepde(as.Pmap, int(va)) != nil {
+		return false
+	}
+	pte := Pmap_lookup(as.Pmap, int(va))
+	return pte == nil || *pte == 0
+}
+
+// queues a fault on the page at va of vmi if the userfaultfd of vmi must
+// handle it, unless a thread already waits on that page. returns nil if the
+// kernel must handle the fault.
+func (as *Vm_t) _uffdfault(vmi *Vminfo_t, va, ecode uintptr,
+	tid defs.Tid_t) *_uffault_t {
+	as.Lockassert_pmap()
+	if !as._uffdmissing(vmi, va) {
+		return nil
+	}
+	u := vmi.uffd
+	va &^= uintptr(PGOFFSET)
+	u.Lock()
+	defer u.Unlock()
+	if u.closed {
+		return nil
+	}
+	if f, ok := u.faults[va]; ok {
+		return f
+	}
+	f := &_uffault_t{va: va, write: ecode&uintptr(PTE_W) != 0, tid: tid,
+		done: make(chan bool)}
+	u.faults[va] = f
+	u.queue = append(u.queue, f)
+	select {
+	case u.ready <- true:
+	default:
+	}
+	u.pollers.Wakeready(fdops.R_READ)
+	return f
+}
+
+// copies as many queued faults as fit in dst, which must have room for at
+// least one, as messages. blocks until a fault is queued unless noblk is true.
+func (u *Uffd_t) Read(dst fdops.Userio_i, noblk bool) (int, defs.Err_t) {
+	if dst.Remain() < UFFD_MSGSZ {
+		return 0, -defs.EINVAL
+	}
+	for {
+		u.Lock()
+		if len(u.queue) != 0 {
+			break
+		}
+		u.Unlock()
+		if noblk {
+			return 0, -defs.EAGAIN
+		}
+		kn := &tinfo.Current().Killnaps
+		select {
+		case <-u.ready:
+		case <-kn.Killch:
+			if kn.Kerr == 0 {
+				panic("eh?")
+			}
+			return 0, kn.Kerr
+		}
+	}
+	n := dst.Remain() / UFFD_MSGSZ
+	if n > len(u.queue) {
+		n = len(u.queue)
+	}
+	fs := u.queue[:n]
+	u.queue = u.queue[n:]
+	// let another reader take the rest
+	if len(u.queue) != 0 {
+		select {
+		case u.ready <- true:
+		default:
+		}
+	}
+	u.Unlock()
+	// the buffer may be on a registered page, thus u must not be locked
+	for i, f := range fs {
+		if _, err := dst.Uiowrite(f._msg()); err != 0 {
+			// requeue the faults which were not read
+			u.Lock()
+			u.queue = append(fs[i:len(fs):len(fs)], u.queue...)
+			u.Unlock()
+			return i * UFFD_MSGSZ, err
+		}
+	}
+	return n * UFFD_MSGSZ, 0
+}
+
+func (u *Uffd_t) Pollone(pm fdops.Pollmsg_t) (fdops.Ready_t, defs.Err_t) {
+	u.Lock()
+	defer u.Unlock()
+	if len(u.queue) != 0 {
+		return pm.Events & fdops.R_READ, 0
+	}
+	if pm.Events&fdops.R_READ == 0 || !pm.Dowait {
+		return 0, 0
+	}
+	return 0, u.pollers.Addpoller(&pm)
+}
+
+// lets the threads which wait on the pages in [start, start+len) retry their
+// faults.
+func (u *Uffd_t) Wake(start, len int) {
+	u.Lock()
+	defer u.Unlock()
+	s, e := uintptr(start), uintptr(start+len)
+	for va, f := range u.faults {
+		if va >= s && va < e {
+			close(f.done)
+			delete(u.faults, va)
+		}
+	}
+	n := 0
+	for _, f := range u.queue {
+		if f.va < s || f.va >= e {
+			u.queue[n] = f
+			n++
+		}
+	}
+	u.queue = u.queue[:n]
+}
+
+// wakes every waiting thread; the kernel handles the following faults on the
+// registered ranges.
+func (u *Uffd_t) Close() {
+	u.Lock()
+	u.closed = true
+	u.Unlock()
+	u.Wake(0, mem.USERMAX)
+}
+
+// maps p_pg, a fresh page with no references, at the missing page va of a
+// range registered with u. the page is freed if it cannot be mapped.
+func (u *Uffd_t) Copy(va int, p_pg mem.Pa_t) defs.Err_t {
+	return u._map(va, p_pg, false)
+}
+
+// maps the zero page at the missing page va of a range registered with u
+func (u *Uffd_t) Zeropage(va int) defs.Err_t {
+	return u._map(va, mem.P_zeropg, true)
+}
+
+func (u *Uffd_t) _map(va int, p_pg mem.Pa_t, zero bool) defs.Err_t {
+	mem.Physmem.Refup(p_pg)
+	defer mem.Physmem.Refdown(p_pg)
+	as := u.as
+	as.Lock_pmap()
+	defer as.Unlock_pmap()
+	if as.freed {
+		return -defs.ESRCH
+	}
+	vmi, ok := as.Vmregion.Lookup(uintptr(va))
+	if !ok || vmi.uffd != u {
+		return -defs.ENOENT
+	}
+	pte, ok := as.Ptefor(vmi, uintptr(va))
+	if !ok {
+		return -defs.ENOMEM
+	}
+	if *pte != 0 {
+		return -defs.EEXIST
+	}
+	perms := PTE_U | PTE_A | vmi._nx()
+	if vmi.Perms&uint(PTE_W) != 0 {
+		if zero {
+			perms |= PTE_COW
+		} else {
+			perms |= PTE_W | PTE_WASCOW | PTE_D
+		}
+	}
+	if vmi.Perms == 0 {
+		perms = (perms &^ PTE_U) | PTE_PROTNONE
+	}
+	if _, ok := as.Page_insert(va, p_pg, perms, true, pte); !ok {
+		// drop the reference Page_insert took
+		mem.Physmem.Refdown(p_pg)
+		return -defs.ENOMEM
+	}
+	if vmi.locked {
+		as._mlockpg(pte)
+	}
+	return 0
+}
+
+// registers [start, start+len), which must be mapped by private anonymous
+// mappings which are not registered with another userfaultfd, with u. u must
+// have been made for as.
+func (as *Vm_t) Uffd_register(start, len int, u *Uffd_t,
+	novma uint) defs.Err_t {
+	as.Lockassert_pmap()
+	if u.as != as {
+		return -defs.EINVAL
+	}
+	var err defs.Err_t
+	as._eachvmi(start, start+len, func(vmi *Vminfo_t, s, e int) {
+		if vmi.Mtype != VANON {
+			err = -defs.EINVAL
+		} else if vmi.uffd != nil && vmi.uffd != u && err == 0 {
+			err = -defs.EBUSY
+		}
+	})
+	if err != 0 {
+		return err
+	}
+	if !as._unhugeends(start, len) {
+		return -defs.ENOMEM
+	}
+	return as.Vmregion.Setuffd(start, len, u, novma)
+}
+
+// unregisters [start, start+len), which must be mapped, and wakes the threads
+// which wait on its pages.
+func (as *Vm_t) Uffd_unregister(start, len int, novma uint) defs.Err_t {
+	as.Lockassert_pmap()
+	var us []*Uffd_t
+	as._eachvmi(start, start+len, func(vmi *Vminfo_t, s, e int) {
+		if vmi.uffd != nil {
+			us = append(us, vmi.uffd)
+		}
+	})
+	if err := as.Vmregion.Setuffd(start, len, nil, novma); err != 0 {
+		return err
+	}
+	for _, u := range us {
+		u.Wake(start, len)
+	}
+	return 0
+}
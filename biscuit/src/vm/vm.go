@@ -1,6 +1,8 @@
 package vm
 
 import "fmt"
+import "runtime"
+import "sync/atomic"
 
 import "defs"
 import "fdops"
@@ -22,14 +24,22 @@ const PTE_PS mem.Pa_t = 1 << 7
 const PTE_COW mem.Pa_t = 1 << 9
 const PTE_WASCOW mem.Pa_t = 1 << 10
 
+// marks a present page whose mapping was made inaccessible by mprotect; PTE_U
+// is clear so that user accesses fault, but the page is still owned by the
+// mapping.
+const PTE_PROTNONE mem.Pa_t = 1 << 11
+
+// execute-disable; honored only once the runtime has enabled EFER.NXE
+const PTE_NX mem.Pa_t = 1 << 63
+
 const PGSIZEW uintptr = uintptr(mem.PGSIZE)
 const PGSHIFT uint = 12
 const PGOFFSET mem.Pa_t = 0xfff
 const PGMASK mem.Pa_t = ^(PGOFFSET)
 const IPGMASK int = ^(int(PGOFFSET))
-const PTE_ADDR mem.Pa_t = PGMASK
+const PTE_ADDR mem.Pa_t = PGMASK &^ PTE_NX
 const PTE_FLAGS mem.Pa_t = (PTE_P | PTE_W | PTE_U | PTE_PCD | PTE_PS | PTE_COW |
-	PTE_WASCOW)
+	PTE_WASCOW | PTE_PROTNONE | PTE_NX)
 
 type mtype_t uint
 
@@ -42,11 +52,23 @@ const (
 	VSANON mtype_t = 1 << iota
 )
 
+// the block cache whose pages shared file mappings map
+type Pagecache_i interface {
+	Unpin(mem.Pa_t)
+	// journals the blocks which the pinned pages cache
+	Pgsync([]mem.Pa_t) defs.Err_t
+	// writes the blocks which the pinned pages cache to disk
+	Pgflush([]mem.Pa_t) defs.Err_t
+}
+
 type Mfile_t struct {
-	mfops fdops.Fdops_i
-	unpin mem.Unpin_i
+	mfops  fdops.Fdops_i
+	pcache Pagecache_i
 	// once mapcount is 0, close mfops
 	mapcount int
+	// the file was not opened for writing, thus a shared mapping of it
+	// can never become writable
+	rdonly bool
 }
 
 type Vminfo_t struct {
@@ -54,7 +76,22 @@ type Vminfo_t struct {
 	Pgn   uintptr
 	Pglen int
 	Perms uint
-	file  struct {
+	// madvise(MADV_NOHUGEPAGE) forbids huge pages in an anonymous mapping
+	nohuge bool
+	// the readahead hint of a file mapping
+	ra Ra_t
+	// madvise(MADV_MERGEABLE) lets the merging daemon merge the pages of
+	// a private anonymous mapping with identical pages
+	merge bool
+	// the userfaultfd which handles the faults on missing pages of a
+	// private anonymous mapping
+	uffd *Uffd_t
+	// mlock(2) keeps the pages of the mapping resident
+	locked bool
+	// the pages of a stack are not executable unless the ELF's
+	// PT_GNU_STACK asks for an executable stack
+	noexec bool
+	file   struct {
 		foff   int
 		mfile  *Mfile_t
 		shared bool
@@ -66,7 +103,11 @@ type Vmregion_t struct {
 	rb     Rbh_t
 	_pglen int
 	Novma  uint
-	hole   struct {
+	// nonzero if a mapping may be mergeable. Setmerge sets it and the
+	// merging daemon, which reads it without the lock, clears it when it
+	// finds no mergeable mapping.
+	mergeable int32
+	hole      struct {
 		startn uintptr
 		pglen  uintptr
 	}
@@ -86,19 +127,39 @@ func (vmi *Vminfo_t) Filepage(va uintptr) (*mem.Pg_t, mem.Pa_t, defs.Err_t) {
 	return mmapi[0].Pg, mmapi[0].Phys, 0
 }
 
+// returns the file operations of a file mapping and the file offset at which
+// the mapping starts
+func (vmi *Vminfo_t) Filemap() (fdops.Fdops_i, int, bool) {
+	if vmi.Mtype != VFILE {
+		return nil, 0, false
+	}
+	return vmi.file.mfile.mfops, vmi.file.foff, true
+}
+
+// returns PTE_NX if the pages of the mapping must not be executable.
+func (vmi *Vminfo_t) _nx() mem.Pa_t {
+	if vmi.noexec && runtime.Nxe {
+		return PTE_NX
+	}
+	return 0
+}
+
+// returns the PTE for va, which a huge page must not map. the page table of
+// the mapping's first page is cached, unless a huge page maps that page; the
+// cache never extends past the first page's 2MB chunk.
 func (vmi *Vminfo_t) Ptefor(pmap *mem.Pmap_t, va uintptr) (*mem.Pa_t, bool) {
-	if vmi.pch == nil {
-		bva := int(vmi.Pgn) << PGSHIFT
+	vn := (va >> PGSHIFT) - vmi.Pgn
+	if vn >= uintptr(vmi.Pglen) {
+		panic("uh oh")
+	}
+	if bva := int(vmi.Pgn) << PGSHIFT; vmi.pch == nil &&
+		_hugepde(pmap, bva) == nil {
 		ptbl, slot := pmap_pgtbl(pmap, bva, true, PTE_U|PTE_W)
 		if ptbl == nil {
 			return nil, false
 		}
 		vmi.pch = ptbl[slot:]
 	}
-	vn := (va >> PGSHIFT) - vmi.Pgn
-	if vn >= uintptr(vmi.Pglen) {
-		panic("uh oh")
-	}
 	if vn < uintptr(len(vmi.pch)) {
 		return &vmi.pch[vn], true
 	} else {
@@ -119,11 +180,14 @@ func (m *Vmregion_t) _canmerge(a, b *Vminfo_t) bool {
 	if a.Mtype != b.Mtype {
 		return false
 	}
-	if a.Perms != b.Perms {
+	if a.Perms != b.Perms || a.nohuge != b.nohuge || a.ra != b.ra ||
+		a.merge != b.merge || a.uffd != b.uffd || a.locked != b.locked ||
+		a.noexec != b.noexec {
 		return false
 	}
 	if a.Mtype == VFILE {
-		if a.file.shared != b.file.shared {
+		if a.file.shared != b.file.shared ||
+			a.file.mfile.rdonly != b.file.mfile.rdonly {
 			return false
 		}
 		if a.file.mfile.mfops.Pathi() != b.file.mfile.mfops.Pathi() {
@@ -168,6 +232,7 @@ func (m *Vmregion_t) _trymerge(nn *Rbn_t, larger bool) {
 		if m._canmerge(&nn.vmi, &n.vmi) {
 			m._merge(&nn.vmi, &n.vmi)
 			m.rb.remove(n)
+			m.Novma--
 			return
 		}
 		if larger {
@@ -197,14 +262,7 @@ func (m *Vmregion_t) insert(vmi *Vminfo_t) {
 		}
 		vmi.file.mfile.mfops.Reopen()
 	}
-	// adjust the cached hole
-	if vmi.Pgn == m.hole.startn {
-		m.hole.startn += uintptr(vmi.Pglen)
-		m.hole.pglen -= uintptr(vmi.Pglen)
-	} else if vmi.Pgn >= m.hole.startn &&
-		vmi.Pgn < m.hole.startn+m.hole.pglen {
-		m.hole.pglen = vmi.Pgn - m.hole.startn
-	}
+	m._holeuse(vmi.Pgn, uintptr(vmi.Pglen))
 	m._pglen += vmi.Pglen
 	var par *Rbn_t
 	for n := m.rb.root; n != nil; {
@@ -247,6 +305,26 @@ func (m *Vmregion_t) insert(vmi *Vminfo_t) {
 	m.rb._balance(nn)
 }
 
+// shrinks the cached hole so that it excludes [pgn, pgn+pglen), which is
+// about to be mapped. the new mapping may begin before the hole if it was
+// placed with MAP_FIXED.
+func (m *Vmregion_t) _holeuse(pgn, pglen uintptr) {
+	hend := m.hole.startn + m.hole.pglen
+	end := pgn + pglen
+	if end <= m.hole.startn || pgn >= hend {
+		return
+	}
+	if pgn > m.hole.startn {
+		m.hole.pglen = pgn - m.hole.startn
+	} else if end < hend {
+		m.hole.startn = end
+		m.hole.pglen = hend - end
+	} else {
+		m.hole.startn = hend
+		m.hole.pglen = 0
+	}
+}
+
 func (m *Vmregion_t) _clear(vmi *Vminfo_t, pglen int) {
 	// decrement mapcounts, close file if necessary
 	if vmi.Mtype != VFILE {
@@ -286,6 +364,10 @@ func (m *Vmregion_t) _copy1(par, src *Rbn_t) *Rbn_t {
 	ret := &Rbn_t{}
 	*ret = *src
 	ret.vmi.pch = nil
+	// the child's faults are handled by the kernel
+	ret.vmi.uffd = nil
+	// locks are not inherited
+	ret.vmi.locked = false
 	// create per-process mfile objects and increase opencount for file
 	// mappings
 	if ret.vmi.Mtype == VFILE {
@@ -303,6 +385,7 @@ func (m *Vmregion_t) _copy1(par, src *Rbn_t) *Rbn_t {
 func (m *Vmregion_t) Copy() Vmregion_t {
 	var ret Vmregion_t
 	ret._pglen, ret.Novma = m._pglen, m.Novma
+	ret.mergeable = m.mergeable
 	ret.rb.root = m._copy1(nil, m.rb.root)
 	return ret
 }
@@ -370,33 +453,30 @@ func (m *Vmregion_t) Pglen() int {
 	return m._pglen
 }
 
+// returns the first hole of at least minlen pages which starts at or after
+// minpgn. the hole may begin at minpgn itself, which matters for randomized
+// hints that usually point into the middle of unused space.
 func (m *Vmregion_t) _findhole(minpgn, minlen uintptr) (uintptr, uintptr) {
-	var startn uintptr
+	startn := minpgn
 	var pglen uintptr
 	var done bool
 	m.Iter(func(vmi *Vminfo_t) {
 		if done {
 			return
 		}
-		if startn == 0 {
-			t := vmi.Pgn + uintptr(vmi.Pglen)
-			if t >= minpgn {
-				startn = t
-			}
+		end := vmi.Pgn + uintptr(vmi.Pglen)
+		if end <= startn {
+			return
+		}
+		if vmi.Pgn > startn && vmi.Pgn-startn >= minlen {
+			pglen = vmi.Pgn - startn
+			done = true
 		} else {
-			if vmi.Pgn-startn >= minlen {
-				pglen = vmi.Pgn - startn
-				done = true
-			} else {
-				startn = vmi.Pgn + uintptr(vmi.Pglen)
-			}
+			startn = end
 		}
 	})
-	if startn == 0 {
-		startn = minpgn
-	}
-	if pglen == 0 {
-		pglen = (0x100 << (39 - PGSHIFT)) - startn
+	if !done {
+		pglen = uintptr(mem.USERMAX>>PGSHIFT) - startn
 	}
 	return startn, pglen
 }
@@ -404,7 +484,8 @@ func (m *Vmregion_t) _findhole(minpgn, minlen uintptr) (uintptr, uintptr) {
 func (m *Vmregion_t) empty(minva, len uintptr) (uintptr, uintptr) {
 	minn := minva >> PGSHIFT
 	pglen := uintptr(util.Roundup(int(len), mem.PGSIZE) >> PGSHIFT)
-	if minn >= m.hole.startn && pglen <= m.hole.pglen {
+	hend := m.hole.startn + m.hole.pglen
+	if minn >= m.hole.startn && minn+pglen <= hend {
 		return m.hole.startn << PGSHIFT, m.hole.pglen << PGSHIFT
 	}
 	nhs, nhl := m._findhole(minn, pglen)
@@ -425,6 +506,261 @@ func (m *Vmregion_t) end() uintptr {
 	return last << PGSHIFT
 }
 
+// makes a mapping begin at pgn by splitting the mapping containing pgn, if
+// any. each half of a split file mapping gets its own mfile so that the halves
+// may later be unmapped or merged independently.
+func (m *Vmregion_t) _split(pgn uintptr) {
+	n := m.rb.lookup(pgn)
+	if n == nil || n.vmi.Pgn == pgn {
+		return
+	}
+	avmi := &Vminfo_t{}
+	*avmi = n.vmi
+	pgend := n.vmi.Pgn + uintptr(n.vmi.Pglen)
+	n.vmi.Pglen = int(pgn - n.vmi.Pgn)
+	n.vmi.pch = nil
+	avmi.Pgn = pgn
+	avmi.Pglen = int(pgend - pgn)
+	avmi.pch = nil
+	if avmi.Mtype == VFILE {
+		avmi.file.foff += n.vmi.Pglen << PGSHIFT
+		nmf := &Mfile_t{}
+		*nmf = *n.vmi.file.mfile
+		nmf.mapcount = avmi.Pglen
+		n.vmi.file.mfile.mapcount -= avmi.Pglen
+		avmi.file.mfile = nmf
+		nmf.mfops.Reopen()
+	}
+	m.rb._insert(avmi)
+	m.Novma++
+}
+
+// merges the mapping beginning at pgn into the adjacent lower mapping, if they
+// are compatible.
+func (m *Vmregion_t) _joinlower(pgn uintptr) {
+	if pgn == 0 {
+		return
+	}
+	n := m.rb.lookup(pgn)
+	lo := m.rb.lookup(pgn - 1)
+	if n == nil || lo == nil || n == lo || n.vmi.Pgn != pgn ||
+		!m._canmerge(&lo.vmi, &n.vmi) {
+		return
+	}
+	if n.vmi.Mtype == VFILE && lo.vmi.file.mfile != n.vmi.file.mfile {
+		lo.vmi.file.mfile.mapcount += n.vmi.file.mfile.mapcount
+		n.vmi.file.mfile.mfops.Close()
+	}
+	lo.vmi.Pglen += n.vmi.Pglen
+	m.rb.remove(n)
+	m.Novma--
+}
+
+// returns the lowest mapping which overlaps [pgn, pgend), if any
+func (m *Vmregion_t) _firstin(pgn, pgend uintptr) *Rbn_t {
+	var ret *Rbn_t
+	for n := m.rb.root; n != nil; {
+		if n.vmi.Pgn+uintptr(n.vmi.Pglen) <= pgn {
+			n = n.r
+		} else if n.vmi.Pgn >= pgend {
+			n = n.l
+		} else {
+			ret = n
+			n = n.l
+		}
+	}
+	return ret
+}
+
+// returns true if any page in [start, start+len) is mapped
+func (m *Vmregion_t) Overlaps(start, len int) bool {
+	pgn := uintptr(start) >> PGSHIFT
+	pgend := pgn + uintptr(util.Roundup(len, mem.PGSIZE)>>PGSHIFT)
+	return m._firstin(pgn, pgend) != nil
+}
+
+// returns the number of mappings that unmapping [start, start+len) adds, which
+// is one if the range is strictly inside a single mapping.
+func (m *Vmregion_t) Unmapsplits(start, len int) uint {
+	pgn := uintptr(start) >> PGSHIFT
+	pgend := pgn + uintptr(util.Roundup(len, mem.PGSIZE)>>PGSHIFT)
+	n := m.rb.lookup(pgn)
+	if n != nil && n.vmi.Pgn < pgn &&
+		n.vmi.Pgn+uintptr(n.vmi.Pglen) > pgend {
+		return 1
+	}
+	return 0
+}
+
+// extends the mapping which ends at pgn by pglen pages. the caller must make
+// sure that the new pages are unmapped.
+func (m *Vmregion_t) grow(pgn uintptr, pglen int) {
+	n := m.rb.lookup(pgn - 1)
+	if n == nil || n.vmi.Pgn+uintptr(n.vmi.Pglen) != pgn {
+		panic("no such mapping")
+	}
+	m._holeuse(pgn, uintptr(pglen))
+	m._pglen += pglen
+	n.vmi.Pglen += pglen
+	if n.vmi.Mtype == VFILE {
+		n.vmi.file.mfile.mapcount += pglen
+	}
+}
+
+// returns true if every page in [start, start+len) is mapped
+func (m *Vmregion_t) Mapped(start, len int) bool {
+	pgn := uintptr(start) >> PGSHIFT
+	pgend := pgn + uintptr(util.Roundup(len, mem.PGSIZE)>>PGSHIFT)
+	for pgn < pgend {
+		n := m.rb.lookup(pgn)
+		if n == nil {
+			return false
+		}
+		pgn = n.vmi.Pgn + uintptr(n.vmi.Pglen)
+	}
+	return true
+}
+
+// changes the permissions of the mappings in [start, start+len), splitting
+// mappings which straddle the range boundaries and merging adjacent mappings
+// which become compatible. the whole range must be mapped. returns ENOMEM if
+// the split would exceed novma mappings and EACCES if a shared mapping of a
+// read-only file would become writable.
+func (m *Vmregion_t) Setperms(start, len int, perms uint, novma uint) defs.Err_t {
+	pgn := uintptr(start) >> PGSHIFT
+	pgend := pgn + uintptr(util.Roundup(len, mem.PGSIZE)>>PGSHIFT)
+	if m.Novma+m._needsplits(pgn, pgend) > novma {
+		return -defs.ENOMEM
+	}
+	if perms&uint(PTE_W) != 0 {
+		for i := pgn; i < pgend; {
+			n := m.rb.lookup(i)
+			if n.vmi.Mtype == VFILE && n.vmi.file.shared &&
+				n.vmi.file.mfile.rdonly {
+				return -defs.EACCES
+			}
+			i = n.vmi.Pgn + uintptr(n.vmi.Pglen)
+		}
+	}
+	m._modify(pgn, pgend, func(vmi *Vminfo_t) {
+		vmi.Perms = perms
+	})
+	return 0
+}
+
+// allows or forbids huge pages in [start, start+len), which must be mapped.
+// returns ENOMEM if the mappings must be split but there would be more than
+// novma mappings.
+func (m *Vmregion_t) Sethuge(start, len int, huge bool, novma uint) defs.Err_t {
+	pgn := uintptr(start) >> PGSHIFT
+	pgend := pgn + uintptr(util.Roundup(len, mem.PGSIZE)>>PGSHIFT)
+	if m.Novma+m._needsplits(pgn, pgend) > novma {
+		return -defs.ENOMEM
+	}
+	m._modify(pgn, pgend, func(vmi *Vminfo_t) {
+		vmi.nohuge = !huge
+	})
+	return 0
+}
+
+// sets the readahead hint of the mappings in [start, start+len), which must be
+// mapped. returns ENOMEM if the mappings must be split but there would be more
+// than novma mappings.
+func (m *Vmregion_t) Setra(start, len int, ra Ra_t, novma uint) defs.Err_t {
+	pgn := uintptr(start) >> PGSHIFT
+	pgend := pgn + uintptr(util.Roundup(len, mem.PGSIZE)>>PGSHIFT)
+	if m.Novma+m._needsplits(pgn, pgend) > novma {
+		return -defs.ENOMEM
+	}
+	m._modify(pgn, pgend, func(vmi *Vminfo_t) {
+		vmi.ra = ra
+	})
+	return 0
+}
+
+// allows or forbids merging the pages in [start, start+len), which must be
+// mapped. returns ENOMEM if the mappings must be split but there would be more
+// than novma mappings.
+func (m *Vmregion_t) Setmerge(start, len int, merge bool, novma uint) defs.Err_t {
+	pgn := uintptr(start) >> PGSHIFT
+	pgend := pgn + uintptr(util.Roundup(len, mem.PGSIZE)>>PGSHIFT)
+	if m.Novma+m._needsplits(pgn, pgend) > novma {
+		return -defs.ENOMEM
+	}
+	m._modify(pgn, pgend, func(vmi *Vminfo_t) {
+		vmi.merge = merge
+	})
+	if merge {
+		atomic.StoreInt32(&m.mergeable, 1)
+	}
+	return 0
+}
+
+// registers the mappings in [start, start+len), which must be mapped, with the
+// userfaultfd u, or unregisters them if u is nil. returns ENOMEM if the
+// mappings must be split but there would be more than novma mappings.
+func (m *Vmregion_t) Setuffd(start, len int, u *Uffd_t, novma uint) defs.Err_t {
+	pgn := uintptr(start) >> PGSHIFT
+	pgend := pgn + uintptr(util.Roundup(len, mem.PGSIZE)>>PGSHIFT)
+	if m.Novma+m._needsplits(pgn, pgend) > novma {
+		return -defs.ENOMEM
+	}
+	m._modify(pgn, pgend, func(vmi *Vminfo_t) {
+		vmi.uffd = u
+	})
+	return 0
+}
+
+// locks or unlocks the mappings in [start, start+len), which must be mapped.
+// returns ENOMEM if the mappings must be split but there would be more than
+// novma mappings.
+func (m *Vmregion_t) Setlock(start, len int, locked bool, novma uint) defs.Err_t {
+	pgn := uintptr(start) >> PGSHIFT
+	pgend := pgn + uintptr(util.Roundup(len, mem.PGSIZE)>>PGSHIFT)
+	if m.Novma+m._needsplits(pgn, pgend) > novma {
+		return -defs.ENOMEM
+	}
+	m._modify(pgn, pgend, func(vmi *Vminfo_t) {
+		vmi.locked = locked
+	})
+	return 0
+}
+
+// returns the number of mappings that splitting the mappings at pgn and pgend
+// creates.
+func (m *Vmregion_t) _needsplits(pgn, pgend uintptr) uint {
+	need := uint(0)
+	if n := m.rb.lookup(pgn); n != nil && n.vmi.Pgn != pgn {
+		need++
+	}
+	if n := m.rb.lookup(pgend); n != nil && n.vmi.Pgn != pgend {
+		need++
+	}
+	return need
+}
+
+// splits the mappings at pgn and pgend, calls f on each mapping in between,
+// and merges the mappings which became compatible.
+func (m *Vmregion_t) _modify(pgn, pgend uintptr, f func(*Vminfo_t)) {
+	m._split(pgn)
+	m._split(pgend)
+	for i := pgn; i < pgend; {
+		n := m.rb.lookup(i)
+		f(&n.vmi)
+		i = n.vmi.Pgn + uintptr(n.vmi.Pglen)
+	}
+	// merge from the top so that the lower mapping of each pair is never
+	// removed from the tree while the loop uses it.
+	for i := pgend; i > pgn; {
+		s := m.rb.lookup(i - 1).vmi.Pgn
+		m._joinlower(i)
+		i = s
+	}
+	m._joinlower(pgn)
+	// the cached hole is unaffected since the set of mapped pages did not
+	// change.
+}
+
 func (m *Vmregion_t) Remove(start, len int, novma uint) defs.Err_t {
 	pgn := uintptr(start) >> PGSHIFT
 	pglen := util.Roundup(len, mem.PGSIZE) >> PGSHIFT
@@ -21,6 +21,7 @@ extern "C" {
 #define		EINTR		4
 #define		EIO		5
 #define		E2BIG		7
+#define		ENOEXEC		8
 #define		EBADF		9
 #define		ECHILD		10
 #define		EAGAIN		11
@@ -37,14 +38,20 @@ extern "C" {
 #define		EINVAL		22
 #define		ENFILE		23
 #define		EMFILE		24
+#define		ENOTTY		25
+#define		ETXTBSY		26
+#define		EFBIG		27
 #define		ENOSPC		28
 #define		ESPIPE		29
 #define		EPIPE		32
 #define		ERANGE		34
+#define		EDEADLK		35
 #define		ENAMETOOLONG	36
 #define		ENOSYS		38
 #define		ENOTEMPTY	39
 #define		EDESTADDRREQ	40
+#define		ENOMSG		42
+#define		EIDRM		43
 #define		EAFNOSUPPORT	47
 #define		EADDRINUSE	48
 #define		EADDRNOTAVAIL	49
@@ -69,7 +76,25 @@ extern "C" {
 
 #define		MAP_SHARED	0x01
 #define		MAP_PRIVATE	0x02
+#define		MAP_FIXED	0x10
 #define		MAP_ANON	0x20
+#define		MAP_FIXED_NOREPLACE	0x100000
+
+#define		MREMAP_MAYMOVE	0x1
+
+#define		MADV_NORMAL	0
+#define		MADV_RANDOM	1
+#define		MADV_SEQUENTIAL	2
+#define		MADV_WILLNEED	3
+#define		MADV_DONTNEED	4
+#define		MADV_MERGEABLE	12
+#define		MADV_UNMERGEABLE	13
+#define		MADV_HUGEPAGE	14
+#define		MADV_NOHUGEPAGE	15
+
+#define		MS_ASYNC	1
+#define		MS_INVALIDATE	2
+#define		MS_SYNC		4
 #define		MAP_ANONYMOUS	MAP_ANON
 
 #define		PROT_NONE	0x0
@@ -125,6 +150,25 @@ struct pollfd {
 	ushort	revents;
 };
 
+typedef union epoll_data {
+	void		*ptr;
+	int		fd;
+	uint32_t	u32;
+	uint64_t	u64;
+} epoll_data_t;
+
+struct epoll_event {
+	uint32_t	events;
+#define		EPOLLIN		0x1
+#define		EPOLLPRI	0x2
+#define		EPOLLOUT	0x4
+#define		EPOLLERR	0x8
+#define		EPOLLHUP	0x10
+#define		EPOLLONESHOT	(1u << 30)
+#define		EPOLLET		(1u << 31)
+	epoll_data_t	data;
+} __attribute__((packed));
+
 struct timeval {
 	time_t tv_sec;
 	time_t tv_usec;
@@ -150,6 +194,11 @@ struct timespec {
 	long tv_nsec;
 };
 
+struct itimerspec {
+	struct timespec it_interval;
+	struct timespec it_value;
+};
+
 extern long timezone;
 
 struct rlimit {
@@ -160,6 +209,20 @@ struct rlimit {
 struct rusage {
 	struct timeval ru_utime;
 	struct timeval ru_stime;
+	long	ru_maxrss;
+	long	ru_ixrss;
+	long	ru_idrss;
+	long	ru_isrss;
+	long	ru_minflt;
+	long	ru_majflt;
+	long	ru_nswap;
+	long	ru_inblock;
+	long	ru_oublock;
+	long	ru_msgsnd;
+	long	ru_msgrcv;
+	long	ru_nsignals;
+	long	ru_nvcsw;
+	long	ru_nivcsw;
 };
 
 union sigval {
@@ -185,13 +248,22 @@ struct sigaction {
 	sigset_t sa_mask;
 #define		sigemptyset(ss)		(*ss = 0)
 #define		sigfillset(ss)		(*ss = -1)
-#define		sigaddset(ss, s)	(*ss |= (1ull << s))
-#define		sigdelset(ss, s)	(*ss &= ~(1ull << s))
-#define		sigismember(ss, s)	(*ss & (1ull << s))
+#define		sigaddset(ss, s)	(*ss |= (1ull << (s - 1)))
+#define		sigdelset(ss, s)	(*ss &= ~(1ull << (s - 1)))
+#define		sigismember(ss, s)	(*ss & (1ull << (s - 1)))
 	int	sa_flags;
 #define		SA_SIGINFO		1
 };
 
+struct signalfd_siginfo {
+	uint32_t	ssi_signo;
+	int32_t		ssi_errno;
+	int32_t		ssi_code;
+	uint32_t	ssi_pid;
+	uint32_t	ssi_uid;
+	uint8_t		_unused[108];
+};
+
 struct sockaddr {
 	uchar	sa_len;
 	uchar	sa_family;
@@ -270,6 +342,67 @@ struct stat {
 #define		S_IWOTH		(00002)
 #define		S_IXOTH		(00001)
 
+#define		IPC_PRIVATE	((key_t)0)
+#define		IPC_CREAT	01000
+#define		IPC_EXCL	02000
+#define		IPC_NOWAIT	04000
+#define		IPC_RMID	0
+#define		IPC_SET		1
+#define		IPC_STAT	2
+
+// permissions are recorded but not checked
+struct ipc_perm {
+	key_t		__key;
+	uint		uid;
+	uint		gid;
+	uint		cuid;
+	uint		cgid;
+	ushort		mode;
+	ushort		_pad[5];
+	ulong		_unused[2];
+};
+
+struct shmid_ds {
+	struct ipc_perm	shm_perm;
+	size_t		shm_segsz;
+	time_t		shm_atime;
+	time_t		shm_dtime;
+	time_t		shm_ctime;
+	int		shm_cpid;
+	int		shm_lpid;
+	ulong		shm_nattch;
+	ulong		_unused[2];
+};
+
+struct semid_ds {
+	struct ipc_perm	sem_perm;
+	time_t		sem_otime;
+	ulong		_unused1;
+	time_t		sem_ctime;
+	ulong		_unused2;
+	ulong		sem_nsems;
+	ulong		_unused3[2];
+};
+
+struct sembuf {
+	ushort		sem_num;
+	short		sem_op;
+	short		sem_flg;
+};
+
+struct msqid_ds {
+	struct ipc_perm	msg_perm;
+	time_t		msg_stime;
+	time_t		msg_rtime;
+	time_t		msg_ctime;
+	ulong		msg_cbytes;
+	ulong		msg_qnum;
+	ulong		msg_qbytes;
+	int		msg_lspid;
+	int		msg_lrpid;
+	ulong		_unused[2];
+};
+
 struct tfork_t {
 	void *tf_tcb;
 	// tf_tid is merely a convenient way for a new thread to learn its tid.
@@ -288,14 +421,34 @@ int bind(int, const struct sockaddr *, socklen_t);
 int connect(int, const struct sockaddr *, socklen_t);
 int chmod(const char *, mode_t);
 int close(int);
+int close_range(unsigned int, unsigned int, int);
+#define		CLOSE_RANGE_CLOEXEC	(1 << 2)
 int chdir(const char *);
 int dup(int);
 int dup2(int, int);
+int dup3(int, int, int);
+int epoll_create(int);
+int epoll_create1(int);
+#define		EPOLL_CLOEXEC	0x80000
+int epoll_ctl(int, int, int, struct epoll_event *);
+#define		EPOLL_CTL_ADD	1
+#define		EPOLL_CTL_DEL	2
+#define		EPOLL_CTL_MOD	3
+int epoll_wait(int, struct epoll_event *, int, int);
+int eventfd(uint, int);
+#define		EFD_SEMAPHORE	1
+#define		EFD_NONBLOCK	0x800
+#define		EFD_CLOEXEC	0x80000
 void _exit(int)
     __attribute__((noreturn));
 int execv(const char *, char * const[]);
 int execve(const char *, char * const[], char * const[]);
 int execvp(const char *, char * const[]);
+int flock(int, int);
+#define		LOCK_SH		1
+#define		LOCK_EX		2
+#define		LOCK_NB		4
+#define		LOCK_UN		8
 pid_t fork(void);
 int fstat(int, struct stat *);
 int ftruncate(int, off_t);
@@ -307,10 +460,14 @@ int futex(const int, void *, void *, int, const struct timespec *);
 char *getcwd(char *, size_t);
 pid_t getpid(void);
 pid_t getppid(void);
+int getpriority(int, int);
+#define		PRIO_PROCESS	0
 
 int getrlimit(int, struct rlimit *);
 #define		RLIMIT_NOFILE	1
 #define		RLIMIT_CORE	2
+#define		RLIMIT_MEMLOCK	3
+#define		RLIMIT_RTPRIO	4
 #define		RLIM_INFINITY	ULONG_MAX
 int getrusage(int, struct rusage *);
 #define		RUSAGE_SELF	1
@@ -330,9 +487,50 @@ int fcntl(int, int, ...);
 #define		F_SETLK		5
 #define		F_SETLKW	6
 #define		F_SETOWN	7
+#define		F_GETLK		8
+#define		F_DUPFD		9
+#define		F_DUPFD_CLOEXEC	10
 
 #define		FD_CLOEXEC	0x4
 
+int inotify_add_watch(int, const char *, uint32_t);
+int inotify_init(void);
+int inotify_init1(int);
+#define		IN_NONBLOCK	0x800
+#define		IN_CLOEXEC	0x80000
+int inotify_rm_watch(int, int);
+
+struct inotify_event {
+	int		wd;
+	uint32_t	mask;
+#define		IN_ACCESS		0x1
+#define		IN_MODIFY		0x2
+#define		IN_ATTRIB		0x4
+#define		IN_CLOSE_WRITE		0x8
+#define		IN_CLOSE_NOWRITE	0x10
+#define		IN_CLOSE		(IN_CLOSE_WRITE | IN_CLOSE_NOWRITE)
+#define		IN_OPEN			0x20
+#define		IN_MOVED_FROM		0x40
+#define		IN_MOVED_TO		0x80
+#define		IN_MOVE			(IN_MOVED_FROM | IN_MOVED_TO)
+#define		IN_CREATE		0x100
+#define		IN_DELETE		0x200
+#define		IN_DELETE_SELF		0x400
+#define		IN_MOVE_SELF		0x800
+#define		IN_ALL_EVENTS		0xfff
+#define		IN_Q_OVERFLOW		0x4000
+#define		IN_IGNORED		0x8000
+#define		IN_ONLYDIR		0x01000000
+#define		IN_DONT_FOLLOW		0x02000000
+#define		IN_EXCL_UNLINK		0x04000000
+#define		IN_MASK_ADD		0x20000000
+#define		IN_ISDIR		0x40000000
+#define		IN_ONESHOT		0x80000000
+	uint32_t	cookie;
+	uint32_t	len;
+	char		name[];
+};
+
 int kill(int, int);
 int link(const char *, const char *);
 int listen(int, int);
@@ -341,11 +539,28 @@ off_t lseek(int, off_t, int);
 #define		SEEK_CUR	2
 #define		SEEK_END	4
 
+int madvise(void *, size_t, int);
 int mkdir(const char *, long);
 int mknod(const char *, mode_t, dev_t);
+int mlock(const void *, size_t);
+int mlockall(int);
+#define		MCL_CURRENT	1
+#define		MCL_FUTURE	2
 void *mmap(void *, size_t, int, int, int, long);
+int mprotect(void *, size_t, int);
+void *mremap(void *, size_t, size_t, int);
+int msync(void *, size_t, int);
+int msgctl(int, int, struct msqid_ds *);
+int msgget(key_t, int);
+ssize_t msgrcv(int, void *, size_t, long, int);
+#define		MSG_NOERROR	010000
+#define		MSG_EXCEPT	020000
+int msgsnd(int, const void *, size_t, int);
+int munlock(const void *, size_t);
+int munlockall(void);
 int munmap(void *, size_t);
 int nanosleep(const struct timespec *, struct timespec *);
+int nice(int);
 int open(const char *, int, ...);
 #define		O_RDONLY	0
 #define		O_WRONLY	1
@@ -359,6 +574,14 @@ int open(const char *, int, ...);
 #define		O_CLOEXEC	0x80000
 
 int pause(void);
+int personality(ulong);
+int oom_score_adj(pid_t, const int *, int *);
+#define		OOM_ADJ_MIN	(-1000)
+#define		OOM_ADJ_MAX	1000
+#define		ADDR_NO_RANDOMIZE	0x0040000
+#define		PER_MASK	0xff
+#define		PER_BISCUIT	0x0
+#define		PER_LINUX	0x1
 int pipe(int[2]);
 int pipe2(int[2], int);
 int poll(struct pollfd *, nfds_t, int);
@@ -405,13 +628,62 @@ struct cmsghdr {
 ssize_t recvmsg(int, struct msghdr *, int);
 int rename(const char *, const char *);
 int rmdir(const char *);
+
+struct sched_param {
+	int	sched_priority;
+};
+
+#define		SCHED_OTHER	0
+#define		SCHED_FIFO	1
+
+typedef struct {
+	ulong	_bits[1];
+} cpu_set_t;
+
+#define		CPU_SETSIZE	64
+#define		CPU_ZERO(s)	((s)->_bits[0] = 0)
+#define		CPU_SET(c, s)	((s)->_bits[0] |= 1ul << (c))
+#define		CPU_CLR(c, s)	((s)->_bits[0] &= ~(1ul << (c)))
+#define		CPU_ISSET(c, s)	(((s)->_bits[0] >> (c)) & 1)
+
+int sched_getaffinity(pid_t, size_t, cpu_set_t *);
+int sched_getparam(pid_t, struct sched_param *);
+int sched_get_priority_max(int);
+int sched_get_priority_min(int);
+int sched_getscheduler(pid_t);
+int sched_setaffinity(pid_t, size_t, const cpu_set_t *);
+int sched_setscheduler(pid_t, int, const struct sched_param *);
 int select(int, fd_set*, fd_set*, fd_set*, struct timeval *);
+int semctl(int, int, int, ...);
+#define		GETPID		11
+#define		GETVAL		12
+#define		GETALL		13
+#define		SETVAL		16
+#define		SETALL		17
+int semget(key_t, int, int);
+int semop(int, struct sembuf *, size_t);
+#define		SEM_UNDO	0x1000
 ssize_t send(int, const void *, size_t, int);
+ssize_t sendfile(int, int, off_t *, size_t);
 ssize_t sendto(int, const void *, size_t, int, const struct sockaddr *,
     socklen_t);
 ssize_t sendmsg(int, struct msghdr *, int);
+int setpriority(int, int, int);
 int setrlimit(int, const struct rlimit *);
 pid_t setsid(void);
+void *shmat(int, const void *, int);
+#define		SHM_RDONLY	010000
+#define		SHM_RND		020000
+#define		SHMLBA		4096
+int shmctl(int, int, struct shmid_ds *);
+int shmdt(const void *);
+int shmget(key_t, size_t, int);
+int shm_open(const char *, int, mode_t);
+int shm_unlink(const char *);
+ssize_t splice(int, off_t *, int, off_t *, size_t, uint);
+#define		SPLICE_F_MOVE		1
+#define		SPLICE_F_NONBLOCK	2
+#define		SPLICE_F_MORE		4
 // levels
 #define		SOL_SOCKET	1
 #define		IPPROTO_TCP	2
@@ -457,6 +729,9 @@ void (*signal(int, void (*)(int)))(int);
 #define		SIG_BLOCK	1
 #define		SIG_SETMASK	2
 #define		SIG_UNBLOCK	3
+int signalfd(int, const sigset_t *, int);
+#define		SFD_NONBLOCK	0x800
+#define		SFD_CLOEXEC	0x80000
 int socket(int, int, int);
 #define		AF_UNIX		1
 #define		AF_LOCAL	AF_UNIX
@@ -470,6 +745,8 @@ int socket(int, int, int);
 #define		SOCK_NONBLOCK	(1 << 5)
 
 int stat(const char *, struct stat *);
+int swapoff(const char *);
+int swapon(const char *, off_t, size_t);
 int sync(void);
 long sys_prof(long, long, long, long);
 #define		PROF_DISABLE   (1ul << 0)
@@ -512,9 +789,104 @@ long sys_info(long);
 #define		SINFO_GCOBJS				9l
 #define		SINFO_DOGC				10l
 #define		SINFO_PROCLIST				11l
-
+#define		SINFO_RSSANON				12l
+#define		SINFO_RSSFILE				13l
+#define		SINFO_RSSSHARED				14l
+#define		SINFO_RSSSWAP				15l
+#define		SINFO_MAXRSS				16l
+#define		SINFO_KSMSHARED				17l
+#define		SINFO_KSMSHARING			18l
+
+long sys_cgroup(long, long, long, long);
+#define		CGROUP_SELF		1l
+#define		CGROUP_CREATE		2l
+#define		CGROUP_DESTROY		3l
+#define		CGROUP_JOIN		4l
+#define		CGROUP_SETLIM		5l
+#define		CGROUP_GETLIM		6l
+#define		CGROUP_USAGE		7l
+#define		CGROUP_PAGES		0l
+#define		CGROUP_HEAP		1l
+#define		CGROUP_PROCS		2l
+#define		CGROUP_UNLIMITED	0x7fffffffffffffffl
+
+int timerfd_create(int, int);
+#define		CLOCK_REALTIME	0
+#define		CLOCK_MONOTONIC	1
+#define		TFD_NONBLOCK	0x800
+#define		TFD_CLOEXEC	0x80000
+int timerfd_gettime(int, struct itimerspec *);
+int timerfd_settime(int, int, const struct itimerspec *, struct itimerspec *);
+#define		TFD_TIMER_ABSTIME	1
 int truncate(const char *, off_t);
 int unlink(const char *);
+int userfaultfd(int);
+
+struct uffdio_api {
+	ulong	api;
+	ulong	features;
+	ulong	ioctls;
+};
+
+struct uffdio_range {
+	ulong	start;
+	ulong	len;
+};
+
+struct uffdio_register {
+	struct uffdio_range	range;
+	ulong	mode;
+	ulong	ioctls;
+};
+
+struct uffdio_copy {
+	ulong	dst;
+	ulong	src;
+	ulong	len;
+	ulong	mode;
+	long	copy;
+};
+
+struct uffdio_zeropage {
+	struct uffdio_range	range;
+	ulong	mode;
+	long	zeropage;
+};
+
+struct uffd_msg {
+	uchar	event;
+	uchar	reserved1;
+	ushort	reserved2;
+	uint	reserved3;
+	union {
+		struct {
+			ulong	flags;
+			ulong	address;
+			union {
+				uint	ptid;
+			} feat;
+		} pagefault;
+		struct {
+			ulong	reserved1;
+			ulong	reserved2;
+			ulong	reserved3;
+		} reserved;
+	} arg;
+};
+
+#define		UFFD_API			0xaa
+#define		UFFDIO_API			0xc018aa3ful
+#define		UFFDIO_REGISTER			0xc020aa00ul
+#define		UFFDIO_UNREGISTER		0x8010aa01ul
+#define		UFFDIO_WAKE			0x8010aa02ul
+#define		UFFDIO_COPY			0xc028aa03ul
+#define		UFFDIO_ZEROPAGE			0xc020aa04ul
+#define		UFFDIO_REGISTER_MODE_MISSING	1
+#define		UFFDIO_COPY_MODE_DONTWAKE	1
+#define		UFFDIO_ZEROPAGE_MODE_DONTWAKE	1
+#define		UFFD_EVENT_PAGEFAULT		0x12
+#define		UFFD_PAGEFAULT_FLAG_WRITE	1
+
 pid_t wait(int *);
 pid_t waitpid(pid_t, int *, int);
 pid_t wait3(int *, int, struct rusage *);
@@ -542,6 +914,19 @@ int tfork_thread(struct tfork_t *, long (*fn)(void *), void *);
 void threxit(long);
 int thrwait(int, long *);
 
+#define		CLONE_VM		0x100
+#define		CLONE_FS		0x200
+#define		CLONE_FILES		0x400
+#define		CLONE_SIGHAND		0x800
+#define		CLONE_VFORK		0x4000
+#define		CLONE_THREAD		0x10000
+#define		CLONE_SETTLS		0x80000
+#define		CLONE_PARENT_SETTID	0x100000
+#define		CLONE_CHILD_CLEARTID	0x200000
+#define		CLONE_CHILD_SETTID	0x1000000
+int clone(int (*)(void *), void *, int, void *, ...);
+void clone_done(long, long);
+
 typedef long pthread_t;
 
 typedef struct {
@@ -617,12 +1002,21 @@ int pthread_setcanceltype(int, int *);
 /*
  * posix stuff
  */
+#define		SPAWN_DUP2	1
+#define		SPAWN_CLOSE	2
+#define		SPAWN_OPEN	3
+// the layout of the kernel's spawn file actions
+struct _spawnact_t {
+	int op;
+	int fd;
+	int arg;
+	int mode;
+	char *path;
+};
+
 typedef struct {
-	struct {
-		int from;
-		int to;
-	} dup2s[10];
-	int dup2slot;
+	struct _spawnact_t acts[16];
+	int nacts;
 } posix_spawn_file_actions_t;
 
 typedef struct {
@@ -630,7 +1024,10 @@ typedef struct {
 
 int posix_spawn(pid_t *, const char *, const posix_spawn_file_actions_t *,
     const posix_spawnattr_t *, char *const argv[], char *const envp[]);
+int posix_spawn_file_actions_addclose(posix_spawn_file_actions_t *, int);
 int posix_spawn_file_actions_adddup2(posix_spawn_file_actions_t *, int, int);
+int posix_spawn_file_actions_addopen(posix_spawn_file_actions_t *, int,
+    const char *, int, mode_t);
 int posix_spawn_file_actions_destroy(posix_spawn_file_actions_t *);
 int posix_spawn_file_actions_init(posix_spawn_file_actions_t *);
 
@@ -819,6 +1216,7 @@ void rewinddir(DIR *);
 //int scanf(const char *, ...) /*REDIS*/
 //    __attribute__((format(scanf, 1, 2))); /*REDIS*/
 int setenv(const char *, const char *, int);
+int unsetenv(const char *);
 char *setlocale(int, const char *);
 #define		LC_COLLATE	1
 uint sleep(uint);
@@ -894,7 +1292,7 @@ extern char __progname[64];
 extern char **environ;
 
 /* NGINX STUFF */
-char *getenv(char *);
+char *getenv(const char *);
 uid_t geteuid(void);
 
 struct passwd {
@@ -957,6 +1355,7 @@ void globfree(glob_t *);
 
 struct flock {
 	short	l_type;
+#define		F_RDLCK		0
 #define		F_WRLCK		1
 #define		F_UNLCK		2
 	short	l_whence;
@@ -975,9 +1374,6 @@ int getpagesize(void);
 int sigprocmask(int, sigset_t *, sigset_t *);
 int sigsuspend(const sigset_t *);
 
-int setpriority(int, int, int);
-#define		PRIO_PROCESS	1
-
 uid_t getuid(void);
 int setuid(uid_t);
 int setgid(gid_t);
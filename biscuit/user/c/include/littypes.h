@@ -64,6 +64,7 @@ typedef unsigned long 	rlim_t;
 typedef unsigned long 	sigset_t;
 typedef volatile long 	sig_atomic_t;
 typedef long 		blkcnt_t;
+typedef int 		key_t;
 typedef char * 		caddr_t;
 
 #define NULL   ((void *)0)
@@ -44,6 +44,9 @@ int main(int argc, char **argv)
 	if (ret != 0 && errno != EEXIST)
 		err(-1, "mknod");
 	ret = mknod("/dev/prof", 0, MKDEV(7, 0));
+	if (ret != 0 && errno != EEXIST)
+		err(-1, "mknod");
+	ret = mknod("/dev/oom", 0, MKDEV(8, 0));
 	if (ret != 0 && errno != EEXIST)
 		err(-1, "mknod");
 
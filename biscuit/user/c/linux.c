@@ -0,0 +1,15 @@
+#include <litc.h>
+
+// runs a statically linked Linux program, which uses the Linux system call ABI.
+int main(int argc, char **argv)
+{
+	if (argc < 2)
+		errx(-1, "usage: %s <program> <arg1> ...", argv[0]);
+	int cur = personality(0xffffffff);
+	if (cur == -1)
+		err(-1, "personality");
+	if (personality((cur & ~PER_MASK) | PER_LINUX) == -1)
+		err(-1, "personality");
+	execvp(argv[1], &argv[1]);
+	err(-1, "exec %s", argv[1]);
+}
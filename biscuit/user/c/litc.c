@@ -10,11 +10,20 @@
 #define SYS_POLL         7
 #define SYS_LSEEK        8
 #define SYS_MMAP         9
+#define SYS_MPROTECT     10
 #define SYS_MUNMAP       11
 #define SYS_SIGACTION    13
+#define SYS_IOCTL        16
 #define SYS_READV        19
 #define SYS_WRITEV       20
 #define SYS_ACCESS       21
+#define SYS_MREMAP       25
+#define SYS_MSYNC        26
+#define SYS_MADVISE      28
+#define SYS_SHMGET       29
+#define SYS_SHMAT        30
+#define SYS_SHMCTL       31
+#define SYS_DUP          32
 #define SYS_DUP2         33
 #define SYS_PAUSE        34
 #define SYS_GETPID       39
@@ -37,7 +46,16 @@
 #define SYS_EXIT         60
 #define SYS_WAIT4        61
 #define SYS_KILL         62
+#define SYS_SEMGET       64
+#define SYS_SEMOP        65
+#define SYS_SEMCTL       66
+#define SYS_SHMDT        67
+#define SYS_MSGGET       68
+#define SYS_MSGSND       69
+#define SYS_MSGRCV       70
+#define SYS_MSGCTL       71
 #define SYS_FCNTL        72
+#define SYS_FLOCK        73
 #define SYS_TRUNC        76
 #define SYS_FTRUNC       77
 #define SYS_GETCWD       79
@@ -50,11 +68,40 @@
 #define SYS_GETRLIMIT    97
 #define SYS_GETRUSAGE    98
 #define SYS_MKNOD        133
+#define SYS_PERSONALITY  135
+#define SYS_GETPRIORITY  140
+#define SYS_SETPRIORITY  141
+#define SYS_SCHED_GETPARAM 143
+#define SYS_SCHED_SETSCHEDULER 144
+#define SYS_SCHED_GETSCHEDULER 145
+#define SYS_MLOCK        149
+#define SYS_MUNLOCK      150
+#define SYS_MLOCKALL     151
+#define SYS_MUNLOCKALL   152
 #define SYS_SETRLIMIT    160
 #define SYS_SYNC         162
+#define SYS_SWAPON       167
+#define SYS_SWAPOFF      168
 #define SYS_REBOOT       169
+#define SYS_SCHED_SETAFFINITY 203
+#define SYS_SCHED_GETAFFINITY 204
 #define SYS_NANOSLEEP    230
+#define SYS_EPOLL_WAIT   232
+#define SYS_EPOLL_CTL    233
+#define SYS_INOTIFY_ADD  254
+#define SYS_INOTIFY_RM   255
+#define SYS_SPLICE       275
+#define SYS_TFD_CREATE   283
+#define SYS_TFD_SETTIME  286
+#define SYS_TFD_GETTIME  287
+#define SYS_SIGNALFD4    289
+#define SYS_EVENTFD2     290
+#define SYS_EPOLL_CREATE1 291
+#define SYS_DUP3         292
 #define SYS_PIPE2        293
+#define SYS_INOTIFY_INIT1 294
+#define SYS_USERFAULTFD  323
+#define SYS_CLOSE_RANGE  436
 #define SYS_PROF         31337
 #define SYS_THREXIT      31338
 #define SYS_INFO         31339
@@ -62,6 +109,13 @@
 #define SYS_PWRITE       31341
 #define SYS_FUTEX        31342
 #define SYS_GETTID       31343
+#define SYS_CGROUP       31344
+#define SYS_OOMADJ       31345
+#define SYS_SHMOPEN      31346
+#define SYS_SHMUNLINK    31347
+#define SYS_SENDFILE     31348
+#define SYS_CLONE        31349
+#define SYS_SPAWN        31350
 
 __thread int errno;
 
@@ -163,15 +217,21 @@ chdir(const char *path)
 	return ret;
 }
 
+int
+close_range(unsigned int first, unsigned int last, int flags)
+{
+	int ret = syscall(SA(first), SA(last), SA(flags), 0, 0,
+	    SYS_CLOSE_RANGE);
+	ERRNO_NZ(ret);
+	return ret;
+}
+
 int
 dup(int o)
 {
-	int fd;
-	if ((fd = open("/", O_RDONLY | O_DIRECTORY)) == -1)
-		return -1;
-	if (dup2(o, fd) == -1)
-		return -1;
-	return fd;
+	int ret = syscall(SA(o), 0, 0, 0, 0, SYS_DUP);
+	ERRNO_NEG(ret);
+	return ret;
 }
 
 int
@@ -197,6 +257,57 @@ dup2(int old, int new)
 	return ret;
 }
 
+int
+dup3(int old, int new, int flags)
+{
+	int ret = syscall(SA(old), SA(new), SA(flags), 0, 0, SYS_DUP3);
+	ERRNO_NEG(ret);
+	return ret;
+}
+
+int
+epoll_create(int size)
+{
+	if (size <= 0) {
+		errno = EINVAL;
+		return -1;
+	}
+	return epoll_create1(0);
+}
+
+int
+epoll_create1(int flags)
+{
+	int ret = syscall(SA(flags), 0, 0, 0, 0, SYS_EPOLL_CREATE1);
+	ERRNO_NEG(ret);
+	return ret;
+}
+
+int
+epoll_ctl(int epfd, int op, int fd, struct epoll_event *ev)
+{
+	int ret = syscall(SA(epfd), SA(op), SA(fd), SA(ev), 0, SYS_EPOLL_CTL);
+	ERRNO_NZ(ret);
+	return ret;
+}
+
+int
+epoll_wait(int epfd, struct epoll_event *evs, int max, int timeout)
+{
+	int ret = syscall(SA(epfd), SA(evs), SA(max), SA(timeout), 0,
+	    SYS_EPOLL_WAIT);
+	ERRNO_NEG(ret);
+	return ret;
+}
+
+int
+eventfd(uint initval, int flags)
+{
+	int ret = syscall(SA(initval), SA(flags), 0, 0, 0, SYS_EVENTFD2);
+	ERRNO_NEG(ret);
+	return ret;
+}
+
 void
 _exit(int status)
 {
@@ -214,9 +325,7 @@ execv(const char *path, char * const argv[])
 int
 execve(const char *path, char * const argv[], char * const envp[])
 {
-	if (envp != environ)
-		errx(-1, "envp not supported yet");
-	int ret = syscall(SA(path), SA(argv), 0, 0, 0, SYS_EXECV);
+	int ret = syscall(SA(path), SA(argv), SA(envp), 0, 0, SYS_EXECV);
 	errno = -ret;
 	return -1;
 }
@@ -269,12 +378,23 @@ fcntl(int fd, int cmd, ...)
 	case F_SETFD:
 	case F_GETFL:
 	case F_SETFL:
+	case F_DUPFD:
+	case F_DUPFD_CLOEXEC:
 	{
 		int fl = va_arg(ap, int);
 		ret = syscall(a1, a2, SA(fl), 0, 0, SYS_FCNTL);
 		ERRNO_NEG(ret);
 		break;
 	}
+	case F_GETLK:
+	case F_SETLK:
+	case F_SETLKW:
+	{
+		struct flock *fl = va_arg(ap, struct flock *);
+		ret = syscall(a1, a2, SA(fl), 0, 0, SYS_FCNTL);
+		ERRNO_NZ(ret);
+		break;
+	}
 	case F_SETOWN:
 	{
 		fprintf(stderr, "warning: F_SETOWN is no-op\n");
@@ -288,6 +408,14 @@ fcntl(int fd, int cmd, ...)
 	return ret;
 }
 
+int
+flock(int fd, int op)
+{
+	int ret = syscall(SA(fd), SA(op), 0, 0, 0, SYS_FLOCK);
+	ERRNO_NZ(ret);
+	return ret;
+}
+
 pid_t
 fork(void)
 {
@@ -327,6 +455,18 @@ getppid(void)
 	return syscall(0, 0, 0, 0, 0, SYS_GETPPID);
 }
 
+int
+getpriority(int which, int who)
+{
+	// the kernel returns 20 - nice so that the result cannot be mistaken
+	// for an error
+	int ret = syscall(SA(which), SA(who), 0, 0, 0, SYS_GETPRIORITY);
+	ERRNO_NEG(ret);
+	if (ret == -1)
+		return -1;
+	return 20 - ret;
+}
+
 int
 getsockopt(int fd, int level, int opt, void *optv, socklen_t *optlen)
 {
@@ -386,13 +526,39 @@ getrusage(int who, struct rusage *r)
 	return ret;
 }
 
+int
+inotify_add_watch(int fd, const char *path, uint32_t mask)
+{
+	int ret = syscall(SA(fd), SA(path), SA(mask), 0, 0, SYS_INOTIFY_ADD);
+	ERRNO_NEG(ret);
+	return ret;
+}
+
+int
+inotify_init(void)
+{
+	return inotify_init1(0);
+}
+
+int
+inotify_init1(int flags)
+{
+	int ret = syscall(SA(flags), 0, 0, 0, 0, SYS_INOTIFY_INIT1);
+	ERRNO_NEG(ret);
+	return ret;
+}
+
+int
+inotify_rm_watch(int fd, int wd)
+{
+	int ret = syscall(SA(fd), SA(wd), 0, 0, 0, SYS_INOTIFY_RM);
+	ERRNO_NZ(ret);
+	return ret;
+}
+
 int
 kill(int pid, int sig)
 {
-	if (sig != SIGKILL) {
-		printf("%s: kill: only SIGKILL is supported\n", __progname);
-		return -1;
-	}
 	int ret = syscall(SA(pid), SA(sig), 0, 0, 0, SYS_KILL);
 	ERRNO_NZ(ret);
 	return ret;
@@ -440,6 +606,22 @@ mknod(const char *p, mode_t m, dev_t d)
 	return ret;
 }
 
+int
+mlock(const void *addr, size_t len)
+{
+	int ret = syscall(SA(addr), SA(len), 0, 0, 0, SYS_MLOCK);
+	ERRNO_NZ(ret);
+	return ret;
+}
+
+int
+mlockall(int flags)
+{
+	int ret = syscall(SA(flags), 0, 0, 0, 0, SYS_MLOCKALL);
+	ERRNO_NZ(ret);
+	return ret;
+}
+
 void *
 mmap(void *addr, size_t len, int prot, int flags, int fd, long offset)
 {
@@ -455,6 +637,92 @@ mmap(void *addr, size_t len, int prot, int flags, int fd, long offset)
 	return (void *)ret;
 }
 
+void *
+mremap(void *old, size_t oldlen, size_t newlen, int flags)
+{
+	long ret;
+	ret = syscall(SA(old), SA(oldlen), SA(newlen), SA(flags), 0,
+	    SYS_MREMAP);
+	if (ret < 0 && -ret >= ERRNO_FIRST && -ret <= ERRNO_LAST) {
+		errno = -ret;
+		ret = (long)MAP_FAILED;
+	}
+	return (void *)ret;
+}
+
+int
+madvise(void *addr, size_t len, int advice)
+{
+	int ret = syscall(SA(addr), SA(len), SA(advice), 0, 0, SYS_MADVISE);
+	ERRNO_NZ(ret);
+	return ret;
+}
+
+int
+mprotect(void *addr, size_t len, int prot)
+{
+	int ret = syscall(SA(addr), SA(len), SA(prot), 0, 0, SYS_MPROTECT);
+	ERRNO_NZ(ret);
+	return ret;
+}
+
+int
+msync(void *addr, size_t len, int flags)
+{
+	int ret = syscall(SA(addr), SA(len), SA(flags), 0, 0, SYS_MSYNC);
+	ERRNO_NZ(ret);
+	return ret;
+}
+
+int
+msgctl(int id, int cmd, struct msqid_ds *buf)
+{
+	int ret = syscall(SA(id), SA(cmd), SA(buf), 0, 0, SYS_MSGCTL);
+	ERRNO_NZ(ret);
+	return ret;
+}
+
+int
+msgget(key_t key, int flags)
+{
+	int ret = syscall(SA(key), SA(flags), 0, 0, 0, SYS_MSGGET);
+	ERRNO_NEG(ret);
+	return ret;
+}
+
+ssize_t
+msgrcv(int id, void *msgp, size_t sz, long type, int flags)
+{
+	ssize_t ret = syscall(SA(id), SA(msgp), SA(sz), SA(type), SA(flags),
+	    SYS_MSGRCV);
+	ERRNO_NEG(ret);
+	return ret;
+}
+
+int
+msgsnd(int id, const void *msgp, size_t sz, int flags)
+{
+	int ret = syscall(SA(id), SA(msgp), SA(sz), SA(flags), 0, SYS_MSGSND);
+	ERRNO_NZ(ret);
+	return ret;
+}
+
+int
+munlock(const void *addr, size_t len)
+{
+	int ret = syscall(SA(addr), SA(len), 0, 0, 0, SYS_MUNLOCK);
+	ERRNO_NZ(ret);
+	return ret;
+}
+
+int
+munlockall(void)
+{
+	int ret = syscall(0, 0, 0, 0, 0, SYS_MUNLOCKALL);
+	ERRNO_NZ(ret);
+	return ret;
+}
+
 int
 munmap(void *addr, size_t len)
 {
@@ -471,6 +739,18 @@ nanosleep(const struct timespec *timeout, struct timespec *remainder)
 	return ret;
 }
 
+int
+nice(int inc)
+{
+	errno = 0;
+	int cur = getpriority(PRIO_PROCESS, 0);
+	if (cur == -1 && errno != 0)
+		return -1;
+	if (setpriority(PRIO_PROCESS, 0, cur + inc) == -1)
+		return -1;
+	return getpriority(PRIO_PROCESS, 0);
+}
+
 int
 open(const char *path, int flags, ...)
 {
@@ -494,6 +774,22 @@ pause(void)
 	return -1;
 }
 
+int
+personality(ulong persona)
+{
+	int ret = syscall(SA(persona), 0, 0, 0, 0, SYS_PERSONALITY);
+	ERRNO_NEG(ret);
+	return ret;
+}
+
+int
+oom_score_adj(pid_t pid, const int *new, int *old)
+{
+	int ret = syscall(SA(pid), SA(new), SA(old), 0, 0, SYS_OOMADJ);
+	ERRNO_NZ(ret);
+	return ret;
+}
+
 int
 pipe(int pfds[2])
 {
@@ -597,6 +893,15 @@ send(int fd, const void *buf, size_t len, int flags)
 	return sendto(fd, buf, len, flags, NULL, 0);
 }
 
+ssize_t
+sendfile(int out, int in, off_t *off, size_t count)
+{
+	ssize_t ret = syscall(SA(out), SA(in), SA(off), SA(count), 0,
+	    SYS_SENDFILE);
+	ERRNO_NEG(ret);
+	return ret;
+}
+
 ssize_t
 sendto(int fd, const void *buf, size_t len, int flags,
     const struct sockaddr *sa, socklen_t slen)
@@ -618,6 +923,14 @@ sendmsg(int fd, struct msghdr *msg, int flags)
 	return ret;
 }
 
+int
+setpriority(int which, int who, int prio)
+{
+	int ret = syscall(SA(which), SA(who), SA(prio), 0, 0, SYS_SETPRIORITY);
+	ERRNO_NZ(ret);
+	return ret;
+}
+
 int
 setrlimit(int res, const struct rlimit *rlp)
 {
@@ -633,6 +946,43 @@ setsid(void)
 	return getpid();
 }
 
+int
+semctl(int id, int num, int cmd, ...)
+{
+	// the union semun argument
+	long arg = 0;
+	va_list ap;
+	va_start(ap, cmd);
+	switch (cmd) {
+	case IPC_STAT:
+	case SETVAL:
+	case GETALL:
+	case SETALL:
+		arg = va_arg(ap, long);
+		break;
+	}
+	va_end(ap);
+	int ret = syscall(SA(id), SA(num), SA(cmd), arg, 0, SYS_SEMCTL);
+	ERRNO_NEG(ret);
+	return ret;
+}
+
+int
+semget(key_t key, int nsems, int flags)
+{
+	int ret = syscall(SA(key), SA(nsems), SA(flags), 0, 0, SYS_SEMGET);
+	ERRNO_NEG(ret);
+	return ret;
+}
+
+int
+semop(int id, struct sembuf *sops, size_t nsops)
+{
+	int ret = syscall(SA(id), SA(sops), SA(nsops), 0, 0, SYS_SEMOP);
+	ERRNO_NZ(ret);
+	return ret;
+}
+
 int
 setsockopt(int a, int b, int c, const void *d, socklen_t e)
 {
@@ -688,6 +1038,67 @@ void
 	return oa.sa_handler;
 }
 
+int
+signalfd(int fd, const sigset_t *mask, int flags)
+{
+	int ret = syscall(SA(fd), SA(mask), sizeof(sigset_t), SA(flags), 0,
+	    SYS_SIGNALFD4);
+	ERRNO_NEG(ret);
+	return ret;
+}
+
+void *
+shmat(int id, const void *addr, int flags)
+{
+	long ret = syscall(SA(id), SA(addr), SA(flags), 0, 0, SYS_SHMAT);
+	if (ret < 0 && -ret >= ERRNO_FIRST && -ret <= ERRNO_LAST) {
+		errno = -ret;
+		ret = -1;
+	}
+	return (void *)ret;
+}
+
+int
+shmctl(int id, int cmd, struct shmid_ds *buf)
+{
+	int ret = syscall(SA(id), SA(cmd), SA(buf), 0, 0, SYS_SHMCTL);
+	ERRNO_NZ(ret);
+	return ret;
+}
+
+int
+shmdt(const void *addr)
+{
+	int ret = syscall(SA(addr), 0, 0, 0, 0, SYS_SHMDT);
+	ERRNO_NZ(ret);
+	return ret;
+}
+
+int
+shmget(key_t key, size_t size, int flags)
+{
+	int ret = syscall(SA(key), SA(size), SA(flags), 0, 0, SYS_SHMGET);
+	ERRNO_NEG(ret);
+	return ret;
+}
+
+// shared memory objects have no permissions; mode is ignored
+int
+shm_open(const char *name, int flags, mode_t mode)
+{
+	int ret = syscall(SA(name), SA(flags), 0, 0, 0, SYS_SHMOPEN);
+	ERRNO_NEG(ret);
+	return ret;
+}
+
+int
+shm_unlink(const char *name)
+{
+	int ret = syscall(SA(name), 0, 0, 0, 0, SYS_SHMUNLINK);
+	ERRNO_NZ(ret);
+	return ret;
+}
+
 int
 shutdown(int fd, int how)
 {
@@ -713,6 +1124,20 @@ socketpair(int dom, int type, int proto, int p[2])
 	return ret;
 }
 
+ssize_t
+splice(int in, off_t *inoff, int out, off_t *outoff, size_t len, uint flags)
+{
+	// the kernel takes the length and flags in one argument
+	if (len > UINT_MAX)
+		len = UINT_MAX;
+	ulong lenflags = (ulong)flags << 32;
+	lenflags |= len;
+	ssize_t ret = syscall(SA(in), SA(inoff), SA(out), SA(outoff),
+	    SA(lenflags), SYS_SPLICE);
+	ERRNO_NEG(ret);
+	return ret;
+}
+
 int
 stat(const char *path, struct stat *st)
 {
@@ -721,6 +1146,22 @@ stat(const char *path, struct stat *st)
 	return ret;
 }
 
+int
+swapoff(const char *path)
+{
+	int ret = syscall(SA(path), 0, 0, 0, 0, SYS_SWAPOFF);
+	ERRNO_NZ(ret);
+	return ret;
+}
+
+int
+swapon(const char *path, off_t off, size_t len)
+{
+	int ret = syscall(SA(path), SA(off), SA(len), 0, 0, SYS_SWAPON);
+	ERRNO_NZ(ret);
+	return ret;
+}
+
 int
 sync(void)
 {
@@ -745,6 +1186,40 @@ sys_info(long n)
 	return ret;
 }
 
+long
+sys_cgroup(long op, long id, long kind, long lim)
+{
+	long ret = syscall(op, id, kind, lim, 0, SYS_CGROUP);
+	ERRNO_NEG(ret);
+	return ret;
+}
+
+int
+timerfd_create(int clock, int flags)
+{
+	int ret = syscall(SA(clock), SA(flags), 0, 0, 0, SYS_TFD_CREATE);
+	ERRNO_NEG(ret);
+	return ret;
+}
+
+int
+timerfd_gettime(int fd, struct itimerspec *cur)
+{
+	int ret = syscall(SA(fd), SA(cur), 0, 0, 0, SYS_TFD_GETTIME);
+	ERRNO_NZ(ret);
+	return ret;
+}
+
+int
+timerfd_settime(int fd, int flags, const struct itimerspec *new,
+    struct itimerspec *old)
+{
+	int ret = syscall(SA(fd), SA(flags), SA(new), SA(old), 0,
+	    SYS_TFD_SETTIME);
+	ERRNO_NZ(ret);
+	return ret;
+}
+
 int
 truncate(const char *p, off_t newlen)
 {
@@ -773,6 +1248,83 @@ rmdir(const char *path)
 	return _unlink(path, 1);
 }
 
+int
+sched_getaffinity(pid_t pid, size_t sz, cpu_set_t *set)
+{
+	int ret = syscall(SA(pid), SA(sz), SA(set), 0, 0,
+	    SYS_SCHED_GETAFFINITY);
+	ERRNO_NEG(ret);
+	return ret < 0 ? ret : 0;
+}
+
+int
+sched_getparam(pid_t pid, struct sched_param *param)
+{
+	int ret = syscall(SA(pid), SA(param), 0, 0, 0, SYS_SCHED_GETPARAM);
+	ERRNO_NZ(ret);
+	return ret;
+}
+
+int
+sched_get_priority_max(int policy)
+{
+	switch (policy) {
+	case SCHED_OTHER:
+		return 0;
+	case SCHED_FIFO:
+		return 99;
+	}
+	errno = EINVAL;
+	return -1;
+}
+
+int
+sched_get_priority_min(int policy)
+{
+	switch (policy) {
+	case SCHED_OTHER:
+		return 0;
+	case SCHED_FIFO:
+		return 1;
+	}
+	errno = EINVAL;
+	return -1;
+}
+
+int
+sched_getscheduler(pid_t pid)
+{
+	int ret = syscall(SA(pid), 0, 0, 0, 0, SYS_SCHED_GETSCHEDULER);
+	ERRNO_NEG(ret);
+	return ret;
+}
+
+int
+sched_setaffinity(pid_t pid, size_t sz, const cpu_set_t *set)
+{
+	int ret = syscall(SA(pid), SA(sz), SA(set), 0, 0,
+	    SYS_SCHED_SETAFFINITY);
+	ERRNO_NZ(ret);
+	return ret;
+}
+
+int
+sched_setscheduler(pid_t pid, int policy, const struct sched_param *param)
+{
+	int ret = syscall(SA(pid), SA(policy), SA(param), 0, 0,
+	    SYS_SCHED_SETSCHEDULER);
+	ERRNO_NZ(ret);
+	return ret;
+}
+
+int
+userfaultfd(int flags)
+{
+	int ret = syscall(SA(flags), 0, 0, 0, 0, SYS_USERFAULTFD);
+	ERRNO_NEG(ret);
+	return ret;
+}
+
 pid_t
 wait(int *status)
 {
@@ -862,6 +1414,70 @@ tfork_thread(struct tfork_t *args, long (*fn)(void *), void *fnarg)
 	return tid;
 }
 
+void
+clone_done(long status, long flags)
+{
+	if (flags & CLONE_THREAD)
+		threxit(status);
+	else
+		_exit(status);
+	errx(-1, "clone exit returned");
+}
+
+int
+clone(int (*fn)(void *), void *stack, int flags, void *arg, ...)
+{
+	if (!fn || !stack) {
+		errno = EINVAL;
+		return -1;
+	}
+	pid_t *ptid = NULL, *ctid = NULL;
+	void *tls = NULL;
+	if (flags & (CLONE_PARENT_SETTID | CLONE_SETTLS | CLONE_CHILD_SETTID |
+	    CLONE_CHILD_CLEARTID)) {
+		va_list ap;
+		va_start(ap, arg);
+		ptid = va_arg(ap, pid_t *);
+		tls = va_arg(ap, void *);
+		ctid = va_arg(ap, pid_t *);
+		va_end(ap);
+	}
+
+	// the child pops its function and argument off of the new stack,
+	// leaving the stack 16-byte aligned for the call, and then exits
+	// with the function's return value.
+	ulong *sp = (ulong *)((ulong)stack & ~0xful);
+	*--sp = 0;
+	*--sp = flags;
+	*--sp = (ulong)arg;
+	*--sp = (ulong)fn;
+
+	int ret;
+	register long r8 asm("r8") = (long)tls;
+	asm volatile(
+	    "movq	%%rsp, %%r10\n"
+	    "leaq	2(%%rip), %%r11\n"
+	    "sysenter\n"
+	    "cmpl	$0, %%eax\n"
+	    // parent or error
+	    "jne	1f\n"
+	    // child
+	    "popq	%%rax\n"
+	    "popq	%%rdi\n"
+	    "call	*%%rax\n"
+	    "movslq	%%eax, %%rdi\n"
+	    "movq	(%%rsp), %%rsi\n"
+	    "call	clone_done\n"
+	    "movq	$0, 0x0\n"
+	    "1:\n"
+	    : "=a"(ret)
+	    : "0"(SYS_CLONE), "D"((long)flags), "S"(sp), "d"(ptid), "c"(ctid),
+	      "r"(r8)
+	    : SYSCALL_CLOBBERS);
+	ERRNO_NEG(ret);
+	return ret;
+}
+
 void
 threxit(long status)
 {
@@ -877,17 +1493,27 @@ thrwait(int tid, long *status)
 	return ret;
 }
 
+// the size of the inaccessible guard page below each thread stack, which
+// turns stack overflows into segfaults instead of silent corruption.
+#define _STKGUARD	(1ul << 12)
+
+// returns the top of a new stack of the given size; the guard page lies
+// immediately below the stack.
 static void *
 mkstack(size_t size)
 {
 	const size_t pgsize = 1 << 12;
 	size += pgsize - 1;
 	size &= ~(pgsize - 1);
-	char *ret = mmap(NULL, size, PROT_READ | PROT_WRITE,
+	char *ret = mmap(NULL, size + _STKGUARD, PROT_READ | PROT_WRITE,
 	    MAP_ANON | MAP_PRIVATE, -1, 0);
-	if (!ret)
+	if (ret == MAP_FAILED)
 		return NULL;
-	return ret + size;
+	if (mprotect(ret, _STKGUARD, PROT_NONE) == -1) {
+		munmap(ret, size + _STKGUARD);
+		return NULL;
+	}
+	return ret + _STKGUARD + size;
 }
 
 struct pcargs_t {
@@ -961,7 +1587,6 @@ pthread_create(pthread_t *t, pthread_attr_t *attrs, void* (*fn)(void *),
 			errx(-1, "stack size not aligned");
 	}
 	int ret;
-	// XXX setup guard page
 	void *stack = mkstack(stksz);
 	if (!stack) {
 		ret = ENOMEM;
@@ -981,9 +1606,9 @@ pthread_create(pthread_t *t, pthread_attr_t *attrs, void* (*fn)(void *),
 
 	pca->fn = fn;
 	pca->arg = arg;
-	pca->stack = stack - stksz;
+	pca->stack = stack - stksz - _STKGUARD;
 	pca->tls = newtls;
-	pca->stksz = stksz;
+	pca->stksz = stksz + _STKGUARD;
 	ret = tfork_thread(&tf, _pcreate, pca);
 	if (ret < 0) {
 		ret = -ret;
@@ -994,7 +1619,7 @@ pthread_create(pthread_t *t, pthread_attr_t *attrs, void* (*fn)(void *),
 both:
 	free(pca);
 errstack:
-	munmap(stack - stksz, stksz);
+	munmap(stack - stksz - _STKGUARD, stksz + _STKGUARD);
 tls:
 	free(newtls);
 	return ret;
@@ -1249,49 +1874,49 @@ pthread_attr_setstacksize(pthread_attr_t *a, size_t sz)
  * posix
  */
 
-int
-_posix_dups(const posix_spawn_file_actions_t *fa)
-{
-	int i;
-	for (i = 0; i < fa->dup2slot; i++) {
-		int ret;
-		int from = fa->dup2s[i].from;
-		int to = fa->dup2s[i].to;
-		if ((ret = dup2(from, to)) < 0)
-			return ret;
-	}
-	return 0;
-}
-
-static char *_environ[] = {"", NULL};
-
 int
 posix_spawn(pid_t *pid, const char *path, const posix_spawn_file_actions_t *fa,
     const posix_spawnattr_t *sa, char *const argv[], char *const envp[])
 {
 	if (sa)
 		errx(-1, "spawnattr not supported");
-	if (envp != NULL)
-		if (envp != _environ || !envp[0] ||
-		    envp[0][0] != '\0' || envp[1] != NULL)
-			errx(-1, "environ not supported");
-	pid_t p = fork();
-	if (p < 0)
-		return p;
-
-	int child = !p;
-	if (child) {
-		if (fa) {
-			if (_posix_dups(fa))
-				errx(127, "posix_spawn dups failed");
-		}
-		execv(path, argv);
-		errx(127, "posix_spawn exec failed");
-	}
+	if (envp == NULL)
+		envp = environ;
+	// the kernel creates the child and applies the file actions without
+	// copying our address space
+	long acts = fa ? SA(fa->acts) : 0;
+	long nacts = fa ? fa->nacts : 0;
+	int ret = syscall(SA(path), SA(argv), SA(envp), acts, nacts, SYS_SPAWN);
+	if (ret < 0)
+		return -ret;
 
 	if (pid)
-		*pid = p;
+		*pid = ret;
+
+	return 0;
+}
+
+static struct _spawnact_t *
+_spawnact(posix_spawn_file_actions_t *fa, int op, int fd)
+{
+	size_t nelms = sizeof(fa->acts)/sizeof(fa->acts[0]);
+	int myslot = fa->nacts++;
+	if (myslot < 0 || myslot >= nelms)
+		errx(-1, "bad spawn action slot: %d", myslot);
+
+	struct _spawnact_t *a = &fa->acts[myslot];
+	a->op = op;
+	a->fd = fd;
+	return a;
+}
+
+int
+posix_spawn_file_actions_addclose(posix_spawn_file_actions_t *fa, int fd)
+{
+	if (fd < 0)
+		return -EBADF;
 
+	_spawnact(fa, SPAWN_CLOSE, fd);
 	return 0;
 }
 
@@ -1301,19 +1926,35 @@ posix_spawn_file_actions_adddup2(posix_spawn_file_actions_t *fa, int ofd, int ne
 	if (ofd < 0 || newfd < 0)
 		return -EINVAL;
 
-	size_t nelms = sizeof(fa->dup2s)/sizeof(fa->dup2s[0]);
-	int myslot = fa->dup2slot++;
-	if (myslot < 0 || myslot >= nelms)
-		errx(-1, "bad dup2slot: %d", myslot);
+	struct _spawnact_t *a = _spawnact(fa, SPAWN_DUP2, newfd);
+	a->arg = ofd;
+	return 0;
+}
+
+int
+posix_spawn_file_actions_addopen(posix_spawn_file_actions_t *fa, int fd,
+    const char *path, int flags, mode_t mode)
+{
+	if (fd < 0)
+		return -EBADF;
 
-	fa->dup2s[myslot].from = ofd;
-	fa->dup2s[myslot].to = newfd;
+	char *cpy = strdup(path);
+	if (!cpy)
+		return -ENOMEM;
+	struct _spawnact_t *a = _spawnact(fa, SPAWN_OPEN, fd);
+	a->arg = flags;
+	a->mode = mode;
+	a->path = cpy;
 	return 0;
 }
 
 int
 posix_spawn_file_actions_destroy(posix_spawn_file_actions_t *fa)
 {
+	int i;
+	for (i = 0; i < fa->nacts; i++)
+		if (fa->acts[i].op == SPAWN_OPEN)
+			free(fa->acts[i].path);
 	return 0;
 }
 
@@ -2824,12 +3465,98 @@ readline(const char *prompt)
 	return readlineb;
 }
 
+static char **
+_envfind(const char *k)
+{
+	size_t l = strlen(k);
+	char **e;
+	for (e = environ; *e; e++)
+		if (strncmp(*e, k, l) == 0 && (*e)[l] == '=')
+			return e;
+	return NULL;
+}
+
+static int
+_envbad(const char *k)
+{
+	return k == NULL || *k == '\0' || strchr(k, '=') != NULL;
+}
+
+char *
+getenv(const char *k)
+{
+	if (_envbad(k))
+		return NULL;
+	char **e = _envfind(k);
+	if (e == NULL)
+		return NULL;
+	return *e + strlen(k) + 1;
+}
+
+// the environment strings passed by exec are never freed since they are not
+// allocated by malloc; only entries added by setenv are.
+static int _envmalloced;
+
 int
 setenv(const char *k, const char *v, int overwrite)
 {
-	printf("setenv: no environment yet\n");
-	errno = ENOSYS;
-	return -1;
+	if (_envbad(k)) {
+		errno = EINVAL;
+		return -1;
+	}
+	char **e = _envfind(k);
+	if (e && !overwrite)
+		return 0;
+	size_t kl = strlen(k);
+	size_t vl = strlen(v);
+	char *new = malloc(kl + vl + 2);
+	if (new == NULL) {
+		errno = ENOMEM;
+		return -1;
+	}
+	memmove(new, k, kl);
+	new[kl] = '=';
+	memmove(new + kl + 1, v, vl + 1);
+	if (e) {
+		*e = new;
+		return 0;
+	}
+
+	int n;
+	for (n = 0; environ[n]; n++)
+		;
+	char **ne;
+	if (_envmalloced)
+		ne = realloc(environ, (n + 2)*sizeof(char *));
+	else {
+		ne = malloc((n + 2)*sizeof(char *));
+		if (ne)
+			memmove(ne, environ, n*sizeof(char *));
+	}
+	if (ne == NULL) {
+		free(new);
+		errno = ENOMEM;
+		return -1;
+	}
+	ne[n] = new;
+	ne[n + 1] = NULL;
+	environ = ne;
+	_envmalloced = 1;
+	return 0;
+}
+
+int
+unsetenv(const char *k)
+{
+	if (_envbad(k)) {
+		errno = EINVAL;
+		return -1;
+	}
+	char **e;
+	while ((e = _envfind(k)) != NULL)
+		for (; *e; e++)
+			*e = *(e + 1);
+	return 0;
 }
 
 static inline int _fdisset(int fd, fd_set *fds)
@@ -3009,6 +3736,7 @@ static const char * const _errstr[] = {
 	[EINTR] = "Interrupted system call",
 	[EIO] = "Input/output error",
 	[E2BIG] = "Argument list too long",
+	[ENOEXEC] = "Exec format error",
 	[EBADF] = "Bad file descriptor",
 	[EAGAIN] = "Resource temporarily unavailable",
 	[ECHILD] = "No child processes",
@@ -3024,14 +3752,19 @@ static const char * const _errstr[] = {
 	[EINVAL] = "Invalid argument",
 	[ENFILE] = "Too many open files in system",
 	[EMFILE] = "Too many open files",
+	[ETXTBSY] = "Text file busy",
+	[EFBIG] = "File too large",
 	[ENOSPC] = "No space left on device",
 	[ESPIPE] = "Illegal seek",
 	[EPIPE] = "Broken pipe",
 	[ERANGE] = "Result too large",
+	[EDEADLK] = "Resource deadlock avoided",
 	[ENAMETOOLONG] = "File name too long",
 	[ENOSYS] = "Function not implemented",
 	[ENOTEMPTY] = "Directory not empty",
 	[EDESTADDRREQ] = "Destination address required",
+	[ENOMSG] = "No message of desired type",
+	[EIDRM] = "Identifier removed",
 	[EAFNOSUPPORT] = "Protocol family not supported",
 	[EADDRINUSE] = "Address already in use",
 	[EADDRNOTAVAIL] = "Can't assign requested address",
@@ -3508,12 +4241,15 @@ out:
 #endif
 
 char __progname[64];
+static char *_environ[] = {NULL};
 char **environ = _environ;
 
 void
-_start(int argc, char **argv, struct kinfo_t *k)
+_start(int argc, char **argv, struct kinfo_t *k, char **envp)
 {
 	kinfo = k;
+	if (envp)
+		environ = envp;
 
 	if (argc)
 		strncpy(__progname, argv[0], sizeof(__progname));
@@ -3546,12 +4282,6 @@ long timezone;
 	return x;	\
 	} while (0)
 
-char *
-getenv(char *name)
-{
-	HACK(NULL);
-}
-
 uid_t
 geteuid(void)
 {
@@ -3666,9 +4396,16 @@ globfree(glob_t *a)
 int
 ioctl(int fd, ulong req, ...)
 {
-	if (req != FIOASYNC)
-		errx(-1, "nyet");
-	HACK(0);
+	if (req == FIOASYNC)
+		HACK(0);
+	// only userfaultfds support ioctls
+	va_list l;
+	va_start(l, req);
+	void *arg = va_arg(l, void *);
+	va_end(l);
+	int ret = syscall(SA(fd), SA(req), SA(arg), 0, 0, SYS_IOCTL);
+	ERRNO_NZ(ret);
+	return ret;
 }
 
 int
@@ -3708,12 +4445,6 @@ sigsuspend(const sigset_t *a)
 	errx(-1, "sigsuspend no imp");
 }
 
-int
-setpriority(int a, int b, int c)
-{
-	FAIL;
-}
-
 uid_t
 getuid(void)
 {
@@ -146,6 +146,18 @@ void doredirs(char *infn, char *outfn, int append)
 
 int main(int argc, char **argv)
 {
+	// run a script, such as one executed via "#!/bin/lsh", without
+	// prompting
+	char *prompt = "# ";
+	if (argc > 1) {
+		int fd = open(argv[1], O_RDONLY);
+		if (fd < 0)
+			err(-1, "open %s", argv[1]);
+		if (dup2(fd, 0) < 0)
+			err(-1, "dup2");
+		close(fd);
+		prompt = NULL;
+	}
 	int nbgs = 0;
 	while (1) {
 		// if you change the output of lsh, you need to update
@@ -155,7 +167,7 @@ int main(int argc, char **argv)
 		size_t sz = sizeof(args)/sizeof(args[0]);
 		char *infile, *outfile;
 		int append;
-		char *p = readline("# ");
+		char *p = readline(prompt);
 		if (p == NULL)
 			exit(0);
 		char *com;
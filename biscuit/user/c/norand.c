@@ -0,0 +1,13 @@
+#include <litc.h>
+
+// runs a command with address space layout randomization disabled, which is
+// useful for reproducible benchmarks.
+int main(int argc, char **argv)
+{
+	if (argc < 2)
+		errx(-1, "usage: %s <command> <arg1> ...", argv[0]);
+	if (personality(ADDR_NO_RANDOMIZE) == -1)
+		err(-1, "personality");
+	execvp(argv[1], &argv[1]);
+	err(-1, "exec %s", argv[1]);
+}
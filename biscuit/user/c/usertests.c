@@ -18,6 +18,8 @@ char *echoargv[] = { "echo", "ALL", "TESTS", "PASSED", 0 };
 #define O_CREATE	O_CREAT
 #define MAXFILE		NADDR*NADDR
 
+void stchk(int, int);
+
 // does chdir() call iput(p->cwd) in a transaction?
 void
 iputtest(void)
@@ -141,170 +143,2704 @@ opentest(void)
 }
 
 void
-writetest(void)
+writetest(void)
+{
+  int fd;
+  int i;
+
+  printf("small file test\n");
+  fd = open("small", O_CREATE|O_RDWR);
+  if(fd >= 0){
+    printf("creat small succeeded; ok\n");
+  } else {
+    printf("error: creat small failed!\n");
+    exit(0);
+  }
+  for(i = 0; i < 100; i++){
+    if(write(fd, "aaaaaaaaaa", 10) != 10){
+      printf("error: write aa %d new file failed\n", i);
+      exit(0);
+    }
+    if(write(fd, "bbbbbbbbbb", 10) != 10){
+      printf("error: write bb %d new file failed\n", i);
+      exit(0);
+    }
+  }
+  printf("writes ok\n");
+  close(fd);
+  fd = open("small", O_RDONLY);
+  if(fd >= 0){
+    printf("open small succeeded ok\n");
+  } else {
+    printf("error: open small failed!\n");
+    exit(0);
+  }
+  i = read(fd, buf, 2000);
+  if(i == 2000){
+    printf("read succeeded ok\n");
+  } else {
+    printf("read failed\n");
+    exit(0);
+  }
+  close(fd);
+
+  if(unlink("small") < 0){
+    printf("unlink small failed\n");
+    exit(0);
+  }
+  printf("small file test ok\n");
+}
+
+void
+writetest1(void)
+{
+  int i, fd, n;
+
+  printf("big files test\n");
+
+  fd = open("big", O_CREATE|O_RDWR);
+  if(fd < 0){
+    printf("error: creat big failed!\n");
+    exit(0);
+  }
+
+  for(i = 0; i < MAXFILE; i++){
+    ((int*)buf)[0] = i;
+    if(write(fd, buf, BSIZE) != BSIZE){
+      printf("error: write big file failed\n");
+      exit(0);
+    }
+  }
+
+  close(fd);
+
+  fd = open("big", O_RDONLY);
+  if(fd < 0){
+    printf("error: open big failed!\n");
+    exit(0);
+  }
+
+  n = 0;
+  for(;;){
+    i = read(fd, buf, BSIZE);
+    if(i == 0){
+      if(n == MAXFILE - 1){
+        printf("read only %d blocks from big", n);
+        exit(0);
+      }
+      break;
+    } else if(i != BSIZE){
+      printf("read failed %d\n", i);
+      exit(0);
+    }
+    if(((int*)buf)[0] != n){
+      printf("read content of block %d is %d\n",
+             n, ((int*)buf)[0]);
+      exit(0);
+    }
+    n++;
+  }
+  close(fd);
+  if(unlink("big") < 0){
+    printf("unlink big failed\n");
+    exit(0);
+  }
+  printf("big files ok\n");
+}
+
+void
+createtest(void)
+{
+  int i, fd;
+
+  printf("many creates, followed by unlink test\n");
+
+  name[0] = 'a';
+  name[2] = '\0';
+  for(i = 0; i < 52; i++){
+    name[1] = '0' + i;
+    fd = open(name, O_CREATE|O_RDWR);
+    close(fd);
+  }
+  name[0] = 'a';
+  name[2] = '\0';
+  for(i = 0; i < 52; i++){
+    name[1] = '0' + i;
+    unlink(name);
+  }
+  printf("many creates, followed by unlink; ok\n");
+}
+
+void dirtest(void)
+{
+  printf("mkdir test\n");
+
+  if(mkdir("dir0") < 0){
+    printf("mkdir failed\n");
+    exit(0);
+  }
+
+  if(chdir("dir0") < 0){
+    printf("chdir dir0 failed\n");
+    exit(0);
+  }
+
+  if(chdir("..") < 0){
+    printf("chdir .. failed\n");
+    exit(0);
+  }
+
+  if(rmdir("dir0") < 0){
+    printf("rmdir dir0 failed\n");
+    exit(0);
+  }
+  if (mkdir("/") != -1)
+    errx(-1, "expected failure");
+  printf("mkdir test ok\n");
+}
+
+void
+exectest(void)
+{
+  printf("exec test\n");
+  if(exec("/bin/echo", echoargv) < 0){
+    printf("exec echo failed\n");
+    exit(0);
+  }
+}
+
+void
+aslrtest(void)
+{
+	printf("aslr test\n");
+	int old = personality(0xffffffff);
+	if (old == -1)
+		err(-1, "personality");
+	if (personality(ADDR_NO_RANDOMIZE) != old)
+		errx(-1, "personality mismatch");
+	if (personality(0xffffffff) != ADDR_NO_RANDOMIZE)
+		errx(-1, "personality not set");
+	if (personality(0x8) != -1 || errno != EINVAL)
+		errx(-1, "bad personality accepted");
+
+	// the flag is inherited by children
+	pid_t c = fork();
+	if (c == -1)
+		err(-1, "fork");
+	if (c == 0) {
+		if (personality(0xffffffff) != ADDR_NO_RANDOMIZE)
+			errx(-1, "personality not inherited");
+		exit(0);
+	}
+	int status;
+	if (wait(&status) != c)
+		errx(-1, "wrong child");
+	if (!WIFEXITED(status) || WEXITSTATUS(status) != 0)
+		errx(-1, "child failed");
+	if (personality(old) != ADDR_NO_RANDOMIZE)
+		errx(-1, "personality mismatch");
+	printf("aslr test ok\n");
+}
+
+static void
+_mpchild(char *p, int wr, int expsig)
+{
+	pid_t c = fork();
+	if (c == -1)
+		err(-1, "fork");
+	if (c == 0) {
+		if (wr)
+			*p = 'X';
+		else
+			printf("%c", *(volatile char *)p);
+		exit(0);
+	}
+	int status;
+	if (wait(&status) != c)
+		errx(-1, "wrong child");
+	stchk(status, expsig);
+}
+
+void
+mprotecttest(void)
+{
+	printf("mprotect test\n");
+	const size_t pgsz = 4096;
+	char *p = mmap(NULL, 3*pgsz, PROT_READ | PROT_WRITE,
+	    MAP_PRIVATE | MAP_ANON, -1, 0);
+	if (p == MAP_FAILED)
+		err(-1, "mmap");
+	int i;
+	for (i = 0; i < 3*pgsz; i++)
+		p[i] = 'A' + i/pgsz;
+
+	// read-only middle page
+	if (mprotect(p + pgsz, pgsz, PROT_READ) == -1)
+		err(-1, "mprotect");
+	_mpchild(p + pgsz, 1, SIGSEGV);
+	_mpchild(p, 1, 0);
+	_mpchild(p + 2*pgsz, 1, 0);
+
+	// inaccessible middle page
+	if (mprotect(p + pgsz, pgsz, PROT_NONE) == -1)
+		err(-1, "mprotect");
+	_mpchild(p + pgsz, 0, SIGSEGV);
+	int fd = open("/bin/cat", O_RDONLY);
+	if (fd == -1)
+		err(-1, "open");
+	if (read(fd, p + pgsz, 10) != -1 || errno != EFAULT)
+		errx(-1, "read to PROT_NONE succeeded");
+	if (close(fd) == -1)
+		err(-1, "close");
+
+	// restoring access preserves the page's contents
+	if (mprotect(p, 3*pgsz, PROT_READ | PROT_WRITE) == -1)
+		err(-1, "mprotect");
+	for (i = 0; i < 3*pgsz; i++)
+		if (p[i] != 'A' + i/pgsz)
+			errx(-1, "data mismatch");
+	p[pgsz] = 'Z';
+
+	// unmapping may span several mappings
+	if (mprotect(p + pgsz, pgsz, PROT_READ) == -1)
+		err(-1, "mprotect");
+	if (munmap(p, 3*pgsz) == -1)
+		err(-1, "munmap");
+	if (mprotect(p, pgsz, PROT_READ) != -1 || errno != ENOMEM)
+		errx(-1, "mprotect on unmapped memory");
+
+	// reserve address space, then make part of it usable
+	p = mmap(NULL, 4*pgsz, PROT_NONE, MAP_PRIVATE | MAP_ANON, -1, 0);
+	if (p == MAP_FAILED)
+		err(-1, "mmap");
+	_mpchild(p, 0, SIGSEGV);
+	if (mprotect(p + pgsz, 2*pgsz, PROT_READ | PROT_WRITE) == -1)
+		err(-1, "mprotect");
+	for (i = pgsz; i < 3*pgsz; i++)
+		if (p[i] != 0)
+			errx(-1, "not zero");
+	memset(p + pgsz, 'q', 2*pgsz);
+	_mpchild(p + 3*pgsz, 1, SIGSEGV);
+	if (mprotect(p, pgsz, PROT_READ | PROT_EXEC | 0x100) != -1 ||
+	    errno != EINVAL)
+		errx(-1, "bad prot accepted");
+	if (mprotect(p + 1, pgsz, PROT_READ) != -1 || errno != EINVAL)
+		errx(-1, "unaligned address accepted");
+	if (munmap(p, 4*pgsz) == -1)
+		err(-1, "munmap");
+	printf("mprotect test ok\n");
+}
+
+void
+mremaptest(void)
+{
+	printf("mremap test\n");
+	const size_t pgsz = 4096;
+	char *p = mmap(NULL, 8*pgsz, PROT_READ | PROT_WRITE,
+	    MAP_PRIVATE | MAP_ANON, -1, 0);
+	if (p == MAP_FAILED)
+		err(-1, "mmap");
+	memset(p, 'a', 8*pgsz);
+
+	// MAP_FIXED replaces the middle of the mapping
+	char *q = mmap(p + 2*pgsz, 2*pgsz, PROT_READ | PROT_WRITE,
+	    MAP_PRIVATE | MAP_ANON | MAP_FIXED, -1, 0);
+	if (q != p + 2*pgsz)
+		err(-1, "mmap fixed");
+	int i;
+	for (i = 0; i < 8*pgsz; i++) {
+		char w = i >= 2*pgsz && i < 4*pgsz ? 0 : 'a';
+		if (p[i] != w)
+			errx(-1, "fixed mismatch at %d", i);
+	}
+	if (mmap(p + 1, pgsz, PROT_READ, MAP_PRIVATE | MAP_ANON | MAP_FIXED,
+	    -1, 0) != MAP_FAILED || errno != EINVAL)
+		errx(-1, "unaligned fixed mapping");
+
+	// MAP_FIXED_NOREPLACE only uses unmapped space
+	if (mmap(p, pgsz, PROT_READ, MAP_PRIVATE | MAP_ANON |
+	    MAP_FIXED_NOREPLACE, -1, 0) != MAP_FAILED || errno != EEXIST)
+		errx(-1, "replaced mapping");
+	if (munmap(p + 7*pgsz, pgsz) == -1)
+		err(-1, "munmap");
+	q = mmap(p + 7*pgsz, pgsz, PROT_READ | PROT_WRITE,
+	    MAP_PRIVATE | MAP_ANON | MAP_FIXED_NOREPLACE, -1, 0);
+	if (q != p + 7*pgsz)
+		err(-1, "mmap noreplace");
+	if (*q != 0)
+		errx(-1, "not zero");
+	if (munmap(p + 4*pgsz, 4*pgsz) == -1)
+		err(-1, "munmap");
+
+	// grow in place into the unmapped pages
+	if (mremap(p, 4*pgsz, 6*pgsz, 0) != p)
+		err(-1, "mremap grow");
+	for (i = 4*pgsz; i < 6*pgsz; i++)
+		if (p[i] != 0)
+			errx(-1, "not zero");
+	memset(p + 4*pgsz, 'b', 2*pgsz);
+
+	// a mapping in the way prevents growing in place
+	q = mmap(p + 6*pgsz, pgsz, PROT_READ, MAP_PRIVATE | MAP_ANON |
+	    MAP_FIXED_NOREPLACE, -1, 0);
+	if (q != p + 6*pgsz)
+		err(-1, "mmap noreplace");
+	if (mremap(p, 6*pgsz, 12*pgsz, 0) != MAP_FAILED || errno != ENOMEM)
+		errx(-1, "grew over mapping");
+	char *n = mremap(p, 6*pgsz, 12*pgsz, MREMAP_MAYMOVE);
+	if (n == MAP_FAILED)
+		err(-1, "mremap move");
+	if (n == p)
+		errx(-1, "did not move");
+	for (i = 0; i < 12*pgsz; i++) {
+		char w = 'a';
+		if (i >= 2*pgsz && i < 4*pgsz)
+			w = 0;
+		else if (i >= 4*pgsz && i < 6*pgsz)
+			w = 'b';
+		else if (i >= 6*pgsz)
+			w = 0;
+		if (n[i] != w)
+			errx(-1, "moved mismatch at %d", i);
+	}
+	_mpchild(p, 0, SIGSEGV);
+	if (munmap(q, pgsz) == -1)
+		err(-1, "munmap");
+
+	// shrink
+	if (mremap(n, 12*pgsz, 2*pgsz, 0) != n)
+		err(-1, "mremap shrink");
+	_mpchild(n + 2*pgsz, 0, SIGSEGV);
+	if (mremap(n, 4*pgsz, 8*pgsz, MREMAP_MAYMOVE) != MAP_FAILED ||
+	    errno != EFAULT)
+		errx(-1, "remapped unmapped pages");
+	if (munmap(n, 2*pgsz) == -1)
+		err(-1, "munmap");
+
+	// the new pages of a shared mapping are shared too
+	p = mmap(NULL, pgsz, PROT_READ | PROT_WRITE, MAP_SHARED | MAP_ANON,
+	    -1, 0);
+	if (p == MAP_FAILED)
+		err(-1, "mmap");
+	p[0] = 'c';
+	p = mremap(p, pgsz, 3*pgsz, MREMAP_MAYMOVE);
+	if (p == MAP_FAILED)
+		err(-1, "mremap shared");
+	pid_t c = fork();
+	if (c == -1)
+		err(-1, "fork");
+	if (c == 0) {
+		if (p[0] != 'c')
+			errx(-1, "shared mismatch");
+		p[2*pgsz] = 'd';
+		exit(0);
+	}
+	int status;
+	if (wait(&status) != c)
+		errx(-1, "wrong child");
+	stchk(status, 0);
+	if (p[2*pgsz] != 'd')
+		errx(-1, "grown shared page is not shared");
+	if (munmap(p, 3*pgsz) == -1)
+		err(-1, "munmap");
+	printf("mremap test ok\n");
+}
+
+void
+swaptest(void)
+{
+	printf("swap test\n");
+	const char *sf = "swapfile";
+	const size_t pgsz = 4096;
+	const int npg = 256;
+	int fd = open(sf, O_CREAT | O_RDWR);
+	if (fd == -1)
+		err(-1, "open");
+	char buf[4096];
+	memset(buf, 0, sizeof(buf));
+	int i;
+	for (i = 0; i < npg; i++)
+		if (write(fd, buf, sizeof(buf)) != sizeof(buf))
+			err(-1, "write");
+
+	if (swapon(sf, 1, 0) != -1 || errno != EINVAL)
+		errx(-1, "unaligned swap area");
+	if (swapon(sf, 0, (npg + 1)*pgsz) != -1 || errno != EINVAL)
+		errx(-1, "swap area beyond file");
+	if (swapon(sf, 0, 0) == -1)
+		err(-1, "swapon");
+	if (swapon(sf, 0, 0) != -1 || errno != EBUSY)
+		errx(-1, "second swapon");
+
+	// the swap file's blocks belong to the swap area
+	if (write(fd, buf, 1) != -1 || errno != ETXTBSY)
+		errx(-1, "wrote swap file");
+	if (ftruncate(fd, 0) != -1 || errno != ETXTBSY)
+		errx(-1, "truncated swap file");
+
+	// memory stays intact whether or not it is paged out
+	const size_t sz = 4 << 20;
+	char *p = mmap(NULL, sz, PROT_READ | PROT_WRITE,
+	    MAP_PRIVATE | MAP_ANON, -1, 0);
+	if (p == MAP_FAILED)
+		err(-1, "mmap");
+	for (i = 0; i < sz; i += pgsz)
+		p[i] = i / pgsz;
+	pid_t c = fork();
+	if (c == -1)
+		err(-1, "fork");
+	if (c == 0) {
+		for (i = 0; i < sz; i += pgsz) {
+			if (p[i] != (char)(i / pgsz))
+				errx(-1, "child mismatch at %d", i);
+			p[i] = 0;
+		}
+		exit(0);
+	}
+	int status;
+	if (wait(&status) != c)
+		errx(-1, "wrong child");
+	stchk(status, 0);
+
+	if (swapoff("nonexistent") != -1)
+		errx(-1, "swapoff of bad path");
+	if (swapoff(sf) == -1)
+		err(-1, "swapoff");
+	if (swapoff(sf) != -1 || errno != EINVAL)
+		errx(-1, "second swapoff");
+	for (i = 0; i < sz; i += pgsz)
+		if (p[i] != (char)(i / pgsz))
+			errx(-1, "mismatch at %d", i);
+	if (munmap(p, sz) == -1)
+		err(-1, "munmap");
+	if (write(fd, buf, 1) != 1)
+		err(-1, "write after swapoff");
+	close(fd);
+	if (unlink(sf) == -1)
+		err(-1, "unlink");
+	printf("swap test ok\n");
+}
+
+void
+thptest(void)
+{
+	printf("huge page test\n");
+	const size_t pgsz = 4096;
+	const size_t hsz = 2 << 20;
+	const size_t sz = 4*hsz;
+	char *p = mmap(NULL, sz, PROT_READ | PROT_WRITE,
+	    MAP_PRIVATE | MAP_ANON, -1, 0);
+	if (p == MAP_FAILED)
+		err(-1, "mmap");
+	if ((ulong)p % hsz != 0)
+		errx(-1, "large mapping is not aligned");
+	int i;
+	for (i = 0; i < sz; i += pgsz)
+		p[i] = i / pgsz;
+
+	// copy-on-write splits the huge pages
+	pid_t c = fork();
+	if (c == -1)
+		err(-1, "fork");
+	if (c == 0) {
+		for (i = 0; i < sz; i += pgsz) {
+			if (p[i] != (char)(i / pgsz))
+				errx(-1, "child mismatch at %d", i);
+			p[i] = 0;
+		}
+		exit(0);
+	}
+	int status;
+	if (wait(&status) != c)
+		errx(-1, "wrong child");
+	stchk(status, 0);
+	for (i = 0; i < sz; i += pgsz)
+		if (p[i] != (char)(i / pgsz))
+			errx(-1, "mismatch at %d", i);
+
+	// partial mprotect and munmap split the huge pages
+	if (mprotect(p + hsz + pgsz, pgsz, PROT_READ) == -1)
+		err(-1, "mprotect");
+	_mpchild(p + hsz + pgsz, 1, SIGSEGV);
+	_mpchild(p + hsz, 1, 0);
+	if (munmap(p + 2*hsz + pgsz, pgsz) == -1)
+		err(-1, "munmap");
+	_mpchild(p + 2*hsz + pgsz, 0, SIGSEGV);
+	for (i = 0; i < sz; i += pgsz) {
+		if (i == 2*hsz + pgsz)
+			continue;
+		if (p[i] != (char)(i / pgsz))
+			errx(-1, "mismatch after split at %d", i);
+	}
+
+	if (madvise(p, hsz, 1000) != -1 || errno != EINVAL)
+		errx(-1, "bad advice accepted");
+	if (madvise(p + 1, pgsz, MADV_HUGEPAGE) != -1 || errno != EINVAL)
+		errx(-1, "unaligned address accepted");
+	if (madvise(p + 2*hsz, 2*pgsz, MADV_HUGEPAGE) != -1 || errno != ENOMEM)
+		errx(-1, "advised unmapped pages");
+	if (munmap(p, sz) == -1)
+		err(-1, "munmap");
+
+	// huge pages may be disabled and enabled again
+	p = mmap(NULL, sz, PROT_READ | PROT_WRITE,
+	    MAP_PRIVATE | MAP_ANON, -1, 0);
+	if (p == MAP_FAILED)
+		err(-1, "mmap");
+	if (madvise(p + pgsz, hsz, MADV_NOHUGEPAGE) == -1)
+		err(-1, "madvise");
+	if (madvise(p + pgsz, pgsz, MADV_HUGEPAGE) == -1)
+		err(-1, "madvise");
+	for (i = 0; i < sz; i += pgsz)
+		p[i] = 'h';
+	for (i = 0; i < sz; i += pgsz)
+		if (p[i] != 'h')
+			errx(-1, "mismatch after madvise at %d", i);
+	if (munmap(p, sz) == -1)
+		err(-1, "munmap");
+	printf("huge page test ok\n");
+}
+
+void
+advisetest(void)
+{
+	printf("madvise test\n");
+	const char *f = "advisefile";
+	const size_t pgsz = 4096;
+	const int npg = 32;
+	int fd = open(f, O_CREAT | O_RDWR);
+	if (fd == -1)
+		err(-1, "open");
+	char buf[4096];
+	int i;
+	for (i = 0; i < npg; i++) {
+		memset(buf, 'a' + i % 26, sizeof(buf));
+		if (write(fd, buf, sizeof(buf)) != sizeof(buf))
+			err(-1, "write");
+	}
+
+	// writes through a shared mapping reach the file
+	char *p = mmap(NULL, npg*pgsz, PROT_READ | PROT_WRITE, MAP_SHARED,
+	    fd, 0);
+	if (p == MAP_FAILED)
+		err(-1, "mmap");
+	if (madvise(p, npg*pgsz, MADV_SEQUENTIAL) == -1)
+		err(-1, "madvise");
+	for (i = 0; i < npg; i++)
+		if (p[i*pgsz] != 'a' + i % 26)
+			errx(-1, "sequential mismatch at %d", i);
+	p[pgsz] = 'X';
+	if (msync(p, npg*pgsz, MS_SYNC) == -1)
+		err(-1, "msync");
+	if (msync(p, pgsz, MS_ASYNC | MS_INVALIDATE) == -1)
+		err(-1, "msync");
+	if (msync(p, pgsz, MS_ASYNC | MS_SYNC) != -1 || errno != EINVAL)
+		errx(-1, "conflicting flags accepted");
+	if (msync(p + 1, pgsz, MS_SYNC) != -1 || errno != EINVAL)
+		errx(-1, "unaligned address accepted");
+	if (pread(fd, buf, 1, pgsz) != 1)
+		err(-1, "pread");
+	if (buf[0] != 'X')
+		errx(-1, "msync'ed write not in file");
+
+	// dropped shared file pages keep their data
+	p[2*pgsz] = 'Y';
+	if (madvise(p, npg*pgsz, MADV_DONTNEED) == -1)
+		err(-1, "madvise");
+	if (p[2*pgsz] != 'Y' || p[pgsz] != 'X')
+		errx(-1, "shared file data lost");
+	if (munmap(p, npg*pgsz) == -1)
+		err(-1, "munmap");
+	if (msync(p, pgsz, MS_SYNC) != -1 || errno != ENOMEM)
+		errx(-1, "synced unmapped pages");
+
+	// dropped private pages are read from the file again
+	p = mmap(NULL, npg*pgsz, PROT_READ | PROT_WRITE, MAP_PRIVATE, fd, 0);
+	if (p == MAP_FAILED)
+		err(-1, "mmap");
+	if (madvise(p, npg*pgsz, MADV_WILLNEED) == -1)
+		err(-1, "madvise");
+	if (madvise(p, npg*pgsz, MADV_RANDOM) == -1)
+		err(-1, "madvise");
+	p[3*pgsz] = 'Z';
+	if (madvise(p + 3*pgsz, pgsz, MADV_DONTNEED) == -1)
+		err(-1, "madvise");
+	if (p[3*pgsz] != 'a' + 3)
+		errx(-1, "private file page not dropped");
+	if (munmap(p, npg*pgsz) == -1)
+		err(-1, "munmap");
+
+	// dropped private anonymous pages are zero; shared ones are kept
+	p = mmap(NULL, 2*pgsz, PROT_READ | PROT_WRITE,
+	    MAP_PRIVATE | MAP_ANON, -1, 0);
+	if (p == MAP_FAILED)
+		err(-1, "mmap");
+	p[0] = p[pgsz] = 'q';
+	if (madvise(p, pgsz, MADV_DONTNEED) == -1)
+		err(-1, "madvise");
+	if (p[0] != 0 || p[pgsz] != 'q')
+		errx(-1, "anonymous page not dropped");
+	if (munmap(p, 2*pgsz) == -1)
+		err(-1, "munmap");
+	p = mmap(NULL, pgsz, PROT_READ | PROT_WRITE, MAP_SHARED | MAP_ANON,
+	    -1, 0);
+	if (p == MAP_FAILED)
+		err(-1, "mmap");
+	p[0] = 'r';
+	if (madvise(p, pgsz, MADV_DONTNEED) == -1)
+		err(-1, "madvise");
+	if (p[0] != 'r')
+		errx(-1, "shared anonymous page dropped");
+	if (munmap(p, pgsz) == -1)
+		err(-1, "munmap");
+
+	close(fd);
+	if (unlink(f) == -1)
+		err(-1, "unlink");
+	printf("madvise test ok\n");
+}
+
+void
+rsstest(void)
+{
+	printf("rss test\n");
+	const size_t pgsz = 4096;
+	const size_t sz = 256*pgsz;
+	long anon = sys_info(SINFO_RSSANON);
+	long shared = sys_info(SINFO_RSSSHARED);
+	if (anon <= 0 || shared < 0)
+		errx(-1, "bad rss: %ld %ld", anon, shared);
+
+	// private anonymous pages are mapped eagerly
+	char *p = mmap(NULL, sz, PROT_READ | PROT_WRITE,
+	    MAP_PRIVATE | MAP_ANON, -1, 0);
+	if (p == MAP_FAILED)
+		err(-1, "mmap");
+	if (sys_info(SINFO_RSSANON) < anon + sz)
+		errx(-1, "anonymous pages not counted");
+	char *s = mmap(NULL, sz, PROT_READ | PROT_WRITE,
+	    MAP_SHARED | MAP_ANON, -1, 0);
+	if (s == MAP_FAILED)
+		err(-1, "mmap");
+	if (sys_info(SINFO_RSSSHARED) != shared + sz)
+		errx(-1, "shared pages not counted");
+	long max = sys_info(SINFO_MAXRSS);
+	if (max < anon + shared + 2*sz)
+		errx(-1, "bad max rss");
+
+	// a child maps the same pages
+	pid_t c = fork();
+	if (c == -1)
+		err(-1, "fork");
+	if (c == 0) {
+		if (sys_info(SINFO_RSSSHARED) != shared + sz)
+			errx(-1, "child shared rss mismatch");
+		if (sys_info(SINFO_RSSANON) < anon + sz)
+			errx(-1, "child anonymous rss mismatch");
+		exit(0);
+	}
+	int status;
+	struct rusage r;
+	if (wait4(c, &status, 0, &r) != c)
+		errx(-1, "wrong child");
+	stchk(status, 0);
+	if (r.ru_maxrss < (anon + sz) / 1024)
+		errx(-1, "child maxrss: %ld", r.ru_maxrss);
+
+	if (munmap(p, sz) == -1 || munmap(s, sz) == -1)
+		err(-1, "munmap");
+	if (sys_info(SINFO_RSSANON) >= anon + sz ||
+	    sys_info(SINFO_RSSSHARED) != shared)
+		errx(-1, "unmapped pages still counted");
+	if (sys_info(SINFO_MAXRSS) < max)
+		errx(-1, "max rss shrank");
+	if (getrusage(RUSAGE_SELF, &r) == -1)
+		err(-1, "getrusage");
+	if (r.ru_maxrss < max / 1024)
+		errx(-1, "maxrss %ld, want %ld", r.ru_maxrss, max / 1024);
+	if (getrusage(RUSAGE_CHILDREN, &r) == -1)
+		err(-1, "getrusage");
+	if (r.ru_maxrss < (anon + sz) / 1024)
+		errx(-1, "children maxrss: %ld", r.ru_maxrss);
+	printf("rss test ok\n");
+}
+
+void
+cgrouptest(void)
+{
+	printf("cgroup test\n");
+	const long pgsz = 4096;
+	long self = sys_cgroup(CGROUP_SELF, 0, 0, 0);
+	if (self < 0)
+		err(-1, "cgroup self");
+	long g = sys_cgroup(CGROUP_CREATE, self, 0, 0);
+	if (g < 0)
+		err(-1, "cgroup create");
+	if (sys_cgroup(CGROUP_GETLIM, g, CGROUP_PAGES, 0) != CGROUP_UNLIMITED)
+		errx(-1, "new group is limited");
+	if (sys_cgroup(CGROUP_SETLIM, g, 42, 0) != -1 || errno != EINVAL)
+		errx(-1, "bad kind");
+
+	// the child's pages are charged to the group when it joins; leave
+	// room for 512 more pages
+	long rss = sys_info(SINFO_RSSANON) + sys_info(SINFO_RSSFILE) +
+	    sys_info(SINFO_RSSSHARED);
+	long lim = rss/pgsz + 512;
+	if (sys_cgroup(CGROUP_SETLIM, g, CGROUP_PAGES, lim) == -1 ||
+	    sys_cgroup(CGROUP_SETLIM, g, CGROUP_PROCS, 2) == -1 ||
+	    sys_cgroup(CGROUP_SETLIM, g, CGROUP_HEAP, 1 << 26) == -1)
+		err(-1, "cgroup setlim");
+	if (sys_cgroup(CGROUP_GETLIM, g, CGROUP_PAGES, 0) != lim)
+		errx(-1, "limit mismatch");
+
+	pid_t c = fork();
+	if (c == -1)
+		err(-1, "fork");
+	if (c == 0) {
+		if (sys_cgroup(CGROUP_JOIN, g, 0, 0) == -1)
+			err(-1, "cgroup join");
+		if (sys_cgroup(CGROUP_SELF, 0, 0, 0) != g)
+			errx(-1, "not in group");
+		if (sys_cgroup(CGROUP_USAGE, g, CGROUP_PROCS, 0) != 1)
+			errx(-1, "procs not charged");
+		if (sys_cgroup(CGROUP_USAGE, g, CGROUP_PAGES, 0) < rss/pgsz/2)
+			errx(-1, "pages not charged");
+		// a process cannot raise its own limits or leave its group
+		if (sys_cgroup(CGROUP_SETLIM, g, CGROUP_PAGES,
+		    CGROUP_UNLIMITED) != -1 || errno != EPERM)
+			errx(-1, "raised own limit");
+		if (sys_cgroup(CGROUP_JOIN, self, 0, 0) != -1 ||
+		    errno != EPERM)
+			errx(-1, "left group");
+
+		// only 2 processes fit
+		int pp[2];
+		if (pipe(pp) == -1)
+			err(-1, "pipe");
+		pid_t gc = fork();
+		if (gc == -1)
+			err(-1, "fork");
+		if (gc == 0) {
+			char b;
+			close(pp[1]);
+			read(pp[0], &b, 1);
+			exit(0);
+		}
+		close(pp[0]);
+		if (fork() != -1 || errno != ENOMEM)
+			errx(-1, "process limit exceeded");
+		if (sys_cgroup(CGROUP_DESTROY, g, 0, 0) != -1 ||
+		    errno != EBUSY)
+			errx(-1, "destroyed used group");
+		close(pp[1]);
+		int status;
+		if (wait(&status) != gc)
+			errx(-1, "wrong child");
+		stchk(status, 0);
+
+		// anonymous pages are mapped eagerly
+		char *p = mmap(NULL, 1024*pgsz, PROT_READ | PROT_WRITE,
+		    MAP_PRIVATE | MAP_ANON, -1, 0);
+		if (p != MAP_FAILED || errno != ENOMEM)
+			errx(-1, "page limit exceeded");
+		p = mmap(NULL, 128*pgsz, PROT_READ | PROT_WRITE,
+		    MAP_PRIVATE | MAP_ANON, -1, 0);
+		if (p == MAP_FAILED)
+			err(-1, "mmap below limit");
+		if (munmap(p, 128*pgsz) == -1)
+			err(-1, "munmap");
+		exit(0);
+	}
+	int status;
+	if (wait(&status) != c)
+		errx(-1, "wrong child");
+	stchk(status, 0);
+
+	if (sys_cgroup(CGROUP_USAGE, g, CGROUP_PROCS, 0) != 0 ||
+	    sys_cgroup(CGROUP_USAGE, g, CGROUP_PAGES, 0) != 0)
+		errx(-1, "charges outlived the processes");
+	if (sys_cgroup(CGROUP_DESTROY, g, 0, 0) == -1)
+		err(-1, "cgroup destroy");
+	if (sys_cgroup(CGROUP_GETLIM, g, CGROUP_PAGES, 0) != -1 ||
+	    errno != ENOENT)
+		errx(-1, "group still exists");
+	printf("cgroup test ok\n");
+}
+
+void
+oomtest(void)
+{
+	printf("oom test\n");
+	const long pgsz = 4096;
+	int adj;
+	if (oom_score_adj(0, NULL, &adj) == -1)
+		err(-1, "oom_score_adj");
+	if (adj != 0)
+		errx(-1, "default adj %d", adj);
+	int n = 500;
+	if (oom_score_adj(getpid(), &n, NULL) == -1)
+		err(-1, "oom_score_adj");
+	n = OOM_ADJ_MAX + 1;
+	if (oom_score_adj(0, &n, NULL) != -1 || errno != EINVAL)
+		errx(-1, "bad adj accepted");
+	if (oom_score_adj(0, NULL, &adj) == -1)
+		err(-1, "oom_score_adj");
+	if (adj != 500)
+		errx(-1, "adj mismatch");
+	if (oom_score_adj(999999, NULL, &adj) != -1 || errno != ESRCH)
+		errx(-1, "adj of missing process");
+	n = 0;
+	if (oom_score_adj(0, &n, NULL) == -1)
+		err(-1, "oom_score_adj");
+	// a process cannot lower its value below the one it started with
+	n = -1;
+	if (oom_score_adj(0, &n, NULL) != -1 || errno != EPERM)
+		errx(-1, "lowered below the inherited value");
+
+	// a parent may only raise the value of a child, and a child cannot
+	// change its parent
+	int cp[2];
+	if (pipe(cp) == -1)
+		err(-1, "pipe");
+	pid_t c = fork();
+	if (c == -1)
+		err(-1, "fork");
+	if (c == 0) {
+		close(cp[1]);
+		n = 100;
+		if (oom_score_adj(getppid(), &n, NULL) != -1 ||
+		    errno != EPERM)
+			errx(-1, "child changed its parent");
+		char ch;
+		if (read(cp[0], &ch, 1) != 1)
+			err(-1, "read");
+		if (oom_score_adj(0, NULL, &adj) == -1)
+			err(-1, "oom_score_adj");
+		exit(adj == 200 ? 0 : 1);
+	}
+	close(cp[0]);
+	n = 200;
+	if (oom_score_adj(c, &n, NULL) == -1)
+		err(-1, "raising a child");
+	n = 100;
+	if (oom_score_adj(c, &n, NULL) != -1 || errno != EPERM)
+		errx(-1, "lowered a child");
+	if (write(cp[1], "x", 1) != 1)
+		err(-1, "write");
+	close(cp[1]);
+	int status;
+	if (wait(&status) != c || !WIFEXITED(status) ||
+	    WEXITSTATUS(status) != 0)
+		errx(-1, "child adj");
+
+	int fd = open("/dev/oom", O_RDONLY);
+	if (fd == -1)
+		err(-1, "open /dev/oom");
+	char buf[4096];
+	ssize_t r;
+	while ((r = read(fd, buf, sizeof(buf))) > 0)
+		;
+	if (r == -1)
+		err(-1, "read");
+	struct pollfd pfd = {.fd = fd, .events = POLLIN};
+	if (poll(&pfd, 1, 0) != 0)
+		errx(-1, "old events readable");
+
+	// a child which faults on more pages than its group allows is killed
+	long g = sys_cgroup(CGROUP_CREATE, sys_cgroup(CGROUP_SELF, 0, 0, 0),
+	    0, 0);
+	if (g < 0)
+		err(-1, "cgroup create");
+	long rss = sys_info(SINFO_RSSANON) + sys_info(SINFO_RSSFILE) +
+	    sys_info(SINFO_RSSSHARED);
+	if (sys_cgroup(CGROUP_SETLIM, g, CGROUP_PAGES, rss/pgsz + 256) == -1)
+		err(-1, "cgroup setlim");
+	c = fork();
+	if (c == -1)
+		err(-1, "fork");
+	if (c == 0) {
+		n = OOM_ADJ_MAX;
+		if (oom_score_adj(0, &n, NULL) == -1)
+			err(-1, "oom_score_adj");
+		if (sys_cgroup(CGROUP_JOIN, g, 0, 0) == -1)
+			err(-1, "cgroup join");
+		// inaccessible private pages are mapped lazily
+		size_t sz = 1024*pgsz;
+		char *p = mmap(NULL, sz, PROT_NONE, MAP_PRIVATE | MAP_ANON,
+		    -1, 0);
+		if (p == MAP_FAILED)
+			err(-1, "mmap");
+		if (mprotect(p, sz, PROT_READ | PROT_WRITE) == -1)
+			err(-1, "mprotect");
+		for (size_t i = 0; i < sz; i += pgsz)
+			p[i] = 1;
+		errx(-1, "survived the group limit");
+	}
+	if (wait(&status) != c)
+		errx(-1, "wrong child");
+	if (!WIFSIGNALED(status))
+		errx(-1, "child not killed");
+
+	if (poll(&pfd, 1, -1) != 1 || (pfd.revents & POLLIN) == 0)
+		errx(-1, "no oom event");
+	r = read(fd, buf, sizeof(buf) - 1);
+	if (r <= 0)
+		err(-1, "read event");
+	buf[r] = 0;
+	char want[32];
+	snprintf(want, sizeof(want), "pid=%ld ", c);
+	if (strstr(buf, want) == NULL ||
+	    strstr(buf, "adj=1000 ") == NULL ||
+	    strstr(buf, "reason=group-pages ") == NULL)
+		errx(-1, "bad event: %s", buf);
+	if (read(fd, buf, sizeof(buf)) != 0)
+		errx(-1, "extra events");
+	close(fd);
+	if (sys_cgroup(CGROUP_DESTROY, g, 0, 0) == -1)
+		err(-1, "cgroup destroy");
+	printf("oom test ok\n");
+}
+
+static int
+ksmwait(long which, long min)
+{
+	int i;
+	for (i = 0; i < 50; i++) {
+		if (sys_info(which) >= min)
+			return 1;
+		usleep(100000);
+	}
+	return 0;
+}
+
+void
+ksmtest(void)
+{
+	printf("ksm test\n");
+	const size_t pgsz = 4096;
+	const int npg = 64;
+	long shared = sys_info(SINFO_KSMSHARED);
+	long sharing = sys_info(SINFO_KSMSHARING);
+	char *p = mmap(NULL, npg*pgsz, PROT_READ | PROT_WRITE,
+	    MAP_PRIVATE | MAP_ANON, -1, 0);
+	if (p == MAP_FAILED)
+		err(-1, "mmap");
+	if (madvise(p, npg*pgsz, MADV_MERGEABLE) == -1)
+		err(-1, "madvise");
+	if (madvise(p, npg*pgsz, 99) != -1 || errno != EINVAL)
+		errx(-1, "bad advice accepted");
+	memset(p, 0x5a, npg*pgsz);
+
+	// identical pages are merged into one
+	if (!ksmwait(SINFO_KSMSHARING, sharing + npg - 1))
+		errx(-1, "pages not merged");
+	if (sys_info(SINFO_KSMSHARED) != shared + 1)
+		errx(-1, "expected one merged page");
+
+	// writes break the sharing
+	p[5*pgsz] = 'Q';
+	int i;
+	for (i = 0; i < npg*pgsz; i++)
+		if (p[i] != (i == 5*pgsz ? 'Q' : 0x5a))
+			errx(-1, "mismatch at %d", i);
+	if (madvise(p, npg*pgsz, MADV_UNMERGEABLE) == -1)
+		err(-1, "madvise");
+	p[6*pgsz] = 'R';
+	if (p[7*pgsz] != 0x5a)
+		errx(-1, "write leaked into merged page");
+
+	if (munmap(p, npg*pgsz) == -1)
+		err(-1, "munmap");
+	for (i = 0; i < 50 && sys_info(SINFO_KSMSHARED) != shared; i++)
+		usleep(100000);
+	if (sys_info(SINFO_KSMSHARED) != shared)
+		errx(-1, "merged page not released");
+	printf("ksm test ok\n");
+}
+
+static void *
+uffdthread(void *arg)
+{
+	const size_t pgsz = 4096;
+	// the faults must happen in order
+	volatile char *p = arg;
+	long ok = p[0] == 'A' && p[pgsz] == 0;
+	p[2*pgsz] = 'w';
+	ok = ok && p[2*pgsz] == 'w' && p[2*pgsz + 1] == 'C';
+	return (void *)ok;
+}
+
+void
+uffdtest(void)
+{
+	printf("userfaultfd test\n");
+	const size_t pgsz = 4096;
+	static char src[4096];
+	int fd = userfaultfd(O_CLOEXEC);
+	if (fd == -1)
+		err(-1, "userfaultfd");
+	struct uffdio_api api = {.api = UFFD_API};
+	if (ioctl(fd, UFFDIO_API, &api) == -1)
+		err(-1, "UFFDIO_API");
+	if (ioctl(0, UFFDIO_API, &api) != -1 || errno != ENOTTY)
+		errx(-1, "ioctl on a non-userfaultfd");
+
+	char *p = mmap(NULL, 4*pgsz, PROT_READ | PROT_WRITE,
+	    MAP_PRIVATE | MAP_ANON, -1, 0);
+	if (p == MAP_FAILED)
+		err(-1, "mmap");
+	struct uffdio_register reg = {.range = {(ulong)p, 4*pgsz},
+	    .mode = UFFDIO_REGISTER_MODE_MISSING};
+	if (ioctl(fd, UFFDIO_REGISTER, &reg) == -1)
+		err(-1, "UFFDIO_REGISTER");
+	if ((reg.ioctls & (1ul << (UFFDIO_COPY & 0xff))) == 0)
+		errx(-1, "no UFFDIO_COPY");
+	struct pollfd pfd = {.fd = fd, .events = POLLIN};
+	if (poll(&pfd, 1, 0) != 0)
+		errx(-1, "fault before any access");
+
+	// the kernel does not wait for the handler
+	int pfds[2];
+	if (pipe(pfds) == -1)
+		err(-1, "pipe");
+	if (write(pfds[1], p + 3*pgsz, 1) != -1 || errno != EFAULT)
+		errx(-1, "kernel access to a missing page");
+
+	// another thread's faults are handled here
+	pthread_t t;
+	if (pthread_create(&t, NULL, uffdthread, p))
+		errx(-1, "pthread_create");
+	int i;
+	for (i = 0; i < 3; i++) {
+		if (poll(&pfd, 1, -1) != 1)
+			err(-1, "poll");
+		struct uffd_msg m;
+		if (read(fd, &m, sizeof(m)) != sizeof(m))
+			err(-1, "read");
+		ulong a = m.arg.pagefault.address;
+		int w = (m.arg.pagefault.flags & UFFD_PAGEFAULT_FLAG_WRITE) != 0;
+		if (m.event != UFFD_EVENT_PAGEFAULT || a != (ulong)p + i*pgsz)
+			errx(-1, "unexpected fault %lx", a);
+		if (w != (i == 2))
+			errx(-1, "bad write flag");
+		if (i == 1) {
+			struct uffdio_zeropage z = {.range = {a, pgsz}};
+			if (ioctl(fd, UFFDIO_ZEROPAGE, &z) == -1 ||
+			    z.zeropage != pgsz)
+				err(-1, "UFFDIO_ZEROPAGE");
+			continue;
+		}
+		memset(src, 'A' + i, sizeof(src));
+		struct uffdio_copy c = {.dst = a, .src = (ulong)src,
+		    .len = pgsz};
+		if (ioctl(fd, UFFDIO_COPY, &c) == -1 || c.copy != pgsz)
+			err(-1, "UFFDIO_COPY");
+	}
+	void *ok;
+	if (pthread_join(t, &ok))
+		errx(-1, "pthread_join");
+	if (!ok)
+		errx(-1, "bad page contents");
+
+	struct uffdio_copy c = {.dst = (ulong)p, .src = (ulong)src,
+	    .len = pgsz};
+	if (ioctl(fd, UFFDIO_COPY, &c) != -1 || errno != EEXIST ||
+	    c.copy != -EEXIST)
+		errx(-1, "copy over a present page");
+
+	// faults on unregistered pages are handled by the kernel
+	struct uffdio_range r = {(ulong)p, 4*pgsz};
+	if (ioctl(fd, UFFDIO_UNREGISTER, &r) == -1)
+		err(-1, "UFFDIO_UNREGISTER");
+	if (p[3*pgsz] != 0)
+		errx(-1, "unregistered page not zero");
+	close(pfds[0]);
+	close(pfds[1]);
+	close(fd);
+	if (munmap(p, 4*pgsz) == -1)
+		err(-1, "munmap");
+	printf("userfaultfd test ok\n");
+}
+
+void
+mlocktest(void)
+{
+	printf("mlock test\n");
+	const size_t pgsz = 4096;
+	const size_t sz = 16*pgsz;
+	struct rlimit rl;
+	if (getrlimit(RLIMIT_MEMLOCK, &rl) == -1)
+		err(-1, "getrlimit");
+	if (rl.rlim_cur == 0)
+		errx(-1, "no memlock limit");
+	rlim_t old = rl.rlim_cur;
+
+	const char *f = "mlockfile";
+	int fd = open(f, O_CREAT | O_RDWR);
+	if (fd == -1)
+		err(-1, "open");
+	char buf[4096];
+	memset(buf, 'l', sizeof(buf));
+	int i;
+	for (i = 0; i < sz / pgsz; i++)
+		if (write(fd, buf, sizeof(buf)) != sizeof(buf))
+			err(-1, "write");
+
+	// locking faults in the file pages
+	char *p = mmap(NULL, sz, PROT_READ, MAP_PRIVATE, fd, 0);
+	if (p == MAP_FAILED)
+		err(-1, "mmap");
+	long file = sys_info(SINFO_RSSFILE);
+	if (mlock(p + 1, sz - 1) == -1)
+		err(-1, "mlock");
+	if (sys_info(SINFO_RSSFILE) < file + sz)
+		errx(-1, "locked pages not resident");
+	if (madvise(p, sz, MADV_DONTNEED) != -1 || errno != EINVAL)
+		errx(-1, "dropped locked pages");
+
+	// a child does not inherit locks
+	pid_t c = fork();
+	if (c == -1)
+		err(-1, "fork");
+	if (c == 0) {
+		if (madvise(p, sz, MADV_DONTNEED) == -1)
+			err(-1, "child madvise");
+		exit(0);
+	}
+	int status;
+	if (wait(&status) != c)
+		errx(-1, "wrong child");
+	stchk(status, 0);
+
+	if (munlock(p, sz) == -1)
+		err(-1, "munlock");
+	if (madvise(p, sz, MADV_DONTNEED) == -1)
+		err(-1, "madvise");
+	for (i = 0; i < sz; i += pgsz)
+		if (p[i] != 'l')
+			errx(-1, "mismatch at %d", i);
+
+	// only the hard limit bounds raises; a child inherits the limits
+	c = fork();
+	if (c == -1)
+		err(-1, "fork");
+	if (c == 0) {
+		struct rlimit hl = {.rlim_cur = 4*pgsz, .rlim_max = 8*pgsz};
+		if (setrlimit(RLIMIT_MEMLOCK, &hl) == -1)
+			err(-1, "lower hard limit");
+		c = fork();
+		if (c == -1)
+			err(-1, "fork");
+		if (c == 0) {
+			if (getrlimit(RLIMIT_MEMLOCK, &hl) == -1)
+				err(-1, "getrlimit");
+			if (hl.rlim_cur != 4*pgsz || hl.rlim_max != 8*pgsz)
+				errx(-1, "limits not inherited");
+			exit(0);
+		}
+		if (wait(&status) != c)
+			errx(-1, "wrong child");
+		stchk(status, 0);
+		hl.rlim_cur = 16*pgsz;
+		if (setrlimit(RLIMIT_MEMLOCK, &hl) != -1 || errno != EINVAL)
+			errx(-1, "soft limit over hard limit");
+		hl.rlim_max = 16*pgsz;
+		if (setrlimit(RLIMIT_MEMLOCK, &hl) != -1 || errno != EPERM)
+			errx(-1, "raised hard limit");
+		if (mlock(p, sz) != -1 || errno != ENOMEM)
+			errx(-1, "mlock over limit");
+		exit(0);
+	}
+	if (wait(&status) != c)
+		errx(-1, "wrong child");
+	stchk(status, 0);
+
+	// the limit applies to all locked mappings
+	rl.rlim_cur = 4*pgsz;
+	if (setrlimit(RLIMIT_MEMLOCK, &rl) == -1)
+		err(-1, "setrlimit");
+	if (mlock(p, sz) != -1 || errno != ENOMEM)
+		errx(-1, "mlock over limit");
+	if (mlock(p, 2*pgsz) == -1 || mlock(p + 2*pgsz, 2*pgsz) == -1)
+		err(-1, "mlock within limit");
+	if (mlock(p + 4*pgsz, pgsz) != -1 || errno != ENOMEM)
+		errx(-1, "mlock over limit");
+	if (mlock(p, 4*pgsz) == -1)
+		err(-1, "relocking");
+	if (mlockall(MCL_CURRENT) != -1 || errno != ENOMEM)
+		errx(-1, "mlockall over limit");
+	if (mlockall(0) != -1 || errno != EINVAL)
+		errx(-1, "bad mlockall flags");
+	if (mlock((void *)0x1000, pgsz) != -1 || errno != ENOMEM)
+		errx(-1, "locked unmapped pages");
+
+	// mappings made after mlockall(MCL_FUTURE) are locked
+	rl.rlim_cur = old;
+	if (setrlimit(RLIMIT_MEMLOCK, &rl) == -1)
+		err(-1, "setrlimit");
+	if (mlockall(MCL_FUTURE) == -1)
+		err(-1, "mlockall");
+	file = sys_info(SINFO_RSSFILE);
+	char *q = mmap(NULL, sz, PROT_READ, MAP_PRIVATE, fd, 0);
+	if (q == MAP_FAILED)
+		err(-1, "mmap");
+	if (sys_info(SINFO_RSSFILE) < file + sz)
+		errx(-1, "new mapping not locked");
+	if (madvise(q, sz, MADV_DONTNEED) != -1 || errno != EINVAL)
+		errx(-1, "dropped locked pages");
+	if (munlockall() == -1)
+		err(-1, "munlockall");
+	if (madvise(q, sz, MADV_DONTNEED) == -1 ||
+	    madvise(p, sz, MADV_DONTNEED) == -1)
+		err(-1, "madvise after munlockall");
+
+	if (munmap(p, sz) == -1 || munmap(q, sz) == -1)
+		err(-1, "munmap");
+	close(fd);
+	if (unlink(f) == -1)
+		err(-1, "unlink");
+	printf("mlock test ok\n");
+}
+
+void
+ipctest(void)
+{
+	printf("ipc test\n");
+	const size_t pgsz = 4096;
+
+	// shared memory objects
+	const char *name = "/ipctest";
+	shm_unlink(name);
+	int fd = shm_open(name, O_RDWR | O_CREAT | O_EXCL, 0600);
+	if (fd == -1)
+		err(-1, "shm_open");
+	if (shm_open(name, O_RDWR | O_CREAT | O_EXCL, 0600) != -1 ||
+	    errno != EEXIST)
+		errx(-1, "exclusive shm_open");
+	if (shm_open("noslash", O_RDWR, 0) != -1 || errno != EINVAL)
+		errx(-1, "bad shm name");
+	if (ftruncate(fd, 2*pgsz) == -1)
+		err(-1, "ftruncate");
+	char *p = mmap(NULL, 2*pgsz, PROT_READ | PROT_WRITE, MAP_SHARED, fd,
+	    0);
+	if (p == MAP_FAILED)
+		err(-1, "mmap");
+	if (p[0] != 0 || p[2*pgsz - 1] != 0)
+		errx(-1, "shm not zeroed");
+	pid_t c = fork();
+	if (c == -1)
+		err(-1, "fork");
+	if (c == 0) {
+		int cfd = shm_open(name, O_RDWR, 0);
+		if (cfd == -1)
+			err(-1, "child shm_open");
+		char *q = mmap(NULL, pgsz, PROT_READ | PROT_WRITE, MAP_SHARED,
+		    cfd, pgsz);
+		if (q == MAP_FAILED)
+			err(-1, "child mmap");
+		strncpy(q, "shared", 7);
+		exit(0);
+	}
+	int status;
+	if (wait(&status) != c)
+		errx(-1, "wrong child");
+	stchk(status, 0);
+	if (strcmp(p + pgsz, "shared") != 0)
+		errx(-1, "shm write not shared");
+	char buf[16];
+	if (pread(fd, buf, 7, pgsz) != 7 || strcmp(buf, "shared") != 0)
+		errx(-1, "shm read mismatch");
+	struct stat st;
+	if (fstat(fd, &st) == -1)
+		err(-1, "fstat");
+	if (st.st_size != 2*pgsz)
+		errx(-1, "bad shm size");
+	// shrinking removes the pages beyond the end from the mappings
+	if (ftruncate(fd, pgsz) == -1)
+		err(-1, "ftruncate");
+	_mpchild(p + pgsz, 0, SIGSEGV);
+	if (ftruncate(fd, 2*pgsz) == -1)
+		err(-1, "ftruncate");
+	if (p[pgsz] != 0)
+		errx(-1, "shm not zeroed after shrink");
+	if (shm_unlink(name) == -1)
+		err(-1, "shm_unlink");
+	if (shm_open(name, O_RDWR, 0) != -1 || errno != ENOENT)
+		errx(-1, "unlinked shm opened");
+	// the mapping outlives the name and the descriptor
+	close(fd);
+	p[0] = 'x';
+	if (munmap(p, 2*pgsz) == -1)
+		err(-1, "munmap");
+
+	// System V shared memory
+	int shmid = shmget(IPC_PRIVATE, 3*pgsz, IPC_CREAT | 0600);
+	if (shmid == -1)
+		err(-1, "shmget");
+	int *sp = shmat(shmid, NULL, 0);
+	if (sp == (void *)-1)
+		err(-1, "shmat");
+	struct shmid_ds ds;
+	if (shmctl(shmid, IPC_STAT, &ds) == -1)
+		err(-1, "shmctl");
+	if (ds.shm_segsz != 3*pgsz || ds.shm_nattch != 1 ||
+	    ds.shm_cpid != getpid())
+		errx(-1, "bad shmid_ds");
+	c = fork();
+	if (c == -1)
+		err(-1, "fork");
+	if (c == 0) {
+		// a child inherits the attachment
+		sp[0] = 31337;
+		int *sp2 = shmat(shmid, NULL, SHM_RDONLY);
+		if (sp2 == (void *)-1)
+			err(-1, "child shmat");
+		if (sp2[0] != 31337)
+			errx(-1, "attachments differ");
+		if (shmdt(sp2 + 1) != -1 || errno != EINVAL)
+			errx(-1, "detached at bad address");
+		if (shmdt(sp2) == -1)
+			err(-1, "shmdt");
+		exit(0);
+	}
+	if (wait(&status) != c)
+		errx(-1, "wrong child");
+	stchk(status, 0);
+	if (sp[0] != 31337)
+		errx(-1, "sysv write not shared");
+	if (shmctl(shmid, IPC_STAT, &ds) == -1)
+		err(-1, "shmctl");
+	if (ds.shm_nattch != 1)
+		errx(-1, "bad attach count %lu", ds.shm_nattch);
+	// a removed segment stays until it is detached
+	if (shmctl(shmid, IPC_RMID, NULL) == -1)
+		err(-1, "shmctl rmid");
+	if (shmat(shmid, NULL, 0) != (void *)-1 || errno != EINVAL)
+		errx(-1, "attached removed segment");
+	sp[1] = 1;
+	if (shmdt(sp) == -1)
+		err(-1, "shmdt");
+
+	// semaphores
+	key_t key = 0x1337;
+	int semid = semget(key, 2, IPC_CREAT | IPC_EXCL | 0600);
+	if (semid == -1)
+		err(-1, "semget");
+	if (semget(key, 2, IPC_CREAT | IPC_EXCL | 0600) != -1 ||
+	    errno != EEXIST)
+		errx(-1, "exclusive semget");
+	if (semget(key, 0, 0) != semid)
+		errx(-1, "semget by key");
+	struct sembuf sop = {.sem_num = 0, .sem_op = -1, .sem_flg = IPC_NOWAIT};
+	if (semop(semid, &sop, 1) != -1 || errno != EAGAIN)
+		errx(-1, "semop should block");
+	c = fork();
+	if (c == -1)
+		err(-1, "fork");
+	if (c == 0) {
+		// wait for the parent to raise semaphore 0, then raise 1
+		struct sembuf ops[2] = {
+			{.sem_num = 0, .sem_op = -1},
+			{.sem_num = 1, .sem_op = 2},
+		};
+		if (semop(semid, ops, 2) == -1)
+			err(-1, "child semop");
+		exit(0);
+	}
+	if (semctl(semid, 0, SETVAL, 1) == -1)
+		err(-1, "semctl setval");
+	sop.sem_num = 1;
+	sop.sem_op = -2;
+	sop.sem_flg = 0;
+	if (semop(semid, &sop, 1) == -1)
+		err(-1, "semop");
+	if (wait(&status) != c)
+		errx(-1, "wrong child");
+	stchk(status, 0);
+	ushort vals[2];
+	if (semctl(semid, 0, GETALL, vals) == -1)
+		err(-1, "semctl getall");
+	if (vals[0] != 0 || vals[1] != 0)
+		errx(-1, "bad semaphore values");
+	if (semctl(semid, 0, GETPID) != c)
+		errx(-1, "bad semaphore pid");
+	vals[0] = 3;
+	vals[1] = 4;
+	if (semctl(semid, 0, SETALL, vals) == -1)
+		err(-1, "semctl setall");
+	if (semctl(semid, 1, GETVAL) != 4)
+		errx(-1, "bad semaphore value");
+	// the operations with SEM_UNDO are undone when the process exits
+	c = fork();
+	if (c == -1)
+		err(-1, "fork");
+	if (c == 0) {
+		struct sembuf ops[2] = {
+			{.sem_num = 0, .sem_op = -2, .sem_flg = SEM_UNDO},
+			{.sem_num = 1, .sem_op = 1, .sem_flg = SEM_UNDO},
+		};
+		if (semop(semid, ops, 2) == -1)
+			err(-1, "child semop");
+		if (semctl(semid, 0, GETVAL) != 1 ||
+		    semctl(semid, 1, GETVAL) != 5)
+			errx(-1, "undo applied early");
+		// setting a value discards its adjustment
+		if (semctl(semid, 1, SETVAL, 2) == -1)
+			err(-1, "semctl setval");
+		exit(0);
+	}
+	if (wait(&status) != c)
+		errx(-1, "wrong child");
+	stchk(status, 0);
+	if (semctl(semid, 0, GETVAL) != 3 || semctl(semid, 1, GETVAL) != 2)
+		errx(-1, "SEM_UNDO not undone");
+	if (semctl(semid, 0, IPC_RMID) == -1)
+		err(-1, "semctl rmid");
+	if (semop(semid, &sop, 1) != -1 || errno != EINVAL)
+		errx(-1, "removed semaphores");
+
+	// message queues
+	int msqid = msgget(IPC_PRIVATE, IPC_CREAT | 0600);
+	if (msqid == -1)
+		err(-1, "msgget");
+	struct {
+		long mtype;
+		char mtext[16];
+	} msg;
+	int types[] = {3, 1, 2};
+	int i;
+	for (i = 0; i < 3; i++) {
+		msg.mtype = types[i];
+		snprintf(msg.mtext, sizeof(msg.mtext), "msg %d", types[i]);
+		if (msgsnd(msqid, &msg, strlen(msg.mtext) + 1, 0) == -1)
+			err(-1, "msgsnd");
+	}
+	msg.mtype = 0;
+	if (msgsnd(msqid, &msg, 1, 0) != -1 || errno != EINVAL)
+		errx(-1, "bad message type");
+	// the lowest type of at most 2
+	if (msgrcv(msqid, &msg, sizeof(msg.mtext), -2, 0) != 6 ||
+	    msg.mtype != 1 || strcmp(msg.mtext, "msg 1") != 0)
+		errx(-1, "msgrcv lowest type");
+	if (msgrcv(msqid, &msg, 2, 0, 0) != -1 || errno != E2BIG)
+		errx(-1, "msgrcv should not truncate");
+	if (msgrcv(msqid, &msg, 2, 2, MSG_NOERROR) != 2 || msg.mtype != 2)
+		errx(-1, "msgrcv truncated");
+	if (msgrcv(msqid, &msg, sizeof(msg.mtext), 3, MSG_EXCEPT |
+	    IPC_NOWAIT) != -1 || errno != ENOMSG)
+		errx(-1, "msgrcv except");
+	struct msqid_ds mds;
+	if (msgctl(msqid, IPC_STAT, &mds) == -1)
+		err(-1, "msgctl");
+	if (mds.msg_qnum != 1 || mds.msg_cbytes != 6 ||
+	    mds.msg_lspid != getpid())
+		errx(-1, "bad msqid_ds");
+	c = fork();
+	if (c == -1)
+		err(-1, "fork");
+	if (c == 0) {
+		msg.mtype = 7;
+		strncpy(msg.mtext, "child", 6);
+		if (msgsnd(msqid, &msg, 6, 0) == -1)
+			err(-1, "child msgsnd");
+		exit(0);
+	}
+	if (msgrcv(msqid, &msg, sizeof(msg.mtext), 7, 0) != 6 ||
+	    strcmp(msg.mtext, "child") != 0)
+		errx(-1, "msgrcv from child");
+	if (wait(&status) != c)
+		errx(-1, "wrong child");
+	stchk(status, 0);
+	if (msgctl(msqid, IPC_RMID, NULL) == -1)
+		err(-1, "msgctl rmid");
+	if (msgrcv(msqid, &msg, sizeof(msg.mtext), 0, 0) != -1 ||
+	    errno != EINVAL)
+		errx(-1, "removed queue");
+	printf("ipc test ok\n");
+}
+
+void
+epolltest(void)
+{
+	printf("epoll test\n");
+
+	int ep = epoll_create1(EPOLL_CLOEXEC);
+	if (ep == -1)
+		err(-1, "epoll_create1");
+	if (epoll_create1(1) != -1 || errno != EINVAL)
+		errx(-1, "bad epoll flags");
+	int lp[2], ep2[2], op[2];
+	if (pipe(lp) == -1 || pipe(ep2) == -1 || pipe(op) == -1)
+		err(-1, "pipe");
+
+	struct epoll_event ev, evs[4];
+	ev.events = EPOLLIN;
+	ev.data.u64 = 1;
+	if (epoll_ctl(ep, EPOLL_CTL_ADD, lp[0], &ev) == -1)
+		err(-1, "epoll_ctl add");
+	if (epoll_ctl(ep, EPOLL_CTL_ADD, lp[0], &ev) != -1 || errno != EEXIST)
+		errx(-1, "double add");
+	if (epoll_ctl(ep, EPOLL_CTL_ADD, ep, &ev) != -1 || errno != EINVAL)
+		errx(-1, "epoll watches itself");
+	ev.events = EPOLLIN | EPOLLET;
+	ev.data.u64 = 2;
+	if (epoll_ctl(ep, EPOLL_CTL_ADD, ep2[0], &ev) == -1)
+		err(-1, "epoll_ctl add");
+	ev.events = EPOLLIN | EPOLLONESHOT;
+	ev.data.u64 = 3;
+	if (epoll_ctl(ep, EPOLL_CTL_ADD, op[0], &ev) == -1)
+		err(-1, "epoll_ctl add");
+
+	if (epoll_wait(ep, evs, 4, 0) != 0)
+		errx(-1, "nothing is ready");
+	if (epoll_wait(ep, evs, 4, 50) != 0)
+		errx(-1, "timeout");
+	if (write(lp[1], "a", 1) != 1 || write(ep2[1], "b", 1) != 1 ||
+	    write(op[1], "c", 1) != 1)
+		err(-1, "write");
+
+	// every registration is reported once at first
+	int n = epoll_wait(ep, evs, 4, -1);
+	if (n != 3)
+		errx(-1, "expected 3 events, got %d", n);
+	int i, seen = 0;
+	for (i = 0; i < n; i++) {
+		if (evs[i].events != EPOLLIN)
+			errx(-1, "wrong events %x", evs[i].events);
+		seen |= 1 << evs[i].data.u64;
+	}
+	if (seen != 0xe)
+		errx(-1, "wrong data");
+
+	// only the level-triggered registration is reported again
+	n = epoll_wait(ep, evs, 4, 0);
+	if (n != 1 || evs[0].data.u64 != 1)
+		errx(-1, "level-triggered");
+
+	// the edge-triggered registration is reported once the pipe becomes
+	// readable again
+	char buf[8];
+	if (read(ep2[0], buf, sizeof(buf)) != 1)
+		err(-1, "read");
+	if (read(lp[0], buf, sizeof(buf)) != 1)
+		err(-1, "read");
+	if (epoll_wait(ep, evs, 4, 0) != 0)
+		errx(-1, "nothing is ready");
+	if (write(ep2[1], "b", 1) != 1)
+		err(-1, "write");
+	n = epoll_wait(ep, evs, 4, 0);
+	if (n != 1 || evs[0].data.u64 != 2)
+		errx(-1, "edge-triggered");
+	if (epoll_wait(ep, evs, 4, 0) != 0)
+		errx(-1, "edge reported twice");
+	// nor is the epoll descriptor readable
+	struct pollfd pfd = {.fd = ep, .events = POLLIN};
+	if (poll(&pfd, 1, 0) != 0)
+		errx(-1, "epoll readable after edge was reported");
+
+	// the oneshot registration is enabled again by EPOLL_CTL_MOD
+	ev.events = EPOLLIN | EPOLLONESHOT;
+	ev.data.u64 = 4;
+	if (epoll_ctl(ep, EPOLL_CTL_MOD, op[0], &ev) == -1)
+		err(-1, "epoll_ctl mod");
+	n = epoll_wait(ep, evs, 4, 0);
+	if (n != 1 || evs[0].data.u64 != 4)
+		errx(-1, "oneshot");
+	if (epoll_wait(ep, evs, 4, 0) != 0)
+		errx(-1, "oneshot reported twice");
+
+	if (epoll_ctl(ep, EPOLL_CTL_DEL, op[0], NULL) == -1)
+		err(-1, "epoll_ctl del");
+	if (epoll_ctl(ep, EPOLL_CTL_DEL, op[0], NULL) != -1 || errno != ENOENT)
+		errx(-1, "double del");
+	if (epoll_ctl(ep, EPOLL_CTL_MOD, op[0], &ev) != -1 || errno != ENOENT)
+		errx(-1, "mod of deleted");
+
+	// deleted registrations do not occupy the pollers of the device
+	for (i = 0; i < 20; i++) {
+		if (epoll_ctl(ep, EPOLL_CTL_DEL, lp[0], NULL) == -1)
+			err(-1, "epoll_ctl del");
+		ev.events = EPOLLIN;
+		ev.data.u64 = 1;
+		if (epoll_ctl(ep, EPOLL_CTL_ADD, lp[0], &ev) == -1)
+			err(-1, "epoll_ctl add %d", i);
+	}
+
+	// closing a descriptor removes its registration
+	if (write(lp[1], "a", 1) != 1)
+		err(-1, "write");
+	close(lp[0]);
+	if (epoll_wait(ep, evs, 4, 0) != 0)
+		errx(-1, "closed descriptor reported");
+
+	// a write by another process wakes a waiter
+	pid_t c = fork();
+	if (c == -1)
+		err(-1, "fork");
+	if (c == 0) {
+		usleep(100000);
+		if (write(op[1], "d", 1) != 1)
+			err(-1, "child write");
+		exit(0);
+	}
+	ev.events = EPOLLIN;
+	ev.data.u64 = 5;
+	if (epoll_ctl(ep, EPOLL_CTL_ADD, op[0], &ev) == -1)
+		err(-1, "epoll_ctl add");
+	if (read(op[0], buf, sizeof(buf)) != 1)
+		err(-1, "read");
+	n = epoll_wait(ep, evs, 4, -1);
+	if (n != 1 || evs[0].data.u64 != 5)
+		errx(-1, "blocking wait");
+	int status;
+	if (wait(&status) != c)
+		errx(-1, "wrong child");
+	if (!WIFEXITED(status) || WEXITSTATUS(status) != 0)
+		errx(-1, "child failed");
+
+	close(lp[1]);
+	close(ep2[0]);
+	close(ep2[1]);
+	close(op[0]);
+	close(op[1]);
+	close(ep);
+	printf("epoll test ok\n");
+}
+
+void
+evfdtest(void)
+{
+	printf("evfd test\n");
+
+	// eventfd
+	uint64_t v;
+	int efd = eventfd(3, EFD_NONBLOCK);
+	if (efd == -1)
+		err(-1, "eventfd");
+	if (read(efd, &v, sizeof(v)) != sizeof(v) || v != 3)
+		errx(-1, "eventfd initval");
+	if (read(efd, &v, sizeof(v)) != -1 || errno != EAGAIN)
+		errx(-1, "eventfd should be empty");
+	struct pollfd pfd = {.fd = efd, .events = POLLIN};
+	if (poll(&pfd, 1, 0) != 0)
+		errx(-1, "empty eventfd is readable");
+	v = 2;
+	if (write(efd, &v, sizeof(v)) != sizeof(v))
+		err(-1, "eventfd write");
+	v = 5;
+	if (write(efd, &v, sizeof(v)) != sizeof(v))
+		err(-1, "eventfd write");
+	if (poll(&pfd, 1, 0) != 1 || !(pfd.revents & POLLIN))
+		errx(-1, "eventfd not readable");
+	uint32_t small;
+	if (read(efd, &small, sizeof(small)) != -1 || errno != EINVAL)
+		errx(-1, "short eventfd read");
+	if (read(efd, &v, sizeof(v)) != sizeof(v) || v != 7)
+		errx(-1, "eventfd sum");
+	v = -1;
+	if (write(efd, &v, sizeof(v)) != -1 || errno != EINVAL)
+		errx(-1, "eventfd max");
+	close(efd);
+
+	efd = eventfd(2, EFD_SEMAPHORE | EFD_NONBLOCK);
+	if (efd == -1)
+		err(-1, "eventfd");
+	int i;
+	for (i = 0; i < 2; i++)
+		if (read(efd, &v, sizeof(v)) != sizeof(v) || v != 1)
+			errx(-1, "eventfd semaphore");
+	if (read(efd, &v, sizeof(v)) != -1 || errno != EAGAIN)
+		errx(-1, "eventfd semaphore should be zero");
+	close(efd);
+
+	// a write by another process wakes a blocked reader
+	efd = eventfd(0, 0);
+	if (efd == -1)
+		err(-1, "eventfd");
+	pid_t c = fork();
+	if (c == -1)
+		err(-1, "fork");
+	if (c == 0) {
+		usleep(100000);
+		v = 42;
+		if (write(efd, &v, sizeof(v)) != sizeof(v))
+			err(-1, "child eventfd write");
+		exit(0);
+	}
+	if (read(efd, &v, sizeof(v)) != sizeof(v) || v != 42)
+		errx(-1, "blocking eventfd read");
+	int status;
+	if (wait(&status) != c)
+		errx(-1, "wrong child");
+	if (!WIFEXITED(status) || WEXITSTATUS(status) != 0)
+		errx(-1, "child failed");
+	close(efd);
+
+	// timerfd
+	int tfd = timerfd_create(CLOCK_MONOTONIC, TFD_NONBLOCK);
+	if (tfd == -1)
+		err(-1, "timerfd_create");
+	if (timerfd_create(7, 0) != -1 || errno != EINVAL)
+		errx(-1, "bad clock");
+	if (read(tfd, &v, sizeof(v)) != -1 || errno != EAGAIN)
+		errx(-1, "disarmed timerfd expired");
+	struct itimerspec its = {.it_value = {0, 50000000},
+	    .it_interval = {0, 20000000}}, cur;
+	if (timerfd_settime(tfd, 0, &its, NULL) == -1)
+		err(-1, "timerfd_settime");
+	if (timerfd_gettime(tfd, &cur) == -1)
+		err(-1, "timerfd_gettime");
+	if (cur.it_interval.tv_sec != 0 ||
+	    cur.it_interval.tv_nsec != 20000000 ||
+	    cur.it_value.tv_sec != 0 || cur.it_value.tv_nsec == 0 ||
+	    cur.it_value.tv_nsec > 50000000)
+		errx(-1, "timerfd_gettime values");
+	pfd.fd = tfd;
+	pfd.events = POLLIN;
+	if (poll(&pfd, 1, 1000) != 1)
+		errx(-1, "timerfd did not expire");
+	usleep(100000);
+	if (read(tfd, &v, sizeof(v)) != sizeof(v) || v < 2)
+		errx(-1, "periodic timerfd expirations");
+	memset(&its, 0, sizeof(its));
+	struct itimerspec old;
+	if (timerfd_settime(tfd, 0, &its, &old) == -1)
+		err(-1, "timerfd_settime");
+	if (old.it_interval.tv_nsec != 20000000)
+		errx(-1, "old timerfd setting");
+	if (timerfd_gettime(tfd, &cur) == -1)
+		err(-1, "timerfd_gettime");
+	if (cur.it_value.tv_sec != 0 || cur.it_value.tv_nsec != 0)
+		errx(-1, "timerfd still armed");
+	close(tfd);
+
+	tfd = timerfd_create(CLOCK_REALTIME, 0);
+	if (tfd == -1)
+		err(-1, "timerfd_create");
+	its.it_value.tv_nsec = 30000000;
+	if (timerfd_settime(tfd, 0, &its, NULL) == -1)
+		err(-1, "timerfd_settime");
+	if (read(tfd, &v, sizeof(v)) != sizeof(v) || v != 1)
+		errx(-1, "one-shot timerfd");
+	close(tfd);
+
+	// signalfd; usertests defines kill() as SIGKILL
+	sigset_t ss;
+	sigemptyset(&ss);
+	sigaddset(&ss, SIGUSR1);
+	int sfd = signalfd(-1, &ss, SFD_NONBLOCK);
+	if (sfd == -1)
+		err(-1, "signalfd");
+	struct signalfd_siginfo si;
+	if (read(sfd, &si, sizeof(si)) != -1 || errno != EAGAIN)
+		errx(-1, "no signals are pending");
+	if ((kill)(getpid(), SIGUSR1) == -1)
+		err(-1, "kill");
+	if (read(sfd, &si, sizeof(si)) != sizeof(si))
+		err(-1, "signalfd read");
+	if (si.ssi_signo != SIGUSR1 || si.ssi_pid != getpid())
+		errx(-1, "wrong siginfo");
+	if (read(sfd, &si, sizeof(si)) != -1 || errno != EAGAIN)
+		errx(-1, "signal read twice");
+	sigaddset(&ss, SIGUSR2);
+	if (signalfd(sfd, &ss, 0) != sfd)
+		err(-1, "signalfd mask");
+	if ((kill)(getpid(), SIGUSR2) == -1)
+		err(-1, "kill");
+	if (read(sfd, &si, sizeof(si)) != sizeof(si) || si.ssi_signo != SIGUSR2)
+		errx(-1, "pending SIGUSR2");
+	close(sfd);
+
+	// a signal which no signalfd reads takes its default disposition
+	if ((kill)(getpid(), SIGCHLD) == -1)
+		err(-1, "ignored signal");
+	c = fork();
+	if (c == -1)
+		err(-1, "fork");
+	if (c == 0) {
+		sleep(5);
+		exit(0);
+	}
+	if ((kill)(c, SIGUSR2) == -1)
+		err(-1, "kill");
+	if (wait(&status) != c)
+		errx(-1, "wrong child");
+	stchk(status, SIGUSR2);
+
+	// a process may only signal the processes which its parent created
+	pid_t gp = getpid();
+	c = fork();
+	if (c == -1)
+		err(-1, "fork");
+	if (c == 0) {
+		pid_t gc = fork();
+		if (gc == -1)
+			err(-1, "fork");
+		if (gc == 0)
+			exit((kill)(gp, SIGUSR2) == -1 && errno == EPERM ? 0 : 1);
+		if (wait(&status) != gc || !WIFEXITED(status) ||
+		    WEXITSTATUS(status) != 0)
+			errx(-1, "signaled a grandparent");
+		exit(0);
+	}
+	if (wait(&status) != c)
+		errx(-1, "wrong child");
+	stchk(status, 0);
+
+	printf("evfd test ok\n");
+}
+
+// reads the next inotify event into buf and checks its watch and mask
+static struct inotify_event *
+_inevent(int fd, char *buf, size_t sz, int wd, uint32_t mask)
+{
+	static char *rem;
+	static ssize_t left;
+	if (left <= 0) {
+		left = read(fd, buf, sz);
+		if (left == -1)
+			err(-1, "inotify read");
+		rem = buf;
+	}
+	struct inotify_event *ie = (struct inotify_event *)rem;
+	size_t esz = sizeof(*ie) + ie->len;
+	rem += esz;
+	left -= esz;
+	if (ie->wd != wd || ie->mask != mask)
+		errx(-1, "inotify event: got %d %x, expected %d %x", ie->wd,
+		    ie->mask, wd, mask);
+	return ie;
+}
+
+void
+inotifytest(void)
+{
+	printf("inotify test\n");
+
+	const char *d = "/indir";
+	const char *f = "/indir/f";
+	if (mkdir(d) == -1)
+		err(-1, "mkdir");
+	int fd = inotify_init1(IN_NONBLOCK);
+	if (fd == -1)
+		err(-1, "inotify_init1");
+	char buf[512];
+	if (read(fd, buf, sizeof(buf)) != -1 || errno != EAGAIN)
+		errx(-1, "no events are queued");
+	if (inotify_add_watch(fd, d, 0) != -1 || errno != EINVAL)
+		errx(-1, "empty inotify mask");
+	int dwd = inotify_add_watch(fd, d, IN_CREATE | IN_DELETE | IN_MOVE);
+	if (dwd == -1)
+		err(-1, "inotify_add_watch");
+	if (inotify_add_watch(fd, d, IN_CREATE | IN_DELETE | IN_MOVE) != dwd)
+		errx(-1, "watching a watched inode should return its wd");
+
+	int ffd = open(f, O_CREAT | O_WRONLY);
+	if (ffd == -1)
+		err(-1, "open");
+	struct inotify_event *ie;
+	ie = _inevent(fd, buf, sizeof(buf), dwd, IN_CREATE);
+	if (ie->len == 0 || strcmp(ie->name, "f") != 0)
+		errx(-1, "wrong name");
+	if (inotify_add_watch(fd, f, IN_ONLYDIR) != -1 || errno != ENOTDIR)
+		errx(-1, "IN_ONLYDIR should fail for files");
+	int fwd = inotify_add_watch(fd, f, IN_MODIFY | IN_CLOSE_WRITE |
+	    IN_ATTRIB | IN_DELETE_SELF);
+	if (fwd == -1 || fwd == dwd)
+		err(-1, "inotify_add_watch");
+
+	struct pollfd pfd = {.fd = fd, .events = POLLIN};
+	if (poll(&pfd, 1, 0) != 0)
+		errx(-1, "empty inotify is readable");
+	// identical successive events are coalesced
+	if (write(ffd, "hi", 2) != 2 || write(ffd, "hi", 2) != 2)
+		err(-1, "write");
+	if (poll(&pfd, 1, 0) != 1 || !(pfd.revents & POLLIN))
+		errx(-1, "inotify not readable");
+	if (read(fd, buf, sizeof(struct inotify_event) - 1) != -1 ||
+	    errno != EINVAL)
+		errx(-1, "short inotify read");
+	_inevent(fd, buf, sizeof(buf), fwd, IN_MODIFY);
+	close(ffd);
+	_inevent(fd, buf, sizeof(buf), fwd, IN_CLOSE_WRITE);
+	if (read(fd, buf, sizeof(buf)) != -1 || errno != EAGAIN)
+		errx(-1, "events were not coalesced");
+
+	// both halves of a rename share a cookie
+	const char *g = "/indir/g";
+	if (rename(f, g) == -1)
+		err(-1, "rename");
+	ie = _inevent(fd, buf, sizeof(buf), dwd, IN_MOVED_FROM);
+	uint32_t cookie = ie->cookie;
+	if (cookie == 0 || strcmp(ie->name, "f") != 0)
+		errx(-1, "bad IN_MOVED_FROM");
+	ie = _inevent(fd, buf, sizeof(buf), dwd, IN_MOVED_TO);
+	if (ie->cookie != cookie || strcmp(ie->name, "g") != 0)
+		errx(-1, "bad IN_MOVED_TO");
+
+	const char *h = "/indir/h";
+	if (link(g, h) == -1)
+		err(-1, "link");
+	_inevent(fd, buf, sizeof(buf), dwd, IN_CREATE);
+	_inevent(fd, buf, sizeof(buf), fwd, IN_ATTRIB);
+	if (unlink(h) == -1)
+		err(-1, "unlink");
+	_inevent(fd, buf, sizeof(buf), dwd, IN_DELETE);
+	_inevent(fd, buf, sizeof(buf), fwd, IN_ATTRIB);
+	// the watch is removed after the file is deleted
+	if (unlink(g) == -1)
+		err(-1, "unlink");
+	ie = _inevent(fd, buf, sizeof(buf), dwd, IN_DELETE);
+	if (strcmp(ie->name, "g") != 0)
+		errx(-1, "wrong name");
+	_inevent(fd, buf, sizeof(buf), fwd, IN_DELETE_SELF);
+	_inevent(fd, buf, sizeof(buf), fwd, IN_IGNORED);
+	if (inotify_rm_watch(fd, fwd) != -1 || errno != EINVAL)
+		errx(-1, "removed watch");
+
+	if (inotify_rm_watch(fd, dwd) == -1)
+		err(-1, "inotify_rm_watch");
+	_inevent(fd, buf, sizeof(buf), dwd, IN_IGNORED);
+	if (rmdir(d) == -1)
+		err(-1, "rmdir");
+	if (read(fd, buf, sizeof(buf)) != -1 || errno != EAGAIN)
+		errx(-1, "unwatched events");
+	close(fd);
+
+	printf("inotify test ok\n");
+}
+
+static int
+_reclock(int fd, int cmd, int type, off_t start, off_t len)
+{
+	struct flock fl = {.l_type = type, .l_whence = SEEK_SET,
+	    .l_start = start, .l_len = len};
+	return fcntl(fd, cmd, &fl);
+}
+
+// returns the type of the first lock which conflicts with a write lock of the
+// range and sets *pid to its owner
+static int
+_getlk(int fd, off_t start, off_t len, pid_t *pid)
+{
+	struct flock fl = {.l_type = F_WRLCK, .l_whence = SEEK_SET,
+	    .l_start = start, .l_len = len};
+	if (fcntl(fd, F_GETLK, &fl) == -1)
+		err(-1, "F_GETLK");
+	if (pid)
+		*pid = fl.l_pid;
+	return fl.l_type;
+}
+
+void
+locktest(void)
+{
+	printf("lock test\n");
+
+	const char *f = "/locktest";
+	int fd = open(f, O_RDWR | O_CREAT | O_TRUNC);
+	if (fd == -1)
+		err(-1, "open");
+	int status;
+
+	// flock locks belong to the open file
+	if (flock(fd, LOCK_EX) == -1)
+		err(-1, "flock");
+	pid_t c = fork();
+	if (c == -1)
+		err(-1, "fork");
+	if (c == 0) {
+		int cfd = open(f, O_RDONLY);
+		if (cfd == -1)
+			err(-1, "child open");
+		if (flock(cfd, LOCK_SH | LOCK_NB) != -1 || errno != EWOULDBLOCK)
+			errx(-1, "flock should conflict");
+		// the inherited descriptor shares the open file
+		if (flock(fd, LOCK_SH | LOCK_NB) == -1)
+			err(-1, "inherited flock");
+		if (flock(fd, LOCK_UN) == -1)
+			err(-1, "flock unlock");
+		if (flock(cfd, LOCK_SH | LOCK_NB) == -1)
+			err(-1, "flock after unlock");
+		// a shared lock conflicts with an exclusive lock of another
+		// open file
+		int cfd2 = open(f, O_RDONLY);
+		if (cfd2 == -1)
+			err(-1, "child open");
+		if (flock(cfd2, LOCK_EX | LOCK_NB) != -1 || errno != EWOULDBLOCK)
+			errx(-1, "shared flock should conflict");
+		exit(0);
+	}
+	if (wait(&status) != c)
+		errx(-1, "wrong child");
+	stchk(status, 0);
+	if (flock(fd, LOCK_EX | LOCK_NB) == -1)
+		err(-1, "flock after child exit");
+	if (flock(fd, 42) != -1 || errno != EINVAL)
+		errx(-1, "bad flock op");
+	close(fd);
+	// closing the last descriptor releases the lock
+	fd = open(f, O_RDWR);
+	if (fd == -1)
+		err(-1, "open");
+	int fd2 = open(f, O_RDWR);
+	if (fd2 == -1)
+		err(-1, "open");
+	if (flock(fd2, LOCK_EX | LOCK_NB) == -1)
+		err(-1, "flock after close");
+	close(fd2);
+
+	// record locks belong to the process
+	if (_reclock(fd, F_SETLK, F_WRLCK, 0, 10) == -1)
+		err(-1, "F_SETLK");
+	if (_reclock(fd, F_SETLK, F_RDLCK, 5, 10) == -1)
+		err(-1, "relock own range");
+	if (_getlk(fd, 0, 0, NULL) != F_UNLCK)
+		errx(-1, "own locks do not conflict");
+	pid_t me = getpid();
+	c = fork();
+	if (c == -1)
+		err(-1, "fork");
+	if (c == 0) {
+		pid_t pid;
+		if (_getlk(fd, 3, 1, &pid) != F_WRLCK || pid != me)
+			errx(-1, "F_GETLK write lock");
+		struct flock fl = {.l_type = F_RDLCK, .l_whence = SEEK_SET,
+		    .l_start = 12, .l_len = 1};
+		if (fcntl(fd, F_GETLK, &fl) == -1)
+			err(-1, "F_GETLK");
+		// the read lock replaced the end of the write lock
+		if (fl.l_type != F_UNLCK)
+			errx(-1, "read locks do not conflict");
+		if (_getlk(fd, 12, 1, NULL) != F_RDLCK)
+			errx(-1, "F_GETLK read lock");
+		if (_reclock(fd, F_SETLK, F_RDLCK, 3, 1) != -1 ||
+		    errno != EAGAIN)
+			errx(-1, "F_SETLK should conflict");
+		if (_reclock(fd, F_SETLK, F_RDLCK, 12, 100) == -1)
+			err(-1, "shared read lock");
+		if (_reclock(fd, F_SETLK, F_WRLCK, 15, 0) == -1)
+			err(-1, "lock to eof");
+		exit(0);
+	}
+	if (wait(&status) != c)
+		errx(-1, "wrong child");
+	stchk(status, 0);
+	// the child's locks were released when it exited
+	if (_reclock(fd, F_SETLK, F_WRLCK, 0, 0) == -1)
+		err(-1, "lock after child exit");
+	// closing any descriptor of the file releases the process' locks
+	fd2 = open(f, O_RDONLY);
+	if (fd2 == -1)
+		err(-1, "open");
+	close(fd2);
+	c = fork();
+	if (c == -1)
+		err(-1, "fork");
+	if (c == 0) {
+		if (_getlk(fd, 0, 0, NULL) != F_UNLCK)
+			errx(-1, "close did not release locks");
+		exit(0);
+	}
+	if (wait(&status) != c)
+		errx(-1, "wrong child");
+	stchk(status, 0);
+
+	// one of two processes waiting for each other fails with EDEADLK
+	int p[2];
+	if (pipe(p) == -1)
+		err(-1, "pipe");
+	if (_reclock(fd, F_SETLK, F_WRLCK, 0, 10) == -1)
+		err(-1, "F_SETLK");
+	c = fork();
+	if (c == -1)
+		err(-1, "fork");
+	if (c == 0) {
+		if (_reclock(fd, F_SETLK, F_WRLCK, 10, 10) == -1)
+			err(-1, "child F_SETLK");
+		if (write(p[1], "x", 1) != 1)
+			err(-1, "write");
+		if (_reclock(fd, F_SETLKW, F_WRLCK, 0, 10) == -1) {
+			if (errno != EDEADLK)
+				err(-1, "child F_SETLKW");
+			exit(1);
+		}
+		exit(0);
+	}
+	char ch;
+	if (read(p[0], &ch, 1) != 1)
+		err(-1, "read");
+	usleep(100000);
+	int deadlk = 0;
+	if (_reclock(fd, F_SETLKW, F_WRLCK, 10, 10) == -1) {
+		if (errno != EDEADLK)
+			err(-1, "F_SETLKW");
+		deadlk = 1;
+		if (_reclock(fd, F_SETLK, F_UNLCK, 0, 10) == -1)
+			err(-1, "unlock");
+	}
+	if (wait(&status) != c)
+		errx(-1, "wrong child");
+	if (!WIFEXITED(status) || WEXITSTATUS(status) == deadlk)
+		errx(-1, "exactly one process should see EDEADLK");
+	if (_reclock(fd, F_SETLK, F_UNLCK, 0, 0) == -1)
+		err(-1, "unlock");
+
+	// waits for a lock are killable
+	if (_reclock(fd, F_SETLK, F_WRLCK, 0, 1) == -1)
+		err(-1, "F_SETLK");
+	c = fork();
+	if (c == -1)
+		err(-1, "fork");
+	if (c == 0) {
+		_reclock(fd, F_SETLKW, F_WRLCK, 0, 1);
+		errx(-1, "F_SETLKW should block");
+	}
+	usleep(100000);
+	if (kill(c) == -1)
+		err(-1, "kill");
+	if (wait(&status) != c)
+		errx(-1, "wrong child");
+	stchk(status, SIGKILL);
+
+	close(p[0]);
+	close(p[1]);
+	close(fd);
+	if (unlink(f) == -1)
+		err(-1, "unlink");
+
+	printf("lock test ok\n");
+}
+
+static void
+_splicechk(const char *buf, size_t len, size_t off)
+{
+	for (size_t i = 0; i < len; i++)
+		if (buf[i] != (char)(off + i))
+			errx(-1, "spliced data mismatch at %zu", off + i);
+}
+
+void
+splicetest(void)
+{
+	printf("splice test\n");
+
+	// the file spans several pages and ends mid-page
+	const char *f = "/splicetest";
+	const char *g = "/splicetest2";
+	const size_t fsz = 3*4096 + 100;
+	static char buf[3*4096 + 100];
+	for (size_t i = 0; i < fsz; i++)
+		buf[i] = (char)i;
+	int fd = open(f, O_RDWR | O_CREAT | O_TRUNC);
+	if (fd == -1)
+		err(-1, "open");
+	if (write(fd, buf, fsz) != fsz)
+		err(-1, "write");
+	int gd = open(g, O_RDWR | O_CREAT | O_TRUNC);
+	if (gd == -1)
+		err(-1, "open");
+
+	// sendfile to a file copies; the given offset is advanced instead of
+	// the file offset
+	off_t off = 10;
+	if (sendfile(gd, fd, &off, 5000) != 5000 || off != 5010)
+		errx(-1, "sendfile with offset");
+	if (lseek(fd, 0, SEEK_CUR) != fsz)
+		errx(-1, "sendfile changed the file offset");
+	if (lseek(fd, fsz - 50, SEEK_SET) == -1)
+		err(-1, "lseek");
+	if (sendfile(gd, fd, NULL, 1000) != 50)
+		errx(-1, "sendfile to eof");
+	if (lseek(fd, 0, SEEK_CUR) != fsz)
+		errx(-1, "sendfile did not advance the file offset");
+	if (sendfile(gd, fd, NULL, 1000) != 0)
+		errx(-1, "sendfile at eof");
+	char rbuf[sizeof(buf)];
+	if (pread(gd, rbuf, 5050, 0) != 5050)
+		err(-1, "pread");
+	_splicechk(rbuf, 5000, 10);
+	_splicechk(rbuf + 5000, 50, fsz - 50);
+
+	int p[2];
+	if (pipe(p) == -1)
+		err(-1, "pipe");
+	if (sendfile(fd, p[0], NULL, 10) != -1 || errno != EINVAL)
+		errx(-1, "sendfile from a pipe");
+
+	// sendfile to a TCP socket sends the page cache pages
+	int s = socket(AF_INET, SOCK_STREAM, 0);
+	if (s == -1)
+		err(-1, "socket");
+	struct sockaddr_in sin = {};
+	sin.sin_family = AF_INET;
+	sin.sin_addr.s_addr = htonl(0x7f000001);
+	sin.sin_port = htons(8181);
+	if (bind(s, (struct sockaddr *)&sin, sizeof(sin)) == -1)
+		err(-1, "bind");
+	if (listen(s, 1) == -1)
+		err(-1, "listen");
+	pid_t c = fork();
+	if (c == -1)
+		err(-1, "fork");
+	if (c == 0) {
+		int cs = socket(AF_INET, SOCK_STREAM, 0);
+		if (cs == -1)
+			err(-1, "socket");
+		if (connect(cs, (struct sockaddr *)&sin, sizeof(sin)) == -1)
+			err(-1, "connect");
+		size_t did = 0;
+		ssize_t r;
+		while ((r = read(cs, rbuf + did, sizeof(rbuf) - did)) > 0)
+			did += r;
+		if (r == -1)
+			err(-1, "read");
+		if (did != fsz)
+			errx(-1, "short tcp read %zu", did);
+		_splicechk(rbuf, fsz - 1, 1);
+		if (rbuf[fsz - 1] != '!')
+			errx(-1, "write did not follow sendfile");
+		exit(0);
+	}
+	int as = accept(s, NULL, NULL);
+	if (as == -1)
+		err(-1, "accept");
+	off = 1;
+	size_t sent = 0;
+	while (sent < fsz - 1) {
+		ssize_t r = sendfile(as, fd, &off, fsz);
+		if (r <= 0)
+			err(-1, "sendfile to socket");
+		sent += r;
+	}
+	if (off != fsz)
+		errx(-1, "bad offset");
+	// written bytes follow the queued pages
+	if (write(as, "!", 1) != 1)
+		err(-1, "write");
+	close(as);
+	int status;
+	if (wait(&status) != c)
+		errx(-1, "wrong child");
+	stchk(status, 0);
+	close(s);
+
+	// splice from a file into a pipe and from the pipe into a file
+	off = 100;
+	if (splice(fd, &off, p[1], NULL, 3000, 0) != 3000 || off != 3100)
+		errx(-1, "splice into pipe");
+	off_t goff = 0;
+	if (splice(p[0], NULL, gd, &goff, 1000, 0) != 1000 || goff != 1000)
+		errx(-1, "splice out of pipe");
+	if (pread(gd, rbuf, 1000, 0) != 1000)
+		err(-1, "pread");
+	_splicechk(rbuf, 1000, 100);
+	// pipe to pipe
+	int q[2];
+	if (pipe(q) == -1)
+		err(-1, "pipe");
+	if (splice(p[0], NULL, q[1], NULL, 5000, 0) != 2000)
+		errx(-1, "splice pipe to pipe");
+	if (read(q[0], rbuf, sizeof(rbuf)) != 2000)
+		err(-1, "read");
+	_splicechk(rbuf, 2000, 1100);
+	if (splice(p[0], NULL, q[1], NULL, 10, SPLICE_F_NONBLOCK) != -1 ||
+	    errno != EAGAIN)
+		errx(-1, "empty pipe splice should not block");
+
+	if (splice(fd, NULL, gd, NULL, 10, 0) != -1 || errno != EINVAL)
+		errx(-1, "splice without a pipe");
+	off = 0;
+	if (splice(p[0], &off, gd, NULL, 10, 0) != -1 || errno != ESPIPE)
+		errx(-1, "splice with a pipe offset");
+	if (splice(p[0], NULL, p[1], NULL, 10, 0) != -1 || errno != EINVAL)
+		errx(-1, "splice to the same pipe");
+	close(p[1]);
+	if (splice(p[0], NULL, gd, NULL, 10, 0) != 0)
+		errx(-1, "splice at eof");
+
+	close(p[0]);
+	close(q[0]);
+	close(q[1]);
+	close(fd);
+	close(gd);
+	if (unlink(f) == -1 || unlink(g) == -1)
+		err(-1, "unlink");
+
+	printf("splice test ok\n");
+}
+
+static void
+_cloexecchk(int fd, int want)
+{
+	int fl = fcntl(fd, F_GETFD);
+	if (fl == -1)
+		err(-1, "F_GETFD %d", fd);
+	if ((fl & FD_CLOEXEC) != want)
+		errx(-1, "fd %d: cloexec %d, expected %d", fd, fl, want);
+}
+
+void
+duptest(void)
 {
-  int fd;
-  int i;
+	printf("dup test\n");
 
-  printf("small file test\n");
-  fd = open("small", O_CREATE|O_RDWR);
-  if(fd >= 0){
-    printf("creat small succeeded; ok\n");
-  } else {
-    printf("error: creat small failed!\n");
-    exit(0);
-  }
-  for(i = 0; i < 100; i++){
-    if(write(fd, "aaaaaaaaaa", 10) != 10){
-      printf("error: write aa %d new file failed\n", i);
-      exit(0);
-    }
-    if(write(fd, "bbbbbbbbbb", 10) != 10){
-      printf("error: write bb %d new file failed\n", i);
-      exit(0);
-    }
-  }
-  printf("writes ok\n");
-  close(fd);
-  fd = open("small", O_RDONLY);
-  if(fd >= 0){
-    printf("open small succeeded ok\n");
-  } else {
-    printf("error: open small failed!\n");
-    exit(0);
-  }
-  i = read(fd, buf, 2000);
-  if(i == 2000){
-    printf("read succeeded ok\n");
-  } else {
-    printf("read failed\n");
-    exit(0);
-  }
-  close(fd);
+	int p[2];
+	if (pipe(p) == -1)
+		err(-1, "pipe");
+	if (fcntl(p[0], F_SETFD, FD_CLOEXEC) == -1)
+		err(-1, "F_SETFD");
+
+	// dup returns the lowest free fd and clears close-on-exec
+	int d = dup(p[0]);
+	if (d == -1)
+		err(-1, "dup");
+	if (close(d) == -1)
+		err(-1, "close");
+	if (dup(p[0]) != d)
+		errx(-1, "dup should reuse %d", d);
+	_cloexecchk(d, 0);
+	_cloexecchk(p[0], FD_CLOEXEC);
+
+	// F_DUPFD returns the lowest free fd not less than the argument
+	if (fcntl(p[0], F_DUPFD, 20) != 20)
+		errx(-1, "F_DUPFD");
+	if (fcntl(p[0], F_DUPFD, 20) != 21)
+		errx(-1, "F_DUPFD");
+	if (fcntl(p[1], F_DUPFD_CLOEXEC, 20) != 22)
+		errx(-1, "F_DUPFD_CLOEXEC");
+	_cloexecchk(21, 0);
+	_cloexecchk(22, FD_CLOEXEC);
+	if (fcntl(p[0], F_DUPFD, -1) != -1 || errno != EINVAL)
+		errx(-1, "F_DUPFD should fail");
+
+	if (dup3(p[1], 30, O_CLOEXEC) != 30)
+		errx(-1, "dup3");
+	_cloexecchk(30, FD_CLOEXEC);
+	if (dup3(p[1], 30, 0) != 30)
+		errx(-1, "dup3");
+	_cloexecchk(30, 0);
+	if (dup3(30, 30, 0) != -1 || errno != EINVAL)
+		errx(-1, "dup3 to itself should fail");
+	if (dup3(p[1], 31, O_NONBLOCK) != -1 || errno != EINVAL)
+		errx(-1, "dup3 with bad flags should fail");
+	if (dup2(30, 30) != 30)
+		errx(-1, "dup2 to itself");
+	if (dup2(31, 31) != -1 || errno != EBADF)
+		errx(-1, "dup2 of a closed fd should fail");
+
+	// the copies refer to the same pipe
+	char buf[4];
+	if (write(30, "dup", 3) != 3)
+		err(-1, "write");
+	if (read(21, buf, sizeof(buf)) != 3 || strncmp(buf, "dup", 3) != 0)
+		errx(-1, "read");
 
-  if(unlink("small") < 0){
-    printf("unlink small failed\n");
-    exit(0);
-  }
-  printf("small file test ok\n");
+	if (close_range(20, 29, CLOSE_RANGE_CLOEXEC) == -1)
+		err(-1, "close_range");
+	_cloexecchk(20, FD_CLOEXEC);
+	_cloexecchk(21, FD_CLOEXEC);
+	_cloexecchk(30, 0);
+	if (close_range(20, 30, 0) == -1)
+		err(-1, "close_range");
+	int i;
+	for (i = 20; i <= 30; i++)
+		if (fcntl(i, F_GETFD) != -1 || errno != EBADF)
+			errx(-1, "fd %d should be closed", i);
+	if (close_range(30, 20, 0) != -1 || errno != EINVAL)
+		errx(-1, "close_range should fail");
+
+	if (close(d) == -1 || close(p[0]) == -1 || close(p[1]) == -1)
+		err(-1, "close");
+	printf("dup test ok\n");
 }
 
+// a position-independent Linux program which writes "ok\n" to stdout, makes a
+// system call Linux does not have and exits with the negated result, ENOSYS.
+static const unsigned char _linuxprog[] = {
+	// ELF header: ELFCLASS64, little-endian, ET_DYN, x86-64
+	0x7f, 'E', 'L', 'F', 2, 1, 1, 0, 0, 0, 0, 0, 0, 0, 0, 0,
+	3, 0, 0x3e, 0, 1, 0, 0, 0,
+	// entry, program header offset, section header offset
+	0x78, 0, 0, 0, 0, 0, 0, 0,
+	0x40, 0, 0, 0, 0, 0, 0, 0,
+	0, 0, 0, 0, 0, 0, 0, 0,
+	// flags, header sizes and counts
+	0, 0, 0, 0, 0x40, 0, 0x38, 0, 1, 0, 0, 0, 0, 0, 0, 0,
+	// PT_LOAD of the whole file, readable and executable
+	1, 0, 0, 0, 5, 0, 0, 0,
+	0, 0, 0, 0, 0, 0, 0, 0,
+	0, 0, 0, 0, 0, 0, 0, 0,
+	0, 0, 0, 0, 0, 0, 0, 0,
+	0xa5, 0, 0, 0, 0, 0, 0, 0,
+	0xa5, 0, 0, 0, 0, 0, 0, 0,
+	0, 0x10, 0, 0, 0, 0, 0, 0,
+	// lea msg(%rip), %rsi
+	0x48, 0x8d, 0x35, 0x23, 0, 0, 0,
+	// write(1, msg, 3)
+	0xbf, 1, 0, 0, 0,
+	0xba, 3, 0, 0, 0,
+	0xb8, 1, 0, 0, 0,
+	0x0f, 0x05,
+	// syscall 500
+	0xb8, 0xf4, 1, 0, 0,
+	0x0f, 0x05,
+	// exit_group(-%eax)
+	0x89, 0xc7,
+	0xf7, 0xdf,
+	0xb8, 0xe7, 0, 0, 0,
+	0x0f, 0x05,
+	// msg
+	'o', 'k', '\n',
+};
+
 void
-writetest1(void)
+linuxtest(void)
 {
-  int i, fd, n;
+	printf("linux abi test\n");
 
-  printf("big files test\n");
+	int old = personality(0xffffffff);
+	if (old == -1)
+		err(-1, "personality");
+	if (personality(0x2) != -1 || errno != EINVAL)
+		errx(-1, "bad domain accepted");
 
-  fd = open("big", O_CREATE|O_RDWR);
-  if(fd < 0){
-    printf("error: creat big failed!\n");
-    exit(0);
-  }
+	char *f = "/tmp/linuxprog";
+	int fd = open(f, O_CREAT | O_TRUNC | O_WRONLY);
+	if (fd == -1)
+		err(-1, "open");
+	if (write(fd, _linuxprog, sizeof(_linuxprog)) != sizeof(_linuxprog))
+		err(-1, "write");
+	close(fd);
 
-  for(i = 0; i < MAXFILE; i++){
-    ((int*)buf)[0] = i;
-    if(write(fd, buf, BSIZE) != BSIZE){
-      printf("error: write big file failed\n");
-      exit(0);
-    }
-  }
+	int p[2];
+	if (pipe(p) == -1)
+		err(-1, "pipe");
+	pid_t c = fork();
+	if (c == -1)
+		err(-1, "fork");
+	if (c == 0) {
+		if (dup2(p[1], 1) == -1)
+			err(-1, "dup2");
+		close(p[0]);
+		close(p[1]);
+		// the domain takes effect at exec
+		if (personality((old & ~PER_MASK) | PER_LINUX) != old)
+			errx(-1, "personality mismatch");
+		char *args[] = {f, NULL};
+		execv(f, args);
+		err(-1, "execv");
+	}
+	close(p[1]);
+	char buf[8];
+	int tot = 0, r;
+	while ((r = read(p[0], buf + tot, sizeof(buf) - tot)) > 0)
+		tot += r;
+	if (r == -1)
+		err(-1, "read");
+	close(p[0]);
+	int status;
+	if (wait(&status) != c)
+		errx(-1, "wrong child");
+	if (!WIFEXITED(status) || WEXITSTATUS(status) != ENOSYS)
+		errx(-1, "linux program failed: %x", status);
+	if (tot != 3 || strncmp(buf, "ok\n", 3) != 0)
+		errx(-1, "unexpected output");
+
+	if (unlink(f) == -1)
+		err(-1, "unlink");
+	printf("linux abi test ok\n");
+}
 
-  close(fd);
+static char _clonestk[4096*4];
+static volatile int _cloneval;
 
-  fd = open("big", O_RDONLY);
-  if(fd < 0){
-    printf("error: open big failed!\n");
-    exit(0);
-  }
+static int
+_clonestore(void *arg)
+{
+	_cloneval = (int)(long)arg;
+	return 0;
+}
 
-  n = 0;
-  for(;;){
-    i = read(fd, buf, BSIZE);
-    if(i == 0){
-      if(n == MAXFILE - 1){
-        printf("read only %d blocks from big", n);
-        exit(0);
-      }
-      break;
-    } else if(i != BSIZE){
-      printf("read failed %d\n", i);
-      exit(0);
-    }
-    if(((int*)buf)[0] != n){
-      printf("read content of block %d is %d\n",
-             n, ((int*)buf)[0]);
-      exit(0);
-    }
-    n++;
-  }
-  close(fd);
-  if(unlink("big") < 0){
-    printf("unlink big failed\n");
-    exit(0);
-  }
-  printf("big files ok\n");
+static int
+_cloneclose(void *arg)
+{
+	return close((int)(long)arg) == 0 ? 0 : 1;
 }
 
-void
-createtest(void)
+static int
+_clonechdir(void *arg)
 {
-  int i, fd;
+	return chdir(arg) == 0 ? 0 : 1;
+}
 
-  printf("many creates, followed by unlink test\n");
+static int
+_cloneexec(void *arg)
+{
+	char *args[] = {arg, NULL};
+	execv(arg, args);
+	return 1;
+}
 
-  name[0] = 'a';
-  name[2] = '\0';
-  for(i = 0; i < 52; i++){
-    name[1] = '0' + i;
-    fd = open(name, O_CREATE|O_RDWR);
-    close(fd);
-  }
-  name[0] = 'a';
-  name[2] = '\0';
-  for(i = 0; i < 52; i++){
-    name[1] = '0' + i;
-    unlink(name);
-  }
-  printf("many creates, followed by unlink; ok\n");
+// clones a child which calls fn with arg and returns its exit status
+static int
+_clonewait(int (*fn)(void *), int flags, void *arg)
+{
+	pid_t c = clone(fn, _clonestk + sizeof(_clonestk), flags, arg);
+	if (c == -1)
+		err(-1, "clone");
+	int status;
+	if (wait(&status) != c)
+		errx(-1, "wrong child");
+	if (!WIFEXITED(status))
+		errx(-1, "clone child failed: %x", status);
+	return WEXITSTATUS(status);
 }
 
-void dirtest(void)
+void
+clonetest(void)
 {
-  printf("mkdir test\n");
+	printf("clone test\n");
+
+	// a vfork child shares the address space and the parent resumes
+	// once it exits
+	pid_t ptid = 0, ctid = 0;
+	_cloneval = 0;
+	pid_t c = clone(_clonestore, _clonestk + sizeof(_clonestk),
+	    CLONE_VM | CLONE_VFORK | CLONE_PARENT_SETTID | CLONE_CHILD_SETTID,
+	    (void *)42, &ptid, NULL, &ctid);
+	if (c == -1)
+		err(-1, "clone");
+	if (_cloneval != 42)
+		errx(-1, "store of vfork child not visible");
+	if (ptid != c || ctid != c)
+		errx(-1, "tids not set: %ld %ld %ld", c, ptid, ctid);
+	int status;
+	if (wait(&status) != c || !WIFEXITED(status) ||
+	    WEXITSTATUS(status) != 0)
+		errx(-1, "vfork child failed");
 
-  if(mkdir("dir0") < 0){
-    printf("mkdir failed\n");
-    exit(0);
-  }
+	// without CLONE_VM the child stores into its copy
+	if (_clonewait(_clonestore, 0, (void *)7) != 0)
+		errx(-1, "child failed");
+	if (_cloneval != 42)
+		errx(-1, "store of child visible");
 
-  if(chdir("dir0") < 0){
-    printf("chdir dir0 failed\n");
-    exit(0);
-  }
+	// a child sharing the fd table closes the parent's fd
+	int p[2];
+	if (pipe(p) == -1)
+		err(-1, "pipe");
+	if (_clonewait(_cloneclose, CLONE_FILES, (void *)(long)p[0]) != 0)
+		errx(-1, "child close failed");
+	if (fcntl(p[0], F_GETFD) != -1 || errno != EBADF)
+		errx(-1, "fd table not shared");
+	if (_clonewait(_cloneclose, 0, (void *)(long)p[1]) != 0)
+		errx(-1, "child close failed");
+	if (fcntl(p[1], F_GETFD) == -1)
+		errx(-1, "fd table shared");
+	close(p[1]);
 
-  if(chdir("..") < 0){
-    printf("chdir .. failed\n");
-    exit(0);
-  }
+	// a child sharing the working directory changes the parent's
+	char cwd[128], ncwd[128];
+	if (getcwd(cwd, sizeof(cwd)) == NULL)
+		err(-1, "getcwd");
+	if (_clonewait(_clonechdir, 0, "/tmp") != 0)
+		errx(-1, "child chdir failed");
+	if (getcwd(ncwd, sizeof(ncwd)) == NULL)
+		err(-1, "getcwd");
+	if (strcmp(cwd, ncwd) != 0)
+		errx(-1, "cwd shared");
+	if (_clonewait(_clonechdir, CLONE_FS, "/tmp") != 0)
+		errx(-1, "child chdir failed");
+	if (getcwd(ncwd, sizeof(ncwd)) == NULL)
+		err(-1, "getcwd");
+	if (strcmp(ncwd, "/tmp") != 0)
+		errx(-1, "cwd not shared: %s", ncwd);
+	if (chdir(cwd) == -1)
+		err(-1, "chdir");
 
-  if(rmdir("dir0") < 0){
-    printf("rmdir dir0 failed\n");
-    exit(0);
-  }
-  if (mkdir("/") != -1)
-    errx(-1, "expected failure");
-  printf("mkdir test ok\n");
+	// a vfork child which execs gets its own address space
+	if (_clonewait(_cloneexec, CLONE_VM | CLONE_VFORK, "/bin/true") != 0)
+		errx(-1, "exec of vfork child failed");
+
+	if (clone(_clonestore, _clonestk + sizeof(_clonestk), CLONE_SIGHAND,
+	    NULL) != -1 || errno != EINVAL)
+		errx(-1, "CLONE_SIGHAND without CLONE_VM accepted");
+	printf("clone test ok\n");
 }
 
 void
-exectest(void)
+envtest(void)
 {
-  printf("exec test\n");
-  if(exec("/bin/echo", echoargv) < 0){
-    printf("exec echo failed\n");
-    exit(0);
-  }
+	printf("env test\n");
+	if (getenv("USERTESTS") != NULL)
+		errx(-1, "unexpected var");
+	if (setenv("USERTESTS", "one", 1) == -1)
+		err(-1, "setenv");
+	if (setenv("USERTESTS", "two", 0) == -1)
+		err(-1, "setenv");
+	char *v = getenv("USERTESTS");
+	if (v == NULL || strcmp(v, "one") != 0)
+		errx(-1, "getenv mismatch");
+	if (setenv("USERTESTS", "two", 1) == -1)
+		err(-1, "setenv");
+	v = getenv("USERTESTS");
+	if (v == NULL || strcmp(v, "two") != 0)
+		errx(-1, "getenv mismatch");
+	if (setenv("BAD=", "x", 1) != -1 || errno != EINVAL)
+		errx(-1, "setenv accepted bad name");
+	if (unsetenv("USERTESTS") == -1)
+		err(-1, "unsetenv");
+	if (getenv("USERTESTS") != NULL)
+		errx(-1, "unsetenv failed");
+
+	// a script is run by the interpreter named on its first line
+	char *script = "envscript";
+	char *out = "envscriptout";
+	int fd = open(script, O_CREAT | O_WRONLY | O_TRUNC);
+	if (fd < 0)
+		err(-1, "open");
+	char *body = "#!/bin/lsh\necho script ok > envscriptout\n";
+	if (write(fd, body, strlen(body)) != strlen(body))
+		err(-1, "write");
+	close(fd);
+	char *args[] = {script, NULL};
+	char *envp[] = {"A=B", NULL};
+	pid_t c = fork();
+	if (c == -1)
+		err(-1, "fork");
+	if (c == 0) {
+		execve(script, args, envp);
+		err(-1, "execve script");
+	}
+	int status;
+	if (wait(&status) != c)
+		errx(-1, "wrong child");
+	if (!WIFEXITED(status) || WEXITSTATUS(status) != 0)
+		errx(-1, "script failed");
+	if ((fd = open(out, O_RDONLY)) < 0)
+		err(-1, "open");
+	char rbuf[32];
+	ssize_t r = read(fd, rbuf, sizeof(rbuf) - 1);
+	if (r < 0)
+		err(-1, "read");
+	rbuf[r] = '\0';
+	close(fd);
+	if (strcmp(rbuf, "script ok\n") != 0)
+		errx(-1, "script output mismatch");
+
+	// files which are neither ELF nor scripts cannot be executed
+	if ((fd = open(script, O_WRONLY | O_TRUNC)) < 0)
+		err(-1, "open");
+	if (write(fd, "junk\n", 5) != 5)
+		err(-1, "write");
+	close(fd);
+	if (execve(script, args, envp) != -1 || errno != ENOEXEC)
+		errx(-1, "exec of junk should fail");
+
+	unlink(script);
+	unlink(out);
+	printf("env test ok\n");
 }
 
 // simple fork and pipe read/write
@@ -2013,6 +4549,200 @@ posixtest()
 	printf("posix test ok\n");
 }
 
+void
+spawntest(void)
+{
+	printf("spawn test\n");
+
+	// the child's stdout is a file opened by a file action
+	char *of = "/tmp/spawnout";
+	posix_spawn_file_actions_t fa;
+	posix_spawn_file_actions_init(&fa);
+	if (posix_spawn_file_actions_addclose(&fa, 0) < 0)
+		errx(-1, "addclose");
+	if (posix_spawn_file_actions_addopen(&fa, 1, of,
+	    O_CREAT | O_TRUNC | O_WRONLY, 0644) < 0)
+		errx(-1, "addopen");
+	char *args[] = {"/bin/echo", "spawned", NULL};
+	pid_t c;
+	int ret = posix_spawn(&c, args[0], &fa, NULL, args, NULL);
+	if (ret)
+		errx(-1, "posix_spawn: %d", ret);
+	posix_spawn_file_actions_destroy(&fa);
+
+	int status;
+	if (wait(&status) != c)
+		errx(-1, "wrong child");
+	if (!WIFEXITED(status) || WEXITSTATUS(status) != 0)
+		errx(-1, "spawned child failed: %x", status);
+	int fd = open(of, O_RDONLY);
+	if (fd == -1)
+		err(-1, "open");
+	char buf[16];
+	if (read(fd, buf, sizeof(buf)) != 8 || strncmp(buf, "spawned\n", 8) != 0)
+		errx(-1, "unexpected output");
+	close(fd);
+	if (unlink(of) == -1)
+		err(-1, "unlink");
+
+	// failures are reported to the parent and leave no child
+	if (posix_spawn(&c, "/bin/nonexistent", NULL, NULL, args, NULL) !=
+	    ENOENT)
+		errx(-1, "spawn of missing file should fail");
+	posix_spawn_file_actions_init(&fa);
+	if (posix_spawn_file_actions_adddup2(&fa, 100, 1) < 0)
+		errx(-1, "adddup2");
+	if (posix_spawn(&c, args[0], &fa, NULL, args, NULL) != EBADF)
+		errx(-1, "spawn with bad file action should fail");
+	posix_spawn_file_actions_destroy(&fa);
+	if (wait(&status) != -1 || errno != ECHILD)
+		errx(-1, "failed spawn created a child");
+	printf("spawn test ok\n");
+}
+
+static void
+_schedchild(void)
+{
+	if (getpriority(PRIO_PROCESS, 0) != 0)
+		errx(-1, "default nice");
+	if (nice(5) != 5 || getpriority(PRIO_PROCESS, 0) != 5)
+		errx(-1, "nice");
+	// children inherit the nice value
+	pid_t c = fork();
+	if (c == -1)
+		err(-1, "fork");
+	if (c == 0) {
+		if (getpriority(PRIO_PROCESS, 0) != 5)
+			errx(-1, "nice not inherited");
+		exit(0);
+	}
+	int status;
+	if (wait(&status) != c || !WIFEXITED(status) ||
+	    WEXITSTATUS(status) != 0)
+		errx(-1, "child failed");
+	// out-of-range values are clamped
+	if (setpriority(PRIO_PROCESS, 0, 100) == -1)
+		err(-1, "setpriority");
+	if (getpriority(PRIO_PROCESS, 0) != 19)
+		errx(-1, "nice not clamped");
+	// the nice value can only be raised
+	if (setpriority(PRIO_PROCESS, 0, 10) != -1 || errno != EACCES)
+		errx(-1, "lowering nice should fail");
+	// only the process and its descendants can be changed
+	pid_t par = getppid();
+	if (setpriority(PRIO_PROCESS, par, 19) != -1 || errno != EPERM)
+		errx(-1, "renicing the parent should fail");
+	if (setpriority(PRIO_PROCESS + 1, 0, 0) != -1 || errno != EINVAL)
+		errx(-1, "bad which should fail");
+	if (getpriority(PRIO_PROCESS, 1 << 30) != -1 || errno != ESRCH)
+		errx(-1, "bad pid should fail");
+
+	// the realtime class
+	if (sched_getscheduler(0) != SCHED_OTHER)
+		errx(-1, "default policy");
+	struct sched_param sp = {.sched_priority = 0};
+	if (sched_setscheduler(0, SCHED_FIFO, &sp) != -1 || errno != EINVAL)
+		errx(-1, "realtime priority 0 should fail");
+	sp.sched_priority = 100;
+	if (sched_setscheduler(0, SCHED_FIFO, &sp) != -1 || errno != EINVAL)
+		errx(-1, "realtime priority 100 should fail");
+	// RLIMIT_RTPRIO permits realtime priorities
+	sp.sched_priority = 10;
+	if (sched_setscheduler(0, SCHED_FIFO, &sp) != -1 || errno != EPERM)
+		errx(-1, "realtime without RLIMIT_RTPRIO should fail");
+	struct rlimit rl;
+	if (getrlimit(RLIMIT_RTPRIO, &rl) == -1)
+		err(-1, "getrlimit");
+	if (rl.rlim_cur != 0)
+		errx(-1, "default RLIMIT_RTPRIO");
+	rl.rlim_cur = 10;
+	if (setrlimit(RLIMIT_RTPRIO, &rl) == -1)
+		err(-1, "setrlimit");
+	// the hard limit can only be lowered
+	rl.rlim_max = 10;
+	if (setrlimit(RLIMIT_RTPRIO, &rl) == -1)
+		err(-1, "setrlimit");
+	rl.rlim_max = 20;
+	if (setrlimit(RLIMIT_RTPRIO, &rl) != -1 || errno != EPERM)
+		errx(-1, "raising the RLIMIT_RTPRIO hard limit should fail");
+	if (sched_setscheduler(par, SCHED_FIFO, &sp) != -1 || errno != EPERM)
+		errx(-1, "changing the parent's policy should fail");
+	if (sched_setscheduler(0, SCHED_FIFO, &sp) == -1)
+		err(-1, "sched_setscheduler");
+	sp.sched_priority = 0;
+	if (sched_getparam(0, &sp) == -1 || sp.sched_priority != 10)
+		errx(-1, "sched_getparam");
+	if (sched_getscheduler(getpid()) != SCHED_FIFO)
+		errx(-1, "policy not set");
+	sp.sched_priority = 0;
+	if (sched_setscheduler(0, SCHED_OTHER, &sp) == -1)
+		err(-1, "sched_setscheduler");
+
+	// CPU affinity
+	cpu_set_t all, one;
+	if (sched_getaffinity(0, sizeof(all), &all) == -1)
+		err(-1, "sched_getaffinity");
+	if (!CPU_ISSET(0, &all))
+		errx(-1, "cpu 0 not allowed");
+	CPU_ZERO(&one);
+	CPU_SET(0, &one);
+	if (sched_setaffinity(par, sizeof(one), &one) != -1 || errno != EPERM)
+		errx(-1, "pinning the parent should fail");
+	if (sched_setaffinity(0, sizeof(one), &one) == -1)
+		err(-1, "sched_setaffinity");
+	// the thread still runs after migrating
+	volatile int i;
+	for (i = 0; i < 1000000; i++)
+		;
+	cpu_set_t got;
+	if (sched_getaffinity(0, sizeof(got), &got) == -1)
+		err(-1, "sched_getaffinity");
+	if (got._bits[0] != one._bits[0])
+		errx(-1, "affinity not set");
+	CPU_ZERO(&one);
+	if (sched_setaffinity(0, sizeof(one), &one) != -1 || errno != EINVAL)
+		errx(-1, "empty mask should fail");
+	if (sched_setaffinity(0, sizeof(all), &all) == -1)
+		err(-1, "sched_setaffinity");
+	exit(0);
+}
+
+void
+schedtest(void)
+{
+	printf("sched test\n");
+
+	// change the priorities of a child, not of the tests
+	pid_t c = fork();
+	if (c == -1)
+		err(-1, "fork");
+	if (c == 0)
+		_schedchild();
+	int status;
+	if (wait(&status) != c || !WIFEXITED(status) ||
+	    WEXITSTATUS(status) != 0)
+		errx(-1, "sched child failed");
+	if (getpriority(PRIO_PROCESS, 0) != 0)
+		errx(-1, "parent nice changed");
+
+	// the nice value of another process
+	c = fork();
+	if (c == -1)
+		err(-1, "fork");
+	if (c == 0) {
+		sleep(1);
+		exit(getpriority(PRIO_PROCESS, 0) == 7 ? 0 : 1);
+	}
+	if (setpriority(PRIO_PROCESS, c, 7) == -1)
+		err(-1, "setpriority");
+	if (getpriority(PRIO_PROCESS, c) != 7)
+		errx(-1, "getpriority of child");
+	if (wait(&status) != c || !WIFEXITED(status) ||
+	    WEXITSTATUS(status) != 0)
+		errx(-1, "child nice not set");
+	printf("sched test ok\n");
+}
+
 void
 lseektest()
 {
@@ -3833,6 +6563,8 @@ main(int argc, char *argv[])
   bigdir(); // slow
 
   posixtest();
+  spawntest();
+  schedtest();
   barriertest();
   threadwait();
   
@@ -3863,6 +6595,28 @@ main(int argc, char *argv[])
 
   killtest();
   lstats();
+  envtest();
+  aslrtest();
+  mprotecttest();
+  mremaptest();
+  swaptest();
+  thptest();
+  advisetest();
+  rsstest();
+  cgrouptest();
+  oomtest();
+  ksmtest();
+  uffdtest();
+  mlocktest();
+  ipctest();
+  epolltest();
+  evfdtest();
+  inotifytest();
+  locktest();
+  splicetest();
+  duptest();
+  linuxtest();
+  clonetest();
 
   exectest();
 
@@ -701,6 +701,17 @@ TEXT ·Rdtsc(SB), NOSPLIT, $0-8
 	MOVL	DX, ret+4(FP)
 	RET
 
+// the second return value is false if the CPU had no random number ready
+TEXT ·Rdrand(SB), NOSPLIT, $0-9
+	// rdrand %rax
+	BYTE	$0x48
+	BYTE	$0x0f
+	BYTE	$0xc7
+	BYTE	$0xf0
+	MOVQ	AX, ret+0(FP)
+	SETCS	ret1+8(FP)
+	RET
+
 TEXT ·Cli(SB), NOSPLIT, $0-0
 	CLI
 	RET
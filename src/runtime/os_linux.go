@@ -31,9 +31,12 @@ const (
 )
 
 // Atomically,
+//
 //	if(*addr == val) sleep
+//
 // Might be woken up spuriously; that's allowed.
 // Don't sleep longer than ns; ns < 0 means forever.
+//
 //go:nosplit
 func futexsleep(addr *uint32, val uint32, ns int64) {
 	var ts timespec
@@ -65,6 +68,7 @@ func futexsleep(addr *uint32, val uint32, ns int64) {
 }
 
 // If any procs are sleeping on addr, wake up at most cnt.
+//
 //go:nosplit
 func futexwakeup(addr *uint32, cnt uint32) {
 	ret := futex(unsafe.Pointer(addr), _FUTEX_WAKE_PRIVATE, cnt, nil, nil, 0)
@@ -142,6 +146,7 @@ const (
 func clone(flags int32, stk, mp, gp, fn unsafe.Pointer) int32
 
 // May run with m.p==nil, so write barriers are not allowed.
+//
 //go:nowritebarrier
 func newosproc(mp *m, stk unsafe.Pointer) {
 	/*
@@ -168,6 +173,7 @@ func newosproc(mp *m, stk unsafe.Pointer) {
 }
 
 // Version of newosproc that doesn't require a valid G.
+//
 //go:nosplit
 func newosproc0(stacksize uintptr, fn unsafe.Pointer) {
 	stack := sysAlloc(stacksize, &memstats.stacks_sys)
@@ -316,6 +322,7 @@ func goenvs() {
 // Called to do synchronous initialization of Go code built with
 // -buildmode=c-archive or -buildmode=c-shared.
 // None of the Go runtime is initialized.
+//
 //go:nosplit
 //go:nowritebarrierrec
 func libpreinit() {
@@ -343,6 +350,7 @@ func minit() {
 }
 
 // Called from dropm to undo the effect of an minit.
+//
 //go:nosplit
 func unminit() {
 	unminitSignals()
@@ -417,6 +425,7 @@ func Rcr3() uintptr
 func Rcr4() uintptr
 func Rdmsr(int) int
 func Rdtsc() uint64
+func Rdrand() (uint64, bool)
 func Sgdt(*uintptr)
 func Sidt(*uintptr)
 func Store32(*uint32, uint32)
@@ -429,13 +438,15 @@ func _userint()
 func _userret()
 func _Userrun(*[TFSIZE]uintptr, bool, *cpu_t) (int, int)
 func Userrun(tf *[TFSIZE]uintptr, fxbuf *[FXREGS]uintptr,
-    p_pmap uintptr, fastret bool, pmap_ref *int32) (int, int, uintptr, bool)
+	p_pmap uintptr, fastret bool, pmap_ref *int32) (int, int, uintptr, bool)
 func Wrmsr(int, int)
 
 // adds src to dst
 func Objsadd(src *Resobjs_t, dst *Resobjs_t)
+
 // subs src from dst
 func Objssub(src *Resobjs_t, dst *Resobjs_t)
+
 // returns a bit mask which is set when the corresponding element of a is
 // larger than b.
 func Objscmp(a *Resobjs_t, b *Resobjs_t) uint
@@ -454,20 +465,20 @@ func Mfence()
 // - using range to iterate over a string (calls stringiter*)
 
 type cpu_t struct {
-	this		*cpu_t
-	mythread	*thread_t
-	rsp		uintptr
-	num		uint
-	sysrsp		uintptr
-	shadowcr3	uintptr
-	shadowfs	uintptr
-	tf	*[TFSIZE]uintptr
-	fxbuf	*[FXREGS]uintptr
+	this      *cpu_t
+	mythread  *thread_t
+	rsp       uintptr
+	num       uint
+	sysrsp    uintptr
+	shadowcr3 uintptr
+	shadowfs  uintptr
+	tf        *[TFSIZE]uintptr
+	fxbuf     *[FXREGS]uintptr
 	// APIC id is nice because it is a reliable CPU identifier, even during
 	// NMI interrupts (which may occur during a swapgs pair, making Gscpu()
 	// return garbage during the NMI handler).
-	apicid		uint32
-	_		[56]uint8
+	apicid uint32
+	_      [56]uint8
 }
 
 func (c *cpu_t) _init(p *cpu_t) {
@@ -486,60 +497,60 @@ const MAXCPUS int = 32
 var cpus [MAXCPUS]cpu_t
 
 type prof_t struct {
-	enabled		int
-	totaltime	int
-	stampstart	int
+	enabled    int
+	totaltime  int
+	stampstart int
 }
 
 // XXX rearrange these for better spatial locality; p_pmap should probably be
 // near front
 type thread_t struct {
-	tf		[TFSIZE]uintptr
+	tf [TFSIZE]uintptr
 	//_pad		int
-	fx		[FXREGS]uintptr
-	sigtf		[TFSIZE]uintptr
-	sigfx		[FXREGS]uintptr
-	status		int
-	doingsig	int
-	sigstack	uintptr
-	sigsize		uintptr
-	prof		prof_t
-	sleepfor	int
-	sleepret	int
-	futaddr		uintptr
-	p_pmap		uintptr
-	_pad2		int
+	fx       [FXREGS]uintptr
+	sigtf    [TFSIZE]uintptr
+	sigfx    [FXREGS]uintptr
+	status   int
+	doingsig int
+	sigstack uintptr
+	sigsize  uintptr
+	prof     prof_t
+	sleepfor int
+	sleepret int
+	futaddr  uintptr
+	p_pmap   uintptr
+	_pad2    int
 }
 
 //var DUR uintptr
 
 // XXX fix these misleading names
-const(
-  TFSIZE       = 24
-  FXREGS       = 64
-  TFREGS       = 17
-  TF_GSBASE    = 0
-  TF_FSBASE    = 1
-  TF_R8        = 9
-  TF_RBP       = 10
-  TF_RSI       = 11
-  TF_RDI       = 12
-  TF_RDX       = 13
-  TF_RCX       = 14
-  TF_RBX       = 15
-  TF_RAX       = 16
-  TF_TRAPNO    = TFREGS
-  TF_RIP       = TFREGS + 2
-  TF_CS        = TFREGS + 3
-  TF_RSP       = TFREGS + 5
-  TF_SS        = TFREGS + 6
-  TF_RFLAGS    = TFREGS + 4
-    TF_FL_IF     uintptr = 1 << 9
+const (
+	TFSIZE            = 24
+	FXREGS            = 64
+	TFREGS            = 17
+	TF_GSBASE         = 0
+	TF_FSBASE         = 1
+	TF_R8             = 9
+	TF_RBP            = 10
+	TF_RSI            = 11
+	TF_RDI            = 12
+	TF_RDX            = 13
+	TF_RCX            = 14
+	TF_RBX            = 15
+	TF_RAX            = 16
+	TF_TRAPNO         = TFREGS
+	TF_RIP            = TFREGS + 2
+	TF_CS             = TFREGS + 3
+	TF_RSP            = TFREGS + 5
+	TF_SS             = TFREGS + 6
+	TF_RFLAGS         = TFREGS + 4
+	TF_FL_IF  uintptr = 1 << 9
 )
 
 //go:nosplit
 func Gscpu() *cpu_t {
-	if rflags() & TF_FL_IF != 0 {
+	if rflags()&TF_FL_IF != 0 {
 		pancake("must not be interruptible", 0)
 	}
 	return _Gscpu()
@@ -547,7 +558,7 @@ func Gscpu() *cpu_t {
 
 //go:nosplit
 func NMI_Gscpu() *cpu_t {
-	if rflags() & TF_FL_IF != 0 {
+	if rflags()&TF_FL_IF != 0 {
 		pancake("must not be interruptible", 0)
 	}
 	me := lap_id()
@@ -574,7 +585,7 @@ func CPUHint() int {
 //go:nowritebarrierrec
 //go:nosplit
 func Userrun_slow(tf *[TFSIZE]uintptr, fxbuf *[FXREGS]uintptr,
-    p_pmap uintptr, fastret bool, pmap_ref *int32) (int, int, uintptr, bool) {
+	p_pmap uintptr, fastret bool, pmap_ref *int32) (int, int, uintptr, bool) {
 
 	// {enter,exit}syscall() may not be worth the overhead. i believe the
 	// only benefit for biscuit is that cpus running in the kernel could GC
@@ -628,22 +639,22 @@ func Userrun_slow(tf *[TFSIZE]uintptr, fxbuf *[FXREGS]uintptr,
 }
 
 type nmiprof_t struct {
-	buf		[]uintptr
-	bufidx		uint64
-	LVTmask		bool
-	evtsel		int
-	evtmin		uint
-	evtmax		uint
-	gctrl		int
-	backtracing	bool
-	percpu [MAXCPUS]struct {
-		scratch	[64]uintptr
-		tfx	[FXREGS]uintptr
-		_	[64]uint8
-	}
-}
-
-var _nmibuf [4096*10]uintptr
+	buf         []uintptr
+	bufidx      uint64
+	LVTmask     bool
+	evtsel      int
+	evtmin      uint
+	evtmax      uint
+	gctrl       int
+	backtracing bool
+	percpu      [MAXCPUS]struct {
+		scratch [64]uintptr
+		tfx     [FXREGS]uintptr
+		_       [64]uint8
+	}
+}
+
+var _nmibuf [4096 * 10]uintptr
 var nmiprof = nmiprof_t{buf: _nmibuf[:]}
 
 func SetNMI(mask bool, evtsel int, min, max uint, backtrace bool) {
@@ -685,7 +696,7 @@ func dumrand(low, high uint) uint {
 	if ra == 0 {
 		return low
 	}
-	_seed = _seed * 1103515245 + 12345
+	_seed = _seed*1103515245 + 12345
 	ret := _seed & 0x7fffffffffffffff
 	return low + (ret % ra)
 }
@@ -705,20 +716,20 @@ func _consumelbr() {
 	for i := 0; i < lbrlen; i++ {
 		from := uintptr(Rdmsr(lastbranch_0_from_ip + i))
 		mispred := uintptr(1 << 63)
-		if from & mispred != 0 {
+		if from&mispred != 0 {
 			l++
 		}
 	}
-	if int(nmiprof.bufidx) + l >= len(nmiprof.buf) {
+	if int(nmiprof.bufidx)+l >= len(nmiprof.buf) {
 		return
 	}
 	idx := int(atomic.Xadd64(&nmiprof.bufidx, int64(l)))
 	idx -= l
 	for i := 0; i < 16; i++ {
 		from := uintptr(Rdmsr(lastbranch_0_from_ip + i))
-		Wrmsr(lastbranch_0_from_ip + i, 0)
+		Wrmsr(lastbranch_0_from_ip+i, 0)
 		mispred := uintptr(1 << 63)
-		if from & mispred == 0 {
+		if from&mispred == 0 {
 			continue
 		}
 		if idx >= len(nmiprof.buf) {
@@ -750,7 +761,7 @@ func _lbrreset(en bool) {
 	noreljmp := 1 << 7
 	nofarbr := 1 << 8
 	dv := nocplgt0 | norelcall | noindcall | nonearret | noindjmp |
-	    noreljmp | nofarbr
+		noreljmp | nofarbr
 	Wrmsr(lbr_select, dv)
 
 	freeze_lbrs_on_pmi := 1 << 11
@@ -762,9 +773,9 @@ func _lbrreset(en bool) {
 func backtracetramp(uintptr, *[TFSIZE]uintptr, *g)
 
 var Lost struct {
-	Go uint
+	Go   uint
 	Full uint
-	Gs uint
+	Gs   uint
 	User uint
 }
 
@@ -787,7 +798,7 @@ func Bluh() {
 //go:nowritebarrierrec
 func _addone(rip uintptr) {
 	idx := atomic.Xadd64(&nmiprof.bufidx, 2) - 2
-	if idx + 2 < uint64(len(nmiprof.buf)) {
+	if idx+2 < uint64(len(nmiprof.buf)) {
 		cid := uintptr(NMI_Gscpu().num)
 		nmiprof.buf[idx] = 0xfeedfacefeed0000 | cid
 		nmiprof.buf[idx+1] = rip
@@ -798,6 +809,7 @@ func _addone(rip uintptr) {
 // and 0xfeedfacefeedface are sentinel values to indicate distinct backtraces.
 // 0xfeedfacefeedface and 0xdeadbeefdeadbeef indicate that a backtrace failed
 // (and thus only the RIP was recorded) or succeeded, respectively.
+//
 //go:nowritebarrierrec
 func nmibacktrace1(tf *[TFSIZE]uintptr, gp *g) {
 	pc := tf[TF_RIP]
@@ -813,7 +825,7 @@ func nmibacktrace1(tf *[TFSIZE]uintptr, gp *g) {
 	}
 
 	did := gentraceback(pc, sp, 0, gp, 0, &buf[0], len(buf), nil,
-	    nil, _TraceTrap|_TraceJumpStack)
+		nil, _TraceTrap|_TraceJumpStack)
 	buf = buf[:did]
 	need := uint64(len(buf) + 1)
 	last := atomic.Xadd64(&nmiprof.bufidx, int64(need))
@@ -846,8 +858,8 @@ func nmibacktrace(tf *[TFSIZE]uintptr) {
 	}
 
 	// XXX
-	if (tf[TF_CS] & 3) != 0 || tf[TF_RFLAGS] & TF_FL_IF == 0 ||
-	    cpu.mythread == nil {
+	if (tf[TF_CS]&3) != 0 || tf[TF_RFLAGS]&TF_FL_IF == 0 ||
+		cpu.mythread == nil {
 		_addone(tf[TF_RIP])
 		//Lost.User++
 		return
@@ -873,7 +885,7 @@ func nmibacktrace(tf *[TFSIZE]uintptr) {
 
 func checky() {
 	if hackmode != 0 {
-		if rflags() & TF_FL_IF == 0 {
+		if rflags()&TF_FL_IF == 0 {
 			pancake("must be interruptible", 0)
 		}
 	}
@@ -895,7 +907,7 @@ func perfgather(tf *[TFSIZE]uintptr) {
 //go:nosplit
 func perfmask() {
 	lapaddr := 0xfee00000
-	lap := (*[PGSIZE/4]uint32)(unsafe.Pointer(uintptr(lapaddr)))
+	lap := (*[PGSIZE / 4]uint32)(unsafe.Pointer(uintptr(lapaddr)))
 
 	perfmonc := 208
 	if nmiprof.LVTmask {
@@ -904,7 +916,7 @@ func perfmask() {
 		_pmcreset(false)
 	} else {
 		// unmask perf LVT, reset pmc
-		nmidelmode :=  uint32(0x4 << 8)
+		nmidelmode := uint32(0x4 << 8)
 		lap[perfmonc] = nmidelmode
 		_pmcreset(true)
 	}
@@ -949,23 +961,23 @@ func _pmcreset(en bool) {
 //go:nosplit
 func sc_setup() {
 	// disable interrupts
-	Outb(com1 + 1, 0)
+	Outb(com1+1, 0)
 
 	// set divisor latch bit to set divisor bytes
-	Outb(com1 + 3, 0x80)
+	Outb(com1+3, 0x80)
 
 	// set both bytes for divisor baud rate
-	Outb(com1 + 0, 115200/115200)
-	Outb(com1 + 1, 0)
+	Outb(com1+0, 115200/115200)
+	Outb(com1+1, 0)
 
 	// 8 bit words, one stop bit, no parity
-	Outb(com1 + 3, 0x03)
+	Outb(com1+3, 0x03)
 
 	// configure FIFO for interrupts: maximum FIFO size, clear
 	// transmit/receive FIFOs, and enable FIFOs.
-	Outb(com1 + 2, 0xc7)
-	Outb(com1 + 4, 0x0b)
-	Outb(com1 + 1, 1)
+	Outb(com1+2, 0xc7)
+	Outb(com1+4, 0x0b)
+	Outb(com1+1, 1)
 }
 
 const com1 = uint16(0x3f8)
@@ -973,7 +985,7 @@ const com1 = uint16(0x3f8)
 //go:nosplit
 func sc_put_(c int8) {
 	lstatus := uint16(5)
-	for Inb(com1 + lstatus) & 0x20 == 0 {
+	for Inb(com1+lstatus)&0x20 == 0 {
 	}
 	Outb(com1, uint8(c))
 }
@@ -1006,9 +1018,9 @@ func sc_put(c int8) {
 }
 
 type put_t struct {
-	vx		int
-	vy		int
-	fakewrap	bool
+	vx       int
+	vy       int
+	fakewrap bool
 }
 
 var put put_t
@@ -1025,7 +1037,7 @@ func vga_put(c int8, attr int8) {
 			c = ' '
 		}
 		v := a | int16(c)
-		p[put.vy * 80 + put.vx] = v
+		p[put.vy*80+put.vx] = v
 		if !backspace {
 			put.vx++
 		}
@@ -1052,7 +1064,7 @@ func vga_put(c int8, attr int8) {
 	}
 	if put.vx == 0 {
 		for i := 0; i < 79; i++ {
-			p[put.vy * 80 + put.vx + i] = 0
+			p[put.vy*80+put.vx+i] = 0
 		}
 	}
 }
@@ -1077,7 +1089,7 @@ func putcha(c int8, a int8) {
 
 //go:nosplit
 func cls() {
-	for i:= 0; i < 1974; i++ {
+	for i := 0; i < 1974; i++ {
 		vga_put(' ', 0x7)
 	}
 	sc_put('c')
@@ -1094,7 +1106,7 @@ var hackmode int64
 var Halt uint32
 
 type Spinlock_t struct {
-	v	uint32
+	v uint32
 }
 
 //go:nosplit
@@ -1121,7 +1133,7 @@ var pmsglock = &Spinlock_t{}
 
 //go:nosplit
 func _pmsg(msg string) {
-	putch(' ');
+	putch(' ')
 	// can't use range since it results in calls stringiter2 which has the
 	// stack splitting proglogue
 	for i := 0; i < len(msg); i++ {
@@ -1130,6 +1142,7 @@ func _pmsg(msg string) {
 }
 
 // msg must be utf-8 string
+//
 //go:nosplit
 func pmsg(msg string) {
 	fl := Pushcli()
@@ -1166,7 +1179,7 @@ func Pmsga(_p *uint8, c int, attr int8) {
 	fl := Pushcli()
 	Splock(pmsglock)
 	for i := uintptr(0); i < uintptr(c); i++ {
-		p := (*int8)(unsafe.Pointer(pn+i))
+		p := (*int8)(unsafe.Pointer(pn + i))
 		putcha(*p, attr)
 	}
 	Spunlock(pmsglock)
@@ -1179,7 +1192,7 @@ var _cpuattrs [MAXCPUS]uint16
 func Cpuprint(n uint16, row uintptr) {
 	p := uintptr(0xb8000)
 	num := Gscpu().num
-	p += (uintptr(num) + row*80)*2
+	p += (uintptr(num) + row*80) * 2
 	attr := _cpuattrs[num]
 	_cpuattrs[num] += 0x100
 	*(*uint16)(unsafe.Pointer(p)) = attr | n
@@ -1188,7 +1201,7 @@ func Cpuprint(n uint16, row uintptr) {
 //go:nosplit
 func cpupnum(rip uintptr) {
 	for i := uintptr(0); i < 16; i++ {
-		c := uint16((rip >> i*4) & 0xf)
+		c := uint16((rip >> i * 4) & 0xf)
 		if c < 0xa {
 			c += '0'
 		} else {
@@ -1218,7 +1231,7 @@ var gostr = []int8{'g', 'o', 0}
 //go:nosplit
 func chkalign(_p unsafe.Pointer, n uintptr) {
 	p := uintptr(_p)
-	if p & (n - 1) != 0 {
+	if p&(n-1) != 0 {
 		pancake("not aligned", p)
 	}
 }
@@ -1231,18 +1244,18 @@ func chksize(n uintptr, exp uintptr) {
 }
 
 type pdesc_t struct {
-	limit	uint16
+	limit   uint16
 	addrlow uint16
-	addrmid	uint32
-	addrhi	uint16
-	_res1	uint16
-	_res2	uint32
+	addrmid uint32
+	addrhi  uint16
+	_res1   uint16
+	_res2   uint32
 }
 
 type seg64_t struct {
-	lim	uint16
-	baselo	uint16
-	rest	uint32
+	lim    uint16
+	baselo uint16
+	rest   uint32
 }
 
 type tss_t struct {
@@ -1274,24 +1287,24 @@ type tss_t struct {
 
 	_res2 [2]uint32
 
-	_res3 uint16
+	_res3  uint16
 	iobmap uint16
 	_align uint64
 }
 
 const (
-	P 	uint32 = (1 << 15)
-	PS	uint32 = (P | (1 << 12))
-	G 	uint32 = (0 << 23)
-	D 	uint32 = (1 << 22)
-	L 	uint32 = (1 << 21)
-	CODE	uint32 = (0x0a << 8)
-	DATA	uint32 = (0x02 << 8)
-	TSS	uint32 = (0x09 << 8)
-	USER	uint32 = (0x60 << 8)
-	INT	uint16 = (0x0e << 8)
-
-	KCODE64		= 1
+	P    uint32 = (1 << 15)
+	PS   uint32 = (P | (1 << 12))
+	G    uint32 = (0 << 23)
+	D    uint32 = (1 << 22)
+	L    uint32 = (1 << 21)
+	CODE uint32 = (0x0a << 8)
+	DATA uint32 = (0x02 << 8)
+	TSS  uint32 = (0x09 << 8)
+	USER uint32 = (0x60 << 8)
+	INT  uint16 = (0x0e << 8)
+
+	KCODE64 = 1
 )
 
 var _segs = [7 + 2*MAXCPUS]seg64_t{
@@ -1321,7 +1334,7 @@ var _tss [MAXCPUS]tss_t
 //go:nosplit
 func tss_set(id uint, rsp, nmi uintptr) *tss_t {
 	sz := unsafe.Sizeof(_tss[id])
-	if sz != 104 + 8 {
+	if sz != 104+8 {
 		panic("bad tss_t")
 	}
 	p := &_tss[id]
@@ -1342,6 +1355,7 @@ func tss_set(id uint, rsp, nmi uintptr) *tss_t {
 }
 
 // maps cpu number to the per-cpu TSS segment descriptor in the GDT
+//
 //go:nosplit
 func segnum(cpunum uint) uint {
 	return 7 + 2*cpunum
@@ -1353,14 +1367,14 @@ func tss_seginit(cpunum uint, _tssaddr *tss_t, lim uintptr) {
 	seg.rest = P | TSS | G
 
 	seg.lim = uint16(lim)
-	seg.rest |= uint32((lim >> 16) & 0xf) << 16
+	seg.rest |= uint32((lim>>16)&0xf) << 16
 
 	base := uintptr(unsafe.Pointer(_tssaddr))
 	seg.baselo = uint16(base)
 	seg.rest |= uint32(uint8(base >> 16))
-	seg.rest |= uint32(uint8(base >> 24) << 24)
+	seg.rest |= uint32(uint8(base>>24) << 24)
 
-	seg = &_segs[segnum(cpunum) + 1]
+	seg = &_segs[segnum(cpunum)+1]
 	seg.lim = uint16(base >> 32)
 	seg.baselo = uint16(base >> 48)
 }
@@ -1371,13 +1385,13 @@ func tss_init(cpunum uint) uintptr {
 	nmistk := 0xa100003000 + uintptr(cpunum)*4*PGSIZE
 	// BSP maps AP's stack for them
 	if cpunum == 0 {
-		alloc_map(intstk - 1, PTE_W, true)
-		alloc_map(nmistk - 1, PTE_W, true)
+		alloc_map(intstk-1, PTE_W, true)
+		alloc_map(nmistk-1, PTE_W, true)
 	}
 	rsp := intstk
 	rspnmi := nmistk
 	tss := tss_set(cpunum, rsp, rspnmi)
-	tss_seginit(cpunum, tss, unsafe.Sizeof(tss_t{}) - 1)
+	tss_seginit(cpunum, tss, unsafe.Sizeof(tss_t{})-1)
 	segselect := segnum(cpunum) << 3
 	ltr(segselect)
 	cpus[cpunum].rsp = rsp
@@ -1404,12 +1418,13 @@ func hexdump(_p unsafe.Pointer, sz uintptr) {
 
 // must be nosplit since stack splitting prologue uses FS which this function
 // initializes.
+//
 //go:nosplit
 func seg_setup() {
 	p := pdesc_t{}
 	chksize(unsafe.Sizeof(p), 16)
 	chksize(unsafe.Sizeof(seg64_t{}), 8)
-	pdsetup(&p, unsafe.Pointer(&_segs[0]), unsafe.Sizeof(_segs) - 1)
+	pdsetup(&p, unsafe.Pointer(&_segs[0]), unsafe.Sizeof(_segs)-1)
 	lgdt(p)
 
 	// now that we have a GDT, setup tls for the first thread.
@@ -1487,15 +1502,16 @@ func Xmsi6()
 func Xmsi7()
 
 type idte_t struct {
-	baselow	uint16
-	segsel	uint16
-	details	uint16
-	basemid	uint16
-	basehi	uint32
-	_res	uint32
+	baselow uint16
+	segsel  uint16
+	details uint16
+	basemid uint16
+	basehi  uint32
+	_res    uint32
 }
 
 const idtsz uintptr = 128
+
 var _idt [idtsz]idte_t
 
 //go:nosplit
@@ -1509,7 +1525,7 @@ func int_set(idx int, intentry func(), istn int) {
 
 	p.segsel = uint16(KCODE64 << 3)
 
-	p.details = uint16(P) | INT | uint16(istn & 0x7)
+	p.details = uint16(P) | INT | uint16(istn&0x7)
 }
 
 //go:nosplit
@@ -1519,93 +1535,93 @@ func int_setup() {
 	chkalign(unsafe.Pointer(&_idt[0]), 8)
 
 	// cpu exceptions
-	int_set(0,   Xdz,  0)
-	int_set(1,   Xrz,  0)
-	int_set(2,   Xnmi, 2)
-	int_set(3,   Xbp,  0)
-	int_set(4,   Xov,  0)
-	int_set(5,   Xbnd, 0)
-	int_set(6,   Xuo,  0)
-	int_set(7,   Xnm,  0)
-	int_set(8,   Xdf,  1)
-	int_set(9,   Xrz2, 0)
-	int_set(10,  Xtss, 0)
-	int_set(11,  Xsnp, 0)
-	int_set(12,  Xssf, 0)
-	int_set(13,  Xgp,  1)
-	int_set(14,  Xpf,  1)
-	int_set(15,  Xrz3, 0)
-	int_set(16,  Xmf,  0)
-	int_set(17,  Xac,  0)
-	int_set(18,  Xmc,  0)
-	int_set(19,  Xfp,  0)
-	int_set(20,  Xve,  0)
+	int_set(0, Xdz, 0)
+	int_set(1, Xrz, 0)
+	int_set(2, Xnmi, 2)
+	int_set(3, Xbp, 0)
+	int_set(4, Xov, 0)
+	int_set(5, Xbnd, 0)
+	int_set(6, Xuo, 0)
+	int_set(7, Xnm, 0)
+	int_set(8, Xdf, 1)
+	int_set(9, Xrz2, 0)
+	int_set(10, Xtss, 0)
+	int_set(11, Xsnp, 0)
+	int_set(12, Xssf, 0)
+	int_set(13, Xgp, 1)
+	int_set(14, Xpf, 1)
+	int_set(15, Xrz3, 0)
+	int_set(16, Xmf, 0)
+	int_set(17, Xac, 0)
+	int_set(18, Xmc, 0)
+	int_set(19, Xfp, 0)
+	int_set(20, Xve, 0)
 
 	// IRQs
-	int_set(32,  Xtimer,  1)
-	int_set(33,  Xirq1,   1)
-	int_set(34,  Xirq2,   1)
-	int_set(35,  Xirq3,   1)
-	int_set(36,  Xirq4,   1)
-	int_set(37,  Xirq5,   1)
-	int_set(38,  Xirq6,   1)
-	int_set(39,  Xirq7,   1)
-	int_set(40,  Xirq8,   1)
-	int_set(41,  Xirq9,   1)
-	int_set(42,  Xirq10,  1)
-	int_set(43,  Xirq11,  1)
-	int_set(44,  Xirq12,  1)
-	int_set(45,  Xirq13,  1)
-	int_set(46,  Xirq14,  1)
-	int_set(47,  Xirq15,  1)
-	int_set(48,  Xirq16,  1)
-	int_set(49,  Xirq17,  1)
-	int_set(50,  Xirq18,  1)
-	int_set(51,  Xirq19,  1)
-	int_set(52,  Xirq20,  1)
-	int_set(53,  Xirq21,  1)
-	int_set(54,  Xirq22,  1)
-	int_set(55,  Xirq23,  1)
+	int_set(32, Xtimer, 1)
+	int_set(33, Xirq1, 1)
+	int_set(34, Xirq2, 1)
+	int_set(35, Xirq3, 1)
+	int_set(36, Xirq4, 1)
+	int_set(37, Xirq5, 1)
+	int_set(38, Xirq6, 1)
+	int_set(39, Xirq7, 1)
+	int_set(40, Xirq8, 1)
+	int_set(41, Xirq9, 1)
+	int_set(42, Xirq10, 1)
+	int_set(43, Xirq11, 1)
+	int_set(44, Xirq12, 1)
+	int_set(45, Xirq13, 1)
+	int_set(46, Xirq14, 1)
+	int_set(47, Xirq15, 1)
+	int_set(48, Xirq16, 1)
+	int_set(49, Xirq17, 1)
+	int_set(50, Xirq18, 1)
+	int_set(51, Xirq19, 1)
+	int_set(52, Xirq20, 1)
+	int_set(53, Xirq21, 1)
+	int_set(54, Xirq22, 1)
+	int_set(55, Xirq23, 1)
 
 	// MSI interrupts
-	int_set(56,  Xmsi0,  1)
-	int_set(57,  Xmsi1,  1)
-	int_set(58,  Xmsi2,  1)
-	int_set(59,  Xmsi3,  1)
-	int_set(60,  Xmsi4,  1)
-	int_set(61,  Xmsi5,  1)
-	int_set(62,  Xmsi6,  1)
-	int_set(63,  Xmsi7,  1)
+	int_set(56, Xmsi0, 1)
+	int_set(57, Xmsi1, 1)
+	int_set(58, Xmsi2, 1)
+	int_set(59, Xmsi3, 1)
+	int_set(60, Xmsi4, 1)
+	int_set(61, Xmsi5, 1)
+	int_set(62, Xmsi6, 1)
+	int_set(63, Xmsi7, 1)
 
-	int_set(64,  Xspur,    1)
+	int_set(64, Xspur, 1)
 
-	int_set(70,  Xtlbshoot, 1)
-	int_set(72,  Xperfmask, 1)
+	int_set(70, Xtlbshoot, 1)
+	int_set(72, Xperfmask, 1)
 
 	p := pdesc_t{}
-	pdsetup(&p, unsafe.Pointer(&_idt[0]), unsafe.Sizeof(_idt) - 1)
+	pdsetup(&p, unsafe.Pointer(&_idt[0]), unsafe.Sizeof(_idt)-1)
 	lidt(p)
 }
 
 const (
-	PTE_P		uintptr = 1 << 0
-	PTE_W		uintptr = 1 << 1
-	PTE_U		uintptr = 1 << 2
-	PTE_PS		uintptr = 1 << 7
-	PTE_G		uintptr = 1 << 8
-	PTE_PCD		uintptr = 1 << 4
-	PGSIZE		uintptr = 1 << 12
-	PGOFFMASK	uintptr = PGSIZE - 1
-	PGMASK		uintptr = ^PGOFFMASK
+	PTE_P     uintptr = 1 << 0
+	PTE_W     uintptr = 1 << 1
+	PTE_U     uintptr = 1 << 2
+	PTE_PS    uintptr = 1 << 7
+	PTE_G     uintptr = 1 << 8
+	PTE_PCD   uintptr = 1 << 4
+	PGSIZE    uintptr = 1 << 12
+	PGOFFMASK uintptr = PGSIZE - 1
+	PGMASK    uintptr = ^PGOFFMASK
 
 	// special pml4 slots, agreed upon with the bootloader (which creates
 	// our pmap).
 	// highest runtime heap mapping
-	VUEND		uintptr = 0x42
+	VUEND uintptr = 0x42
 	// recursive mapping
-	VREC		uintptr = 0x42
+	VREC uintptr = 0x42
 	// available mapping
-	VTEMP		uintptr = 0x43
+	VTEMP uintptr = 0x43
 )
 
 // physical address of kernel's pmap, given to us by bootloader
@@ -1638,13 +1654,14 @@ func pgrounddown(va uintptr) uintptr {
 
 //go:nosplit
 func caddr(l4 uintptr, ppd uintptr, pd uintptr, pt uintptr,
-    off uintptr) uintptr {
-	ret := l4 << 39 | ppd << 30 | pd << 21 | pt << 12
-	ret += off*8
+	off uintptr) uintptr {
+	ret := l4<<39 | ppd<<30 | pd<<21 | pt<<12
+	ret += off * 8
 	return uintptr(ret)
 }
 
 // XXX get rid of create
+//
 //go:nosplit
 func pgdir_walk(_va uintptr, create bool) *uintptr {
 	v := pgrounddown(_va)
@@ -1662,20 +1679,20 @@ func pgdir_walk(_va uintptr, create bool) *uintptr {
 //go:nosplit
 func pgdir_walk1(slot, van uintptr, create bool) *uintptr {
 	ns := slotnext(slot)
-	ns += pml4x(van)*8
+	ns += pml4x(van) * 8
 	if pml4x(ns) != VREC {
 		return (*uintptr)(unsafe.Pointer(slot))
 	}
 	sp := (*uintptr)(unsafe.Pointer(slot))
-	if *sp & PTE_P == 0 {
-		if !create{
+	if *sp&PTE_P == 0 {
+		if !create {
 			return nil
 		}
 		p_pg := get_pg()
 		zero_phys(p_pg)
 		*sp = p_pg | PTE_P | PTE_W
 	}
-	if *sp & PTE_PS != 0 {
+	if *sp&PTE_PS != 0 {
 		pancake("map in PS", *sp)
 	}
 	return pgdir_walk1(ns, slotnext(van), create)
@@ -1685,7 +1702,7 @@ func pgdir_walk1(slot, van uintptr, create bool) *uintptr {
 func zero_phys(_phys uintptr) {
 	rec := caddr(VREC, VREC, VREC, VREC, VTEMP)
 	pml4 := (*uintptr)(unsafe.Pointer(rec))
-	if *pml4 & PTE_P != 0 {
+	if *pml4&PTE_P != 0 {
 		pancake("vtemp in use", *pml4)
 	}
 	phys := pgrounddown(_phys)
@@ -1708,22 +1725,22 @@ func zero_phys(_phys uintptr) {
 // memory management code in the kernel and not the bootloader.
 
 type e820_t struct {
-	start	uintptr
-	len	uintptr
+	start uintptr
+	len   uintptr
 }
 
 // "secret structure". created by bootloader for passing info to the kernel.
 type secret_t struct {
-	e820p	uintptr
-	pmap	uintptr
-	freepg	uintptr
+	e820p  uintptr
+	pmap   uintptr
+	freepg uintptr
 }
 
 // regions of memory not included in the e820 map, into which we cannot
 // allocate
 type badregion_t struct {
-	start	uintptr
-	end	uintptr
+	start uintptr
+	end   uintptr
 }
 
 var badregs = []badregion_t{
@@ -1781,7 +1798,7 @@ func phys_init() {
 	if !found {
 		pancake("e820 problems", pgfirst)
 	}
-	if pgfirst & PGOFFMASK != 0 {
+	if pgfirst&PGOFFMASK != 0 {
 		pancake("pgfist not aligned", pgfirst)
 	}
 }
@@ -1803,12 +1820,12 @@ func Tcount() (int, int) {
 	r := 0
 	nr := 0
 	for i := range threads {
-		switch (threads[i].status) {
+		switch threads[i].status {
 		case ST_RUNNING, ST_RUNNABLE:
 			r++
 		case ST_INVALID:
 		default:
-			nr++;
+			nr++
 		}
 	}
 
@@ -1841,14 +1858,14 @@ func FuncPC(f interface{}) uintptr {
 func alloc_map(va uintptr, perms uintptr, fempty bool) {
 	pte := pgdir_walk(va, true)
 	old := *pte
-	if old & PTE_P != 0 && fempty {
+	if old&PTE_P != 0 && fempty {
 		pancake("expected empty pte", old)
 	}
 	p_pg := get_pg()
 	zero_phys(p_pg)
 	// XXX goodbye, memory
 	*pte = p_pg | perms | PTE_P | PTE_G
-	if old & PTE_P != 0 {
+	if old&PTE_P != 0 {
 		invlpg(va)
 	}
 }
@@ -1856,6 +1873,7 @@ func alloc_map(va uintptr, perms uintptr, fempty bool) {
 var Fxinit [FXREGS]uintptr
 
 // nosplit because APs call this function before FS is setup
+//
 //go:nosplit
 //go:nowritebarrierrec
 func fpuinit(amfirst bool) {
@@ -1865,12 +1883,12 @@ func fpuinit(amfirst bool) {
 	cr0 &^= (1 << 2)
 	// set MP
 	cr0 |= 1 << 1
-	Lcr0(cr0);
+	Lcr0(cr0)
 
 	cr4 := Rcr4()
 	// set OSFXSR
 	cr4 |= 1 << 9
-	Lcr4(cr4);
+	Lcr4(cr4)
 
 	if amfirst {
 		chkalign(unsafe.Pointer(&Fxinit[0]), 16)
@@ -1893,20 +1911,20 @@ func fpuinit0() {
 
 // LAPIC registers
 const (
-	LAPID		= 0x20/4
-	LAPEOI		= 0xb0/4
-	LAPVER		= 0x30/4
-	LAPDCNT		= 0x3e0/4
-	LAPICNT		= 0x380/4
-	LAPCCNT		= 0x390/4
-	LVSPUR		= 0xf0/4
-	LVTIMER		= 0x320/4
-	LVCMCI		= 0x2f0/4
-	LVINT0		= 0x350/4
-	LVINT1		= 0x360/4
-	LVERROR		= 0x370/4
-	LVPERF		= 0x340/4
-	LVTHERMAL	= 0x330/4
+	LAPID     = 0x20 / 4
+	LAPEOI    = 0xb0 / 4
+	LAPVER    = 0x30 / 4
+	LAPDCNT   = 0x3e0 / 4
+	LAPICNT   = 0x380 / 4
+	LAPCCNT   = 0x390 / 4
+	LVSPUR    = 0xf0 / 4
+	LVTIMER   = 0x320 / 4
+	LVCMCI    = 0x2f0 / 4
+	LVINT0    = 0x350 / 4
+	LVINT1    = 0x360 / 4
+	LVERROR   = 0x370 / 4
+	LVPERF    = 0x340 / 4
+	LVTHERMAL = 0x330 / 4
 )
 
 var _lapaddr uintptr
@@ -1916,7 +1934,7 @@ func rlap(reg uint) uint32 {
 	if _lapaddr == 0 {
 		pancake("lapic not init", 0)
 	}
-	lpg := (*[PGSIZE/4]uint32)(unsafe.Pointer(_lapaddr))
+	lpg := (*[PGSIZE / 4]uint32)(unsafe.Pointer(_lapaddr))
 	return atomic.Load(&lpg[reg])
 }
 
@@ -1925,19 +1943,19 @@ func wlap(reg uint, val uint32) {
 	if _lapaddr == 0 {
 		pancake("lapic not init", 0)
 	}
-	lpg := (*[PGSIZE/4]uint32)(unsafe.Pointer(_lapaddr))
+	lpg := (*[PGSIZE / 4]uint32)(unsafe.Pointer(_lapaddr))
 	lpg[reg] = val
 }
 
 //go:nosplit
 func lap_id() uint32 {
-	if rflags() & TF_FL_IF != 0 {
+	if rflags()&TF_FL_IF != 0 {
 		pancake("interrupts must be cleared", 0)
 	}
 	if _lapaddr == 0 {
 		pancake("lapic not init", 0)
 	}
-	lpg := (*[PGSIZE/4]uint32)(unsafe.Pointer(_lapaddr))
+	lpg := (*[PGSIZE / 4]uint32)(unsafe.Pointer(_lapaddr))
 	return lpg[LAPID] >> 24
 }
 
@@ -1951,11 +1969,11 @@ func lap_eoi() {
 
 // PIT registers
 const (
-	CNT0	uint16 = 0x40
-	CNTCTL	uint16 = 0x43
-	_pitfreq	= 1193182
-	_pithz		= 100
-	PITDIV		= _pitfreq/_pithz
+	CNT0     uint16 = 0x40
+	CNTCTL   uint16 = 0x43
+	_pitfreq        = 1193182
+	_pithz          = 100
+	PITDIV          = _pitfreq / _pithz
 )
 
 //go:nosplit
@@ -1965,7 +1983,7 @@ func pit_ticks() uint {
 	Outb(CNTCTL, cmd)
 	low := Inb(CNT0)
 	hi := Inb(CNT0)
-	return hi << 8 | low
+	return hi<<8 | low
 }
 
 //go:nosplit
@@ -1974,18 +1992,19 @@ func pit_enable() {
 	// PIT uses div/2 for the countdown since div is taken to be the period
 	// of the wave)
 	Outb(CNTCTL, 0x34)
-	Outb(CNT0, uint8(PITDIV & 0xff))
-	Outb(CNT0, uint8(PITDIV >> 8))
+	Outb(CNT0, uint8(PITDIV&0xff))
+	Outb(CNT0, uint8(PITDIV>>8))
 }
 
 func pit_disable() {
 	// disable PIT: one-shot, lsb then msb
-	Outb(CNTCTL, 0x32);
-	Outb(CNT0, uint8(PITDIV & 0xff))
-	Outb(CNT0, uint8(PITDIV >> 8))
+	Outb(CNTCTL, 0x32)
+	Outb(CNT0, uint8(PITDIV&0xff))
+	Outb(CNT0, uint8(PITDIV>>8))
 }
 
 // wait until 8254 resets the counter
+//
 //go:nosplit
 //go:nowritebarrierrec
 func pit_phasewait() {
@@ -2010,7 +2029,7 @@ func lapic_setup(calibrate bool) {
 	if calibrate {
 		// map lapic IO mem
 		pte := pgdir_walk(la, false)
-		if pte != nil && *pte & PTE_P != 0 {
+		if pte != nil && *pte&PTE_P != 0 {
 			pancake("lapic mem already mapped", 0)
 		}
 	}
@@ -2026,11 +2045,11 @@ func lapic_setup(calibrate bool) {
 
 	// enable lapic, set spurious int vector
 	apicenable := 1 << 8
-	wlap(LVSPUR, uint32(apicenable | TRAP_SPUR))
+	wlap(LVSPUR, uint32(apicenable|TRAP_SPUR))
 
 	// timer: periodic, int 32
 	periodic := 1 << 17
-	wlap(LVTIMER, uint32(periodic | TRAP_TIMER))
+	wlap(LVTIMER, uint32(periodic|TRAP_TIMER))
 	// divide by 1
 	divone := uint32(0xb)
 	wlap(LAPDCNT, divone)
@@ -2056,18 +2075,18 @@ func lapic_setup(calibrate bool) {
 		if lapend > lapstart {
 			pancake("lapic timer wrapped?", uintptr(lapend))
 		}
-		lapelapsed := (lapstart - lapend)*uint32(frac)
-		cycelapsed := (Rdtsc() - cycstart)*uint64(frac)
+		lapelapsed := (lapstart - lapend) * uint32(frac)
+		cycelapsed := (Rdtsc() - cycstart) * uint64(frac)
 		pmsg("LAPIC Mhz:")
-		pnum(uintptr(lapelapsed/(1000 * 1000)))
+		pnum(uintptr(lapelapsed / (1000 * 1000)))
 		pmsg("\n")
 		_lapic_quantum = lapelapsed / HZ
 
 		pmsg("CPU Mhz:")
-		Cpumhz = uint(cycelapsed/(1000 * 1000))
+		Cpumhz = uint(cycelapsed / (1000 * 1000))
 		pnum(uintptr(Cpumhz))
 		pmsg("\n")
-		Pspercycle = uint(1000000000000/cycelapsed)
+		Pspercycle = uint(1000000000000 / cycelapsed)
 
 		pit_disable()
 	}
@@ -2078,31 +2097,31 @@ func lapic_setup(calibrate bool) {
 
 	maskint := uint32(1 << 16)
 	// mask cmci, lint[01], error, perf counters, and thermal sensor
-	wlap(LVCMCI,    maskint)
+	wlap(LVCMCI, maskint)
 	// unmask LINT0 and LINT1
-	wlap(LVINT0,    rlap(LVINT0) &^ maskint)
-	wlap(LVINT1,    rlap(LVINT1) &^ maskint)
-	wlap(LVERROR,   maskint)
-	wlap(LVPERF,    maskint)
+	wlap(LVINT0, rlap(LVINT0)&^maskint)
+	wlap(LVINT1, rlap(LVINT1)&^maskint)
+	wlap(LVERROR, maskint)
+	wlap(LVPERF, maskint)
 	wlap(LVTHERMAL, maskint)
 
 	ia32_apic_base := 0x1b
 	reg := uintptr(Rdmsr(ia32_apic_base))
-	if reg & (1 << 11) == 0 {
+	if reg&(1<<11) == 0 {
 		pancake("lapic disabled?", reg)
 	}
 	if (reg >> 12) != 0xfee00 {
-		pancake("weird base addr?", reg >> 12)
+		pancake("weird base addr?", reg>>12)
 	}
 
 	lreg := rlap(LVSPUR)
-	if lreg & (1 << 12) != 0 {
+	if lreg&(1<<12) != 0 {
 		pmsg("EOI broadcast surpression\n")
 	}
-	if lreg & (1 << 9) != 0 {
+	if lreg&(1<<9) != 0 {
 		pmsg("focus processor checking\n")
 	}
-	if lreg & (1 << 8) == 0 {
+	if lreg&(1<<8) == 0 {
 		pmsg("apic disabled\n")
 	}
 }
@@ -2128,11 +2147,12 @@ func proc_setup() {
 	// otherwise an RTC timer interrupt (that turns into a double-fault
 	// since the PIC has not been programmed yet) comes in immediately
 	// after sti.
-	Outb(0x20 + 1, 0xff)
-	Outb(0xa0 + 1, 0xff)
+	Outb(0x20+1, 0xff)
+	Outb(0xa0+1, 0xff)
 
 	myrsp := tss_init(0)
 	sysc_setup(myrsp)
+	nxe_setup()
 	gs_set(&cpus[0])
 	cpus[0].apicid = lap_id()
 	Gscpu().num = 0
@@ -2163,6 +2183,7 @@ func Ap_setup(cpunum uint) {
 	lapic_setup(false)
 	myrsp := tss_init(cpunum)
 	sysc_setup(myrsp)
+	nxe_setup()
 	mycpu := &cpus[cpunum]
 	if mycpu.num != 0 {
 		pancake("cpu id conflict", uintptr(mycpu.num))
@@ -2190,7 +2211,7 @@ func Ap_setup(cpunum uint) {
 //go:nosplit
 func sysc_setup(myrsp uintptr) {
 	// lowest 2 bits are ignored for sysenter, but used for sysexit
-	kcode64 := 1 << 3 | 3
+	kcode64 := 1<<3 | 3
 	sysenter_cs := 0x174
 	Wrmsr(sysenter_cs, kcode64)
 
@@ -2203,6 +2224,24 @@ func sysc_setup(myrsp uintptr) {
 	Wrmsr(sysenter_esp, 0)
 }
 
+// true if the CPUs honor the execute-disable bit (bit 63) of page map entries
+var Nxe bool
+
+//go:nosplit
+func nxe_setup() {
+	maxext, _, _, _ := Cpuid(0x80000000, 0)
+	if maxext < 0x80000001 {
+		return
+	}
+	_, _, _, edx := Cpuid(0x80000001, 0)
+	if edx&(1<<20) == 0 {
+		return
+	}
+	efer := 0xc0000080
+	Wrmsr(efer, Rdmsr(efer)|1<<11)
+	Nxe = true
+}
+
 //go:nowritebarrierrec
 func Condflush(_refp *int32, p_pmap, va uintptr, pgcount int) bool {
 	var refp *uint32
@@ -2241,11 +2280,12 @@ func TLBflush() {
 }
 
 var Tlbshoot struct {
-	Waitfor	int64
-	P_pmap	uintptr
+	Waitfor int64
+	P_pmap  uintptr
 }
 
 // must be nosplit since called at interrupt time
+//
 //go:nosplit
 //go:nowritebarrierrec
 func tlb_shootdown() {
@@ -2268,36 +2308,37 @@ func tlb_shootdown() {
 
 // cpu exception/interrupt vectors
 const (
-	TRAP_NMI	= 2
-	TRAP_PGFAULT	= 14
-	TRAP_SYSCALL	= 64
-	TRAP_TIMER	= 32
-	TRAP_DISK	= (32 + 14)
-	TRAP_SPUR	= 64
-	TRAP_TLBSHOOT	= 70
-	TRAP_SIGRET	= 71
-	TRAP_PERFMASK	= 72
-	TRAP_YIELD	= 73
+	TRAP_NMI      = 2
+	TRAP_PGFAULT  = 14
+	TRAP_SYSCALL  = 64
+	TRAP_TIMER    = 32
+	TRAP_DISK     = (32 + 14)
+	TRAP_SPUR     = 64
+	TRAP_TLBSHOOT = 70
+	TRAP_SIGRET   = 71
+	TRAP_PERFMASK = 72
+	TRAP_YIELD    = 73
 )
 
 var threadlock = &Spinlock_t{}
 
 // maximum # of runtime "OS" threads
 const maxthreads = 64
+
 var threads [maxthreads]thread_t
 
 // thread states
 const (
-	ST_INVALID	= 0
-	ST_RUNNABLE	= 1
-	ST_RUNNING	= 2
-	ST_SLEEPING	= 4
-	ST_WILLSLEEP	= 5
+	ST_INVALID   = 0
+	ST_RUNNABLE  = 1
+	ST_RUNNING   = 2
+	ST_SLEEPING  = 4
+	ST_WILLSLEEP = 5
 )
 
 // scheduler constants
 const (
-	HZ	= 1000
+	HZ = 1000
 )
 
 var _userintaddr uintptr
@@ -2314,12 +2355,12 @@ func Install_traphandler(newtrap func(*[TFSIZE]uintptr)) {
 func stack_dump(rsp uintptr) {
 	pte := pgdir_walk(rsp, false)
 	_pmsg("STACK DUMP\n")
-	if pte != nil && *pte & PTE_P != 0 {
+	if pte != nil && *pte&PTE_P != 0 {
 		pc := 0
 		p := rsp
 		for i := 0; i < 70; i++ {
 			pte = pgdir_walk(p, false)
-			if pte != nil && *pte & PTE_P != 0 {
+			if pte != nil && *pte&PTE_P != 0 {
 				n := *(*uintptr)(unsafe.Pointer(p))
 				p += 8
 				_pnum(n)
@@ -2359,6 +2400,7 @@ func kernel_fault(tf *[TFSIZE]uintptr) {
 // XXX
 // may want to only ·wakeup() on most timer ints since now there is more
 // overhead for timer ints during user time.
+//
 //go:nosplit
 //go:nowritebarrierrec
 func trap(tf *[TFSIZE]uintptr) {
@@ -2390,13 +2432,13 @@ func trap(tf *[TFSIZE]uintptr) {
 	cpu := Gscpu()
 
 	// CPU exceptions in kernel mode are fatal errors
-	if trapno < TRAP_TIMER && (tf[TF_CS] & 3) == 0 {
+	if trapno < TRAP_TIMER && (tf[TF_CS]&3) == 0 {
 		kernel_fault(tf)
 	}
 
 	ct := cpu.mythread
 
-	if rflags() & TF_FL_IF != 0 {
+	if rflags()&TF_FL_IF != 0 {
 		pancake("ints enabled in trap", 0)
 	}
 
@@ -2415,7 +2457,7 @@ func trap(tf *[TFSIZE]uintptr) {
 		// if in user mode, save to user buffers and make it look like
 		// Userrun returned. did the interrupt occur while in user
 		// mode?
-		if tf[TF_CS] & 3 != 0 {
+		if tf[TF_CS]&3 != 0 {
 			ufx := cpu.fxbuf
 			fxsave(ufx)
 			utf := cpu.tf
@@ -2503,7 +2545,7 @@ func is_cpuex(trapno uintptr) bool {
 //go:nosplit
 //go:nowritebarrierrec
 func _tchk() {
-	if rflags() & TF_FL_IF != 0 {
+	if rflags()&TF_FL_IF != 0 {
 		pancake("must not be interruptible", 0)
 	}
 	if threadlock.v == 0 {
@@ -2514,7 +2556,7 @@ func _tchk() {
 //go:nosplit
 //go:nowritebarrierrec
 func sched_halt() {
-	if rflags() & TF_FL_IF != 0 {
+	if rflags()&TF_FL_IF != 0 {
 		pancake("must not be interruptible", 0)
 	}
 	// busy loop waiting for runnable thread without the threadlock
@@ -2544,7 +2586,7 @@ func sched_halt() {
 //go:nowritebarrierrec
 //go:nosplit
 func sched_run(t *thread_t) {
-	if t.tf[TF_RFLAGS] & TF_FL_IF == 0 {
+	if t.tf[TF_RFLAGS]&TF_FL_IF == 0 {
 		pancake("thread not interurptible", 0)
 	}
 	// mythread never references a heap allocated object. avoid
@@ -2608,8 +2650,8 @@ func _yieldy() {
 	var start int
 	if ct != nil {
 		_ti := (uintptr(unsafe.Pointer(ct)) -
-		    uintptr(unsafe.Pointer(&threads[0])))/
-		    unsafe.Sizeof(thread_t{})
+			uintptr(unsafe.Pointer(&threads[0]))) /
+			unsafe.Sizeof(thread_t{})
 		ti := int(_ti)
 		start = (ti + 1) % maxthreads
 	} else {
@@ -2625,22 +2667,22 @@ func _yieldy() {
 		}
 	}
 	*(*uintptr)(unsafe.Pointer(&cpu.mythread)) =
-	    uintptr(unsafe.Pointer(nil))
+		uintptr(unsafe.Pointer(nil))
 	Spunlock(threadlock)
 }
 
 var _irqv struct {
 	// slock protects everything in _irqv
-	slock		Spinlock_t
-	handlers	[64]struct {
-		igp	*g
-		started	bool
+	slock    Spinlock_t
+	handlers [64]struct {
+		igp     *g
+		started bool
 	}
 	// flag indicating whether a thread in schedule() should check for
 	// runnable IRQ-handling goroutines
-	check		bool
+	check bool
 	// bitmask of IRQs that have requested service
-	irqs		uintptr
+	irqs uintptr
 }
 
 // IRQsched yields iff there have been no new IRQs since the last time the
@@ -2669,14 +2711,14 @@ func irqsched_m(gp *g) {
 	Splock(&_irqv.slock)
 
 	status := readgstatus(gp)
-	if((status&^_Gscan) != _Grunning){
+	if (status &^ _Gscan) != _Grunning {
 		pancake("bad g status", uintptr(status))
 	}
 
 	var nstatus uint32
 	var start bool
 	bit := uintptr(1 << irq)
-	sleeping := _irqv.irqs & bit == 0
+	sleeping := _irqv.irqs&bit == 0
 	if sleeping {
 		nstatus = _Gwaiting
 		if _irqv.handlers[irq].igp != nil {
@@ -2711,6 +2753,7 @@ func irqsched_m(gp *g) {
 
 // called from the CPU interrupt handler. must only be called while interrupts
 // are disabled
+//
 //go:nosplit
 func IRQwake(irq uint) {
 	if irq > 63 {
@@ -2749,7 +2792,7 @@ func IRQcheck(pp *p) {
 	// wakeup the goroutine for each received IRQ
 	for i := 0; i < 64; i++ {
 		ibit := uintptr(1 << uint(i))
-		if irqs & ibit != 0 {
+		if irqs&ibit != 0 {
 			gp := _irqv.handlers[i].igp
 			// the IRQ-handling goroutine has not yet called
 			// IRQsched; keep trying until it does.
@@ -2758,7 +2801,7 @@ func IRQcheck(pp *p) {
 				continue
 			}
 			gst := readgstatus(gp)
-			if gst &^ _Gscan != _Gwaiting {
+			if gst&^_Gscan != _Gwaiting {
 				pancake("bad igp status", uintptr(gst))
 			}
 			setGNoWB(&_irqv.handlers[i].igp, nil)
@@ -2785,6 +2828,211 @@ out:
 	}
 }
 
+// the scheduling classes of user threads
+const (
+	SCHED_OTHER = 0
+	SCHED_FIFO  = 1
+)
+
+// like Linux's sched_rt_period_us and sched_rt_runtime_us, realtime threads
+// may use at most 95% of the ticks of a P per second so that they cannot
+// starve the kernel's goroutines.
+const (
+	rtperiod  = 1000000000
+	rtruntime = HZ * 95 / 100
+)
+
+// goroutines whose CPU affinity excludes the P which was about to run them,
+// queued for the lowest-numbered allowed P. only the owner may put to a P's
+// local run queue, thus each P moves its own queue there in affcheck().
+var _affq struct {
+	lock mutex
+	n    uint32
+	head [MAXCPUS]guintptr
+	tail [MAXCPUS]guintptr
+}
+
+// Setsched sets the scheduling class, priority and CPU affinity of the
+// calling goroutine. prio is the nice value for SCHED_OTHER and the realtime
+// priority for SCHED_FIFO. mask is the set of the Ps on which the goroutine
+// may run; 0 allows all Ps. the goroutine migrates now if the current P is
+// not in mask.
+func Setsched(class, prio int, mask uint64) {
+	gp := getg()
+	gp.sclass = int32(class)
+	gp.sprio = int32(prio)
+	gp.sticks = 0
+	gp.smask = mask
+	mp := acquirem()
+	ok := schedallowed(gp, mp.p.ptr())
+	releasem(mp)
+	if !ok {
+		Gosched()
+	}
+}
+
+// Schedtick is called by a user thread after a timer interrupt and yields
+// once the thread's time slice is used up. the slice of a SCHED_OTHER thread
+// is one tick plus one per five points of negative nice, and a thread with
+// positive nice yields once more per five points while other goroutines wait
+// to run. a SCHED_OTHER thread also yields as soon as a realtime thread waits
+// on its P. like on Linux, a SCHED_FIFO thread runs until it blocks or
+// yields; the other Ps steal the work queued behind it. once the realtime
+// threads of a P exhaust their budget, they yield on every tick until the
+// period ends.
+func Schedtick() {
+	gp := getg()
+	if gp.sclass == SCHED_FIFO {
+		if rtthrottled() {
+			Gosched()
+		}
+		return
+	}
+	gp.sticks++
+	slice := int32(1)
+	if gp.sprio < 0 {
+		slice += -gp.sprio / 5
+	}
+	if gp.sticks < slice && !rtwaiting() {
+		return
+	}
+	gp.sticks = 0
+	Gosched()
+	for i := int32(0); i < gp.sprio/5 && schedpending(); i++ {
+		Gosched()
+	}
+}
+
+// charges a tick to the realtime budget of the calling goroutine's P and
+// returns true if the budget of the current period is used up
+func rtthrottled() bool {
+	mp := acquirem()
+	pp := mp.p.ptr()
+	now := hack_nanotime()
+	if now-pp.rtstart >= rtperiod {
+		pp.rtstart = now
+		pp.rtused = 0
+	}
+	pp.rtused++
+	ret := pp.rtused > rtruntime
+	releasem(mp)
+	return ret
+}
+
+// returns true if the next goroutine of the calling goroutine's P is a
+// realtime thread
+func rtwaiting() bool {
+	mp := acquirem()
+	n := mp.p.ptr().runnext.ptr()
+	ret := n != nil && n.sclass == SCHED_FIFO
+	releasem(mp)
+	return ret
+}
+
+// returns true if goroutines wait to run on the calling goroutine's P or on
+// the global run queue
+func schedpending() bool {
+	mp := acquirem()
+	ret := sched.runqsize != 0 || !runqempty(mp.p.ptr())
+	releasem(mp)
+	return ret
+}
+
+// returns whether runqput() should put gp in pp's runnext slot. a realtime
+// thread runs before the other goroutines of pp, and only a realtime thread
+// of higher priority may displace it from runnext. executed only by the
+// owner P.
+func schednext(pp *p, gp *g, next bool) bool {
+	n := pp.runnext.ptr()
+	if n != nil && n.sclass == SCHED_FIFO &&
+		(gp.sclass != SCHED_FIFO || gp.sprio <= n.sprio) {
+		return false
+	}
+	return next || gp.sclass == SCHED_FIFO
+}
+
+func schedallowed(gp *g, pp *p) bool {
+	return gp.smask == 0 || gp.smask&(1<<uint(pp.id)) != 0
+}
+
+// returns true if gp may run on pp. otherwise, gp is queued for the first P
+// in its CPU affinity mask. gp's status must be _Grunnable.
+func schedok(gp *g, pp *p) bool {
+	if schedallowed(gp, pp) {
+		return true
+	}
+	id := int32(-1)
+	for i := int32(0); i < gomaxprocs; i++ {
+		if gp.smask&(1<<uint(i)) != 0 {
+			id = i
+			break
+		}
+	}
+	// the mask names no P; run anywhere
+	if id == -1 {
+		return true
+	}
+	lock(&_affq.lock)
+	gp.schedlink = 0
+	if t := _affq.tail[id]; t != 0 {
+		t.ptr().schedlink.set(gp)
+	} else {
+		_affq.head[id].set(gp)
+	}
+	_affq.tail[id].set(gp)
+	atomic.Xadd(&_affq.n, 1)
+	unlock(&_affq.lock)
+	affwake(id)
+	return false
+}
+
+// starts an M for the P id if the P is idle so that it runs the goroutines
+// queued for it. a busy P takes them the next time it schedules.
+func affwake(id int32) {
+	lock(&sched.lock)
+	var prev *p
+	pp := sched.pidle.ptr()
+	for pp != nil && pp.id != id {
+		prev = pp
+		pp = pp.link.ptr()
+	}
+	if pp == nil {
+		unlock(&sched.lock)
+		return
+	}
+	if prev == nil {
+		sched.pidle = pp.link
+	} else {
+		prev.link = pp.link
+	}
+	atomic.Xadd(&sched.npidle, -1)
+	unlock(&sched.lock)
+	startm(pp, false)
+}
+
+// moves the goroutines queued for pp by schedok() to pp's local run queue.
+// executed only by the owner P.
+func affcheck(pp *p) {
+	if atomic.Load(&_affq.n) == 0 {
+		return
+	}
+	lock(&_affq.lock)
+	gp := _affq.head[pp.id].ptr()
+	_affq.head[pp.id] = 0
+	_affq.tail[pp.id] = 0
+	for n := gp; n != nil; n = n.schedlink.ptr() {
+		atomic.Xadd(&_affq.n, -1)
+	}
+	unlock(&_affq.lock)
+
+	// runqput() may take the scheduler lock
+	for gp != nil {
+		next := gp.schedlink.ptr()
+		runqput(pp, gp, false)
+		gp = next
+	}
+}
+
 // goprofiling is implemented by simulating the SIGPROF signal. when proftick
 // observes that enough time has elapsed, mksig() is used to deliver SIGPROF to
 // the runtime and things are setup so the runtime returns to sigsim().
@@ -2805,7 +3053,7 @@ func proftick() {
 	profns := 10000000
 	n := hack_nanotime()
 
-	if n - _lastprof < profns {
+	if n-_lastprof < profns {
 		return
 	}
 	_lastprof = n
@@ -2830,44 +3078,44 @@ func proftick() {
 // these are defined by linux since we lie to the go build system that we are
 // running on linux...
 type ucontext_t struct {
-	uc_flags	uintptr
-	uc_link		uintptr
+	uc_flags uintptr
+	uc_link  uintptr
 	uc_stack struct {
-		sp	uintptr
-		flags	int32
-		size	uint64
+		sp    uintptr
+		flags int32
+		size  uint64
 	}
 	uc_mcontext struct {
-		r8	uintptr
-		r9	uintptr
-		r10	uintptr
-		r11	uintptr
-		r12	uintptr
-		r13	uintptr
-		r14	uintptr
-		r15	uintptr
-		rdi	uintptr
-		rsi	uintptr
-		rbp	uintptr
-		rbx	uintptr
-		rdx	uintptr
-		rax	uintptr
-		rcx	uintptr
-		rsp	uintptr
-		rip	uintptr
-		eflags	uintptr
-		cs	uint16
-		gs	uint16
-		fs	uint16
-		__pad0	uint16
-		err	uintptr
-		trapno	uintptr
-		oldmask	uintptr
-		cr2	uintptr
-		fpptr	uintptr
-		res	[8]uintptr
-	}
-	uc_sigmask	uintptr
+		r8      uintptr
+		r9      uintptr
+		r10     uintptr
+		r11     uintptr
+		r12     uintptr
+		r13     uintptr
+		r14     uintptr
+		r15     uintptr
+		rdi     uintptr
+		rsi     uintptr
+		rbp     uintptr
+		rbx     uintptr
+		rdx     uintptr
+		rax     uintptr
+		rcx     uintptr
+		rsp     uintptr
+		rip     uintptr
+		eflags  uintptr
+		cs      uint16
+		gs      uint16
+		fs      uint16
+		__pad0  uint16
+		err     uintptr
+		trapno  uintptr
+		oldmask uintptr
+		cr2     uintptr
+		fpptr   uintptr
+		res     [8]uintptr
+	}
+	uc_sigmask uintptr
 }
 
 //go:nosplit
@@ -2876,7 +3124,7 @@ func mksig(t *thread_t, signo int32) {
 		pancake("no sig stack", t.sigstack)
 	}
 	// save old context for sigret
-	if t.tf[TF_RFLAGS] & TF_FL_IF == 0 {
+	if t.tf[TF_RFLAGS]&TF_FL_IF == 0 {
 		pancake("thread uninterruptible?", 0)
 	}
 	t.sigtf = t.tf
@@ -2942,12 +3190,12 @@ func find_empty(sz uintptr) uintptr {
 	cantuse := uintptr(0xf0)
 	for {
 		pte := pgdir_walk(v, false)
-		if pte == nil || (*pte != cantuse && *pte & PTE_P == 0) {
+		if pte == nil || (*pte != cantuse && *pte&PTE_P == 0) {
 			failed := false
 			for i := uintptr(0); i < sz; i += PGSIZE {
-				pte = pgdir_walk(v + i, false)
+				pte = pgdir_walk(v+i, false)
 				if pte != nil &&
-				    (*pte & PTE_P != 0 || *pte == cantuse) {
+					(*pte&PTE_P != 0 || *pte == cantuse) {
 					failed = true
 					v += i
 					break
@@ -2963,7 +3211,7 @@ func find_empty(sz uintptr) uintptr {
 
 func prot_none(v, sz uintptr) {
 	for i := uintptr(0); i < sz; i += PGSIZE {
-		pte := pgdir_walk(v + i, true)
+		pte := pgdir_walk(v+i, true)
 		if pte != nil {
 			*pte = *pte & ^PTE_P
 			invlpg(v + i)
@@ -3034,7 +3282,7 @@ func test_func_consist() {
 //var didsz uintptr
 
 func hack_mmap(va, _sz uintptr, _prot uint32, _flags uint32,
-    fd int32, offset int32) (uintptr, int) {
+	fd int32, offset int32) (uintptr, int) {
 	fl := Pushcli()
 	Splock(maplock)
 
@@ -3069,12 +3317,12 @@ func hack_mmap(va, _sz uintptr, _prot uint32, _flags uint32,
 	//_pnum(sz); _pmsg("\n")
 	//_pnum(va + sz); _pmsg("\n")
 	//_pnum(vaend); _pmsg("\n")
-	if va >= vaend || va + sz >= vaend {
+	if va >= vaend || va+sz >= vaend {
 		pancake("va space exhausted", va)
 	}
 
 	t = MAP_ANON | MAP_PRIVATE
-	if flags & t != t {
+	if flags&t != t {
 		pancake("unexpected flags", flags)
 	}
 	perms = PTE_P
@@ -3085,7 +3333,7 @@ func hack_mmap(va, _sz uintptr, _prot uint32, _flags uint32,
 		goto out
 	}
 
-	if prot & PROT_WRITE != 0 {
+	if prot&PROT_WRITE != 0 {
 		perms |= PTE_W
 	}
 
@@ -3094,14 +3342,14 @@ func hack_mmap(va, _sz uintptr, _prot uint32, _flags uint32,
 		for sidx := pml4x(va); sidx <= eidx; sidx++ {
 			pml4 := caddr(VREC, VREC, VREC, VREC, sidx)
 			pml4e := (*uintptr)(unsafe.Pointer(pml4))
-			if *pml4e & PTE_P == 0 {
+			if *pml4e&PTE_P == 0 {
 				pancake("new pml4 entry to kernel pmap", va)
 			}
 		}
 	}
 
 	for i := uintptr(0); i < sz; i += PGSIZE {
-		alloc_map(va + i, perms, true)
+		alloc_map(va+i, perms, true)
 	}
 	ret = va
 	//didsz += sz
@@ -3123,7 +3371,7 @@ func hack_munmap(v, _sz uintptr) {
 			pancake("high unmap", va)
 		}
 		// XXX goodbye, memory
-		if pte != nil && *pte & PTE_P != 0 {
+		if pte != nil && *pte&PTE_P != 0 {
 			// make sure these pages aren't remapped via
 			// hack_munmap
 			*pte = cantuse
@@ -3158,7 +3406,7 @@ func hack_clone(flags uint32, rsp uintptr, mp *m, gp *g, fn uintptr) int32 {
 	// _CLONE_SYSVSEM is specified only for strict qemu-arm64 checks; the
 	// runtime doesn't use sysv sems, fortunately
 	chk := uint32(_CLONE_VM | _CLONE_FS | _CLONE_FILES | _CLONE_SIGHAND |
-	    _CLONE_THREAD | _CLONE_SYSVSEM)
+		_CLONE_THREAD | _CLONE_SYSVSEM)
 	if flags != chk {
 		pancake("unexpected clone args", uintptr(flags))
 	}
@@ -3211,8 +3459,8 @@ func hack_setitimer(timer uint32, new, old *itimerval) {
 
 	fl := Pushcli()
 	ct := Gscpu().mythread
-	nsecs := new.it_interval.tv_sec * 1000000000 +
-	    new.it_interval.tv_usec * 1000
+	nsecs := new.it_interval.tv_sec*1000000000 +
+		new.it_interval.tv_usec*1000
 	if nsecs != 0 {
 		ct.prof.enabled = 1
 	} else {
@@ -3235,7 +3483,7 @@ func hack_sigaltstack(new, old *stackt) {
 		}
 	}
 	if new != nil {
-		if new.ss_flags & SS_DISABLE != 0 {
+		if new.ss_flags&SS_DISABLE != 0 {
 			ct.sigstack = 0
 			ct.sigsize = 0
 		} else {
@@ -3264,7 +3512,7 @@ func hack_write(fd int, bufn uintptr, sz uint32) int64 {
 
 // "/etc/localtime"
 var fnwhite = []int8{0x2f, 0x65, 0x74, 0x63, 0x2f, 0x6c, 0x6f, 0x63, 0x61,
-    0x6c, 0x74, 0x69, 0x6d, 0x65}
+	0x6c, 0x74, 0x69, 0x6d, 0x65}
 
 // a is the C string.
 func cstrmatch(a uintptr, b []int8) bool {
@@ -3302,9 +3550,10 @@ var futexlock = &Spinlock_t{}
 // a system call and thus calls "entersyscallblock" which sets a flag that
 // causes a panic if the stack needs to be split or if the g is preempted
 // (though stackcheck() call below makes sure the stack is not overflowed).
+//
 //go:nosplit
 func hack_futex(uaddr *int32, op, val int32, to *timespec, uaddr2 *int32,
-    val2 int32) int64 {
+	val2 int32) int64 {
 	stackcheck()
 	FUTEX_WAIT := int32(0) | _FUTEX_PRIVATE_FLAG
 	FUTEX_WAKE := int32(1) | _FUTEX_PRIVATE_FLAG
@@ -3366,8 +3615,8 @@ func hack_futex(uaddr *int32, op, val int32, to *timespec, uaddr2 *int32,
 
 func hack_usleep(delay int64) {
 	ts := timespec{}
-	ts.tv_sec = delay/1000000
-	ts.tv_nsec = (delay%1000000)*1000
+	ts.tv_sec = delay / 1000000
+	ts.tv_nsec = (delay % 1000000) * 1000
 	dummy := int32(0)
 	FUTEX_WAIT := int32(0) | _FUTEX_PRIVATE_FLAG
 	hack_futex(&dummy, FUTEX_WAIT, 0, &ts, nil, 0)
@@ -3385,16 +3634,17 @@ func hack_exit(code int32) {
 }
 
 // called in interupt context
+//
 //go:nosplit
 func hack_nanotime() int {
 	cyc := uint(Rdtsc())
-	return int(cyc*Pspercycle/1000)
+	return int(cyc * Pspercycle / 1000)
 }
 
 func Vtop(va unsafe.Pointer) (uintptr, bool) {
 	van := uintptr(va)
 	pte := pgdir_walk(van, false)
-	if pte == nil || *pte & PTE_P == 0 {
+	if pte == nil || *pte&PTE_P == 0 {
 		return 0, false
 	}
 	base := pte_addr(*pte)
@@ -3403,6 +3653,7 @@ func Vtop(va unsafe.Pointer) (uintptr, bool) {
 
 // XXX also called in interupt context; remove when trapstub is moved into
 // runtime
+//
 //go:nosplit
 func Nanotime() int {
 	return hack_nanotime()
@@ -3418,6 +3669,7 @@ func Crash() {
 
 // XXX also called in interupt context; remove when trapstub is moved into
 // runtime
+//
 //go:nosplit
 func Pnum(n int) {
 	pnum(uintptr(n))
@@ -3499,23 +3751,23 @@ func GCPacerToggle() {
 	}
 }
 
-//type Resobjs_t [_NumSizeClasses]uint32
+// type Resobjs_t [_NumSizeClasses]uint32
 // at the time of writing, biscuit allocates from 24 size classes.
 // Objsadd/Objssub assumes this is an array of 24 uint32s; fix Objsadd if you
 // change this type.
 type Resobjs_t [24]uint32 // NOTICE ABOVE!
 
 type Res_t struct {
-	Objs	Resobjs_t
+	Objs Resobjs_t
 }
 
 var _centralres = struct {
-	avail		Res_t
-	tmp		Res_t
+	avail Res_t
+	tmp   Res_t
 	// XXX remove when maxlive supports sizeclasses
-	maxheap		int64
+	maxheap int64
 }{
-	avail: Res_t{Resobjs_t{1: uint32(_maxheap)}},
+	avail:   Res_t{Resobjs_t{1: uint32(_maxheap)}},
 	maxheap: _maxheap,
 }
 
@@ -3548,14 +3800,14 @@ func robcentral(scidx int, want uint32) uint32 {
 			return 0
 		}
 		took := want
-		if atomic.Cas(p, left, left - took) {
+		if atomic.Cas(p, left, left-took) {
 			return took
 		}
 	}
 }
 
-var Maxa	uint32
-var Byuf	[]uintptr
+var Maxa uint32
+var Byuf []uintptr
 
 func casbt(ne uint32) {
 	for {
@@ -3588,7 +3840,7 @@ func Greserve(want *Res_t) bool {
 	} else {
 		//mc.robs++
 		for i := 0; i < len(mc.avail.Objs); i++ {
-			if m & (1 << uint(i)) != 0 {
+			if m&(1<<uint(i)) != 0 {
 				//mc.robi++
 				rob := robcentral(i, want.Objs[i])
 				if rob == 0 {
@@ -3692,6 +3944,7 @@ func getsig(i uint32) uintptr {
 }
 
 // setSignaltstackSP sets the ss_sp field of a stackt.
+//
 //go:nosplit
 func setSignalstackSP(s *stackt, sp uintptr) {
 	*(*uintptr)(unsafe.Pointer(&s.ss_sp)) = sp
@@ -3701,6 +3954,7 @@ func (c *sigctxt) fixsigcode(sig uint32) {
 }
 
 // sysSigaction calls the rt_sigaction system call.
+//
 //go:nosplit
 func sysSigaction(sig uint32, new, old *sigactiont) {
 	if rt_sigaction(uintptr(sig), new, old, unsafe.Sizeof(sigactiont{}.sa_mask)) != 0 {
@@ -3712,5 +3966,6 @@ func sysSigaction(sig uint32, new, old *sigactiont) {
 }
 
 // rt_sigaction is implemented in assembly.
+//
 //go:noescape
 func rt_sigaction(sig uintptr, new, old *sigactiont, size uintptr) int32
@@ -2220,6 +2220,7 @@ top:
 		}
 	}
 	IRQcheck(_g_.m.p.ptr())
+	affcheck(_g_.m.p.ptr())
 	if *cgo_yield != nil {
 		asmcgocall(*cgo_yield, nil)
 	}
@@ -2536,6 +2537,7 @@ top:
 		}
 	}
 	if gp == nil {
+		affcheck(_g_.m.p.ptr())
 		gp, inheritTime = runqget(_g_.m.p.ptr())
 		if gp != nil && _g_.m.spinning {
 			throw("schedule: spinning with local work")
@@ -2552,6 +2554,12 @@ top:
 		resetspinning()
 	}
 
+	// a goroutine whose CPU affinity excludes this P is queued for an
+	// allowed P instead
+	if !schedok(gp, _g_.m.p.ptr()) {
+		goto top
+	}
+
 	if gp.lockedm != 0 {
 		// Hands off own p to the locked m,
 		// then blocks waiting for a new p.
@@ -2672,6 +2680,7 @@ func goexit0(gp *g) {
 	}
 	gp.current = nil
 	gp.allused = false
+	gp.sclass, gp.sprio, gp.sticks, gp.smask = 0, 0, 0, 0
 	if a := gp.res1.Objs[1]; hackmode != 0 && a != 0 {
 		print("leaked res! ", a, "\n")
 	}
@@ -4681,6 +4690,7 @@ func runqput(_p_ *p, gp *g, next bool) {
 	if randomizeScheduler && next && fastrand()%2 == 0 {
 		next = false
 	}
+	next = schednext(_p_, gp, next)
 
 	if next {
 	retryNext:
@@ -407,6 +407,12 @@ type g struct {
 	allused	bool
 	//robc	int
 	current		unsafe.Pointer
+	// the scheduling class, priority, elapsed time slice ticks and
+	// allowed Ps of a user thread; see Setsched
+	sclass		int32
+	sprio		int32
+	sticks		int32
+	smask		uint64
 }
 
 type m struct {
@@ -560,6 +566,11 @@ type p struct {
 
 	runSafePointFn uint32 // if 1, run sched.safePointFn at next safe point
 
+	// the start of the current realtime period and the ticks which
+	// realtime threads used during it; see rtthrottled
+	rtstart	int
+	rtused	int32
+
 	pad [sys.CacheLineSize]byte
 }
 